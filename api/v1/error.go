@@ -1,14 +1,21 @@
 package log_v1
 
 import (
+	"encoding/base64"
 	"fmt"
+	"strconv"
 
 	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
 
 type ErrOffsetOutOfRange struct {
 	Offset uint64
+	// LogStartOffset is the lowest offset of the log, see DeleteBeforeRequest.
+	LogStartOffset uint64
+	// HighestOffset is the offset of the log's last record, zero if there is none.
+	HighestOffset uint64
 }
 
 func (e ErrOffsetOutOfRange) GRPCStatus() *status.Status {
@@ -20,7 +27,15 @@ func (e ErrOffsetOutOfRange) GRPCStatus() *status.Status {
 		Message: msg,
 	}
 
-	std, err := st.WithDetails(d)
+	std, err := st.WithDetails(d, &errdetails.ErrorInfo{
+		Reason: offsetOutOfRangeReason,
+		Domain: errorDomain,
+		Metadata: map[string]string{
+			"offset":           strconv.FormatUint(e.Offset, 10),
+			"log_start_offset": strconv.FormatUint(e.LogStartOffset, 10),
+			"highest_offset":   strconv.FormatUint(e.HighestOffset, 10),
+		},
+	})
 	if err != nil {
 		return st
 	}
@@ -31,3 +46,477 @@ func (e ErrOffsetOutOfRange) GRPCStatus() *status.Status {
 func (e ErrOffsetOutOfRange) Error() string {
 	return e.GRPCStatus().Err().Error()
 }
+
+// OffsetOutOfRangeFromError extracts the ErrOffsetOutOfRange carried by a gRPC error.
+func OffsetOutOfRangeFromError(err error) (ErrOffsetOutOfRange, bool) {
+	e, ok := FromError(err).(ErrOffsetOutOfRange)
+	return e, ok
+}
+
+type ErrBookmarkNotFound struct {
+	Name string
+}
+
+func (e ErrBookmarkNotFound) GRPCStatus() *status.Status {
+	st := status.New(codes.NotFound, fmt.Sprintf("bookmark not found: %q", e.Name))
+	return withInfo(st, bookmarkNotFoundReason, map[string]string{"name": e.Name})
+}
+
+func (e ErrBookmarkNotFound) Error() string {
+	return e.GRPCStatus().Err().Error()
+}
+
+// ErrOffsetNotCommitted is returned for consumer groups which haven't
+// committed an offset for the topic yet.
+type ErrOffsetNotCommitted struct {
+	Group string
+	Topic string
+}
+
+func (e ErrOffsetNotCommitted) GRPCStatus() *status.Status {
+	st := status.New(codes.NotFound, fmt.Sprintf("group %q has no committed offset for topic %q", e.Group, e.Topic))
+	return withInfo(st, offsetNotCommittedReason, map[string]string{"group": e.Group, "topic": e.Topic})
+}
+
+func (e ErrOffsetNotCommitted) Error() string {
+	return e.GRPCStatus().Err().Error()
+}
+
+// The errors' statuses carry an errdetails.ErrorInfo of the domain, its
+// reason tells the error apart and its metadata holds the error's fields, see
+// FromStatus.
+const (
+	errorDomain           = "proglog"
+	notLeaderReason       = "NOT_LEADER"
+	recordTooLargeReason  = "RECORD_TOO_LARGE"
+	schemaViolationReason = "SCHEMA_VIOLATION"
+	// offsetOutOfRangeReason carries the log start offset
+	offsetOutOfRangeReason   = "OFFSET_OUT_OF_RANGE"
+	bookmarkNotFoundReason   = "BOOKMARK_NOT_FOUND"
+	offsetNotCommittedReason = "OFFSET_NOT_COMMITTED"
+	duplicateSequenceReason  = "DUPLICATE_SEQUENCE"
+	outOfOrderSequenceReason = "OUT_OF_ORDER_SEQUENCE"
+	invalidTopicReason       = "INVALID_TOPIC"
+	topicExistsReason        = "TOPIC_EXISTS"
+	topicNotFoundReason      = "TOPIC_NOT_FOUND"
+	topicDeletedReason       = "TOPIC_DELETED"
+	corruptRecordReason      = "CORRUPT_RECORD"
+	quotaExceededReason      = "QUOTA_EXCEEDED"
+	readOnlyReason           = "READ_ONLY"
+	diskFullReason           = "DISK_FULL"
+	// keyNotFoundReason carries the key base64 encoded, it needn't be UTF-8
+	keyNotFoundReason        = "KEY_NOT_FOUND"
+	keyIndexDisabledReason   = "KEY_INDEX_DISABLED"
+	slowConsumerReason       = "SLOW_CONSUMER"
+	compactionDisabledReason = "COMPACTION_DISABLED"
+)
+
+// withInfo attaches the error info of the reason to the status.
+func withInfo(st *status.Status, reason string, metadata map[string]string) *status.Status {
+	std, err := st.WithDetails(&errdetails.ErrorInfo{
+		Reason:   reason,
+		Domain:   errorDomain,
+		Metadata: metadata,
+	})
+	if err != nil {
+		return st
+	}
+	return std
+}
+
+// FromStatus restores the error a status carries, e.g. an ErrNotLeader, so
+// clients can switch on the error's type. Other statuses are returned as
+// their error, which is nil for OK.
+func FromStatus(st *status.Status) error {
+	for _, d := range st.Details() {
+		info, ok := d.(*errdetails.ErrorInfo)
+		if !ok || info.Domain != errorDomain {
+			continue
+		}
+		m := info.Metadata
+		switch info.Reason {
+		case offsetOutOfRangeReason:
+			return ErrOffsetOutOfRange{Offset: parseUint(m["offset"]), LogStartOffset: parseUint(m["log_start_offset"]), HighestOffset: parseUint(m["highest_offset"])}
+		case notLeaderReason:
+			return ErrNotLeader{LeaderAddr: m["leader_addr"], Term: parseUint(m["term"])}
+		case recordTooLargeReason:
+			return ErrRecordTooLarge{Size: parseUint(m["size"]), Limit: parseUint(m["limit"])}
+		case schemaViolationReason:
+			return ErrSchemaViolation{Topic: m["topic"], Schema: m["schema"], Violation: m["violation"]}
+		case bookmarkNotFoundReason:
+			return ErrBookmarkNotFound{Name: m["name"]}
+		case offsetNotCommittedReason:
+			return ErrOffsetNotCommitted{Group: m["group"], Topic: m["topic"]}
+		case duplicateSequenceReason:
+			return ErrDuplicateSequence{ProducerID: m["producer_id"], Sequence: parseUint(m["sequence"]), LastSequence: parseUint(m["last_sequence"])}
+		case outOfOrderSequenceReason:
+			return ErrOutOfOrderSequence{ProducerID: m["producer_id"], Sequence: parseUint(m["sequence"]), Expected: parseUint(m["expected"])}
+		case invalidTopicReason:
+			return ErrInvalidTopic{Topic: m["topic"]}
+		case topicExistsReason:
+			return ErrTopicExists{Topic: m["topic"]}
+		case topicNotFoundReason:
+			return ErrTopicNotFound{Topic: m["topic"]}
+		case topicDeletedReason:
+			return ErrTopicDeleted{Topic: m["topic"]}
+		case corruptRecordReason:
+			return ErrCorruptRecord{Offset: parseUint(m["offset"])}
+		case quotaExceededReason:
+			return ErrQuotaExceeded{Tenant: m["tenant"], Quota: parseUint(m["quota"])}
+		case diskFullReason:
+			return ErrDiskFull{Usage: parseUint(m["usage"]), HighWatermark: parseUint(m["high_watermark"])}
+		case keyNotFoundReason:
+			key, _ := base64.StdEncoding.DecodeString(m["key"])
+			return ErrKeyNotFound{Key: key}
+		case keyIndexDisabledReason:
+			return ErrKeyIndexDisabled{Topic: m["topic"]}
+		case slowConsumerReason:
+			return ErrSlowConsumer{Topic: m["topic"], Lag: parseUint(m["lag"])}
+		case compactionDisabledReason:
+			return ErrCompactionDisabled{Topic: m["topic"]}
+		case readOnlyReason:
+			return ErrReadOnly{Cluster: m["cluster"] == "true", Reason: m["reason"]}
+		}
+	}
+	return st.Err()
+}
+
+// FromError is FromStatus for the errors of RPCs, errors which aren't
+// statuses are returned as they are.
+func FromError(err error) error {
+	st, ok := status.FromError(err)
+	if !ok {
+		return err
+	}
+	return FromStatus(st)
+}
+
+func parseUint(s string) uint64 {
+	n, _ := strconv.ParseUint(s, 10, 64)
+	return n
+}
+
+// ErrNotLeader is returned by followers for requests only the leader can serve.
+type ErrNotLeader struct {
+	// LeaderAddr is the RPC address of the current leader, empty if unknown.
+	LeaderAddr string
+	Term       uint64
+}
+
+func (e ErrNotLeader) GRPCStatus() *status.Status {
+	st := status.New(codes.FailedPrecondition, fmt.Sprintf("not the leader, leader is %q", e.LeaderAddr))
+	return withInfo(st, notLeaderReason, map[string]string{
+		"leader_addr": e.LeaderAddr,
+		"term":        strconv.FormatUint(e.Term, 10),
+	})
+}
+
+func (e ErrNotLeader) Error() string {
+	return e.GRPCStatus().Err().Error()
+}
+
+// NotLeaderFromError extracts the ErrNotLeader carried by a gRPC error.
+func NotLeaderFromError(err error) (ErrNotLeader, bool) {
+	e, ok := FromError(err).(ErrNotLeader)
+	return e, ok
+}
+
+// ErrRecordTooLarge is returned for records whose encoded size exceeds the
+// configured limit.
+type ErrRecordTooLarge struct {
+	Size  uint64
+	Limit uint64
+}
+
+func (e ErrRecordTooLarge) GRPCStatus() *status.Status {
+	st := status.New(codes.InvalidArgument, fmt.Sprintf("record of %d bytes exceeds the limit of %d bytes", e.Size, e.Limit))
+	return withInfo(st, recordTooLargeReason, map[string]string{
+		"size":  strconv.FormatUint(e.Size, 10),
+		"limit": strconv.FormatUint(e.Limit, 10),
+	})
+}
+
+func (e ErrRecordTooLarge) Error() string {
+	return e.GRPCStatus().Err().Error()
+}
+
+// RecordTooLargeFromError extracts the ErrRecordTooLarge carried by a gRPC error.
+func RecordTooLargeFromError(err error) (ErrRecordTooLarge, bool) {
+	e, ok := FromError(err).(ErrRecordTooLarge)
+	return e, ok
+}
+
+// ErrSchemaViolation is returned for records whose value doesn't match the
+// schema registered for their topic.
+type ErrSchemaViolation struct {
+	Topic string
+	// Schema names the schema, e.g. the protobuf message's full name.
+	Schema string
+	// Violation tells what's wrong with the value.
+	Violation string
+}
+
+func (e ErrSchemaViolation) GRPCStatus() *status.Status {
+	st := status.New(codes.InvalidArgument, fmt.Sprintf("record doesn't match schema %s of topic %q: %s", e.Schema, e.Topic, e.Violation))
+	return withInfo(st, schemaViolationReason, map[string]string{
+		"topic":     e.Topic,
+		"schema":    e.Schema,
+		"violation": e.Violation,
+	})
+}
+
+func (e ErrSchemaViolation) Error() string {
+	return e.GRPCStatus().Err().Error()
+}
+
+// SchemaViolationFromError extracts the ErrSchemaViolation carried by a gRPC error.
+func SchemaViolationFromError(err error) (ErrSchemaViolation, bool) {
+	e, ok := FromError(err).(ErrSchemaViolation)
+	return e, ok
+}
+
+// ErrDuplicateSequence is returned for retried records of an idempotent
+// producer which were appended before its latest append, so their offsets are
+// no longer known.
+type ErrDuplicateSequence struct {
+	ProducerID   string
+	Sequence     uint64
+	LastSequence uint64
+}
+
+func (e ErrDuplicateSequence) GRPCStatus() *status.Status {
+	st := status.New(codes.AlreadyExists, fmt.Sprintf("producer %q already appended sequence %d, last is %d", e.ProducerID, e.Sequence, e.LastSequence))
+	return withInfo(st, duplicateSequenceReason, map[string]string{
+		"producer_id":   e.ProducerID,
+		"sequence":      strconv.FormatUint(e.Sequence, 10),
+		"last_sequence": strconv.FormatUint(e.LastSequence, 10),
+	})
+}
+
+func (e ErrDuplicateSequence) Error() string {
+	return e.GRPCStatus().Err().Error()
+}
+
+// ErrOutOfOrderSequence is returned for records of an idempotent producer
+// which don't continue its sequence, e.g. because records were lost in between.
+type ErrOutOfOrderSequence struct {
+	ProducerID string
+	Sequence   uint64
+	Expected   uint64
+}
+
+func (e ErrOutOfOrderSequence) GRPCStatus() *status.Status {
+	st := status.New(codes.FailedPrecondition, fmt.Sprintf("producer %q sent sequence %d, expected %d", e.ProducerID, e.Sequence, e.Expected))
+	return withInfo(st, outOfOrderSequenceReason, map[string]string{
+		"producer_id": e.ProducerID,
+		"sequence":    strconv.FormatUint(e.Sequence, 10),
+		"expected":    strconv.FormatUint(e.Expected, 10),
+	})
+}
+
+func (e ErrOutOfOrderSequence) Error() string {
+	return e.GRPCStatus().Err().Error()
+}
+
+type ErrInvalidTopic struct {
+	Topic string
+}
+
+func (e ErrInvalidTopic) GRPCStatus() *status.Status {
+	st := status.New(codes.InvalidArgument, fmt.Sprintf("invalid topic name: %q", e.Topic))
+	return withInfo(st, invalidTopicReason, map[string]string{"topic": e.Topic})
+}
+
+func (e ErrInvalidTopic) Error() string {
+	return e.GRPCStatus().Err().Error()
+}
+
+// ErrTopicExists is returned for creating a topic which exists already.
+type ErrTopicExists struct {
+	Topic string
+}
+
+func (e ErrTopicExists) GRPCStatus() *status.Status {
+	st := status.New(codes.AlreadyExists, fmt.Sprintf("topic exists already: %q", e.Topic))
+	return withInfo(st, topicExistsReason, map[string]string{"topic": e.Topic})
+}
+
+func (e ErrTopicExists) Error() string {
+	return e.GRPCStatus().Err().Error()
+}
+
+// ErrTopicNotFound is returned by the admin operations on topics which don't exist.
+type ErrTopicNotFound struct {
+	Topic string
+}
+
+func (e ErrTopicNotFound) GRPCStatus() *status.Status {
+	st := status.New(codes.NotFound, fmt.Sprintf("topic not found: %q", e.Topic))
+	return withInfo(st, topicNotFoundReason, map[string]string{"topic": e.Topic})
+}
+
+func (e ErrTopicNotFound) Error() string {
+	return e.GRPCStatus().Err().Error()
+}
+
+// ErrTopicDeleted is returned for creating or appending to a topic which was
+// deleted but can still be undeleted.
+type ErrTopicDeleted struct {
+	Topic string
+}
+
+func (e ErrTopicDeleted) GRPCStatus() *status.Status {
+	st := status.New(codes.FailedPrecondition, fmt.Sprintf("topic is deleted: %q", e.Topic))
+	return withInfo(st, topicDeletedReason, map[string]string{"topic": e.Topic})
+}
+
+func (e ErrTopicDeleted) Error() string {
+	return e.GRPCStatus().Err().Error()
+}
+
+// ErrCorruptRecord is returned for records whose checksum doesn't match their data.
+type ErrCorruptRecord struct {
+	Offset uint64
+}
+
+func (e ErrCorruptRecord) GRPCStatus() *status.Status {
+	st := status.New(codes.DataLoss, fmt.Sprintf("record at offset %d is corrupt", e.Offset))
+	return withInfo(st, corruptRecordReason, map[string]string{"offset": strconv.FormatUint(e.Offset, 10)})
+}
+
+func (e ErrCorruptRecord) Error() string {
+	return e.GRPCStatus().Err().Error()
+}
+
+// ErrQuotaExceeded is returned for appends to the topics of a tenant whose
+// records take up its storage quota.
+type ErrQuotaExceeded struct {
+	Tenant string
+	Quota  uint64
+}
+
+func (e ErrQuotaExceeded) GRPCStatus() *status.Status {
+	st := status.New(codes.ResourceExhausted, fmt.Sprintf("tenant %q exceeds its storage quota of %d bytes", e.Tenant, e.Quota))
+	return withInfo(st, quotaExceededReason, map[string]string{
+		"tenant": e.Tenant,
+		"quota":  strconv.FormatUint(e.Quota, 10),
+	})
+}
+
+func (e ErrQuotaExceeded) Error() string {
+	return e.GRPCStatus().Err().Error()
+}
+
+// ErrReadOnly is returned for appends to a server or cluster in read-only
+// mode, see ReadOnlyMode.
+type ErrReadOnly struct {
+	// Cluster tells whether the cluster is read-only rather than the server.
+	Cluster bool
+	Reason  string
+}
+
+func (e ErrReadOnly) GRPCStatus() *status.Status {
+	scope := "server"
+	if e.Cluster {
+		scope = "cluster"
+	}
+	msg := fmt.Sprintf("%s is read-only", scope)
+	if e.Reason != "" {
+		msg += ": " + e.Reason
+	}
+	st := status.New(codes.FailedPrecondition, msg)
+	return withInfo(st, readOnlyReason, map[string]string{
+		"cluster": strconv.FormatBool(e.Cluster),
+		"reason":  e.Reason,
+	})
+}
+
+func (e ErrReadOnly) Error() string {
+	return e.GRPCStatus().Err().Error()
+}
+
+// ErrDiskFull is returned for appends to a server whose data takes up more
+// disk space than its high watermark allows.
+type ErrDiskFull struct {
+	Usage         uint64
+	HighWatermark uint64
+}
+
+func (e ErrDiskFull) GRPCStatus() *status.Status {
+	st := status.New(codes.ResourceExhausted, fmt.Sprintf("disk usage of %d bytes exceeds the high watermark of %d bytes", e.Usage, e.HighWatermark))
+	return withInfo(st, diskFullReason, map[string]string{
+		"usage":          strconv.FormatUint(e.Usage, 10),
+		"high_watermark": strconv.FormatUint(e.HighWatermark, 10),
+	})
+}
+
+func (e ErrDiskFull) Error() string {
+	return e.GRPCStatus().Err().Error()
+}
+
+// ErrKeyNotFound is returned for lookups by key of keys without readable
+// record, e.g. because it expired or was deleted.
+type ErrKeyNotFound struct {
+	Key []byte
+}
+
+func (e ErrKeyNotFound) GRPCStatus() *status.Status {
+	st := status.New(codes.NotFound, fmt.Sprintf("key not found: %q", e.Key))
+	return withInfo(st, keyNotFoundReason, map[string]string{"key": base64.StdEncoding.EncodeToString(e.Key)})
+}
+
+func (e ErrKeyNotFound) Error() string {
+	return e.GRPCStatus().Err().Error()
+}
+
+// ErrKeyIndexDisabled is returned for lookups by key in topics which don't
+// index their records' keys, see TopicConfig.key_index.
+type ErrKeyIndexDisabled struct {
+	Topic string
+}
+
+func (e ErrKeyIndexDisabled) GRPCStatus() *status.Status {
+	st := status.New(codes.FailedPrecondition, fmt.Sprintf("topic %q has no key index", e.Topic))
+	return withInfo(st, keyIndexDisabledReason, map[string]string{"topic": e.Topic})
+}
+
+func (e ErrKeyIndexDisabled) Error() string {
+	return e.GRPCStatus().Err().Error()
+}
+
+// ErrSlowConsumer ends ConsumeStreams whose consumer falls too far behind the
+// topic or stops receiving, see the server's StreamLimits. Streams reopened
+// at an offset still too far behind are ended again, such consumers skip
+// ahead instead.
+type ErrSlowConsumer struct {
+	Topic string
+	// Lag is the number of records the consumer was behind the topic's end
+	Lag uint64
+}
+
+func (e ErrSlowConsumer) GRPCStatus() *status.Status {
+	st := status.New(codes.ResourceExhausted, fmt.Sprintf("consumer of topic %q is too slow, it's %d records behind", e.Topic, e.Lag))
+	return withInfo(st, slowConsumerReason, map[string]string{
+		"topic": e.Topic,
+		"lag":   strconv.FormatUint(e.Lag, 10),
+	})
+}
+
+func (e ErrSlowConsumer) Error() string {
+	return e.GRPCStatus().Err().Error()
+}
+
+// ErrCompactionDisabled is returned for compactions run on demand on topics
+// which don't compact their records, see TopicConfig.compact.
+type ErrCompactionDisabled struct {
+	Topic string
+}
+
+func (e ErrCompactionDisabled) GRPCStatus() *status.Status {
+	st := status.New(codes.FailedPrecondition, fmt.Sprintf("topic %q isn't compacted", e.Topic))
+	return withInfo(st, compactionDisabledReason, map[string]string{"topic": e.Topic})
+}
+
+func (e ErrCompactionDisabled) Error() string {
+	return e.GRPCStatus().Err().Error()
+}
@@ -0,0 +1,65 @@
+package log_v1
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestFromError(t *testing.T) {
+	errs := map[string]error{
+		"offset out of range":   ErrOffsetOutOfRange{Offset: 3, LogStartOffset: 1, HighestOffset: 2},
+		"not leader":            ErrNotLeader{LeaderAddr: "127.0.0.1:8400", Term: 2},
+		"record too large":      ErrRecordTooLarge{Size: 2048, Limit: 1024},
+		"schema violation":      ErrSchemaViolation{Topic: "orders", Schema: "Order", Violation: "missing id"},
+		"bookmark not found":    ErrBookmarkNotFound{Name: "nightly"},
+		"offset not committed":  ErrOffsetNotCommitted{Group: "billing", Topic: "orders"},
+		"duplicate sequence":    ErrDuplicateSequence{ProducerID: "p", Sequence: 1, LastSequence: 2},
+		"out of order sequence": ErrOutOfOrderSequence{ProducerID: "p", Sequence: 3, Expected: 2},
+		"invalid topic":         ErrInvalidTopic{Topic: "a/b"},
+		"topic exists":          ErrTopicExists{Topic: "orders"},
+		"topic not found":       ErrTopicNotFound{Topic: "orders"},
+		"topic deleted":         ErrTopicDeleted{Topic: "orders"},
+		"corrupt record":        ErrCorruptRecord{Offset: 7},
+		"quota exceeded":        ErrQuotaExceeded{Tenant: "acme", Quota: 1 << 20},
+		"read only":             ErrReadOnly{Cluster: true, Reason: "maintenance"},
+		"disk full":             ErrDiskFull{Usage: 2 << 30, HighWatermark: 1 << 30},
+		"key not found":         ErrKeyNotFound{Key: []byte{0xff, 'k'}},
+		"key index disabled":    ErrKeyIndexDisabled{Topic: "orders"},
+		"slow consumer":         ErrSlowConsumer{Topic: "orders", Lag: 1000},
+		"compaction disabled":   ErrCompactionDisabled{Topic: "orders"},
+	}
+
+	for name, want := range errs {
+		t.Run(name, func(t *testing.T) {
+			// arrange
+			st, ok := status.FromError(want)
+			require.True(t, ok)
+			// the status as received by a client
+			received := status.FromProto(st.Proto()).Err()
+
+			// act
+			got := FromError(received)
+
+			// assert
+			require.Equal(t, want, got)
+			require.Equal(t, want.Error(), got.Error())
+		})
+	}
+}
+
+func TestFromErrorOthers(t *testing.T) {
+	// act
+	plain := FromError(status.Error(codes.Unavailable, "unavailable"))
+	other := FromError(context.Canceled)
+	none := FromError(nil)
+
+	// assert
+	require.Equal(t, codes.Unavailable, status.Code(plain))
+	require.Equal(t, "unavailable", status.Convert(plain).Message())
+	require.ErrorIs(t, other, context.Canceled)
+	require.NoError(t, none)
+}
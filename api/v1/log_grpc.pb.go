@@ -19,11 +19,36 @@ import (
 const _ = grpc.SupportPackageIsVersion7
 
 const (
-	Log_Create_FullMethodName       = "/log.v1.Log/Create"
-	Log_CreateStream_FullMethodName = "/log.v1.Log/CreateStream"
-	Log_Get_FullMethodName          = "/log.v1.Log/Get"
-	Log_GetStream_FullMethodName    = "/log.v1.Log/GetStream"
-	Log_GetServers_FullMethodName   = "/log.v1.Log/GetServers"
+	Log_Create_FullMethodName            = "/log.v1.Log/Create"
+	Log_CreateBatch_FullMethodName       = "/log.v1.Log/CreateBatch"
+	Log_CreateStream_FullMethodName      = "/log.v1.Log/CreateStream"
+	Log_CreateTransaction_FullMethodName = "/log.v1.Log/CreateTransaction"
+	Log_Delete_FullMethodName            = "/log.v1.Log/Delete"
+	Log_Get_FullMethodName               = "/log.v1.Log/Get"
+	Log_GetStream_FullMethodName         = "/log.v1.Log/GetStream"
+	Log_ConsumeStream_FullMethodName     = "/log.v1.Log/ConsumeStream"
+	Log_GetMany_FullMethodName           = "/log.v1.Log/GetMany"
+	Log_GetRange_FullMethodName          = "/log.v1.Log/GetRange"
+	Log_GetByTime_FullMethodName         = "/log.v1.Log/GetByTime"
+	Log_GetByKey_FullMethodName          = "/log.v1.Log/GetByKey"
+	Log_LowestOffset_FullMethodName      = "/log.v1.Log/LowestOffset"
+	Log_HighestOffset_FullMethodName     = "/log.v1.Log/HighestOffset"
+	Log_Watch_FullMethodName             = "/log.v1.Log/Watch"
+	Log_SetBookmark_FullMethodName       = "/log.v1.Log/SetBookmark"
+	Log_GetBookmark_FullMethodName       = "/log.v1.Log/GetBookmark"
+	Log_DeleteBookmark_FullMethodName    = "/log.v1.Log/DeleteBookmark"
+	Log_CommitOffset_FullMethodName      = "/log.v1.Log/CommitOffset"
+	Log_FetchOffset_FullMethodName       = "/log.v1.Log/FetchOffset"
+	Log_GetSegmentStats_FullMethodName   = "/log.v1.Log/GetSegmentStats"
+	Log_GetLogStats_FullMethodName       = "/log.v1.Log/GetLogStats"
+	Log_Verify_FullMethodName            = "/log.v1.Log/Verify"
+	Log_Truncate_FullMethodName          = "/log.v1.Log/Truncate"
+	Log_DeleteBefore_FullMethodName      = "/log.v1.Log/DeleteBefore"
+	Log_Backup_FullMethodName            = "/log.v1.Log/Backup"
+	Log_GetServers_FullMethodName        = "/log.v1.Log/GetServers"
+	Log_Join_FullMethodName              = "/log.v1.Log/Join"
+	Log_Leave_FullMethodName             = "/log.v1.Log/Leave"
+	Log_ReloadConfig_FullMethodName      = "/log.v1.Log/ReloadConfig"
 )
 
 // LogClient is the client API for Log service.
@@ -31,10 +56,35 @@ const (
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
 type LogClient interface {
 	Create(ctx context.Context, in *CreateRecordRequest, opts ...grpc.CallOption) (*CreateRecordResponse, error)
+	CreateBatch(ctx context.Context, in *CreateRecordBatchRequest, opts ...grpc.CallOption) (*CreateRecordBatchResponse, error)
 	CreateStream(ctx context.Context, opts ...grpc.CallOption) (Log_CreateStreamClient, error)
+	CreateTransaction(ctx context.Context, in *CreateTransactionRequest, opts ...grpc.CallOption) (*CreateTransactionResponse, error)
+	Delete(ctx context.Context, in *DeleteRecordRequest, opts ...grpc.CallOption) (*DeleteRecordResponse, error)
 	Get(ctx context.Context, in *GetRecordRequest, opts ...grpc.CallOption) (*GetRecordResponse, error)
 	GetStream(ctx context.Context, opts ...grpc.CallOption) (Log_GetStreamClient, error)
+	ConsumeStream(ctx context.Context, in *GetRecordRequest, opts ...grpc.CallOption) (Log_ConsumeStreamClient, error)
+	GetMany(ctx context.Context, in *GetManyRequest, opts ...grpc.CallOption) (*GetManyResponse, error)
+	GetRange(ctx context.Context, in *GetRangeRequest, opts ...grpc.CallOption) (*GetRangeResponse, error)
+	GetByTime(ctx context.Context, in *GetByTimeRequest, opts ...grpc.CallOption) (*GetByTimeResponse, error)
+	GetByKey(ctx context.Context, in *GetByKeyRequest, opts ...grpc.CallOption) (*GetByKeyResponse, error)
+	LowestOffset(ctx context.Context, in *LowestOffsetRequest, opts ...grpc.CallOption) (*LowestOffsetResponse, error)
+	HighestOffset(ctx context.Context, in *HighestOffsetRequest, opts ...grpc.CallOption) (*HighestOffsetResponse, error)
+	Watch(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (Log_WatchClient, error)
+	SetBookmark(ctx context.Context, in *SetBookmarkRequest, opts ...grpc.CallOption) (*SetBookmarkResponse, error)
+	GetBookmark(ctx context.Context, in *GetBookmarkRequest, opts ...grpc.CallOption) (*GetBookmarkResponse, error)
+	DeleteBookmark(ctx context.Context, in *DeleteBookmarkRequest, opts ...grpc.CallOption) (*DeleteBookmarkResponse, error)
+	CommitOffset(ctx context.Context, in *CommitOffsetRequest, opts ...grpc.CallOption) (*CommitOffsetResponse, error)
+	FetchOffset(ctx context.Context, in *FetchOffsetRequest, opts ...grpc.CallOption) (*FetchOffsetResponse, error)
+	GetSegmentStats(ctx context.Context, in *GetSegmentStatsRequest, opts ...grpc.CallOption) (*GetSegmentStatsResponse, error)
+	GetLogStats(ctx context.Context, in *GetLogStatsRequest, opts ...grpc.CallOption) (*GetLogStatsResponse, error)
+	Verify(ctx context.Context, in *VerifyRequest, opts ...grpc.CallOption) (*VerifyResponse, error)
+	Truncate(ctx context.Context, in *TruncateRequest, opts ...grpc.CallOption) (*TruncateResponse, error)
+	DeleteBefore(ctx context.Context, in *DeleteBeforeRequest, opts ...grpc.CallOption) (*DeleteBeforeResponse, error)
+	Backup(ctx context.Context, in *BackupRequest, opts ...grpc.CallOption) (Log_BackupClient, error)
 	GetServers(ctx context.Context, in *GetServersRequest, opts ...grpc.CallOption) (*GetServersResponse, error)
+	Join(ctx context.Context, in *JoinRequest, opts ...grpc.CallOption) (*JoinResponse, error)
+	Leave(ctx context.Context, in *LeaveRequest, opts ...grpc.CallOption) (*LeaveResponse, error)
+	ReloadConfig(ctx context.Context, in *ReloadConfigRequest, opts ...grpc.CallOption) (*ReloadConfigResponse, error)
 }
 
 type logClient struct {
@@ -54,6 +104,15 @@ func (c *logClient) Create(ctx context.Context, in *CreateRecordRequest, opts ..
 	return out, nil
 }
 
+func (c *logClient) CreateBatch(ctx context.Context, in *CreateRecordBatchRequest, opts ...grpc.CallOption) (*CreateRecordBatchResponse, error) {
+	out := new(CreateRecordBatchResponse)
+	err := c.cc.Invoke(ctx, Log_CreateBatch_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *logClient) CreateStream(ctx context.Context, opts ...grpc.CallOption) (Log_CreateStreamClient, error) {
 	stream, err := c.cc.NewStream(ctx, &Log_ServiceDesc.Streams[0], Log_CreateStream_FullMethodName, opts...)
 	if err != nil {
@@ -85,6 +144,24 @@ func (x *logCreateStreamClient) Recv() (*CreateRecordResponse, error) {
 	return m, nil
 }
 
+func (c *logClient) CreateTransaction(ctx context.Context, in *CreateTransactionRequest, opts ...grpc.CallOption) (*CreateTransactionResponse, error) {
+	out := new(CreateTransactionResponse)
+	err := c.cc.Invoke(ctx, Log_CreateTransaction_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *logClient) Delete(ctx context.Context, in *DeleteRecordRequest, opts ...grpc.CallOption) (*DeleteRecordResponse, error) {
+	out := new(DeleteRecordResponse)
+	err := c.cc.Invoke(ctx, Log_Delete_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *logClient) Get(ctx context.Context, in *GetRecordRequest, opts ...grpc.CallOption) (*GetRecordResponse, error) {
 	out := new(GetRecordResponse)
 	err := c.cc.Invoke(ctx, Log_Get_FullMethodName, in, out, opts...)
@@ -125,6 +202,246 @@ func (x *logGetStreamClient) Recv() (*GetRecordResponse, error) {
 	return m, nil
 }
 
+func (c *logClient) ConsumeStream(ctx context.Context, in *GetRecordRequest, opts ...grpc.CallOption) (Log_ConsumeStreamClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Log_ServiceDesc.Streams[2], Log_ConsumeStream_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &logConsumeStreamClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Log_ConsumeStreamClient interface {
+	Recv() (*GetRecordResponse, error)
+	grpc.ClientStream
+}
+
+type logConsumeStreamClient struct {
+	grpc.ClientStream
+}
+
+func (x *logConsumeStreamClient) Recv() (*GetRecordResponse, error) {
+	m := new(GetRecordResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *logClient) GetMany(ctx context.Context, in *GetManyRequest, opts ...grpc.CallOption) (*GetManyResponse, error) {
+	out := new(GetManyResponse)
+	err := c.cc.Invoke(ctx, Log_GetMany_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *logClient) GetRange(ctx context.Context, in *GetRangeRequest, opts ...grpc.CallOption) (*GetRangeResponse, error) {
+	out := new(GetRangeResponse)
+	err := c.cc.Invoke(ctx, Log_GetRange_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *logClient) GetByTime(ctx context.Context, in *GetByTimeRequest, opts ...grpc.CallOption) (*GetByTimeResponse, error) {
+	out := new(GetByTimeResponse)
+	err := c.cc.Invoke(ctx, Log_GetByTime_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *logClient) GetByKey(ctx context.Context, in *GetByKeyRequest, opts ...grpc.CallOption) (*GetByKeyResponse, error) {
+	out := new(GetByKeyResponse)
+	err := c.cc.Invoke(ctx, Log_GetByKey_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *logClient) LowestOffset(ctx context.Context, in *LowestOffsetRequest, opts ...grpc.CallOption) (*LowestOffsetResponse, error) {
+	out := new(LowestOffsetResponse)
+	err := c.cc.Invoke(ctx, Log_LowestOffset_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *logClient) HighestOffset(ctx context.Context, in *HighestOffsetRequest, opts ...grpc.CallOption) (*HighestOffsetResponse, error) {
+	out := new(HighestOffsetResponse)
+	err := c.cc.Invoke(ctx, Log_HighestOffset_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *logClient) Watch(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (Log_WatchClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Log_ServiceDesc.Streams[3], Log_Watch_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &logWatchClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Log_WatchClient interface {
+	Recv() (*HighWatermark, error)
+	grpc.ClientStream
+}
+
+type logWatchClient struct {
+	grpc.ClientStream
+}
+
+func (x *logWatchClient) Recv() (*HighWatermark, error) {
+	m := new(HighWatermark)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *logClient) SetBookmark(ctx context.Context, in *SetBookmarkRequest, opts ...grpc.CallOption) (*SetBookmarkResponse, error) {
+	out := new(SetBookmarkResponse)
+	err := c.cc.Invoke(ctx, Log_SetBookmark_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *logClient) GetBookmark(ctx context.Context, in *GetBookmarkRequest, opts ...grpc.CallOption) (*GetBookmarkResponse, error) {
+	out := new(GetBookmarkResponse)
+	err := c.cc.Invoke(ctx, Log_GetBookmark_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *logClient) DeleteBookmark(ctx context.Context, in *DeleteBookmarkRequest, opts ...grpc.CallOption) (*DeleteBookmarkResponse, error) {
+	out := new(DeleteBookmarkResponse)
+	err := c.cc.Invoke(ctx, Log_DeleteBookmark_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *logClient) CommitOffset(ctx context.Context, in *CommitOffsetRequest, opts ...grpc.CallOption) (*CommitOffsetResponse, error) {
+	out := new(CommitOffsetResponse)
+	err := c.cc.Invoke(ctx, Log_CommitOffset_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *logClient) FetchOffset(ctx context.Context, in *FetchOffsetRequest, opts ...grpc.CallOption) (*FetchOffsetResponse, error) {
+	out := new(FetchOffsetResponse)
+	err := c.cc.Invoke(ctx, Log_FetchOffset_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *logClient) GetSegmentStats(ctx context.Context, in *GetSegmentStatsRequest, opts ...grpc.CallOption) (*GetSegmentStatsResponse, error) {
+	out := new(GetSegmentStatsResponse)
+	err := c.cc.Invoke(ctx, Log_GetSegmentStats_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *logClient) GetLogStats(ctx context.Context, in *GetLogStatsRequest, opts ...grpc.CallOption) (*GetLogStatsResponse, error) {
+	out := new(GetLogStatsResponse)
+	err := c.cc.Invoke(ctx, Log_GetLogStats_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *logClient) Verify(ctx context.Context, in *VerifyRequest, opts ...grpc.CallOption) (*VerifyResponse, error) {
+	out := new(VerifyResponse)
+	err := c.cc.Invoke(ctx, Log_Verify_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *logClient) Truncate(ctx context.Context, in *TruncateRequest, opts ...grpc.CallOption) (*TruncateResponse, error) {
+	out := new(TruncateResponse)
+	err := c.cc.Invoke(ctx, Log_Truncate_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *logClient) DeleteBefore(ctx context.Context, in *DeleteBeforeRequest, opts ...grpc.CallOption) (*DeleteBeforeResponse, error) {
+	out := new(DeleteBeforeResponse)
+	err := c.cc.Invoke(ctx, Log_DeleteBefore_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *logClient) Backup(ctx context.Context, in *BackupRequest, opts ...grpc.CallOption) (Log_BackupClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Log_ServiceDesc.Streams[4], Log_Backup_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &logBackupClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Log_BackupClient interface {
+	Recv() (*BackupChunk, error)
+	grpc.ClientStream
+}
+
+type logBackupClient struct {
+	grpc.ClientStream
+}
+
+func (x *logBackupClient) Recv() (*BackupChunk, error) {
+	m := new(BackupChunk)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 func (c *logClient) GetServers(ctx context.Context, in *GetServersRequest, opts ...grpc.CallOption) (*GetServersResponse, error) {
 	out := new(GetServersResponse)
 	err := c.cc.Invoke(ctx, Log_GetServers_FullMethodName, in, out, opts...)
@@ -134,15 +451,67 @@ func (c *logClient) GetServers(ctx context.Context, in *GetServersRequest, opts
 	return out, nil
 }
 
+func (c *logClient) Join(ctx context.Context, in *JoinRequest, opts ...grpc.CallOption) (*JoinResponse, error) {
+	out := new(JoinResponse)
+	err := c.cc.Invoke(ctx, Log_Join_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *logClient) Leave(ctx context.Context, in *LeaveRequest, opts ...grpc.CallOption) (*LeaveResponse, error) {
+	out := new(LeaveResponse)
+	err := c.cc.Invoke(ctx, Log_Leave_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *logClient) ReloadConfig(ctx context.Context, in *ReloadConfigRequest, opts ...grpc.CallOption) (*ReloadConfigResponse, error) {
+	out := new(ReloadConfigResponse)
+	err := c.cc.Invoke(ctx, Log_ReloadConfig_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // LogServer is the server API for Log service.
 // All implementations must embed UnimplementedLogServer
 // for forward compatibility
 type LogServer interface {
 	Create(context.Context, *CreateRecordRequest) (*CreateRecordResponse, error)
+	CreateBatch(context.Context, *CreateRecordBatchRequest) (*CreateRecordBatchResponse, error)
 	CreateStream(Log_CreateStreamServer) error
+	CreateTransaction(context.Context, *CreateTransactionRequest) (*CreateTransactionResponse, error)
+	Delete(context.Context, *DeleteRecordRequest) (*DeleteRecordResponse, error)
 	Get(context.Context, *GetRecordRequest) (*GetRecordResponse, error)
 	GetStream(Log_GetStreamServer) error
+	ConsumeStream(*GetRecordRequest, Log_ConsumeStreamServer) error
+	GetMany(context.Context, *GetManyRequest) (*GetManyResponse, error)
+	GetRange(context.Context, *GetRangeRequest) (*GetRangeResponse, error)
+	GetByTime(context.Context, *GetByTimeRequest) (*GetByTimeResponse, error)
+	GetByKey(context.Context, *GetByKeyRequest) (*GetByKeyResponse, error)
+	LowestOffset(context.Context, *LowestOffsetRequest) (*LowestOffsetResponse, error)
+	HighestOffset(context.Context, *HighestOffsetRequest) (*HighestOffsetResponse, error)
+	Watch(*WatchRequest, Log_WatchServer) error
+	SetBookmark(context.Context, *SetBookmarkRequest) (*SetBookmarkResponse, error)
+	GetBookmark(context.Context, *GetBookmarkRequest) (*GetBookmarkResponse, error)
+	DeleteBookmark(context.Context, *DeleteBookmarkRequest) (*DeleteBookmarkResponse, error)
+	CommitOffset(context.Context, *CommitOffsetRequest) (*CommitOffsetResponse, error)
+	FetchOffset(context.Context, *FetchOffsetRequest) (*FetchOffsetResponse, error)
+	GetSegmentStats(context.Context, *GetSegmentStatsRequest) (*GetSegmentStatsResponse, error)
+	GetLogStats(context.Context, *GetLogStatsRequest) (*GetLogStatsResponse, error)
+	Verify(context.Context, *VerifyRequest) (*VerifyResponse, error)
+	Truncate(context.Context, *TruncateRequest) (*TruncateResponse, error)
+	DeleteBefore(context.Context, *DeleteBeforeRequest) (*DeleteBeforeResponse, error)
+	Backup(*BackupRequest, Log_BackupServer) error
 	GetServers(context.Context, *GetServersRequest) (*GetServersResponse, error)
+	Join(context.Context, *JoinRequest) (*JoinResponse, error)
+	Leave(context.Context, *LeaveRequest) (*LeaveResponse, error)
+	ReloadConfig(context.Context, *ReloadConfigRequest) (*ReloadConfigResponse, error)
 	mustEmbedUnimplementedLogServer()
 }
 
@@ -153,18 +522,93 @@ type UnimplementedLogServer struct {
 func (UnimplementedLogServer) Create(context.Context, *CreateRecordRequest) (*CreateRecordResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Create not implemented")
 }
+func (UnimplementedLogServer) CreateBatch(context.Context, *CreateRecordBatchRequest) (*CreateRecordBatchResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateBatch not implemented")
+}
 func (UnimplementedLogServer) CreateStream(Log_CreateStreamServer) error {
 	return status.Errorf(codes.Unimplemented, "method CreateStream not implemented")
 }
+func (UnimplementedLogServer) CreateTransaction(context.Context, *CreateTransactionRequest) (*CreateTransactionResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateTransaction not implemented")
+}
+func (UnimplementedLogServer) Delete(context.Context, *DeleteRecordRequest) (*DeleteRecordResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Delete not implemented")
+}
 func (UnimplementedLogServer) Get(context.Context, *GetRecordRequest) (*GetRecordResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Get not implemented")
 }
 func (UnimplementedLogServer) GetStream(Log_GetStreamServer) error {
 	return status.Errorf(codes.Unimplemented, "method GetStream not implemented")
 }
+func (UnimplementedLogServer) ConsumeStream(*GetRecordRequest, Log_ConsumeStreamServer) error {
+	return status.Errorf(codes.Unimplemented, "method ConsumeStream not implemented")
+}
+func (UnimplementedLogServer) GetMany(context.Context, *GetManyRequest) (*GetManyResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetMany not implemented")
+}
+func (UnimplementedLogServer) GetRange(context.Context, *GetRangeRequest) (*GetRangeResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetRange not implemented")
+}
+func (UnimplementedLogServer) GetByTime(context.Context, *GetByTimeRequest) (*GetByTimeResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetByTime not implemented")
+}
+func (UnimplementedLogServer) GetByKey(context.Context, *GetByKeyRequest) (*GetByKeyResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetByKey not implemented")
+}
+func (UnimplementedLogServer) LowestOffset(context.Context, *LowestOffsetRequest) (*LowestOffsetResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method LowestOffset not implemented")
+}
+func (UnimplementedLogServer) HighestOffset(context.Context, *HighestOffsetRequest) (*HighestOffsetResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method HighestOffset not implemented")
+}
+func (UnimplementedLogServer) Watch(*WatchRequest, Log_WatchServer) error {
+	return status.Errorf(codes.Unimplemented, "method Watch not implemented")
+}
+func (UnimplementedLogServer) SetBookmark(context.Context, *SetBookmarkRequest) (*SetBookmarkResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetBookmark not implemented")
+}
+func (UnimplementedLogServer) GetBookmark(context.Context, *GetBookmarkRequest) (*GetBookmarkResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetBookmark not implemented")
+}
+func (UnimplementedLogServer) DeleteBookmark(context.Context, *DeleteBookmarkRequest) (*DeleteBookmarkResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteBookmark not implemented")
+}
+func (UnimplementedLogServer) CommitOffset(context.Context, *CommitOffsetRequest) (*CommitOffsetResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CommitOffset not implemented")
+}
+func (UnimplementedLogServer) FetchOffset(context.Context, *FetchOffsetRequest) (*FetchOffsetResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method FetchOffset not implemented")
+}
+func (UnimplementedLogServer) GetSegmentStats(context.Context, *GetSegmentStatsRequest) (*GetSegmentStatsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetSegmentStats not implemented")
+}
+func (UnimplementedLogServer) GetLogStats(context.Context, *GetLogStatsRequest) (*GetLogStatsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetLogStats not implemented")
+}
+func (UnimplementedLogServer) Verify(context.Context, *VerifyRequest) (*VerifyResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Verify not implemented")
+}
+func (UnimplementedLogServer) Truncate(context.Context, *TruncateRequest) (*TruncateResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Truncate not implemented")
+}
+func (UnimplementedLogServer) DeleteBefore(context.Context, *DeleteBeforeRequest) (*DeleteBeforeResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteBefore not implemented")
+}
+func (UnimplementedLogServer) Backup(*BackupRequest, Log_BackupServer) error {
+	return status.Errorf(codes.Unimplemented, "method Backup not implemented")
+}
 func (UnimplementedLogServer) GetServers(context.Context, *GetServersRequest) (*GetServersResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method GetServers not implemented")
 }
+func (UnimplementedLogServer) Join(context.Context, *JoinRequest) (*JoinResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Join not implemented")
+}
+func (UnimplementedLogServer) Leave(context.Context, *LeaveRequest) (*LeaveResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Leave not implemented")
+}
+func (UnimplementedLogServer) ReloadConfig(context.Context, *ReloadConfigRequest) (*ReloadConfigResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ReloadConfig not implemented")
+}
 func (UnimplementedLogServer) mustEmbedUnimplementedLogServer() {}
 
 // UnsafeLogServer may be embedded to opt out of forward compatibility for this service.
@@ -196,6 +640,24 @@ func _Log_Create_Handler(srv interface{}, ctx context.Context, dec func(interfac
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Log_CreateBatch_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateRecordBatchRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LogServer).CreateBatch(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Log_CreateBatch_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LogServer).CreateBatch(ctx, req.(*CreateRecordBatchRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 func _Log_CreateStream_Handler(srv interface{}, stream grpc.ServerStream) error {
 	return srv.(LogServer).CreateStream(&logCreateStreamServer{stream})
 }
@@ -222,26 +684,62 @@ func (x *logCreateStreamServer) Recv() (*CreateRecordRequest, error) {
 	return m, nil
 }
 
-func _Log_Get_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(GetRecordRequest)
+func _Log_CreateTransaction_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateTransactionRequest)
 	if err := dec(in); err != nil {
 		return nil, err
 	}
 	if interceptor == nil {
-		return srv.(LogServer).Get(ctx, in)
+		return srv.(LogServer).CreateTransaction(ctx, in)
 	}
 	info := &grpc.UnaryServerInfo{
 		Server:     srv,
-		FullMethod: Log_Get_FullMethodName,
+		FullMethod: Log_CreateTransaction_FullMethodName,
 	}
 	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(LogServer).Get(ctx, req.(*GetRecordRequest))
+		return srv.(LogServer).CreateTransaction(ctx, req.(*CreateTransactionRequest))
 	}
 	return interceptor(ctx, in, info, handler)
 }
 
-func _Log_GetStream_Handler(srv interface{}, stream grpc.ServerStream) error {
-	return srv.(LogServer).GetStream(&logGetStreamServer{stream})
+func _Log_Delete_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteRecordRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LogServer).Delete(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Log_Delete_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LogServer).Delete(ctx, req.(*DeleteRecordRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Log_Get_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetRecordRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LogServer).Get(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Log_Get_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LogServer).Get(ctx, req.(*GetRecordRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Log_GetStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(LogServer).GetStream(&logGetStreamServer{stream})
 }
 
 type Log_GetStreamServer interface {
@@ -250,73 +748,1004 @@ type Log_GetStreamServer interface {
 	grpc.ServerStream
 }
 
-type logGetStreamServer struct {
-	grpc.ServerStream
+type logGetStreamServer struct {
+	grpc.ServerStream
+}
+
+func (x *logGetStreamServer) Send(m *GetRecordResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *logGetStreamServer) Recv() (*GetRecordRequest, error) {
+	m := new(GetRecordRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _Log_ConsumeStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(GetRecordRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(LogServer).ConsumeStream(m, &logConsumeStreamServer{stream})
+}
+
+type Log_ConsumeStreamServer interface {
+	Send(*GetRecordResponse) error
+	grpc.ServerStream
+}
+
+type logConsumeStreamServer struct {
+	grpc.ServerStream
+}
+
+func (x *logConsumeStreamServer) Send(m *GetRecordResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Log_GetMany_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetManyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LogServer).GetMany(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Log_GetMany_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LogServer).GetMany(ctx, req.(*GetManyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Log_GetRange_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetRangeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LogServer).GetRange(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Log_GetRange_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LogServer).GetRange(ctx, req.(*GetRangeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Log_GetByTime_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetByTimeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LogServer).GetByTime(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Log_GetByTime_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LogServer).GetByTime(ctx, req.(*GetByTimeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Log_GetByKey_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetByKeyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LogServer).GetByKey(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Log_GetByKey_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LogServer).GetByKey(ctx, req.(*GetByKeyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Log_LowestOffset_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(LowestOffsetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LogServer).LowestOffset(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Log_LowestOffset_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LogServer).LowestOffset(ctx, req.(*LowestOffsetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Log_HighestOffset_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(HighestOffsetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LogServer).HighestOffset(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Log_HighestOffset_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LogServer).HighestOffset(ctx, req.(*HighestOffsetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Log_Watch_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(LogServer).Watch(m, &logWatchServer{stream})
+}
+
+type Log_WatchServer interface {
+	Send(*HighWatermark) error
+	grpc.ServerStream
+}
+
+type logWatchServer struct {
+	grpc.ServerStream
+}
+
+func (x *logWatchServer) Send(m *HighWatermark) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Log_SetBookmark_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetBookmarkRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LogServer).SetBookmark(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Log_SetBookmark_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LogServer).SetBookmark(ctx, req.(*SetBookmarkRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Log_GetBookmark_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetBookmarkRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LogServer).GetBookmark(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Log_GetBookmark_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LogServer).GetBookmark(ctx, req.(*GetBookmarkRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Log_DeleteBookmark_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteBookmarkRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LogServer).DeleteBookmark(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Log_DeleteBookmark_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LogServer).DeleteBookmark(ctx, req.(*DeleteBookmarkRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Log_CommitOffset_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CommitOffsetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LogServer).CommitOffset(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Log_CommitOffset_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LogServer).CommitOffset(ctx, req.(*CommitOffsetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Log_FetchOffset_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(FetchOffsetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LogServer).FetchOffset(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Log_FetchOffset_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LogServer).FetchOffset(ctx, req.(*FetchOffsetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Log_GetSegmentStats_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetSegmentStatsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LogServer).GetSegmentStats(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Log_GetSegmentStats_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LogServer).GetSegmentStats(ctx, req.(*GetSegmentStatsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Log_GetLogStats_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetLogStatsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LogServer).GetLogStats(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Log_GetLogStats_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LogServer).GetLogStats(ctx, req.(*GetLogStatsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Log_Verify_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(VerifyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LogServer).Verify(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Log_Verify_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LogServer).Verify(ctx, req.(*VerifyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Log_Truncate_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TruncateRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LogServer).Truncate(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Log_Truncate_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LogServer).Truncate(ctx, req.(*TruncateRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Log_DeleteBefore_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteBeforeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LogServer).DeleteBefore(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Log_DeleteBefore_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LogServer).DeleteBefore(ctx, req.(*DeleteBeforeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Log_Backup_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(BackupRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(LogServer).Backup(m, &logBackupServer{stream})
+}
+
+type Log_BackupServer interface {
+	Send(*BackupChunk) error
+	grpc.ServerStream
+}
+
+type logBackupServer struct {
+	grpc.ServerStream
+}
+
+func (x *logBackupServer) Send(m *BackupChunk) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Log_GetServers_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetServersRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LogServer).GetServers(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Log_GetServers_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LogServer).GetServers(ctx, req.(*GetServersRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Log_Join_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(JoinRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LogServer).Join(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Log_Join_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LogServer).Join(ctx, req.(*JoinRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Log_Leave_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(LeaveRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LogServer).Leave(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Log_Leave_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LogServer).Leave(ctx, req.(*LeaveRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Log_ReloadConfig_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReloadConfigRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LogServer).ReloadConfig(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Log_ReloadConfig_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LogServer).ReloadConfig(ctx, req.(*ReloadConfigRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Log_ServiceDesc is the grpc.ServiceDesc for Log service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Log_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "log.v1.Log",
+	HandlerType: (*LogServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Create",
+			Handler:    _Log_Create_Handler,
+		},
+		{
+			MethodName: "CreateBatch",
+			Handler:    _Log_CreateBatch_Handler,
+		},
+		{
+			MethodName: "CreateTransaction",
+			Handler:    _Log_CreateTransaction_Handler,
+		},
+		{
+			MethodName: "Delete",
+			Handler:    _Log_Delete_Handler,
+		},
+		{
+			MethodName: "Get",
+			Handler:    _Log_Get_Handler,
+		},
+		{
+			MethodName: "GetMany",
+			Handler:    _Log_GetMany_Handler,
+		},
+		{
+			MethodName: "GetRange",
+			Handler:    _Log_GetRange_Handler,
+		},
+		{
+			MethodName: "GetByTime",
+			Handler:    _Log_GetByTime_Handler,
+		},
+		{
+			MethodName: "GetByKey",
+			Handler:    _Log_GetByKey_Handler,
+		},
+		{
+			MethodName: "LowestOffset",
+			Handler:    _Log_LowestOffset_Handler,
+		},
+		{
+			MethodName: "HighestOffset",
+			Handler:    _Log_HighestOffset_Handler,
+		},
+		{
+			MethodName: "SetBookmark",
+			Handler:    _Log_SetBookmark_Handler,
+		},
+		{
+			MethodName: "GetBookmark",
+			Handler:    _Log_GetBookmark_Handler,
+		},
+		{
+			MethodName: "DeleteBookmark",
+			Handler:    _Log_DeleteBookmark_Handler,
+		},
+		{
+			MethodName: "CommitOffset",
+			Handler:    _Log_CommitOffset_Handler,
+		},
+		{
+			MethodName: "FetchOffset",
+			Handler:    _Log_FetchOffset_Handler,
+		},
+		{
+			MethodName: "GetSegmentStats",
+			Handler:    _Log_GetSegmentStats_Handler,
+		},
+		{
+			MethodName: "GetLogStats",
+			Handler:    _Log_GetLogStats_Handler,
+		},
+		{
+			MethodName: "Verify",
+			Handler:    _Log_Verify_Handler,
+		},
+		{
+			MethodName: "Truncate",
+			Handler:    _Log_Truncate_Handler,
+		},
+		{
+			MethodName: "DeleteBefore",
+			Handler:    _Log_DeleteBefore_Handler,
+		},
+		{
+			MethodName: "GetServers",
+			Handler:    _Log_GetServers_Handler,
+		},
+		{
+			MethodName: "Join",
+			Handler:    _Log_Join_Handler,
+		},
+		{
+			MethodName: "Leave",
+			Handler:    _Log_Leave_Handler,
+		},
+		{
+			MethodName: "ReloadConfig",
+			Handler:    _Log_ReloadConfig_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "CreateStream",
+			Handler:       _Log_CreateStream_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "GetStream",
+			Handler:       _Log_GetStream_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "ConsumeStream",
+			Handler:       _Log_ConsumeStream_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "Watch",
+			Handler:       _Log_Watch_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "Backup",
+			Handler:       _Log_Backup_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "api/v1/log.proto",
+}
+
+const (
+	Admin_CreateTopic_FullMethodName          = "/log.v1.Admin/CreateTopic"
+	Admin_DeleteTopic_FullMethodName          = "/log.v1.Admin/DeleteTopic"
+	Admin_UndeleteTopic_FullMethodName        = "/log.v1.Admin/UndeleteTopic"
+	Admin_DescribeTopic_FullMethodName        = "/log.v1.Admin/DescribeTopic"
+	Admin_ConfigureTopic_FullMethodName       = "/log.v1.Admin/ConfigureTopic"
+	Admin_ResetOffsets_FullMethodName         = "/log.v1.Admin/ResetOffsets"
+	Admin_SetReadOnly_FullMethodName          = "/log.v1.Admin/SetReadOnly"
+	Admin_GetReadOnly_FullMethodName          = "/log.v1.Admin/GetReadOnly"
+	Admin_RunMaintenance_FullMethodName       = "/log.v1.Admin/RunMaintenance"
+	Admin_GetMaintenanceStatus_FullMethodName = "/log.v1.Admin/GetMaintenanceStatus"
+)
+
+// AdminClient is the client API for Admin service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type AdminClient interface {
+	CreateTopic(ctx context.Context, in *CreateTopicRequest, opts ...grpc.CallOption) (*CreateTopicResponse, error)
+	DeleteTopic(ctx context.Context, in *DeleteTopicRequest, opts ...grpc.CallOption) (*DeleteTopicResponse, error)
+	UndeleteTopic(ctx context.Context, in *UndeleteTopicRequest, opts ...grpc.CallOption) (*UndeleteTopicResponse, error)
+	DescribeTopic(ctx context.Context, in *DescribeTopicRequest, opts ...grpc.CallOption) (*DescribeTopicResponse, error)
+	ConfigureTopic(ctx context.Context, in *ConfigureTopicRequest, opts ...grpc.CallOption) (*ConfigureTopicResponse, error)
+	ResetOffsets(ctx context.Context, in *ResetOffsetsRequest, opts ...grpc.CallOption) (*ResetOffsetsResponse, error)
+	SetReadOnly(ctx context.Context, in *SetReadOnlyRequest, opts ...grpc.CallOption) (*SetReadOnlyResponse, error)
+	GetReadOnly(ctx context.Context, in *GetReadOnlyRequest, opts ...grpc.CallOption) (*GetReadOnlyResponse, error)
+	RunMaintenance(ctx context.Context, in *RunMaintenanceRequest, opts ...grpc.CallOption) (*RunMaintenanceResponse, error)
+	GetMaintenanceStatus(ctx context.Context, in *GetMaintenanceStatusRequest, opts ...grpc.CallOption) (*GetMaintenanceStatusResponse, error)
 }
 
-func (x *logGetStreamServer) Send(m *GetRecordResponse) error {
-	return x.ServerStream.SendMsg(m)
+type adminClient struct {
+	cc grpc.ClientConnInterface
 }
 
-func (x *logGetStreamServer) Recv() (*GetRecordRequest, error) {
-	m := new(GetRecordRequest)
-	if err := x.ServerStream.RecvMsg(m); err != nil {
+func NewAdminClient(cc grpc.ClientConnInterface) AdminClient {
+	return &adminClient{cc}
+}
+
+func (c *adminClient) CreateTopic(ctx context.Context, in *CreateTopicRequest, opts ...grpc.CallOption) (*CreateTopicResponse, error) {
+	out := new(CreateTopicResponse)
+	err := c.cc.Invoke(ctx, Admin_CreateTopic_FullMethodName, in, out, opts...)
+	if err != nil {
 		return nil, err
 	}
-	return m, nil
+	return out, nil
 }
 
-func _Log_GetServers_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(GetServersRequest)
+func (c *adminClient) DeleteTopic(ctx context.Context, in *DeleteTopicRequest, opts ...grpc.CallOption) (*DeleteTopicResponse, error) {
+	out := new(DeleteTopicResponse)
+	err := c.cc.Invoke(ctx, Admin_DeleteTopic_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) UndeleteTopic(ctx context.Context, in *UndeleteTopicRequest, opts ...grpc.CallOption) (*UndeleteTopicResponse, error) {
+	out := new(UndeleteTopicResponse)
+	err := c.cc.Invoke(ctx, Admin_UndeleteTopic_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) DescribeTopic(ctx context.Context, in *DescribeTopicRequest, opts ...grpc.CallOption) (*DescribeTopicResponse, error) {
+	out := new(DescribeTopicResponse)
+	err := c.cc.Invoke(ctx, Admin_DescribeTopic_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) ConfigureTopic(ctx context.Context, in *ConfigureTopicRequest, opts ...grpc.CallOption) (*ConfigureTopicResponse, error) {
+	out := new(ConfigureTopicResponse)
+	err := c.cc.Invoke(ctx, Admin_ConfigureTopic_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) ResetOffsets(ctx context.Context, in *ResetOffsetsRequest, opts ...grpc.CallOption) (*ResetOffsetsResponse, error) {
+	out := new(ResetOffsetsResponse)
+	err := c.cc.Invoke(ctx, Admin_ResetOffsets_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) SetReadOnly(ctx context.Context, in *SetReadOnlyRequest, opts ...grpc.CallOption) (*SetReadOnlyResponse, error) {
+	out := new(SetReadOnlyResponse)
+	err := c.cc.Invoke(ctx, Admin_SetReadOnly_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) GetReadOnly(ctx context.Context, in *GetReadOnlyRequest, opts ...grpc.CallOption) (*GetReadOnlyResponse, error) {
+	out := new(GetReadOnlyResponse)
+	err := c.cc.Invoke(ctx, Admin_GetReadOnly_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) RunMaintenance(ctx context.Context, in *RunMaintenanceRequest, opts ...grpc.CallOption) (*RunMaintenanceResponse, error) {
+	out := new(RunMaintenanceResponse)
+	err := c.cc.Invoke(ctx, Admin_RunMaintenance_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adminClient) GetMaintenanceStatus(ctx context.Context, in *GetMaintenanceStatusRequest, opts ...grpc.CallOption) (*GetMaintenanceStatusResponse, error) {
+	out := new(GetMaintenanceStatusResponse)
+	err := c.cc.Invoke(ctx, Admin_GetMaintenanceStatus_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// AdminServer is the server API for Admin service.
+// All implementations must embed UnimplementedAdminServer
+// for forward compatibility
+type AdminServer interface {
+	CreateTopic(context.Context, *CreateTopicRequest) (*CreateTopicResponse, error)
+	DeleteTopic(context.Context, *DeleteTopicRequest) (*DeleteTopicResponse, error)
+	UndeleteTopic(context.Context, *UndeleteTopicRequest) (*UndeleteTopicResponse, error)
+	DescribeTopic(context.Context, *DescribeTopicRequest) (*DescribeTopicResponse, error)
+	ConfigureTopic(context.Context, *ConfigureTopicRequest) (*ConfigureTopicResponse, error)
+	ResetOffsets(context.Context, *ResetOffsetsRequest) (*ResetOffsetsResponse, error)
+	SetReadOnly(context.Context, *SetReadOnlyRequest) (*SetReadOnlyResponse, error)
+	GetReadOnly(context.Context, *GetReadOnlyRequest) (*GetReadOnlyResponse, error)
+	RunMaintenance(context.Context, *RunMaintenanceRequest) (*RunMaintenanceResponse, error)
+	GetMaintenanceStatus(context.Context, *GetMaintenanceStatusRequest) (*GetMaintenanceStatusResponse, error)
+	mustEmbedUnimplementedAdminServer()
+}
+
+// UnimplementedAdminServer must be embedded to have forward compatible implementations.
+type UnimplementedAdminServer struct {
+}
+
+func (UnimplementedAdminServer) CreateTopic(context.Context, *CreateTopicRequest) (*CreateTopicResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateTopic not implemented")
+}
+func (UnimplementedAdminServer) DeleteTopic(context.Context, *DeleteTopicRequest) (*DeleteTopicResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteTopic not implemented")
+}
+func (UnimplementedAdminServer) UndeleteTopic(context.Context, *UndeleteTopicRequest) (*UndeleteTopicResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UndeleteTopic not implemented")
+}
+func (UnimplementedAdminServer) DescribeTopic(context.Context, *DescribeTopicRequest) (*DescribeTopicResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DescribeTopic not implemented")
+}
+func (UnimplementedAdminServer) ConfigureTopic(context.Context, *ConfigureTopicRequest) (*ConfigureTopicResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ConfigureTopic not implemented")
+}
+func (UnimplementedAdminServer) ResetOffsets(context.Context, *ResetOffsetsRequest) (*ResetOffsetsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ResetOffsets not implemented")
+}
+func (UnimplementedAdminServer) SetReadOnly(context.Context, *SetReadOnlyRequest) (*SetReadOnlyResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetReadOnly not implemented")
+}
+func (UnimplementedAdminServer) GetReadOnly(context.Context, *GetReadOnlyRequest) (*GetReadOnlyResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetReadOnly not implemented")
+}
+func (UnimplementedAdminServer) RunMaintenance(context.Context, *RunMaintenanceRequest) (*RunMaintenanceResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RunMaintenance not implemented")
+}
+func (UnimplementedAdminServer) GetMaintenanceStatus(context.Context, *GetMaintenanceStatusRequest) (*GetMaintenanceStatusResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetMaintenanceStatus not implemented")
+}
+func (UnimplementedAdminServer) mustEmbedUnimplementedAdminServer() {}
+
+// UnsafeAdminServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to AdminServer will
+// result in compilation errors.
+type UnsafeAdminServer interface {
+	mustEmbedUnimplementedAdminServer()
+}
+
+func RegisterAdminServer(s grpc.ServiceRegistrar, srv AdminServer) {
+	s.RegisterService(&Admin_ServiceDesc, srv)
+}
+
+func _Admin_CreateTopic_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateTopicRequest)
 	if err := dec(in); err != nil {
 		return nil, err
 	}
 	if interceptor == nil {
-		return srv.(LogServer).GetServers(ctx, in)
+		return srv.(AdminServer).CreateTopic(ctx, in)
 	}
 	info := &grpc.UnaryServerInfo{
 		Server:     srv,
-		FullMethod: Log_GetServers_FullMethodName,
+		FullMethod: Admin_CreateTopic_FullMethodName,
 	}
 	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(LogServer).GetServers(ctx, req.(*GetServersRequest))
+		return srv.(AdminServer).CreateTopic(ctx, req.(*CreateTopicRequest))
 	}
 	return interceptor(ctx, in, info, handler)
 }
 
-// Log_ServiceDesc is the grpc.ServiceDesc for Log service.
+func _Admin_DeleteTopic_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteTopicRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).DeleteTopic(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Admin_DeleteTopic_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).DeleteTopic(ctx, req.(*DeleteTopicRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_UndeleteTopic_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UndeleteTopicRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).UndeleteTopic(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Admin_UndeleteTopic_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).UndeleteTopic(ctx, req.(*UndeleteTopicRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_DescribeTopic_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DescribeTopicRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).DescribeTopic(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Admin_DescribeTopic_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).DescribeTopic(ctx, req.(*DescribeTopicRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_ConfigureTopic_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ConfigureTopicRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).ConfigureTopic(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Admin_ConfigureTopic_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).ConfigureTopic(ctx, req.(*ConfigureTopicRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_ResetOffsets_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ResetOffsetsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).ResetOffsets(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Admin_ResetOffsets_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).ResetOffsets(ctx, req.(*ResetOffsetsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_SetReadOnly_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetReadOnlyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).SetReadOnly(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Admin_SetReadOnly_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).SetReadOnly(ctx, req.(*SetReadOnlyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_GetReadOnly_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetReadOnlyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).GetReadOnly(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Admin_GetReadOnly_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).GetReadOnly(ctx, req.(*GetReadOnlyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_RunMaintenance_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RunMaintenanceRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).RunMaintenance(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Admin_RunMaintenance_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).RunMaintenance(ctx, req.(*RunMaintenanceRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Admin_GetMaintenanceStatus_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetMaintenanceStatusRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServer).GetMaintenanceStatus(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Admin_GetMaintenanceStatus_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServer).GetMaintenanceStatus(ctx, req.(*GetMaintenanceStatusRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Admin_ServiceDesc is the grpc.ServiceDesc for Admin service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
-var Log_ServiceDesc = grpc.ServiceDesc{
-	ServiceName: "log.v1.Log",
-	HandlerType: (*LogServer)(nil),
+var Admin_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "log.v1.Admin",
+	HandlerType: (*AdminServer)(nil),
 	Methods: []grpc.MethodDesc{
 		{
-			MethodName: "Create",
-			Handler:    _Log_Create_Handler,
+			MethodName: "CreateTopic",
+			Handler:    _Admin_CreateTopic_Handler,
 		},
 		{
-			MethodName: "Get",
-			Handler:    _Log_Get_Handler,
+			MethodName: "DeleteTopic",
+			Handler:    _Admin_DeleteTopic_Handler,
 		},
 		{
-			MethodName: "GetServers",
-			Handler:    _Log_GetServers_Handler,
+			MethodName: "UndeleteTopic",
+			Handler:    _Admin_UndeleteTopic_Handler,
 		},
-	},
-	Streams: []grpc.StreamDesc{
 		{
-			StreamName:    "CreateStream",
-			Handler:       _Log_CreateStream_Handler,
-			ServerStreams: true,
-			ClientStreams: true,
+			MethodName: "DescribeTopic",
+			Handler:    _Admin_DescribeTopic_Handler,
 		},
 		{
-			StreamName:    "GetStream",
-			Handler:       _Log_GetStream_Handler,
-			ServerStreams: true,
-			ClientStreams: true,
+			MethodName: "ConfigureTopic",
+			Handler:    _Admin_ConfigureTopic_Handler,
+		},
+		{
+			MethodName: "ResetOffsets",
+			Handler:    _Admin_ResetOffsets_Handler,
+		},
+		{
+			MethodName: "SetReadOnly",
+			Handler:    _Admin_SetReadOnly_Handler,
+		},
+		{
+			MethodName: "GetReadOnly",
+			Handler:    _Admin_GetReadOnly_Handler,
+		},
+		{
+			MethodName: "RunMaintenance",
+			Handler:    _Admin_RunMaintenance_Handler,
+		},
+		{
+			MethodName: "GetMaintenanceStatus",
+			Handler:    _Admin_GetMaintenanceStatus_Handler,
 		},
 	},
+	Streams:  []grpc.StreamDesc{},
 	Metadata: "api/v1/log.proto",
 }
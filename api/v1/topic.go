@@ -0,0 +1,31 @@
+package log_v1
+
+import "strings"
+
+// DefaultTopic is used by requests which don't name a topic.
+const DefaultTopic = "default"
+
+// TenantSeparator separates the tenant from the name of a tenant's topic,
+// e.g. "team-a.orders".
+const TenantSeparator = "."
+
+// IdempotencyKeyProducer prefixes the ids of the producers made up for
+// produces with an idempotency key. Logs forget them after a while, unlike
+// the producers of clients.
+const IdempotencyKeyProducer = "idempotency-key/"
+
+// TenantTopic returns the name of the tenant's topic, the empty topic is the
+// tenant's default topic.
+func TenantTopic(tenant, topic string) string {
+	if topic == "" {
+		topic = DefaultTopic
+	}
+	return tenant + TenantSeparator + topic
+}
+
+// TopicTenant returns the tenant of a topic named by TenantTopic, ok is false
+// for topics without tenant.
+func TopicTenant(topic string) (tenant string, ok bool) {
+	tenant, _, ok = strings.Cut(topic, TenantSeparator)
+	return tenant, ok
+}
@@ -0,0 +1,118 @@
+// Package client wraps the generated log client with retries, a consumer
+// which resumes its stream, a buffered producer, consumer group processing
+// with dead-letter topics, a mirror copying topics between clusters and
+// end-to-end encryption of the records' values.
+package client
+
+import (
+	"context"
+	"time"
+
+	api "github.com/justagabriel/proglog/api/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// RetryPolicy controls how calls failing with Unavailable are retried.
+// Zero values are replaced by the defaults.
+type RetryPolicy struct {
+	// MaxAttempts includes the first attempt, defaults to 5.
+	MaxAttempts int
+	// InitialBackoff is doubled after every attempt, defaults to 100ms.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the backoff, defaults to 5s.
+	MaxBackoff time.Duration
+}
+
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	if p.MaxAttempts == 0 {
+		p.MaxAttempts = 5
+	}
+	if p.InitialBackoff == 0 {
+		p.InitialBackoff = 100 * time.Millisecond
+	}
+	if p.MaxBackoff == 0 {
+		p.MaxBackoff = 5 * time.Second
+	}
+	return p
+}
+
+// backoff returns how long to wait before the given retry, starting at 1.
+func (p RetryPolicy) backoff(retry int) time.Duration {
+	d := p.InitialBackoff
+	for i := 1; i < retry && d < p.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > p.MaxBackoff {
+		return p.MaxBackoff
+	}
+	return d
+}
+
+// sleep waits for the backoff of the retry, it fails once ctx is done.
+func (p RetryPolicy) sleep(ctx context.Context, retry int) error {
+	timer := time.NewTimer(p.backoff(retry))
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+type Config struct {
+	// Addr is the target dialed, e.g. "localhost:8400" or "proglog:///localhost:8400"
+	// to balance the calls across the cluster.
+	Addr string
+	// DialOptions are passed to grpc.Dial, e.g. the transport credentials.
+	DialOptions []grpc.DialOption
+	Retry       RetryPolicy
+}
+
+// Client is a log and admin client whose unary calls are retried on Unavailable.
+// The connection reconnects by itself, so retries pick up a new one.
+// Retried Creates may append the record twice unless it carries a producer
+// id, see Producer.
+type Client struct {
+	api.LogClient
+	api.AdminClient
+	conn  *grpc.ClientConn
+	retry RetryPolicy
+}
+
+func New(config Config) (*Client, error) {
+	retry := config.Retry.withDefaults()
+	opts := append([]grpc.DialOption{
+		grpc.WithChainUnaryInterceptor(retryUnary(retry)),
+	}, config.DialOptions...)
+	conn, err := grpc.Dial(config.Addr, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{
+		LogClient:   api.NewLogClient(conn),
+		AdminClient: api.NewAdminClient(conn),
+		conn:        conn,
+		retry:       retry,
+	}, nil
+}
+
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// retryUnary retries calls failing with Unavailable with exponential backoff.
+func retryUnary(policy RetryPolicy) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		for retry := 1; retry < policy.MaxAttempts && status.Code(err) == codes.Unavailable; retry++ {
+			if serr := policy.sleep(ctx, retry); serr != nil {
+				return err
+			}
+			err = invoker(ctx, method, req, reply, cc, opts...)
+		}
+		return err
+	}
+}
@@ -0,0 +1,229 @@
+package client
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	api "github.com/justagabriel/proglog/api/v1"
+	"github.com/justagabriel/proglog/internal/config"
+	"github.com/justagabriel/proglog/internal/server"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+)
+
+func TestRetryUnary(t *testing.T) {
+	scenarios := map[string]struct {
+		errs      []error
+		wantCalls int
+		wantCode  codes.Code
+	}{
+		"unavailable is retried": {
+			errs:      []error{status.Error(codes.Unavailable, ""), status.Error(codes.Unavailable, ""), nil},
+			wantCalls: 3,
+			wantCode:  codes.OK,
+		},
+		"other errors are returned": {
+			errs:      []error{status.Error(codes.PermissionDenied, "")},
+			wantCalls: 1,
+			wantCode:  codes.PermissionDenied,
+		},
+		"attempts are limited": {
+			errs:      []error{status.Error(codes.Unavailable, ""), status.Error(codes.Unavailable, ""), status.Error(codes.Unavailable, ""), nil},
+			wantCalls: 3,
+			wantCode:  codes.Unavailable,
+		},
+	}
+
+	for scenario, s := range scenarios {
+		t.Run(scenario, func(t *testing.T) {
+			// arrange
+			policy := RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}.withDefaults()
+			calls := 0
+			invoker := func(context.Context, string, interface{}, interface{}, *grpc.ClientConn, ...grpc.CallOption) error {
+				err := s.errs[calls]
+				calls++
+				return err
+			}
+
+			// act
+			err := retryUnary(policy)(context.Background(), "/log.v1.Log/Get", nil, nil, nil, invoker)
+
+			// assert
+			require.Equal(t, s.wantCode, status.Code(err))
+			require.Equal(t, s.wantCalls, calls)
+		})
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	// arrange
+	policy := RetryPolicy{InitialBackoff: time.Second, MaxBackoff: 3 * time.Second}
+
+	// act & assert
+	require.Equal(t, time.Second, policy.backoff(1))
+	require.Equal(t, 2*time.Second, policy.backoff(2))
+	require.Equal(t, 3*time.Second, policy.backoff(3))
+	require.Equal(t, 3*time.Second, policy.backoff(50))
+}
+
+func TestClient(t *testing.T) {
+	scenarios := map[string]func(t *testing.T, client *Client){
+		"produced records are consumed":   testProduceConsume,
+		"linger flushes buffered records": testProducerLinger,
+		"closed producers reject records": testProducerClosed,
+		"consumer reopens ended streams":  testConsumerReconnects,
+		"consumer stops once ctx is done": testConsumerCancel,
+		"encrypted records are opaque":    testProducerEncryption,
+	}
+
+	for scenario, fn := range scenarios {
+		t.Run(scenario, func(t *testing.T) {
+			debug := false
+			setup := server.SetupTest(t, func(c *server.Config) {
+				c.StreamLimits.IdleTimeout = 100 * time.Millisecond
+			}, &debug)
+			defer setup.Teardown()
+
+			client := newTestClient(t, setup.LogServerAddr)
+			defer client.Close()
+
+			fn(t, client)
+		})
+	}
+}
+
+// newTestClient dials the address with the root client's certificate.
+func newTestClient(t *testing.T, addr string) *Client {
+	t.Helper()
+	tlsConfig, err := config.SetupTLSConfig(config.TLSConfig{
+		CertFile: config.RootClientCertFile,
+		KeyFile:  config.RootClientKeyFile,
+		CAFile:   config.CAFile,
+	})
+	require.NoError(t, err)
+	client, err := New(Config{
+		Addr:        addr,
+		DialOptions: []grpc.DialOption{grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig))},
+		Retry:       RetryPolicy{InitialBackoff: 10 * time.Millisecond},
+	})
+	require.NoError(t, err)
+	return client
+}
+
+func testProduceConsume(t *testing.T, client *Client) {
+	// arrange
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	producer, err := client.NewProducer("client", ProducerConfig{MaxRecords: 2})
+	require.NoError(t, err)
+	values := []string{"first", "second", "third"}
+
+	// act
+	for _, value := range values {
+		require.NoError(t, producer.Produce(ctx, &api.Record{Value: []byte(value)}))
+	}
+	require.NoError(t, producer.Close(ctx))
+
+	// assert
+	consumer := client.Consume(ctx, "client", 0)
+	for i, value := range values {
+		require.True(t, consumer.Next(), consumer.Err())
+		require.Equal(t, uint64(i), consumer.Record().Offset)
+		require.Equal(t, value, string(consumer.Record().Value))
+	}
+	require.Equal(t, uint64(len(values)), consumer.Offset())
+}
+
+func testProducerLinger(t *testing.T, client *Client) {
+	// arrange
+	ctx := context.Background()
+	producer, err := client.NewProducer("", ProducerConfig{Linger: 10 * time.Millisecond})
+	require.NoError(t, err)
+	defer producer.Close(ctx)
+
+	// act
+	err = producer.Produce(ctx, &api.Record{Value: []byte("hello world")})
+
+	// assert
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		_, err := client.Get(ctx, &api.GetRecordRequest{Offset: 0})
+		return err == nil
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func testProducerClosed(t *testing.T, client *Client) {
+	// arrange
+	ctx := context.Background()
+	producer, err := client.NewProducer("", ProducerConfig{})
+	require.NoError(t, err)
+	require.NoError(t, producer.Close(ctx))
+
+	// act
+	err = producer.Produce(ctx, &api.Record{Value: []byte("hello world")})
+
+	// assert
+	require.ErrorIs(t, err, ErrProducerClosed)
+}
+
+func testConsumerReconnects(t *testing.T, client *Client) {
+	// arrange
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := client.Create(ctx, &api.CreateRecordRequest{Record: &api.Record{Value: []byte("first")}})
+	require.NoError(t, err)
+	consumer := client.Consume(ctx, "", 0)
+	require.True(t, consumer.Next(), consumer.Err())
+
+	// act
+	time.Sleep(300 * time.Millisecond) // the server ends the idle stream
+	_, err = client.Create(ctx, &api.CreateRecordRequest{Record: &api.Record{Value: []byte("second")}})
+	require.NoError(t, err)
+
+	// assert
+	require.True(t, consumer.Next(), consumer.Err())
+	require.Equal(t, uint64(1), consumer.Record().Offset)
+	require.Equal(t, "second", string(consumer.Record().Value))
+}
+
+func testConsumerCancel(t *testing.T, client *Client) {
+	// arrange
+	ctx, cancel := context.WithCancel(context.Background())
+	consumer := client.Consume(ctx, "", 0)
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	// act
+	next := consumer.Next()
+
+	// assert
+	require.False(t, next)
+	require.ErrorIs(t, consumer.Err(), context.Canceled)
+}
+
+func testProducerEncryption(t *testing.T, client *Client) {
+	// arrange
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	encryptor, err := NewEncryptor(EncryptionConfig{
+		KeyProvider: LocalKeyProvider{Current: "v1", Keys: map[string][]byte{"v1": make([]byte, 32)}},
+	})
+	require.NoError(t, err)
+	producer, err := client.NewProducer("secrets", ProducerConfig{Encryptor: encryptor})
+	require.NoError(t, err)
+
+	// act
+	require.NoError(t, producer.Produce(ctx, &api.Record{Key: []byte("user-1"), Value: []byte("alice")}))
+	require.NoError(t, producer.Close(ctx))
+
+	// assert
+	res, err := client.Get(ctx, &api.GetRecordRequest{Topic: "secrets", Offset: 0})
+	require.NoError(t, err)
+	require.NotEqual(t, "alice", string(res.Record.Value), "the server stores the encrypted value")
+	decrypted, err := encryptor.Decrypt(ctx, res.Record)
+	require.NoError(t, err)
+	require.Equal(t, "alice", string(decrypted.Value))
+}
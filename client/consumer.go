@@ -0,0 +1,130 @@
+package client
+
+import (
+	"context"
+	"io"
+
+	api "github.com/justagabriel/proglog/api/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// consumeBatchBytes is the size of the batches of records consumers request.
+const consumeBatchBytes = 256 << 10
+
+// Consumer iterates over the records of a topic, waiting for new ones at
+// its end:
+//
+//	consumer := c.Consume(ctx, "topic", 0)
+//	for consumer.Next() {
+//		handle(consumer.Record())
+//	}
+//	if err := consumer.Err(); err != nil {
+//		...
+//	}
+type Consumer struct {
+	client *Client
+	ctx    context.Context
+	topic  string
+	next   uint64
+	stream api.Log_ConsumeStreamClient
+	record *api.Record
+	// batch holds the records received but not iterated yet
+	batch []*api.Record
+	err   error
+	// retries counts the failed attempts since the last record, they determine the backoff
+	retries int
+}
+
+// Consume returns a consumer of the topic starting at the offset. Its stream
+// is reopened at the next offset whenever it ends or fails with Unavailable,
+// e.g. on a server restart. It backs off like the client's retry policy but
+// keeps retrying until ctx is done.
+func (c *Client) Consume(ctx context.Context, topic string, from uint64) *Consumer {
+	return &Consumer{client: c, ctx: ctx, topic: topic, next: from}
+}
+
+// Next waits for the next record, it returns false once ctx is done or the
+// stream failed for good.
+func (c *Consumer) Next() bool {
+	if c.err != nil {
+		return false
+	}
+	for {
+		if len(c.batch) > 0 {
+			c.record = c.batch[0]
+			c.batch = c.batch[1:]
+			c.next = c.record.Offset + 1
+			return true
+		}
+		if c.stream == nil {
+			stream, err := c.client.ConsumeStream(c.ctx, &api.GetRecordRequest{
+				Topic:    c.topic,
+				Offset:   c.next,
+				MaxBytes: consumeBatchBytes,
+			})
+			if err != nil && !c.retry(err) {
+				return false
+			}
+			c.stream = stream
+			if err != nil {
+				continue
+			}
+		}
+
+		res, err := c.stream.Recv()
+		if err != nil {
+			c.stream = nil
+			if !c.retry(err) {
+				return false
+			}
+			continue
+		}
+		c.retries = 0
+		c.batch = res.Records
+		if res.Record != nil {
+			// servers not supporting batches send the records one by one
+			c.batch = []*api.Record{res.Record}
+		}
+	}
+}
+
+// retry waits before reopening the stream, it reports false and sets the
+// error if the error isn't retried.
+func (c *Consumer) retry(err error) bool {
+	if c.ctx.Err() != nil {
+		c.err = c.ctx.Err()
+		return false
+	}
+	if err != io.EOF && status.Code(err) != codes.Unavailable {
+		c.err = err
+		return false
+	}
+	c.retries++
+	if serr := c.client.retry.sleep(c.ctx, c.retries); serr != nil {
+		c.err = serr
+		return false
+	}
+	return true
+}
+
+// Record returns the record read by the last call of Next.
+func (c *Consumer) Record() *api.Record {
+	return c.record
+}
+
+// Buffered returns how many records were received but not iterated yet, Next
+// returns them without waiting.
+func (c *Consumer) Buffered() int {
+	return len(c.batch)
+}
+
+// Offset returns the offset the consumer continues at.
+func (c *Consumer) Offset() uint64 {
+	return c.next
+}
+
+// Err returns the error which ended the iteration, ctx' error if it was done.
+func (c *Consumer) Err() error {
+	return c.err
+}
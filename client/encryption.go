@@ -0,0 +1,264 @@
+package client
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	api "github.com/justagabriel/proglog/api/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// EncryptionKeyHeader carries the wrapped data key of an encrypted record.
+const EncryptionKeyHeader = "proglog-encryption-key"
+
+const (
+	// dataKeyBytes selects AES-256 for the values.
+	dataKeyBytes = 32
+	// maxCachedDataKeys bounds the unwrapped keys kept for decryption.
+	maxCachedDataKeys = 1024
+)
+
+// ErrDecrypt is returned for encrypted records which can't be decrypted,
+// e.g. because they were tampered with.
+var ErrDecrypt = errors.New("record can't be decrypted")
+
+// KeyProvider wraps the data keys records are encrypted with, usually with
+// a master key held by a KMS, so only the wrapped keys are stored with the
+// records.
+type KeyProvider interface {
+	// GenerateDataKey returns a new data key of the given size and its
+	// wrapped form.
+	GenerateDataKey(ctx context.Context, size int) (key, wrapped []byte, err error)
+	// UnwrapDataKey returns the data key of a key GenerateDataKey wrapped.
+	UnwrapDataKey(ctx context.Context, wrapped []byte) ([]byte, error)
+}
+
+// LocalKeyProvider wraps data keys with AES-GCM master keys held in memory,
+// e.g. read from a secret store. Keys maps the ids of the master keys to
+// keys of 16, 24 or 32 bytes. New data keys are wrapped with the Current
+// one, the others still unwrap the keys they wrapped, so master keys can be
+// rotated.
+type LocalKeyProvider struct {
+	Current string
+	Keys    map[string][]byte
+}
+
+func (p LocalKeyProvider) GenerateDataKey(ctx context.Context, size int) (key, wrapped []byte, err error) {
+	if len(p.Current) > 255 {
+		return nil, nil, fmt.Errorf("master key id %q is too long", p.Current)
+	}
+	aead, err := p.aead(p.Current)
+	if err != nil {
+		return nil, nil, err
+	}
+	key = make([]byte, size)
+	if _, err = rand.Read(key); err != nil {
+		return nil, nil, err
+	}
+	// the wrapped key is the master key's id prefixed by its length, the
+	// nonce and the sealed data key
+	wrapped = append([]byte{byte(len(p.Current))}, p.Current...)
+	nonce := make([]byte, aead.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return nil, nil, err
+	}
+	wrapped = append(wrapped, nonce...)
+	return key, aead.Seal(wrapped, nonce, key, []byte(p.Current)), nil
+}
+
+func (p LocalKeyProvider) UnwrapDataKey(ctx context.Context, wrapped []byte) ([]byte, error) {
+	if len(wrapped) == 0 || len(wrapped) < 1+int(wrapped[0]) {
+		return nil, ErrDecrypt
+	}
+	id := string(wrapped[1 : 1+wrapped[0]])
+	wrapped = wrapped[1+len(id):]
+	aead, err := p.aead(id)
+	if err != nil {
+		return nil, err
+	}
+	if len(wrapped) < aead.NonceSize() {
+		return nil, ErrDecrypt
+	}
+	key, err := aead.Open(nil, wrapped[:aead.NonceSize()], wrapped[aead.NonceSize():], []byte(id))
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return key, nil
+}
+
+func (p LocalKeyProvider) aead(id string) (cipher.AEAD, error) {
+	key, ok := p.Keys[id]
+	if !ok {
+		return nil, fmt.Errorf("unknown master key %q", id)
+	}
+	return newAEAD(key)
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+type EncryptionConfig struct {
+	// KeyProvider wraps the data keys, it's required.
+	KeyProvider KeyProvider
+	// DataKeyLifetime is how long a data key encrypts records before a new
+	// one is generated, defaults to an hour.
+	DataKeyLifetime time.Duration
+}
+
+// Encryptor encrypts the values of records with AES-256-GCM, so they're
+// opaque to the servers and to anyone reading their disks. The data keys
+// are wrapped by the KeyProvider and stored in the records'
+// EncryptionKeyHeader. Keys, other headers and timestamps stay readable,
+// the servers need the keys for compaction and key lookups. Values are
+// bound to their record's key, so they can't be moved to another key.
+//
+// Producers and Process encrypt and decrypt records if configured to,
+// records read otherwise are decrypted with Decrypt:
+//
+//	for consumer.Next() {
+//		record, err := encryptor.Decrypt(ctx, consumer.Record())
+//		...
+//	}
+type Encryptor struct {
+	config EncryptionConfig
+
+	mu      sync.Mutex
+	key     cipher.AEAD
+	wrapped []byte
+	expires time.Time
+	// keys caches the unwrapped data keys by their wrapped form
+	keys map[string]cipher.AEAD
+}
+
+func NewEncryptor(config EncryptionConfig) (*Encryptor, error) {
+	if config.KeyProvider == nil {
+		return nil, errors.New("key provider is required")
+	}
+	if config.DataKeyLifetime == 0 {
+		config.DataKeyLifetime = time.Hour
+	}
+	return &Encryptor{config: config, keys: make(map[string]cipher.AEAD)}, nil
+}
+
+// Encrypt returns a copy of the record with its value encrypted. Tombstones
+// are returned as they are, they have no value.
+func (e *Encryptor) Encrypt(ctx context.Context, record *api.Record) (*api.Record, error) {
+	if record.Tombstone {
+		return record, nil
+	}
+	aead, wrapped, err := e.dataKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	encrypted := proto.Clone(record).(*api.Record)
+	encrypted.Value = aead.Seal(nonce, nonce, record.Value, record.Key)
+	encrypted.Headers = append(withoutHeader(record.Headers, EncryptionKeyHeader), &api.Header{
+		Key:   EncryptionKeyHeader,
+		Value: wrapped,
+	})
+	return encrypted, nil
+}
+
+// Decrypt returns a copy of the record with its value decrypted, records
+// without EncryptionKeyHeader are returned as they are. It fails with
+// ErrDecrypt if the value or its key were tampered with.
+func (e *Encryptor) Decrypt(ctx context.Context, record *api.Record) (*api.Record, error) {
+	var wrapped []byte
+	for _, header := range record.Headers {
+		if header.Key == EncryptionKeyHeader {
+			wrapped = header.Value
+		}
+	}
+	if wrapped == nil {
+		return record, nil
+	}
+	aead, err := e.unwrap(ctx, wrapped)
+	if err != nil {
+		return nil, err
+	}
+	if len(record.Value) < aead.NonceSize() {
+		return nil, ErrDecrypt
+	}
+	nonce, sealed := record.Value[:aead.NonceSize()], record.Value[aead.NonceSize():]
+	value, err := aead.Open(nil, nonce, sealed, record.Key)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+
+	decrypted := proto.Clone(record).(*api.Record)
+	decrypted.Value = value
+	decrypted.Headers = withoutHeader(record.Headers, EncryptionKeyHeader)
+	return decrypted, nil
+}
+
+// dataKey returns the current data key, generating a new one once it expired.
+func (e *Encryptor) dataKey(ctx context.Context) (cipher.AEAD, []byte, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.key != nil && time.Now().Before(e.expires) {
+		return e.key, e.wrapped, nil
+	}
+	key, wrapped, err := e.config.KeyProvider.GenerateDataKey(ctx, dataKeyBytes)
+	if err != nil {
+		return nil, nil, err
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	e.key, e.wrapped, e.expires = aead, wrapped, time.Now().Add(e.config.DataKeyLifetime)
+	return aead, wrapped, nil
+}
+
+// unwrap returns the data key of the wrapped key, the provider is only asked
+// for keys which aren't cached.
+func (e *Encryptor) unwrap(ctx context.Context, wrapped []byte) (cipher.AEAD, error) {
+	e.mu.Lock()
+	aead, ok := e.keys[string(wrapped)]
+	e.mu.Unlock()
+	if ok {
+		return aead, nil
+	}
+
+	key, err := e.config.KeyProvider.UnwrapDataKey(ctx, wrapped)
+	if err != nil {
+		return nil, err
+	}
+	if aead, err = newAEAD(key); err != nil {
+		return nil, err
+	}
+	e.mu.Lock()
+	if len(e.keys) >= maxCachedDataKeys {
+		e.keys = make(map[string]cipher.AEAD)
+	}
+	e.keys[string(wrapped)] = aead
+	e.mu.Unlock()
+	return aead, nil
+}
+
+// withoutHeader returns a copy of the headers without the key's.
+func withoutHeader(headers []*api.Header, key string) []*api.Header {
+	var kept []*api.Header
+	for _, header := range headers {
+		if header.Key != key {
+			kept = append(kept, header)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,128 @@
+package client
+
+import (
+	"context"
+	"testing"
+
+	api "github.com/justagabriel/proglog/api/v1"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+)
+
+func newTestEncryptor(t *testing.T, provider LocalKeyProvider) *Encryptor {
+	t.Helper()
+	encryptor, err := NewEncryptor(EncryptionConfig{KeyProvider: provider})
+	require.NoError(t, err)
+	return encryptor
+}
+
+func TestEncryptor(t *testing.T) {
+	provider := LocalKeyProvider{
+		Current: "v1",
+		Keys:    map[string][]byte{"v1": make([]byte, 32)},
+	}
+
+	scenarios := map[string]func(t *testing.T, encryptor *Encryptor){
+		"values round trip":                       testEncryptorRoundTrip,
+		"tampered records aren't decrypted":       testEncryptorTampered,
+		"plaintext records are kept":              testEncryptorPlaintext,
+		"rotated master keys still decrypt":       testEncryptorRotation,
+		"data keys are reused for their lifetime": testEncryptorReuse,
+	}
+
+	for scenario, fn := range scenarios {
+		t.Run(scenario, func(t *testing.T) {
+			fn(t, newTestEncryptor(t, provider))
+		})
+	}
+}
+
+func testEncryptorRoundTrip(t *testing.T, encryptor *Encryptor) {
+	// arrange
+	ctx := context.Background()
+	record := &api.Record{
+		Key:     []byte("user-1"),
+		Value:   []byte("alice@example.com"),
+		Headers: []*api.Header{{Key: "content-type", Value: []byte("text/plain")}},
+	}
+
+	// act
+	encrypted, err := encryptor.Encrypt(ctx, record)
+	require.NoError(t, err)
+	decrypted, err := encryptor.Decrypt(ctx, encrypted)
+
+	// assert
+	require.NoError(t, err)
+	require.NotContains(t, string(encrypted.Value), "alice")
+	require.Equal(t, "alice@example.com", string(record.Value), "the record isn't changed")
+	require.Equal(t, record.Value, decrypted.Value)
+	require.Equal(t, record.Key, encrypted.Key, "keys stay readable")
+	require.Equal(t, record.Headers, decrypted.Headers)
+}
+
+func testEncryptorTampered(t *testing.T, encryptor *Encryptor) {
+	// arrange
+	ctx := context.Background()
+	encrypted, err := encryptor.Encrypt(ctx, &api.Record{Key: []byte("user-1"), Value: []byte("alice")})
+	require.NoError(t, err)
+	moved := proto.Clone(encrypted).(*api.Record)
+	moved.Key = []byte("user-2")
+
+	// act
+	_, err = encryptor.Decrypt(ctx, moved)
+
+	// assert
+	require.ErrorIs(t, err, ErrDecrypt, "values are bound to their key")
+}
+
+func testEncryptorPlaintext(t *testing.T, encryptor *Encryptor) {
+	// arrange
+	ctx := context.Background()
+	record := &api.Record{Value: []byte("hello world")}
+	tombstone := &api.Record{Key: []byte("user-1"), Tombstone: true}
+
+	// act
+	decrypted, err := encryptor.Decrypt(ctx, record)
+	require.NoError(t, err)
+	encrypted, encryptErr := encryptor.Encrypt(ctx, tombstone)
+
+	// assert
+	require.Equal(t, record, decrypted)
+	require.NoError(t, encryptErr)
+	require.Equal(t, tombstone, encrypted)
+}
+
+func testEncryptorRotation(t *testing.T, encryptor *Encryptor) {
+	// arrange
+	ctx := context.Background()
+	encrypted, err := encryptor.Encrypt(ctx, &api.Record{Value: []byte("hello world")})
+	require.NoError(t, err)
+	rotated := newTestEncryptor(t, LocalKeyProvider{
+		Current: "v2",
+		Keys:    map[string][]byte{"v1": make([]byte, 32), "v2": make([]byte, 16)},
+	})
+
+	// act
+	decrypted, err := rotated.Decrypt(ctx, encrypted)
+
+	// assert
+	require.NoError(t, err)
+	require.Equal(t, "hello world", string(decrypted.Value))
+	_, err = newTestEncryptor(t, LocalKeyProvider{Current: "v2", Keys: map[string][]byte{"v2": make([]byte, 16)}}).Decrypt(ctx, encrypted)
+	require.Error(t, err, "the master key is required")
+}
+
+func testEncryptorReuse(t *testing.T, encryptor *Encryptor) {
+	// arrange
+	ctx := context.Background()
+
+	// act
+	first, err := encryptor.Encrypt(ctx, &api.Record{Value: []byte("first")})
+	require.NoError(t, err)
+	second, err := encryptor.Encrypt(ctx, &api.Record{Value: []byte("second")})
+	require.NoError(t, err)
+
+	// assert
+	require.Equal(t, first.Headers, second.Headers)
+	require.NotEqual(t, first.Value[:12], second.Value[:12], "nonces aren't reused")
+}
@@ -0,0 +1,236 @@
+package client
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"strconv"
+	"sync"
+
+	api "github.com/justagabriel/proglog/api/v1"
+)
+
+// MirrorOffsetHeader is added to mirrored records, it holds the offset of the
+// record in the source cluster as decimal number.
+const MirrorOffsetHeader = "proglog-mirror-offset"
+
+type MirrorConfig struct {
+	// Topics are mirrored to the destination's topics of the same name, ""
+	// being the default topic.
+	Topics []string
+	// StateFile keeps the position of the mirror, so it resumes where it
+	// stopped. Empty keeps it in memory only, the mirror starts at the
+	// beginning of the topics then.
+	StateFile string
+	// MaxRecords caps the records appended at once, defaults to 100.
+	MaxRecords int
+}
+
+// MirrorPosition is the position of the mirror in a topic.
+type MirrorPosition struct {
+	// SourceOffset is the next offset consumed from the source.
+	SourceOffset uint64 `json:"source_offset"`
+	// DestinationOffset is the offset the last mirrored record got in the
+	// destination plus one, zero if none was mirrored yet.
+	DestinationOffset uint64 `json:"destination_offset"`
+	// the mirror appends its records as idempotent producer, pending are the
+	// records of the batch in flight, which is appended again on resume
+	ProducerID string `json:"producer_id"`
+	Sequence   uint64 `json:"sequence"`
+	Pending    int    `json:"pending,omitempty"`
+}
+
+// Mirror copies topics from a source cluster into a destination cluster, e.g.
+// for disaster recovery or to fan out records to other regions. Mirrored
+// records keep their key, type and headers and carry their source offset in
+// MirrorOffsetHeader. Records aren't mirrored twice, even if the mirror
+// stops while appending. Only one mirror may write a destination topic.
+type Mirror struct {
+	source      *Client
+	destination *Client
+	config      MirrorConfig
+
+	mu        sync.Mutex
+	positions map[string]*MirrorPosition
+}
+
+// NewMirror returns a mirror from the source to the destination, resuming at
+// the positions of the state file.
+func NewMirror(source, destination *Client, config MirrorConfig) (*Mirror, error) {
+	if config.MaxRecords == 0 {
+		config.MaxRecords = 100
+	}
+	m := &Mirror{
+		source:      source,
+		destination: destination,
+		config:      config,
+		positions:   make(map[string]*MirrorPosition),
+	}
+	if config.StateFile == "" {
+		return m, nil
+	}
+	data, err := os.ReadFile(config.StateFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &m.positions); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Run mirrors the topics until ctx is done or mirroring a topic failed for
+// good. Streams failing with Unavailable are reopened, see Consume.
+func (m *Mirror) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, len(m.config.Topics))
+	for _, topic := range m.config.Topics {
+		wg.Add(1)
+		go func(topic string) {
+			defer wg.Done()
+			if err := m.mirror(ctx, topic); err != nil {
+				errs <- err
+				cancel()
+			}
+		}(topic)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if !errors.Is(err, context.Canceled) {
+			return err
+		}
+	}
+	return ctx.Err()
+}
+
+// Positions returns the mirror's position in each topic.
+func (m *Mirror) Positions() map[string]MirrorPosition {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	positions := make(map[string]MirrorPosition, len(m.positions))
+	for topic, pos := range m.positions {
+		positions[topic] = *pos
+	}
+	return positions
+}
+
+func (m *Mirror) mirror(ctx context.Context, topic string) error {
+	pos, err := m.position(topic)
+	if err != nil {
+		return err
+	}
+	consumer := m.source.Consume(ctx, topic, pos.SourceOffset)
+	var batch []*api.Record
+	for consumer.Next() {
+		source := consumer.Record()
+		headers := append([]*api.Header{}, source.Headers...)
+		headers = append(headers, &api.Header{Key: MirrorOffsetHeader, Value: []byte(strconv.FormatUint(source.Offset, 10))})
+		batch = append(batch, &api.Record{
+			Value:      source.Value,
+			Type:       source.Type,
+			Key:        source.Key,
+			Headers:    headers,
+			ProducerId: pos.ProducerID,
+			Sequence:   pos.Sequence + uint64(len(batch)),
+		})
+
+		if !m.flushes(pos, len(batch), consumer.Buffered()) {
+			continue
+		}
+		if err := m.append(ctx, topic, pos, batch, consumer.Offset()); err != nil {
+			return err
+		}
+		batch = nil
+	}
+	return consumer.Err()
+}
+
+// flushes tells whether the batch is appended now: once it's full or no more
+// records were received. A pending batch is appended again just like before,
+// so it's recognized as duplicate.
+func (m *Mirror) flushes(pos *MirrorPosition, batched, buffered int) bool {
+	if pos.Pending > 0 {
+		return batched == pos.Pending
+	}
+	return batched >= m.config.MaxRecords || buffered == 0
+}
+
+// append appends the batch and moves the topic's position to the source's
+// next offset.
+func (m *Mirror) append(ctx context.Context, topic string, pos *MirrorPosition, batch []*api.Record, next uint64) error {
+	m.mu.Lock()
+	pos.Pending = len(batch)
+	err := m.save()
+	m.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	res, err := m.destination.CreateBatch(ctx, &api.CreateRecordBatchRequest{Topic: topic, Records: batch})
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	pos.SourceOffset = next
+	pos.DestinationOffset = res.Offsets[len(res.Offsets)-1] + 1
+	pos.Sequence += uint64(len(batch))
+	pos.Pending = 0
+	return m.save()
+}
+
+// position returns the topic's position, a new one starts at the beginning
+// of the topic with a new producer id.
+func (m *Mirror) position(topic string) (*MirrorPosition, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if pos, ok := m.positions[topic]; ok {
+		return pos, nil
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	pos := &MirrorPosition{ProducerID: hex.EncodeToString(id)}
+	m.positions[topic] = pos
+	return pos, nil
+}
+
+// save writes the positions to the state file, m.mu has to be held.
+func (m *Mirror) save() error {
+	if m.config.StateFile == "" {
+		return nil
+	}
+	data, err := json.Marshal(m.positions)
+	if err != nil {
+		return err
+	}
+	tmp := m.config.StateFile + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(data); err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, m.config.StateFile)
+}
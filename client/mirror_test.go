@@ -0,0 +1,162 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	api "github.com/justagabriel/proglog/api/v1"
+	"github.com/justagabriel/proglog/internal/server"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMirror(t *testing.T) {
+	scenarios := map[string]func(t *testing.T, source, destination *Client, stateFile string){
+		"records are mirrored with their offset":   testMirrorRecords,
+		"mirror resumes at its position":           testMirrorResume,
+		"pending batches aren't mirrored twice":    testMirrorPending,
+		"mirroring stops once the context is done": testMirrorCancel,
+	}
+
+	for scenario, fn := range scenarios {
+		t.Run(scenario, func(t *testing.T) {
+			debug := false
+			sourceSetup := server.SetupTest(t, nil, &debug)
+			defer sourceSetup.Teardown()
+			destinationSetup := server.SetupTest(t, nil, &debug)
+			defer destinationSetup.Teardown()
+
+			source := newTestClient(t, sourceSetup.LogServerAddr)
+			defer source.Close()
+			destination := newTestClient(t, destinationSetup.LogServerAddr)
+			defer destination.Close()
+
+			fn(t, source, destination, filepath.Join(t.TempDir(), "mirror.json"))
+		})
+	}
+}
+
+func testMirrorRecords(t *testing.T, source, destination *Client, stateFile string) {
+	// arrange
+	ctx := context.Background()
+	produce(t, source, "orders", "order 0")
+	_, err := source.Create(ctx, &api.CreateRecordRequest{Topic: "orders", Record: &api.Record{
+		Value:   []byte("order 1"),
+		Key:     []byte("customer"),
+		Headers: []*api.Header{{Key: "content-type", Value: []byte("text/plain")}},
+	}})
+	require.NoError(t, err)
+
+	// act
+	mirror := runMirror(t, source, destination, MirrorConfig{Topics: []string{"orders"}}, 2)
+
+	// assert
+	got, err := destination.Get(ctx, &api.GetRecordRequest{Topic: "orders", Offset: 1})
+	require.NoError(t, err)
+	require.Equal(t, "order 1", string(got.Record.Value))
+	require.Equal(t, "customer", string(got.Record.Key))
+	require.Len(t, got.Record.Headers, 2)
+	require.Equal(t, "content-type", got.Record.Headers[0].Key)
+	require.Equal(t, MirrorOffsetHeader, got.Record.Headers[1].Key)
+	require.Equal(t, "1", string(got.Record.Headers[1].Value))
+	pos := mirror.Positions()["orders"]
+	require.Equal(t, uint64(2), pos.SourceOffset)
+	require.Equal(t, uint64(2), pos.DestinationOffset)
+}
+
+func testMirrorResume(t *testing.T, source, destination *Client, stateFile string) {
+	// arrange
+	config := MirrorConfig{Topics: []string{"orders"}, StateFile: stateFile}
+	produce(t, source, "orders", "order 0", "order 1")
+	runMirror(t, source, destination, config, 2)
+	produce(t, source, "orders", "order 2")
+
+	// act
+	runMirror(t, source, destination, config, 3)
+
+	// assert
+	requireMirrored(t, destination, "orders", "order 0", "order 1", "order 2")
+}
+
+func testMirrorPending(t *testing.T, source, destination *Client, stateFile string) {
+	// arrange
+	config := MirrorConfig{Topics: []string{"orders"}, StateFile: stateFile}
+	produce(t, source, "orders", "order 0", "order 1")
+	runMirror(t, source, destination, config, 2)
+	// the mirror stopped after appending its batch but before moving on
+	positions := map[string]*MirrorPosition{}
+	data, err := os.ReadFile(stateFile)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(data, &positions))
+	pos := positions["orders"]
+	pos.SourceOffset, pos.DestinationOffset, pos.Sequence, pos.Pending = 0, 0, 0, 2
+	data, err = json.Marshal(positions)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(stateFile, data, 0o600))
+	produce(t, source, "orders", "order 2")
+
+	// act
+	mirror := runMirror(t, source, destination, config, 3)
+
+	// assert
+	requireMirrored(t, destination, "orders", "order 0", "order 1", "order 2")
+	require.Equal(t, uint64(3), mirror.Positions()["orders"].DestinationOffset)
+}
+
+func testMirrorCancel(t *testing.T, source, destination *Client, stateFile string) {
+	// arrange
+	mirror, err := NewMirror(source, destination, MirrorConfig{Topics: []string{"orders", "payments"}})
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	// act
+	err = mirror.Run(ctx)
+
+	// assert
+	require.ErrorIs(t, err, context.Canceled)
+}
+
+func produce(t *testing.T, client *Client, topic string, values ...string) {
+	t.Helper()
+	for _, value := range values {
+		_, err := client.Create(context.Background(), &api.CreateRecordRequest{Topic: topic, Record: &api.Record{Value: []byte(value)}})
+		require.NoError(t, err)
+	}
+}
+
+// runMirror runs a mirror until it consumed the topic's first records.
+func runMirror(t *testing.T, source, destination *Client, config MirrorConfig, records uint64) *Mirror {
+	t.Helper()
+	mirror, err := NewMirror(source, destination, config)
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- mirror.Run(ctx) }()
+	require.Eventually(t, func() bool {
+		return mirror.Positions()[config.Topics[0]].SourceOffset == records
+	}, 5*time.Second, 10*time.Millisecond)
+	cancel()
+	require.ErrorIs(t, <-done, context.Canceled)
+	return mirror
+}
+
+// requireMirrored requires the topic to hold exactly the values, each
+// carrying its offset as source offset.
+func requireMirrored(t *testing.T, client *Client, topic string, values ...string) {
+	t.Helper()
+	ctx := context.Background()
+	highest, err := client.HighestOffset(ctx, &api.HighestOffsetRequest{Topic: topic})
+	require.NoError(t, err)
+	require.Equal(t, uint64(len(values)-1), highest.Offset)
+	for i, value := range values {
+		got, err := client.Get(ctx, &api.GetRecordRequest{Topic: topic, Offset: uint64(i)})
+		require.NoError(t, err)
+		require.Equal(t, value, string(got.Record.Value))
+		require.Equal(t, strconv.Itoa(i), string(got.Record.Headers[0].Value))
+	}
+}
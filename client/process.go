@@ -0,0 +1,127 @@
+package client
+
+import (
+	"context"
+	"strconv"
+
+	api "github.com/justagabriel/proglog/api/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// The headers added to records routed to a dead-letter topic.
+const (
+	DeadLetterTopicHeader    = "proglog-dead-letter-topic"
+	DeadLetterOffsetHeader   = "proglog-dead-letter-offset"
+	DeadLetterGroupHeader    = "proglog-dead-letter-group"
+	DeadLetterErrorHeader    = "proglog-dead-letter-error"
+	DeadLetterAttemptsHeader = "proglog-dead-letter-attempts"
+)
+
+// Handler processes a record consumed by Process.
+type Handler func(ctx context.Context, record *api.Record) error
+
+type ProcessConfig struct {
+	// Group commits the offsets of the records processed, Process resumes at
+	// the group's offset. It's required.
+	Group string
+	// MaxAttempts is how often a record is handled before it's routed to
+	// DeadLetterTopic, defaults to 3. Failed attempts back off like the
+	// client's retry policy.
+	MaxAttempts int
+	// DeadLetterTopic receives the records failing MaxAttempts times, along
+	// with the DeadLetter headers describing the failure. Empty stops Process
+	// with the handler's error instead.
+	DeadLetterTopic string
+	// Encryptor decrypts the records before they're handled, records failing
+	// to decrypt count as failed attempts. Dead-letter topics receive the
+	// records as they were read.
+	Encryptor *Encryptor
+}
+
+// Process consumes the topic as member of the group and handles its records
+// one by one until ctx is done. A record is committed once it was handled or
+// routed to the dead-letter topic, so a poisoned record doesn't stop the
+// group. Records are handled at least once, those handled but not committed
+// yet are handled again after a restart.
+func (c *Client) Process(ctx context.Context, topic string, config ProcessConfig, handler Handler) error {
+	if config.Group == "" {
+		return status.Error(codes.InvalidArgument, "group is required")
+	}
+	if config.MaxAttempts == 0 {
+		config.MaxAttempts = 3
+	}
+	var from uint64
+	res, err := c.FetchOffset(ctx, &api.FetchOffsetRequest{Group: config.Group, Topic: topic})
+	switch {
+	case err == nil:
+		from = res.Offset
+	case status.Code(err) != codes.NotFound:
+		return err
+	}
+
+	consumer := c.Consume(ctx, topic, from)
+	for consumer.Next() {
+		record := consumer.Record()
+		if err := c.handle(ctx, topic, config, handler, record); err != nil {
+			return err
+		}
+		// commits are spared while more records are at hand
+		if consumer.Buffered() > 0 {
+			continue
+		}
+		_, err := c.CommitOffset(ctx, &api.CommitOffsetRequest{Group: config.Group, Topic: topic, Offset: consumer.Offset()})
+		if err != nil {
+			return err
+		}
+	}
+	return consumer.Err()
+}
+
+// handle handles the record until it succeeds or failed MaxAttempts times,
+// then it's routed to the dead-letter topic.
+func (c *Client) handle(ctx context.Context, topic string, config ProcessConfig, handler Handler, record *api.Record) error {
+	var err error
+	for attempt := 1; attempt <= config.MaxAttempts; attempt++ {
+		if attempt > 1 {
+			if serr := c.retry.sleep(ctx, attempt-1); serr != nil {
+				return serr
+			}
+		}
+		if err = c.decryptAndHandle(ctx, config, handler, record); err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+	if config.DeadLetterTopic == "" {
+		return err
+	}
+
+	headers := append([]*api.Header{}, record.Headers...)
+	headers = append(headers,
+		&api.Header{Key: DeadLetterTopicHeader, Value: []byte(topic)},
+		&api.Header{Key: DeadLetterOffsetHeader, Value: []byte(strconv.FormatUint(record.Offset, 10))},
+		&api.Header{Key: DeadLetterGroupHeader, Value: []byte(config.Group)},
+		&api.Header{Key: DeadLetterErrorHeader, Value: []byte(err.Error())},
+		&api.Header{Key: DeadLetterAttemptsHeader, Value: []byte(strconv.Itoa(config.MaxAttempts))},
+	)
+	_, err = c.Create(ctx, &api.CreateRecordRequest{
+		Topic:  config.DeadLetterTopic,
+		Record: &api.Record{Value: record.Value, Key: record.Key, Type: record.Type, Headers: headers},
+	})
+	return err
+}
+
+// decryptAndHandle decrypts the record if configured to before it's handled.
+func (c *Client) decryptAndHandle(ctx context.Context, config ProcessConfig, handler Handler, record *api.Record) error {
+	if config.Encryptor == nil {
+		return handler(ctx, record)
+	}
+	decrypted, err := config.Encryptor.Decrypt(ctx, record)
+	if err != nil {
+		return err
+	}
+	return handler(ctx, decrypted)
+}
@@ -0,0 +1,165 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	api "github.com/justagabriel/proglog/api/v1"
+	"github.com/justagabriel/proglog/internal/server"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProcess(t *testing.T) {
+	scenarios := map[string]func(t *testing.T, client *Client){
+		"handled records are committed":            testProcessCommits,
+		"failing records are dead-lettered":        testProcessDeadLetter,
+		"failures stop without dead-letter topic":  testProcessFails,
+		"processing resumes at the group's offset": testProcessResumes,
+		"encrypted records are decrypted":          testProcessDecrypts,
+	}
+
+	for scenario, fn := range scenarios {
+		t.Run(scenario, func(t *testing.T) {
+			debug := false
+			setup := server.SetupTest(t, nil, &debug)
+			defer setup.Teardown()
+			client := newTestClient(t, setup.LogServerAddr)
+			defer client.Close()
+
+			fn(t, client)
+		})
+	}
+}
+
+func testProcessCommits(t *testing.T, client *Client) {
+	// arrange
+	produce(t, client, "orders", "order 0", "order 1", "order 2")
+	handled := &handledValues{}
+
+	// act
+	process(t, client, ProcessConfig{Group: "billing"}, handled.handle, 3)
+
+	// assert
+	require.Equal(t, []string{"order 0", "order 1", "order 2"}, handled.get())
+}
+
+func testProcessDeadLetter(t *testing.T, client *Client) {
+	// arrange
+	produce(t, client, "orders", "order 0", "poison", "order 2")
+	handled := &handledValues{fail: "poison"}
+
+	// act
+	process(t, client, ProcessConfig{Group: "billing", MaxAttempts: 2, DeadLetterTopic: "orders-dlq"}, handled.handle, 3)
+
+	// assert
+	require.Equal(t, []string{"order 0", "poison", "poison", "order 2"}, handled.get())
+	res, err := client.Get(context.Background(), &api.GetRecordRequest{Topic: "orders-dlq", Offset: 0})
+	require.NoError(t, err)
+	require.Equal(t, "poison", string(res.Record.Value))
+	headers := map[string]string{}
+	for _, h := range res.Record.Headers {
+		headers[h.Key] = string(h.Value)
+	}
+	require.Equal(t, map[string]string{
+		DeadLetterTopicHeader:    "orders",
+		DeadLetterOffsetHeader:   "1",
+		DeadLetterGroupHeader:    "billing",
+		DeadLetterErrorHeader:    "poisoned",
+		DeadLetterAttemptsHeader: "2",
+	}, headers)
+}
+
+func testProcessFails(t *testing.T, client *Client) {
+	// arrange
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	produce(t, client, "orders", "poison")
+	handled := &handledValues{fail: "poison"}
+
+	// act
+	err := client.Process(ctx, "orders", ProcessConfig{Group: "billing", MaxAttempts: 2}, handled.handle)
+
+	// assert
+	require.EqualError(t, err, "poisoned")
+	_, err = client.FetchOffset(ctx, &api.FetchOffsetRequest{Group: "billing", Topic: "orders"})
+	require.Error(t, err, "the failed record isn't committed")
+}
+
+func testProcessResumes(t *testing.T, client *Client) {
+	// arrange
+	produce(t, client, "orders", "order 0", "order 1")
+	handled := &handledValues{}
+	process(t, client, ProcessConfig{Group: "billing"}, handled.handle, 2)
+	produce(t, client, "orders", "order 2")
+
+	// act
+	process(t, client, ProcessConfig{Group: "billing"}, handled.handle, 3)
+
+	// assert
+	require.Equal(t, []string{"order 0", "order 1", "order 2"}, handled.get())
+}
+
+func testProcessDecrypts(t *testing.T, client *Client) {
+	// arrange
+	ctx := context.Background()
+	encryptor := newTestEncryptor(t, LocalKeyProvider{Current: "v1", Keys: map[string][]byte{"v1": make([]byte, 32)}})
+	producer, err := client.NewProducer("orders", ProducerConfig{Encryptor: encryptor})
+	require.NoError(t, err)
+	for _, value := range []string{"order 0", "poison"} {
+		require.NoError(t, producer.Produce(ctx, &api.Record{Value: []byte(value)}))
+	}
+	require.NoError(t, producer.Close(ctx))
+	handled := &handledValues{fail: "poison"}
+
+	// act
+	process(t, client, ProcessConfig{Group: "billing", MaxAttempts: 1, DeadLetterTopic: "orders-dlq", Encryptor: encryptor}, handled.handle, 2)
+
+	// assert
+	require.Equal(t, []string{"order 0", "poison"}, handled.get())
+	res, err := client.Get(ctx, &api.GetRecordRequest{Topic: "orders-dlq", Offset: 0})
+	require.NoError(t, err)
+	require.NotEqual(t, "poison", string(res.Record.Value), "dead letters stay encrypted")
+	decrypted, err := encryptor.Decrypt(ctx, res.Record)
+	require.NoError(t, err)
+	require.Equal(t, "poison", string(decrypted.Value))
+}
+
+// process processes the orders topic until the group committed the offset.
+func process(t *testing.T, client *Client, config ProcessConfig, handler Handler, offset uint64) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- client.Process(ctx, "orders", config, handler) }()
+	require.Eventually(t, func() bool {
+		res, err := client.FetchOffset(ctx, &api.FetchOffsetRequest{Group: config.Group, Topic: "orders"})
+		return err == nil && res.Offset == offset
+	}, 5*time.Second, 10*time.Millisecond)
+	cancel()
+	require.ErrorIs(t, <-done, context.Canceled)
+}
+
+// handledValues records the values handled, handling fails for fail.
+type handledValues struct {
+	mu     sync.Mutex
+	values []string
+	fail   string
+}
+
+func (h *handledValues) handle(ctx context.Context, record *api.Record) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.values = append(h.values, string(record.Value))
+	if string(record.Value) == h.fail {
+		return errors.New("poisoned")
+	}
+	return nil
+}
+
+func (h *handledValues) get() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.values
+}
@@ -0,0 +1,163 @@
+package client
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+
+	api "github.com/justagabriel/proglog/api/v1"
+)
+
+// ErrProducerClosed is returned when producing to a closed producer.
+var ErrProducerClosed = errors.New("producer is closed")
+
+type ProducerConfig struct {
+	// MaxRecords flushes the buffer once it holds that many records, defaults
+	// to 100. Servers accept batches of up to 1000 records.
+	MaxRecords int
+	// Linger flushes buffered records at the latest after that long, zero
+	// leaves flushing to MaxRecords, Flush and Close.
+	Linger time.Duration
+	// Encryptor encrypts the records' values before they're buffered, nil
+	// produces them as they are.
+	Encryptor *Encryptor
+}
+
+// Producer buffers records and appends them to a topic in batches. Its
+// records carry a producer id and sequence numbers, so retried batches
+// aren't appended twice. A batch which failed stays buffered and is sent
+// again by the next flush.
+type Producer struct {
+	client *Client
+	topic  string
+	config ProducerConfig
+	id     string
+
+	mu       sync.Mutex
+	sequence uint64
+	buffer   []*api.Record
+	timer    *time.Timer
+	// err is the error of the last flush started by Linger, it's returned by
+	// the next call
+	err    error
+	closed bool
+}
+
+// NewProducer returns a producer appending to the topic.
+func (c *Client) NewProducer(topic string, config ProducerConfig) (*Producer, error) {
+	if config.MaxRecords == 0 {
+		config.MaxRecords = 100
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	return &Producer{
+		client: c,
+		topic:  topic,
+		config: config,
+		id:     hex.EncodeToString(id),
+	}, nil
+}
+
+// Produce buffers the record, the buffer is flushed once it's full.
+func (p *Producer) Produce(ctx context.Context, record *api.Record) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return ErrProducerClosed
+	}
+	if err := p.takeErr(); err != nil {
+		return err
+	}
+	if p.config.Encryptor != nil {
+		encrypted, err := p.config.Encryptor.Encrypt(ctx, record)
+		if err != nil {
+			return err
+		}
+		record = encrypted
+	}
+	record.ProducerId = p.id
+	record.Sequence = p.sequence
+	p.sequence++
+	p.buffer = append(p.buffer, record)
+
+	if len(p.buffer) >= p.config.MaxRecords {
+		return p.flush(ctx)
+	}
+	if p.config.Linger > 0 && p.timer == nil {
+		p.timer = time.AfterFunc(p.config.Linger, p.linger)
+	}
+	return nil
+}
+
+// Flush appends the buffered records.
+func (p *Producer) Flush(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err := p.takeErr(); err != nil {
+		return err
+	}
+	return p.flush(ctx)
+}
+
+// Close flushes the buffered records, the producer can't be used afterwards.
+func (p *Producer) Close(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return nil
+	}
+	if err := p.flush(ctx); err != nil {
+		return err
+	}
+	p.closed = true
+	return nil
+}
+
+func (p *Producer) linger() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.timer = nil
+	if err := p.flush(context.Background()); err != nil {
+		p.err = err
+	}
+}
+
+// takeErr returns and clears the error of the last lingering flush, p.mu has to be held.
+func (p *Producer) takeErr() error {
+	err := p.err
+	p.err = nil
+	return err
+}
+
+// flush has to be called with p.mu held.
+func (p *Producer) flush(ctx context.Context) error {
+	if p.timer != nil {
+		p.timer.Stop()
+		p.timer = nil
+	}
+	for len(p.buffer) > 0 {
+		n := len(p.buffer)
+		if n > p.config.MaxRecords {
+			n = p.config.MaxRecords
+		}
+		_, err := p.client.CreateBatch(ctx, &api.CreateRecordBatchRequest{
+			Topic:   p.topic,
+			Records: p.buffer[:n],
+		})
+		if err != nil {
+			return err
+		}
+		p.buffer = p.buffer[n:]
+	}
+	p.buffer = nil
+	return nil
+}
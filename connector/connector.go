@@ -0,0 +1,118 @@
+// Package connector copies records between the log and other systems: a
+// Runner writes a topic's records to a Sink, e.g. files or S3 buckets to
+// archive the log, a Source appends the lines of files to a topic. Both
+// commit their positions to the log like consumer groups.
+package connector
+
+import (
+	"context"
+
+	api "github.com/justagabriel/proglog/api/v1"
+	"github.com/justagabriel/proglog/client"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// pendingSuffix names the group holding the end of the batch in flight.
+const pendingSuffix = ".pending"
+
+// Sink stores batches of records outside of the log. After a restart the
+// batch in flight is written again with the same records, so sinks have to
+// replace a batch written before rather than add it twice, e.g. by naming it
+// after its offsets like FileSink and S3Sink do.
+type Sink interface {
+	Write(records []*api.Record) error
+}
+
+type Config struct {
+	Topic string
+	// Group commits the offsets of the records written, it's required. The
+	// runner commits to the group suffixed with ".pending" as well, so the ACL
+	// has to permit both, e.g. with "group/archive*".
+	Group string
+	// MaxRecords caps the records written at once, defaults to 1000.
+	MaxRecords int
+}
+
+// Runner consumes a topic and writes its records to a sink, resuming at the
+// group's committed offset. An offset is committed once the sink wrote its
+// record, and the records are written once: a batch is announced as pending
+// before it's written, and written again with the same records if the runner
+// stopped in between.
+type Runner struct {
+	client *client.Client
+	sink   Sink
+	config Config
+}
+
+func NewRunner(cl *client.Client, sink Sink, config Config) *Runner {
+	if config.MaxRecords == 0 {
+		config.MaxRecords = 1000
+	}
+	return &Runner{client: cl, sink: sink, config: config}
+}
+
+// Run writes the topic's records to the sink until ctx is done or writing
+// failed.
+func (r *Runner) Run(ctx context.Context) error {
+	if r.config.Group == "" {
+		return status.Error(codes.InvalidArgument, "group is required")
+	}
+	committed, err := r.fetch(ctx, r.config.Group)
+	if err != nil {
+		return err
+	}
+	pending, err := r.fetch(ctx, r.config.Group+pendingSuffix)
+	if err != nil {
+		return err
+	}
+
+	consumer := r.client.Consume(ctx, r.config.Topic, committed)
+	var batch []*api.Record
+	for consumer.Next() {
+		batch = append(batch, consumer.Record())
+		next := consumer.Offset()
+		// the pending batch is written again just like before
+		if pending > committed {
+			if next < pending {
+				continue
+			}
+		} else if len(batch) < r.config.MaxRecords && consumer.Buffered() > 0 {
+			continue
+		}
+		if err := r.write(ctx, batch, next); err != nil {
+			return err
+		}
+		committed, pending, batch = next, next, nil
+	}
+	return consumer.Err()
+}
+
+// write writes the batch to the sink and commits next, the offset following
+// the batch.
+func (r *Runner) write(ctx context.Context, batch []*api.Record, next uint64) error {
+	if err := r.commit(ctx, r.config.Group+pendingSuffix, next); err != nil {
+		return err
+	}
+	if err := r.sink.Write(batch); err != nil {
+		return err
+	}
+	return r.commit(ctx, r.config.Group, next)
+}
+
+func (r *Runner) commit(ctx context.Context, group string, offset uint64) error {
+	_, err := r.client.CommitOffset(ctx, &api.CommitOffsetRequest{Group: group, Topic: r.config.Topic, Offset: offset})
+	return err
+}
+
+// fetch returns the group's committed offset, zero if it has none.
+func (r *Runner) fetch(ctx context.Context, group string) (uint64, error) {
+	res, err := r.client.FetchOffset(ctx, &api.FetchOffsetRequest{Group: group, Topic: r.config.Topic})
+	if status.Code(err) == codes.NotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return res.Offset, nil
+}
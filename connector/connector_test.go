@@ -0,0 +1,175 @@
+package connector
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	api "github.com/justagabriel/proglog/api/v1"
+	"github.com/justagabriel/proglog/client"
+	"github.com/justagabriel/proglog/internal/config"
+	"github.com/justagabriel/proglog/internal/server"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+func TestRunner(t *testing.T) {
+	scenarios := map[string]func(t *testing.T, cl *client.Client){
+		"records are written to files":         testRunnerFileSink,
+		"runner resumes at the group's offset": testRunnerResume,
+		"pending batch is written again":       testRunnerPending,
+		"failed writes aren't committed":       testRunnerWriteFails,
+	}
+
+	for scenario, fn := range scenarios {
+		t.Run(scenario, func(t *testing.T) {
+			fn(t, setupClient(t))
+		})
+	}
+}
+
+// setupClient returns a client of a test server with the root certificate.
+func setupClient(t *testing.T) *client.Client {
+	t.Helper()
+	debug := false
+	setup := server.SetupTest(t, nil, &debug)
+	t.Cleanup(setup.Teardown)
+
+	tlsConfig, err := config.SetupTLSConfig(config.TLSConfig{
+		CertFile: config.RootClientCertFile,
+		KeyFile:  config.RootClientKeyFile,
+		CAFile:   config.CAFile,
+	})
+	require.NoError(t, err)
+	cl, err := client.New(client.Config{
+		Addr:        setup.LogServerAddr,
+		DialOptions: []grpc.DialOption{grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig))},
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { cl.Close() })
+	return cl
+}
+
+func testRunnerFileSink(t *testing.T, cl *client.Client) {
+	// arrange
+	dir := t.TempDir()
+	produce(t, cl, "order 0", "order 1", "order 2")
+
+	// act
+	run(t, NewRunner(cl, FileSink(dir), Config{Topic: "orders", Group: "archive", MaxRecords: 2}), cl, 3)
+
+	// assert
+	files, err := filepath.Glob(filepath.Join(dir, "*.jsonl"))
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		filepath.Join(dir, "00000000000000000000-00000000000000000001.jsonl"),
+		filepath.Join(dir, "00000000000000000002-00000000000000000002.jsonl"),
+	}, files)
+	data, err := os.ReadFile(files[0])
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	require.Len(t, lines, 2)
+	require.Contains(t, lines[1], `"offset":"1"`)
+}
+
+func testRunnerResume(t *testing.T, cl *client.Client) {
+	// arrange
+	sink := &recordingSink{}
+	config := Config{Topic: "orders", Group: "archive"}
+	produce(t, cl, "order 0", "order 1")
+	run(t, NewRunner(cl, sink, config), cl, 2)
+	produce(t, cl, "order 2")
+
+	// act
+	run(t, NewRunner(cl, sink, config), cl, 3)
+
+	// assert
+	require.Equal(t, [][]uint64{{0, 1}, {2}}, sink.offsets())
+}
+
+func testRunnerPending(t *testing.T, cl *client.Client) {
+	// arrange
+	sink := &recordingSink{}
+	ctx := context.Background()
+	produce(t, cl, "order 0", "order 1", "order 2")
+	// the runner stopped while writing the first two records
+	_, err := cl.CommitOffset(ctx, &api.CommitOffsetRequest{Group: "archive.pending", Topic: "orders", Offset: 2})
+	require.NoError(t, err)
+
+	// act
+	run(t, NewRunner(cl, sink, Config{Topic: "orders", Group: "archive"}), cl, 3)
+
+	// assert
+	require.Equal(t, [][]uint64{{0, 1}, {2}}, sink.offsets())
+}
+
+func testRunnerWriteFails(t *testing.T, cl *client.Client) {
+	// arrange
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	produce(t, cl, "order 0")
+	sink := &recordingSink{err: errors.New("disk full")}
+
+	// act
+	err := NewRunner(cl, sink, Config{Topic: "orders", Group: "archive"}).Run(ctx)
+
+	// assert
+	require.ErrorIs(t, err, sink.err)
+	_, err = cl.FetchOffset(ctx, &api.FetchOffsetRequest{Group: "archive", Topic: "orders"})
+	require.Error(t, err, "nothing is committed")
+}
+
+func produce(t *testing.T, cl *client.Client, values ...string) {
+	t.Helper()
+	for _, value := range values {
+		_, err := cl.Create(context.Background(), &api.CreateRecordRequest{Topic: "orders", Record: &api.Record{Value: []byte(value)}})
+		require.NoError(t, err)
+	}
+}
+
+// run runs the runner until its group committed the offset.
+func run(t *testing.T, runner *Runner, cl *client.Client, offset uint64) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- runner.Run(ctx) }()
+	require.Eventually(t, func() bool {
+		res, err := cl.FetchOffset(ctx, &api.FetchOffsetRequest{Group: runner.config.Group, Topic: runner.config.Topic})
+		return err == nil && res.Offset == offset
+	}, 5*time.Second, 10*time.Millisecond)
+	cancel()
+	require.ErrorIs(t, <-done, context.Canceled)
+}
+
+// recordingSink records the offsets of the batches written, or fails with err.
+type recordingSink struct {
+	mu      sync.Mutex
+	batches [][]uint64
+	err     error
+}
+
+func (s *recordingSink) Write(records []*api.Record) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var offsets []uint64
+	for _, record := range records {
+		offsets = append(offsets, record.Offset)
+	}
+	s.batches = append(s.batches, offsets)
+	return nil
+}
+
+func (s *recordingSink) offsets() [][]uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.batches
+}
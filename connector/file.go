@@ -0,0 +1,67 @@
+package connector
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	api "github.com/justagabriel/proglog/api/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// batchName names a batch after the offsets of its first and last record,
+// zero padded so the names sort by offset.
+func batchName(records []*api.Record) string {
+	return fmt.Sprintf("%020d-%020d.jsonl", records[0].Offset, records[len(records)-1].Offset)
+}
+
+// encodeBatch encodes the records as JSON, one per line.
+func encodeBatch(records []*api.Record) ([]byte, error) {
+	var buf bytes.Buffer
+	for _, record := range records {
+		b, err := protojson.Marshal(record)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(b)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes(), nil
+}
+
+// FileSink writes each batch to a file of the directory, named after the
+// batch's offsets and holding a record as JSON per line.
+type FileSink string
+
+// Write writes to a temporary file first, so a batch's file is either
+// complete or missing.
+func (d FileSink) Write(records []*api.Record) error {
+	if len(records) == 0 {
+		return nil
+	}
+	data, err := encodeBatch(records)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(string(d), 0755); err != nil {
+		return err
+	}
+	p := filepath.Join(string(d), batchName(records))
+	tmp, err := os.CreateTemp(string(d), filepath.Base(p)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = tmp.Write(data); err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), p)
+}
@@ -0,0 +1,173 @@
+package connector
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	api "github.com/justagabriel/proglog/api/v1"
+	"github.com/justagabriel/proglog/client"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// SourceFileHeader is added to the records of a Source, it holds the path of
+// the file the line was read from.
+const SourceFileHeader = "proglog-source-file"
+
+type SourceConfig struct {
+	Topic string
+	// Group commits the position in each file, like consumer groups commit
+	// offsets, to the group suffixed with ":" and the file's path. It's
+	// required, the ACL has to permit the groups, e.g. with "group/shipper:*".
+	Group string
+	// Files are tailed, missing ones once they're created.
+	Files []string
+	// PollInterval is how often the files are checked for new lines,
+	// defaults to a second.
+	PollInterval time.Duration
+	// MaxRecords caps the lines appended at once, defaults to 100.
+	MaxRecords int
+}
+
+// Source tails files and appends each of their lines as record to a topic,
+// making the log a target for log shippers. The position in each file is
+// committed to the log once its lines were appended, lines appended but not
+// committed yet are appended again after a restart. A file shorter than the
+// position was truncated, e.g. by log rotation, and is read from its start.
+type Source struct {
+	client *client.Client
+	config SourceConfig
+}
+
+func NewSource(cl *client.Client, config SourceConfig) *Source {
+	if config.PollInterval == 0 {
+		config.PollInterval = time.Second
+	}
+	if config.MaxRecords == 0 {
+		config.MaxRecords = 100
+	}
+	return &Source{client: cl, config: config}
+}
+
+// Run tails the files until ctx is done or appending failed.
+func (s *Source) Run(ctx context.Context) error {
+	if s.config.Group == "" {
+		return status.Error(codes.InvalidArgument, "group is required")
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, len(s.config.Files))
+	for _, path := range s.config.Files {
+		wg.Add(1)
+		go func(path string) {
+			defer wg.Done()
+			if err := s.tail(ctx, path); err != nil {
+				errs <- err
+				cancel()
+			}
+		}(path)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if !errors.Is(err, context.Canceled) && status.Code(err) != codes.Canceled {
+			return err
+		}
+	}
+	return ctx.Err()
+}
+
+func (s *Source) tail(ctx context.Context, path string) error {
+	group := s.config.Group + ":" + path
+	res, err := s.client.FetchOffset(ctx, &api.FetchOffsetRequest{Group: group, Topic: s.config.Topic})
+	if err != nil && status.Code(err) != codes.NotFound {
+		return err
+	}
+	pos := res.GetOffset()
+
+	ticker := time.NewTicker(s.config.PollInterval)
+	defer ticker.Stop()
+	for {
+		if pos, err = s.read(ctx, path, group, pos); err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// read appends the complete lines following pos and returns the position
+// after them.
+func (s *Source) read(ctx context.Context, path, group string, pos uint64) (uint64, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return pos, nil
+	}
+	if err != nil {
+		return pos, err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return pos, err
+	}
+	if uint64(fi.Size()) < pos {
+		pos = 0
+	}
+	if _, err = f.Seek(int64(pos), io.SeekStart); err != nil {
+		return pos, err
+	}
+
+	r := bufio.NewReader(f)
+	var batch []*api.Record
+	next := pos
+	for {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			// the rest of the line isn't written yet
+			break
+		}
+		if err != nil {
+			return pos, err
+		}
+		next += uint64(len(line))
+		batch = append(batch, &api.Record{
+			Value:   bytes.TrimRight(line, "\r\n"),
+			Headers: []*api.Header{{Key: SourceFileHeader, Value: []byte(path)}},
+		})
+		if len(batch) == s.config.MaxRecords {
+			if err := s.append(ctx, group, batch, next); err != nil {
+				return pos, err
+			}
+			pos, batch = next, nil
+		}
+	}
+	if len(batch) > 0 {
+		if err := s.append(ctx, group, batch, next); err != nil {
+			return pos, err
+		}
+	}
+	return next, nil
+}
+
+// append appends the lines and commits the position after them.
+func (s *Source) append(ctx context.Context, group string, batch []*api.Record, next uint64) error {
+	_, err := s.client.CreateBatch(ctx, &api.CreateRecordBatchRequest{Topic: s.config.Topic, Records: batch})
+	if err != nil {
+		return err
+	}
+	_, err = s.client.CommitOffset(ctx, &api.CommitOffsetRequest{Group: group, Topic: s.config.Topic, Offset: next})
+	return err
+}
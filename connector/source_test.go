@@ -0,0 +1,135 @@
+package connector
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	api "github.com/justagabriel/proglog/api/v1"
+	"github.com/justagabriel/proglog/client"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSource(t *testing.T) {
+	scenarios := map[string]func(t *testing.T, cl *client.Client, path string){
+		"complete lines are appended":           testSourceLines,
+		"source resumes at the committed line":  testSourceResume,
+		"truncated files are read anew":         testSourceTruncated,
+		"missing files are tailed once created": testSourceMissing,
+	}
+
+	for scenario, fn := range scenarios {
+		t.Run(scenario, func(t *testing.T) {
+			fn(t, setupClient(t), filepath.Join(t.TempDir(), "app.log"))
+		})
+	}
+}
+
+func testSourceLines(t *testing.T, cl *client.Client, path string) {
+	// arrange
+	writeLines(t, path, "line 0\nline 1\r\nline")
+	source := newTestSource(cl, path)
+
+	// act
+	tailSource(t, source, cl, path, func() {
+		requireCommitted(t, cl, path, 15)
+		writeLines(t, path, " 2\n")
+		requireCommitted(t, cl, path, 22)
+	})
+
+	// assert
+	requireLines(t, cl, path, "line 0", "line 1", "line 2")
+}
+
+func testSourceResume(t *testing.T, cl *client.Client, path string) {
+	// arrange
+	writeLines(t, path, "line 0\n")
+	tailSource(t, newTestSource(cl, path), cl, path, func() { requireCommitted(t, cl, path, 7) })
+	writeLines(t, path, "line 1\n")
+
+	// act
+	tailSource(t, newTestSource(cl, path), cl, path, func() { requireCommitted(t, cl, path, 14) })
+
+	// assert
+	requireLines(t, cl, path, "line 0", "line 1")
+}
+
+func testSourceTruncated(t *testing.T, cl *client.Client, path string) {
+	// arrange
+	writeLines(t, path, "line 0\nline 1\n")
+	source := newTestSource(cl, path)
+
+	// act
+	tailSource(t, source, cl, path, func() {
+		requireCommitted(t, cl, path, 14)
+		require.NoError(t, os.WriteFile(path, []byte("line 2\n"), 0o600))
+		requireCommitted(t, cl, path, 7)
+	})
+
+	// assert
+	requireLines(t, cl, path, "line 0", "line 1", "line 2")
+}
+
+func testSourceMissing(t *testing.T, cl *client.Client, path string) {
+	// arrange
+	source := newTestSource(cl, path)
+
+	// act
+	tailSource(t, source, cl, path, func() {
+		time.Sleep(50 * time.Millisecond)
+		writeLines(t, path, "line 0\n")
+		requireCommitted(t, cl, path, 7)
+	})
+
+	// assert
+	requireLines(t, cl, path, "line 0")
+}
+
+func newTestSource(cl *client.Client, path string) *Source {
+	return NewSource(cl, SourceConfig{Topic: "logs", Group: "shipper", Files: []string{path}, PollInterval: 10 * time.Millisecond})
+}
+
+// tailSource runs the source while fn runs.
+func tailSource(t *testing.T, source *Source, cl *client.Client, path string, fn func()) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- source.Run(ctx) }()
+	fn()
+	cancel()
+	require.ErrorIs(t, <-done, context.Canceled)
+}
+
+func writeLines(t *testing.T, path, lines string) {
+	t.Helper()
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	require.NoError(t, err)
+	_, err = f.WriteString(lines)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+}
+
+func requireCommitted(t *testing.T, cl *client.Client, path string, pos uint64) {
+	t.Helper()
+	require.Eventually(t, func() bool {
+		res, err := cl.FetchOffset(context.Background(), &api.FetchOffsetRequest{Group: "shipper:" + path, Topic: "logs"})
+		return err == nil && res.Offset == pos
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+// requireLines requires the topic to hold exactly the lines of the file.
+func requireLines(t *testing.T, cl *client.Client, path string, lines ...string) {
+	t.Helper()
+	ctx := context.Background()
+	highest, err := cl.HighestOffset(ctx, &api.HighestOffsetRequest{Topic: "logs"})
+	require.NoError(t, err)
+	require.Equal(t, uint64(len(lines)-1), highest.Offset)
+	for i, line := range lines {
+		res, err := cl.Get(ctx, &api.GetRecordRequest{Topic: "logs", Offset: uint64(i)})
+		require.NoError(t, err)
+		require.Equal(t, line, string(res.Record.Value))
+		require.Equal(t, path, string(res.Record.Headers[0].Value))
+	}
+}
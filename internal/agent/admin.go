@@ -0,0 +1,109 @@
+package agent
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"reflect"
+	runtimepprof "runtime/pprof"
+	"time"
+
+	api "github.com/justagabriel/proglog/api/v1"
+)
+
+func (a *Agent) setupAdminServer() error {
+	if a.Config.AdminPort == 0 {
+		return nil
+	}
+	// the admin endpoints aren't authenticated, so they're only reachable locally
+	ln, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", a.Config.AdminPort))
+	if err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+	mux.HandleFunc("/debug/goroutines", a.serveGoroutines)
+	mux.HandleFunc("/debug/config", a.serveConfig)
+	mux.HandleFunc("/debug/segments", a.serveSegments)
+	a.adminServer = &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		if err := a.adminServer.Serve(ln); err != http.ErrServerClosed {
+			_ = a.Shutdown()
+		}
+	}()
+	return nil
+}
+
+// serveGoroutines dumps the stacks of all goroutines.
+func (a *Agent) serveGoroutines(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_ = runtimepprof.Lookup("goroutine").WriteTo(w, 2)
+}
+
+// serveConfig writes the current config, as changed by Reload.
+func (a *Agent) serveConfig(w http.ResponseWriter, r *http.Request) {
+	a.reloadLock.Lock()
+	config := configValues(a.Config)
+	a.reloadLock.Unlock()
+	writeJSON(w, config)
+}
+
+// serveSegments writes the segment statistics of every topic.
+func (a *Agent) serveSegments(w http.ResponseWriter, r *http.Request) {
+	segments := make(map[string][]*api.SegmentStats)
+	for _, topic := range a.log.Topics() {
+		stats, err := a.log.SegmentStats(topic)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		segments[topic] = stats
+	}
+	writeJSON(w, segments)
+}
+
+// configValues returns the plain values of the config by field name. TLS
+// configs, keys, callbacks and other implementations are left out, they
+// can't be encoded and may hold secrets.
+func configValues(c Config) map[string]interface{} {
+	v := reflect.ValueOf(c)
+	values := make(map[string]interface{}, v.NumField())
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Field(i)
+		kind := f.Kind()
+		if kind == reflect.Slice {
+			kind = f.Type().Elem().Kind()
+		}
+		switch kind {
+		case reflect.Func, reflect.Interface, reflect.Pointer, reflect.Chan:
+			continue
+		}
+		if d, ok := f.Interface().(time.Duration); ok {
+			values[v.Type().Field(i).Name] = d.String()
+			continue
+		}
+		values[v.Type().Field(i).Name] = f.Interface()
+	}
+	return values
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
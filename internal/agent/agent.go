@@ -1,33 +1,71 @@
 package agent
 
 import (
-	"bytes"
+	"context"
 	"crypto/tls"
+	"crypto/x509"
 	"fmt"
 	"io"
 	"net"
+	"net/http"
+	"path/filepath"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/hashicorp/raft"
+	api "github.com/justagabriel/proglog/api/v1"
+	logclient "github.com/justagabriel/proglog/client"
 	"github.com/justagabriel/proglog/internal/auth"
 	"github.com/justagabriel/proglog/internal/discovery"
 	"github.com/justagabriel/proglog/internal/log"
 	"github.com/justagabriel/proglog/internal/server"
 	"github.com/soheilhy/cmux"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/trace"
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
 )
 
+// Version is published to the other members, it's set when building, e.g.
+// with -ldflags "-X github.com/justagabriel/proglog/internal/agent.Version=v1.2.0".
+var Version = "dev"
+
 // Agent encapsulates all components of a Node.
 type Agent struct {
 	Config Config
 
 	mux        cmux.CMux
 	log        *log.DistributedLog
-	server     *grpc.Server
+	authorizer *auth.Authorizer
+	// stopACLWatch stops reloading the ACL files on changes
+	stopACLWatch func() error
+	server       *grpc.Server
+	// forwarder forwards writes received as a follower to the leader
+	forwarder  *server.Forwarder
+	httpServer *http.Server
+	// metrics serves the Prometheus metrics, nil if disabled
+	metrics       *server.MetricsExporter
+	metricsServer *http.Server
+	// adminServer serves the debug endpoints, nil if disabled
+	adminServer *http.Server
+	// tracer exports spans over OTLP, nil if disabled
+	tracer     *server.OTLPExporter
 	membership *discovery.Membership
+	// serfLn hands over the gossip's connections on the RPC port, nil unless
+	// SerfOnRPCPort is set
+	serfLn net.Listener
+
+	// logLevel, requestLogger and the rate limiters are changed by Reload
+	logLevel          zap.AtomicLevel
+	requestLogger     *server.RequestLogger
+	rateLimiter       *server.RateLimiter
+	clientRateLimiter *server.RateLimiter
+	reloadLock        sync.Mutex
+	// diskUsage is the size of the data dir as last measured
+	diskUsage atomic.Uint64
 
 	shutdown     bool
 	shutdowns    chan struct{}
@@ -38,14 +76,165 @@ type Agent struct {
 type Config struct {
 	ServerTLSConfig *tls.Config
 	PeerTLSConfig   *tls.Config
+	// RaftTLSConfig serves the raft connections of peers dialing with
+	// PeerTLSConfig, defaults to ServerTLSConfig. It lets replication verify
+	// peers against a CA of their own rather than the clients' one.
+	RaftTLSConfig *tls.Config
+	// PeerSubjects are the subjects of the servers' peer certificates, whose
+	// forwarded requests are trusted, see server.Config.PeerSubjects.
+	// Defaults to the subject of PeerTLSConfig's certificate.
+	PeerSubjects []string
+	// SerfEncryptKeys encrypt the gossip between nodes, see
+	// discovery.Config.EncryptKeys.
+	SerfEncryptKeys [][]byte
 	DataDir         string
 	BindAddr        string
 	RPCPort         int
-	NodeName        string
-	StartJoinAddr   []string
-	ACLModelFile    string
-	ACLPolicyFile   string
+	// SerfOnRPCPort serves the gossip on the RPC port along with raft and the
+	// RPC clients, so nodes expose a single port. BindAddr's port isn't used
+	// and StartJoinAddr lists RPC addresses then, all nodes of a cluster have
+	// to agree on it.
+	SerfOnRPCPort bool
+	// HTTPPort serves the JSON gateway of the log, zero disables it.
+	HTTPPort int
+	// WebSocketOrigins are the web pages allowed to use the gateway's
+	// WebSocket bridge, see server.Config.
+	WebSocketOrigins []string
+	// GRPCWeb serves the RPCs to gRPC-web clients on the HTTP port as well,
+	// with CORS for the pages of GRPCWebOrigins, see server.NewGRPCWebHandler.
+	GRPCWeb        bool
+	GRPCWebOrigins []string
+	// MetricsPort serves Prometheus metrics at /metrics over plain HTTP, zero disables it.
+	MetricsPort int
+	// AdminPort serves pprof, expvar, the current config, segment statistics
+	// and goroutine dumps on localhost under /debug/, zero disables it.
+	AdminPort int
+	NodeName  string
+	// Zone is the availability zone or rack the node runs in, it's published to the others.
+	Zone string
+	// MaxVoters caps the servers taking part in raft elections and commits,
+	// the voters are spread across zones. Zero makes every server a voter.
+	MaxVoters int
+	// ReadReplica nodes join as non-voters which are never promoted, they
+	// replicate the log and serve reads without slowing down commits.
+	ReadReplica bool
+	// Raft takes a snapshot every SnapshotInterval once SnapshotThreshold
+	// entries were appended since the last one and keeps SnapshotRetain
+	// snapshots. SnapshotTrailingLogs entries are kept after a snapshot,
+	// followers lagging further behind catch up from the snapshot. Zero
+	// values use raft's defaults, one snapshot is kept by default.
+	SnapshotInterval     time.Duration
+	SnapshotThreshold    uint64
+	SnapshotTrailingLogs uint64
+	SnapshotRetain       int
+	StartJoinAddr        []string
+	StartJoinDNS         string
+	ACLModelFile         string
+	ACLPolicyFile        string
+	// Authenticators are tried in order, defaults to client certificates only.
+	// If others than server.TLSAuthenticator are set, RPC clients may connect
+	// without a client certificate, peers still need one.
+	Authenticators []server.Authenticator
+	// TenantResolvers enable multi-tenancy, see server.Config.
+	TenantResolvers []server.TenantResolver
+	// TenantQuotas caps the bytes of each tenant's records, see log.Config.
+	TenantQuotas map[string]uint64
+	// UnaryInterceptors and StreamInterceptors are added to the server's
+	// interceptors, see server.Config.
+	UnaryInterceptors  []grpc.UnaryServerInterceptor
+	StreamInterceptors []grpc.StreamServerInterceptor
+	// Bootstrap bootstraps a cluster of this node only, which the others
+	// join. BootstrapExpect bootstraps the cluster once as many nodes joined
+	// each other instead, see discovery.Config.BootstrapExpect.
 	Bootstrap       bool
+	BootstrapExpect int
+	RateLimits      server.RateLimits
+	// ClientRateLimits limit each client across topics, see server.Config.ClientRateLimits.
+	ClientRateLimits server.RateLimits
+	StreamLimits     server.StreamLimits
+	// Scheduling bounds the appends and reads in progress, see server.Config.
+	Scheduling server.Scheduling
+	// Transport sets the RPC connections' message size limits and
+	// keepalives, see server.Transport.
+	Transport server.Transport
+	// Reflection lets tools like grpcurl discover the RPC services.
+	Reflection bool
+	// DiskWatermarks throttle and reject appends once the data dir takes up
+	// too many bytes, it's measured every DiskCheckInterval, 10 seconds by
+	// default. The zero value disables them.
+	DiskWatermarks    server.DiskWatermarks
+	DiskCheckInterval time.Duration
+	// MaxConnectionsPerClient limits the RPC connections of each client host, zero disables the limit.
+	MaxConnectionsPerClient int
+	// RetentionMaxAge and RetentionMaxBytes limit each topic, see log.Config.Retention.
+	RetentionMaxAge   time.Duration
+	RetentionMaxBytes uint64
+	// Compact keeps only the latest record per key in old segments.
+	Compact bool
+	// TombstoneRetention is how long compaction keeps tombstones, zero keeps them.
+	TombstoneRetention time.Duration
+	// TopicDeleteGracePeriod keeps deleted topics for undeleting, see
+	// log.Config.TopicDeleteGracePeriod.
+	TopicDeleteGracePeriod time.Duration
+	// IdempotencyKeyTTL is how long HTTP produces are deduplicated by their
+	// Idempotency-Key, see log.Config.IdempotencyKeyTTL.
+	IdempotencyKeyTTL time.Duration
+	// SegmentMaxAge rolls segments by time as well, see log.Config.Segment.MaxAge.
+	SegmentMaxAge time.Duration
+	// PreallocateSegments and RecycleSegments take creating segment files
+	// off the append path, see log.Config.Segment.Preallocate and Recycle.
+	PreallocateSegments bool
+	RecycleSegments     bool
+	// SyncPolicy controls when appended records are synced to disk.
+	SyncPolicy log.SyncPolicy
+	// Compression compresses the records on disk.
+	Compression log.Compression
+	// IndexInterval indexes every Nth record only, see log.Config.Segment.IndexInterval.
+	IndexInterval uint64
+	// IndexAccess selects how index files are accessed, see log.IndexAccess.
+	IndexAccess log.IndexAccess
+	// CacheBytes and ReadAheadBytes keep records in memory for consumers,
+	// see log.Config.CacheBytes and log.Config.Segment.ReadAheadBytes.
+	CacheBytes     uint64
+	ReadAheadBytes uint64
+	// MaxRecordBytes rejects larger records, zero disables the limit.
+	MaxRecordBytes uint64
+	// Schemas rejects records not matching their topic's schema, see the
+	// schema package. Nil accepts all records.
+	Schemas server.SchemaValidator
+	// TieredStorage receives segments not written to for OffloadAfter, see
+	// log.Config.Tiering. Objects are prefixed by the node name, nil disables tiering.
+	TieredStorage log.ObjectStore
+	OffloadAfter  time.Duration
+	// OTLPEndpoint receives the RPCs' spans over OTLP/HTTP, e.g. http://localhost:4318/v1/traces.
+	// Empty disables exporting spans.
+	OTLPEndpoint string
+	// TraceSampler decides which RPCs are traced, defaults to all of them.
+	TraceSampler trace.Sampler
+	// EncryptionKeys encrypts the records on disk if set, all nodes need the same keys.
+	EncryptionKeys log.KeyProvider
+	// LogLevel is one of zap's levels, e.g. "info", empty logs at debug level.
+	LogLevel string
+	// RequestLog samples the RPCs' logs, see server.RequestLogConfig.
+	RequestLog server.RequestLogConfig
+	// LogFaults and ServerFaults inject failures for tests of applications
+	// embedding the agent, see log.Faults and server.Faults. Nil injects none.
+	LogFaults    *log.Faults
+	ServerFaults *server.Faults
+	// LoadConfig returns the config ReloadConfig applies, e.g. by re-reading
+	// the config file. Nil disables the ReloadConfig RPC.
+	LoadConfig func() (Config, error)
+	// ShutdownGracePeriod is how long running requests may take to finish on
+	// shutdown before they're cancelled, defaults to 10 seconds.
+	ShutdownGracePeriod time.Duration
+	// MirrorAddr is the RPC address of an independent cluster, whose
+	// MirrorTopics the node copies into its own cluster, see client.Mirror.
+	// The mirror's positions are kept in the data dir. Only one node of a
+	// cluster may mirror the topics, empty disables mirroring.
+	MirrorAddr   string
+	MirrorTopics []string
+	// MirrorTLSConfig dials MirrorAddr, defaults to PeerTLSConfig.
+	MirrorTLSConfig *tls.Config
 }
 
 // RPCAddr returns the URI of the Agent client.
@@ -70,8 +259,15 @@ func New(config Config) (*Agent, error) {
 		a.setupLogger,
 		a.setupMux,
 		a.setupLog,
+		a.setupDiskUsage,
+		a.setupAuthorizer,
+		a.setupTracing,
 		a.setupServer,
+		a.setupHTTPServer,
+		a.setupMetricsServer,
+		a.setupAdminServer,
 		a.setupMembership,
+		a.setupMirror,
 	}
 
 	for _, fn := range setup {
@@ -94,7 +290,14 @@ func (a *Agent) serve() error {
 }
 
 func (a *Agent) setupLogger() error {
-	logger, err := zap.NewDevelopment()
+	level, err := parseLogLevel(a.Config.LogLevel)
+	if err != nil {
+		return err
+	}
+	a.logLevel = zap.NewAtomicLevelAt(level)
+	config := zap.NewDevelopmentConfig()
+	config.Level = a.logLevel
+	logger, err := config.Build()
 	if err != nil {
 		return err
 	}
@@ -113,22 +316,57 @@ func (a *Agent) setupMux() error {
 		return err
 	}
 	a.mux = cmux.New(ln)
+	// the gossip has to be matched before the RPC server takes all the rest
+	if a.Config.SerfOnRPCPort {
+		a.serfLn = a.mux.Match(matchFirstByte(discovery.SerfRPC))
+	}
 	return nil
 }
 
-func (a *Agent) setupLog() error {
-	raftLn := a.mux.Match(func(r io.Reader) bool {
-		b := make([]byte, 1)
-		if _, err := r.Read(b); err != nil {
+// matchFirstByte matches the connections starting with b.
+func matchFirstByte(b byte) cmux.Matcher {
+	return func(r io.Reader) bool {
+		first := make([]byte, 1)
+		if _, err := r.Read(first); err != nil {
 			return false
 		}
-		return bytes.Equal(b, []byte{byte(log.RaftRPC)})
-	})
+		return first[0] == b
+	}
+}
+
+func (a *Agent) setupLog() error {
+	raftLn := a.mux.Match(matchFirstByte(log.RaftRPC))
 
 	logConfig := log.Config{}
+	logConfig.Retention.MaxAge = a.Config.RetentionMaxAge
+	logConfig.Retention.MaxBytes = a.Config.RetentionMaxBytes
+	logConfig.Retention.Compact = a.Config.Compact
+	logConfig.Retention.TombstoneRetention = a.Config.TombstoneRetention
+	logConfig.Segment.SyncPolicy = a.Config.SyncPolicy
+	logConfig.Segment.Compression = a.Config.Compression
+	logConfig.Segment.IndexInterval = a.Config.IndexInterval
+	logConfig.Segment.IndexAccess = a.Config.IndexAccess
+	logConfig.Segment.MaxAge = a.Config.SegmentMaxAge
+	logConfig.Segment.Preallocate = a.Config.PreallocateSegments
+	logConfig.Segment.Recycle = a.Config.RecycleSegments
+	logConfig.Segment.ReadAheadBytes = a.Config.ReadAheadBytes
+	logConfig.CacheBytes = a.Config.CacheBytes
+	logConfig.TenantQuotas = a.Config.TenantQuotas
+	logConfig.TopicDeleteGracePeriod = a.Config.TopicDeleteGracePeriod
+	logConfig.IdempotencyKeyTTL = a.Config.IdempotencyKeyTTL
+	logConfig.Segment.Encryption = a.Config.EncryptionKeys
+	logConfig.MaxRecordBytes = a.Config.MaxRecordBytes
+	logConfig.Tiering.Store = a.Config.TieredStorage
+	logConfig.Tiering.OffloadAfter = a.Config.OffloadAfter
+	logConfig.Tiering.Prefix = a.Config.NodeName
+	logConfig.Faults = a.Config.LogFaults
+	raftTLSConfig := a.Config.RaftTLSConfig
+	if raftTLSConfig == nil {
+		raftTLSConfig = a.Config.ServerTLSConfig
+	}
 	logConfig.Raft.StreamLayer = log.NewStreamLayer(
 		raftLn,
-		a.Config.ServerTLSConfig,
+		raftTLSConfig,
 		a.Config.PeerTLSConfig,
 	)
 
@@ -140,7 +378,12 @@ func (a *Agent) setupLog() error {
 	logConfig.Raft.BindAddr = rpcAddr
 	logConfig.Raft.LocalID = raft.ServerID(a.Config.NodeName)
 	logConfig.Raft.Bootstrap = a.Config.Bootstrap
-	logConfig.Raft.LeaderLeaseTimeout = 50 * time.Millisecond
+	logConfig.Raft.Zone = a.Config.Zone
+	logConfig.Raft.MaxVoters = a.Config.MaxVoters
+	logConfig.Raft.SnapshotInterval = a.Config.SnapshotInterval
+	logConfig.Raft.SnapshotThreshold = a.Config.SnapshotThreshold
+	logConfig.Raft.TrailingLogs = a.Config.SnapshotTrailingLogs
+	logConfig.Raft.SnapshotRetain = a.Config.SnapshotRetain
 	a.log, err = log.NewDistributedLog(
 		a.Config.DataDir,
 		logConfig,
@@ -155,20 +398,25 @@ func (a *Agent) setupLog() error {
 }
 
 func (a *Agent) setupServer() error {
-	authorizer, err := auth.New(a.Config.ACLModelFile, a.Config.ACLPolicyFile)
-	if err != nil {
-		return err
+	// peers dial each other with the peer certificate, like raft does
+	peerCreds := insecure.NewCredentials()
+	if a.Config.PeerTLSConfig != nil {
+		peerCreds = credentials.NewTLS(a.Config.PeerTLSConfig)
 	}
+	a.forwarder = server.NewForwarder(grpc.WithTransportCredentials(peerCreds))
+	// the gateway shares the limiters, so Reload changes the limits of both
+	a.rateLimiter = server.NewRateLimiter(a.Config.RateLimits)
+	a.clientRateLimiter = server.NewRateLimiter(a.Config.ClientRateLimits)
+	a.requestLogger = server.NewRequestLogger(a.Config.RequestLog)
 
-	serverConfig := &server.Config{
-		CommitLog:   a.log,
-		Authorizer:  authorizer,
-		GetServerer: a.log,
+	serverConfig, err := a.serverConfig()
+	if err != nil {
+		return err
 	}
 
 	var opts []grpc.ServerOption
-	if a.Config.ServerTLSConfig != nil {
-		creds := credentials.NewTLS(a.Config.ServerTLSConfig)
+	if tlsConfig := a.serverTLSConfig(); tlsConfig != nil {
+		creds := credentials.NewTLS(tlsConfig)
 		opts = append(opts, grpc.Creds(creds))
 	}
 
@@ -177,7 +425,7 @@ func (a *Agent) setupServer() error {
 		return err
 	}
 
-	grpcLn := a.mux.Match(cmux.Any())
+	grpcLn := server.LimitConnections(a.mux.Match(cmux.Any()), a.Config.MaxConnectionsPerClient)
 
 	go func() {
 		if err := a.server.Serve(grpcLn); err != nil {
@@ -188,23 +436,369 @@ func (a *Agent) setupServer() error {
 	return err
 }
 
+func (a *Agent) setupHTTPServer() error {
+	if a.Config.HTTPPort == 0 {
+		return nil
+	}
+	serverConfig, err := a.serverConfig()
+	if err != nil {
+		return err
+	}
+	handler, err := server.NewHTTPHandler(serverConfig)
+	if err != nil {
+		return err
+	}
+	if a.Config.GRPCWeb {
+		handler = server.NewGRPCWebHandler(a.server, a.Config.GRPCWebOrigins, handler)
+	}
+
+	ln, err := net.Listen("tcp", fmt.Sprintf(":%d", a.Config.HTTPPort))
+	if err != nil {
+		return err
+	}
+	// WebSocket subscriptions outlive Shutdown, they end with the agent
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-a.shutdowns
+		cancel()
+	}()
+	a.httpServer = &http.Server{
+		Handler:           handler,
+		TLSConfig:         a.serverTLSConfig(),
+		ReadHeaderTimeout: 10 * time.Second,
+		BaseContext:       func(net.Listener) context.Context { return ctx },
+	}
+
+	go func() {
+		var err error
+		if a.httpServer.TLSConfig != nil {
+			err = a.httpServer.ServeTLS(ln, "", "")
+		} else {
+			err = a.httpServer.Serve(ln)
+		}
+		if err != http.ErrServerClosed {
+			_ = a.Shutdown()
+		}
+	}()
+	return nil
+}
+
+// setupAuthorizer loads the ACL and reloads it whenever its files change.
+func (a *Agent) setupAuthorizer() error {
+	var err error
+	a.authorizer, err = auth.New(a.Config.ACLModelFile, a.Config.ACLPolicyFile)
+	if err != nil {
+		return err
+	}
+	return a.watchACL()
+}
+
+func (a *Agent) watchACL() error {
+	logger := zap.L().Named("auth")
+	var err error
+	a.stopACLWatch, err = a.authorizer.Watch(func(err error) {
+		logger.Error("failed to reload ACL, keeping the previous one", zap.Error(err))
+	})
+	return err
+}
+
+// ReloadACL re-reads the ACL model and policy files, which are also reloaded
+// whenever they change. Connected clients and their streams are kept.
+func (a *Agent) ReloadACL() error {
+	return a.authorizer.Reload()
+}
+
+func (a *Agent) setupTracing() error {
+	if a.Config.OTLPEndpoint == "" {
+		return nil
+	}
+	a.tracer = server.NewOTLPExporter(server.OTLPConfig{
+		Endpoint: a.Config.OTLPEndpoint,
+		Resource: map[string]string{
+			"service.name":        "proglog",
+			"service.instance.id": a.Config.NodeName,
+		},
+	})
+	trace.RegisterExporter(a.tracer)
+	return nil
+}
+
+func (a *Agent) setupMetricsServer() error {
+	if a.Config.MetricsPort == 0 {
+		return nil
+	}
+	var err error
+	metricsConfig := &server.Config{
+		SegmentStatser: a.log,
+		TopicLister:    a.log,
+		DiskWatermarks: a.Config.DiskWatermarks,
+	}
+	if wm := a.Config.DiskWatermarks; wm.Low != 0 || wm.High != 0 {
+		metricsConfig.DiskUsager = a
+	}
+	a.metrics, err = server.NewMetricsExporter(metricsConfig)
+	if err != nil {
+		return err
+	}
+
+	ln, err := net.Listen("tcp", fmt.Sprintf(":%d", a.Config.MetricsPort))
+	if err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", a.metrics)
+	a.metricsServer = &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	view.RegisterExporter(a.metrics)
+
+	go func() {
+		if err := a.metricsServer.Serve(ln); err != http.ErrServerClosed {
+			_ = a.Shutdown()
+		}
+	}()
+	return nil
+}
+
+func (a *Agent) serverConfig() (*server.Config, error) {
+	config := &server.Config{
+		CommitLog:          a.log,
+		BatchAppender:      a.log,
+		Transactor:         a.log,
+		TopicAdmin:         a.log,
+		Maintainer:         a.log,
+		AcksAppender:       a.log,
+		ContextCommitLog:   a.log,
+		Authorizer:         a.authorizer,
+		Authenticators:     a.Config.Authenticators,
+		TenantResolvers:    a.Config.TenantResolvers,
+		UnaryInterceptors:  a.Config.UnaryInterceptors,
+		StreamInterceptors: a.Config.StreamInterceptors,
+		GetServerer:        a,
+		MembershipChanger:  a.log,
+		ReadOnlier:         a.log,
+		Watcher:            a.log,
+		Bookmarker:         a.log,
+		OffsetCommitter:    a.log,
+		SegmentStatser:     a.log,
+		LogStatser:         a.log,
+		Verifier:           a.log,
+		DurabilityReporter: a.log,
+		EncodedReader:      a.log,
+		Truncater:          a.log,
+		RecordDeleter:      a.log,
+		Backuper:           a.log,
+		TimeSearcher:       a.log,
+		KeyReader:          a.log,
+		OffsetRanger:       a.log,
+		LeaderReader:       a.log,
+		Readier:            a.log,
+		TraceSampler:       a.Config.TraceSampler,
+		RateLimits:         a.Config.RateLimits,
+		ClientRateLimits:   a.Config.ClientRateLimits,
+		RateLimiter:        a.rateLimiter,
+		ClientRateLimiter:  a.clientRateLimiter,
+		RequestLogger:      a.requestLogger,
+		StreamLimits:       a.Config.StreamLimits,
+		Scheduling:         a.Config.Scheduling,
+		Transport:          a.Config.Transport,
+		Reflection:         a.Config.Reflection,
+		DiskWatermarks:     a.Config.DiskWatermarks,
+		Forwarder:          a.forwarder,
+		PeerSubjects:       a.peerSubjects(),
+		MaxRecordBytes:     a.Config.MaxRecordBytes,
+		SchemaValidator:    a.Config.Schemas,
+		WebSocketOrigins:   a.Config.WebSocketOrigins,
+		Faults:             a.Config.ServerFaults,
+	}
+	if a.Config.LoadConfig != nil {
+		config.ConfigReloader = a
+	}
+	if wm := a.Config.DiskWatermarks; wm.Low != 0 || wm.High != 0 {
+		config.DiskUsager = a
+	}
+	return config, nil
+}
+
+// serverTLSConfig returns the TLS config for RPC clients, which may connect
+// without client certificate if other authenticators are configured.
+func (a *Agent) serverTLSConfig() *tls.Config {
+	tlsConfig := a.Config.ServerTLSConfig
+	if tlsConfig != nil && a.certOptional() && tlsConfig.ClientAuth == tls.RequireAndVerifyClientCert {
+		tlsConfig = tlsConfig.Clone()
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return tlsConfig
+}
+
+// peerSubjects returns the configured peer subjects, by default the subject
+// the TLS authenticator extracts from this server's peer certificate.
+func (a *Agent) peerSubjects() []string {
+	if a.Config.PeerSubjects != nil {
+		return a.Config.PeerSubjects
+	}
+	if a.Config.PeerTLSConfig == nil || len(a.Config.PeerTLSConfig.Certificates) == 0 {
+		return nil
+	}
+	cert, err := x509.ParseCertificate(a.Config.PeerTLSConfig.Certificates[0].Certificate[0])
+	if err != nil {
+		return nil
+	}
+	subject := server.CommonNameSubject
+	for _, authenticator := range a.Config.Authenticators {
+		if tlsAuthenticator, ok := authenticator.(server.TLSAuthenticator); ok {
+			if tlsAuthenticator.Subject != nil {
+				subject = tlsAuthenticator.Subject
+			}
+			break
+		}
+	}
+	if name, ok := subject(cert); ok {
+		return []string{name}
+	}
+	return nil
+}
+
+// certOptional tells whether authenticators other than client certificates are configured.
+func (a *Agent) certOptional() bool {
+	for _, authenticator := range a.Config.Authenticators {
+		if _, ok := authenticator.(server.TLSAuthenticator); !ok {
+			return true
+		}
+	}
+	return false
+}
+
 func (a *Agent) setupMembership() error {
 	rpcAddr, err := a.Config.RPCAddr()
 	if err != nil {
 		return err
 	}
+	bindAddr := a.Config.BindAddr
+	if a.Config.SerfOnRPCPort {
+		bindAddr = rpcAddr
+	}
 	discoveryConfig := discovery.Config{
 		NodeName: a.Config.NodeName,
-		BindAddr: a.Config.BindAddr,
-		Tags: map[string]string{
-			"rpc_addr": rpcAddr,
+		BindAddr: bindAddr,
+		// raft shares the RPC listener
+		Tags: discovery.Tags{
+			RPCAddr:  rpcAddr,
+			RaftAddr: rpcAddr,
+			Zone:     a.Config.Zone,
+			Version:  Version,
+			Replica:  a.Config.ReadReplica,
 		},
-		StartJoinAddrs: a.Config.StartJoinAddr,
+		StartJoinAddrs:  a.Config.StartJoinAddr,
+		StartJoinDNS:    a.Config.StartJoinDNS,
+		BootstrapExpect: a.Config.BootstrapExpect,
+		EncryptKeys:     a.Config.SerfEncryptKeys,
+		Listener:        a.serfLn,
 	}
 	a.membership, err = discovery.New(a.log, discoveryConfig)
 	return err
 }
 
+// setupMirror copies the topics of the cluster at MirrorAddr into this one
+// until shutdown, failed runs are logged and retried.
+func (a *Agent) setupMirror() error {
+	if a.Config.MirrorAddr == "" {
+		return nil
+	}
+	rpcAddr, err := a.Config.RPCAddr()
+	if err != nil {
+		return err
+	}
+	mirrorTLSConfig := a.Config.MirrorTLSConfig
+	if mirrorTLSConfig == nil {
+		mirrorTLSConfig = a.Config.PeerTLSConfig
+	}
+	dial := func(addr string, tlsConfig *tls.Config) (*logclient.Client, error) {
+		creds := insecure.NewCredentials()
+		if tlsConfig != nil {
+			creds = credentials.NewTLS(tlsConfig)
+		}
+		return logclient.New(logclient.Config{
+			Addr:        addr,
+			DialOptions: []grpc.DialOption{grpc.WithTransportCredentials(creds)},
+		})
+	}
+	source, err := dial(a.Config.MirrorAddr, mirrorTLSConfig)
+	if err != nil {
+		return err
+	}
+	// the node appends like a client of its cluster, followers forward
+	destination, err := dial(rpcAddr, a.Config.PeerTLSConfig)
+	if err != nil {
+		source.Close()
+		return err
+	}
+	mirror, err := logclient.NewMirror(source, destination, logclient.MirrorConfig{
+		Topics:    a.Config.MirrorTopics,
+		StateFile: filepath.Join(a.Config.DataDir, "mirror.json"),
+	})
+	if err != nil {
+		source.Close()
+		destination.Close()
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-a.shutdowns
+		cancel()
+	}()
+	go func() {
+		defer source.Close()
+		defer destination.Close()
+		logger := zap.L().Named("mirror")
+		for {
+			err := mirror.Run(ctx)
+			if ctx.Err() != nil {
+				return
+			}
+			logger.Error("failed to mirror", zap.String("addr", a.Config.MirrorAddr), zap.Error(err))
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(5 * time.Second):
+			}
+		}
+	}()
+	return nil
+}
+
+// GetServers lists the servers of the raft cluster along with the tags
+// their membership publishes.
+func (a *Agent) GetServers() ([]*api.Server, error) {
+	servers, err := a.log.GetServers()
+	if err != nil || a.membership == nil {
+		return servers, err
+	}
+	tags := a.membership.MemberTags()
+	for _, server := range servers {
+		t, ok := tags[server.Id]
+		if !ok {
+			continue
+		}
+		if t.RPCAddr != "" {
+			server.RpcAddr = t.RPCAddr
+		}
+		server.RaftAddr = t.RaftAddr
+		server.Zone = t.Zone
+		server.Version = t.Version
+	}
+	return servers, nil
+}
+
+// LeadershipChanges receives true once this node becomes the raft leader and
+// false once it loses leadership, so embedders can start and stop leader-only
+// jobs. Only the latest change is kept, the channel is closed on shutdown.
+func (a *Agent) LeadershipChanges() <-chan bool {
+	return a.log.LeadershipChanges()
+}
+
 // Shutdown free's up all resources hold by this Agent.
 func (a *Agent) Shutdown() error {
 	a.shutdownLock.Lock()
@@ -216,12 +810,52 @@ func (a *Agent) Shutdown() error {
 	a.shutdown = true
 	close(a.shutdowns)
 
+	grace := a.Config.ShutdownGracePeriod
+	if grace == 0 {
+		grace = 10 * time.Second
+	}
+	// the gateway and the RPC server drain within the same grace period
+	ctx, cancel := context.WithTimeout(context.Background(), grace)
+	defer cancel()
+
 	shutdownFuncs := []func() error{
 		a.membership.Leave,
 		func() error {
-			a.server.GracefulStop()
+			if a.httpServer == nil {
+				return nil
+			}
+			if err := a.httpServer.Shutdown(ctx); err != context.DeadlineExceeded {
+				return err
+			}
+			return a.httpServer.Close()
+		},
+		func() error {
+			if a.metricsServer != nil {
+				view.UnregisterExporter(a.metrics)
+				return a.metricsServer.Close()
+			}
+			return nil
+		},
+		func() error {
+			if a.adminServer != nil {
+				return a.adminServer.Close()
+			}
+			return nil
+		},
+		func() error {
+			deadline, _ := ctx.Deadline()
+			server.GracefulStop(a.server, time.Until(deadline))
+			return a.forwarder.Close()
+		},
+		a.stopACLWatch,
+		func() error {
+			if a.tracer != nil {
+				trace.UnregisterExporter(a.tracer)
+				return a.tracer.Close()
+			}
 			return nil
 		},
+		// closing syncs the records to disk
 		a.log.Close,
 	}
 
@@ -4,6 +4,8 @@ import (
 	"context"
 	"crypto/tls"
 	"fmt"
+	"io"
+	"net/http"
 	"os"
 	"testing"
 	"time"
@@ -12,8 +14,11 @@ import (
 	"github.com/justagabriel/proglog/internal"
 	"github.com/justagabriel/proglog/internal/config"
 	"github.com/justagabriel/proglog/internal/loadbalance"
+	"github.com/justagabriel/proglog/internal/server"
 	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zapcore"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/status"
 )
@@ -47,19 +52,33 @@ func TestAgent(t *testing.T) {
 
 		dataDir := internal.GetTempDir(t, "agent-test-log")
 
+		// the nodes gossip on their RPC ports, which they join each other at
 		var startJoinAddrs []string
 		if i != 0 {
-			startJoinAddrs = append(startJoinAddrs, agents[0].Config.BindAddr)
+			addr, err := agents[0].Config.RPCAddr()
+			require.NoError(t, err)
+			startJoinAddrs = append(startJoinAddrs, addr)
 		}
 
 		isLeader := i == 0
+		var metricsPort, adminPort int
+		if isLeader {
+			metricsPort = internal.FreePort(t)
+			adminPort = internal.FreePort(t)
+		}
 		agent, err := New(Config{
 			ServerTLSConfig: serverTLSConfig,
 			PeerTLSConfig:   peerTLSConfig,
+			RaftTLSConfig:   serverTLSConfig,
+			SerfEncryptKeys: [][]byte{[]byte("0123456789abcdef")},
+			SerfOnRPCPort:   true,
 			DataDir:         dataDir,
 			BindAddr:        bindAddr,
 			RPCPort:         rpcPort,
+			MetricsPort:     metricsPort,
+			AdminPort:       adminPort,
 			NodeName:        fmt.Sprintf("%d", i),
+			Zone:            fmt.Sprintf("zone-%d", i),
 			StartJoinAddr:   startJoinAddrs,
 			ACLModelFile:    config.ACLModelFile,
 			ACLPolicyFile:   config.ACLPolicyFile,
@@ -100,13 +119,37 @@ func TestAgent(t *testing.T) {
 
 	time.Sleep(3 * time.Second)
 
+	serversResp, err := leaderClient.GetServers(context.Background(), &api.GetServersRequest{})
+	require.NoError(t, err)
+	require.Len(t, serversResp.Servers, 3)
+	for _, server := range serversResp.Servers {
+		require.Equal(t, "zone-"+server.Id, server.Zone)
+		require.Equal(t, Version, server.Version)
+	}
+	select {
+	case leader := <-agents[0].LeadershipChanges():
+		require.True(t, leader)
+	default:
+		require.Fail(t, "the leader isn't notified of its leadership")
+	}
+
 	followerClient := client(t, agents[1], peerTLSConfig)
 	getResp2, err := followerClient.Get(context.Background(), &getReq)
 	require.NoError(t, err)
 	require.Equal(t, getResp2.Record.Value, createReq.Record.Value)
 
+	// without the load balancer, followers forward writes to the leader
+	followerAddr, err := agents[1].Config.RPCAddr()
+	require.NoError(t, err)
+	followerConn, err := grpc.Dial(followerAddr, grpc.WithTransportCredentials(credentials.NewTLS(peerTLSConfig)))
+	require.NoError(t, err)
+	defer followerConn.Close()
+	forwardedResp, err := api.NewLogClient(followerConn).Create(context.Background(), &createReq)
+	require.NoError(t, err)
+	require.Equal(t, createResp.Offset+1, forwardedResp.Offset)
+
 	getReqOutOfBounds := api.GetRecordRequest{
-		Offset: createResp.GetOffset() + 1,
+		Offset: forwardedResp.GetOffset() + 1,
 	}
 	getRespOutOfBounds, err := leaderClient.Get(context.Background(), &getReqOutOfBounds)
 	require.Nil(t, getRespOutOfBounds)
@@ -114,6 +157,29 @@ func TestAgent(t *testing.T) {
 	got := status.Code(err)
 	want := status.Code(api.ErrOffsetOutOfRange{}.GRPCStatus().Err())
 	require.Equal(t, got, want)
+
+	res, err := http.Get(fmt.Sprintf("http://%s:%d/metrics", host, agents[0].Config.MetricsPort))
+	require.NoError(t, err)
+	defer res.Body.Close()
+	metrics, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	require.Contains(t, string(metrics), `proglog_log_segments{topic="default"} 1`)
+
+	for path, want := range map[string]string{
+		"/debug/pprof/":     "goroutine",
+		"/debug/vars":       `"memstats"`,
+		"/debug/goroutines": "goroutine",
+		"/debug/config":     `"NodeName": "0"`,
+		"/debug/segments":   `"default"`,
+	} {
+		res, err := http.Get(fmt.Sprintf("http://127.0.0.1:%d%s", agents[0].Config.AdminPort, path))
+		require.NoError(t, err)
+		body, err := io.ReadAll(res.Body)
+		res.Body.Close()
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, res.StatusCode, path)
+		require.Contains(t, string(body), want, path)
+	}
 }
 
 func client(t *testing.T, agent *Agent, tlsConfig *tls.Config) api.LogClient {
@@ -128,3 +194,116 @@ func client(t *testing.T, agent *Agent, tlsConfig *tls.Config) api.LogClient {
 
 	return api.NewLogClient(conn)
 }
+
+func TestAgentReload(t *testing.T) {
+	// arrange
+	tlsConfig := func(certFile, keyFile string, server bool) *tls.Config {
+		c, err := config.SetupTLSConfig(config.TLSConfig{
+			CertFile:      certFile,
+			KeyFile:       keyFile,
+			CAFile:        config.CAFile,
+			ServerAddress: "localhost",
+			Server:        server,
+		})
+		require.NoError(t, err)
+		return c
+	}
+	peerTLSConfig := tlsConfig(config.RootClientCertFile, config.RootClientKeyFile, false)
+	dataDir := internal.GetTempDir(t, "agent-test-log")
+	defer os.RemoveAll(dataDir)
+	reloaded := make(chan Config, 1)
+	agent, err := New(Config{
+		ServerTLSConfig: tlsConfig(config.ServerCertFile, config.ServerKeyFile, true),
+		PeerTLSConfig:   peerTLSConfig,
+		DataDir:         dataDir,
+		BindAddr:        fmt.Sprintf("localhost:%d", internal.FreePort(t)),
+		RPCPort:         internal.FreePort(t),
+		NodeName:        "0",
+		ACLModelFile:    config.ACLModelFile,
+		ACLPolicyFile:   config.ACLPolicyFile,
+		Bootstrap:       true,
+		LoadConfig: func() (Config, error) {
+			return <-reloaded, nil
+		},
+	})
+	require.NoError(t, err)
+	defer agent.Shutdown()
+	cl := client(t, agent, peerTLSConfig)
+	ctx := context.Background()
+	cfg := agent.Config
+	cfg.LogLevel = "info"
+	cfg.RateLimits.Produce.RecordsPerSecond = 1
+
+	// act
+	invalid := cfg
+	invalid.LogLevel = "loud"
+	reloaded <- invalid
+	_, invalidErr := cl.ReloadConfig(ctx, &api.ReloadConfigRequest{})
+	reloaded <- cfg
+	dryRun, err := cl.ReloadConfig(ctx, &api.ReloadConfigRequest{DryRun: true})
+	require.NoError(t, err)
+	require.Equal(t, zapcore.DebugLevel, agent.logLevel.Level(), "dry runs don't apply the config")
+	reloaded <- cfg
+	res, err := cl.ReloadConfig(ctx, &api.ReloadConfigRequest{})
+	require.NoError(t, err)
+
+	// assert
+	require.Equal(t, codes.InvalidArgument, status.Code(invalidErr))
+	require.Contains(t, status.Convert(invalidErr).Message(), "LogLevel:  -> loud")
+	want := []string{
+		"LogLevel:  -> info",
+		"RateLimits: {Produce:{RecordsPerSecond:0 BytesPerSecond:0} Consume:{RecordsPerSecond:0 BytesPerSecond:0}} -> " +
+			"{Produce:{RecordsPerSecond:1 BytesPerSecond:0} Consume:{RecordsPerSecond:0 BytesPerSecond:0}}",
+	}
+	require.Equal(t, want, dryRun.Changes)
+	require.Equal(t, want, res.Changes)
+	require.Equal(t, zapcore.InfoLevel, agent.logLevel.Level())
+	_, err = cl.Create(ctx, &api.CreateRecordRequest{Record: &api.Record{Value: []byte("foo")}})
+	require.NoError(t, err)
+	_, err = cl.Create(ctx, &api.CreateRecordRequest{Record: &api.Record{Value: []byte("foo")}})
+	require.Equal(t, codes.ResourceExhausted, status.Code(err), "the reloaded rate limits apply")
+}
+
+func TestAgentDiskWatermarks(t *testing.T) {
+	// arrange
+	tlsConfig := func(certFile, keyFile string, server bool) *tls.Config {
+		c, err := config.SetupTLSConfig(config.TLSConfig{
+			CertFile:      certFile,
+			KeyFile:       keyFile,
+			CAFile:        config.CAFile,
+			ServerAddress: "localhost",
+			Server:        server,
+		})
+		require.NoError(t, err)
+		return c
+	}
+	peerTLSConfig := tlsConfig(config.RootClientCertFile, config.RootClientKeyFile, false)
+	dataDir := internal.GetTempDir(t, "agent-test-log")
+	defer os.RemoveAll(dataDir)
+	agent, err := New(Config{
+		ServerTLSConfig: tlsConfig(config.ServerCertFile, config.ServerKeyFile, true),
+		PeerTLSConfig:   peerTLSConfig,
+		DataDir:         dataDir,
+		BindAddr:        fmt.Sprintf("localhost:%d", internal.FreePort(t)),
+		RPCPort:         internal.FreePort(t),
+		NodeName:        "0",
+		ACLModelFile:    config.ACLModelFile,
+		ACLPolicyFile:   config.ACLPolicyFile,
+		Bootstrap:       true,
+		// the raft state alone exceeds the watermark
+		DiskWatermarks:    server.DiskWatermarks{High: 1},
+		DiskCheckInterval: 10 * time.Millisecond,
+	})
+	require.NoError(t, err)
+	defer agent.Shutdown()
+	cl := client(t, agent, peerTLSConfig)
+
+	// act
+	_, err = cl.Create(context.Background(), &api.CreateRecordRequest{Record: &api.Record{Value: []byte("foo")}})
+
+	// assert
+	diskFull, ok := api.FromError(err).(api.ErrDiskFull)
+	require.True(t, ok, "got %v", err)
+	require.Equal(t, uint64(1), diskFull.HighWatermark)
+	require.Positive(t, agent.DiskUsage())
+}
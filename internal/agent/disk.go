@@ -0,0 +1,81 @@
+package agent
+
+import (
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// defaultDiskCheckInterval is how often the data dir is measured by default.
+const defaultDiskCheckInterval = 10 * time.Second
+
+// setupDiskUsage measures the data dir periodically for the disk watermarks.
+func (a *Agent) setupDiskUsage() error {
+	wm := a.Config.DiskWatermarks
+	if wm.Low == 0 && wm.High == 0 {
+		return nil
+	}
+	size, err := dirSize(a.Config.DataDir)
+	if err != nil {
+		return err
+	}
+	a.diskUsage.Store(size)
+
+	interval := a.Config.DiskCheckInterval
+	if interval == 0 {
+		interval = defaultDiskCheckInterval
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-a.shutdowns:
+				return
+			case <-ticker.C:
+			}
+			size, err := dirSize(a.Config.DataDir)
+			if err != nil {
+				zap.L().Named("agent").Error("failed to measure the data dir", zap.Error(err))
+				continue
+			}
+			a.diskUsage.Store(size)
+		}
+	}()
+	return nil
+}
+
+// DiskUsage returns the bytes the data dir took up when it was last measured.
+func (a *Agent) DiskUsage() uint64 {
+	return a.diskUsage.Load()
+}
+
+// dirSize sums up the sizes of the dir's files, those removed while it's
+// walked, e.g. segments removed by retention, are skipped.
+func dirSize(dir string) (uint64, error) {
+	var size uint64
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		size += uint64(info.Size())
+		return nil
+	})
+	return size, err
+}
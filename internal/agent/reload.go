@@ -0,0 +1,169 @@
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/justagabriel/proglog/internal/auth"
+	"github.com/justagabriel/proglog/internal/log"
+	"github.com/justagabriel/proglog/internal/server"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ErrInvalidConfig rejects a reloaded config, none of its settings were applied.
+type ErrInvalidConfig struct {
+	// Changes lists the settings the config would have changed.
+	Changes []string
+	Err     error
+}
+
+func (e ErrInvalidConfig) Error() string {
+	return fmt.Sprintf("invalid config: %v, it would change %s", e.Err, strings.Join(e.Changes, "; "))
+}
+
+func (e ErrInvalidConfig) Unwrap() error {
+	return e.Err
+}
+
+func (e ErrInvalidConfig) GRPCStatus() *status.Status {
+	return status.New(codes.InvalidArgument, e.Error())
+}
+
+// Reload applies the settings of the config which don't require a restart:
+// the retention, the rate limits, the log level, the request log sampling and
+// the ACL files, which are re-read even if their paths didn't change. Other fields are ignored. All
+// settings are validated before any of them is applied, an invalid config is
+// rejected with ErrInvalidConfig. It returns the changed settings, with
+// dryRun they're validated only.
+func (a *Agent) Reload(config Config, dryRun bool) ([]string, error) {
+	a.reloadLock.Lock()
+	defer a.reloadLock.Unlock()
+	return a.reload(config, dryRun)
+}
+
+// ReloadConfig reloads the config returned by Config.LoadConfig, see Reload.
+func (a *Agent) ReloadConfig(dryRun bool) ([]string, error) {
+	a.reloadLock.Lock()
+	defer a.reloadLock.Unlock()
+	if a.Config.LoadConfig == nil {
+		return nil, errors.New("the agent has no config loader")
+	}
+	config, err := a.Config.LoadConfig()
+	if err != nil {
+		return nil, err
+	}
+	return a.reload(config, dryRun)
+}
+
+func (a *Agent) reload(config Config, dryRun bool) ([]string, error) {
+	old := a.Config
+	changes := reloadChanges(old, config)
+	invalid := func(err error) ([]string, error) {
+		return nil, ErrInvalidConfig{Changes: changes, Err: err}
+	}
+
+	level, err := parseLogLevel(config.LogLevel)
+	if err != nil {
+		return invalid(err)
+	}
+	if err = validateRateLimits("RateLimits", config.RateLimits); err != nil {
+		return invalid(err)
+	}
+	if err = validateRateLimits("ClientRateLimits", config.ClientRateLimits); err != nil {
+		return invalid(err)
+	}
+	// the ACL is loaded last, nothing has been applied if it fails
+	if dryRun {
+		if _, err = auth.New(config.ACLModelFile, config.ACLPolicyFile); err != nil {
+			return invalid(err)
+		}
+		return changes, nil
+	}
+	if err = a.authorizer.Load(config.ACLModelFile, config.ACLPolicyFile); err != nil {
+		return invalid(err)
+	}
+
+	a.Config.ACLModelFile = config.ACLModelFile
+	a.Config.ACLPolicyFile = config.ACLPolicyFile
+	if config.ACLModelFile != old.ACLModelFile || config.ACLPolicyFile != old.ACLPolicyFile {
+		if err = a.stopACLWatch(); err != nil {
+			zap.L().Named("auth").Error("failed to stop watching the previous ACL files", zap.Error(err))
+		}
+		if err = a.watchACL(); err != nil {
+			a.stopACLWatch = func() error { return nil }
+			zap.L().Named("auth").Error("failed to watch the ACL files", zap.Error(err))
+		}
+	}
+	if config.RetentionMaxAge != old.RetentionMaxAge || config.RetentionMaxBytes != old.RetentionMaxBytes || config.Compact != old.Compact || config.TombstoneRetention != old.TombstoneRetention {
+		a.log.SetRetention(log.RetentionPolicy{
+			MaxAge:             config.RetentionMaxAge,
+			MaxBytes:           config.RetentionMaxBytes,
+			Compact:            config.Compact,
+			TombstoneRetention: config.TombstoneRetention,
+		})
+		a.Config.RetentionMaxAge = config.RetentionMaxAge
+		a.Config.RetentionMaxBytes = config.RetentionMaxBytes
+		a.Config.Compact = config.Compact
+		a.Config.TombstoneRetention = config.TombstoneRetention
+	}
+	if config.RateLimits != old.RateLimits {
+		a.rateLimiter.SetLimits(config.RateLimits)
+		a.Config.RateLimits = config.RateLimits
+	}
+	if config.ClientRateLimits != old.ClientRateLimits {
+		a.clientRateLimiter.SetLimits(config.ClientRateLimits)
+		a.Config.ClientRateLimits = config.ClientRateLimits
+	}
+	a.logLevel.SetLevel(level)
+	a.Config.LogLevel = config.LogLevel
+	a.requestLogger.SetConfig(config.RequestLog)
+	a.Config.RequestLog = config.RequestLog
+	return changes, nil
+}
+
+// reloadChanges lists the reloadable settings which differ, e.g. "LogLevel: debug -> info".
+func reloadChanges(old, new Config) []string {
+	var changes []string
+	diff := func(name string, from, to interface{}) {
+		if from != to {
+			changes = append(changes, fmt.Sprintf("%s: %+v -> %+v", name, from, to))
+		}
+	}
+	diff("LogLevel", old.LogLevel, new.LogLevel)
+	diff("RequestLog", old.RequestLog, new.RequestLog)
+	diff("RetentionMaxAge", old.RetentionMaxAge, new.RetentionMaxAge)
+	diff("RetentionMaxBytes", old.RetentionMaxBytes, new.RetentionMaxBytes)
+	diff("Compact", old.Compact, new.Compact)
+	diff("TombstoneRetention", old.TombstoneRetention, new.TombstoneRetention)
+	diff("RateLimits", old.RateLimits, new.RateLimits)
+	diff("ClientRateLimits", old.ClientRateLimits, new.ClientRateLimits)
+	diff("ACLModelFile", old.ACLModelFile, new.ACLModelFile)
+	diff("ACLPolicyFile", old.ACLPolicyFile, new.ACLPolicyFile)
+	return changes
+}
+
+// parseLogLevel defaults to debug.
+func parseLogLevel(level string) (zapcore.Level, error) {
+	if level == "" {
+		return zapcore.DebugLevel, nil
+	}
+	return zapcore.ParseLevel(level)
+}
+
+func validateRateLimits(name string, limits server.RateLimits) error {
+	for _, rate := range []float64{
+		limits.Produce.RecordsPerSecond,
+		limits.Produce.BytesPerSecond,
+		limits.Consume.RecordsPerSecond,
+		limits.Consume.BytesPerSecond,
+	} {
+		if rate < 0 {
+			return fmt.Errorf("%s mustn't be negative", name)
+		}
+	}
+	return nil
+}
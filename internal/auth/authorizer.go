@@ -2,14 +2,23 @@ package auth
 
 import (
 	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
 
 	"github.com/casbin/casbin/v2"
+	"github.com/fsnotify/fsnotify"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
 
+// reloadDelay coalesces the events of a file being written into a single reload.
+const reloadDelay = 100 * time.Millisecond
+
 type Authorizer struct {
-	enforcer *casbin.Enforcer
+	mu            sync.RWMutex
+	model, policy string
+	enforcer      *casbin.Enforcer
 }
 
 func New(model, policy string) (*Authorizer, error) {
@@ -19,21 +28,117 @@ func New(model, policy string) (*Authorizer, error) {
 	}
 
 	return &Authorizer{
+		model:    model,
+		policy:   policy,
 		enforcer: enforcer,
 	}, nil
 }
 
-func (a *Authorizer) Authorize(subject, action string) error {
-	isAllowed, err := a.enforcer.Enforce(subject, action)
+// Authorize checks whether the subject may perform the action on the object,
+// e.g. "create" on "topic/orders".
+func (a *Authorizer) Authorize(subject, object, action string) error {
+	a.mu.RLock()
+	enforcer := a.enforcer
+	a.mu.RUnlock()
+
+	isAllowed, err := enforcer.Enforce(subject, object, action)
 	if err != nil {
 		return err
 	}
 
 	if !isAllowed {
-		msg := fmt.Sprintf("%q is not permitted to %q", subject, action)
+		msg := fmt.Sprintf("%q is not permitted to %q %q", subject, action, object)
 		st := status.New(codes.PermissionDenied, msg)
 		return st.Err()
 	}
 
 	return nil
 }
+
+// Reload re-reads the model and policy files. If they can't be loaded the
+// previous ones stay in effect.
+func (a *Authorizer) Reload() error {
+	a.mu.RLock()
+	model, policy := a.model, a.policy
+	a.mu.RUnlock()
+	return a.Load(model, policy)
+}
+
+// Load switches to other model and policy files. If they can't be loaded
+// the previous ones stay in effect. Watchers keep watching the previous files.
+func (a *Authorizer) Load(model, policy string) error {
+	enforcer, err := casbin.NewEnforcer(model, policy)
+	if err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	a.model, a.policy = model, policy
+	a.enforcer = enforcer
+	a.mu.Unlock()
+	return nil
+}
+
+// Watch reloads the model and policy whenever their files change, until the
+// returned function is called. Failed reloads are passed to onError.
+func (a *Authorizer) Watch(onError func(error)) (stop func() error, err error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	// directories are watched, editors and config management replace files by renaming
+	a.mu.RLock()
+	model, policy := a.model, a.policy
+	a.mu.RUnlock()
+	files := map[string]bool{}
+	for _, file := range []string{model, policy} {
+		file = filepath.Clean(file)
+		files[file] = true
+		if err = watcher.Add(filepath.Dir(file)); err != nil {
+			watcher.Close()
+			return nil, err
+		}
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		var reload *time.Timer
+		errs := watcher.Errors
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					if reload != nil {
+						reload.Stop()
+					}
+					return
+				}
+				if !files[filepath.Clean(event.Name)] || event.Op == fsnotify.Chmod {
+					continue
+				}
+				if reload != nil {
+					reload.Stop()
+				}
+				reload = time.AfterFunc(reloadDelay, func() {
+					if err := a.Reload(); err != nil {
+						onError(err)
+					}
+				})
+			case err, ok := <-errs:
+				if !ok {
+					errs = nil
+					continue
+				}
+				onError(err)
+			}
+		}
+	}()
+
+	return func() error {
+		err := watcher.Close()
+		wg.Wait()
+		return err
+	}, nil
+}
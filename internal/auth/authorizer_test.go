@@ -1,7 +1,10 @@
 package auth
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/justagabriel/proglog/internal/config"
 	"github.com/stretchr/testify/require"
@@ -9,6 +12,7 @@ import (
 
 const (
 	validSubject string = "root"
+	validObject  string = "topic/default"
 )
 
 func TestACLAuthorization(t *testing.T) {
@@ -34,7 +38,7 @@ func testValidGetCreds(t *testing.T, authorizer *Authorizer) {
 	getAction := "get"
 
 	// act
-	authError := authorizer.Authorize(validSubject, getAction)
+	authError := authorizer.Authorize(validSubject, validObject, getAction)
 
 	// assert
 	require.NoError(t, authError, "credentials are valid - should work")
@@ -45,7 +49,7 @@ func testValidCreateCreds(t *testing.T, authorizer *Authorizer) {
 	getAction := "create"
 
 	// act
-	authError := authorizer.Authorize(validSubject, getAction)
+	authError := authorizer.Authorize(validSubject, validObject, getAction)
 
 	// assert
 	require.NoError(t, authError, "credentials are valid - should work")
@@ -57,7 +61,7 @@ func testInvalidSubject(t *testing.T, authorizer *Authorizer) {
 	validAction := "create"
 
 	// act
-	authError := authorizer.Authorize(invalidSubject, validAction)
+	authError := authorizer.Authorize(invalidSubject, validObject, validAction)
 
 	// assert
 	require.Error(t, authError, "subject is not defined - should fail")
@@ -68,8 +72,137 @@ func testInvalidAction(t *testing.T, authorizer *Authorizer) {
 	invalidAction := "destroy"
 
 	// act
-	authError := authorizer.Authorize(validSubject, invalidAction)
+	authError := authorizer.Authorize(validSubject, validObject, invalidAction)
 
 	// assert
 	require.Error(t, authError, "action is not defined - should fail")
 }
+
+func TestTopicAuthorization(t *testing.T) {
+	// arrange
+	model, policy := copyACL(t)
+	require.NoError(t, os.WriteFile(policy, []byte(
+		"p, alice, topic/orders, create\n"+
+			"p, alice, topic/payments, get\n"+
+			"p, bob, topic/*, get\n"), 0644))
+	authorizer, err := New(model, policy)
+	require.NoError(t, err)
+
+	scenarios := map[string]struct {
+		subject, object, action string
+		allowed                 bool
+	}{
+		"produces to a permitted topic":         {"alice", "topic/orders", "create", true},
+		"consumes a permitted topic":            {"alice", "topic/payments", "get", true},
+		"doesn't consume a produce only topic":  {"alice", "topic/orders", "get", false},
+		"doesn't produce to a consume only one": {"alice", "topic/payments", "create", false},
+		"doesn't access other topics":           {"alice", "topic/audit", "get", false},
+		"wildcard matches all topics":           {"bob", "topic/audit", "get", true},
+		"wildcard doesn't match bookmarks":      {"bob", "bookmark/audit", "get", false},
+	}
+
+	for scenario, sc := range scenarios {
+		t.Run(scenario, func(t *testing.T) {
+			// act
+			err := authorizer.Authorize(sc.subject, sc.object, sc.action)
+
+			// assert
+			require.Equal(t, sc.allowed, err == nil)
+		})
+	}
+}
+
+// copyACL copies the ACL files into a temporary directory, so tests can change them.
+func copyACL(t *testing.T) (model, policy string) {
+	t.Helper()
+	dir := t.TempDir()
+	model, policy = filepath.Join(dir, "model.conf"), filepath.Join(dir, "policy.csv")
+	for src, dst := range map[string]string{config.ACLModelFile: model, config.ACLPolicyFile: policy} {
+		b, err := os.ReadFile(src)
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(dst, b, 0644))
+	}
+	return model, policy
+}
+
+func TestAuthorizerReload(t *testing.T) {
+	scenarios := map[string]struct {
+		policy  string
+		err     bool
+		allowed bool
+	}{
+		"changed policy takes effect": {
+			policy: "p, root, *, create\n",
+		},
+		"invalid policy keeps the previous one": {
+			policy:  "p, root\n",
+			err:     true,
+			allowed: true,
+		},
+	}
+
+	for scenario, sc := range scenarios {
+		t.Run(scenario, func(t *testing.T) {
+			// arrange
+			model, policy := copyACL(t)
+			authorizer, err := New(model, policy)
+			require.NoError(t, err)
+			require.NoError(t, authorizer.Authorize(validSubject, validObject, "get"))
+			require.NoError(t, os.WriteFile(policy, []byte(sc.policy), 0644))
+
+			// act
+			err = authorizer.Reload()
+
+			// assert
+			require.Equal(t, sc.err, err != nil)
+			require.Equal(t, sc.allowed, authorizer.Authorize(validSubject, validObject, "get") == nil)
+		})
+	}
+}
+
+func TestAuthorizerLoad(t *testing.T) {
+	// arrange
+	model, policy := copyACL(t)
+	authorizer, err := New(model, policy)
+	require.NoError(t, err)
+	otherPolicy := filepath.Join(t.TempDir(), "policy.csv")
+	require.NoError(t, os.WriteFile(otherPolicy, []byte("p, root, *, create\n"), 0644))
+
+	// act
+	invalidErr := authorizer.Load(model, filepath.Join(t.TempDir(), "missing.csv"))
+	err = authorizer.Load(model, otherPolicy)
+	require.NoError(t, os.WriteFile(otherPolicy, []byte("p, root, *, get\n"), 0644))
+	reloadErr := authorizer.Reload()
+
+	// assert
+	require.Error(t, invalidErr)
+	require.NoError(t, err)
+	require.NoError(t, reloadErr)
+	require.NoError(t, authorizer.Authorize(validSubject, validObject, "get"), "reloads read the loaded files")
+	require.Error(t, authorizer.Authorize(validSubject, validObject, "create"))
+}
+
+func TestAuthorizerWatch(t *testing.T) {
+	// arrange
+	model, policy := copyACL(t)
+	authorizer, err := New(model, policy)
+	require.NoError(t, err)
+	stop, err := authorizer.Watch(func(err error) {
+		t.Errorf("unexpected reload error: %v", err)
+	})
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, stop())
+	}()
+
+	// act
+	replacement := policy + ".tmp"
+	require.NoError(t, os.WriteFile(replacement, []byte("p, root, *, create\n"), 0644))
+	require.NoError(t, os.Rename(replacement, policy))
+
+	// assert
+	require.Eventually(t, func() bool {
+		return authorizer.Authorize(validSubject, validObject, "get") != nil
+	}, 2*time.Second, 10*time.Millisecond)
+	require.NoError(t, authorizer.Authorize(validSubject, validObject, "create"))
+}
@@ -0,0 +1,148 @@
+// Command benchcmp compares two runs of `go test -bench`, e.g. of the base
+// branch and of a change, and fails if a benchmark got slower than allowed.
+// The results of benchmarks run several times with -count are averaged.
+//
+//	benchcmp -threshold 10 old.txt new.txt
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+func main() {
+	threshold := flag.Float64("threshold", 10, "percentage by which ns/op may increase before the comparison fails")
+	flag.Parse()
+	if flag.NArg() != 2 {
+		log.Fatal("usage: benchcmp [-threshold percent] old.txt new.txt")
+	}
+
+	old, err := parseFile(flag.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	cur, err := parseFile(flag.Arg(1))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var names []string
+	for name := range cur {
+		if _, ok := old[name]; ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "benchmark\tunit\told\tnew\tdelta\t")
+	var regressions int
+	for _, name := range names {
+		for _, unit := range units(old[name], cur[name]) {
+			before, after := old[name].mean(unit), cur[name].mean(unit)
+			delta := change(before, after)
+			mark := ""
+			if unit == "ns/op" && delta > *threshold {
+				mark = "regression"
+				regressions++
+			}
+			fmt.Fprintf(w, "%s\t%s\t%.4g\t%.4g\t%+.2f%%\t%s\n", name, unit, before, after, delta, mark)
+		}
+	}
+	w.Flush()
+
+	if regressions > 0 {
+		log.Fatalf("%d benchmarks got slower by more than %g%%", regressions, *threshold)
+	}
+}
+
+// result holds the values a benchmark reported per unit, one per run.
+type result map[string][]float64
+
+func (r result) mean(unit string) float64 {
+	var sum float64
+	for _, v := range r[unit] {
+		sum += v
+	}
+	return sum / float64(len(r[unit]))
+}
+
+// change returns the percentage by which after differs from before.
+func change(before, after float64) float64 {
+	if before == 0 {
+		if after == 0 {
+			return 0
+		}
+		return math.Inf(1)
+	}
+	return 100 * (after - before) / before
+}
+
+// units returns the units both results reported, ns/op first.
+func units(old, cur result) []string {
+	var units []string
+	for unit := range cur {
+		if _, ok := old[unit]; ok && unit != "ns/op" {
+			units = append(units, unit)
+		}
+	}
+	sort.Strings(units)
+	if _, ok := old["ns/op"]; ok {
+		if _, ok := cur["ns/op"]; ok {
+			units = append([]string{"ns/op"}, units...)
+		}
+	}
+	return units
+}
+
+// parseFile reads the results of `go test -bench` output, the benchmarks are
+// named by their package and name, as names may repeat across packages.
+func parseFile(name string) (map[string]result, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	results := make(map[string]result)
+	var pkg string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if p, ok := strings.CutPrefix(line, "pkg: "); ok {
+			pkg = p
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 4 || !strings.HasPrefix(fields[0], "Benchmark") || len(fields)%2 != 0 {
+			continue
+		}
+		if _, err := strconv.Atoi(fields[1]); err != nil {
+			continue
+		}
+		key := fields[0]
+		if pkg != "" {
+			key = pkg + "." + key
+		}
+		if results[key] == nil {
+			results[key] = make(result)
+		}
+		// the iterations are followed by pairs of values and units
+		for i := 2; i < len(fields); i += 2 {
+			v, err := strconv.ParseFloat(fields[i], 64)
+			if err != nil {
+				return nil, fmt.Errorf("%s: invalid value %q of %s", name, fields[i], fields[0])
+			}
+			results[key][fields[i+1]] = append(results[key][fields[i+1]], v)
+		}
+	}
+	return results, scanner.Err()
+}
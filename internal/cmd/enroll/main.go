@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/justagabriel/proglog/internal/config"
+)
+
+func main() {
+	var cfg config.EnrollConfig
+	flag.StringVar(&cfg.ServerURL, "server-url", "", "EST base url, e.g. https://ca.internal/.well-known/est")
+	flag.StringVar(&cfg.ServerCAFile, "server-ca-file", "", "CA used to verify the EST server, system roots if empty")
+	flag.StringVar(&cfg.Username, "username", "", "username for the initial enrollment")
+	flag.StringVar(&cfg.Password, "password", os.Getenv("EST_PASSWORD"), "password for the initial enrollment")
+	flag.StringVar(&cfg.CommonName, "common-name", "", "common name of the certificate")
+	flag.StringVar(&cfg.CertFile, "cert-file", "", "path the certificate is written to")
+	flag.StringVar(&cfg.KeyFile, "key-file", "", "path the private key is written to, the cert file's path writes both to one file which is replaced at once")
+	flag.StringVar(&cfg.CAFile, "ca-file", "", "path the CA certificates are written to")
+	flag.DurationVar(&cfg.RenewBefore, "renew-before", 0, "renew certificates this long before expiry, a third of the lifetime if zero")
+	agent := flag.Bool("agent", false, "keep running and renew the certificate before it expires")
+	flag.Parse()
+	cfg.OnError = func(err error) {
+		log.Printf("enrollment failed, retrying: %v", err)
+	}
+
+	enroller, err := config.NewEnroller(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	if *agent {
+		err = enroller.Run(ctx)
+	} else {
+		err = enroller.Enroll(ctx)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
@@ -4,17 +4,41 @@ import (
 	"context"
 	"flag"
 	"log"
+	"net"
 
 	api "github.com/justagabriel/proglog/api/v1"
+	"github.com/justagabriel/proglog/internal/config"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
 )
 
 func main() {
 	addr := flag.String("addr", "localhost:8400", "service address")
+	caFile := flag.String("ca-file", "", "CA used to verify the server, connects without TLS if empty")
+	certFile := flag.String("cert-file", "", "client certificate")
+	keyFile := flag.String("key-file", "", "client certificate key")
 	flag.Parse()
 
-	conn, err := grpc.Dial(*addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	creds := insecure.NewCredentials()
+	if *caFile != "" {
+		host, _, err := net.SplitHostPort(*addr)
+		if err != nil {
+			log.Fatal(err)
+		}
+		tlsConfig, err := config.SetupTLSConfig(config.TLSConfig{
+			CertFile:      *certFile,
+			KeyFile:       *keyFile,
+			CAFile:        *caFile,
+			ServerAddress: host,
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+		creds = credentials.NewTLS(tlsConfig)
+	}
+
+	conn, err := grpc.Dial(*addr, grpc.WithTransportCredentials(creds))
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -1,17 +1,24 @@
 package main
 
 import (
-	"errors"
+	"fmt"
 	"log"
 	"os"
 	"os/signal"
 	"path"
+	"strconv"
+	"strings"
 	"syscall"
+	"time"
 
 	"github.com/justagabriel/proglog/internal/agent"
 	"github.com/justagabriel/proglog/internal/config"
+	plog "github.com/justagabriel/proglog/internal/log"
+	"github.com/justagabriel/proglog/internal/schema"
+	"github.com/justagabriel/proglog/internal/server"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+	"go.opencensus.io/trace"
 )
 
 func main() {
@@ -37,6 +44,7 @@ type cfg struct {
 	agent.Config
 	ServerTLSConfig config.TLSConfig
 	PeerTLSConfig   config.TLSConfig
+	RaftTLSConfig   config.TLSConfig
 }
 
 func setupFlags(cmd *cobra.Command) error {
@@ -46,18 +54,110 @@ func setupFlags(cmd *cobra.Command) error {
 	}
 
 	cmd.Flags().String("node-name", hostname, "Unique server ID.")
+	cmd.Flags().String("zone", "", "Availability zone or rack the server runs in.")
+	cmd.Flags().Duration("snapshot-interval", 0, "How often raft checks whether to take a snapshot (0 uses raft's default of 2m).")
+	cmd.Flags().Uint64("snapshot-threshold", 0, "Entries appended since the last snapshot before taking one (0 uses raft's default of 8192).")
+	cmd.Flags().Uint64("snapshot-trailing-logs", 0, "Entries kept after a snapshot for followers to catch up from (0 uses raft's default of 10240).")
+	cmd.Flags().Int("snapshot-retain", 1, "Snapshots kept on disk.")
+	cmd.Flags().Bool("read-replica", false, "Join as non-voter serving reads only.")
+	cmd.Flags().Int("max-voters", 0, "Servers taking part in raft elections and commits, spread across zones. Zero makes every server a voter.")
 
 	dataDir := path.Join(os.TempDir(), "proglog")
 	cmd.Flags().String("data-dir", dataDir, "Directory to store log and Raft data.")
 
 	cmd.Flags().String("config-file", "", "Path to config file.")
-	cmd.Flags().String("bind-addr", "127.0.01:8401", "Address to bind Serf on.")
+	cmd.Flags().String("bind-addr", "127.0.0.1:8401", "Address to bind Serf on.")
 	cmd.Flags().Int("rpc-port", 8400, "Port for RPC clients (and Raft) connections.")
+	cmd.Flags().Int("http-port", 0, "Port for HTTP/JSON clients (0 disables the gateway).")
+	cmd.Flags().StringSlice("websocket-origins", nil, "Origins of the web pages allowed to use the gateway's WebSockets, \"*\" for all (defaults to the gateway's own).")
+	cmd.Flags().Bool("grpc-web", false, "Serve the RPCs to gRPC-web clients on the HTTP port as well.")
+	cmd.Flags().StringSlice("grpc-web-origins", nil, "Origins of the web pages allowed to call gRPC-web, \"*\" for all (defaults to the gateway's own).")
+	cmd.Flags().Int("metrics-port", 0, "Port serving Prometheus metrics at /metrics over plain HTTP (0 disables it).")
+	cmd.Flags().Int("admin-port", 0, "Localhost port serving pprof, expvar, the config, segment stats and goroutine dumps under /debug/ (0 disables it).")
 	cmd.Flags().StringSlice("start-join-addrs", nil, "Serf addresses to join.")
+	cmd.Flags().String("start-join-dns", "", "Host and Serf port whose host resolves to the members to join, e.g. a headless Kubernetes service. It's resolved again every 30s to find members whose IPs changed.")
+	cmd.Flags().Bool("serf-on-rpc-port", false, "Gossip on the RPC port instead of the bind address' port, start-join-addrs lists RPC addresses then.")
+	cmd.Flags().StringSlice("serf-encrypt-keys", nil, "Base64 encoded AES keys of 16, 24 or 32 bytes encrypting the gossip, the first one encrypts (empty doesn't encrypt).")
+	cmd.Flags().String("mirror-addr", "", "RPC address of an independent cluster to mirror topics from with the peer certificate, only one node of a cluster may mirror.")
+	cmd.Flags().StringSlice("mirror-topics", nil, "Topics mirrored from --mirror-addr.")
 	cmd.Flags().Bool("bootstrap", false, "Bootstrap the cluster.")
+	cmd.Flags().Int("bootstrap-expect", 0, "Bootstrap the cluster once this many servers joined each other, all servers have to expect the cluster's initial size (0 leaves bootstrapping to --bootstrap).")
+	cmd.Flags().String("log-level", "debug", "Level of the logs: debug, info, warn or error.")
+	cmd.Flags().Uint64("log-requests-every", 0, "Log every Nth successful unary RPC per method, failed ones are always logged (0 logs all).")
+	cmd.Flags().Uint64("log-stream-messages-every", 0, "Log every Nth message sent by a stream besides its end (0 logs the ends only).")
+	cmd.Flags().Duration("shutdown-grace-period", 10*time.Second, "How long running requests may take to finish on shutdown before they're cancelled.")
+
+	cmd.Flags().Float64("produce-records-per-second", 0, "Max records per second produced to a topic (0 disables the limit).")
+	cmd.Flags().Float64("produce-bytes-per-second", 0, "Max bytes per second produced to a topic (0 disables the limit).")
+	cmd.Flags().Float64("consume-records-per-second", 0, "Max records per second consumed from a topic (0 disables the limit).")
+	cmd.Flags().Float64("consume-bytes-per-second", 0, "Max bytes per second consumed from a topic (0 disables the limit).")
+	cmd.Flags().Float64("client-produce-records-per-second", 0, "Max records per second produced by a client (0 disables the limit).")
+	cmd.Flags().Float64("client-produce-bytes-per-second", 0, "Max bytes per second produced by a client (0 disables the limit).")
+	cmd.Flags().Float64("client-consume-records-per-second", 0, "Max records per second consumed by a client (0 disables the limit).")
+	cmd.Flags().Float64("client-consume-bytes-per-second", 0, "Max bytes per second consumed by a client (0 disables the limit).")
+	cmd.Flags().Int("max-streams", 0, "Max streaming RPCs in progress (0 disables the limit).")
+	cmd.Flags().Int("max-streams-per-client", 0, "Max streaming RPCs in progress of a client (0 disables the limit).")
+	cmd.Flags().Duration("stream-idle-timeout", 0, "End streams which neither sent nor received a message for longer (0 disables the timeout).")
+	cmd.Flags().Int("create-stream-window", 64, "Max records a CreateStream receives ahead of appending them.")
+	cmd.Flags().Uint64("max-consumer-lag", 0, "End consume streams staying more records behind their topic for the slow consumer timeout (0 disables the limit).")
+	cmd.Flags().Duration("slow-consumer-timeout", 0, "End consume streams whose sends block for longer, and how long they may exceed the max consumer lag (0 disables the timeout).")
+	cmd.Flags().Int("max-produce", 0, "Max appends in progress (0 disables the limit).")
+	cmd.Flags().Int("max-consume", 0, "Max reads in progress (0 disables the limit).")
+	cmd.Flags().Int("max-in-flight", 0, "Max appends and reads in progress together (0 disables the limit).")
+	cmd.Flags().String("priority", "none", "Operations admitted first once the limits are reached: none, produce or consume.")
+	cmd.Flags().Int("max-recv-msg-bytes", 0, "Max size of RPC requests received (0 keeps gRPC's default of 4 MiB).")
+	cmd.Flags().Int("max-send-msg-bytes", 0, "Max size of RPC responses sent (0 keeps gRPC's default).")
+	cmd.Flags().Duration("keepalive-min-time", 0, "Min interval of client pings, clients pinging more often are disconnected (0 keeps gRPC's default of 5m).")
+	cmd.Flags().Bool("keepalive-permit-without-stream", false, "Let clients ping without RPCs in progress.")
+	cmd.Flags().Duration("keepalive-time", 0, "Ping clients after connections were idle for that long (0 keeps gRPC's default of 2h).")
+	cmd.Flags().Duration("keepalive-timeout", 0, "Close connections whose pings weren't acked within that time (0 keeps gRPC's default of 20s).")
+	cmd.Flags().Bool("grpc-reflection", false, "Register the gRPC reflection service, so tools like grpcurl discover the services.")
+	cmd.Flags().Duration("max-connection-idle", 0, "Close connections without RPCs for that long (0 disables it).")
+	cmd.Flags().Duration("max-connection-age", 0, "Close connections once they're that old (0 disables it).")
+	cmd.Flags().Duration("max-connection-age-grace", 0, "Time given to the RPCs of connections closed for their age (0 waits for them).")
+	cmd.Flags().Int("max-connections-per-client", 0, "Max RPC connections of a client host (0 disables the limit).")
+	cmd.Flags().Uint64("disk-low-watermark", 0, "Throttle appends once the data dir takes up more bytes (0 disables throttling).")
+	cmd.Flags().Uint64("disk-high-watermark", 0, "Reject appends once the data dir takes up that many bytes (0 disables rejecting).")
+	cmd.Flags().Duration("disk-max-throttle", time.Second, "Delay of appends at the high watermark, shorter the closer the usage is to the low one.")
+	cmd.Flags().Duration("disk-check-interval", 10*time.Second, "How often the data dir is measured for the disk watermarks.")
+
+	cmd.Flags().Duration("retention-max-age", 0, "Remove segments of a topic not written to for longer (0 disables the limit).")
+	cmd.Flags().Uint64("retention-max-bytes", 0, "Remove the oldest segments of a topic exceeding this size (0 disables the limit).")
+	cmd.Flags().Bool("compact", false, "Keep only the latest record per key in old segments.")
+	cmd.Flags().Duration("tombstone-retention", 24*time.Hour, "How long compaction keeps the tombstones of deleted keys (0 keeps them).")
+	cmd.Flags().Duration("topic-delete-grace-period", 24*time.Hour, "How long deleted topics can be undeleted before they're removed (0 removes them right away).")
+	cmd.Flags().Duration("idempotency-key-ttl", 24*time.Hour, "How long HTTP produces are deduplicated by their Idempotency-Key header.")
+	cmd.Flags().Bool("preallocate-segments", false, "Create the next segment's files in the background, so rolling a segment doesn't add latency to appends.")
+	cmd.Flags().Bool("recycle-segments", false, "Reuse the files of removed segments for the next segment.")
+	cmd.Flags().Duration("segment-max-age", 0, "Roll a topic's active segment once its first record is older, so retention and tiering free quiet topics (0 rolls by size only).")
+
+	cmd.Flags().Uint64("sync-every-writes", 0, "Sync the log to disk after this many appends (0 disables it).")
+	cmd.Flags().Duration("sync-interval", 0, "Sync the log to disk at most this long after an append (0 disables it).")
+
+	cmd.Flags().Uint64("max-record-bytes", 1<<20, "Reject records whose encoded size exceeds this (0 disables the limit).")
+	cmd.Flags().String("compression", plog.CompressionNone.String(), "Compression of records on disk, \"none\" or \"flate\".")
+	cmd.Flags().Uint64("index-interval", 1, "Index every Nth record only, reads scan forward from the closest indexed record.")
+	cmd.Flags().String("index-access", plog.IndexAccessAuto.String(), "How index files are accessed: \"mmap\", \"portable\" reads and writes for Windows and network filesystems, or \"auto\" to map them except on Windows.")
+	cmd.Flags().Uint64("cache-bytes", 0, "Keep the most recently appended and read records of each topic in memory up to this size (0 disables the cache).")
+	cmd.Flags().Uint64("read-ahead-bytes", 64<<10, "Read this much of a segment at once when reading records (0 disables read-ahead).")
+	cmd.Flags().String("tiered-storage-dir", "", "Directory, e.g. a mounted bucket, old segments are moved to (empty disables tiered storage).")
+	cmd.Flags().Duration("offload-after", time.Hour, "Move segments not written to for longer to the tiered storage.")
+	cmd.Flags().StringSlice("schema", nil, "Schema records of a topic must match, as topic=schema.json or topic=descriptors.binpb#package.Message.")
+	cmd.Flags().String("encryption-key-file", "", "Path to a hex encoded AES key records on disk are encrypted with.")
+
+	cmd.Flags().String("otlp-endpoint", "", "OTLP/HTTP endpoint receiving traces, e.g. http://localhost:4318/v1/traces (empty disables exporting).")
+	cmd.Flags().Float64("trace-sample-rate", 1, "Fraction of RPCs traced, RPCs of sampled client traces are always traced.")
 
 	cmd.Flags().String("acl-model-file", "", "Path to ACL model.")
 	cmd.Flags().String("acl-policy-file", "", "Path to ACL policy.")
+	cmd.Flags().String("tls-subject", "cn", "Client certificate field used as ACL subject: cn, spiffe (URI SAN) or dns (first DNS SAN).")
+	cmd.Flags().String("auth-tokens-file", "", "Path to a file of \"<subject> <token>\" lines accepted as bearer tokens after client certificates.")
+	cmd.Flags().String("jwt-issuer", "", "Issuer of JWT bearer tokens accepted after client certificates, its keys are discovered through OpenID Connect.")
+	cmd.Flags().String("jwt-jwks-url", "", "URL of the keys JWT bearer tokens are signed with, overrides discovering them.")
+	cmd.Flags().String("jwt-audience", "", "Audience JWT bearer tokens have to be issued for.")
+	cmd.Flags().String("jwt-subject-claim", "sub", "Claim of JWT bearer tokens used as ACL subject.")
+	cmd.Flags().StringSlice("tenant-from", nil, "Where the tenant of requests is taken from, in order: cert-ou, header (empty disables multi-tenancy).")
+	cmd.Flags().StringSlice("tenant-quotas", nil, "Storage quotas of tenants as tenant=bytes.")
 
 	cmd.Flags().String("server-tls-cert-file", "", "Path to server tls cert.")
 	cmd.Flags().String("server-tls-key-file", "", "Path to server tls key.")
@@ -67,6 +167,10 @@ func setupFlags(cmd *cobra.Command) error {
 	cmd.Flags().String("peer-tls-key-file", "", "Path to peer tls key.")
 	cmd.Flags().String("peer-tls-ca-file", "", "Path to peer certificate authority.")
 
+	cmd.Flags().String("raft-tls-cert-file", "", "Path to the tls cert serving raft, the server's if empty.")
+	cmd.Flags().String("raft-tls-key-file", "", "Path to the tls key serving raft.")
+	cmd.Flags().String("raft-tls-ca-file", "", "Path to the certificate authority verifying peers.")
+
 	return viper.BindPFlags(cmd.Flags())
 }
 
@@ -76,23 +180,186 @@ func (c *cli) setupConfig(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	viper.SetConfigFile(configFile)
-	if err = viper.ReadInConfig(); err != nil {
-		// it's ok if the file doesn't exist
-		if !errors.As(err, &viper.ConfigFileNotFoundError{}) {
+	// flags and their defaults suffice without config file, a given one has to exist
+	if configFile != "" {
+		viper.SetConfigFile(configFile)
+		if err = viper.ReadInConfig(); err != nil {
 			return err
 		}
 	}
 
 	c.cfg.DataDir = viper.GetString("data-dir")
 	c.cfg.NodeName = viper.GetString("node-name")
+	c.cfg.Zone = viper.GetString("zone")
+	c.cfg.MaxVoters = viper.GetInt("max-voters")
+	c.cfg.ReadReplica = viper.GetBool("read-replica")
+	c.cfg.SnapshotInterval = viper.GetDuration("snapshot-interval")
+	c.cfg.SnapshotThreshold = viper.GetUint64("snapshot-threshold")
+	c.cfg.SnapshotTrailingLogs = viper.GetUint64("snapshot-trailing-logs")
+	c.cfg.SnapshotRetain = viper.GetInt("snapshot-retain")
 	c.cfg.RPCPort = viper.GetInt("rpc-port")
 	c.cfg.BindAddr = viper.GetString("bind-addr")
+	c.cfg.HTTPPort = viper.GetInt("http-port")
+	c.cfg.WebSocketOrigins = viper.GetStringSlice("websocket-origins")
+	c.cfg.GRPCWeb = viper.GetBool("grpc-web")
+	c.cfg.GRPCWebOrigins = viper.GetStringSlice("grpc-web-origins")
+	c.cfg.MetricsPort = viper.GetInt("metrics-port")
+	c.cfg.AdminPort = viper.GetInt("admin-port")
 	c.cfg.StartJoinAddr = viper.GetStringSlice("start-join-addrs")
+	c.cfg.StartJoinDNS = viper.GetString("start-join-dns")
+	c.cfg.SerfOnRPCPort = viper.GetBool("serf-on-rpc-port")
+	c.cfg.SerfEncryptKeys, err = config.ParseGossipKeys(viper.GetStringSlice("serf-encrypt-keys"))
+	if err != nil {
+		return err
+	}
+	c.cfg.MirrorAddr = viper.GetString("mirror-addr")
+	c.cfg.MirrorTopics = viper.GetStringSlice("mirror-topics")
 	c.cfg.Bootstrap = viper.GetBool("bootstrap")
+	c.cfg.BootstrapExpect = viper.GetInt("bootstrap-expect")
+	if c.cfg.Bootstrap && c.cfg.BootstrapExpect > 0 {
+		return fmt.Errorf("bootstrap and bootstrap-expect are exclusive")
+	}
+	c.cfg.ShutdownGracePeriod = viper.GetDuration("shutdown-grace-period")
+	setupReloadable(&c.cfg.Config)
+	c.cfg.LoadConfig = func() (agent.Config, error) {
+		if configFile != "" {
+			if err := viper.ReadInConfig(); err != nil {
+				return agent.Config{}, err
+			}
+		}
+		config := c.cfg.Config
+		setupReloadable(&config)
+		return config, nil
+	}
+
+	c.cfg.StreamLimits.MaxStreams = viper.GetInt("max-streams")
+	c.cfg.StreamLimits.MaxStreamsPerClient = viper.GetInt("max-streams-per-client")
+	c.cfg.StreamLimits.IdleTimeout = viper.GetDuration("stream-idle-timeout")
+	c.cfg.StreamLimits.CreateWindow = viper.GetInt("create-stream-window")
+	c.cfg.StreamLimits.MaxConsumerLag = viper.GetUint64("max-consumer-lag")
+	c.cfg.StreamLimits.SlowConsumerTimeout = viper.GetDuration("slow-consumer-timeout")
+	c.cfg.Scheduling.MaxProduce = viper.GetInt("max-produce")
+	c.cfg.Scheduling.MaxConsume = viper.GetInt("max-consume")
+	c.cfg.Scheduling.MaxInFlight = viper.GetInt("max-in-flight")
+	c.cfg.Transport = server.Transport{
+		MaxRecvMsgBytes:              viper.GetInt("max-recv-msg-bytes"),
+		MaxSendMsgBytes:              viper.GetInt("max-send-msg-bytes"),
+		KeepaliveMinTime:             viper.GetDuration("keepalive-min-time"),
+		KeepalivePermitWithoutStream: viper.GetBool("keepalive-permit-without-stream"),
+		KeepaliveTime:                viper.GetDuration("keepalive-time"),
+		KeepaliveTimeout:             viper.GetDuration("keepalive-timeout"),
+		MaxConnectionIdle:            viper.GetDuration("max-connection-idle"),
+		MaxConnectionAge:             viper.GetDuration("max-connection-age"),
+		MaxConnectionAgeGrace:        viper.GetDuration("max-connection-age-grace"),
+	}
+	c.cfg.Reflection = viper.GetBool("grpc-reflection")
+	c.cfg.Scheduling.Priority, err = server.ParsePriority(viper.GetString("priority"))
+	if err != nil {
+		return err
+	}
+	c.cfg.MaxConnectionsPerClient = viper.GetInt("max-connections-per-client")
+	c.cfg.DiskWatermarks = server.DiskWatermarks{
+		Low:         viper.GetUint64("disk-low-watermark"),
+		High:        viper.GetUint64("disk-high-watermark"),
+		MaxThrottle: viper.GetDuration("disk-max-throttle"),
+	}
+	c.cfg.DiskCheckInterval = viper.GetDuration("disk-check-interval")
+
+	c.cfg.SyncPolicy.EveryWrites = viper.GetUint64("sync-every-writes")
+	c.cfg.SyncPolicy.Interval = viper.GetDuration("sync-interval")
+	c.cfg.MaxRecordBytes = viper.GetUint64("max-record-bytes")
+	c.cfg.IndexInterval = viper.GetUint64("index-interval")
+	c.cfg.SegmentMaxAge = viper.GetDuration("segment-max-age")
+	c.cfg.PreallocateSegments = viper.GetBool("preallocate-segments")
+	c.cfg.RecycleSegments = viper.GetBool("recycle-segments")
+	c.cfg.CacheBytes = viper.GetUint64("cache-bytes")
+	c.cfg.ReadAheadBytes = viper.GetUint64("read-ahead-bytes")
+	c.cfg.Compression, err = plog.ParseCompression(viper.GetString("compression"))
+	if err != nil {
+		return err
+	}
+	c.cfg.IndexAccess, err = plog.ParseIndexAccess(viper.GetString("index-access"))
+	if err != nil {
+		return err
+	}
+	if dir := viper.GetString("tiered-storage-dir"); dir != "" {
+		c.cfg.TieredStorage = plog.DirObjectStore(dir)
+	}
+	c.cfg.OffloadAfter = viper.GetDuration("offload-after")
+	if keyFile := viper.GetString("encryption-key-file"); keyFile != "" {
+		c.cfg.EncryptionKeys, err = plog.LoadStaticKey(keyFile)
+		if err != nil {
+			return err
+		}
+	}
+
+	if specs := viper.GetStringSlice("schema"); len(specs) > 0 {
+		registry := schema.NewRegistry()
+		for _, spec := range specs {
+			if err = registry.Load(spec); err != nil {
+				return err
+			}
+		}
+		c.cfg.Schemas = registry
+	}
+
+	c.cfg.OTLPEndpoint = viper.GetString("otlp-endpoint")
+	c.cfg.TraceSampler = trace.ProbabilitySampler(viper.GetFloat64("trace-sample-rate"))
+
+	var tlsAuthenticator server.TLSAuthenticator
+	switch tlsSubject := viper.GetString("tls-subject"); tlsSubject {
+	case "cn":
+	case "spiffe":
+		tlsAuthenticator.Subject = server.SPIFFESubject
+	case "dns":
+		tlsAuthenticator.Subject = server.DNSSubject
+	default:
+		return fmt.Errorf("invalid tls-subject %q, want cn, spiffe or dns", tlsSubject)
+	}
 
-	c.cfg.ACLModelFile = viper.GetString("acl-model-file")
-	c.cfg.ACLPolicyFile = viper.GetString("acl-policy-file")
+	authenticators := []server.Authenticator{tlsAuthenticator}
+	if issuer, jwksURL := viper.GetString("jwt-issuer"), viper.GetString("jwt-jwks-url"); issuer != "" || jwksURL != "" {
+		jwt, err := server.NewJWTAuthenticator(server.JWTConfig{
+			Issuer:       issuer,
+			JWKSURL:      jwksURL,
+			Audience:     viper.GetString("jwt-audience"),
+			SubjectClaim: viper.GetString("jwt-subject-claim"),
+		})
+		if err != nil {
+			return err
+		}
+		authenticators = append(authenticators, jwt)
+	}
+	if tokensFile := viper.GetString("auth-tokens-file"); tokensFile != "" {
+		tokens, err := server.LoadTokenAuthenticator(tokensFile)
+		if err != nil {
+			return err
+		}
+		authenticators = append(authenticators, tokens)
+	}
+	c.cfg.Authenticators = authenticators
+
+	for _, from := range viper.GetStringSlice("tenant-from") {
+		switch from {
+		case "cert-ou":
+			c.cfg.TenantResolvers = append(c.cfg.TenantResolvers, server.CertOUTenant{})
+		case "header":
+			c.cfg.TenantResolvers = append(c.cfg.TenantResolvers, server.HeaderTenant{})
+		default:
+			return fmt.Errorf("invalid tenant-from %q, want cert-ou or header", from)
+		}
+	}
+	for _, quota := range viper.GetStringSlice("tenant-quotas") {
+		tenant, bytes, ok := strings.Cut(quota, "=")
+		n, err := strconv.ParseUint(bytes, 10, 64)
+		if !ok || err != nil {
+			return fmt.Errorf("invalid tenant quota %q, want tenant=bytes", quota)
+		}
+		if c.cfg.TenantQuotas == nil {
+			c.cfg.TenantQuotas = make(map[string]uint64)
+		}
+		c.cfg.TenantQuotas[tenant] = n
+	}
 
 	c.cfg.ServerTLSConfig.CertFile = viper.GetString("server-tls-cert-file")
 	c.cfg.ServerTLSConfig.KeyFile = viper.GetString("server-tls-key-file")
@@ -117,9 +384,44 @@ func (c *cli) setupConfig(cmd *cobra.Command, args []string) error {
 		}
 	}
 
+	c.cfg.RaftTLSConfig.CertFile = viper.GetString("raft-tls-cert-file")
+	c.cfg.RaftTLSConfig.KeyFile = viper.GetString("raft-tls-key-file")
+	c.cfg.RaftTLSConfig.CAFile = viper.GetString("raft-tls-ca-file")
+
+	if c.cfg.RaftTLSConfig.CertFile != "" && c.cfg.RaftTLSConfig.KeyFile != "" {
+		c.cfg.RaftTLSConfig.Server = true
+		c.cfg.Config.RaftTLSConfig, err = config.SetupTLSConfig(c.cfg.RaftTLSConfig)
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
+// setupReloadable reads the settings agent.Agent.Reload applies.
+func setupReloadable(cfg *agent.Config) {
+	cfg.LogLevel = viper.GetString("log-level")
+	cfg.RequestLog.SampleEvery = viper.GetUint64("log-requests-every")
+	cfg.RequestLog.StreamMessagesEvery = viper.GetUint64("log-stream-messages-every")
+	cfg.RateLimits.Produce.RecordsPerSecond = viper.GetFloat64("produce-records-per-second")
+	cfg.RateLimits.Produce.BytesPerSecond = viper.GetFloat64("produce-bytes-per-second")
+	cfg.RateLimits.Consume.RecordsPerSecond = viper.GetFloat64("consume-records-per-second")
+	cfg.RateLimits.Consume.BytesPerSecond = viper.GetFloat64("consume-bytes-per-second")
+	cfg.ClientRateLimits.Produce.RecordsPerSecond = viper.GetFloat64("client-produce-records-per-second")
+	cfg.ClientRateLimits.Produce.BytesPerSecond = viper.GetFloat64("client-produce-bytes-per-second")
+	cfg.ClientRateLimits.Consume.RecordsPerSecond = viper.GetFloat64("client-consume-records-per-second")
+	cfg.ClientRateLimits.Consume.BytesPerSecond = viper.GetFloat64("client-consume-bytes-per-second")
+	cfg.RetentionMaxAge = viper.GetDuration("retention-max-age")
+	cfg.RetentionMaxBytes = viper.GetUint64("retention-max-bytes")
+	cfg.Compact = viper.GetBool("compact")
+	cfg.TombstoneRetention = viper.GetDuration("tombstone-retention")
+	cfg.TopicDeleteGracePeriod = viper.GetDuration("topic-delete-grace-period")
+	cfg.IdempotencyKeyTTL = viper.GetDuration("idempotency-key-ttl")
+	cfg.ACLModelFile = viper.GetString("acl-model-file")
+	cfg.ACLPolicyFile = viper.GetString("acl-policy-file")
+}
+
 func (c *cli) run(cmd *cobra.Command, args []string) error {
 	var err error
 	agent, err := agent.New(c.cfg.Config)
@@ -127,7 +429,17 @@ func (c *cli) run(cmd *cobra.Command, args []string) error {
 		return err
 	}
 	sigc := make(chan os.Signal, 1)
-	signal.Notify(sigc, syscall.SIGINT, syscall.SIGTERM)
-	<-sigc
+	signal.Notify(sigc, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	for sig := range sigc {
+		if sig != syscall.SIGHUP {
+			break
+		}
+		changes, err := agent.ReloadConfig(false)
+		if err != nil {
+			log.Printf("failed to reload config: %v", err)
+			continue
+		}
+		log.Printf("reloaded config, changes: %s", strings.Join(changes, "; "))
+	}
 	return agent.Shutdown()
 }
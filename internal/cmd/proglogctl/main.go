@@ -0,0 +1,906 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	api "github.com/justagabriel/proglog/api/v1"
+	"github.com/justagabriel/proglog/client"
+	"github.com/justagabriel/proglog/connector"
+	"github.com/justagabriel/proglog/internal/auth"
+	"github.com/justagabriel/proglog/internal/config"
+	plog "github.com/justagabriel/proglog/internal/log"
+	"github.com/spf13/cobra"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func main() {
+	ctl := &ctl{}
+	cmd := &cobra.Command{
+		Use:           "proglogctl",
+		Short:         "Talk to a proglog cluster.",
+		SilenceUsage:  true,
+		SilenceErrors: true,
+	}
+	cmd.PersistentFlags().StringVar(&ctl.addr, "addr", "localhost:8400", "Service address.")
+	cmd.PersistentFlags().StringVar(&ctl.caFile, "ca-file", "", "CA used to verify the server, connects without TLS if empty.")
+	cmd.PersistentFlags().StringVar(&ctl.certFile, "cert-file", "", "Client certificate.")
+	cmd.PersistentFlags().StringVar(&ctl.keyFile, "key-file", "", "Client certificate key.")
+	cmd.PersistentFlags().StringVar(&ctl.topic, "topic", "", "Topic, the default topic if empty.")
+	cmd.AddCommand(ctl.produceCmd(), ctl.consumeCmd(), ctl.getKeyCmd(), ctl.deleteKeyCmd(), ctl.serversCmd(), ctl.statsCmd(), ctl.verifyCmd(), ctl.truncateCmd(), ctl.resetOffsetsCmd(), ctl.joinCmd(), ctl.leaveCmd(), ctl.reloadCmd(), ctl.readOnlyCmd(), ctl.maintainCmd(), ctl.topicCmd(), ctl.mirrorCmd(), ctl.sinkCmd(), ctl.sourceCmd(), ctl.kafkaCmd(), aclCmd())
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	if err := cmd.ExecuteContext(ctx); err != nil {
+		log.Fatal(err)
+	}
+}
+
+type ctl struct {
+	addr     string
+	caFile   string
+	certFile string
+	keyFile  string
+	topic    string
+}
+
+func (c *ctl) client() (*client.Client, error) {
+	return dial(c.addr, c.caFile, c.certFile, c.keyFile)
+}
+
+func dial(addr, caFile, certFile, keyFile string) (*client.Client, error) {
+	creds := insecure.NewCredentials()
+	if caFile != "" {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig, err := config.SetupTLSConfig(config.TLSConfig{
+			CertFile:      certFile,
+			KeyFile:       keyFile,
+			CAFile:        caFile,
+			ServerAddress: host,
+		})
+		if err != nil {
+			return nil, err
+		}
+		creds = credentials.NewTLS(tlsConfig)
+	}
+	return client.New(client.Config{
+		Addr:        addr,
+		DialOptions: []grpc.DialOption{grpc.WithTransportCredentials(creds)},
+	})
+}
+
+func (c *ctl) produceCmd() *cobra.Command {
+	var headerFlags []string
+	var acksFlag string
+	cmd := &cobra.Command{
+		Use:   "produce [value...]",
+		Short: "Append the values, or the lines of stdin without any, and print their offsets.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			acks, ok := api.Acks_value["ACKS_"+strings.ToUpper(acksFlag)]
+			if !ok {
+				return fmt.Errorf("invalid acks %q, want quorum, leader or none", acksFlag)
+			}
+			var headers []*api.Header
+			for _, h := range headerFlags {
+				key, value, ok := strings.Cut(h, "=")
+				if !ok {
+					return fmt.Errorf("invalid header %q, want key=value", h)
+				}
+				headers = append(headers, &api.Header{Key: key, Value: []byte(value)})
+			}
+			cl, err := c.client()
+			if err != nil {
+				return err
+			}
+			defer cl.Close()
+
+			produce := func(value string) error {
+				res, err := cl.Create(cmd.Context(), &api.CreateRecordRequest{
+					Topic:  c.topic,
+					Record: &api.Record{Value: []byte(value), Headers: headers},
+					Acks:   api.Acks(acks),
+				})
+				if err != nil {
+					return err
+				}
+				// records acknowledged early have no offset yet
+				if api.Acks(acks) == api.Acks_ACKS_QUORUM {
+					fmt.Fprintln(cmd.OutOrStdout(), res.Offset)
+				}
+				return nil
+			}
+			if len(args) > 0 {
+				for _, value := range args {
+					if err = produce(value); err != nil {
+						return err
+					}
+				}
+				return nil
+			}
+			scanner := bufio.NewScanner(cmd.InOrStdin())
+			for scanner.Scan() {
+				if err = produce(scanner.Text()); err != nil {
+					return err
+				}
+			}
+			return scanner.Err()
+		},
+	}
+	cmd.Flags().StringArrayVar(&headerFlags, "header", nil, "Header of the records as key=value, may be repeated.")
+	cmd.Flags().StringVar(&acksFlag, "acks", "quorum", "Acknowledge the records once committed by the quorum, stored by the leader or right away: quorum, leader or none.")
+	return cmd
+}
+
+func (c *ctl) consumeCmd() *cobra.Command {
+	var from, count uint64
+	cmd := &cobra.Command{
+		Use:   "consume",
+		Short: "Print the offset and value of the topic's records, waiting for new ones until interrupted.",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cl, err := c.client()
+			if err != nil {
+				return err
+			}
+			defer cl.Close()
+
+			consumer := cl.Consume(cmd.Context(), c.topic, from)
+			for n := uint64(0); (count == 0 || n < count) && consumer.Next(); n++ {
+				record := consumer.Record()
+				fmt.Fprintf(cmd.OutOrStdout(), "%d\t%s\n", record.Offset, record.Value)
+			}
+			if cmd.Context().Err() != nil {
+				return nil
+			}
+			return consumer.Err()
+		},
+	}
+	cmd.Flags().Uint64Var(&from, "from", 0, "Offset to start at.")
+	cmd.Flags().Uint64Var(&count, "count", 0, "Stop after this many records (0 waits until interrupted).")
+	return cmd
+}
+
+func (c *ctl) getKeyCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "get-key <key>",
+		Short: "Print the offset and value of the topic's latest record with the key, the topic has to index its keys.",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cl, err := c.client()
+			if err != nil {
+				return err
+			}
+			defer cl.Close()
+
+			res, err := cl.GetByKey(cmd.Context(), &api.GetByKeyRequest{Topic: c.topic, Key: []byte(args[0])})
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "%d\t%s\n", res.Record.Offset, res.Record.Value)
+			return nil
+		},
+	}
+}
+
+func (c *ctl) deleteKeyCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "delete-key <key>",
+		Short: "Append a tombstone for the key and print its offset, compaction removes the key's records.",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cl, err := c.client()
+			if err != nil {
+				return err
+			}
+			defer cl.Close()
+
+			res, err := cl.Delete(cmd.Context(), &api.DeleteRecordRequest{Topic: c.topic, Key: []byte(args[0])})
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "%d\n", res.Offset)
+			return nil
+		},
+	}
+}
+
+func (c *ctl) serversCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "servers",
+		Short: "List the servers of the cluster.",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cl, err := c.client()
+			if err != nil {
+				return err
+			}
+			defer cl.Close()
+
+			res, err := cl.GetServers(cmd.Context(), &api.GetServersRequest{})
+			if err != nil {
+				return err
+			}
+			for _, server := range res.Servers {
+				leader := ""
+				if server.IsLeader {
+					leader = "\tleader"
+				} else if !server.Voter {
+					leader = "\tnonvoter"
+				}
+				fmt.Fprintf(cmd.OutOrStdout(), "%s\t%s%s\n", server.Id, server.RpcAddr, leader)
+			}
+			return nil
+		},
+	}
+}
+
+func (c *ctl) statsCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "stats",
+		Short: "Show the offsets, segments and disk usage of the topic.",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cl, err := c.client()
+			if err != nil {
+				return err
+			}
+			defer cl.Close()
+
+			res, err := cl.GetLogStats(cmd.Context(), &api.GetLogStatsRequest{Topic: c.topic})
+			if err != nil {
+				return err
+			}
+			stats, out := res.Stats, cmd.OutOrStdout()
+			fmt.Fprintf(out, "offsets\t%d-%d\n", stats.LowestOffset, stats.HighestOffset)
+			fmt.Fprintf(out, "segments\t%d\n", stats.SegmentCount)
+			fmt.Fprintf(out, "bytes\t%d\tremote %d\n", stats.TotalBytes, stats.RemoteBytes)
+			for _, s := range stats.Segments {
+				state := ""
+				if s.Active {
+					state = "\tactive"
+				} else if s.Remote {
+					state = "\tremote"
+				}
+				fmt.Fprintf(out, "%d-%d\t%d bytes\tage %s\tindex %.0f%%%s\n",
+					s.BaseOffset, s.NextOffset, s.StoreBytes+s.IndexBytes,
+					s.Age.AsDuration().Round(time.Second), 100*s.IndexUtilization, state)
+			}
+			return nil
+		},
+	}
+}
+
+func (c *ctl) verifyCmd() *cobra.Command {
+	req := &api.VerifyRequest{}
+	cmd := &cobra.Command{
+		Use:   "verify",
+		Short: "Check the topic's segments of the server against their checksums and indexes.",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cl, err := c.client()
+			if err != nil {
+				return err
+			}
+			defer cl.Close()
+
+			req.Topic = c.topic
+			res, err := cl.Verify(cmd.Context(), req)
+			if err != nil {
+				return err
+			}
+			report, out := res.Report, cmd.OutOrStdout()
+			for _, i := range report.Inconsistencies {
+				file := "store"
+				if i.Index {
+					file = "index"
+				}
+				fmt.Fprintf(out, "segment %d\t%s position %d\t%s\n", i.Segment, file, i.Position, i.Problem)
+			}
+			fmt.Fprintf(out, "%d segments, %d records, %d inconsistencies\n", report.Segments, report.Records, len(report.Inconsistencies))
+			if report.Repaired {
+				fmt.Fprintf(out, "repaired, dropped %d bytes\n", report.DroppedBytes)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&req.Repair, "repair", false, "Rewrite inconsistent segments with their intact records, losing those following a corrupt one.")
+	return cmd
+}
+
+func (c *ctl) truncateCmd() *cobra.Command {
+	var lowest uint64
+	cmd := &cobra.Command{
+		Use:   "truncate",
+		Short: "Remove the topic's segments holding only records up to the lowest offset.",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cl, err := c.client()
+			if err != nil {
+				return err
+			}
+			defer cl.Close()
+
+			_, err = cl.Truncate(cmd.Context(), &api.TruncateRequest{Topic: c.topic, Lowest: lowest})
+			return err
+		},
+	}
+	cmd.Flags().Uint64Var(&lowest, "lowest", 0, "Lowest offset to remove.")
+	return cmd
+}
+
+func (c *ctl) resetOffsetsCmd() *cobra.Command {
+	var earliest, latest, dryRun bool
+	var at string
+	var offset uint64
+	cmd := &cobra.Command{
+		Use:   "reset-offsets <group>",
+		Short: "Reset the group's committed offset of the topic to replay or skip records.",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			req := &api.ResetOffsetsRequest{Group: args[0], Topic: c.topic, DryRun: dryRun}
+			switch {
+			case earliest:
+				req.To = &api.ResetOffsetsRequest_Earliest{Earliest: true}
+			case latest:
+				req.To = &api.ResetOffsetsRequest_Latest{Latest: true}
+			case at != "":
+				t, err := time.Parse(time.RFC3339, at)
+				if err != nil {
+					return err
+				}
+				req.To = &api.ResetOffsetsRequest_Time{Time: timestamppb.New(t)}
+			case cmd.Flags().Changed("to-offset"):
+				req.To = &api.ResetOffsetsRequest_Offset{Offset: offset}
+			default:
+				return fmt.Errorf("one of --to-earliest, --to-latest, --to-time or --to-offset is required")
+			}
+
+			cl, err := c.client()
+			if err != nil {
+				return err
+			}
+			defer cl.Close()
+
+			res, err := cl.ResetOffsets(cmd.Context(), req)
+			if err != nil {
+				return err
+			}
+			previous := "none"
+			if res.PreviousOffset != nil {
+				previous = fmt.Sprint(*res.PreviousOffset)
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "%s\t%s -> %d\tlag %d\n", args[0], previous, res.Offset, res.Lag)
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&earliest, "to-earliest", false, "Reset to the topic's lowest offset, replaying all records.")
+	cmd.Flags().BoolVar(&latest, "to-latest", false, "Reset to the next offset to be written, skipping all records.")
+	cmd.Flags().StringVar(&at, "to-time", "", "Reset to the first record appended at or after the RFC 3339 time.")
+	cmd.Flags().Uint64Var(&offset, "to-offset", 0, "Reset to the offset.")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Print the offset and the resulting lag without committing it.")
+	cmd.MarkFlagsMutuallyExclusive("to-earliest", "to-latest", "to-time", "to-offset")
+	return cmd
+}
+
+func (c *ctl) joinCmd() *cobra.Command {
+	req := &api.JoinRequest{}
+	cmd := &cobra.Command{
+		Use:   "join <id> <raft-addr>",
+		Short: "Add the server to the raft cluster.",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cl, err := c.client()
+			if err != nil {
+				return err
+			}
+			defer cl.Close()
+
+			req.Id, req.Addr = args[0], args[1]
+			_, err = cl.Join(cmd.Context(), req)
+			return err
+		},
+	}
+	cmd.Flags().StringVar(&req.Zone, "zone", "", "Zone the server runs in.")
+	cmd.Flags().BoolVar(&req.Nonvoter, "nonvoter", false, "Add the server as read replica.")
+	return cmd
+}
+
+func (c *ctl) leaveCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "leave <id>",
+		Short: "Remove the server from the raft cluster.",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cl, err := c.client()
+			if err != nil {
+				return err
+			}
+			defer cl.Close()
+
+			_, err = cl.Leave(cmd.Context(), &api.LeaveRequest{Id: args[0]})
+			return err
+		},
+	}
+}
+
+func (c *ctl) reloadCmd() *cobra.Command {
+	var dryRun bool
+	cmd := &cobra.Command{
+		Use:   "reload",
+		Short: "Make the server re-read its config and print the changed settings.",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cl, err := c.client()
+			if err != nil {
+				return err
+			}
+			defer cl.Close()
+
+			res, err := cl.ReloadConfig(cmd.Context(), &api.ReloadConfigRequest{DryRun: dryRun})
+			if err != nil {
+				return err
+			}
+			for _, change := range res.Changes {
+				fmt.Fprintln(cmd.OutOrStdout(), change)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Validate the config without applying it.")
+	return cmd
+}
+
+func (c *ctl) readOnlyCmd() *cobra.Command {
+	var reason string
+	var cluster bool
+	cmd := &cobra.Command{
+		Use:   "read-only [on|off]",
+		Short: "Reject or accept appends again, or show whether the server and its cluster are read-only.",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cl, err := c.client()
+			if err != nil {
+				return err
+			}
+			defer cl.Close()
+
+			if len(args) == 0 {
+				res, err := cl.GetReadOnly(cmd.Context(), &api.GetReadOnlyRequest{})
+				if err != nil {
+					return err
+				}
+				fmt.Fprintf(cmd.OutOrStdout(), "server\t%t\t%s\n", res.Node.GetEnabled(), res.Node.GetReason())
+				if res.Cluster != nil {
+					fmt.Fprintf(cmd.OutOrStdout(), "cluster\t%t\t%s\n", res.Cluster.Enabled, res.Cluster.Reason)
+				}
+				return nil
+			}
+			var enabled bool
+			switch args[0] {
+			case "on":
+				enabled = true
+			case "off":
+			default:
+				return fmt.Errorf("expected on or off, got %q", args[0])
+			}
+			_, err = cl.SetReadOnly(cmd.Context(), &api.SetReadOnlyRequest{
+				Mode:    &api.ReadOnlyMode{Enabled: enabled, Reason: reason},
+				Cluster: cluster,
+			})
+			return err
+		},
+	}
+	cmd.Flags().StringVar(&reason, "reason", "", "Reason reported to the producers rejected.")
+	cmd.Flags().BoolVar(&cluster, "cluster", false, "Set the mode of all servers rather than the one addressed.")
+	return cmd
+}
+
+func (c *ctl) maintainCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "maintain [retention|compaction]",
+		Short: "Run retention or compaction on the topic's log of the server right away, or show the progress of the runs.",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cl, err := c.client()
+			if err != nil {
+				return err
+			}
+			defer cl.Close()
+
+			var runs []*api.MaintenanceProgress
+			if len(args) == 0 {
+				res, err := cl.GetMaintenanceStatus(cmd.Context(), &api.GetMaintenanceStatusRequest{Topic: c.topic})
+				if err != nil {
+					return err
+				}
+				runs = res.Runs
+			} else {
+				task, ok := api.MaintenanceTask_value["MAINTENANCE_TASK_"+strings.ToUpper(args[0])]
+				if !ok {
+					return fmt.Errorf("expected retention or compaction, got %q", args[0])
+				}
+				res, err := cl.RunMaintenance(cmd.Context(), &api.RunMaintenanceRequest{
+					Topic: c.topic,
+					Task:  api.MaintenanceTask(task),
+				})
+				if err != nil {
+					return err
+				}
+				runs = []*api.MaintenanceProgress{res.Progress}
+			}
+			for _, run := range runs {
+				task := strings.ToLower(strings.TrimPrefix(run.Task.String(), "MAINTENANCE_TASK_"))
+				state := "running, eta " + run.Eta.AsDuration().Round(time.Second).String()
+				switch {
+				case run.Error != "":
+					state = "failed: " + run.Error
+				case run.Finished != nil:
+					state = "finished " + run.Finished.AsTime().Format(time.RFC3339)
+				case run.Eta == nil:
+					state = "running"
+				}
+				fmt.Fprintf(cmd.OutOrStdout(), "%s\t%d/%d segments\t%d bytes reclaimed\t%s\n",
+					task, run.SegmentsProcessed, run.Segments, run.BytesReclaimed, state)
+			}
+			return nil
+		},
+	}
+}
+
+func (c *ctl) mirrorCmd() *cobra.Command {
+	var to, toCAFile, toCertFile, toKeyFile string
+	mirrorConfig := client.MirrorConfig{}
+	cmd := &cobra.Command{
+		Use:   "mirror <topic>...",
+		Short: "Copy the topics' records into the cluster at --to until interrupted, resuming at the positions of --state-file.",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			source, err := c.client()
+			if err != nil {
+				return err
+			}
+			defer source.Close()
+			destination, err := dial(to, toCAFile, toCertFile, toKeyFile)
+			if err != nil {
+				return err
+			}
+			defer destination.Close()
+
+			mirrorConfig.Topics = args
+			mirror, err := client.NewMirror(source, destination, mirrorConfig)
+			if err != nil {
+				return err
+			}
+			err = mirror.Run(cmd.Context())
+			if cmd.Context().Err() != nil {
+				return nil
+			}
+			return err
+		},
+	}
+	cmd.Flags().StringVar(&to, "to", "", "Address of the destination cluster.")
+	cmd.Flags().StringVar(&toCAFile, "to-ca-file", "", "CA used to verify the destination, connects without TLS if empty.")
+	cmd.Flags().StringVar(&toCertFile, "to-cert-file", "", "Client certificate for the destination.")
+	cmd.Flags().StringVar(&toKeyFile, "to-key-file", "", "Client certificate key for the destination.")
+	cmd.Flags().StringVar(&mirrorConfig.StateFile, "state-file", "", "File keeping the mirror's positions, it starts at the beginning of the topics if empty.")
+	cmd.Flags().IntVar(&mirrorConfig.MaxRecords, "max-records", 100, "Records appended to the destination at once.")
+	_ = cmd.MarkFlagRequired("to")
+	return cmd
+}
+
+func (c *ctl) sinkCmd() *cobra.Command {
+	connectorConfig := connector.Config{}
+	cmd := &cobra.Command{
+		Use:   "sink",
+		Short: "Write the topic's records to files or S3 until interrupted, resuming at the group's committed offset.",
+	}
+	cmd.PersistentFlags().StringVar(&connectorConfig.Group, "group", "", "Consumer group committing the records written.")
+	cmd.PersistentFlags().IntVar(&connectorConfig.MaxRecords, "max-records", 1000, "Records written at once.")
+	_ = cmd.MarkPersistentFlagRequired("group")
+	run := func(cmd *cobra.Command, sink connector.Sink) error {
+		cl, err := c.client()
+		if err != nil {
+			return err
+		}
+		defer cl.Close()
+
+		connectorConfig.Topic = c.topic
+		err = connector.NewRunner(cl, sink, connectorConfig).Run(cmd.Context())
+		if cmd.Context().Err() != nil {
+			return nil
+		}
+		return err
+	}
+
+	s3 := &connector.S3Sink{
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	s3Cmd := &cobra.Command{
+		Use:   "s3 <bucket>",
+		Short: "Write batches of records to objects of the bucket, signed with the credentials of the AWS_* environment variables.",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s3.Bucket = args[0]
+			if s3.Endpoint == "" {
+				s3.Endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", s3.Region)
+			}
+			return run(cmd, s3)
+		},
+	}
+	s3Cmd.Flags().StringVar(&s3.Endpoint, "endpoint", "", "URL of the S3 API, defaults to AWS' of the region.")
+	s3Cmd.Flags().StringVar(&s3.Region, "region", "us-east-1", "Region of the bucket.")
+	s3Cmd.Flags().StringVar(&s3.Prefix, "prefix", "", "Prefix of the objects' names, e.g. archive/orders/.")
+
+	cmd.AddCommand(
+		&cobra.Command{
+			Use:   "file <dir>",
+			Short: "Write batches of records to files of the directory, a record as JSON per line.",
+			Args:  cobra.ExactArgs(1),
+			RunE: func(cmd *cobra.Command, args []string) error {
+				return run(cmd, connector.FileSink(args[0]))
+			},
+		},
+		s3Cmd,
+	)
+	return cmd
+}
+
+func (c *ctl) sourceCmd() *cobra.Command {
+	sourceConfig := connector.SourceConfig{}
+	cmd := &cobra.Command{
+		Use:   "source <file>...",
+		Short: "Append the lines of the files to the topic, tailing them until interrupted and resuming at the group's committed positions.",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cl, err := c.client()
+			if err != nil {
+				return err
+			}
+			defer cl.Close()
+
+			sourceConfig.Topic, sourceConfig.Files = c.topic, args
+			err = connector.NewSource(cl, sourceConfig).Run(cmd.Context())
+			if cmd.Context().Err() != nil {
+				return nil
+			}
+			return err
+		},
+	}
+	cmd.Flags().StringVar(&sourceConfig.Group, "group", "", "Consumer group prefix committing the position in each file.")
+	cmd.Flags().DurationVar(&sourceConfig.PollInterval, "poll-interval", time.Second, "How often the files are checked for new lines.")
+	cmd.Flags().IntVar(&sourceConfig.MaxRecords, "max-records", 100, "Lines appended at once.")
+	_ = cmd.MarkFlagRequired("group")
+	return cmd
+}
+
+func (c *ctl) kafkaCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "kafka",
+		Short: "Move the topic's records to and from Kafka log segment files, e.g. to migrate to or from a Kafka cluster.",
+	}
+	cmd.AddCommand(
+		&cobra.Command{
+			Use:   "export <dir>",
+			Short: "Write the topic's records into the directory as Kafka log segment files, a file per segment, so it can be used as a partition directory of a broker.",
+			Args:  cobra.ExactArgs(1),
+			RunE: func(cmd *cobra.Command, args []string) error {
+				cl, err := c.client()
+				if err != nil {
+					return err
+				}
+				defer cl.Close()
+				return exportKafka(cmd.Context(), cl, c.topic, args[0])
+			},
+		},
+		&cobra.Command{
+			Use:   "import <dir>",
+			Short: "Append the records of the directory's Kafka log segment files to the topic and print how many were appended.",
+			Args:  cobra.ExactArgs(1),
+			RunE: func(cmd *cobra.Command, args []string) error {
+				cl, err := c.client()
+				if err != nil {
+					return err
+				}
+				defer cl.Close()
+
+				n, err := plog.ImportKafka(args[0], plog.AppenderFunc(func(record *api.Record) (uint64, error) {
+					res, err := cl.Create(cmd.Context(), &api.CreateRecordRequest{Topic: c.topic, Record: record})
+					if err != nil {
+						return 0, err
+					}
+					return res.Offset, nil
+				}))
+				fmt.Fprintln(cmd.OutOrStdout(), n)
+				return err
+			},
+		},
+	)
+	return cmd
+}
+
+// exportKafka exports the records the topic holds when it's called, they're
+// read like consumers do, see log.Log.ExportKafka.
+func exportKafka(ctx context.Context, cl *client.Client, topic, dir string) error {
+	res, err := cl.GetLogStats(ctx, &api.GetLogStatsRequest{Topic: topic})
+	if err != nil {
+		return err
+	}
+	e, err := plog.NewKafkaExporter(dir)
+	if err != nil {
+		return err
+	}
+	defer e.Close()
+	for _, s := range res.Stats.Segments {
+		off := s.BaseOffset
+		if off < res.Stats.LowestOffset {
+			off = res.Stats.LowestOffset
+		}
+		for ; off < s.NextOffset; off++ {
+			got, err := cl.Get(ctx, &api.GetRecordRequest{Topic: topic, Offset: off})
+			if _, ok := api.FromStatus(status.Convert(err)).(api.ErrOffsetOutOfRange); ok {
+				// hidden from reads or removed by now
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if err = e.Write(got.Record); err != nil {
+				return err
+			}
+		}
+		if err = e.Roll(); err != nil {
+			return err
+		}
+	}
+	return e.Close()
+}
+
+func (c *ctl) topicCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "topic",
+		Short: "Create, delete, describe and configure topics.",
+	}
+	run := func(fn func(ctx context.Context, cl *client.Client, topic string) (*api.TopicDescription, error)) func(*cobra.Command, []string) error {
+		return func(cmd *cobra.Command, args []string) error {
+			cl, err := c.client()
+			if err != nil {
+				return err
+			}
+			defer cl.Close()
+
+			topic, err := fn(cmd.Context(), cl, args[0])
+			if err != nil || topic == nil {
+				return err
+			}
+			out, tc := cmd.OutOrStdout(), topic.Config
+			fmt.Fprintf(out, "topic\t%s\n", topic.Topic)
+			fmt.Fprintf(out, "offsets\t%d-%d\n", topic.Stats.LowestOffset, topic.Stats.HighestOffset)
+			fmt.Fprintf(out, "bytes\t%d\n", topic.Stats.TotalBytes)
+			fmt.Fprintf(out, "segments\tstore %d\tindex %d\n", tc.MaxStoreBytes, tc.MaxIndexBytes)
+			fmt.Fprintf(out, "retention\tage %s\tbytes %d\tcompact %t\ttombstones %s\n", tc.RetentionMaxAge.AsDuration(), tc.RetentionMaxBytes, tc.Compact, tc.TombstoneRetention.AsDuration())
+			fmt.Fprintf(out, "key index\t%t\n", tc.KeyIndex)
+			return nil
+		}
+	}
+
+	var retentionMaxAge, tombstoneRetention time.Duration
+	tc := &api.TopicConfig{}
+	configFlags := func(cmd *cobra.Command) *cobra.Command {
+		cmd.Flags().Uint64Var(&tc.MaxStoreBytes, "max-store-bytes", 0, "Maximum store size of the topic's segments, the server's if zero.")
+		cmd.Flags().Uint64Var(&tc.MaxIndexBytes, "max-index-bytes", 0, "Maximum index size of the topic's segments, the server's if zero.")
+		cmd.Flags().DurationVar(&retentionMaxAge, "retention-max-age", 0, "Remove segments which weren't written to for longer, the server's retention if zero.")
+		cmd.Flags().Uint64Var(&tc.RetentionMaxBytes, "retention-max-bytes", 0, "Cap the size of the topic's stores, the server's retention if zero.")
+		cmd.Flags().BoolVar(&tc.Compact, "compact", false, "Keep only the latest record per key.")
+		cmd.Flags().BoolVar(&tc.KeyIndex, "key-index", false, "Index the records' keys, so get-key looks them up.")
+		cmd.Flags().DurationVar(&tombstoneRetention, "tombstone-retention", 0, "How long compaction keeps tombstones, the server's if zero.")
+		return cmd
+	}
+	config := func() *api.TopicConfig {
+		if retentionMaxAge != 0 {
+			tc.RetentionMaxAge = durationpb.New(retentionMaxAge)
+		}
+		if tombstoneRetention != 0 {
+			tc.TombstoneRetention = durationpb.New(tombstoneRetention)
+		}
+		return tc
+	}
+
+	cmd.AddCommand(
+		configFlags(&cobra.Command{
+			Use:   "create <topic>",
+			Short: "Create the topic, overriding the server's config with the flags set.",
+			Args:  cobra.ExactArgs(1),
+			RunE: run(func(ctx context.Context, cl *client.Client, topic string) (*api.TopicDescription, error) {
+				res, err := cl.CreateTopic(ctx, &api.CreateTopicRequest{Topic: topic, Config: config()})
+				return res.GetTopic(), err
+			}),
+		}),
+		&cobra.Command{
+			Use:   "delete <topic>",
+			Short: "Delete the topic and its records, they're kept for the servers' grace period.",
+			Args:  cobra.ExactArgs(1),
+			RunE: run(func(ctx context.Context, cl *client.Client, topic string) (*api.TopicDescription, error) {
+				_, err := cl.DeleteTopic(ctx, &api.DeleteTopicRequest{Topic: topic})
+				return nil, err
+			}),
+		},
+		&cobra.Command{
+			Use:   "undelete <topic>",
+			Short: "Restore the topic deleted within the servers' grace period.",
+			Args:  cobra.ExactArgs(1),
+			RunE: run(func(ctx context.Context, cl *client.Client, topic string) (*api.TopicDescription, error) {
+				res, err := cl.UndeleteTopic(ctx, &api.UndeleteTopicRequest{Topic: topic})
+				return res.GetTopic(), err
+			}),
+		},
+		&cobra.Command{
+			Use:   "describe <topic>",
+			Short: "Show the topic's config overrides and offsets.",
+			Args:  cobra.ExactArgs(1),
+			RunE: run(func(ctx context.Context, cl *client.Client, topic string) (*api.TopicDescription, error) {
+				res, err := cl.DescribeTopic(ctx, &api.DescribeTopicRequest{Topic: topic})
+				return res.GetTopic(), err
+			}),
+		},
+		configFlags(&cobra.Command{
+			Use:   "configure <topic>",
+			Short: "Replace the topic's config overrides by the flags set.",
+			Args:  cobra.ExactArgs(1),
+			RunE: run(func(ctx context.Context, cl *client.Client, topic string) (*api.TopicDescription, error) {
+				res, err := cl.ConfigureTopic(ctx, &api.ConfigureTopicRequest{Topic: topic, Config: config()})
+				return res.GetTopic(), err
+			}),
+		}),
+	)
+	return cmd
+}
+
+// aclCmd evaluates policies locally, the API doesn't expose the ACL.
+func aclCmd() *cobra.Command {
+	var model, policy string
+	check := &cobra.Command{
+		Use:   "check <subject> <object> <action>",
+		Short: "Check whether the policy permits the subject the action on the object, e.g. root topic/orders create.",
+		Args:  cobra.ExactArgs(3),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			authorizer, err := auth.New(model, policy)
+			if err != nil {
+				return err
+			}
+			if err = authorizer.Authorize(args[0], args[1], args[2]); err != nil {
+				return err
+			}
+			fmt.Fprintln(cmd.OutOrStdout(), "permitted")
+			return nil
+		},
+	}
+	check.Flags().StringVar(&model, "acl-model-file", "", "Path to ACL model.")
+	check.Flags().StringVar(&policy, "acl-policy-file", "", "Path to ACL policy.")
+	_ = check.MarkFlagRequired("acl-model-file")
+	_ = check.MarkFlagRequired("acl-policy-file")
+
+	cmd := &cobra.Command{
+		Use:   "acl",
+		Short: "Inspect access control policies.",
+	}
+	cmd.AddCommand(check)
+	return cmd
+}
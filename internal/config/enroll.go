@@ -0,0 +1,392 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// EnrollConfig configures the enrollment of a certificate with an EST server (RFC 7030).
+type EnrollConfig struct {
+	// ServerURL is the EST base URL, e.g. "https://ca.internal/.well-known/est".
+	ServerURL string
+	// ServerCAFile is used to verify the EST server, the system pool is used if empty.
+	ServerCAFile string
+	// Username and Password are used for the initial enrollment via HTTP basic auth.
+	Username string
+	Password string
+
+	CommonName string
+	// CertFile, KeyFile and CAFile are written in the format SetupTLSConfig expects.
+	// A KeyFile equal to CertFile writes the key and certificate to one PEM
+	// file, so they're replaced together. Separate files are replaced one
+	// after the other, readers may load a mismatched pair in between.
+	CertFile string
+	KeyFile  string
+	CAFile   string
+
+	// RenewBefore defines how long before expiry a certificate gets renewed.
+	// Defaults to a third of the certificate's lifetime.
+	RenewBefore time.Duration
+	// OnError is called with the errors of the enrollments Run retries, e.g.
+	// to log them.
+	OnError func(err error)
+}
+
+// minRenewWait keeps Run from hammering the EST server if certificates are issued
+// with a lifetime shorter than RenewBefore. It caps the backoff of retried
+// enrollments as well.
+const minRenewWait = time.Minute
+
+// minRetryWait is how long Run waits before retrying a failed enrollment the
+// first time, the wait doubles with every further failure.
+const minRetryWait = time.Second
+
+// Enroller obtains and renews a certificate from an EST server.
+type Enroller struct {
+	config    EnrollConfig
+	client    *http.Client
+	retryWait time.Duration
+}
+
+// NewEnroller creates a new Enroller.
+func NewEnroller(config EnrollConfig) (*Enroller, error) {
+	if config.ServerURL == "" || config.CertFile == "" || config.KeyFile == "" {
+		return nil, fmt.Errorf("enroll: server url, cert file and key file are required")
+	}
+
+	tlsConfig := &tls.Config{}
+	if config.ServerCAFile != "" {
+		b, err := os.ReadFile(config.ServerCAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(b) {
+			return nil, fmt.Errorf("failed to parse root certificate: %q", config.ServerCAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	return &Enroller{
+		config: config,
+		client: &http.Client{
+			Timeout:   30 * time.Second,
+			Transport: &http.Transport{TLSClientConfig: tlsConfig},
+		},
+		retryWait: minRetryWait,
+	}, nil
+}
+
+// Enroll writes a new certificate if there is none yet or the existing one is due for renewal.
+// Existing certificates are used to authenticate the re-enrollment.
+func (e *Enroller) Enroll(ctx context.Context) error {
+	current, err := tls.LoadX509KeyPair(e.config.CertFile, e.config.KeyFile)
+	hasCert := err == nil
+	if hasCert && time.Until(e.renewAt(current)) > 0 {
+		return nil
+	}
+
+	if e.config.CAFile != "" {
+		if err := e.fetchCACerts(ctx); err != nil {
+			return err
+		}
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: e.config.CommonName},
+	}, key)
+	if err != nil {
+		return err
+	}
+
+	op := "simpleenroll"
+	client := e.client
+	if hasCert {
+		op = "simplereenroll"
+		client = e.clientWithCert(current)
+	}
+
+	certs, err := e.do(ctx, client, op, csr)
+	if err != nil {
+		return err
+	}
+	if len(certs) == 0 {
+		return fmt.Errorf("enroll: %s returned no certificate", op)
+	}
+
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return err
+	}
+	keyBlock := &pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}
+	if e.config.KeyFile == e.config.CertFile {
+		return writePEM(e.config.CertFile, 0600, append(certBlocks(certs), keyBlock)...)
+	}
+	return e.replacePair(certs, keyBlock)
+}
+
+// replacePair replaces the separate certificate and key files. Both are
+// written before either is replaced and the certificate is restored if the
+// key can't be replaced, so a failure keeps the current pair.
+func (e *Enroller) replacePair(certs []*x509.Certificate, keyBlock *pem.Block) error {
+	keyTmp, err := tempPEM(e.config.KeyFile, 0600, keyBlock)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(keyTmp)
+	certTmp, err := tempPEM(e.config.CertFile, 0644, certBlocks(certs)...)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(certTmp)
+	current, err := os.ReadFile(e.config.CertFile)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	hadCert := err == nil
+
+	if err = os.Rename(certTmp, e.config.CertFile); err != nil {
+		return err
+	}
+	if err = os.Rename(keyTmp, e.config.KeyFile); err == nil {
+		return nil
+	}
+	if hadCert {
+		if rerr := writeFile(e.config.CertFile, 0644, current); rerr != nil {
+			return fmt.Errorf("%w, restoring the certificate failed: %v", err, rerr)
+		}
+	} else {
+		os.Remove(e.config.CertFile)
+	}
+	return err
+}
+
+// Run enrolls and keeps renewing the certificate until the context is done.
+// Failed enrollments are retried with exponential backoff, so an outage of
+// the EST server doesn't end the renewals.
+func (e *Enroller) Run(ctx context.Context) error {
+	retries := 0
+	for {
+		wait, err := e.renew(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			if e.config.OnError != nil {
+				e.config.OnError(err)
+			}
+			wait = e.retryWait << retries
+			if wait > minRenewWait || wait <= 0 {
+				wait = minRenewWait
+			} else {
+				retries++
+			}
+		} else {
+			retries = 0
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+		case <-timer.C:
+		}
+	}
+}
+
+// renew enrolls if needed and returns how long until the next renewal.
+func (e *Enroller) renew(ctx context.Context) (time.Duration, error) {
+	if err := e.Enroll(ctx); err != nil {
+		return 0, err
+	}
+	cert, err := tls.LoadX509KeyPair(e.config.CertFile, e.config.KeyFile)
+	if err != nil {
+		return 0, err
+	}
+	wait := time.Until(e.renewAt(cert))
+	if wait < minRenewWait {
+		wait = minRenewWait
+	}
+	return wait, nil
+}
+
+func (e *Enroller) renewAt(cert tls.Certificate) time.Time {
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return time.Time{}
+	}
+	renewBefore := e.config.RenewBefore
+	if renewBefore == 0 {
+		renewBefore = leaf.NotAfter.Sub(leaf.NotBefore) / 3
+	}
+	return leaf.NotAfter.Add(-renewBefore)
+}
+
+func (e *Enroller) clientWithCert(cert tls.Certificate) *http.Client {
+	transport := e.client.Transport.(*http.Transport).Clone()
+	transport.TLSClientConfig.Certificates = []tls.Certificate{cert}
+	return &http.Client{Timeout: e.client.Timeout, Transport: transport}
+}
+
+func (e *Enroller) fetchCACerts(ctx context.Context) error {
+	certs, err := e.do(ctx, e.client, "cacerts", nil)
+	if err != nil {
+		return err
+	}
+	return writeCerts(e.config.CAFile, certs)
+}
+
+func (e *Enroller) do(ctx context.Context, client *http.Client, op string, csr []byte) ([]*x509.Certificate, error) {
+	method := http.MethodGet
+	var body io.Reader
+	if csr != nil {
+		method = http.MethodPost
+		body = strings.NewReader(base64.StdEncoding.EncodeToString(csr))
+	}
+
+	url := strings.TrimSuffix(e.config.ServerURL, "/") + "/" + op
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	if csr != nil {
+		req.Header.Set("Content-Type", "application/pkcs10")
+		req.Header.Set("Content-Transfer-Encoding", "base64")
+	}
+	if op == "simpleenroll" && e.config.Username != "" {
+		req.SetBasicAuth(e.config.Username, e.config.Password)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("enroll: %s failed with %q: %s", op, resp.Status, bytes.TrimSpace(b))
+	}
+
+	der, err := base64.StdEncoding.DecodeString(string(bytes.Join(bytes.Fields(b), nil)))
+	if err != nil {
+		return nil, err
+	}
+	return parseCertsOnly(der)
+}
+
+type pkcs7ContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,optional,tag:0"`
+}
+
+type pkcs7SignedData struct {
+	Version          int
+	DigestAlgorithms asn1.RawValue
+	ContentInfo      asn1.RawValue
+	Certificates     asn1.RawValue `asn1:"optional,tag:0"`
+	CRLs             asn1.RawValue `asn1:"optional,tag:1"`
+	SignerInfos      asn1.RawValue
+}
+
+// parseCertsOnly extracts the certificates of a degenerate "certs-only" PKCS#7 message.
+func parseCertsOnly(der []byte) ([]*x509.Certificate, error) {
+	var info pkcs7ContentInfo
+	if _, err := asn1.Unmarshal(der, &info); err != nil {
+		return nil, err
+	}
+
+	var signedData pkcs7SignedData
+	if _, err := asn1.Unmarshal(info.Content.Bytes, &signedData); err != nil {
+		return nil, err
+	}
+
+	return x509.ParseCertificates(signedData.Certificates.Bytes)
+}
+
+func writeCerts(path string, certs []*x509.Certificate) error {
+	return writePEM(path, 0644, certBlocks(certs)...)
+}
+
+func certBlocks(certs []*x509.Certificate) []*pem.Block {
+	var blocks []*pem.Block
+	for _, cert := range certs {
+		blocks = append(blocks, &pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+	}
+	return blocks
+}
+
+// writePEM replaces the file atomically, so readers never observe a partially written file.
+func writePEM(path string, perm os.FileMode, blocks ...*pem.Block) error {
+	tmp, err := tempPEM(path, perm, blocks...)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+	return os.Rename(tmp, path)
+}
+
+// writeFile replaces the file atomically like writePEM.
+func writeFile(path string, perm os.FileMode, data []byte) error {
+	tmp, err := tempFile(path, perm, data)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+	return os.Rename(tmp, path)
+}
+
+// tempPEM writes the blocks to a temporary file next to path, which replaces
+// path once renamed. It returns the temporary file's name.
+func tempPEM(path string, perm os.FileMode, blocks ...*pem.Block) (string, error) {
+	var buf bytes.Buffer
+	for _, block := range blocks {
+		if err := pem.Encode(&buf, block); err != nil {
+			return "", err
+		}
+	}
+	return tempFile(path, perm, buf.Bytes())
+}
+
+// tempFile is tempPEM for data encoded already.
+func tempFile(path string, perm os.FileMode, data []byte) (string, error) {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return "", err
+	}
+	if _, err = tmp.Write(data); err == nil {
+		err = tmp.Chmod(perm)
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	return tmp.Name(), nil
+}
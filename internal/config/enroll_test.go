@@ -0,0 +1,337 @@
+package config
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/justagabriel/proglog/internal"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnroller(t *testing.T) {
+	scenarios := map[string]func(t *testing.T, est *testEST, config EnrollConfig){
+		"enrolls a new certificate":                testEnrollsNewCertificate,
+		"keeps a certificate not due for renewal":  testKeepsValidCertificate,
+		"re-enrolls using the current certificate": testReenrollsWithCurrentCertificate,
+		"fails on rejected enrollment":             testFailsOnRejectedEnrollment,
+		"keeps the key if the cert write fails":    testKeepsKeyOnFailedCertWrite,
+		"restores the cert if the key write fails": testRestoresCertOnFailedKeyWrite,
+		"writes a combined cert and key file":      testWritesCombinedFile,
+		"run retries failed enrollments":           testRunRetriesFailedEnrollments,
+	}
+
+	for title, test := range scenarios {
+		t.Run(title, func(t *testing.T) {
+			est, config := setupEnrollTest(t)
+			test(t, est, config)
+		})
+	}
+}
+
+func testEnrollsNewCertificate(t *testing.T, est *testEST, config EnrollConfig) {
+	// arrange
+	e, err := NewEnroller(config)
+	require.NoError(t, err)
+
+	// act
+	err = e.Enroll(context.Background())
+
+	// assert
+	require.NoError(t, err)
+	require.Equal(t, []string{"simpleenroll"}, est.enrolls)
+	cert, err := tls.LoadX509KeyPair(config.CertFile, config.KeyFile)
+	require.NoError(t, err)
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	require.NoError(t, err)
+	require.Equal(t, "root", leaf.Subject.CommonName)
+
+	_, err = SetupTLSConfig(TLSConfig{
+		CertFile: config.CertFile,
+		KeyFile:  config.KeyFile,
+		CAFile:   config.CAFile,
+	})
+	require.NoError(t, err)
+}
+
+func testKeepsValidCertificate(t *testing.T, est *testEST, config EnrollConfig) {
+	// arrange
+	e, err := NewEnroller(config)
+	require.NoError(t, err)
+	require.NoError(t, e.Enroll(context.Background()))
+
+	// act
+	err = e.Enroll(context.Background())
+
+	// assert
+	require.NoError(t, err)
+	require.Equal(t, []string{"simpleenroll"}, est.enrolls)
+}
+
+func testReenrollsWithCurrentCertificate(t *testing.T, est *testEST, config EnrollConfig) {
+	// arrange
+	config.RenewBefore = 2 * est.validity
+	e, err := NewEnroller(config)
+	require.NoError(t, err)
+	require.NoError(t, e.Enroll(context.Background()))
+
+	// act
+	err = e.Enroll(context.Background())
+
+	// assert
+	require.NoError(t, err)
+	require.Equal(t, []string{"simpleenroll", "simplereenroll"}, est.enrolls)
+}
+
+func testFailsOnRejectedEnrollment(t *testing.T, est *testEST, config EnrollConfig) {
+	// arrange
+	config.Password = "wrong"
+	e, err := NewEnroller(config)
+	require.NoError(t, err)
+
+	// act
+	err = e.Enroll(context.Background())
+
+	// assert
+	require.Error(t, err)
+	_, err = os.Stat(config.CertFile)
+	require.True(t, os.IsNotExist(err))
+}
+
+func testKeepsKeyOnFailedCertWrite(t *testing.T, est *testEST, config EnrollConfig) {
+	// arrange
+	config.CertFile = path.Join(path.Dir(config.CertFile), "missing", "client.pem")
+	e, err := NewEnroller(config)
+	require.NoError(t, err)
+
+	// act
+	err = e.Enroll(context.Background())
+
+	// assert
+	require.Error(t, err)
+	_, err = os.Stat(config.KeyFile)
+	require.True(t, os.IsNotExist(err))
+	entries, err := os.ReadDir(path.Dir(config.KeyFile))
+	require.NoError(t, err)
+	for _, entry := range entries {
+		require.NotContains(t, entry.Name(), "client-key.pem")
+	}
+}
+
+func testRestoresCertOnFailedKeyWrite(t *testing.T, est *testEST, config EnrollConfig) {
+	// arrange
+	e, err := NewEnroller(config)
+	require.NoError(t, err)
+	require.NoError(t, e.Enroll(context.Background()))
+	current, err := os.ReadFile(config.CertFile)
+	require.NoError(t, err)
+	// a directory which isn't empty can't be replaced by the new key
+	require.NoError(t, os.Remove(config.KeyFile))
+	require.NoError(t, os.MkdirAll(path.Join(config.KeyFile, "busy"), 0755))
+
+	// act
+	err = e.Enroll(context.Background())
+
+	// assert
+	require.Error(t, err)
+	require.Equal(t, []string{"simpleenroll", "simpleenroll"}, est.enrolls)
+	restored, err := os.ReadFile(config.CertFile)
+	require.NoError(t, err)
+	require.Equal(t, current, restored)
+}
+
+func testWritesCombinedFile(t *testing.T, est *testEST, config EnrollConfig) {
+	// arrange
+	config.KeyFile = config.CertFile
+	config.RenewBefore = 2 * est.validity
+	e, err := NewEnroller(config)
+	require.NoError(t, err)
+	require.NoError(t, e.Enroll(context.Background()))
+
+	// act
+	err = e.Enroll(context.Background())
+
+	// assert
+	require.NoError(t, err)
+	require.Equal(t, []string{"simpleenroll", "simplereenroll"}, est.enrolls)
+	_, err = tls.LoadX509KeyPair(config.CertFile, config.CertFile)
+	require.NoError(t, err)
+	fi, err := os.Stat(config.CertFile)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0600), fi.Mode().Perm(), "the file holds the key")
+}
+
+func testRunRetriesFailedEnrollments(t *testing.T, est *testEST, config EnrollConfig) {
+	// arrange
+	est.failures = 2
+	var errs []error
+	config.OnError = func(err error) { errs = append(errs, err) }
+	e, err := NewEnroller(config)
+	require.NoError(t, err)
+	e.retryWait = time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+
+	// act
+	go func() { done <- e.Run(ctx) }()
+
+	// assert
+	require.Eventually(t, func() bool {
+		_, err := tls.LoadX509KeyPair(config.CertFile, config.KeyFile)
+		return err == nil
+	}, 5*time.Second, 10*time.Millisecond)
+	cancel()
+	require.NoError(t, <-done)
+	require.Len(t, errs, 2)
+}
+
+// testEST is a minimal EST server signing every CSR with a throwaway CA.
+type testEST struct {
+	ca       *x509.Certificate
+	caKey    *ecdsa.PrivateKey
+	validity time.Duration
+	enrolls  []string
+	// failures is the number of enrollments failed before signing CSRs.
+	failures int
+}
+
+func setupEnrollTest(t *testing.T) (*testEST, EnrollConfig) {
+	t.Helper()
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	caTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test-ca"},
+		NotBefore:             time.Now().Add(-time.Minute),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTmpl, caTmpl, &caKey.PublicKey, caKey)
+	require.NoError(t, err)
+	ca, err := x509.ParseCertificate(caDER)
+	require.NoError(t, err)
+
+	est := &testEST{ca: ca, caKey: caKey, validity: time.Hour}
+	srv := httptest.NewUnstartedServer(est)
+	srv.TLS = &tls.Config{ClientAuth: tls.RequestClientCert}
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+
+	dir := internal.GetTempDir(t, "enroll-*")
+	serverCAFile := path.Join(dir, "est-ca.pem")
+	serverCA := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	require.NoError(t, os.WriteFile(serverCAFile, serverCA, 0644))
+
+	return est, EnrollConfig{
+		ServerURL:    srv.URL + "/.well-known/est",
+		ServerCAFile: serverCAFile,
+		Username:     "enroll",
+		Password:     "secret",
+		CommonName:   "root",
+		CertFile:     path.Join(dir, "client.pem"),
+		KeyFile:      path.Join(dir, "client-key.pem"),
+		CAFile:       path.Join(dir, "ca.pem"),
+	}
+}
+
+func (e *testEST) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/.well-known/est/cacerts":
+		e.writeCerts(w, e.ca.Raw)
+		return
+	case "/.well-known/est/simpleenroll":
+		if user, pass, ok := r.BasicAuth(); !ok || user != "enroll" || pass != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+	case "/.well-known/est/simplereenroll":
+		if len(r.TLS.PeerCertificates) == 0 {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	if e.failures > 0 {
+		e.failures--
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	b, _ := io.ReadAll(r.Body)
+	der, err := base64.StdEncoding.DecodeString(string(b))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	csr, err := x509.ParseCertificateRequest(der)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      csr.Subject,
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(e.validity),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	cert, err := x509.CreateCertificate(rand.Reader, tmpl, e.ca, csr.PublicKey, e.caKey)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	e.enrolls = append(e.enrolls, path.Base(r.URL.Path))
+	e.writeCerts(w, cert)
+}
+
+// writeCerts responds with a degenerate "certs-only" PKCS#7 message.
+func (e *testEST) writeCerts(w http.ResponseWriter, der []byte) {
+	emptySet := asn1.RawValue{Tag: asn1.TagSet, IsCompound: true}
+	signedData, _ := asn1.Marshal(struct {
+		Version          int
+		DigestAlgorithms asn1.RawValue
+		ContentInfo      struct{ ContentType asn1.ObjectIdentifier }
+		Certificates     asn1.RawValue
+		SignerInfos      asn1.RawValue
+	}{
+		Version:          1,
+		DigestAlgorithms: emptySet,
+		ContentInfo:      struct{ ContentType asn1.ObjectIdentifier }{asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}},
+		Certificates:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: der},
+		SignerInfos:      emptySet,
+	})
+	contentInfo, _ := asn1.Marshal(struct {
+		ContentType asn1.ObjectIdentifier
+		Content     asn1.RawValue
+	}{
+		ContentType: asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2},
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: signedData},
+	})
+
+	w.Header().Set("Content-Type", "application/pkcs7-mime; smime-type=certs-only")
+	w.Header().Set("Content-Transfer-Encoding", "base64")
+	w.Write([]byte(base64.StdEncoding.EncodeToString(contentInfo)))
+}
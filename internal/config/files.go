@@ -63,10 +63,10 @@ func configFile(path ...string) string {
 		panic(err)
 	}
 
-	projectRoot := "proglog"
-	absProjectRoot, err := extractDirPath(cwd, projectRoot)
+	// binaries run from anywhere, fall back to the cwd instead of failing on init
+	absProjectRoot, err := extractDirPath(cwd, "proglog")
 	if err != nil {
-		panic(fmt.Errorf("could not extract project root %q from cwd: %q", projectRoot, cwd))
+		absProjectRoot = cwd
 	}
 
 	path = append([]string{absProjectRoot, "test"}, path...)
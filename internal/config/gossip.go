@@ -0,0 +1,25 @@
+package config
+
+import (
+	"encoding/base64"
+	"fmt"
+)
+
+// ParseGossipKeys decodes the base64 encoded keys encrypting the gossip
+// between members, see discovery.Config.EncryptKeys.
+func ParseGossipKeys(encoded []string) ([][]byte, error) {
+	keys := make([][]byte, 0, len(encoded))
+	for i, e := range encoded {
+		key, err := base64.StdEncoding.DecodeString(e)
+		if err != nil {
+			return nil, fmt.Errorf("invalid gossip key %d: %w", i, err)
+		}
+		switch len(key) {
+		case 16, 24, 32:
+		default:
+			return nil, fmt.Errorf("invalid gossip key %d: %d bytes, want 16, 24 or 32", i, len(key))
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
@@ -0,0 +1,38 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseGossipKeys(t *testing.T) {
+	scenarios := map[string]struct {
+		encoded []string
+		keys    [][]byte
+		err     string
+	}{
+		"keys are decoded": {
+			encoded: []string{"MDEyMzQ1Njc4OWFiY2RlZg==", "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY="},
+			keys:    [][]byte{[]byte("0123456789abcdef"), []byte("0123456789abcdef0123456789abcdef")},
+		},
+		"no keys":                {encoded: nil, keys: [][]byte{}},
+		"invalid base64 fails":   {encoded: []string{"not base64!"}, err: "invalid gossip key 0: illegal base64 data at input byte 3"},
+		"invalid key size fails": {encoded: []string{"c2hvcnQ="}, err: "invalid gossip key 0: 5 bytes, want 16, 24 or 32"},
+	}
+
+	for scenario, s := range scenarios {
+		t.Run(scenario, func(t *testing.T) {
+			// act
+			keys, err := ParseGossipKeys(s.encoded)
+
+			// assert
+			if s.err != "" {
+				require.EqualError(t, err, s.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, s.keys, keys)
+		})
+	}
+}
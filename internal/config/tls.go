@@ -5,6 +5,8 @@ import (
 	"crypto/x509"
 	"fmt"
 	"os"
+	"sync"
+	"time"
 )
 
 type TLSConfig struct {
@@ -13,22 +15,45 @@ type TLSConfig struct {
 	CAFile        string
 	ServerAddress string
 	Server        bool
+	// CertificateManager provides the server certificate instead of CertFile
+	// and KeyFile, e.g. an autocert.Manager obtaining it through ACME.
+	CertificateManager CertificateManager
+}
+
+const acmeTLSProtocol = "acme-tls/1"
+
+// CertificateManager provides the certificate per handshake.
+type CertificateManager interface {
+	GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error)
 }
 
 func SetupTLSConfig(cfg TLSConfig) (*tls.Config, error) {
 	tlsConfig := &tls.Config{}
-	var err error
-
-	if cfg.CertFile != "" && cfg.KeyFile != "" {
-		tlsConfig.Certificates = make([]tls.Certificate, 1)
-		tlsConfig.Certificates[0], err = tls.LoadX509KeyPair(
-			cfg.CertFile,
-			cfg.KeyFile,
-		)
 
+	if cfg.CertificateManager != nil {
+		if !cfg.Server {
+			return nil, fmt.Errorf("certificate manager only provides server certificates")
+		}
+		tlsConfig.GetCertificate = cfg.CertificateManager.GetCertificate
+		// lets ACME servers validate the domain with the TLS-ALPN-01 challenge,
+		// the manager answers these handshakes
+		tlsConfig.NextProtos = []string{acmeTLSProtocol}
+	} else if cfg.CertFile != "" && cfg.KeyFile != "" {
+		// the key pair is handed out per handshake, so rotated files are picked
+		// up by new connections while established ones keep going
+		keyPair, err := loadKeyPair(cfg.CertFile, cfg.KeyFile)
 		if err != nil {
 			return nil, err
 		}
+		if cfg.Server {
+			tlsConfig.GetCertificate = func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+				return keyPair.certificate()
+			}
+		} else {
+			tlsConfig.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+				return keyPair.certificate()
+			}
+		}
 	}
 
 	if cfg.CAFile != "" {
@@ -58,3 +83,61 @@ func SetupTLSConfig(cfg TLSConfig) (*tls.Config, error) {
 
 	return tlsConfig, nil
 }
+
+// keyPair is a certificate and its key, which are loaded again once their
+// files changed.
+type keyPair struct {
+	certFile, keyFile string
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	version [2]fileVersion
+}
+
+type fileVersion struct {
+	modTime time.Time
+	size    int64
+}
+
+func loadKeyPair(certFile, keyFile string) (*keyPair, error) {
+	kp := &keyPair{certFile: certFile, keyFile: keyFile}
+	if _, err := kp.certificate(); err != nil {
+		return nil, err
+	}
+	return kp, nil
+}
+
+func (kp *keyPair) certificate() (*tls.Certificate, error) {
+	kp.mu.Lock()
+	defer kp.mu.Unlock()
+
+	version, err := kp.stat()
+	if err == nil && kp.cert != nil && version == kp.version {
+		return kp.cert, nil
+	}
+	if err == nil {
+		var cert tls.Certificate
+		cert, err = tls.LoadX509KeyPair(kp.certFile, kp.keyFile)
+		if err == nil {
+			kp.cert, kp.version = &cert, version
+			return kp.cert, nil
+		}
+	}
+	// files being rotated may be missing or not match for a moment, the
+	// previous certificate stays in use until they're consistent again
+	if kp.cert != nil {
+		return kp.cert, nil
+	}
+	return nil, err
+}
+
+func (kp *keyPair) stat() (version [2]fileVersion, err error) {
+	for i, file := range []string{kp.certFile, kp.keyFile} {
+		info, err := os.Stat(file)
+		if err != nil {
+			return version, err
+		}
+		version[i] = fileVersion{modTime: info.ModTime(), size: info.Size()}
+	}
+	return version, nil
+}
@@ -0,0 +1,182 @@
+package config
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/justagabriel/proglog/internal"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTLSConfigReload(t *testing.T) {
+	scenarios := map[string]func(t *testing.T, files TLSConfig){
+		"serves the rotated certificate":             testServesRotatedCertificate,
+		"presents the rotated client certificate":    testPresentsRotatedClientCertificate,
+		"keeps the certificate while files mismatch": testKeepsCertificateWhileMismatched,
+		"fails on missing files":                     testFailsOnMissingFiles,
+	}
+
+	for title, test := range scenarios {
+		t.Run(title, func(t *testing.T) {
+			dir := internal.GetTempDir(t, "tls-*")
+			files := TLSConfig{
+				CertFile: path.Join(dir, "cert.pem"),
+				KeyFile:  path.Join(dir, "key.pem"),
+			}
+			test(t, files)
+		})
+	}
+}
+
+func testServesRotatedCertificate(t *testing.T, files TLSConfig) {
+	// arrange
+	writeKeyPair(t, files, "first", time.Now())
+	files.Server = true
+	tlsConfig, err := SetupTLSConfig(files)
+	require.NoError(t, err)
+
+	// act
+	writeKeyPair(t, files, "second", time.Now().Add(time.Second))
+
+	// assert
+	cert, err := tlsConfig.GetCertificate(&tls.ClientHelloInfo{})
+	require.NoError(t, err)
+	require.Equal(t, "second", commonName(t, cert))
+}
+
+func testPresentsRotatedClientCertificate(t *testing.T, files TLSConfig) {
+	// arrange
+	writeKeyPair(t, files, "first", time.Now())
+	tlsConfig, err := SetupTLSConfig(files)
+	require.NoError(t, err)
+	cert, err := tlsConfig.GetClientCertificate(&tls.CertificateRequestInfo{})
+	require.NoError(t, err)
+	require.Equal(t, "first", commonName(t, cert))
+
+	// act
+	writeKeyPair(t, files, "second", time.Now().Add(time.Second))
+
+	// assert
+	cert, err = tlsConfig.GetClientCertificate(&tls.CertificateRequestInfo{})
+	require.NoError(t, err)
+	require.Equal(t, "second", commonName(t, cert))
+}
+
+func testKeepsCertificateWhileMismatched(t *testing.T, files TLSConfig) {
+	// arrange
+	writeKeyPair(t, files, "first", time.Now())
+	files.Server = true
+	tlsConfig, err := SetupTLSConfig(files)
+	require.NoError(t, err)
+
+	// act
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(files.KeyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0600))
+	require.NoError(t, os.Chtimes(files.KeyFile, time.Now(), time.Now().Add(time.Second)))
+
+	// assert
+	cert, err := tlsConfig.GetCertificate(&tls.ClientHelloInfo{})
+	require.NoError(t, err)
+	require.Equal(t, "first", commonName(t, cert))
+}
+
+func testFailsOnMissingFiles(t *testing.T, files TLSConfig) {
+	// act
+	_, err := SetupTLSConfig(files)
+
+	// assert
+	require.Error(t, err)
+}
+
+// writeKeyPair writes a self-signed certificate, modTime makes sure the
+// change is visible despite coarse file system timestamps.
+func writeKeyPair(t *testing.T, files TLSConfig, commonName string, modTime time.Time) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(files.CertFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER}), 0644))
+	require.NoError(t, os.WriteFile(files.KeyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+	for _, file := range []string{files.CertFile, files.KeyFile} {
+		require.NoError(t, os.Chtimes(file, modTime, modTime))
+	}
+}
+
+func commonName(t *testing.T, cert *tls.Certificate) string {
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	require.NoError(t, err)
+	return leaf.Subject.CommonName
+}
+
+type staticManager struct {
+	cert *tls.Certificate
+}
+
+func (m staticManager) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return m.cert, nil
+}
+
+func TestTLSConfigCertificateManager(t *testing.T) {
+	scenarios := map[string]func(t *testing.T, manager CertificateManager){
+		"serves the manager's certificate":    testServesManagedCertificate,
+		"doesn't provide client certificates": testRejectsManagedClientCertificate,
+	}
+
+	for title, test := range scenarios {
+		t.Run(title, func(t *testing.T) {
+			dir := internal.GetTempDir(t, "tls-*")
+			files := TLSConfig{
+				CertFile: path.Join(dir, "cert.pem"),
+				KeyFile:  path.Join(dir, "key.pem"),
+			}
+			writeKeyPair(t, files, "managed", time.Now())
+			cert, err := tls.LoadX509KeyPair(files.CertFile, files.KeyFile)
+			require.NoError(t, err)
+			test(t, staticManager{cert: &cert})
+		})
+	}
+}
+
+func testServesManagedCertificate(t *testing.T, manager CertificateManager) {
+	// act
+	tlsConfig, err := SetupTLSConfig(TLSConfig{CertificateManager: manager, Server: true})
+
+	// assert
+	require.NoError(t, err)
+	cert, err := tlsConfig.GetCertificate(&tls.ClientHelloInfo{ServerName: "log.example.com"})
+	require.NoError(t, err)
+	require.Equal(t, "managed", commonName(t, cert))
+	require.Contains(t, tlsConfig.NextProtos, acmeTLSProtocol)
+}
+
+func testRejectsManagedClientCertificate(t *testing.T, manager CertificateManager) {
+	// act
+	_, err := SetupTLSConfig(TLSConfig{CertificateManager: manager})
+
+	// assert
+	require.Error(t, err)
+}
@@ -0,0 +1,66 @@
+package discovery
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/hashicorp/serf/serf"
+	"go.uber.org/zap"
+)
+
+// rejoinDNS joins the members StartJoinDNS resolves to until the member left.
+func (m *Membership) rejoinDNS() {
+	interval := m.RejoinInterval
+	if interval == 0 {
+		interval = 30 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		m.joinDNS()
+		select {
+		case <-ticker.C:
+		case <-m.left:
+			return
+		}
+	}
+}
+
+// joinDNS joins the addresses StartJoinDNS resolves to, which aren't alive
+// members yet. Failures are logged only, members which aren't up yet are
+// joined the next time.
+func (m *Membership) joinDNS() {
+	host, port, err := net.SplitHostPort(m.StartJoinDNS)
+	if err != nil {
+		m.logger.Error("invalid start join dns", zap.String("dns", m.StartJoinDNS), zap.Error(err))
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	ips, err := net.DefaultResolver.LookupHost(ctx, host)
+	if err != nil {
+		m.logger.Debug("failed to resolve start join dns", zap.String("dns", m.StartJoinDNS), zap.Error(err))
+		return
+	}
+
+	alive := make(map[string]bool)
+	for _, member := range m.serf.Members() {
+		if member.Status == serf.StatusAlive {
+			alive[net.JoinHostPort(member.Addr.String(), strconv.Itoa(int(member.Port)))] = true
+		}
+	}
+	var addrs []string
+	for _, ip := range ips {
+		if addr := net.JoinHostPort(ip, port); !alive[addr] {
+			addrs = append(addrs, addr)
+		}
+	}
+	if len(addrs) == 0 {
+		return
+	}
+	if _, err := m.serf.Join(addrs, true); err != nil {
+		m.logger.Debug("failed to join start join dns", zap.Strings("addrs", addrs), zap.Error(err))
+	}
+}
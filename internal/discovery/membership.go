@@ -3,22 +3,70 @@ package discovery
 import (
 	"errors"
 	"net"
+	"sync"
+	"time"
 
+	"github.com/hashicorp/memberlist"
 	"github.com/hashicorp/raft"
 	"github.com/hashicorp/serf/serf"
+	api "github.com/justagabriel/proglog/api/v1"
 	"go.uber.org/zap"
 )
 
+// Handler is notified about other members joining and leaving the cluster.
 type Handler interface {
 	Join(name, addr string) error
 	Leave(name string) error
 }
 
+// ZoneHandler is implemented by handlers which place members by their zone,
+// it's called instead of Join.
+type ZoneHandler interface {
+	JoinZone(name, addr, zone string) error
+}
+
+// ReplicaHandler is implemented by handlers which support read replicas,
+// it's called instead of Join for members tagged as replica.
+type ReplicaHandler interface {
+	JoinNonvoter(name, addr, zone string) error
+}
+
+// Bootstrapper is implemented by handlers bootstrapping the cluster, it's
+// called with the names and raft addresses of the members once
+// Config.BootstrapExpect of them are alive.
+type Bootstrapper interface {
+	Bootstrap(servers map[string]string) error
+}
+
 type Config struct {
 	NodeName       string
 	BindAddr       string
-	Tags           map[string]string
+	Tags           Tags
 	StartJoinAddrs []string
+	// StartJoinDNS is a host and port whose host resolves to the addresses
+	// of the members to join, e.g. the name of a headless Kubernetes service.
+	// It's resolved again every RejoinInterval, defaulting to 30 seconds, and
+	// the addresses which aren't alive members are joined, so members are
+	// found again after their IPs changed and partitions heal.
+	StartJoinDNS   string
+	RejoinInterval time.Duration
+	// BootstrapExpect bootstraps the cluster through the handler once exactly
+	// this many members are alive, read replicas aside, so no member
+	// bootstraps a cluster of its own. All members have to expect the same
+	// count, which has to stay the cluster's initial size when it grows. Zero
+	// leaves bootstrapping to others.
+	BootstrapExpect int
+	// EncryptKeys encrypt the gossip between members with AES, the keys are
+	// 16, 24 or 32 bytes long. The first key encrypts and all of them decrypt,
+	// so a key is rotated by adding the new one to all members before making
+	// it the first. Members without a key in common can't join each other,
+	// no keys leave the gossip unencrypted.
+	EncryptKeys [][]byte
+	// Listener carries the gossip over its TCP connections instead of
+	// BindAddr's own UDP and TCP ports, e.g. a listener of a port shared with
+	// other protocols handing over the connections starting with SerfRPC.
+	// BindAddr is the address members reach the listener at then.
+	Listener net.Listener
 }
 
 type Membership struct {
@@ -27,6 +75,11 @@ type Membership struct {
 	serf    *serf.Serf
 	events  chan serf.Event
 	logger  *zap.Logger
+	// left stops rejoining StartJoinDNS
+	left      chan struct{}
+	leaveOnce sync.Once
+	// bootstrapped is only accessed by the event handler
+	bootstrapped bool
 }
 
 func New(handler Handler, config Config) (*Membership, error) {
@@ -34,6 +87,7 @@ func New(handler Handler, config Config) (*Membership, error) {
 		Config:  config,
 		handler: handler,
 		logger:  zap.L().Named("membership"),
+		left:    make(chan struct{}),
 	}
 
 	if err := c.setupSerf(); err != nil {
@@ -46,17 +100,26 @@ func New(handler Handler, config Config) (*Membership, error) {
 func (m *Membership) setupSerf() error {
 	addr, err := net.ResolveTCPAddr("tcp", m.BindAddr)
 	if err != nil {
-		return nil
+		return err
 	}
 
 	config := serf.DefaultConfig()
 	config.Init()
 
-	config.Tags = m.Tags
+	config.Tags = m.Tags.Map()
 	config.NodeName = m.Config.NodeName
 
 	config.MemberlistConfig.BindAddr = addr.IP.String()
 	config.MemberlistConfig.BindPort = addr.Port
+	if m.Listener != nil {
+		config.MemberlistConfig.Transport = newMuxTransport(m.Listener, addr)
+	}
+	if len(m.EncryptKeys) > 0 {
+		config.MemberlistConfig.Keyring, err = memberlist.NewKeyring(m.EncryptKeys[1:], m.EncryptKeys[0])
+		if err != nil {
+			return err
+		}
+	}
 
 	m.events = make(chan serf.Event)
 	config.EventCh = m.events
@@ -73,6 +136,9 @@ func (m *Membership) setupSerf() error {
 			return err
 		}
 	}
+	if m.StartJoinDNS != "" {
+		go m.rejoinDNS()
+	}
 
 	return nil
 }
@@ -87,10 +153,12 @@ func (m *Membership) eventHandler() {
 				}
 				m.handleJoin(member)
 			}
+			m.bootstrap()
 		case serf.EventMemberLeave, serf.EventMemberFailed:
 			for _, member := range e.(serf.MemberEvent).Members {
+				// the handler must keep draining events, serf blocks otherwise
 				if m.isLocal(member) {
-					return
+					continue
 				}
 				m.handleLeave(member)
 			}
@@ -99,12 +167,48 @@ func (m *Membership) eventHandler() {
 }
 
 func (m *Membership) handleJoin(member serf.Member) {
-	err := m.handler.Join(member.Name, member.Tags["rpc_addr"])
+	tags := ParseTags(member.Tags)
+	var err error
+	rh, isReplicaHandler := m.handler.(ReplicaHandler)
+	zh, isZoneHandler := m.handler.(ZoneHandler)
+	switch {
+	case tags.Replica && isReplicaHandler:
+		err = rh.JoinNonvoter(member.Name, tags.raftAddr(), tags.Zone)
+	case isZoneHandler:
+		err = zh.JoinZone(member.Name, tags.raftAddr(), tags.Zone)
+	default:
+		err = m.handler.Join(member.Name, tags.raftAddr())
+	}
 	if err != nil {
 		m.logError(err, "failed to join", member)
 	}
 }
 
+// bootstrap bootstraps the cluster with the alive members once they're as many
+// as expected.
+func (m *Membership) bootstrap() {
+	b, ok := m.handler.(Bootstrapper)
+	if !ok || m.BootstrapExpect == 0 || m.bootstrapped {
+		return
+	}
+	servers := make(map[string]string)
+	for _, member := range m.serf.Members() {
+		tags := ParseTags(member.Tags)
+		if member.Status == serf.StatusAlive && !tags.Replica {
+			servers[member.Name] = tags.raftAddr()
+		}
+	}
+	// members joining a cluster grown beyond the count are added by its leader
+	if len(servers) != m.BootstrapExpect {
+		return
+	}
+	if err := b.Bootstrap(servers); err != nil {
+		m.logger.Error("failed to bootstrap", zap.Error(err))
+		return
+	}
+	m.bootstrapped = true
+}
+
 func (m *Membership) handleLeave(member serf.Member) {
 	err := m.handler.Leave(member.Name)
 	if err != nil {
@@ -121,19 +225,32 @@ func (m *Membership) Members() []serf.Member {
 	return m.serf.Members()
 }
 
+// MemberTags returns the tags of the members which are alive by their name.
+func (m *Membership) MemberTags() map[string]Tags {
+	tags := make(map[string]Tags)
+	for _, member := range m.serf.Members() {
+		if member.Status == serf.StatusAlive {
+			tags[member.Name] = ParseTags(member.Tags)
+		}
+	}
+	return tags
+}
+
 func (m *Membership) Leave() error {
+	m.leaveOnce.Do(func() { close(m.left) })
 	return m.serf.Leave()
 }
 
 func (m *Membership) logError(err error, msg string, mbr serf.Member) {
 	log := m.logger.Error
-	if errors.Is(err, raft.ErrNotLeader) {
+	var notLeader api.ErrNotLeader
+	if errors.Is(err, raft.ErrNotLeader) || errors.As(err, &notLeader) {
 		log = m.logger.Debug
 	}
 	log(
 		msg,
 		zap.Error(err),
 		zap.String("name", mbr.Name),
-		zap.String("rpc_addr", mbr.Tags["rpc_addr"]),
+		zap.String("rpc_addr", mbr.Tags[rpcAddrTag]),
 	)
 }
@@ -2,6 +2,8 @@ package discovery
 
 import (
 	"fmt"
+	"net"
+	"sync"
 	"testing"
 	"time"
 
@@ -38,15 +40,160 @@ func TestMembership(t *testing.T) {
 		250*time.Microsecond)
 
 	require.Equal(t, fmt.Sprintf("%d", 2), <-handler.leaves)
+	tags := m[0].MemberTags()
+	require.Len(t, tags, 2, "members which left are left out")
+	require.Equal(t, m[1].Tags, tags["1"])
+}
+
+func TestMembershipInvalidBindAddr(t *testing.T) {
+	// act
+	_, err := New(&handler{}, Config{NodeName: "0", BindAddr: "127.0.0.1"})
+
+	// assert
+	require.Error(t, err)
+}
+
+func TestMembershipEncrypted(t *testing.T) {
+	// arrange
+	oldKey, newKey, otherKey := []byte("0123456789abcdef"), []byte("fedcba9876543210"), []byte("0000000000000000")
+	first, err := New(&handler{}, encryptedConfig(t, "0", "", oldKey, newKey))
+	require.NoError(t, err)
+	defer first.Leave()
+
+	// act
+	// the second member already encrypts with the new key
+	rotated, rotatedErr := New(&handler{}, encryptedConfig(t, "1", first.BindAddr, newKey, oldKey))
+	_, otherErr := New(&handler{}, encryptedConfig(t, "2", first.BindAddr, otherKey))
+
+	// assert
+	require.NoError(t, rotatedErr, "members decrypting each other's keys join")
+	defer rotated.Leave()
+	require.Eventually(t, func() bool { return len(first.Members()) == 2 }, 5*time.Second, 10*time.Millisecond)
+	require.Error(t, otherErr, "members without a key in common don't")
+}
+
+func TestMembershipListener(t *testing.T) {
+	// arrange
+	first := listenerConfig(t, "0")
+	m0, err := New(&handler{}, first)
+	require.NoError(t, err)
+	defer m0.Leave()
+	second := listenerConfig(t, "1")
+	second.StartJoinAddrs = []string{first.BindAddr}
+
+	// act
+	m1, err := New(&handler{}, second)
+	require.NoError(t, err)
+	defer m1.Leave()
+
+	// assert
+	require.Eventually(t, func() bool {
+		return len(m0.Members()) == 2 && len(m1.Members()) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+	require.NoError(t, m1.Leave())
+	require.Eventually(t, func() bool {
+		for _, member := range m0.Members() {
+			if member.Name == "1" {
+				return member.Status == serf.StatusLeft
+			}
+		}
+		return false
+	}, 5*time.Second, 10*time.Millisecond, "the gossip reaches the first member")
+}
+
+func TestMembershipStartJoinDNS(t *testing.T) {
+	// arrange
+	port := internal.FreePort(t)
+	addr := fmt.Sprintf("127.0.0.1:%d", internal.FreePort(t))
+	joining, err := New(&handler{}, Config{
+		NodeName:       "1",
+		BindAddr:       addr,
+		Tags:           Tags{RPCAddr: addr},
+		StartJoinDNS:   fmt.Sprintf("localhost:%d", port),
+		RejoinInterval: 10 * time.Millisecond,
+	})
+	require.NoError(t, err, "members which aren't up yet don't fail the start")
+	defer joining.Leave()
+
+	// act
+	addr = fmt.Sprintf("127.0.0.1:%d", port)
+	first, err := New(&handler{}, Config{NodeName: "0", BindAddr: addr, Tags: Tags{RPCAddr: addr}})
+	require.NoError(t, err)
+	defer first.Leave()
+
+	// assert
+	require.Eventually(t, func() bool {
+		return len(first.Members()) == 2 && len(joining.Members()) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestMembershipBootstrapExpect(t *testing.T) {
+	// arrange
+	var members []*Membership
+	var handlers []*bootstrapHandler
+	servers := make(map[string]string)
+	join := func() {
+		addr := fmt.Sprintf("127.0.0.1:%d", internal.FreePort(t))
+		config := Config{NodeName: fmt.Sprint(len(members)), BindAddr: addr, Tags: Tags{RPCAddr: addr}, BootstrapExpect: 3}
+		if len(members) > 0 {
+			config.StartJoinAddrs = []string{members[0].BindAddr}
+		}
+		h := &bootstrapHandler{}
+		m, err := New(h, config)
+		require.NoError(t, err)
+		t.Cleanup(func() { m.Leave() })
+		members, handlers = append(members, m), append(handlers, h)
+		servers[config.NodeName] = addr
+	}
+	join()
+	join()
+	require.Eventually(t, func() bool { return len(members[0].Members()) == 2 }, 5*time.Second, 10*time.Millisecond)
+	_, calls := handlers[0].get()
+	require.Zero(t, calls, "two members don't bootstrap")
+
+	// act
+	join()
+
+	// assert
+	require.Eventually(t, func() bool {
+		for _, h := range handlers {
+			if _, calls := h.get(); calls == 0 {
+				return false
+			}
+		}
+		return true
+	}, 5*time.Second, 10*time.Millisecond)
+	for _, h := range handlers {
+		bootstrapped, calls := h.get()
+		require.Equal(t, servers, bootstrapped, "the members bootstrap the same cluster")
+		require.Equal(t, 1, calls)
+	}
+}
+
+// listenerConfig configures a member gossiping over a TCP listener of its own.
+func listenerConfig(t *testing.T, name string) Config {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+	addr := ln.Addr().String()
+	return Config{NodeName: name, BindAddr: addr, Tags: Tags{RPCAddr: addr}, Listener: ln}
+}
+
+// encryptedConfig configures a member joining join unless it's empty.
+func encryptedConfig(t *testing.T, name, join string, keys ...[]byte) Config {
+	addr := fmt.Sprintf("127.0.0.1:%d", internal.FreePort(t))
+	config := Config{NodeName: name, BindAddr: addr, Tags: Tags{RPCAddr: addr}, EncryptKeys: keys}
+	if join != "" {
+		config.StartJoinAddrs = []string{join}
+	}
+	return config
 }
 
 func setupMember(t *testing.T, members []*Membership) ([]*Membership, *handler) {
 	id := len(members)
 	port := internal.FreePort(t)
 	addr := fmt.Sprintf("%s:%d", "127.0.0.1", port)
-	tags := map[string]string{
-		"rpc_addr": addr,
-	}
+	tags := Tags{RPCAddr: addr, Zone: fmt.Sprintf("zone-%d", id), Version: "1.0.0"}
 
 	config := Config{
 		NodeName: fmt.Sprintf("%d", id),
@@ -91,3 +238,26 @@ func (h *handler) Leave(id string) error {
 	}
 	return nil
 }
+
+// bootstrapHandler records the servers it bootstrapped with.
+type bootstrapHandler struct {
+	handler
+	mu      sync.Mutex
+	servers map[string]string
+	calls   int
+}
+
+func (h *bootstrapHandler) Bootstrap(servers map[string]string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.servers = servers
+	h.calls++
+	return nil
+}
+
+// get returns the servers and how often it bootstrapped.
+func (h *bootstrapHandler) get() (map[string]string, int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.servers, h.calls
+}
@@ -0,0 +1,61 @@
+package discovery
+
+import "strconv"
+
+// Tags describe a member to the others.
+type Tags struct {
+	// RPCAddr serves the log's RPCs.
+	RPCAddr string
+	// RaftAddr is joined to the raft cluster, it's the RPC address if empty.
+	RaftAddr string
+	// Zone is the availability zone or rack the member runs in.
+	Zone string
+	// Version is the member's software version, e.g. to check rolling upgrades.
+	Version string
+	// Replica members join raft as non-voters serving reads only.
+	Replica bool
+}
+
+const (
+	rpcAddrTag  = "rpc_addr"
+	raftAddrTag = "raft_addr"
+	zoneTag     = "zone"
+	versionTag  = "version"
+	replicaTag  = "replica"
+)
+
+// Map returns the serf tags, empty ones are left out.
+func (t Tags) Map() map[string]string {
+	m := make(map[string]string)
+	for key, value := range map[string]string{
+		rpcAddrTag:  t.RPCAddr,
+		raftAddrTag: t.RaftAddr,
+		zoneTag:     t.Zone,
+		versionTag:  t.Version,
+		replicaTag:  strconv.FormatBool(t.Replica),
+	} {
+		if value != "" && value != "false" {
+			m[key] = value
+		}
+	}
+	return m
+}
+
+// ParseTags reads the serf tags of a member.
+func ParseTags(m map[string]string) Tags {
+	return Tags{
+		RPCAddr:  m[rpcAddrTag],
+		RaftAddr: m[raftAddrTag],
+		Zone:     m[zoneTag],
+		Version:  m[versionTag],
+		Replica:  m[replicaTag] == "true",
+	}
+}
+
+// raftAddr returns the address the member is joined to raft with.
+func (t Tags) raftAddr() string {
+	if t.RaftAddr == "" {
+		return t.RPCAddr
+	}
+	return t.RaftAddr
+}
@@ -0,0 +1,192 @@
+package discovery
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"github.com/hashicorp/memberlist"
+	"go.uber.org/zap"
+)
+
+// SerfRPC identifies the gossip's connections on a listener shared with other
+// protocols, like log.RaftRPC identifies raft's.
+const SerfRPC = 2
+
+// The kinds of connections following SerfRPC.
+const (
+	packetConn byte = iota
+	streamConn
+)
+
+const (
+	// maxPacketBytes caps a packet, memberlist's UDP packets aren't larger.
+	maxPacketBytes = 65536
+	// connTimeout bounds dialing and sending a packet or stream header.
+	connTimeout = 5 * time.Second
+)
+
+var _ memberlist.Transport = (*muxTransport)(nil)
+
+// muxTransport carries memberlist's gossip over the TCP connections of a
+// listener shared with other protocols, so members need no ports of their
+// own. Each packet is sent over a connection of its own, prefixed with the
+// sender's address as UDP's source address is missing.
+type muxTransport struct {
+	ln       net.Listener
+	addr     *net.TCPAddr
+	packets  chan *memberlist.Packet
+	streams  chan net.Conn
+	shutdown chan struct{}
+	logger   *zap.Logger
+}
+
+func newMuxTransport(ln net.Listener, addr *net.TCPAddr) *muxTransport {
+	t := &muxTransport{
+		ln:       ln,
+		addr:     addr,
+		packets:  make(chan *memberlist.Packet),
+		streams:  make(chan net.Conn),
+		shutdown: make(chan struct{}),
+		logger:   zap.L().Named("membership"),
+	}
+	go t.accept()
+	return t
+}
+
+// FinalAdvertiseAddr advertises the address the listener is reached at.
+func (t *muxTransport) FinalAdvertiseAddr(ip string, port int) (net.IP, int, error) {
+	if ip != "" {
+		advertiseIP := net.ParseIP(ip)
+		if advertiseIP == nil {
+			return nil, 0, fmt.Errorf("invalid advertise address %q", ip)
+		}
+		return advertiseIP, port, nil
+	}
+	if t.addr.IP.IsUnspecified() {
+		return nil, 0, errors.New("bind address has to name the host members reach it at")
+	}
+	return t.addr.IP, t.addr.Port, nil
+}
+
+// WriteTo sends the packet in the background, packets are best-effort like
+// over UDP, and dialing unreachable members mustn't hold up the probes.
+func (t *muxTransport) WriteTo(b []byte, addr string) (time.Time, error) {
+	from := t.addr.String()
+	buf := make([]byte, 0, 4+len(from)+len(b))
+	buf = append(buf, SerfRPC, packetConn)
+	buf = binary.BigEndian.AppendUint16(buf, uint16(len(from)))
+	buf = append(buf, from...)
+	buf = append(buf, b...)
+	go func() {
+		conn, err := net.DialTimeout("tcp", addr, connTimeout)
+		if err != nil {
+			t.logger.Debug("failed to send packet", zap.String("addr", addr), zap.Error(err))
+			return
+		}
+		defer conn.Close()
+		_ = conn.SetWriteDeadline(time.Now().Add(connTimeout))
+		if _, err = conn.Write(buf); err != nil {
+			t.logger.Debug("failed to send packet", zap.String("addr", addr), zap.Error(err))
+		}
+	}()
+	return time.Now(), nil
+}
+
+func (t *muxTransport) PacketCh() <-chan *memberlist.Packet {
+	return t.packets
+}
+
+func (t *muxTransport) DialTimeout(addr string, timeout time.Duration) (net.Conn, error) {
+	conn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return nil, err
+	}
+	_ = conn.SetWriteDeadline(time.Now().Add(connTimeout))
+	if _, err = conn.Write([]byte{SerfRPC, streamConn}); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	_ = conn.SetWriteDeadline(time.Time{})
+	return conn, nil
+}
+
+func (t *muxTransport) StreamCh() <-chan net.Conn {
+	return t.streams
+}
+
+// Shutdown stops handing out connections, the shared listener is closed by
+// its owner.
+func (t *muxTransport) Shutdown() error {
+	close(t.shutdown)
+	return nil
+}
+
+func (t *muxTransport) accept() {
+	for {
+		conn, err := t.ln.Accept()
+		if err != nil {
+			return
+		}
+		go t.handle(conn)
+	}
+}
+
+func (t *muxTransport) handle(conn net.Conn) {
+	_ = conn.SetReadDeadline(time.Now().Add(connTimeout))
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(conn, header); err != nil || header[0] != SerfRPC {
+		conn.Close()
+		return
+	}
+
+	switch header[1] {
+	case streamConn:
+		_ = conn.SetReadDeadline(time.Time{})
+		select {
+		case t.streams <- conn:
+		case <-t.shutdown:
+			conn.Close()
+		}
+	case packetConn:
+		defer conn.Close()
+		packet, err := readPacket(conn)
+		if err != nil {
+			t.logger.Debug("failed to receive packet", zap.Stringer("addr", conn.RemoteAddr()), zap.Error(err))
+			return
+		}
+		select {
+		case t.packets <- packet:
+		case <-t.shutdown:
+		}
+	default:
+		conn.Close()
+	}
+}
+
+// readPacket reads the sender's address and the packet following it.
+func readPacket(r io.Reader) (*memberlist.Packet, error) {
+	var n uint16
+	if err := binary.Read(r, binary.BigEndian, &n); err != nil {
+		return nil, err
+	}
+	from := make([]byte, n)
+	if _, err := io.ReadFull(r, from); err != nil {
+		return nil, err
+	}
+	addr, err := net.ResolveTCPAddr("tcp", string(from))
+	if err != nil {
+		return nil, err
+	}
+	buf, err := io.ReadAll(io.LimitReader(r, maxPacketBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(buf) > maxPacketBytes {
+		return nil, fmt.Errorf("packet exceeds %d bytes", maxPacketBytes)
+	}
+	return &memberlist.Packet{Buf: buf, From: addr, Timestamp: time.Now()}, nil
+}
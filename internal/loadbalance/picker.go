@@ -5,6 +5,7 @@ import (
 	"sync"
 	"sync/atomic"
 
+	api "github.com/justagabriel/proglog/api/v1"
 	"google.golang.org/grpc/balancer"
 	"google.golang.org/grpc/balancer/base"
 )
@@ -15,22 +16,32 @@ type Picker struct {
 	mu        sync.Mutex
 	leader    balancer.SubConn
 	followers []balancer.SubConn
-	current   uint64
+	// local are the followers in the client's zone, reads prefer them
+	local   []balancer.SubConn
+	addrs   map[string]balancer.SubConn
+	current uint64
 }
 
 func (p *Picker) Build(buildInfo base.PickerBuildInfo) balancer.Picker {
 	p.mu.Lock()
 	defer p.mu.Unlock()
-	var followers []balancer.SubConn
+	var followers, local []balancer.SubConn
+	p.leader = nil
+	p.addrs = make(map[string]balancer.SubConn, len(buildInfo.ReadySCs))
 	for sc, scInfo := range buildInfo.ReadySCs {
+		p.addrs[scInfo.Address.Addr] = sc
 		isLeader := scInfo.Address.Attributes.Value("is_leader").(bool)
 		if isLeader {
 			p.leader = sc
 			continue
 		}
 		followers = append(followers, sc)
+		if sameZone, _ := scInfo.Address.Attributes.Value("same_zone").(bool); sameZone {
+			local = append(local, sc)
+		}
 	}
 	p.followers = followers
+	p.local = local
 	return p
 }
 
@@ -40,22 +51,45 @@ func (p *Picker) Pick(info balancer.PickInfo) (balancer.PickResult, error) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 	var result balancer.PickResult
-	if strings.Contains(info.FullMethodName, "Create") || len(p.followers) == 0 {
-		result.SubConn = p.leader
-	} else if strings.Contains(info.FullMethodName, "Get") {
+	// reads are spread across followers, those in the client's zone first,
+	// everything else goes to the leader
+	if strings.Contains(info.FullMethodName, "Get") && len(p.followers) > 0 {
 		result.SubConn = p.nextFollower()
+	} else {
+		result.SubConn = p.leader
 	}
 	if result.SubConn == nil {
 		return result, balancer.ErrNoSubConnAvailable
 	}
+	result.Done = p.done
 	return result, nil
 }
 
+// done follows not-leader errors, so that writes go to the new leader before
+// the resolver catches up. Together with the retry policy set by the resolver
+// the failed call is retried against the new leader.
+func (p *Picker) done(info balancer.DoneInfo) {
+	e, ok := api.NotLeaderFromError(info.Err)
+	if !ok || e.LeaderAddr == "" {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if sc, ok := p.addrs[e.LeaderAddr]; ok {
+		p.leader = sc
+	}
+}
+
 func (p *Picker) nextFollower() balancer.SubConn {
+	followers := p.followers
+	if len(p.local) > 0 {
+		followers = p.local
+	}
 	cur := atomic.AddUint64(&p.current, uint64(1))
-	len := uint64(len(p.followers))
+	len := uint64(len(followers))
 	idx := int(cur % len)
-	return p.followers[idx]
+	return followers[idx]
 }
 
 func init() {
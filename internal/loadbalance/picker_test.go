@@ -1,8 +1,10 @@
 package loadbalance_test
 
 import (
+	"fmt"
 	"testing"
 
+	api "github.com/justagabriel/proglog/api/v1"
 	"github.com/justagabriel/proglog/internal/loadbalance"
 	"github.com/stretchr/testify/require"
 	"google.golang.org/grpc/attributes"
@@ -48,6 +50,7 @@ func setupTest() (*loadbalance.Picker, []*subConn) {
 	for i := 0; i < 3; i++ {
 		sc := &subConn{}
 		addr := resolver.Address{
+			Addr:       fmt.Sprintf("127.0.0.1:%d", 8400+i),
 			Attributes: attributes.New("is_leader", i == 0),
 		}
 		// 9th sub conn is the leader
@@ -71,3 +74,53 @@ func TestPickerCreatesToLeader(t *testing.T) {
 		require.Equal(t, subConns[0], gotPick.SubConn)
 	}
 }
+
+func TestPickerFollowsNotLeader(t *testing.T) {
+	picker, subConns := setupTest()
+	info := balancer.PickInfo{
+		FullMethodName: "/log.vX.Log/Create",
+	}
+	gotPick, err := picker.Pick(info)
+	require.NoError(t, err)
+	require.Equal(t, subConns[0], gotPick.SubConn)
+
+	gotPick.Done(balancer.DoneInfo{
+		Err: api.ErrNotLeader{LeaderAddr: "127.0.0.1:8402", Term: 2}.GRPCStatus().Err(),
+	})
+
+	gotPick, err = picker.Pick(info)
+	require.NoError(t, err)
+	require.Equal(t, subConns[2], gotPick.SubConn)
+}
+
+func TestPickerGetsPreferSameZone(t *testing.T) {
+	// arrange
+	buildInfo := base.PickerBuildInfo{
+		ReadySCs: make(map[balancer.SubConn]base.SubConnInfo),
+	}
+	var subConns []*subConn
+	for i := 0; i < 4; i++ {
+		sc := &subConn{}
+		addr := resolver.Address{
+			Addr:       fmt.Sprintf("127.0.0.1:%d", 8400+i),
+			Attributes: attributes.New("is_leader", i == 0).WithValue("same_zone", i >= 2),
+		}
+		sc.UpdateAddresses([]resolver.Address{addr})
+		buildInfo.ReadySCs[sc] = base.SubConnInfo{Address: addr}
+		subConns = append(subConns, sc)
+	}
+	picker := &loadbalance.Picker{}
+	picker.Build(buildInfo)
+	info := balancer.PickInfo{
+		FullMethodName: "/log.vX.Log/Get",
+	}
+
+	for i := 0; i < 5; i++ {
+		// act
+		gotPick, err := picker.Pick(info)
+
+		// assert
+		require.NoError(t, err)
+		require.Contains(t, []balancer.SubConn{subConns[2], subConns[3]}, gotPick.SubConn)
+	}
+}
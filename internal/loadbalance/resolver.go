@@ -2,6 +2,7 @@ package loadbalance
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"sync"
 	"time"
@@ -18,12 +19,17 @@ const (
 	Name string = "proglog"
 )
 
+var errNoLeader = errors.New("no leader found")
+
 type Resolver struct {
 	mu            sync.Mutex
 	clientConn    resolver.ClientConn
 	resolverConn  *grpc.ClientConn
 	serviceConfig *serviceconfig.ParseResult
 	logger        *zap.Logger
+	// zone of the client, set with the target's zone query parameter, e.g.
+	// proglog:///localhost:8400?zone=eu-west-1a
+	zone string
 }
 
 // Close implements resolver.Resolver.
@@ -45,6 +51,7 @@ func (r *Resolver) ResolveNow(resolver.ResolveNowOptions) {
 		resp, err := client.GetServers(ctx, &api.GetServersRequest{})
 		if err != nil {
 			r.logger.Error("failed to resolve server", zap.Error(err))
+			r.clientConn.ReportError(err)
 			return
 		}
 
@@ -55,9 +62,13 @@ func (r *Resolver) ResolveNow(resolver.ResolveNowOptions) {
 				foundLeader = true
 			}
 
+			attrs := attributes.New("is_leader", server.IsLeader)
+			if r.zone != "" {
+				attrs = attrs.WithValue("same_zone", server.Zone == r.zone)
+			}
 			addr := resolver.Address{
 				Addr:       server.RpcAddr,
-				Attributes: attributes.New("is_leader", server.IsLeader),
+				Attributes: attrs,
 			}
 			addrs = append(addrs, addr)
 		}
@@ -66,9 +77,11 @@ func (r *Resolver) ResolveNow(resolver.ResolveNowOptions) {
 			isLastRetry := (i == (retries - 1))
 			if isLastRetry {
 				r.logger.Error("no leader found, no more retries")
-			} else {
-				r.logger.Warn("no leader found")
+				// fails pending RPCs instead of leaving them waiting for a picker
+				r.clientConn.ReportError(errNoLeader)
+				return
 			}
+			r.logger.Warn("no leader found")
 			time.Sleep(time.Duration(i*300) * time.Millisecond)
 			continue
 		}
@@ -87,15 +100,31 @@ func (*Resolver) Scheme() string {
 	return Name
 }
 
-// Build implements resolver.Builder.
-func (r *Resolver) Build(target resolver.Target, cc resolver.ClientConn, opts resolver.BuildOptions) (resolver.Resolver, error) {
-	r.logger = zap.L().Named("resolver")
-	r.clientConn = cc
+// Build implements resolver.Builder. Every client connection gets its own resolver.
+func (*Resolver) Build(target resolver.Target, cc resolver.ClientConn, opts resolver.BuildOptions) (resolver.Resolver, error) {
+	r := &Resolver{
+		clientConn: cc,
+		logger:     zap.L().Named("resolver"),
+		zone:       target.URL.Query().Get("zone"),
+	}
 	var dialOpts []grpc.DialOption
 	if opts.DialCreds != nil {
 		dialOpts = append(dialOpts, grpc.WithTransportCredentials(opts.DialCreds))
 	}
-	configStr := fmt.Sprintf(`{"loadBalancingConfig":[{"%s":{}}]}`, Name)
+	// not-leader errors are returned before anything is applied, so retrying them is safe
+	configStr := fmt.Sprintf(`{
+		"loadBalancingConfig": [{"%s": {}}],
+		"methodConfig": [{
+			"name": [{"service": "log.v1.Log"}],
+			"retryPolicy": {
+				"maxAttempts": 3,
+				"initialBackoff": "0.01s",
+				"maxBackoff": "0.1s",
+				"backoffMultiplier": 2,
+				"retryableStatusCodes": ["FAILED_PRECONDITION"]
+			}
+		}]
+	}`, Name)
 	r.serviceConfig = r.clientConn.ParseServiceConfig(configStr)
 	var err error
 	r.resolverConn, err = grpc.Dial(target.Endpoint(), dialOpts...)
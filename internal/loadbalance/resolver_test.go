@@ -18,6 +18,72 @@ import (
 
 func TestResolver(t *testing.T) {
 	// arrange
+	target, opts := setupResolverTest(t, &getServers{})
+	conn := &clienConn{}
+
+	// act
+	r, err := (&Resolver{}).Build(target, conn, opts)
+
+	// assert
+	require.NoError(t, err)
+	wantState := resolver.State{
+		Addresses: []resolver.Address{
+			{Addr: "localhost:9001",
+				Attributes: attributes.New("is_leader", true),
+			}, {
+				Addr:       "localhost:9002",
+				Attributes: attributes.New("is_leader", false),
+			},
+		},
+	}
+	require.Equal(t, wantState, conn.state)
+
+	conn.state.Addresses = nil
+	r.ResolveNow(resolver.ResolveNowOptions{})
+	require.Equal(t, wantState, conn.state)
+}
+
+func TestResolverZone(t *testing.T) {
+	// arrange
+	target, opts := setupResolverTest(t, &getServers{})
+	target.URL.RawQuery = "zone=zone-b"
+	conn := &clienConn{}
+
+	// act
+	_, err := (&Resolver{}).Build(target, conn, opts)
+
+	// assert
+	require.NoError(t, err)
+	wantState := resolver.State{
+		Addresses: []resolver.Address{
+			{Addr: "localhost:9001",
+				Attributes: attributes.New("is_leader", true).WithValue("same_zone", false),
+			}, {
+				Addr:       "localhost:9002",
+				Attributes: attributes.New("is_leader", false).WithValue("same_zone", true),
+			},
+		},
+	}
+	require.Equal(t, wantState, conn.state)
+}
+
+func TestResolverNoLeader(t *testing.T) {
+	// arrange
+	target, opts := setupResolverTest(t, &getServers{withoutLeader: true})
+	conn := &clienConn{}
+
+	// act
+	_, err := (&Resolver{}).Build(target, conn, opts)
+
+	// assert
+	require.NoError(t, err)
+	require.Nil(t, conn.state.Addresses)
+	require.Equal(t, errNoLeader, conn.err)
+}
+
+func setupResolverTest(t *testing.T, getServerer server.GetServerer) (resolver.Target, resolver.BuildOptions) {
+	t.Helper()
+
 	ln, err := net.Listen("tcp", "127.0.0.1:0")
 	require.NoError(t, err)
 
@@ -32,13 +98,13 @@ func TestResolver(t *testing.T) {
 	serverCreds := credentials.NewTLS(tlsConfig)
 
 	srv, err := server.NewGRPCServer(&server.Config{
-		GetServerer: &getServers{},
+		GetServerer: getServerer,
 	}, grpc.Creds(serverCreds))
 	require.NoError(t, err)
 
 	go srv.Serve(ln)
+	t.Cleanup(srv.Stop)
 
-	conn := &clienConn{}
 	tlsConfig, err = config.SetupTLSConfig(config.TLSConfig{
 		CertFile:      config.RootClientCertFile,
 		KeyFile:       config.RootClientKeyFile,
@@ -47,47 +113,31 @@ func TestResolver(t *testing.T) {
 		Server:        false,
 	})
 	require.NoError(t, err)
-	clientCreds := credentials.NewTLS(tlsConfig)
 	opts := resolver.BuildOptions{
-		DialCreds: clientCreds,
+		DialCreds: credentials.NewTLS(tlsConfig),
 	}
-	r := &Resolver{}
 	url, err := url.Parse("dns:" + ln.Addr().String())
 	require.NoError(t, err)
-	_, err = r.Build(resolver.Target{
-		URL: *url,
-	}, conn, opts)
-	require.NoError(t, err)
-	wantState := resolver.State{
-		Addresses: []resolver.Address{
-			{Addr: "localhost:9001",
-				Attributes: attributes.New("is_leader", true),
-			}, {
-				Addr:       "localhost:9002",
-				Attributes: attributes.New("is_leader", false),
-			},
-		},
-	}
-	require.Equal(t, wantState, conn.state)
-
-	conn.state.Addresses = nil
-	r.ResolveNow(resolver.ResolveNowOptions{})
-	require.Equal(t, wantState, conn.state)
+	return resolver.Target{URL: *url}, opts
 }
 
-type getServers struct{}
+type getServers struct {
+	withoutLeader bool
+}
 
 func (s *getServers) GetServers() ([]*api.Server, error) {
 	return []*api.Server{
 		{
 			Id:       "leader",
 			RpcAddr:  "localhost:9001",
-			IsLeader: true,
+			IsLeader: !s.withoutLeader,
+			Zone:     "zone-a",
 		},
 		{
 			Id:       "follower",
 			RpcAddr:  "localhost:9002",
 			IsLeader: false,
+			Zone:     "zone-b",
 		},
 	}, nil
 }
@@ -95,6 +145,7 @@ func (s *getServers) GetServers() ([]*api.Server, error) {
 type clienConn struct {
 	resolver.ClientConn
 	state resolver.State
+	err   error
 }
 
 func (c *clienConn) UpdateState(state resolver.State) error {
@@ -103,6 +154,7 @@ func (c *clienConn) UpdateState(state resolver.State) error {
 }
 
 func (c *clienConn) ReportError(err error) {
+	c.err = err
 }
 
 func (c *clienConn) NewAddress(addrs []resolver.Address) {}
@@ -0,0 +1,96 @@
+package log
+
+import (
+	"encoding/binary"
+	"errors"
+
+	"github.com/hashicorp/raft"
+	api "github.com/justagabriel/proglog/api/v1"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// AppendAcks appends the record, acknowledging it as requested:
+// api.Acks_ACKS_QUORUM once it's committed, like Append, api.Acks_ACKS_LEADER
+// once the leader stored it in its raft log and api.Acks_ACKS_NONE once it's
+// handed to raft. The latter two return no offset, records are assigned
+// theirs when they're committed, and their failures after the acknowledgment
+// are only logged.
+func (l *DistributedLog) AppendAcks(topic string, record *api.Record, acks api.Acks) (uint64, error) {
+	if acks == api.Acks_ACKS_QUORUM {
+		return l.Append(topic, record)
+	}
+	record.Timestamp = timestamppb.Now()
+	if err := checkSize(l.config, record); err != nil {
+		return 0, err
+	}
+	if l.raft.State() != raft.Leader {
+		return 0, l.notLeader()
+	}
+	cmd, err := command(AppendRequestType, &api.CreateRecordRequest{Topic: topic, Record: record})
+	if err != nil {
+		return 0, err
+	}
+
+	var stored <-chan struct{}
+	var id []byte
+	if acks == api.Acks_ACKS_LEADER {
+		id = binary.BigEndian.AppendUint64(nil, l.acks.Add(1))
+		stored = l.logStore.awaitStored(id)
+		defer l.logStore.stored.Delete(string(id))
+	}
+	future := l.raft.ApplyLog(raft.Log{Data: cmd, Extensions: id}, applyTimeout)
+	applied := make(chan error, 1)
+	go func() {
+		err := future.Error()
+		if err == nil {
+			err, _ = future.Response().(error)
+		}
+		applied <- err
+		acked := stored == nil
+		if !acked {
+			select {
+			case <-stored:
+				acked = true
+			default:
+			}
+		}
+		if err != nil && acked {
+			zap.L().Named("log").Error(
+				"failed to append acknowledged record",
+				zap.String("topic", topic),
+				zap.Error(err),
+			)
+		}
+	}()
+
+	if stored == nil {
+		return 0, nil
+	}
+	select {
+	case <-stored:
+		return 0, nil
+	case err = <-applied:
+		if errors.Is(err, raft.ErrNotLeader) {
+			return 0, l.notLeader()
+		}
+		return 0, err
+	}
+}
+
+// awaitStored returns a channel which is closed once the entry with the
+// extensions is stored.
+func (l *logStore) awaitStored(extensions []byte) <-chan struct{} {
+	stored := make(chan struct{})
+	l.stored.Store(string(extensions), stored)
+	return stored
+}
+
+func (l *logStore) notifyStored(record *raft.Log) {
+	if len(record.Extensions) == 0 {
+		return
+	}
+	if stored, ok := l.stored.LoadAndDelete(string(record.Extensions)); ok {
+		close(stored.(chan struct{}))
+	}
+}
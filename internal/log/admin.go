@@ -0,0 +1,406 @@
+package log
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	api "github.com/justagabriel/proglog/api/v1"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	// topicConfigFile holds the config overrides of a topic, see CreateTopic.
+	topicConfigFile = "topic.json"
+	// topicDeletedFile marks a deleted topic, it holds the time the topic was
+	// deleted at, see DeleteTopic.
+	topicDeletedFile = "deleted"
+)
+
+// deletedTopic is a topic deleted within Config.TopicDeleteGracePeriod, it's
+// kept until it's undeleted or purged.
+type deletedTopic struct {
+	log *Log
+	at  time.Time
+}
+
+// withTopicConfig applies the topic's config overrides to the log config.
+func withTopicConfig(c Config, tc *api.TopicConfig) Config {
+	if tc == nil {
+		return c
+	}
+	if tc.MaxStoreBytes != 0 {
+		c.Segment.MaxStoreBytes = tc.MaxStoreBytes
+	}
+	if tc.MaxIndexBytes != 0 {
+		c.Segment.MaxIndexBytes = tc.MaxIndexBytes
+	}
+	if tc.RetentionMaxAge != nil {
+		c.Retention.MaxAge = tc.RetentionMaxAge.AsDuration()
+	}
+	if tc.RetentionMaxBytes != 0 {
+		c.Retention.MaxBytes = tc.RetentionMaxBytes
+	}
+	if tc.Compact {
+		c.Retention.Compact = true
+	}
+	if tc.KeyIndex {
+		c.KeyIndex = true
+	}
+	if tc.TombstoneRetention != nil {
+		c.Retention.TombstoneRetention = tc.TombstoneRetention.AsDuration()
+	}
+	return c
+}
+
+// logConfig returns the config of the topic's log, t.mu has to be held.
+func (t *Topics) logConfig(c Config, name string) Config {
+	return withTopicConfig(topicConfig(c, name), t.configs[name])
+}
+
+// loadTopicConfig reads the config overrides of the topic's log in dir, nil
+// if it has none.
+func loadTopicConfig(c Config, dir string) (*api.TopicConfig, error) {
+	data, err := readFile(storageOf(c), filepath.Join(dir, topicConfigFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	tc := &api.TopicConfig{}
+	return tc, protojson.Unmarshal(data, tc)
+}
+
+func saveTopicConfig(c Config, dir string, tc *api.TopicConfig) error {
+	data, err := protojson.Marshal(tc)
+	if err != nil {
+		return err
+	}
+	return writeFile(storageOf(c), filepath.Join(dir, topicConfigFile), data)
+}
+
+// CreateTopic creates the topic with the config overrides, which may be nil.
+// Topics created by their first append use the config of all topics.
+func (t *Topics) CreateTopic(topic string, tc *api.TopicConfig) (*api.TopicDescription, error) {
+	name, err := topicName(topic)
+	if err != nil {
+		return nil, err
+	}
+
+	t.mu.Lock()
+	if _, ok := t.logs[name]; ok {
+		t.mu.Unlock()
+		return nil, api.ErrTopicExists{Topic: name}
+	}
+	if _, ok := t.deleted[name]; ok {
+		t.mu.Unlock()
+		return nil, api.ErrTopicDeleted{Topic: name}
+	}
+	if tc != nil {
+		t.configs[name] = proto.Clone(tc).(*api.TopicConfig)
+	}
+	_, err = t.createLog(name, t.Config)
+	if err != nil {
+		delete(t.configs, name)
+	}
+	t.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	return t.DescribeTopic(name)
+}
+
+// DeleteTopic removes the topic's log, remote segments included. With
+// Config.TopicDeleteGracePeriod set the topic is kept for that long instead:
+// it's hidden from reads and listings, appends and CreateTopic fail with
+// api.ErrTopicDeleted, and UndeleteTopic restores it. It's removed by the
+// next purge afterwards. Appending to a removed topic creates it anew.
+func (t *Topics) DeleteTopic(topic string) error {
+	return t.deleteTopic(topic, time.Now())
+}
+
+// deleteTopic deletes the topic as of at, which replicas take from the raft
+// log so they agree on when the grace period ends.
+func (t *Topics) deleteTopic(topic string, at time.Time) error {
+	name, err := topicName(topic)
+	if err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	l, ok := t.logs[name]
+	if !ok {
+		return api.ErrTopicNotFound{Topic: name}
+	}
+	if t.Config.TopicDeleteGracePeriod == 0 {
+		delete(t.logs, name)
+		delete(t.configs, name)
+		return l.Remove()
+	}
+	if err = markDeleted(t.Config, l.Dir, at); err != nil {
+		return err
+	}
+	delete(t.logs, name)
+	t.deleted[name] = &deletedTopic{log: l, at: at}
+	return nil
+}
+
+// UndeleteTopic restores a topic deleted less than
+// Config.TopicDeleteGracePeriod ago with its records and config overrides.
+// Topics which weren't deleted or were purged already aren't found.
+func (t *Topics) UndeleteTopic(topic string) (*api.TopicDescription, error) {
+	return t.undeleteTopic(topic, time.Now())
+}
+
+func (t *Topics) undeleteTopic(topic string, at time.Time) (*api.TopicDescription, error) {
+	name, err := topicName(topic)
+	if err != nil {
+		return nil, err
+	}
+
+	t.mu.Lock()
+	d, ok := t.deleted[name]
+	if !ok || t.expired(d, at) {
+		t.mu.Unlock()
+		return nil, api.ErrTopicNotFound{Topic: name}
+	}
+	err = storageOf(t.Config).Remove(filepath.Join(d.log.Dir, topicDeletedFile))
+	if err == nil {
+		delete(t.deleted, name)
+		t.logs[name] = d.log
+		close(t.created)
+		t.created = make(chan struct{})
+	}
+	t.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	return t.DescribeTopic(name)
+}
+
+// expired reports whether the deleted topic's grace period ended by now, t.mu
+// has to be held.
+func (t *Topics) expired(d *deletedTopic, now time.Time) bool {
+	return !now.Before(d.at.Add(t.Config.TopicDeleteGracePeriod))
+}
+
+// hasExpired reports whether any deleted topic's grace period ended by now.
+func (t *Topics) hasExpired(now time.Time) bool {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	for _, d := range t.deleted {
+		if t.expired(d, now) {
+			return true
+		}
+	}
+	return false
+}
+
+// purgeDeleted removes the deleted topics whose grace period ended by now.
+// It stops once done is closed.
+func (t *Topics) purgeDeleted(done <-chan struct{}, now time.Time) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for name, d := range t.deleted {
+		select {
+		case <-done:
+			return nil
+		default:
+		}
+		if !t.expired(d, now) {
+			continue
+		}
+		delete(t.deleted, name)
+		delete(t.configs, name)
+		if err := d.log.Remove(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// startPurge purges deleted topics in the background until the topics are
+// closed. Replicated topics are purged by the raft leader instead, so all
+// replicas agree on whether a topic can be undeleted.
+func (t *Topics) startPurge() {
+	if t.Config.TopicDeleteGracePeriod == 0 || t.Config.replicated {
+		return
+	}
+	interval := t.Config.Retention.CheckInterval
+	if interval == 0 {
+		interval = defaultRetentionCheckInterval
+	}
+
+	done := make(chan struct{})
+	t.purgeDone = done
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case now := <-ticker.C:
+				if err := t.purgeDeleted(done, now); err != nil {
+					zap.L().Named("log").Error(
+						"failed to purge deleted topics",
+						zap.String("dir", t.Dir),
+						zap.Error(err),
+					)
+				}
+			}
+		}
+	}()
+}
+
+// markDeleted marks the topic's log in dir as deleted at the time.
+func markDeleted(c Config, dir string, at time.Time) error {
+	data, err := at.MarshalText()
+	if err != nil {
+		return err
+	}
+	return writeFile(storageOf(c), filepath.Join(dir, topicDeletedFile), data)
+}
+
+// loadDeleted returns the time the topic's log in dir was deleted at, ok is
+// false unless it was.
+func loadDeleted(c Config, dir string) (at time.Time, ok bool, err error) {
+	data, err := readFile(storageOf(c), filepath.Join(dir, topicDeletedFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return at, false, nil
+	}
+	if err != nil {
+		return at, false, err
+	}
+	return at, true, at.UnmarshalText(data)
+}
+
+// deletedTopics returns the times the deleted topics were deleted at.
+func (t *Topics) deletedTopics() map[string]time.Time {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	deleted := make(map[string]time.Time, len(t.deleted))
+	for name, d := range t.deleted {
+		deleted[name] = d.at
+	}
+	return deleted
+}
+
+// restoreDeleted deletes the restored topics as they were when the snapshot
+// was taken.
+func (t *Topics) restoreDeleted(deleted map[string]time.Time) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for name, at := range deleted {
+		l, ok := t.logs[name]
+		if !ok {
+			continue
+		}
+		if err := markDeleted(t.Config, l.Dir, at); err != nil {
+			return err
+		}
+		delete(t.logs, name)
+		t.deleted[name] = &deletedTopic{log: l, at: at}
+	}
+	return nil
+}
+
+// DescribeTopic returns the topic's config overrides and log stats.
+func (t *Topics) DescribeTopic(topic string) (*api.TopicDescription, error) {
+	name, err := topicName(topic)
+	if err != nil {
+		return nil, err
+	}
+
+	t.mu.RLock()
+	l, ok := t.logs[name]
+	tc := t.configs[name]
+	t.mu.RUnlock()
+	if !ok {
+		return nil, api.ErrTopicNotFound{Topic: name}
+	}
+	if tc == nil {
+		tc = &api.TopicConfig{}
+	}
+	stats, err := l.Stats()
+	if err != nil {
+		return nil, err
+	}
+	return &api.TopicDescription{Topic: name, Config: proto.Clone(tc).(*api.TopicConfig), Stats: stats}, nil
+}
+
+// ConfigureTopic replaces the topic's config overrides. Retention applies
+// right away, segment sizes to the segments created afterwards.
+func (t *Topics) ConfigureTopic(topic string, tc *api.TopicConfig) (*api.TopicDescription, error) {
+	name, err := topicName(topic)
+	if err != nil {
+		return nil, err
+	}
+
+	t.mu.Lock()
+	l, ok := t.logs[name]
+	if !ok {
+		t.mu.Unlock()
+		return nil, api.ErrTopicNotFound{Topic: name}
+	}
+	if tc == nil {
+		tc = &api.TopicConfig{}
+	}
+	tc = proto.Clone(tc).(*api.TopicConfig)
+	err = saveTopicConfig(t.Config, l.Dir, tc)
+	if err == nil {
+		t.configs[name] = tc
+		c := t.logConfig(t.Config, name)
+		l.setSegmentSizes(c.Segment.MaxStoreBytes, c.Segment.MaxIndexBytes)
+		l.SetRetention(c.Retention)
+		err = l.setKeyIndex(c.KeyIndex)
+	}
+	t.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	return t.DescribeTopic(name)
+}
+
+// topicConfigs returns the config overrides of the topics having them.
+func (t *Topics) topicConfigs() map[string]*api.TopicConfig {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	configs := make(map[string]*api.TopicConfig, len(t.configs))
+	for name, tc := range t.configs {
+		configs[name] = proto.Clone(tc).(*api.TopicConfig)
+	}
+	return configs
+}
+
+// restoreConfigs replaces the config overrides of the topics, they apply to
+// the logs created afterwards, e.g. by restoreLog.
+func (t *Topics) restoreConfigs(configs map[string]*api.TopicConfig) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.configs = configs
+}
+
+// setSegmentSizes changes the maximum sizes of the segments created
+// afterwards, zero sizes default like NewLog's.
+func (l *Log) setSegmentSizes(storeBytes, indexBytes uint64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if storeBytes == 0 {
+		storeBytes = 1024
+	}
+	if indexBytes == 0 {
+		indexBytes = 1024
+	}
+	l.Config.Segment.MaxStoreBytes = storeBytes
+	l.Config.Segment.MaxIndexBytes = indexBytes
+}
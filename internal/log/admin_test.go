@@ -0,0 +1,335 @@
+package log
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	api "github.com/justagabriel/proglog/api/v1"
+	"github.com/justagabriel/proglog/internal"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+func TestTopicAdmin(t *testing.T) {
+	scenarios := map[string]func(t *testing.T, topics *Topics){
+		"created topic uses its config":           testTopicAdminCreate,
+		"existing topic can't be created":         testTopicAdminCreateExisting,
+		"deleted topic is gone":                   testTopicAdminDelete,
+		"configuring replaces the overrides":      testTopicAdminConfigure,
+		"overrides survive a restart":             testTopicAdminReopen,
+		"overrides are kept by snapshots":         testTopicAdminSnapshot,
+		"overrides win over the retention policy": testTopicAdminSetRetention,
+	}
+
+	for scenario, fn := range scenarios {
+		t.Run(scenario, func(t *testing.T) {
+			dir := internal.GetTempDir(t, "topic-admin-test")
+			defer os.RemoveAll(dir)
+
+			topics, err := NewTopics(dir, Config{})
+			require.NoError(t, err)
+
+			fn(t, topics)
+		})
+	}
+}
+
+func testTopicAdminCreate(t *testing.T, topics *Topics) {
+	// act
+	topic, err := topics.CreateTopic("orders", &api.TopicConfig{MaxStoreBytes: 4096, RetentionMaxAge: durationpb.New(time.Hour)})
+	require.NoError(t, err)
+
+	// assert
+	require.Equal(t, "orders", topic.Topic)
+	require.Equal(t, uint64(4096), topic.Config.MaxStoreBytes)
+	require.NotNil(t, topic.Stats)
+	l, err := topics.log("orders", false)
+	require.NoError(t, err)
+	require.Equal(t, uint64(4096), l.Config.Segment.MaxStoreBytes)
+	require.Equal(t, uint64(1024), l.Config.Segment.MaxIndexBytes, "other settings are the server's")
+	require.Equal(t, time.Hour, l.Config.Retention.MaxAge)
+}
+
+func testTopicAdminCreateExisting(t *testing.T, topics *Topics) {
+	// arrange
+	_, err := topics.Append("orders", &api.Record{Value: []byte("order")})
+	require.NoError(t, err)
+
+	// act
+	_, err = topics.CreateTopic("orders", nil)
+
+	// assert
+	require.Equal(t, api.ErrTopicExists{Topic: "orders"}, err)
+}
+
+func testTopicAdminDelete(t *testing.T, topics *Topics) {
+	// arrange
+	_, err := topics.CreateTopic("orders", &api.TopicConfig{MaxStoreBytes: 4096})
+	require.NoError(t, err)
+	_, err = topics.Append("orders", &api.Record{Value: []byte("order")})
+	require.NoError(t, err)
+
+	// act
+	err = topics.DeleteTopic("orders")
+	require.NoError(t, err)
+	notFound := topics.DeleteTopic("orders")
+	_, readErr := topics.Read("orders", 0)
+
+	// assert
+	require.Equal(t, api.ErrTopicNotFound{Topic: "orders"}, notFound)
+	require.IsType(t, api.ErrOffsetOutOfRange{}, readErr)
+	require.Empty(t, topics.Names())
+	_, err = topics.Append("orders", &api.Record{Value: []byte("order")})
+	require.NoError(t, err)
+	topic, err := topics.DescribeTopic("orders")
+	require.NoError(t, err)
+	require.Zero(t, topic.Config.MaxStoreBytes, "the recreated topic has no overrides")
+}
+
+func testTopicAdminConfigure(t *testing.T, topics *Topics) {
+	// arrange
+	_, err := topics.CreateTopic("orders", &api.TopicConfig{MaxStoreBytes: 4096})
+	require.NoError(t, err)
+
+	// act
+	topic, err := topics.ConfigureTopic("orders", &api.TopicConfig{RetentionMaxBytes: 1 << 20})
+	require.NoError(t, err)
+	_, unknownErr := topics.ConfigureTopic("payments", nil)
+
+	// assert
+	require.True(t, proto.Equal(&api.TopicConfig{RetentionMaxBytes: 1 << 20}, topic.Config))
+	l, err := topics.log("orders", false)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1024), l.Config.Segment.MaxStoreBytes)
+	require.Equal(t, uint64(1<<20), l.Config.Retention.MaxBytes)
+	require.Equal(t, api.ErrTopicNotFound{Topic: "payments"}, unknownErr)
+}
+
+func testTopicAdminReopen(t *testing.T, topics *Topics) {
+	// arrange
+	_, err := topics.CreateTopic("orders", &api.TopicConfig{MaxStoreBytes: 4096})
+	require.NoError(t, err)
+	require.NoError(t, topics.Close())
+
+	// act
+	reopened, err := NewTopics(topics.Dir, topics.Config)
+	require.NoError(t, err)
+
+	// assert
+	topic, err := reopened.DescribeTopic("orders")
+	require.NoError(t, err)
+	require.Equal(t, uint64(4096), topic.Config.MaxStoreBytes)
+	l, err := reopened.log("orders", false)
+	require.NoError(t, err)
+	require.Equal(t, uint64(4096), l.Config.Segment.MaxStoreBytes)
+}
+
+func testTopicAdminSnapshot(t *testing.T, topics *Topics) {
+	// arrange
+	_, err := topics.CreateTopic("orders", &api.TopicConfig{MaxStoreBytes: 4096})
+	require.NoError(t, err)
+	_, err = topics.Append("orders", &api.Record{Value: []byte("order")})
+	require.NoError(t, err)
+	bookmarks, err := NewBookmarks(filepath.Join(topics.Dir, "bookmarks.json"))
+	require.NoError(t, err)
+	offsets, err := NewConsumerOffsets(filepath.Join(topics.Dir, "offsets.json"))
+	require.NoError(t, err)
+	snap, err := (&fsm{topics: topics, bookmarks: bookmarks, offsets: offsets}).Snapshot()
+	require.NoError(t, err)
+	sink := &testSnapshotSink{}
+	require.NoError(t, snap.Persist(sink))
+	restored, err := NewTopics(internal.GetTempDir(t, "topic-admin-test"), Config{})
+	require.NoError(t, err)
+	defer restored.Remove()
+
+	// act
+	err = (&fsm{topics: restored, bookmarks: bookmarks, offsets: offsets}).Restore(io.NopCloser(&sink.Buffer))
+
+	// assert
+	require.NoError(t, err)
+	topic, err := restored.DescribeTopic("orders")
+	require.NoError(t, err)
+	require.Equal(t, uint64(4096), topic.Config.MaxStoreBytes)
+	record, err := restored.Read("orders", 0)
+	require.NoError(t, err)
+	require.Equal(t, []byte("order"), record.Value)
+}
+
+func testTopicAdminSetRetention(t *testing.T, topics *Topics) {
+	// arrange
+	_, err := topics.CreateTopic("orders", &api.TopicConfig{RetentionMaxBytes: 1 << 20})
+	require.NoError(t, err)
+	_, err = topics.Append("payments", &api.Record{Value: []byte("payment")})
+	require.NoError(t, err)
+
+	// act
+	topics.SetRetention(RetentionPolicy{MaxBytes: 1 << 30, MaxAge: time.Hour})
+
+	// assert
+	orders, err := topics.log("orders", false)
+	require.NoError(t, err)
+	require.Equal(t, RetentionPolicy{MaxBytes: 1 << 20, MaxAge: time.Hour}, orders.Config.Retention)
+	payments, err := topics.log("payments", false)
+	require.NoError(t, err)
+	require.Equal(t, RetentionPolicy{MaxBytes: 1 << 30, MaxAge: time.Hour}, payments.Config.Retention)
+}
+
+func TestTopicSoftDelete(t *testing.T) {
+	scenarios := map[string]func(t *testing.T, topics *Topics){
+		"deleted topic is hidden":              testSoftDeleteHidden,
+		"undeleted topic keeps its records":    testSoftDeleteUndelete,
+		"deletion survives a restart":          testSoftDeleteReopen,
+		"expired topic is purged":              testSoftDeletePurge,
+		"deletions are kept by snapshots":      testSoftDeleteSnapshot,
+		"purging stops once topics are closed": testSoftDeleteClose,
+	}
+
+	for scenario, fn := range scenarios {
+		t.Run(scenario, func(t *testing.T) {
+			dir := internal.GetTempDir(t, "soft-delete-test")
+			defer os.RemoveAll(dir)
+
+			topics, err := NewTopics(dir, Config{TopicDeleteGracePeriod: time.Hour})
+			require.NoError(t, err)
+			defer topics.Close()
+
+			_, err = topics.CreateTopic("orders", &api.TopicConfig{MaxStoreBytes: 4096})
+			require.NoError(t, err)
+			_, err = topics.Append("orders", &api.Record{Value: []byte("order")})
+			require.NoError(t, err)
+
+			fn(t, topics)
+		})
+	}
+}
+
+func testSoftDeleteHidden(t *testing.T, topics *Topics) {
+	// act
+	err := topics.DeleteTopic("orders")
+	require.NoError(t, err)
+	_, readErr := topics.Read("orders", 0)
+	_, describeErr := topics.DescribeTopic("orders")
+	_, appendErr := topics.Append("orders", &api.Record{Value: []byte("order")})
+	_, createErr := topics.CreateTopic("orders", nil)
+	deleteErr := topics.DeleteTopic("orders")
+
+	// assert
+	require.IsType(t, api.ErrOffsetOutOfRange{}, readErr)
+	require.Equal(t, api.ErrTopicNotFound{Topic: "orders"}, describeErr)
+	require.Equal(t, api.ErrTopicDeleted{Topic: "orders"}, appendErr)
+	require.Equal(t, api.ErrTopicDeleted{Topic: "orders"}, createErr)
+	require.Equal(t, api.ErrTopicNotFound{Topic: "orders"}, deleteErr)
+	require.Empty(t, topics.Names())
+	require.DirExists(t, filepath.Join(topics.Dir, "orders"), "the segments are kept")
+}
+
+func testSoftDeleteUndelete(t *testing.T, topics *Topics) {
+	// arrange
+	require.NoError(t, topics.DeleteTopic("orders"))
+
+	// act
+	topic, err := topics.UndeleteTopic("orders")
+	require.NoError(t, err)
+	_, notDeletedErr := topics.UndeleteTopic("orders")
+
+	// assert
+	require.Equal(t, uint64(4096), topic.Config.MaxStoreBytes)
+	require.Equal(t, api.ErrTopicNotFound{Topic: "orders"}, notDeletedErr)
+	require.Equal(t, []string{"orders"}, topics.Names())
+	record, err := topics.Read("orders", 0)
+	require.NoError(t, err)
+	require.Equal(t, []byte("order"), record.Value)
+	_, err = topics.Append("orders", &api.Record{Value: []byte("order")})
+	require.NoError(t, err)
+}
+
+func testSoftDeleteReopen(t *testing.T, topics *Topics) {
+	// arrange
+	require.NoError(t, topics.DeleteTopic("orders"))
+	require.NoError(t, topics.Close())
+
+	// act
+	reopened, err := NewTopics(topics.Dir, topics.Config)
+	require.NoError(t, err)
+	defer reopened.Close()
+
+	// assert
+	require.Empty(t, reopened.Names())
+	_, err = reopened.UndeleteTopic("orders")
+	require.NoError(t, err)
+	record, err := reopened.Read("orders", 0)
+	require.NoError(t, err)
+	require.Equal(t, []byte("order"), record.Value)
+}
+
+func testSoftDeletePurge(t *testing.T, topics *Topics) {
+	// arrange
+	deletedAt := time.Now().Add(-2 * time.Hour)
+	require.NoError(t, topics.deleteTopic("orders", deletedAt))
+
+	// act
+	_, undeleteErr := topics.UndeleteTopic("orders")
+	expired := topics.hasExpired(time.Now())
+	err := topics.purgeDeleted(nil, time.Now())
+
+	// assert
+	require.Equal(t, api.ErrTopicNotFound{Topic: "orders"}, undeleteErr, "the grace period ended")
+	require.True(t, expired)
+	require.NoError(t, err)
+	require.NoDirExists(t, filepath.Join(topics.Dir, "orders"))
+	require.False(t, topics.hasExpired(time.Now()))
+	_, err = topics.Append("orders", &api.Record{Value: []byte("order")})
+	require.NoError(t, err)
+	topic, err := topics.DescribeTopic("orders")
+	require.NoError(t, err)
+	require.Zero(t, topic.Config.MaxStoreBytes, "the recreated topic has no overrides")
+}
+
+func testSoftDeleteSnapshot(t *testing.T, topics *Topics) {
+	// arrange
+	deletedAt := time.Now().Add(-time.Minute)
+	require.NoError(t, topics.deleteTopic("orders", deletedAt))
+	bookmarks, err := NewBookmarks(filepath.Join(topics.Dir, "bookmarks.json"))
+	require.NoError(t, err)
+	offsets, err := NewConsumerOffsets(filepath.Join(topics.Dir, "offsets.json"))
+	require.NoError(t, err)
+	snap, err := (&fsm{topics: topics, bookmarks: bookmarks, offsets: offsets}).Snapshot()
+	require.NoError(t, err)
+	sink := &testSnapshotSink{}
+	require.NoError(t, snap.Persist(sink))
+	restored, err := NewTopics(internal.GetTempDir(t, "soft-delete-test"), topics.Config)
+	require.NoError(t, err)
+	defer restored.Remove()
+
+	// act
+	err = (&fsm{topics: restored, bookmarks: bookmarks, offsets: offsets}).Restore(io.NopCloser(&sink.Buffer))
+
+	// assert
+	require.NoError(t, err)
+	require.Empty(t, restored.Names())
+	require.True(t, deletedAt.Equal(restored.deletedTopics()["orders"]))
+	topic, err := restored.undeleteTopic("orders", deletedAt.Add(time.Minute))
+	require.NoError(t, err)
+	require.Equal(t, uint64(4096), topic.Config.MaxStoreBytes)
+	record, err := restored.Read("orders", 0)
+	require.NoError(t, err)
+	require.Equal(t, []byte("order"), record.Value)
+}
+
+func testSoftDeleteClose(t *testing.T, topics *Topics) {
+	// arrange
+	require.NoError(t, topics.deleteTopic("orders", time.Now().Add(-2*time.Hour)))
+	done := make(chan struct{})
+	close(done)
+
+	// act
+	err := topics.purgeDeleted(done, time.Now())
+
+	// assert
+	require.NoError(t, err)
+	require.DirExists(t, filepath.Join(topics.Dir, "orders"))
+}
@@ -0,0 +1,119 @@
+package log
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+
+	api "github.com/justagabriel/proglog/api/v1"
+)
+
+// Bookmarks maps names to offsets and persists them in a JSON file.
+type Bookmarks struct {
+	mu      sync.RWMutex
+	path    string
+	offsets map[string]uint64
+}
+
+// NewBookmarks loads the bookmarks stored at path, the file is created on the first change.
+func NewBookmarks(path string) (*Bookmarks, error) {
+	b := &Bookmarks{
+		path:    path,
+		offsets: make(map[string]uint64),
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return b, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(data, &b.offsets); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func (b *Bookmarks) SetBookmark(name string, offset uint64) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.offsets[name] = offset
+	return b.persist()
+}
+
+func (b *Bookmarks) GetBookmark(name string) (uint64, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	offset, ok := b.offsets[name]
+	if !ok {
+		return 0, api.ErrBookmarkNotFound{Name: name}
+	}
+	return offset, nil
+}
+
+func (b *Bookmarks) DeleteBookmark(name string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.offsets[name]; !ok {
+		return api.ErrBookmarkNotFound{Name: name}
+	}
+	delete(b.offsets, name)
+	return b.persist()
+}
+
+func (b *Bookmarks) all() map[string]uint64 {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	offsets := make(map[string]uint64, len(b.offsets))
+	for name, offset := range b.offsets {
+		offsets[name] = offset
+	}
+	return offsets
+}
+
+func (b *Bookmarks) replace(offsets map[string]uint64) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.offsets = offsets
+	return b.persist()
+}
+
+// persist replaces the file atomically, b.mu has to be held for writing.
+func (b *Bookmarks) persist() error {
+	data, err := json.Marshal(b.offsets)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(b.path, data)
+}
+
+// writeFileAtomic replaces the file at path by data, readers see either the
+// old or the new content even if the process crashes in between.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,123 @@
+package log
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/hashicorp/raft"
+	api "github.com/justagabriel/proglog/api/v1"
+	"github.com/justagabriel/proglog/internal"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBookmarks(t *testing.T) {
+	scenarios := map[string]func(t *testing.T, bookmarks *Bookmarks, dir string){
+		"set and get a bookmark succeeds":         testBookmarkSetGet,
+		"unknown bookmark is not found":           testBookmarkNotFound,
+		"bookmarks survive a restart":             testBookmarksPersist,
+		"snapshot restores bookmarks and records": testBookmarksSnapshot,
+	}
+
+	for scenario, fn := range scenarios {
+		t.Run(scenario, func(t *testing.T) {
+			dir := internal.GetTempDir(t, "bookmarks-test")
+			defer os.RemoveAll(dir)
+
+			bookmarks, err := NewBookmarks(path.Join(dir, "bookmarks.json"))
+			require.NoError(t, err)
+
+			fn(t, bookmarks, dir)
+		})
+	}
+}
+
+func testBookmarkSetGet(t *testing.T, bookmarks *Bookmarks, dir string) {
+	// act
+	err := bookmarks.SetBookmark("replay", 3)
+	require.NoError(t, err)
+	err = bookmarks.SetBookmark("replay", 5)
+	require.NoError(t, err)
+	off, err := bookmarks.GetBookmark("replay")
+
+	// assert
+	require.NoError(t, err)
+	require.Equal(t, uint64(5), off)
+}
+
+func testBookmarkNotFound(t *testing.T, bookmarks *Bookmarks, dir string) {
+	// act
+	_, getErr := bookmarks.GetBookmark("replay")
+	deleteErr := bookmarks.DeleteBookmark("replay")
+
+	// assert
+	require.Equal(t, api.ErrBookmarkNotFound{Name: "replay"}, getErr)
+	require.Equal(t, api.ErrBookmarkNotFound{Name: "replay"}, deleteErr)
+}
+
+func testBookmarksPersist(t *testing.T, bookmarks *Bookmarks, dir string) {
+	// arrange
+	require.NoError(t, bookmarks.SetBookmark("replay", 3))
+	require.NoError(t, bookmarks.SetBookmark("audit", 7))
+	require.NoError(t, bookmarks.DeleteBookmark("audit"))
+
+	// act
+	reopened, err := NewBookmarks(path.Join(dir, "bookmarks.json"))
+
+	// assert
+	require.NoError(t, err)
+	off, err := reopened.GetBookmark("replay")
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), off)
+	_, err = reopened.GetBookmark("audit")
+	require.Error(t, err)
+}
+
+func testBookmarksSnapshot(t *testing.T, bookmarks *Bookmarks, dir string) {
+	// arrange
+	topics, err := NewTopics(internal.GetTempDir(t, "bookmarks-log-test"), Config{})
+	require.NoError(t, err)
+	defer topics.Remove()
+	_, err = topics.Append("", &api.Record{Value: []byte("hello world")})
+	require.NoError(t, err)
+	require.NoError(t, bookmarks.SetBookmark("replay", 0))
+
+	offsets, err := NewConsumerOffsets(path.Join(dir, "offsets.json"))
+	require.NoError(t, err)
+	source := &fsm{topics: topics, bookmarks: bookmarks, offsets: offsets}
+	snap, err := source.Snapshot()
+	require.NoError(t, err)
+	sink := &testSnapshotSink{}
+	require.NoError(t, snap.Persist(sink))
+
+	restoredTopics, err := NewTopics(internal.GetTempDir(t, "bookmarks-log-test"), Config{})
+	require.NoError(t, err)
+	defer restoredTopics.Remove()
+	restoredBookmarks, err := NewBookmarks(path.Join(dir, "restored.json"))
+	require.NoError(t, err)
+	target := &fsm{topics: restoredTopics, bookmarks: restoredBookmarks, offsets: offsets}
+
+	// act
+	err = target.Restore(io.NopCloser(&sink.Buffer))
+
+	// assert
+	require.NoError(t, err)
+	off, err := restoredBookmarks.GetBookmark("replay")
+	require.NoError(t, err)
+	require.Equal(t, uint64(0), off)
+	record, err := restoredTopics.Read("", 0)
+	require.NoError(t, err)
+	require.Equal(t, []byte("hello world"), record.Value)
+}
+
+type testSnapshotSink struct {
+	bytes.Buffer
+}
+
+func (s *testSnapshotSink) ID() string    { return "test" }
+func (s *testSnapshotSink) Cancel() error { return nil }
+func (s *testSnapshotSink) Close() error  { return nil }
+
+var _ raft.SnapshotSink = (*testSnapshotSink)(nil)
@@ -0,0 +1,89 @@
+package log
+
+import (
+	"container/list"
+	"sync"
+
+	api "github.com/justagabriel/proglog/api/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// recordCache keeps the most recently appended and read records of a log up
+// to a total encoded size, so consumers close to the end of the log are served
+// from memory. Records are copied in and out, callers may modify them.
+// A nil cache caches nothing.
+type recordCache struct {
+	mu       sync.Mutex
+	maxBytes uint64
+	size     uint64
+	// lru holds the records, the most recently used first
+	lru     *list.List
+	records map[uint64]*list.Element
+}
+
+func newRecordCache(maxBytes uint64) *recordCache {
+	if maxBytes == 0 {
+		return nil
+	}
+	return &recordCache{
+		maxBytes: maxBytes,
+		lru:      list.New(),
+		records:  make(map[uint64]*list.Element),
+	}
+}
+
+func (c *recordCache) get(off uint64) (*api.Record, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.records[off]
+	if !ok {
+		return nil, false
+	}
+	c.lru.MoveToFront(e)
+	return proto.Clone(e.Value.(*api.Record)).(*api.Record), true
+}
+
+func (c *recordCache) add(record *api.Record) {
+	if c == nil {
+		return
+	}
+	size := uint64(proto.Size(record))
+	if size > c.maxBytes {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.records[record.Offset]; ok {
+		c.remove(e)
+	}
+	c.records[record.Offset] = c.lru.PushFront(proto.Clone(record))
+	c.size += size
+	for c.size > c.maxBytes {
+		c.remove(c.lru.Back())
+	}
+}
+
+// remove drops the element, c.mu has to be held.
+func (c *recordCache) remove(e *list.Element) {
+	record := c.lru.Remove(e).(*api.Record)
+	delete(c.records, record.Offset)
+	c.size -= uint64(proto.Size(record))
+}
+
+// reset drops all records, e.g. once records were removed from the log.
+func (c *recordCache) reset() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.lru.Init()
+	c.records = make(map[uint64]*list.Element)
+	c.size = 0
+}
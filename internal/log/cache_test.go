@@ -0,0 +1,87 @@
+package log
+
+import (
+	"os"
+	"testing"
+
+	api "github.com/justagabriel/proglog/api/v1"
+	"github.com/justagabriel/proglog/internal"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestRecordCache(t *testing.T) {
+	// arrange
+	record := func(off uint64) *api.Record {
+		return &api.Record{Value: []byte("hello world"), Offset: off}
+	}
+	size := uint64(proto.Size(record(1)))
+	cache := newRecordCache(2 * size)
+	cache.add(record(1))
+	cache.add(record(2))
+
+	// act
+	got, ok := cache.get(1)
+	cache.add(record(3))
+
+	// assert
+	require.True(t, ok)
+	require.Equal(t, uint64(1), got.Offset)
+	_, ok = cache.get(2)
+	require.False(t, ok, "the least recently used record is evicted")
+	_, ok = cache.get(3)
+	require.True(t, ok)
+
+	// act
+	got.Value = []byte("modified")
+	again, ok := cache.get(1)
+
+	// assert
+	require.True(t, ok)
+	require.Equal(t, []byte("hello world"), again.Value, "cached records are copies")
+
+	// act
+	cache.reset()
+
+	// assert
+	_, ok = cache.get(1)
+	require.False(t, ok)
+	require.Zero(t, cache.size)
+	_, ok = newRecordCache(0).get(1)
+	require.False(t, ok, "a disabled cache caches nothing")
+}
+
+func TestLogCache(t *testing.T) {
+	// arrange
+	dir := internal.GetTempDir(t, "cache-test")
+	defer os.RemoveAll(dir)
+	c := Config{}
+	c.CacheBytes = 1024
+	c.Segment.MaxStoreBytes = 64
+	c.Retention.Compact = true
+	log, err := NewLog(dir, c)
+	require.NoError(t, err)
+	defer log.Close()
+	for _, value := range []string{"old", "other", "new"} {
+		key := "key"
+		if value == "other" {
+			key = "other"
+		}
+		_, err = log.Append(&api.Record{Key: []byte(key), Value: []byte(value)})
+		require.NoError(t, err)
+	}
+	for off := uint64(0); off < 3; off++ {
+		_, err = log.Read(off)
+		require.NoError(t, err)
+	}
+
+	// act
+	require.NoError(t, log.compact(make(chan struct{})))
+
+	// assert
+	_, err = log.Read(0)
+	require.Equal(t, api.ErrOffsetOutOfRange{Offset: 0, HighestOffset: 2}, err, "compacted records aren't served from the cache")
+	record, err := log.Read(2)
+	require.NoError(t, err)
+	require.Equal(t, []byte("new"), record.Value)
+}
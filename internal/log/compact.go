@@ -0,0 +1,183 @@
+package log
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	api "github.com/justagabriel/proglog/api/v1"
+)
+
+// compactDir is where segments are rewritten before they replace the originals.
+const compactDir = ".compact"
+
+// compact rewrites the inactive segments keeping only the latest record per key,
+// records without key are kept unless they expired. Hidden records, e.g.
+// aborted ones, don't replace the latest record of their key, expired ones do
+// and are removed along with it. Tombstones are removed once they're older
+// than RetentionPolicy.TombstoneRetention. Offsets don't change, so compacted
+// segments have gaps. done guards against running on a log closed meanwhile.
+func (l *Log) compact(done <-chan struct{}) error {
+	return l.compactRun(done, nil)
+}
+
+// compactRun compacts the log, reporting its progress to the run.
+func (l *Log) compactRun(done <-chan struct{}, run *maintenanceRun) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	select {
+	case <-done:
+		return nil
+	default:
+	}
+
+	latest := make(map[string]uint64)
+	for _, s := range l.segments {
+		err := s.scan(func(record *api.Record) error {
+			if len(record.Key) != 0 && !l.hidden(record.Transaction, record.Marker) {
+				latest[string(record.Key)] = record.Offset
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	// records compacted away mustn't be served from the cache
+	defer l.cache.reset()
+	defer l.publish()
+	run.start(len(l.segments) - 1)
+	segments := make([]*segment, 0, len(l.segments))
+	for i, s := range l.segments {
+		if s == l.activeSegment {
+			segments = append(segments, s)
+			continue
+		}
+		size := s.store.size
+		compacted, err := l.compactSegment(s, latest)
+		if err != nil {
+			l.segments = append(segments, l.segments[i:]...)
+			return err
+		}
+		if compacted != nil {
+			segments = append(segments, compacted)
+			size -= compacted.store.size
+		}
+		run.processed(size)
+	}
+	l.segments = segments
+	return nil
+}
+
+// compactSegment returns the rewritten segment, nil if no record was left.
+func (l *Log) compactSegment(s *segment, latest map[string]uint64) (*segment, error) {
+	var kept []*api.Record
+	total := 0
+	now := time.Now()
+	err := s.scan(func(record *api.Record) error {
+		total++
+		if expired(record, now) || l.tombstoneExpired(record, now) {
+			return nil
+		}
+		if len(record.Key) == 0 || latest[string(record.Key)] == record.Offset {
+			kept = append(kept, record)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	switch len(kept) {
+	case total:
+		return s, nil
+	case 0:
+		return nil, l.removeSegment(s)
+	}
+	return l.rewriteSegment(s, kept)
+}
+
+// tombstoneExpired tells whether compaction removes the tombstone, tombstones
+// are kept if RetentionPolicy.TombstoneRetention is zero.
+func (l *Log) tombstoneExpired(record *api.Record, now time.Time) bool {
+	retention := l.Config.Retention.TombstoneRetention
+	if !record.Tombstone || retention == 0 || record.Timestamp == nil {
+		return false
+	}
+	return !now.Before(record.Timestamp.AsTime().Add(retention))
+}
+
+// rewriteSegment replaces the segment by one holding the records only.
+func (l *Log) rewriteSegment(s *segment, records []*api.Record) (*segment, error) {
+	dir := filepath.Join(l.Dir, compactDir)
+	storage := storageOf(l.Config)
+	if err := storage.RemoveAll(dir); err != nil {
+		return nil, err
+	}
+	if err := storage.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	rewritten, err := newSegment(dir, s.baseOffset, s.config)
+	if err != nil {
+		return nil, err
+	}
+	for _, record := range records {
+		if err = rewritten.write(record); err != nil {
+			return nil, err
+		}
+	}
+	if err = rewritten.Close(); err != nil {
+		return nil, err
+	}
+
+	if err = s.Close(); err != nil {
+		return nil, err
+	}
+	// the store is swapped first, see recoverCompaction for crashes in between
+	if err = storage.Rename(rewritten.store.Name(), s.store.Name()); err != nil {
+		return nil, err
+	}
+	if err = storage.Rename(rewritten.index.Name(), s.index.Name()); err != nil {
+		return nil, err
+	}
+	if err = storage.Remove(dir); err != nil {
+		return nil, err
+	}
+	return openSegment(l.Dir, s.baseOffset, s.config, true)
+}
+
+// recoverCompaction finishes or rolls back a segment rewrite interrupted by a
+// crash. As long as the rewritten store is left, the original segment is
+// intact and the rewrite is dropped. Once it's swapped, only the rewritten
+// index is left to swap.
+func (l *Log) recoverCompaction() error {
+	storage := storageOf(l.Config)
+	dir := filepath.Join(l.Dir, compactDir)
+	files, err := storage.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	stores := make(map[string]bool)
+	for _, file := range files {
+		if filepath.Ext(file.Name()) == ".store" {
+			stores[strings.TrimSuffix(file.Name(), ".store")] = true
+		}
+	}
+	for _, file := range files {
+		name := file.Name()
+		if filepath.Ext(name) != ".index" || stores[strings.TrimSuffix(name, ".index")] {
+			continue
+		}
+		if err = storage.Rename(filepath.Join(dir, name), filepath.Join(l.Dir, name)); err != nil {
+			return err
+		}
+	}
+	return storage.RemoveAll(dir)
+}
@@ -0,0 +1,308 @@
+package log
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	api "github.com/justagabriel/proglog/api/v1"
+	"github.com/justagabriel/proglog/internal"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestCompact(t *testing.T) {
+	scenarios := map[string]func(t *testing.T, log *Log){
+		"latest record per key is kept":          testCompactLatest,
+		"compacted log survives a restart":       testCompactReopen,
+		"segments without records are removed":   testCompactRemovesEmpty,
+		"records in the active segment are kept": testCompactKeepsActive,
+		"restored snapshot keeps the gaps":       testCompactRestore,
+		"interrupted swaps are finished":         testCompactRecoverSwap,
+		"interrupted rewrites are dropped":       testCompactRecoverRewrite,
+	}
+
+	config := Config{}
+	config.Segment.MaxStoreBytes = 96
+
+	for scenario, fn := range scenarios {
+		t.Run(scenario, func(t *testing.T) {
+			dir := internal.GetTempDir(t, "compact-test")
+			defer os.RemoveAll(dir)
+
+			log, err := NewLog(dir, config)
+			require.NoError(t, err)
+			defer log.Close()
+
+			fn(t, log)
+		})
+	}
+}
+
+func appendKeyed(t *testing.T, log *Log, key, value string) uint64 {
+	t.Helper()
+	record := &api.Record{Value: []byte(value)}
+	if key != "" {
+		record.Key = []byte(key)
+	}
+	off, err := log.Append(record)
+	require.NoError(t, err)
+	return off
+}
+
+func testCompactLatest(t *testing.T, log *Log) {
+	// arrange
+	appendKeyed(t, log, "a", "a1")
+	appendKeyed(t, log, "b", "b1")
+	appendKeyed(t, log, "", "no key")
+	appendKeyed(t, log, "a", "a2")
+	for len(log.segments) < 3 {
+		appendKeyed(t, log, "c", "filler")
+	}
+
+	// act
+	err := log.compact(nil)
+
+	// assert
+	require.NoError(t, err)
+	_, err = log.Read(0)
+	require.Equal(t, api.ErrOffsetOutOfRange{Offset: 0, HighestOffset: 5}, err)
+	for off, want := range map[uint64]string{1: "b1", 2: "no key", 3: "a2"} {
+		record, err := log.Read(off)
+		require.NoError(t, err)
+		require.Equal(t, want, string(record.Value))
+		require.Equal(t, off, record.Offset)
+	}
+}
+
+func testCompactReopen(t *testing.T, log *Log) {
+	// arrange
+	appendKeyed(t, log, "a", "a1")
+	appendKeyed(t, log, "b", "b1")
+	appendKeyed(t, log, "a", "a2")
+	for len(log.segments) < 3 {
+		appendKeyed(t, log, "c", "filler")
+	}
+	require.NoError(t, log.compact(nil))
+	require.NoError(t, log.Close())
+
+	// act
+	reopened, err := NewLog(log.Dir, log.Config)
+	require.NoError(t, err)
+	defer reopened.Close()
+
+	// assert
+	_, err = reopened.Read(0)
+	require.Equal(t, api.ErrOffsetOutOfRange{Offset: 0, HighestOffset: 5}, err)
+	record, err := reopened.Read(1)
+	require.NoError(t, err)
+	require.Equal(t, "b1", string(record.Value))
+	off := appendKeyed(t, reopened, "a", "a3")
+	require.Equal(t, log.activeSegment.nextOffset, off)
+}
+
+func testCompactRecoverSwap(t *testing.T, log *Log) {
+	// arrange
+	appendKeyed(t, log, "a", "a1")
+	appendKeyed(t, log, "b", "b1")
+	appendKeyed(t, log, "a", "a2")
+	for len(log.segments) < 3 {
+		appendKeyed(t, log, "c", "filler")
+	}
+	require.NoError(t, log.Close())
+	index := filepath.Join(log.Dir, "0.index")
+	original, err := os.ReadFile(index)
+	require.NoError(t, err)
+	compacted, err := NewLog(log.Dir, log.Config)
+	require.NoError(t, err)
+	require.NoError(t, compacted.compact(nil))
+	require.NoError(t, compacted.Close())
+	// a crash after swapping the store leaves the rewritten index behind
+	require.NoError(t, os.Mkdir(filepath.Join(log.Dir, compactDir), 0755))
+	require.NoError(t, os.Rename(index, filepath.Join(log.Dir, compactDir, "0.index")))
+	require.NoError(t, os.WriteFile(index, original, 0644))
+
+	// act
+	reopened, err := NewLog(log.Dir, log.Config)
+
+	// assert
+	require.NoError(t, err)
+	defer reopened.Close()
+	_, err = reopened.Read(0)
+	require.IsType(t, api.ErrOffsetOutOfRange{}, err)
+	for off, want := range map[uint64]string{1: "b1", 2: "a2"} {
+		record, err := reopened.Read(off)
+		require.NoError(t, err)
+		require.Equal(t, want, string(record.Value))
+	}
+	_, err = os.Stat(filepath.Join(log.Dir, compactDir))
+	require.True(t, os.IsNotExist(err))
+}
+
+func testCompactRecoverRewrite(t *testing.T, log *Log) {
+	// arrange
+	appendKeyed(t, log, "a", "a1")
+	appendKeyed(t, log, "b", "b1")
+	for len(log.segments) < 3 {
+		appendKeyed(t, log, "c", "filler")
+	}
+	require.NoError(t, log.Close())
+	// a crash while rewriting leaves a partial segment behind
+	dir := filepath.Join(log.Dir, compactDir)
+	require.NoError(t, os.Mkdir(dir, 0755))
+	for _, ext := range []string{".store", ".index"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "0"+ext), []byte("partial"), 0644))
+	}
+
+	// act
+	reopened, err := NewLog(log.Dir, log.Config)
+
+	// assert
+	require.NoError(t, err)
+	defer reopened.Close()
+	for off, want := range map[uint64]string{0: "a1", 1: "b1"} {
+		record, err := reopened.Read(off)
+		require.NoError(t, err)
+		require.Equal(t, want, string(record.Value))
+	}
+	_, err = os.Stat(dir)
+	require.True(t, os.IsNotExist(err))
+}
+
+func testCompactRemovesEmpty(t *testing.T, log *Log) {
+	// arrange
+	for len(log.segments) < 3 {
+		appendKeyed(t, log, "a", "same key")
+	}
+	segments := len(log.segments)
+
+	// act
+	err := log.compact(nil)
+
+	// assert
+	require.NoError(t, err)
+	require.Less(t, len(log.segments), segments)
+	lowest, err := log.LowestOffset()
+	require.NoError(t, err)
+	require.NotZero(t, lowest)
+}
+
+func testCompactKeepsActive(t *testing.T, log *Log) {
+	// arrange
+	first := appendKeyed(t, log, "a", "a1")
+	second := appendKeyed(t, log, "a", "a2")
+
+	// act
+	err := log.compact(nil)
+
+	// assert
+	require.NoError(t, err)
+	for _, off := range []uint64{first, second} {
+		_, err = log.Read(off)
+		require.NoError(t, err)
+	}
+}
+
+func testCompactRestore(t *testing.T, log *Log) {
+	// arrange
+	appendKeyed(t, log, "a", "a1")
+	appendKeyed(t, log, "b", "b1")
+	appendKeyed(t, log, "a", "a2")
+	for len(log.segments) < 3 {
+		appendKeyed(t, log, "c", "filler")
+	}
+	require.NoError(t, log.compact(nil))
+	var snapshot bytes.Buffer
+	require.NoError(t, log.Snapshot(&snapshot))
+
+	dir := internal.GetTempDir(t, "compact-restore-test")
+	defer os.RemoveAll(dir)
+	restored, err := NewLog(dir, log.Config)
+	require.NoError(t, err)
+	defer restored.Close()
+
+	// act
+	err = restored.Restore(&snapshot)
+
+	// assert
+	require.NoError(t, err)
+	_, err = restored.Read(0)
+	require.Equal(t, api.ErrOffsetOutOfRange{Offset: 0, LogStartOffset: 1, HighestOffset: 5}, err)
+	for off, want := range map[uint64]string{1: "b1", 2: "a2"} {
+		record, err := restored.Read(off)
+		require.NoError(t, err)
+		require.Equal(t, want, string(record.Value))
+	}
+}
+
+// appendTombstone appends a tombstone for the key appended age ago.
+func appendTombstone(t *testing.T, log *Log, key string, age time.Duration) uint64 {
+	t.Helper()
+	off, err := log.Append(&api.Record{
+		Key:       []byte(key),
+		Tombstone: true,
+		Timestamp: timestamppb.New(time.Now().Add(-age)),
+	})
+	require.NoError(t, err)
+	return off
+}
+
+func TestCompactTombstones(t *testing.T) {
+	scenarios := map[string]struct {
+		retention time.Duration
+		age       time.Duration
+		kept      bool
+	}{
+		"tombstones are kept by default":         {retention: 0, age: time.Hour, kept: true},
+		"recent tombstones are kept":             {retention: time.Hour, age: time.Minute, kept: true},
+		"tombstones are removed after retention": {retention: time.Hour, age: 2 * time.Hour, kept: false},
+	}
+
+	for scenario, s := range scenarios {
+		t.Run(scenario, func(t *testing.T) {
+			// arrange
+			dir := internal.GetTempDir(t, "compact-test")
+			defer os.RemoveAll(dir)
+			config := Config{}
+			config.Segment.MaxStoreBytes = 96
+			config.Retention.TombstoneRetention = s.retention
+			// the records keep their timestamps, see appendTombstone
+			config.replicated = true
+			log, err := NewLog(dir, config)
+			require.NoError(t, err)
+			defer log.Close()
+
+			// timestamps don't decrease, so the old records are appended first
+			deleted, err := log.Append(&api.Record{
+				Key:       []byte("a"),
+				Value:     []byte("a1"),
+				Timestamp: timestamppb.New(time.Now().Add(-s.age)),
+			})
+			require.NoError(t, err)
+			tombstone := appendTombstone(t, log, "a", s.age)
+			kept := appendKeyed(t, log, "b", "b1")
+			for len(log.segments) < 3 {
+				appendKeyed(t, log, "c", "filler")
+			}
+
+			// act
+			err = log.compact(nil)
+
+			// assert
+			require.NoError(t, err)
+			_, err = log.Read(deleted)
+			require.IsType(t, api.ErrOffsetOutOfRange{}, err, "the key's earlier records are removed")
+			_, err = log.Read(kept)
+			require.NoError(t, err)
+			record, err := log.Read(tombstone)
+			if !s.kept {
+				require.IsType(t, api.ErrOffsetOutOfRange{}, err)
+				return
+			}
+			require.NoError(t, err)
+			require.True(t, record.Tombstone)
+		})
+	}
+}
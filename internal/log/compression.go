@@ -0,0 +1,105 @@
+package log
+
+import (
+	"bytes"
+	"compress/flate"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Compression selects how records are compressed in the store.
+type Compression uint8
+
+const (
+	// CompressionNone stores records as they are.
+	CompressionNone Compression = iota
+	// CompressionFlate compresses records with DEFLATE.
+	CompressionFlate
+)
+
+var compressionNames = map[Compression]string{
+	CompressionNone:  "none",
+	CompressionFlate: "flate",
+}
+
+func (c Compression) String() string {
+	if name, ok := compressionNames[c]; ok {
+		return name
+	}
+	return fmt.Sprintf("Compression(%d)", c)
+}
+
+// ParseCompression returns the compression of the given name, see Compression.String.
+func ParseCompression(name string) (Compression, error) {
+	for c, n := range compressionNames {
+		if n == name {
+			return c, nil
+		}
+	}
+	return CompressionNone, fmt.Errorf("unknown compression %q", name)
+}
+
+const (
+	// codecShift is the position of the record's compression in its length,
+	// the 7 bits below crcFlag hold it.
+	codecShift        = 56
+	codecMask  uint64 = 0x7f << codecShift
+)
+
+// compressor compresses records, it's not safe for concurrent use.
+type compressor struct {
+	buf bytes.Buffer
+	w   *flate.Writer
+}
+
+// compress returns the compressed record, ok is false if it doesn't get any smaller.
+// The returned slice is only valid until the next call.
+func (c *compressor) compress(p []byte) (compressed []byte, ok bool, err error) {
+	c.buf.Reset()
+	if c.w == nil {
+		c.w, err = flate.NewWriter(&c.buf, flate.DefaultCompression)
+		if err != nil {
+			return nil, false, err
+		}
+	} else {
+		c.w.Reset(&c.buf)
+	}
+
+	if _, err = c.w.Write(p); err != nil {
+		return nil, false, err
+	}
+	if err = c.w.Close(); err != nil {
+		return nil, false, err
+	}
+	if c.buf.Len() >= len(p) {
+		return nil, false, nil
+	}
+	return c.buf.Bytes(), true, nil
+}
+
+var flateReaders sync.Pool
+
+// decompress replaces the record following start in b by its decompressed form.
+func decompress(codec Compression, b *bytes.Buffer, start int) error {
+	if codec != CompressionFlate {
+		return fmt.Errorf("unknown compression %d", codec)
+	}
+
+	compressed := bytes.NewReader(append([]byte(nil), b.Bytes()[start:]...))
+	b.Truncate(start)
+	r, ok := flateReaders.Get().(io.ReadCloser)
+	if ok {
+		if err := r.(flate.Resetter).Reset(compressed, nil); err != nil {
+			return err
+		}
+	} else {
+		r = flate.NewReader(compressed)
+	}
+	defer flateReaders.Put(r)
+
+	if _, err := io.Copy(b, r); err != nil {
+		return errCorruptRecord
+	}
+	return nil
+}
@@ -1,6 +1,10 @@
 package log
 
-import "github.com/hashicorp/raft"
+import (
+	"time"
+
+	"github.com/hashicorp/raft"
+)
 
 type Config struct {
 	Raft struct {
@@ -8,10 +12,120 @@ type Config struct {
 		BindAddr    string
 		StreamLayer *StreamLayer
 		Bootstrap   bool
+		// Zone is the availability zone or rack of this server.
+		Zone string
+		// SnapshotRetain is the number of snapshots kept on disk, defaults to
+		// one. The snapshot interval and threshold and the trailing logs
+		// kept after a snapshot are set in the embedded raft.Config.
+		SnapshotRetain int
+		// MaxVoters caps the servers taking part in elections and commits,
+		// the others replicate the log as non-voters. Voters are spread
+		// across zones, see JoinZone. Zero makes every server a voter.
+		MaxVoters int
 	}
 	Segment struct {
 		MaxStoreBytes uint64
 		MaxIndexBytes uint64
+		// MaxAge rolls the active segment once its first record is older, so
+		// retention and tiering free the records of quiet logs as well. Idle
+		// logs are rolled every Retention.CheckInterval if retention or tiering
+		// is enabled. Zero rolls segments by size only.
+		MaxAge        time.Duration
 		InitialOffset uint64
+		// Preallocate creates the next segment's files in the background, so
+		// rolling renames them instead of creating them and growing the index
+		// on the append path.
+		Preallocate bool
+		// Recycle keeps the files of a segment removed by retention, Truncate,
+		// DeleteBefore or compaction for the next segment, unless there are
+		// spare files already.
+		Recycle bool
+		// IndexInterval indexes every Nth record only, reads scan the store
+		// from the closest indexed record. Zero and one index all records.
+		IndexInterval uint64
+		// IndexAccess selects whether index files are mapped into memory or
+		// read and written at their entries' positions, see IndexAccess.
+		IndexAccess IndexAccess
+		// ReadAheadBytes reads this much of a store at once, so sequential
+		// reads are served from memory. Each store keeps one such buffer once
+		// read from, zero reads each record on its own.
+		ReadAheadBytes uint64
+		// SyncPolicy controls when appended records are synced to disk.
+		SyncPolicy SyncPolicy
+		// Compression compresses records which get smaller by it.
+		Compression Compression
+		// Encryption encrypts the records in the stores with AES-GCM if set.
+		// Indexes hold offsets and positions only and aren't encrypted.
+		Encryption KeyProvider
+		// Storage holds the log's files, defaults to the OS' files.
+		Storage Storage
+	}
+	// MaxRecordBytes rejects records whose encoded size exceeds it with
+	// api.ErrRecordTooLarge, zero disables the limit.
+	MaxRecordBytes uint64
+	// CacheBytes keeps the most recently appended and read records of the log
+	// in memory up to this encoded size, zero disables the cache.
+	CacheBytes uint64
+	// KeyIndex keeps the offset of the latest record per key in memory, so
+	// ReadByKey finds records without scanning the log. It's rebuilt from
+	// the local segments when the log is opened.
+	KeyIndex bool
+	// TenantQuotas caps the bytes the records of a tenant's topics take up,
+	// including tiered segments, by tenant. The tenant of a topic is the part
+	// of its name before api.TenantSeparator. Appends are rejected with
+	// api.ErrQuotaExceeded once the quota is reached, so the last append may
+	// exceed it. Tenants without quota aren't limited.
+	TenantQuotas map[string]uint64
+	// TopicDeleteGracePeriod keeps deleted topics this long before their
+	// segments are removed, so they can be undeleted, see Topics.DeleteTopic.
+	// Zero removes them right away.
+	TopicDeleteGracePeriod time.Duration
+	// IdempotencyKeyTTL is how long a log remembers the producers made up
+	// for idempotency keys, see api.IdempotencyKeyProducer, measured by the
+	// timestamps of its records. Defaults to a day.
+	IdempotencyKeyTTL time.Duration
+	// Retention removes old segments, see RetentionPolicy.
+	Retention RetentionPolicy
+	// Faults injects failures for tests, nil injects none.
+	Faults *Faults
+	// Tiering moves inactive segments to an object store, reads of their
+	// records fetch them back. Retention removes remote segments as well,
+	// compaction only rewrites local ones. Nil Store disables tiering.
+	Tiering struct {
+		Store ObjectStore
+		// OffloadAfter moves segments which weren't written to for longer,
+		// they're checked every Retention.CheckInterval.
+		OffloadAfter time.Duration
+		// Prefix is prepended to the names of the log's objects.
+		Prefix string
 	}
+	// replicated keeps the timestamps records are appended with, which the
+	// raft leader assigned. Other logs stamp records with the time they're
+	// appended, so writers can't date them.
+	replicated bool
+}
+
+// RetentionPolicy removes old segments, a zero value for a field disables
+// that particular limit. The active segment is never removed.
+type RetentionPolicy struct {
+	// MaxAge removes segments which weren't written to for longer.
+	MaxAge time.Duration
+	// MaxBytes caps the size of the log's stores.
+	MaxBytes uint64
+	// Compact rewrites inactive segments keeping only the latest record per key.
+	Compact bool
+	// TombstoneRetention is how long compaction keeps tombstones, zero keeps
+	// them.
+	TombstoneRetention time.Duration
+	// CheckInterval defaults to a minute.
+	CheckInterval time.Duration
+}
+
+// SyncPolicy controls when appends are synced to stable storage. Both fields
+// may be combined, the zero value leaves syncing to closing the log and the OS.
+type SyncPolicy struct {
+	// EveryWrites syncs after this many appends, 1 syncs on each append.
+	EveryWrites uint64
+	// Interval syncs at most this long after an append.
+	Interval time.Duration
 }
@@ -0,0 +1,114 @@
+package log
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// startFile holds the log start offset set by DeleteBefore.
+const startFile = "start.json"
+
+// DeleteBefore deletes the records below the offset, which becomes the log
+// start offset. Segments holding only such records are removed, the others
+// keep them unreadable until they're removed themselves. The log start offset
+// never decreases, the current one is returned.
+func (l *Log) DeleteBefore(off uint64) (uint64, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	start := l.logStart()
+	if off > l.activeSegment.nextOffset {
+		return 0, l.outOfRange(off)
+	}
+	if off <= start {
+		return start, nil
+	}
+
+	data, err := json.Marshal(off)
+	if err != nil {
+		return 0, err
+	}
+	if err = writeFile(storageOf(l.Config), filepath.Join(l.Dir, startFile), data); err != nil {
+		return 0, err
+	}
+	l.start = off
+	defer l.notify()
+	defer l.publish()
+
+	n := 0
+	for n < len(l.remote) && l.remote[n].NextOffset <= off {
+		n++
+	}
+	if err = l.dropRemote(n); err != nil {
+		return 0, err
+	}
+	var segments []*segment
+	for _, s := range l.segments {
+		if s != l.activeSegment && s.nextOffset <= off {
+			if err = l.removeSegment(s); err != nil {
+				return 0, err
+			}
+			continue
+		}
+		segments = append(segments, s)
+	}
+	l.segments = segments
+	return off, nil
+}
+
+// loadStart reads the log start offset set by DeleteBefore.
+func (l *Log) loadStart() error {
+	l.start = 0
+	data, err := readFile(storageOf(l.Config), filepath.Join(l.Dir, startFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, &l.start)
+}
+
+// logStart returns the lowest offset which may be read, l.mu has to be held.
+func (l *Log) logStart() uint64 {
+	base := l.segments[0].baseOffset
+	if len(l.remote) > 0 {
+		base = l.remote[0].BaseOffset
+	}
+	if l.start > base {
+		return l.start
+	}
+	return base
+}
+
+// deletedBytes returns the size of the deleted records at the start of the
+// first store, which snapshots leave out. l.mu has to be held.
+func (l *Log) deletedBytes() (uint64, error) {
+	if len(l.remote) > 0 {
+		if l.start <= l.remote[0].BaseOffset {
+			return 0, nil
+		}
+		l.fetchMu.Lock()
+		defer l.fetchMu.Unlock()
+		s, err := l.fetch(l.remote[0].BaseOffset)
+		if err != nil {
+			return 0, err
+		}
+		return s.position(l.start)
+	}
+	if l.start <= l.segments[0].baseOffset {
+		return 0, nil
+	}
+	return l.segments[0].position(l.start)
+}
+
+// errReader fails every read.
+type errReader struct {
+	err error
+}
+
+func (r errReader) Read([]byte) (int, error) {
+	return 0, r.err
+}
@@ -0,0 +1,134 @@
+package log
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	api "github.com/justagabriel/proglog/api/v1"
+	"github.com/justagabriel/proglog/internal"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeleteBefore(t *testing.T) {
+	scenarios := map[string]func(t *testing.T, log *Log){
+		"deleted records are out of range":         testDeleteBeforeRead,
+		"log start offset survives reopening":      testDeleteBeforeReopen,
+		"snapshot leaves deleted records out":      testDeleteBeforeSnapshot,
+		"log start offset never decreases":         testDeleteBeforeMonotonic,
+		"offsets past the next offset are invalid": testDeleteBeforeTooHigh,
+	}
+
+	for scenario, fn := range scenarios {
+		t.Run(scenario, func(t *testing.T) {
+			dir := internal.GetTempDir(t, "delete-test")
+			defer os.RemoveAll(dir)
+
+			config := Config{}
+			config.Segment.MaxStoreBytes = 64
+			log, err := NewLog(dir, config)
+			require.NoError(t, err)
+			defer log.Close()
+			for i := 0; i < 6; i++ {
+				_, err = log.Append(&api.Record{Value: []byte("hello world")})
+				require.NoError(t, err)
+			}
+			require.Greater(t, len(log.segments), 2)
+
+			fn(t, log)
+		})
+	}
+}
+
+func testDeleteBeforeRead(t *testing.T, log *Log) {
+	// arrange
+	segments := len(log.segments)
+
+	// act
+	start, err := log.DeleteBefore(3)
+
+	// assert
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), start)
+	require.Less(t, len(log.segments), segments, "segments below the offset are removed")
+	_, err = log.Read(2)
+	require.Equal(t, api.ErrOffsetOutOfRange{Offset: 2, LogStartOffset: 3, HighestOffset: 5}, err)
+	record, err := log.Read(3)
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), record.Offset)
+	lowest, err := log.LowestOffset()
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), lowest)
+}
+
+func testDeleteBeforeReopen(t *testing.T, log *Log) {
+	// arrange
+	_, err := log.DeleteBefore(3)
+	require.NoError(t, err)
+	require.NoError(t, log.Close())
+
+	// act
+	reopened, err := NewLog(log.Dir, log.Config)
+	require.NoError(t, err)
+	defer reopened.Close()
+
+	// assert
+	_, err = reopened.Read(2)
+	require.Equal(t, api.ErrOffsetOutOfRange{Offset: 2, LogStartOffset: 3, HighestOffset: 5}, err)
+}
+
+func testDeleteBeforeSnapshot(t *testing.T, log *Log) {
+	// arrange
+	_, err := log.DeleteBefore(3)
+	require.NoError(t, err)
+	var snapshot bytes.Buffer
+	require.NoError(t, log.Snapshot(&snapshot))
+
+	dir := internal.GetTempDir(t, "delete-test")
+	defer os.RemoveAll(dir)
+	restored, err := NewLog(dir, log.Config)
+	require.NoError(t, err)
+	defer restored.Close()
+
+	// act
+	err = restored.Restore(&snapshot)
+
+	// assert
+	require.NoError(t, err)
+	lowest, err := restored.LowestOffset()
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), lowest)
+	highest, err := restored.HighestOffset()
+	require.NoError(t, err)
+	require.Equal(t, uint64(5), highest)
+}
+
+func testDeleteBeforeMonotonic(t *testing.T, log *Log) {
+	// arrange
+	_, err := log.DeleteBefore(3)
+	require.NoError(t, err)
+
+	// act
+	start, err := log.DeleteBefore(1)
+
+	// assert
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), start)
+}
+
+func testDeleteBeforeTooHigh(t *testing.T, log *Log) {
+	// act
+	_, err := log.DeleteBefore(7)
+
+	// assert
+	require.Equal(t, api.ErrOffsetOutOfRange{Offset: 7, HighestOffset: 5}, err)
+
+	// act
+	start, err := log.DeleteBefore(6)
+
+	// assert
+	require.NoError(t, err)
+	require.Equal(t, uint64(6), start)
+	_, err = log.Read(5)
+	require.ErrorAs(t, err, &api.ErrOffsetOutOfRange{})
+}
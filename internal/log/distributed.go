@@ -2,24 +2,59 @@ package log
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
+	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
 	"net"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/hashicorp/raft"
 	raftboltdb "github.com/hashicorp/raft-boltdb"
 	api "github.com/justagabriel/proglog/api/v1"
+	"go.uber.org/zap"
 	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 type DistributedLog struct {
-	config Config
-	log    *Log
-	raft   *raft.Raft
+	config    Config
+	topics    *Topics
+	bookmarks *Bookmarks
+	offsets   *ConsumerOffsets
+	fsm       *fsm
+	raft      *raft.Raft
+	// logStore and stableStore are closed along with raft
+	logStore    *logStore
+	stableStore *raftboltdb.BoltStore
+
+	// observations of leader changes close leaderChanged
+	observer     *raft.Observer
+	observations chan raft.Observation
+
+	mu            sync.Mutex
+	leaderChanged chan struct{}
+	// leadership receives whether this server is the leader once that changes
+	leadership chan bool
+	leader     bool
+	closed     bool
+	// zones of the other servers, as told by JoinZone
+	zones map[raft.ServerID]string
+	// replicas joined with JoinNonvoter, they're never promoted
+	replicas map[raft.ServerID]bool
+	// acks numbers the entries AppendAcks waits to be stored for
+	acks atomic.Uint64
+	// purgeDone stops purging deleted topics, see startPurge
+	purgeDone chan struct{}
 }
 
 func NewDistributedLog(dataDir string, config Config) (*DistributedLog, error) {
@@ -35,21 +70,32 @@ func NewDistributedLog(dataDir string, config Config) (*DistributedLog, error) {
 		return nil, err
 	}
 
+	l.startPurge()
 	return l, nil
 }
 
 func (l *DistributedLog) setupLog(dataDir string) error {
-	logDir := filepath.Join(dataDir, "log")
-	if err := os.MkdirAll(logDir, 0755); err != nil {
+	// records are checked before they're replicated, replicas configured with
+	// a lower limit mustn't fail applying them
+	topicsConfig := l.config
+	topicsConfig.MaxRecordBytes = 0
+	topicsConfig.replicated = true
+	var err error
+	l.topics, err = NewTopics(filepath.Join(dataDir, "log"), topicsConfig)
+	if err != nil {
 		return err
 	}
-	var err error
-	l.log, err = NewLog(logDir, l.config)
+	l.bookmarks, err = NewBookmarks(filepath.Join(dataDir, "bookmarks.json"))
+	if err != nil {
+		return err
+	}
+	l.offsets, err = NewConsumerOffsets(filepath.Join(dataDir, "offsets.json"))
 	return err
 }
 
 func (l *DistributedLog) setupRaft(dataDir string) error {
-	fsm := &fsm{log: l.log}
+	fsm := &fsm{topics: l.topics, bookmarks: l.bookmarks, offsets: l.offsets}
+	l.fsm = fsm
 
 	logDir := filepath.Join(dataDir, "raft", "log")
 	err := os.MkdirAll(logDir, 0755)
@@ -59,24 +105,53 @@ func (l *DistributedLog) setupRaft(dataDir string) error {
 
 	logConfig := l.config
 	logConfig.Segment.InitialOffset = 1
+	// entries carry whole batches, their records are checked before replication
+	logConfig.MaxRecordBytes = 0
+	// raft compacts its log itself after taking snapshots
+	logConfig.Retention.MaxAge = 0
+	logConfig.Retention.MaxBytes = 0
+	logConfig.Retention.Compact = false
+	logConfig.Segment.MaxAge = 0
+	// raft reads its entries one by one
+	logConfig.Segment.IndexInterval = 0
+	// raft's entries stay local, the records are offloaded by each node's topics
+	logConfig.Tiering.Store = nil
 	logStore, err := newLogStore(logDir, logConfig)
 	if err != nil {
 		return err
 	}
+	l.logStore = logStore
 
 	stableStorePath := filepath.Join(dataDir, "raft", "stable")
 	stableStore, err := raftboltdb.NewBoltStore(stableStorePath)
 	if err != nil {
 		return err
 	}
+	l.stableStore = stableStore
 
-	retain := 1
+	retain := l.config.Raft.SnapshotRetain
+	if retain == 0 {
+		retain = 1
+	}
 	snapshotFilePath := filepath.Join(dataDir, "raft")
 	snapshotStore, err := raft.NewFileSnapshotStore(snapshotFilePath, retain, os.Stderr)
 	if err != nil {
 		return err
 	}
 
+	// raft replays the entries following the latest snapshot into the FSM on start,
+	// Restore resets the FSM to the snapshot first. Without a snapshot, the whole
+	// log gets replayed, so the state persisted by the FSM has to be dropped.
+	snapshots, err := snapshotStore.List()
+	if err != nil {
+		return err
+	}
+	if len(snapshots) == 0 {
+		if err = fsm.reset(); err != nil {
+			return err
+		}
+	}
+
 	maxPool := 5
 	timeout := 10 * time.Second
 	transport := raft.NewNetworkTransport(
@@ -101,11 +176,21 @@ func (l *DistributedLog) setupRaft(dataDir string) error {
 	if l.config.Raft.CommitTimeout != 0 {
 		config.CommitTimeout = l.config.Raft.CommitTimeout
 	}
+	if l.config.Raft.SnapshotInterval != 0 {
+		config.SnapshotInterval = l.config.Raft.SnapshotInterval
+	}
+	if l.config.Raft.SnapshotThreshold != 0 {
+		config.SnapshotThreshold = l.config.Raft.SnapshotThreshold
+	}
+	if l.config.Raft.TrailingLogs != 0 {
+		config.TrailingLogs = l.config.Raft.TrailingLogs
+	}
 
 	l.raft, err = raft.NewRaft(config, fsm, logStore, stableStore, snapshotStore, transport)
 	if err != nil {
 		return err
 	}
+	l.observeLeader()
 
 	hasState, err := raft.HasExistingState(logStore, stableStore, snapshotStore)
 	if err != nil {
@@ -125,15 +210,130 @@ func (l *DistributedLog) setupRaft(dataDir string) error {
 	return err
 }
 
-func (l *DistributedLog) Append(record *api.Record) (uint64, error) {
-	res, err := l.apply(AppendRequestType, &api.CreateRecordRequest{Record: record})
+// Append replicates the record. The leader assigns its timestamp, so all
+// replicas store the same one. The record is left with the stored id, see
+// Log.restampDuplicates.
+func (l *DistributedLog) Append(topic string, record *api.Record) (uint64, error) {
+	return l.AppendContext(context.Background(), topic, record)
+}
+
+// AppendContext replicates the record like Append, it stops waiting for the
+// record to be committed once ctx is done. The record may still be
+// appended then, unless ctx was done before it was handed to raft.
+func (l *DistributedLog) AppendContext(ctx context.Context, topic string, record *api.Record) (uint64, error) {
+	record.Timestamp = timestamppb.Now()
+	if err := checkSize(l.config, record); err != nil {
+		return 0, err
+	}
+	res, err := l.applyContext(ctx, AppendRequestType, &api.CreateRecordRequest{Topic: topic, Record: record})
 	if err != nil {
 		return 0, err
 	}
+	record.Id = res.(*api.CreateRecordResponse).Id
 	return res.(*api.CreateRecordResponse).Offset, nil
 }
 
+// AppendBatch replicates the records as a single raft log entry.
+func (l *DistributedLog) AppendBatch(topic string, records []*api.Record) ([]uint64, error) {
+	now := timestamppb.Now()
+	for _, record := range records {
+		record.Timestamp = now
+	}
+	if err := checkSize(l.config, records...); err != nil {
+		return nil, err
+	}
+	res, err := l.apply(AppendBatchRequestType, &api.CreateRecordBatchRequest{Topic: topic, Records: records})
+	if err != nil {
+		return nil, err
+	}
+	for i, id := range res.(*api.CreateRecordBatchResponse).Ids {
+		records[i].Id = id
+	}
+	return res.(*api.CreateRecordBatchResponse).Offsets, nil
+}
+
+// AppendTransaction replicates the transaction as a single raft log entry,
+// see Topics.AppendTransaction. Its id and timestamp are assigned here, so
+// all replicas append it alike.
+func (l *DistributedLog) AppendTransaction(appends []*api.TopicRecords) ([]*api.TopicOffsets, error) {
+	if err := checkTransaction(appends); err != nil {
+		return nil, err
+	}
+	// the caller's records stay as they are, e.g. to be forwarded to the leader
+	req := proto.Clone(&api.CreateTransactionRequest{Appends: appends}).(*api.CreateTransactionRequest)
+	now := timestamppb.Now()
+	transaction := newTransactionID()
+	for _, a := range req.Appends {
+		for _, record := range a.Records {
+			record.Timestamp = now
+			record.Transaction = transaction
+		}
+		if err := checkSize(l.config, a.Records...); err != nil {
+			return nil, err
+		}
+	}
+	res, err := l.apply(TransactionRequestType, req)
+	if err != nil {
+		return nil, err
+	}
+	return res.(*api.CreateTransactionResponse).Offsets, nil
+}
+
 func (l *DistributedLog) apply(reqType RequestType, req proto.Message) (interface{}, error) {
+	return l.applyContext(context.Background(), reqType, req)
+}
+
+// applyContext applies the command, waiting for it until ctx is done. Raft
+// starts it no later than ctx's deadline.
+func (l *DistributedLog) applyContext(ctx context.Context, reqType RequestType, req proto.Message) (interface{}, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	cmd, err := command(reqType, req)
+	if err != nil {
+		return nil, err
+	}
+
+	timeout := applyTimeout
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < timeout {
+		// raft waits without timeout for a zero one
+		if timeout = time.Until(deadline); timeout <= 0 {
+			return nil, context.DeadlineExceeded
+		}
+	}
+	future := l.raft.Apply(cmd, timeout)
+	if ctx.Done() == nil {
+		err = future.Error()
+	} else {
+		applied := make(chan error, 1)
+		go func() { applied <- future.Error() }()
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case err = <-applied:
+		}
+	}
+	if err != nil {
+		if errors.Is(err, raft.ErrNotLeader) {
+			return nil, l.notLeader()
+		}
+		return nil, err
+	}
+
+	res := future.Response()
+	err, isErr := res.(error)
+	if isErr {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// applyTimeout caps how long commands wait to be started by raft.
+const applyTimeout = 10 * time.Second
+
+// command encodes the request as the raft log entry applied by the FSM.
+func command(reqType RequestType, req proto.Message) ([]byte, error) {
 	var buf bytes.Buffer
 	_, err := buf.Write([]byte{byte(reqType)})
 	if err != nil {
@@ -149,63 +349,402 @@ func (l *DistributedLog) apply(reqType RequestType, req proto.Message) (interfac
 	if err != nil {
 		return nil, err
 	}
+	return buf.Bytes(), nil
+}
 
-	timeout := 10 * time.Second
-	future := l.raft.Apply(buf.Bytes(), timeout)
-	if future.Error() != nil {
-		return nil, future.Error()
+// notLeader points clients to the leader. Raft and RPC share a listener,
+// so the leader's raft address is its RPC address as well.
+func (l *DistributedLog) notLeader() api.ErrNotLeader {
+	term, _ := strconv.ParseUint(l.raft.Stats()["term"], 10, 64)
+	return api.ErrNotLeader{LeaderAddr: l.leaderAddr(), Term: term}
+}
+
+// leaderAddr looks up the leader's address in the configuration, the address
+// raft reports for the leader is the one its listener is bound to, e.g. "[::]:8400".
+func (l *DistributedLog) leaderAddr() string {
+	_, leaderID := l.raft.LeaderWithID()
+	future := l.raft.GetConfiguration()
+	if leaderID == "" || future.Error() != nil {
+		return ""
+	}
+	for _, srv := range future.Configuration().Servers {
+		if srv.ID == leaderID {
+			return string(srv.Address)
+		}
 	}
+	return ""
+}
 
-	res := future.Response()
-	err, isErr := res.(error)
-	if isErr {
+func (l *DistributedLog) Read(topic string, offset uint64) (*api.Record, error) {
+	return l.topics.Read(topic, offset)
+}
+
+// ReadContext reads the record of the local replica, see Log.ReadContext.
+func (l *DistributedLog) ReadContext(ctx context.Context, topic string, offset uint64) (*api.Record, error) {
+	return l.topics.ReadContext(ctx, topic, offset)
+}
+
+// ReadEncoded returns the encoded record of the local replica, see Log.ReadEncoded.
+func (l *DistributedLog) ReadEncoded(topic string, offset uint64) ([]byte, error) {
+	return l.topics.ReadEncoded(topic, offset)
+}
+
+// ReadLeader reads the record once raft confirmed this node is still the
+// leader, so it reflects all writes which succeeded before.
+func (l *DistributedLog) ReadLeader(topic string, offset uint64) (*api.Record, error) {
+	if err := l.raft.VerifyLeader().Error(); err != nil {
+		if errors.Is(err, raft.ErrNotLeader) || errors.Is(err, raft.ErrLeadershipLost) {
+			return nil, l.notLeader()
+		}
 		return nil, err
 	}
+	return l.topics.Read(topic, offset)
+}
 
-	return res, nil
+// SetBookmark replicates the bookmark to all servers.
+func (l *DistributedLog) SetBookmark(name string, offset uint64) error {
+	_, err := l.apply(SetBookmarkRequestType, &api.SetBookmarkRequest{
+		Bookmark: &api.Bookmark{Name: name, Offset: offset},
+	})
+	return err
+}
+
+// GetBookmark resolves the bookmark from the local replica.
+func (l *DistributedLog) GetBookmark(name string) (uint64, error) {
+	return l.bookmarks.GetBookmark(name)
+}
+
+// DeleteBookmark removes the bookmark from all servers.
+func (l *DistributedLog) DeleteBookmark(name string) error {
+	_, err := l.apply(DeleteBookmarkRequestType, &api.DeleteBookmarkRequest{Name: name})
+	return err
+}
+
+// CommitOffset replicates the consumer group's offset to all servers.
+func (l *DistributedLog) CommitOffset(group, topic string, offset uint64) error {
+	_, err := l.apply(CommitOffsetRequestType, &api.CommitOffsetRequest{
+		Group:  group,
+		Topic:  topic,
+		Offset: offset,
+	})
+	return err
+}
+
+// FetchOffset resolves the consumer group's offset from the local replica.
+func (l *DistributedLog) FetchOffset(group, topic string) (uint64, error) {
+	return l.offsets.FetchOffset(group, topic)
+}
+
+// Backup writes a copy of the topic's records of this node to w.
+func (l *DistributedLog) Backup(topic string, w io.Writer) error {
+	return l.topics.Backup(topic, w)
+}
+
+// OffsetByTime searches the topic by time, see Log.OffsetByTime.
+func (l *DistributedLog) OffsetByTime(topic string, t time.Time) (uint64, error) {
+	return l.topics.OffsetByTime(topic, t)
+}
+
+// ReadByKey returns the latest record with the key of the local replica.
+func (l *DistributedLog) ReadByKey(topic string, key []byte) (*api.Record, error) {
+	return l.topics.ReadByKey(topic, key)
+}
+
+// LowestOffset returns the topic's lowest offset of the local replica.
+func (l *DistributedLog) LowestOffset(topic string) (uint64, error) {
+	return l.topics.LowestOffset(topic)
+}
+
+// HighestOffset returns the topic's highest offset of the local replica.
+func (l *DistributedLog) HighestOffset(topic string) (uint64, error) {
+	return l.topics.HighestOffset(topic)
+}
+
+// SegmentStats describes the local replica's segments, see Log.SegmentStats.
+func (l *DistributedLog) SegmentStats(topic string) ([]*api.SegmentStats, error) {
+	return l.topics.SegmentStats(topic)
+}
+
+// Stats summarizes the topic's log of the local replica, see Log.Stats.
+func (l *DistributedLog) Stats(topic string) (*api.LogStats, error) {
+	return l.topics.Stats(topic)
+}
+
+// Verify checks and optionally repairs the topic's log of the local replica,
+// see Log.Verify. Records dropped by a repair aren't fetched from the others.
+func (l *DistributedLog) Verify(topic string, repair bool) (*api.VerifyReport, error) {
+	return l.topics.Verify(topic, repair)
+}
+
+// RunMaintenance runs the task on the topic's log of the local replica, see
+// Log.RunMaintenance. Replicas maintain their logs themselves.
+func (l *DistributedLog) RunMaintenance(topic string, task api.MaintenanceTask) (*api.MaintenanceProgress, error) {
+	return l.topics.RunMaintenance(topic, task)
+}
+
+// MaintenanceStatus reports the maintenance runs of the topic's log of the
+// local replica, see Log.MaintenanceStatus.
+func (l *DistributedLog) MaintenanceStatus(topic string) ([]*api.MaintenanceProgress, error) {
+	return l.topics.MaintenanceStatus(topic)
+}
+
+// DurableOffset returns the local replica's high watermark, the records
+// below it were committed by a quorum of the cluster.
+func (l *DistributedLog) DurableOffset(topic string) (uint64, error) {
+	hw, _, err := l.topics.HighWatermark(topic)
+	if err != nil {
+		return 0, err
+	}
+	return hw.Offset, nil
+}
+
+// HighWatermark returns the local replica's high watermark, see Topics.HighWatermark.
+func (l *DistributedLog) HighWatermark(topic string) (*api.HighWatermark, <-chan struct{}, error) {
+	return l.topics.HighWatermark(topic)
+}
+
+// Truncate removes old segments of the topic on all servers, see Log.Truncate.
+func (l *DistributedLog) Truncate(topic string, lowest uint64) error {
+	_, err := l.apply(TruncateRequestType, &api.TruncateRequest{Topic: topic, Lowest: lowest})
+	return err
+}
+
+// DeleteBefore deletes the topic's records below the offset on all servers,
+// see Log.DeleteBefore.
+func (l *DistributedLog) DeleteBefore(topic string, offset uint64) (uint64, error) {
+	res, err := l.apply(DeleteBeforeRequestType, &api.DeleteBeforeRequest{Topic: topic, Offset: offset})
+	if err != nil {
+		return 0, err
+	}
+	return res.(*api.DeleteBeforeResponse).LogStartOffset, nil
+}
+
+// CreateTopic creates the topic on all servers, see Topics.CreateTopic.
+func (l *DistributedLog) CreateTopic(topic string, tc *api.TopicConfig) (*api.TopicDescription, error) {
+	res, err := l.apply(CreateTopicRequestType, &api.CreateTopicRequest{Topic: topic, Config: tc})
+	if err != nil {
+		return nil, err
+	}
+	return res.(*api.CreateTopicResponse).Topic, nil
 }
 
-func (l *DistributedLog) Read(offset uint64) (*api.Record, error) {
-	return l.log.Read(offset)
+// DeleteTopic deletes the topic on all servers, see Topics.DeleteTopic. The
+// grace period starts when the leader appended the deletion to the raft log.
+func (l *DistributedLog) DeleteTopic(topic string) error {
+	_, err := l.apply(DeleteTopicRequestType, &api.DeleteTopicRequest{Topic: topic})
+	return err
+}
+
+// UndeleteTopic restores the deleted topic on all servers, see
+// Topics.UndeleteTopic.
+func (l *DistributedLog) UndeleteTopic(topic string) (*api.TopicDescription, error) {
+	res, err := l.apply(UndeleteTopicRequestType, &api.UndeleteTopicRequest{Topic: topic})
+	if err != nil {
+		return nil, err
+	}
+	return res.(*api.UndeleteTopicResponse).Topic, nil
+}
+
+// startPurge has the leader purge the deleted topics whose grace period
+// ended until the log is closed. Purges are replicated, so all replicas
+// remove the topics at the same entry and agree on which can be undeleted.
+func (l *DistributedLog) startPurge() {
+	if l.config.TopicDeleteGracePeriod == 0 {
+		return
+	}
+	interval := l.config.Retention.CheckInterval
+	if interval == 0 {
+		interval = defaultRetentionCheckInterval
+	}
+
+	done := make(chan struct{})
+	l.purgeDone = done
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case now := <-ticker.C:
+				if l.raft.State() != raft.Leader || !l.topics.hasExpired(now) {
+					continue
+				}
+				if _, err := l.apply(PurgeTopicsRequestType, &emptypb.Empty{}); err != nil {
+					zap.L().Named("log").Error(
+						"failed to purge deleted topics",
+						zap.Error(err),
+					)
+				}
+			}
+		}
+	}()
+}
+
+// DescribeTopic describes the local replica of the topic.
+func (l *DistributedLog) DescribeTopic(topic string) (*api.TopicDescription, error) {
+	return l.topics.DescribeTopic(topic)
+}
+
+// ConfigureTopic replaces the topic's config overrides on all servers, see
+// Topics.ConfigureTopic.
+func (l *DistributedLog) ConfigureTopic(topic string, tc *api.TopicConfig) (*api.TopicDescription, error) {
+	res, err := l.apply(ConfigureTopicRequestType, &api.ConfigureTopicRequest{Topic: topic, Config: tc})
+	if err != nil {
+		return nil, err
+	}
+	return res.(*api.ConfigureTopicResponse).Topic, nil
+}
+
+// SetReadOnly sets the read-only mode of all servers, nil or a disabled mode
+// lets them accept appends again.
+func (l *DistributedLog) SetReadOnly(mode *api.ReadOnlyMode) error {
+	if mode == nil {
+		mode = &api.ReadOnlyMode{}
+	}
+	_, err := l.apply(ReadOnlyRequestType, mode)
+	return err
+}
+
+// ReadOnly returns the cluster's read-only mode as the local replica has it.
+func (l *DistributedLog) ReadOnly() *api.ReadOnlyMode {
+	return l.fsm.readOnlyMode()
+}
+
+// Topics returns the names of the local replica's topics.
+func (l *DistributedLog) Topics() []string {
+	return l.topics.Names()
 }
 
 var _ raft.FSM = (*fsm)(nil)
 
 type fsm struct {
-	log *Log
+	topics    *Topics
+	bookmarks *Bookmarks
+	offsets   *ConsumerOffsets
+	// readOnly is the cluster's read-only mode, nil if it was never set
+	readOnly atomic.Pointer[api.ReadOnlyMode]
 }
 
 func (l *DistributedLog) Join(id, addr string) error {
-	configFuture := l.raft.GetConfiguration()
-	if err := configFuture.Error(); err != nil {
-		return err
+	return l.JoinZone(id, addr, "")
+}
+
+// Bootstrap bootstraps the cluster with the servers, ids to raft addresses,
+// unless this server has raft state already. All servers may bootstrap with
+// the same servers, they end up in the same cluster.
+func (l *DistributedLog) Bootstrap(servers map[string]string) error {
+	config := raft.Configuration{}
+	for id, addr := range servers {
+		config.Servers = append(config.Servers, raft.Server{
+			ID:      raft.ServerID(id),
+			Address: raft.ServerAddress(addr),
+		})
 	}
+	sort.Slice(config.Servers, func(i, j int) bool {
+		return config.Servers[i].ID < config.Servers[j].ID
+	})
+	err := l.raft.BootstrapCluster(config).Error()
+	if errors.Is(err, raft.ErrCantBootstrap) {
+		return nil
+	}
+	return err
+}
 
-	serverID := raft.ServerID(id)
-	serverAddr := raft.ServerAddress(addr)
-	for _, srv := range configFuture.Configuration().Servers {
-		if srv.ID == serverID || srv.Address == serverAddr {
-			if srv.ID == serverID && srv.Address == serverAddr {
-				// server has already joined
-				return nil
-			}
-			// remove existing server
-			removeFuture := l.raft.RemoveServer(serverID, 0, 0)
-			if err := removeFuture.Error(); err != nil {
-				return err
+// SetRetention changes the retention policy of the topics, raft's log is
+// trimmed by its snapshots instead.
+func (l *DistributedLog) SetRetention(r RetentionPolicy) {
+	l.topics.SetRetention(r)
+}
+
+// Snapshot takes a snapshot of the log right away, besides the ones taken
+// every Raft.SnapshotInterval once Raft.SnapshotThreshold entries were
+// appended. Entries before the snapshot but the Raft.TrailingLogs latest ones
+// are removed, followers lagging further behind catch up from the snapshot.
+func (l *DistributedLog) Snapshot() error {
+	return l.raft.Snapshot().Error()
+}
+
+func (l *DistributedLog) Leave(id string) error {
+	l.mu.Lock()
+	delete(l.zones, raft.ServerID(id))
+	delete(l.replicas, raft.ServerID(id))
+	l.mu.Unlock()
+
+	removeFuture := l.raft.RemoveServer(raft.ServerID(id), 0, 0)
+	if err := removeFuture.Error(); err != nil {
+		return l.notLeaderErr(err)
+	}
+	return l.notLeaderErr(l.promote())
+}
+
+// notLeaderErr points callers of membership changes to the leader, only it
+// can change the configuration.
+func (l *DistributedLog) notLeaderErr(err error) error {
+	if errors.Is(err, raft.ErrNotLeader) {
+		return l.notLeader()
+	}
+	return err
+}
+
+func (l *DistributedLog) observeLeader() {
+	l.leaderChanged = make(chan struct{})
+	l.leadership = make(chan bool, 1)
+	// the buffer keeps one change pending, Ready looks up the current leader anyway
+	l.observations = make(chan raft.Observation, 1)
+	l.observer = raft.NewObserver(l.observations, false, func(o *raft.Observation) bool {
+		_, ok := o.Data.(raft.LeaderObservation)
+		return ok
+	})
+	l.raft.RegisterObserver(l.observer)
+
+	go func() {
+		for range l.observations {
+			l.mu.Lock()
+			if !l.closed {
+				close(l.leaderChanged)
+				l.leaderChanged = make(chan struct{})
+				l.notifyLeadership()
 			}
+			l.mu.Unlock()
 		}
+	}()
+}
+
+// Ready reports whether the cluster has a leader, so writes can be served.
+// The returned channel is closed once that may have changed, it's nil once
+// the log is closed.
+// LeadershipChanges receives true once this server becomes the leader and
+// false once it isn't anymore, e.g. to run leader-only jobs. Only the latest
+// change is kept for slow receivers, the channel is closed along with the log.
+func (l *DistributedLog) LeadershipChanges() <-chan bool {
+	return l.leadership
+}
+
+// notifyLeadership replaces a pending change nobody received yet, l.mu must be held.
+// Dropped observations are made up for by looking up the current leader.
+func (l *DistributedLog) notifyLeadership() {
+	_, leaderID := l.raft.LeaderWithID()
+	leader := leaderID == l.config.Raft.LocalID
+	if leader == l.leader {
+		return
 	}
-	addFuture := l.raft.AddVoter(serverID, serverAddr, 0, 0)
-	if err := addFuture.Error(); err != nil {
-		return err
+	l.leader = leader
+	select {
+	case <-l.leadership:
+	default:
 	}
-	return nil
+	l.leadership <- leader
 }
 
-func (l *DistributedLog) Leave(id string) error {
-	removeFuture := l.raft.RemoveServer(raft.ServerID(id), 0, 0)
-	return removeFuture.Error()
+func (l *DistributedLog) Ready() (bool, <-chan struct{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return false, nil
+	}
+	leader, _ := l.raft.LeaderWithID()
+	return leader != "", l.leaderChanged
 }
 
 func (l *DistributedLog) WaitForLeader(timeout time.Duration) error {
@@ -226,11 +765,28 @@ func (l *DistributedLog) WaitForLeader(timeout time.Duration) error {
 
 // Close disconnects from the Raft cluster and shut's down the replication service.
 func (l *DistributedLog) Close() error {
+	l.raft.DeregisterObserver(l.observer)
+	close(l.observations)
+	l.mu.Lock()
+	l.closed = true
+	close(l.leaderChanged)
+	close(l.leadership)
+	if l.purgeDone != nil {
+		close(l.purgeDone)
+	}
+	l.mu.Unlock()
+
 	f := l.raft.Shutdown()
 	if err := f.Error(); err != nil {
 		return err
 	}
-	return l.log.Close()
+	if err := l.stableStore.Close(); err != nil {
+		return err
+	}
+	if err := l.logStore.Close(); err != nil {
+		return err
+	}
+	return l.topics.Close()
 }
 
 // GetServers returns information about all servers of the app.
@@ -239,12 +795,14 @@ func (l *DistributedLog) GetServers() ([]*api.Server, error) {
 	if err := future.Error(); err != nil {
 		return nil, err
 	}
+	_, leaderID := l.raft.LeaderWithID()
 	var servers []*api.Server
 	for _, srv := range future.Configuration().Servers {
 		servers = append(servers, &api.Server{
 			Id:       string(srv.ID),
 			RpcAddr:  string(srv.Address),
-			IsLeader: l.raft.Leader() == srv.Address,
+			IsLeader: leaderID == srv.ID,
+			Voter:    srv.Suffrage == raft.Voter,
 		})
 	}
 	return servers, nil
@@ -253,7 +811,20 @@ func (l *DistributedLog) GetServers() ([]*api.Server, error) {
 type RequestType uint8
 
 const (
-	AppendRequestType RequestType = 0
+	AppendRequestType         RequestType = 0
+	SetBookmarkRequestType    RequestType = 1
+	DeleteBookmarkRequestType RequestType = 2
+	TruncateRequestType       RequestType = 3
+	AppendBatchRequestType    RequestType = 4
+	CommitOffsetRequestType   RequestType = 5
+	DeleteBeforeRequestType   RequestType = 6
+	TransactionRequestType    RequestType = 7
+	CreateTopicRequestType    RequestType = 8
+	DeleteTopicRequestType    RequestType = 9
+	ConfigureTopicRequestType RequestType = 10
+	ReadOnlyRequestType       RequestType = 11
+	UndeleteTopicRequestType  RequestType = 12
+	PurgeTopicsRequestType    RequestType = 13
 )
 
 // Apply implements raft.FSM.
@@ -263,83 +834,657 @@ func (l *fsm) Apply(record *raft.Log) interface{} {
 	switch reqType {
 	case AppendRequestType:
 		return l.applyAppend(buf[1:])
+	case SetBookmarkRequestType:
+		return l.applySetBookmark(buf[1:])
+	case DeleteBookmarkRequestType:
+		return l.applyDeleteBookmark(buf[1:])
+	case TruncateRequestType:
+		return l.applyTruncate(buf[1:])
+	case AppendBatchRequestType:
+		return l.applyAppendBatch(buf[1:])
+	case CommitOffsetRequestType:
+		return l.applyCommitOffset(buf[1:])
+	case DeleteBeforeRequestType:
+		return l.applyDeleteBefore(buf[1:])
+	case TransactionRequestType:
+		return l.applyTransaction(buf[1:])
+	case CreateTopicRequestType:
+		return l.applyCreateTopic(buf[1:])
+	case DeleteTopicRequestType:
+		return l.applyDeleteTopic(buf[1:], record.AppendedAt)
+	case UndeleteTopicRequestType:
+		return l.applyUndeleteTopic(buf[1:], record.AppendedAt)
+	case PurgeTopicsRequestType:
+		return l.topics.purgeDeleted(nil, record.AppendedAt)
+	case ConfigureTopicRequestType:
+		return l.applyConfigureTopic(buf[1:])
+	case ReadOnlyRequestType:
+		return l.applyReadOnly(buf[1:])
 	}
 	return nil
 }
 
+// reset drops all topics, bookmarks and consumer offsets.
+func (l *fsm) reset() error {
+	if err := l.topics.reset(); err != nil {
+		return err
+	}
+	if err := l.bookmarks.replace(map[string]uint64{}); err != nil {
+		return err
+	}
+	return l.offsets.replace(map[string]map[string]uint64{})
+}
+
 func (l *fsm) applyAppend(b []byte) interface{} {
 	var req api.CreateRecordRequest
 	err := proto.Unmarshal(b, &req)
 	if err != nil {
 		return err
 	}
-	offset, err := l.log.Append(req.Record)
+	offset, err := l.topics.Append(req.Topic, req.Record)
 	if err != nil {
 		return err
 	}
 	return &api.CreateRecordResponse{
 		Offset: offset,
+		Id:     req.Record.Id,
 	}
 }
 
+func (l *fsm) applyAppendBatch(b []byte) interface{} {
+	var req api.CreateRecordBatchRequest
+	err := proto.Unmarshal(b, &req)
+	if err != nil {
+		return err
+	}
+	offsets, err := l.topics.AppendBatch(req.Topic, req.Records)
+	if err != nil {
+		return err
+	}
+	ids := make([][]byte, len(req.Records))
+	for i, record := range req.Records {
+		ids[i] = record.Id
+	}
+	return &api.CreateRecordBatchResponse{
+		Offsets: offsets,
+		Ids:     ids,
+	}
+}
+
+func (l *fsm) applyTransaction(b []byte) interface{} {
+	var req api.CreateTransactionRequest
+	err := proto.Unmarshal(b, &req)
+	if err != nil {
+		return err
+	}
+	offsets, err := l.topics.AppendTransaction(req.Appends)
+	if err != nil {
+		return err
+	}
+	return &api.CreateTransactionResponse{
+		Offsets: offsets,
+	}
+}
+
+func (l *fsm) applyCreateTopic(b []byte) interface{} {
+	var req api.CreateTopicRequest
+	err := proto.Unmarshal(b, &req)
+	if err != nil {
+		return err
+	}
+	topic, err := l.topics.CreateTopic(req.Topic, req.Config)
+	if err != nil {
+		return err
+	}
+	return &api.CreateTopicResponse{Topic: topic}
+}
+
+// applyDeleteTopic deletes the topic as of the time the leader appended the
+// entry, see logStore.StoreLogs.
+func (l *fsm) applyDeleteTopic(b []byte, at time.Time) interface{} {
+	var req api.DeleteTopicRequest
+	err := proto.Unmarshal(b, &req)
+	if err != nil {
+		return err
+	}
+	return l.topics.deleteTopic(req.Topic, at)
+}
+
+func (l *fsm) applyUndeleteTopic(b []byte, at time.Time) interface{} {
+	var req api.UndeleteTopicRequest
+	err := proto.Unmarshal(b, &req)
+	if err != nil {
+		return err
+	}
+	topic, err := l.topics.undeleteTopic(req.Topic, at)
+	if err != nil {
+		return err
+	}
+	return &api.UndeleteTopicResponse{Topic: topic}
+}
+
+func (l *fsm) applyConfigureTopic(b []byte) interface{} {
+	var req api.ConfigureTopicRequest
+	err := proto.Unmarshal(b, &req)
+	if err != nil {
+		return err
+	}
+	topic, err := l.topics.ConfigureTopic(req.Topic, req.Config)
+	if err != nil {
+		return err
+	}
+	return &api.ConfigureTopicResponse{Topic: topic}
+}
+
+func (l *fsm) applyReadOnly(b []byte) interface{} {
+	mode := &api.ReadOnlyMode{}
+	if err := proto.Unmarshal(b, mode); err != nil {
+		return err
+	}
+	l.readOnly.Store(mode)
+	return nil
+}
+
+// readOnlyMode returns the read-only mode, a disabled one if it was never set.
+func (l *fsm) readOnlyMode() *api.ReadOnlyMode {
+	if mode := l.readOnly.Load(); mode != nil {
+		return mode
+	}
+	return &api.ReadOnlyMode{}
+}
+
+func (l *fsm) applySetBookmark(b []byte) interface{} {
+	var req api.SetBookmarkRequest
+	err := proto.Unmarshal(b, &req)
+	if err != nil {
+		return err
+	}
+	return l.bookmarks.SetBookmark(req.Bookmark.Name, req.Bookmark.Offset)
+}
+
+func (l *fsm) applyDeleteBookmark(b []byte) interface{} {
+	var req api.DeleteBookmarkRequest
+	err := proto.Unmarshal(b, &req)
+	if err != nil {
+		return err
+	}
+	return l.bookmarks.DeleteBookmark(req.Name)
+}
+
+func (l *fsm) applyCommitOffset(b []byte) interface{} {
+	var req api.CommitOffsetRequest
+	err := proto.Unmarshal(b, &req)
+	if err != nil {
+		return err
+	}
+	return l.offsets.CommitOffset(req.Group, req.Topic, req.Offset)
+}
+
+func (l *fsm) applyTruncate(b []byte) interface{} {
+	var req api.TruncateRequest
+	err := proto.Unmarshal(b, &req)
+	if err != nil {
+		return err
+	}
+	return l.topics.Truncate(req.Topic, req.Lowest)
+}
+
+func (l *fsm) applyDeleteBefore(b []byte) interface{} {
+	var req api.DeleteBeforeRequest
+	err := proto.Unmarshal(b, &req)
+	if err != nil {
+		return err
+	}
+	start, err := l.topics.DeleteBefore(req.Topic, req.Offset)
+	if err != nil {
+		return err
+	}
+	return &api.DeleteBeforeResponse{LogStartOffset: start}
+}
+
+// Snapshots start with snapshotMagic and their format's version, followed by
+// sections. Each section starts with its id and size, so readers skip the
+// sections they don't know. All sections are optional, the state of missing
+// ones is empty. Snapshots of servers predating topics hold the records of
+// the default topic only and start with the length of the first record,
+// whose first byte is zero.
+var snapshotMagic = []byte("plsn")
+
+const snapshotVersion = 1
+
+// snapshotSection identifies a section of a snapshot.
+type snapshotSection uint64
+
+const (
+	bookmarksSection snapshotSection = iota + 1
+	offsetsSection
+	configsSection
+	readOnlySection
+	// deletedSection holds the deletion times of the deleted topics, which
+	// are part of the topics section
+	deletedSection
+	// topicsSection holds name, size and records of each topic, it's last
+	topicsSection
+)
+
 // Snapshot implements raft.FSM.
 func (m *fsm) Snapshot() (raft.FSMSnapshot, error) {
-	r := m.log.Reader()
-	return &snapshot{reader: r}, nil
+	topics, err := m.topics.snapshot()
+	if err != nil {
+		return nil, err
+	}
+	return &snapshot{
+		topics:    topics,
+		configs:   m.topics.topicConfigs(),
+		deleted:   m.topics.deletedTopics(),
+		bookmarks: m.bookmarks.all(),
+		offsets:   m.offsets.all(),
+		readOnly:  m.readOnlyMode(),
+	}, nil
 }
 
 var _ raft.FSMSnapshot = (*snapshot)(nil)
 
 type snapshot struct {
-	reader io.Reader
+	topics    []topicSnapshot
+	configs   map[string]*api.TopicConfig
+	deleted   map[string]time.Time
+	bookmarks map[string]uint64
+	offsets   map[string]map[string]uint64
+	readOnly  *api.ReadOnlyMode
 }
 
 // Persist implements raft.FSMSnapshot.
 func (s *snapshot) Persist(sink raft.SnapshotSink) error {
-	if _, err := io.Copy(sink, s.reader); err != nil {
+	if err := s.persist(sink); err != nil {
 		_ = sink.Cancel()
 		return err
 	}
 	return sink.Close()
 }
 
-// Release implements raft.FSMSnapshot.
-func (*snapshot) Release() {}
+func (s *snapshot) persist(w io.Writer) error {
+	var head bytes.Buffer
+	head.Write(snapshotMagic)
+	if err := binary.Write(&head, enc, uint64(snapshotVersion)); err != nil {
+		return err
+	}
+	if _, err := w.Write(head.Bytes()); err != nil {
+		return err
+	}
+
+	sections := []struct {
+		id     snapshotSection
+		encode func() ([]byte, error)
+	}{
+		{bookmarksSection, s.encodeBookmarks},
+		{offsetsSection, s.encodeOffsets},
+		{configsSection, s.encodeConfigs},
+		{readOnlySection, s.encodeReadOnly},
+		{deletedSection, s.encodeDeleted},
+	}
+	for _, section := range sections {
+		b, err := section.encode()
+		if err != nil {
+			return err
+		}
+		if len(b) == 0 {
+			continue
+		}
+		if err = writeSectionHeader(w, section.id, uint64(len(b))); err != nil {
+			return err
+		}
+		if _, err = w.Write(b); err != nil {
+			return err
+		}
+	}
+
+	var size uint64
+	for _, topic := range s.topics {
+		size += 8 + uint64(len(topic.name)) + 8 + topic.size
+	}
+	if err := writeSectionHeader(w, topicsSection, size); err != nil {
+		return err
+	}
+	for _, topic := range s.topics {
+		if err := s.persistTopic(w, topic); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-func (f *fsm) Restore(r io.ReadCloser) error {
-	b := make([]byte, lenWidth)
+func writeSectionHeader(w io.Writer, id snapshotSection, size uint64) error {
 	var buf bytes.Buffer
-	for i := 0; ; i++ {
-		_, err := io.ReadFull(r, b)
+	if err := binary.Write(&buf, enc, uint64(id)); err != nil {
+		return err
+	}
+	if err := binary.Write(&buf, enc, size); err != nil {
+		return err
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// encodeMessages encodes the count of the messages followed by the size and
+// encoding of each.
+func encodeMessages[M proto.Message](messages []M) ([]byte, error) {
+	if len(messages) == 0 {
+		return nil, nil
+	}
+	var buf bytes.Buffer
+	if err := binary.Write(&buf, enc, uint64(len(messages))); err != nil {
+		return nil, err
+	}
+	for _, m := range messages {
+		b, err := proto.Marshal(m)
 		if err != nil {
+			return nil, err
+		}
+		if err = binary.Write(&buf, enc, uint64(len(b))); err != nil {
+			return nil, err
+		}
+		buf.Write(b)
+	}
+	return buf.Bytes(), nil
+}
+
+func (s *snapshot) encodeBookmarks() ([]byte, error) {
+	var bookmarks []*api.Bookmark
+	for name, offset := range s.bookmarks {
+		bookmarks = append(bookmarks, &api.Bookmark{Name: name, Offset: offset})
+	}
+	return encodeMessages(bookmarks)
+}
+
+func (s *snapshot) encodeOffsets() ([]byte, error) {
+	var commits []*api.CommitOffsetRequest
+	for group, topics := range s.offsets {
+		for topic, offset := range topics {
+			commits = append(commits, &api.CommitOffsetRequest{Group: group, Topic: topic, Offset: offset})
+		}
+	}
+	return encodeMessages(commits)
+}
+
+func (s *snapshot) encodeConfigs() ([]byte, error) {
+	var configs []*api.ConfigureTopicRequest
+	for topic, tc := range s.configs {
+		configs = append(configs, &api.ConfigureTopicRequest{Topic: topic, Config: tc})
+	}
+	return encodeMessages(configs)
+}
+
+// encodeReadOnly encodes the mode as is, a disabled mode encodes as nothing.
+func (s *snapshot) encodeReadOnly() ([]byte, error) {
+	return proto.Marshal(s.readOnly)
+}
+
+func (s *snapshot) encodeDeleted() ([]byte, error) {
+	if len(s.deleted) == 0 {
+		return nil, nil
+	}
+	var buf bytes.Buffer
+	if err := binary.Write(&buf, enc, uint64(len(s.deleted))); err != nil {
+		return nil, err
+	}
+	for topic, at := range s.deleted {
+		if err := binary.Write(&buf, enc, uint64(len(topic))); err != nil {
+			return nil, err
+		}
+		buf.WriteString(topic)
+		if err := binary.Write(&buf, enc, at.UnixNano()); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+func (s *snapshot) persistTopic(w io.Writer, topic topicSnapshot) error {
+	var buf bytes.Buffer
+	if err := binary.Write(&buf, enc, uint64(len(topic.name))); err != nil {
+		return err
+	}
+	buf.WriteString(topic.name)
+	if err := binary.Write(&buf, enc, topic.size); err != nil {
+		return err
+	}
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		return err
+	}
+	_, err := io.Copy(w, topic.reader)
+	return err
+}
+
+// Release implements raft.FSMSnapshot.
+func (*snapshot) Release() {}
+
+func (f *fsm) Restore(rc io.ReadCloser) error {
+	head := make([]byte, len(snapshotMagic))
+	if _, err := io.ReadFull(rc, head); err != nil {
+		if err == io.EOF {
+			return nil
+		}
+		return err
+	}
+
+	if err := f.topics.reset(); err != nil {
+		return err
+	}
+	if err := f.bookmarks.replace(map[string]uint64{}); err != nil {
+		return err
+	}
+	if err := f.offsets.replace(map[string]map[string]uint64{}); err != nil {
+		return err
+	}
+	f.readOnly.Store(nil)
+	if !bytes.Equal(head, snapshotMagic) {
+		return f.restoreRecords(io.MultiReader(bytes.NewReader(head), rc), api.DefaultTopic)
+	}
+
+	var version uint64
+	if err := binary.Read(rc, enc, &version); err != nil {
+		return err
+	}
+	if version != snapshotVersion {
+		return fmt.Errorf("unsupported snapshot version %d", version)
+	}
+	var deleted map[string]time.Time
+	for {
+		var id, size uint64
+		if err := binary.Read(rc, enc, &id); err != nil {
 			if err == io.EOF {
 				break
 			}
 			return err
 		}
-
-		size := int64(enc.Uint64(b))
-		if _, err = io.CopyN(&buf, r, size); err != nil {
+		if err := binary.Read(rc, enc, &size); err != nil {
 			return err
 		}
 
-		record := &api.Record{}
-		if err = proto.Unmarshal(buf.Bytes(), record); err != nil {
+		section := io.LimitReader(rc, int64(size))
+		var err error
+		switch snapshotSection(id) {
+		case bookmarksSection:
+			err = f.restoreBookmarks(section)
+		case offsetsSection:
+			err = f.restoreOffsets(section)
+		case configsSection:
+			err = f.restoreConfigs(section)
+		case readOnlySection:
+			err = f.restoreReadOnly(section)
+		case deletedSection:
+			deleted, err = readDeleted(section)
+		case topicsSection:
+			err = f.restoreTopics(section)
+		}
+		if err != nil {
 			return err
 		}
+		// skips unknown sections and what's left of known ones
+		if _, err = io.Copy(io.Discard, section); err != nil {
+			return err
+		}
+	}
+	// topics are deleted once they're restored
+	return f.topics.restoreDeleted(deleted)
+}
 
-		if i == 0 {
-			f.log.Config.Segment.InitialOffset = record.Offset
-			if err := f.log.Reset(); err != nil {
+func (f *fsm) restoreTopics(r io.Reader) error {
+	for {
+		var size uint64
+		if err := binary.Read(r, enc, &size); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		name := make([]byte, size)
+		if _, err := io.ReadFull(r, name); err != nil {
+			return err
+		}
+		if err := binary.Read(r, enc, &size); err != nil {
+			return err
+		}
+		if size == 0 {
+			if _, err := f.topics.restoreLog(string(name), 0); err != nil {
 				return err
 			}
+			continue
 		}
-		if _, err = f.log.Append(record); err != nil {
+		if err := f.restoreRecords(io.LimitReader(r, int64(size)), string(name)); err != nil {
 			return err
 		}
-		buf.Reset()
 	}
+}
+
+func (f *fsm) restoreRecords(r io.Reader, topic string) error {
+	log, err := f.topics.restoreLog(topic, 0)
+	if err != nil {
+		return err
+	}
+	return log.Restore(r)
+}
 
+func (f *fsm) restoreBookmarks(r io.Reader) error {
+	var count uint64
+	if err := binary.Read(r, enc, &count); err != nil {
+		return err
+	}
+
+	offsets := make(map[string]uint64, count)
+	for i := uint64(0); i < count; i++ {
+		var size uint64
+		if err := binary.Read(r, enc, &size); err != nil {
+			return err
+		}
+		b := make([]byte, size)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return err
+		}
+		bookmark := &api.Bookmark{}
+		if err := proto.Unmarshal(b, bookmark); err != nil {
+			return err
+		}
+		offsets[bookmark.Name] = bookmark.Offset
+	}
+	return f.bookmarks.replace(offsets)
+}
+
+func (f *fsm) restoreOffsets(r io.Reader) error {
+	var count uint64
+	if err := binary.Read(r, enc, &count); err != nil {
+		return err
+	}
+
+	offsets := make(map[string]map[string]uint64)
+	for i := uint64(0); i < count; i++ {
+		var size uint64
+		if err := binary.Read(r, enc, &size); err != nil {
+			return err
+		}
+		b := make([]byte, size)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return err
+		}
+		commit := &api.CommitOffsetRequest{}
+		if err := proto.Unmarshal(b, commit); err != nil {
+			return err
+		}
+		if offsets[commit.Group] == nil {
+			offsets[commit.Group] = make(map[string]uint64)
+		}
+		offsets[commit.Group][commit.Topic] = commit.Offset
+	}
+	return f.offsets.replace(offsets)
+}
+
+// restoreConfigs restores the topics' config overrides, they're applied to
+// the topics restored afterwards.
+func (f *fsm) restoreConfigs(r io.Reader) error {
+	var count uint64
+	if err := binary.Read(r, enc, &count); err != nil {
+		return err
+	}
+
+	configs := make(map[string]*api.TopicConfig, count)
+	for i := uint64(0); i < count; i++ {
+		var size uint64
+		if err := binary.Read(r, enc, &size); err != nil {
+			return err
+		}
+		b := make([]byte, size)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return err
+		}
+		req := &api.ConfigureTopicRequest{}
+		if err := proto.Unmarshal(b, req); err != nil {
+			return err
+		}
+		configs[req.Topic] = req.Config
+	}
+	f.topics.restoreConfigs(configs)
+	return nil
+}
+
+// readDeleted reads the deleted topics' deletion times, they're restored
+// once the topics are, see Topics.restoreDeleted.
+func readDeleted(r io.Reader) (map[string]time.Time, error) {
+	var count uint64
+	if err := binary.Read(r, enc, &count); err != nil {
+		return nil, err
+	}
+
+	deleted := make(map[string]time.Time, count)
+	for i := uint64(0); i < count; i++ {
+		var size uint64
+		if err := binary.Read(r, enc, &size); err != nil {
+			return nil, err
+		}
+		name := make([]byte, size)
+		if _, err := io.ReadFull(r, name); err != nil {
+			return nil, err
+		}
+		var at int64
+		if err := binary.Read(r, enc, &at); err != nil {
+			return nil, err
+		}
+		deleted[string(name)] = time.Unix(0, at)
+	}
+	return deleted, nil
+}
+
+// restoreReadOnly restores the mode from the rest of r.
+func (f *fsm) restoreReadOnly(r io.Reader) error {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	mode := &api.ReadOnlyMode{}
+	if err := proto.Unmarshal(b, mode); err != nil {
+		return err
+	}
+	f.readOnly.Store(mode)
 	return nil
 }
 
@@ -347,14 +1492,19 @@ var _ raft.LogStore = (*logStore)(nil)
 
 type logStore struct {
 	*Log
+	// stored holds the channels closed once the entries with the extensions
+	// they're keyed by are stored, see DistributedLog.AppendAcks
+	stored sync.Map
 }
 
 func newLogStore(dir string, c Config) (*logStore, error) {
+	// entries keep the time the leader appended them at, see StoreLogs
+	c.replicated = true
 	log, err := NewLog(dir, c)
 	if err != nil {
 		return nil, err
 	}
-	return &logStore{log}, nil
+	return &logStore{Log: log}, nil
 }
 
 func (l *logStore) FirstIndex() (uint64, error) {
@@ -366,8 +1516,13 @@ func (l *logStore) LastIndex() (uint64, error) {
 	return l.HighestOffset()
 }
 
+// GetLog implements raft.LogStore. Entries removed after a snapshot aren't
+// found, so raft sends the snapshot to followers needing them instead.
 func (l *logStore) GetLog(index uint64, out *raft.Log) error {
 	in, err := l.Read(index)
+	if _, ok := err.(api.ErrOffsetOutOfRange); ok {
+		return raft.ErrLogNotFound
+	}
 	if err != nil {
 		return err
 	}
@@ -376,6 +1531,9 @@ func (l *logStore) GetLog(index uint64, out *raft.Log) error {
 	out.Index = in.Offset
 	out.Type = raft.LogType(in.Type)
 	out.Term = in.Term
+	if in.Timestamp != nil {
+		out.AppendedAt = in.Timestamp.AsTime()
+	}
 	return nil
 }
 
@@ -383,26 +1541,66 @@ func (l *logStore) StoreLog(record *raft.Log) error {
 	return l.StoreLogs([]*raft.Log{record})
 }
 
+// StoreLogs implements raft.LogStore. Entries following a gap, e.g. the
+// first ones after a follower installed a snapshot, start the log over at
+// their index, the entries before are covered by the snapshot. The time the
+// leader appended an entry at is kept as its record's timestamp and set on
+// the entry as stored, it never decreases.
 func (l *logStore) StoreLogs(records []*raft.Log) error {
+	if len(records) > 0 {
+		highest, err := l.HighestOffset()
+		if err != nil {
+			return err
+		}
+		if records[0].Index > highest+1 {
+			l.Config.Segment.InitialOffset = records[0].Index
+			if err = l.Reset(); err != nil {
+				return err
+			}
+		}
+	}
 	for _, record := range records {
 		apiRec := &api.Record{
 			Value: record.Data,
 			Term:  record.Term,
 			Type:  uint32(record.Type),
 		}
+		if !record.AppendedAt.IsZero() {
+			apiRec.Timestamp = timestamppb.New(record.AppendedAt)
+		}
 		_, err := l.Append(apiRec)
 		if err != nil {
 			return err
 		}
+		record.AppendedAt = apiRec.Timestamp.AsTime()
+		l.notifyStored(record)
 	}
 	return nil
 }
 
-// DeleteRange implements raft.LogStore.
+// DeleteRange implements raft.LogStore. Removing all entries, e.g. once a
+// follower installed a snapshot, starts the log over after the removed ones.
 func (l *logStore) DeleteRange(min, max uint64) error {
+	highest, err := l.HighestOffset()
+	if err != nil {
+		return err
+	}
+	if max >= highest {
+		l.Config.Segment.InitialOffset = max + 1
+		return l.Reset()
+	}
 	return l.Truncate(max)
 }
 
+// IsMonotonic implements raft.MonotonicLogStore. The offsets of the log
+// follow each other without gaps, so raft removes all entries after
+// installing a snapshot instead of keeping those following it.
+func (l *logStore) IsMonotonic() bool {
+	return true
+}
+
+var _ raft.MonotonicLogStore = (*logStore)(nil)
+
 var _ raft.StreamLayer = new(StreamLayer)
 
 type StreamLayer struct {
@@ -1,9 +1,14 @@
 package log
 
 import (
+	"bytes"
+	"context"
+	"encoding/binary"
 	"fmt"
+	"io"
 	"net"
 	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
 	"time"
@@ -65,13 +70,13 @@ func TestMultipleNodes(t *testing.T) {
 
 	// assert  that logs are replicated to followers
 	for _, r := range records {
-		off, err := logs[0].Append(r)
+		off, err := logs[0].Append("", r)
 		require.NoError(t, err)
 		require.Eventually(
 			t,
 			func() bool {
 				for i := 0; i < nodeCount; i++ {
-					got, err := logs[i].Read(off)
+					got, err := logs[i].Read("", off)
 					if err != nil {
 						return false
 					}
@@ -88,6 +93,27 @@ func TestMultipleNodes(t *testing.T) {
 		)
 	}
 
+	offsets, err := logs[0].AppendBatch("", []*api.Record{
+		{Value: []byte("batched first")},
+		{Value: []byte("batched second")},
+	})
+	require.NoError(t, err)
+	require.Equal(t, []uint64{2, 3}, offsets)
+	require.Eventually(
+		t,
+		func() bool {
+			for i := 0; i < nodeCount; i++ {
+				got, err := logs[i].Read("", offsets[1])
+				if err != nil || string(got.Value) != "batched second" {
+					return false
+				}
+			}
+			return true
+		},
+		500*time.Millisecond,
+		50*time.Millisecond,
+	)
+
 	servers, err := logs[0].GetServers()
 	require.NoError(t, err)
 	require.Equal(t, 3, len(servers))
@@ -95,6 +121,19 @@ func TestMultipleNodes(t *testing.T) {
 	require.False(t, servers[1].IsLeader)
 	require.False(t, servers[2].IsLeader)
 
+	_, err = logs[1].Append("", &api.Record{Value: []byte("to follower")})
+	notLeader, ok := api.NotLeaderFromError(err)
+	require.True(t, ok)
+	require.Equal(t, servers[0].RpcAddr, notLeader.LeaderAddr)
+	require.True(t, notLeader.Term > 0)
+
+	got, err := logs[0].ReadLeader("", offsets[1])
+	require.NoError(t, err)
+	require.Equal(t, "batched second", string(got.Value))
+	_, err = logs[1].ReadLeader("", offsets[1])
+	_, ok = api.NotLeaderFromError(err)
+	require.True(t, ok)
+
 	err = logs[0].Leave("1")
 	require.NoError(t, err)
 
@@ -106,19 +145,681 @@ func TestMultipleNodes(t *testing.T) {
 
 	time.Sleep(50 * time.Millisecond)
 
-	off, err := logs[0].Append(&api.Record{
+	off, err := logs[0].Append("", &api.Record{
 		Value: []byte("third"),
 	})
 	require.NoError(t, err)
 
 	time.Sleep(50 * time.Millisecond)
 
-	record, err := logs[1].Read(off)
+	record, err := logs[1].Read("", off)
 	require.IsType(t, api.ErrOffsetOutOfRange{}, err)
 	require.Nil(t, record)
 
-	record, err = logs[2].Read(off)
+	record, err = logs[2].Read("", off)
 	require.NoError(t, err)
 	require.Equal(t, []byte("third"), record.Value)
 	require.Equal(t, off, record.Offset)
 }
+
+func TestRestartDoesNotReapply(t *testing.T) {
+	// arrange
+	dataDir := internal.GetTempDir(t, "distributed-log-test")
+	defer os.RemoveAll(dataDir)
+	addr := fmt.Sprintf("127.0.0.1:%d", internal.FreePort(t))
+
+	open := func() *DistributedLog {
+		ln, err := net.Listen("tcp", addr)
+		require.NoError(t, err)
+
+		config := Config{}
+		config.Raft.StreamLayer = NewStreamLayer(ln, nil, nil)
+		config.Raft.LocalID = raft.ServerID("0")
+		config.Raft.HeartbeatTimeout = 50 * time.Millisecond
+		config.Raft.ElectionTimeout = 50 * time.Millisecond
+		config.Raft.LeaderLeaseTimeout = 50 * time.Millisecond
+		config.Raft.CommitTimeout = 5 * time.Millisecond
+		config.Raft.BindAddr = addr
+		config.Raft.Bootstrap = true
+
+		dlog, err := NewDistributedLog(dataDir, config)
+		require.NoError(t, err)
+		require.NoError(t, dlog.WaitForLeader(3*time.Second))
+		return dlog
+	}
+
+	dlog := open()
+	off, err := dlog.Append("", &api.Record{Value: []byte("first")})
+	require.NoError(t, err)
+	require.Equal(t, uint64(0), off)
+	require.NoError(t, dlog.Close())
+
+	// act
+	dlog = open()
+	defer dlog.Close()
+	off, err = dlog.Append("", &api.Record{Value: []byte("second")})
+
+	// assert
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), off)
+	record, err := dlog.Read("", 0)
+	require.NoError(t, err)
+	require.Equal(t, []byte("first"), record.Value)
+}
+
+func TestReady(t *testing.T) {
+	// arrange
+	dataDir := internal.GetTempDir(t, "distributed-log-test")
+	defer os.RemoveAll(dataDir)
+	addr := fmt.Sprintf("127.0.0.1:%d", internal.FreePort(t))
+	ln, err := net.Listen("tcp", addr)
+	require.NoError(t, err)
+
+	config := Config{}
+	config.Raft.StreamLayer = NewStreamLayer(ln, nil, nil)
+	config.Raft.LocalID = raft.ServerID("0")
+	config.Raft.HeartbeatTimeout = 50 * time.Millisecond
+	config.Raft.ElectionTimeout = 50 * time.Millisecond
+	config.Raft.LeaderLeaseTimeout = 50 * time.Millisecond
+	config.Raft.CommitTimeout = 5 * time.Millisecond
+	config.Raft.BindAddr = addr
+	config.Raft.Bootstrap = true
+	dlog, err := NewDistributedLog(dataDir, config)
+	require.NoError(t, err)
+
+	// act
+	ready, changed := dlog.Ready()
+	for !ready {
+		select {
+		case <-changed:
+		case <-time.After(3 * time.Second):
+			require.Fail(t, "no leader elected")
+		}
+		ready, changed = dlog.Ready()
+	}
+	leader := <-dlog.LeadershipChanges()
+	require.NoError(t, dlog.Close())
+
+	// assert
+	require.True(t, leader)
+	_, ok := <-dlog.LeadershipChanges()
+	require.False(t, ok, "closing closes the leadership changes")
+	select {
+	case <-changed:
+	default:
+		require.Fail(t, "closing doesn't wake up waiters")
+	}
+	ready, changed = dlog.Ready()
+	require.False(t, ready)
+	require.Nil(t, changed)
+}
+
+func TestJoinZone(t *testing.T) {
+	// arrange
+	logs, addrs := setupZoneLogs(t, []string{"a", "a", "b"}, 2)
+	suffrage := func() map[raft.ServerID]raft.ServerSuffrage {
+		return raftSuffrage(t, logs[0])
+	}
+
+	// act
+	require.NoError(t, logs[0].JoinZone("1", addrs[1], "a"))
+	require.NoError(t, logs[0].JoinZone("2", addrs[2], "b"))
+
+	// assert
+	require.Equal(t, map[raft.ServerID]raft.ServerSuffrage{
+		"0": raft.Voter,
+		"1": raft.Nonvoter,
+		"2": raft.Voter,
+	}, suffrage(), "a voter of zone a makes room for zone b")
+
+	// act
+	require.NoError(t, logs[0].Leave("2"))
+
+	// assert
+	require.Equal(t, map[raft.ServerID]raft.ServerSuffrage{
+		"0": raft.Voter,
+		"1": raft.Voter,
+	}, suffrage(), "non-voters are promoted once a voter left")
+}
+
+func TestJoinNonvoter(t *testing.T) {
+	// arrange
+	logs, addrs := setupZoneLogs(t, []string{"a", "a", "b"}, 2)
+
+	// act
+	require.NoError(t, logs[0].JoinNonvoter("1", addrs[1], "a"))
+	require.NoError(t, logs[0].JoinZone("2", addrs[2], "b"))
+	require.NoError(t, logs[0].Leave("2"))
+	require.Eventually(t, func() bool {
+		_, leaderID := logs[1].raft.LeaderWithID()
+		return leaderID != ""
+	}, 3*time.Second, 50*time.Millisecond)
+	err := logs[1].JoinZone("2", addrs[2], "b")
+
+	// assert
+	require.Equal(t, map[raft.ServerID]raft.ServerSuffrage{
+		"0": raft.Voter,
+		"1": raft.Nonvoter,
+	}, raftSuffrage(t, logs[0]), "read replicas aren't promoted")
+	notLeader, ok := err.(api.ErrNotLeader)
+	require.True(t, ok, "followers point to the leader")
+	require.Equal(t, addrs[0], notLeader.LeaderAddr)
+}
+
+// setupZoneLogs starts a log per zone, the first one bootstraps the cluster
+// which the others are yet to join.
+func setupZoneLogs(t *testing.T, zones []string, maxVoters int) ([]*DistributedLog, []string) {
+	t.Helper()
+	var logs []*DistributedLog
+	var addrs []string
+	for i, zone := range zones {
+		dataDir := internal.GetTempDir(t, "distributed-log-test")
+		t.Cleanup(func() { os.RemoveAll(dataDir) })
+		ln, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", internal.FreePort(t)))
+		require.NoError(t, err)
+
+		config := Config{}
+		config.Raft.StreamLayer = NewStreamLayer(ln, nil, nil)
+		config.Raft.LocalID = raft.ServerID(fmt.Sprintf("%d", i))
+		config.Raft.HeartbeatTimeout = 50 * time.Millisecond
+		config.Raft.ElectionTimeout = 50 * time.Millisecond
+		config.Raft.LeaderLeaseTimeout = 50 * time.Millisecond
+		config.Raft.CommitTimeout = 5 * time.Millisecond
+		config.Raft.BindAddr = ln.Addr().String()
+		config.Raft.Bootstrap = i == 0
+		config.Raft.Zone = zone
+		config.Raft.MaxVoters = maxVoters
+
+		dlog, err := NewDistributedLog(dataDir, config)
+		require.NoError(t, err)
+		t.Cleanup(func() { dlog.Close() })
+		if i == 0 {
+			require.NoError(t, dlog.WaitForLeader(3*time.Second))
+		}
+		logs = append(logs, dlog)
+		addrs = append(addrs, ln.Addr().String())
+	}
+	return logs, addrs
+}
+
+func raftSuffrage(t *testing.T, l *DistributedLog) map[raft.ServerID]raft.ServerSuffrage {
+	future := l.raft.GetConfiguration()
+	require.NoError(t, future.Error())
+	got := make(map[raft.ServerID]raft.ServerSuffrage)
+	for _, srv := range future.Configuration().Servers {
+		got[srv.ID] = srv.Suffrage
+	}
+	return got
+}
+
+func TestSnapshotCatchUp(t *testing.T) {
+	// arrange
+	var logs []*DistributedLog
+	var addrs []string
+	for i := 0; i < 2; i++ {
+		dataDir := internal.GetTempDir(t, "distributed-log-test")
+		defer os.RemoveAll(dataDir)
+		ln, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", internal.FreePort(t)))
+		require.NoError(t, err)
+
+		config := Config{}
+		config.Raft.StreamLayer = NewStreamLayer(ln, nil, nil)
+		config.Raft.LocalID = raft.ServerID(fmt.Sprintf("%d", i))
+		config.Raft.HeartbeatTimeout = 50 * time.Millisecond
+		config.Raft.ElectionTimeout = 50 * time.Millisecond
+		config.Raft.LeaderLeaseTimeout = 50 * time.Millisecond
+		config.Raft.CommitTimeout = 5 * time.Millisecond
+		config.Raft.BindAddr = ln.Addr().String()
+		config.Raft.Bootstrap = i == 0
+		config.Raft.TrailingLogs = 1
+		config.Raft.SnapshotRetain = 2
+		// every entry gets a segment of its own, so the snapshot removes them
+		config.Segment.MaxStoreBytes = 1
+
+		dlog, err := NewDistributedLog(dataDir, config)
+		require.NoError(t, err)
+		defer dlog.Close()
+		logs = append(logs, dlog)
+		addrs = append(addrs, ln.Addr().String())
+	}
+	require.NoError(t, logs[0].WaitForLeader(3*time.Second))
+	for i := 0; i < 10; i++ {
+		_, err := logs[0].Append("", &api.Record{Value: []byte(fmt.Sprintf("record %d", i))})
+		require.NoError(t, err)
+	}
+
+	// act
+	require.NoError(t, logs[0].Snapshot())
+	first, err := logs[0].logStore.FirstIndex()
+	require.NoError(t, err)
+	require.Greater(t, first, uint64(2), "the entries before the snapshot are removed")
+	require.NoError(t, logs[0].Join("1", addrs[1]))
+
+	// assert
+	require.Eventually(t, func() bool {
+		for _, off := range []uint64{0, 9} {
+			record, err := logs[1].Read("", off)
+			if err != nil || string(record.Value) != fmt.Sprintf("record %d", off) {
+				return false
+			}
+		}
+		return true
+	}, 3*time.Second, 50*time.Millisecond, "the follower catches up from the snapshot")
+}
+
+func TestAppendAcks(t *testing.T) {
+	// arrange
+	dataDir := internal.GetTempDir(t, "distributed-log-test")
+	defer os.RemoveAll(dataDir)
+	dlog := setupSingleNode(t, dataDir)
+	defer dlog.Close()
+
+	// act
+	quorum, quorumErr := dlog.AppendAcks("", &api.Record{Value: []byte("quorum")}, api.Acks_ACKS_QUORUM)
+	leader, leaderErr := dlog.AppendAcks("", &api.Record{Value: []byte("leader")}, api.Acks_ACKS_LEADER)
+	none, noneErr := dlog.AppendAcks("", &api.Record{Value: []byte("none")}, api.Acks_ACKS_NONE)
+
+	// assert
+	require.NoError(t, quorumErr)
+	require.NoError(t, leaderErr)
+	require.NoError(t, noneErr)
+	require.Zero(t, quorum)
+	require.Zero(t, leader, "offsets are assigned once committed")
+	require.Zero(t, none)
+	require.Eventually(t, func() bool {
+		record, err := dlog.Read("", 2)
+		return err == nil && string(record.Value) == "none"
+	}, time.Second, 10*time.Millisecond)
+	record, err := dlog.Read("", 1)
+	require.NoError(t, err)
+	require.Equal(t, "leader", string(record.Value))
+	dlog.logStore.stored.Range(func(key, value interface{}) bool {
+		require.Fail(t, "waiters aren't removed")
+		return false
+	})
+}
+
+func TestAppendContext(t *testing.T) {
+	// arrange
+	dataDir := internal.GetTempDir(t, "distributed-log-test")
+	defer os.RemoveAll(dataDir)
+	dlog := setupSingleNode(t, dataDir)
+	defer dlog.Close()
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	// act
+	_, cancelledErr := dlog.AppendContext(cancelled, "", &api.Record{Value: []byte("cancelled")})
+	off, err := dlog.AppendContext(ctx, "", &api.Record{Value: []byte("hello world")})
+
+	// assert
+	require.ErrorIs(t, cancelledErr, context.Canceled)
+	require.NoError(t, err)
+	require.Zero(t, off, "the cancelled record wasn't appended")
+	record, err := dlog.ReadContext(ctx, "", off)
+	require.NoError(t, err)
+	require.Equal(t, "hello world", string(record.Value))
+	_, err = dlog.ReadContext(cancelled, "", off)
+	require.ErrorIs(t, err, context.Canceled)
+}
+
+func TestDistributedRetriedIDs(t *testing.T) {
+	// arrange
+	dataDir := internal.GetTempDir(t, "distributed-log-test")
+	defer os.RemoveAll(dataDir)
+	dlog := setupSingleNode(t, dataDir)
+	defer dlog.Close()
+	_, err := dlog.Append("", &api.Record{Value: []byte("first"), Id: []byte("first"), ProducerId: "p"})
+	require.NoError(t, err)
+	retry := &api.Record{Value: []byte("first"), Id: []byte("retry"), ProducerId: "p"}
+	_, err = dlog.AppendBatch("", []*api.Record{{Value: []byte("batch"), Id: []byte("batch"), ProducerId: "q"}})
+	require.NoError(t, err)
+	retriedBatch := []*api.Record{{Value: []byte("batch"), Id: []byte("retry"), ProducerId: "q"}}
+
+	// act
+	_, err = dlog.Append("", retry)
+	require.NoError(t, err)
+	_, err = dlog.AppendBatch("", retriedBatch)
+
+	// assert
+	require.NoError(t, err)
+	require.Equal(t, "first", string(retry.Id), "the stored id is returned")
+	require.Equal(t, "batch", string(retriedBatch[0].Id))
+}
+
+func TestAppendTransaction(t *testing.T) {
+	// arrange
+	dataDir := internal.GetTempDir(t, "distributed-log-test")
+	defer os.RemoveAll(dataDir)
+	dlog := setupSingleNode(t, dataDir)
+	defer dlog.Close()
+	order := &api.Record{Value: []byte("order")}
+
+	// act
+	res, err := dlog.AppendTransaction([]*api.TopicRecords{
+		{Topic: "orders", Records: []*api.Record{order}},
+		{Topic: "payments", Records: []*api.Record{{Value: []byte("payment")}}},
+	})
+
+	// assert
+	require.NoError(t, err)
+	require.Equal(t, []*api.TopicOffsets{
+		{Topic: "orders", Offsets: []uint64{0}},
+		{Topic: "payments", Offsets: []uint64{0}},
+	}, res)
+	require.Zero(t, order.Transaction, "the caller's records are left as they are")
+	record, err := dlog.Read("payments", 0)
+	require.NoError(t, err)
+	require.Equal(t, "payment", string(record.Value))
+	require.NotZero(t, record.Transaction)
+	_, err = dlog.Read("payments", 1)
+	require.IsType(t, api.ErrOffsetOutOfRange{}, err, "markers aren't read")
+}
+
+func TestDistributedTopicAdmin(t *testing.T) {
+	// arrange
+	dataDir := internal.GetTempDir(t, "distributed-log-test")
+	defer os.RemoveAll(dataDir)
+	dlog := setupSingleNode(t, dataDir)
+	defer dlog.Close()
+
+	// act
+	created, createErr := dlog.CreateTopic("orders", &api.TopicConfig{MaxStoreBytes: 4096})
+	_, existsErr := dlog.CreateTopic("orders", nil)
+	configured, configureErr := dlog.ConfigureTopic("orders", &api.TopicConfig{Compact: true})
+	deleteErr := dlog.DeleteTopic("orders")
+	_, describeErr := dlog.DescribeTopic("orders")
+
+	// assert
+	require.NoError(t, createErr)
+	require.Equal(t, uint64(4096), created.Config.MaxStoreBytes)
+	require.Equal(t, api.ErrTopicExists{Topic: "orders"}, existsErr)
+	require.NoError(t, configureErr)
+	require.True(t, configured.Config.Compact)
+	require.NoError(t, deleteErr)
+	require.Equal(t, api.ErrTopicNotFound{Topic: "orders"}, describeErr)
+}
+
+func TestDistributedUndeleteTopic(t *testing.T) {
+	// arrange
+	dataDir := internal.GetTempDir(t, "distributed-log-test")
+	defer os.RemoveAll(dataDir)
+	dlog := setupSingleNode(t, dataDir, func(c *Config) { c.TopicDeleteGracePeriod = time.Hour })
+	defer dlog.Close()
+	_, err := dlog.CreateTopic("orders", &api.TopicConfig{MaxStoreBytes: 4096})
+	require.NoError(t, err)
+	_, err = dlog.Append("orders", &api.Record{Value: []byte("order")})
+	require.NoError(t, err)
+
+	// act
+	before := time.Now()
+	deleteErr := dlog.DeleteTopic("orders")
+	deletedAt := dlog.topics.deletedTopics()["orders"]
+	_, appendErr := dlog.Append("orders", &api.Record{Value: []byte("order")})
+	names := dlog.Topics()
+	undeleted, undeleteErr := dlog.UndeleteTopic("orders")
+	_, notDeletedErr := dlog.UndeleteTopic("orders")
+
+	// assert
+	require.NoError(t, deleteErr)
+	require.WithinDuration(t, before, deletedAt, time.Second, "the leader's append time")
+	require.Equal(t, api.ErrTopicDeleted{Topic: "orders"}, appendErr)
+	require.Empty(t, names)
+	require.NoError(t, undeleteErr)
+	require.Equal(t, uint64(4096), undeleted.Config.MaxStoreBytes)
+	require.Equal(t, api.ErrTopicNotFound{Topic: "orders"}, notDeletedErr)
+	record, err := dlog.Read("orders", 0)
+	require.NoError(t, err)
+	require.Equal(t, []byte("order"), record.Value)
+}
+
+func TestDistributedPurgeTopics(t *testing.T) {
+	// arrange
+	dataDir := internal.GetTempDir(t, "distributed-log-test")
+	defer os.RemoveAll(dataDir)
+	dlog := setupSingleNode(t, dataDir, func(c *Config) {
+		c.TopicDeleteGracePeriod = 50 * time.Millisecond
+		c.Retention.CheckInterval = 10 * time.Millisecond
+	})
+	defer dlog.Close()
+	_, err := dlog.Append("orders", &api.Record{Value: []byte("order")})
+	require.NoError(t, err)
+
+	// act
+	err = dlog.DeleteTopic("orders")
+	require.NoError(t, err)
+
+	// assert
+	require.Eventually(t, func() bool {
+		return len(dlog.topics.deletedTopics()) == 0
+	}, 3*time.Second, 10*time.Millisecond, "the leader purges the topic")
+	_, err = dlog.UndeleteTopic("orders")
+	require.Equal(t, api.ErrTopicNotFound{Topic: "orders"}, err)
+	_, err = dlog.Append("orders", &api.Record{Value: []byte("order")})
+	require.NoError(t, err)
+}
+
+func TestLogStoreAppendedAt(t *testing.T) {
+	// arrange
+	dir := internal.GetTempDir(t, "log-store-test")
+	defer os.RemoveAll(dir)
+	c := Config{}
+	c.Segment.InitialOffset = 1
+	store, err := newLogStore(dir, c)
+	require.NoError(t, err)
+	defer store.Close()
+	appendedAt := time.Now().Add(-time.Hour)
+	entries := []*raft.Log{
+		{Index: 1, Term: 1, Data: []byte("first"), AppendedAt: appendedAt},
+		{Index: 2, Term: 1, Data: []byte("second"), AppendedAt: appendedAt.Add(-time.Minute)},
+	}
+
+	// act
+	err = store.StoreLogs(entries)
+	require.NoError(t, err)
+	var first, second raft.Log
+	require.NoError(t, store.GetLog(1, &first))
+	require.NoError(t, store.GetLog(2, &second))
+
+	// assert
+	require.True(t, appendedAt.Equal(first.AppendedAt), "followers apply the leader's time")
+	require.True(t, appendedAt.Equal(second.AppendedAt), "the time never decreases")
+	require.True(t, appendedAt.Equal(entries[1].AppendedAt), "the leader applies the stored time")
+}
+
+func TestDistributedReadOnly(t *testing.T) {
+	// arrange
+	dataDir := internal.GetTempDir(t, "distributed-log-test")
+	defer os.RemoveAll(dataDir)
+	dlog := setupSingleNode(t, dataDir)
+	defer dlog.Close()
+	initial := dlog.ReadOnly()
+
+	// act
+	err := dlog.SetReadOnly(&api.ReadOnlyMode{Enabled: true, Reason: "maintenance"})
+	require.NoError(t, err)
+	snap, err := dlog.fsm.Snapshot()
+	require.NoError(t, err)
+	sink := &testSnapshotSink{}
+	require.NoError(t, snap.Persist(sink))
+	topics, err := NewTopics(internal.GetTempDir(t, "distributed-log-test"), Config{})
+	require.NoError(t, err)
+	defer topics.Remove()
+	restored := &fsm{topics: topics, bookmarks: dlog.bookmarks, offsets: dlog.offsets}
+	err = restored.Restore(io.NopCloser(&sink.Buffer))
+
+	// assert
+	require.NoError(t, err)
+	require.False(t, initial.Enabled)
+	require.True(t, dlog.ReadOnly().Enabled)
+	require.Equal(t, "maintenance", restored.readOnlyMode().Reason, "snapshots keep the mode")
+	require.True(t, restored.readOnlyMode().Enabled)
+	require.NoError(t, dlog.SetReadOnly(nil))
+	require.False(t, dlog.ReadOnly().Enabled)
+}
+
+func TestSnapshotSections(t *testing.T) {
+	// unknown inserts a section the restore doesn't know ahead of the others
+	unknown := func(b []byte) []byte {
+		head := len(snapshotMagic) + 8
+		section := binary.BigEndian.AppendUint64(nil, 99)
+		section = binary.BigEndian.AppendUint64(section, 3)
+		section = append(section, "abc"...)
+		return append(append(append([]byte(nil), b[:head]...), section...), b[head:]...)
+	}
+	scenarios := map[string]struct {
+		change func(b []byte) []byte
+		err    string
+	}{
+		"all sections are restored":    {change: func(b []byte) []byte { return b }},
+		"unknown sections are skipped": {change: unknown},
+		"later versions are rejected": {
+			change: func(b []byte) []byte {
+				binary.BigEndian.PutUint64(b[len(snapshotMagic):], snapshotVersion+1)
+				return b
+			},
+			err: "unsupported snapshot version",
+		},
+	}
+
+	for scenario, sc := range scenarios {
+		t.Run(scenario, func(t *testing.T) {
+			// arrange
+			topics, err := NewTopics(internal.GetTempDir(t, "snapshot-test"), Config{})
+			require.NoError(t, err)
+			defer topics.Remove()
+			_, err = topics.CreateTopic("orders", &api.TopicConfig{MaxStoreBytes: 4096})
+			require.NoError(t, err)
+			_, err = topics.Append("orders", &api.Record{Value: []byte("order")})
+			require.NoError(t, err)
+			bookmarks, err := NewBookmarks(filepath.Join(topics.Dir, "bookmarks.json"))
+			require.NoError(t, err)
+			require.NoError(t, bookmarks.SetBookmark("orders-checkpoint", 1))
+			offsets, err := NewConsumerOffsets(filepath.Join(topics.Dir, "offsets.json"))
+			require.NoError(t, err)
+			f := &fsm{topics: topics, bookmarks: bookmarks, offsets: offsets}
+			f.readOnly.Store(&api.ReadOnlyMode{Enabled: true})
+			snap, err := f.Snapshot()
+			require.NoError(t, err)
+			sink := &testSnapshotSink{}
+			require.NoError(t, snap.Persist(sink))
+			restored, err := NewTopics(internal.GetTempDir(t, "snapshot-test"), Config{})
+			require.NoError(t, err)
+			defer restored.Remove()
+			target := &fsm{topics: restored, bookmarks: bookmarks, offsets: offsets}
+
+			// act
+			err = target.Restore(io.NopCloser(bytes.NewReader(sc.change(sink.Bytes()))))
+
+			// assert
+			if sc.err != "" {
+				require.ErrorContains(t, err, sc.err)
+				return
+			}
+			require.NoError(t, err)
+			record, err := restored.Read("orders", 0)
+			require.NoError(t, err)
+			require.Equal(t, "order", string(record.Value))
+			topic, err := restored.DescribeTopic("orders")
+			require.NoError(t, err)
+			require.Equal(t, uint64(4096), topic.Config.MaxStoreBytes)
+			require.True(t, target.readOnlyMode().Enabled)
+			require.Equal(t, map[string]uint64{"orders-checkpoint": 1}, bookmarks.all())
+		})
+	}
+}
+
+// setupSingleNode starts a distributed log bootstrapping a cluster of its own,
+// fns change its config.
+func setupSingleNode(t testing.TB, dataDir string, fns ...func(*Config)) *DistributedLog {
+	t.Helper()
+	addr := fmt.Sprintf("127.0.0.1:%d", internal.FreePort(t))
+	ln, err := net.Listen("tcp", addr)
+	require.NoError(t, err)
+
+	config := Config{}
+	config.Raft.StreamLayer = NewStreamLayer(ln, nil, nil)
+	config.Raft.LocalID = raft.ServerID("0")
+	config.Raft.HeartbeatTimeout = 50 * time.Millisecond
+	config.Raft.ElectionTimeout = 50 * time.Millisecond
+	config.Raft.LeaderLeaseTimeout = 50 * time.Millisecond
+	config.Raft.CommitTimeout = 5 * time.Millisecond
+	config.Raft.BindAddr = addr
+	config.Raft.Bootstrap = true
+	for _, fn := range fns {
+		fn(&config)
+	}
+	dlog, err := NewDistributedLog(dataDir, config)
+	require.NoError(t, err)
+	require.NoError(t, dlog.WaitForLeader(3*time.Second))
+	return dlog
+}
+
+func TestBootstrap(t *testing.T) {
+	// arrange
+	var logs []*DistributedLog
+	servers := make(map[string]string)
+	for i := 0; i < 3; i++ {
+		dataDir := internal.GetTempDir(t, "distributed-log-test")
+		t.Cleanup(func() { os.RemoveAll(dataDir) })
+		ln, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", internal.FreePort(t)))
+		require.NoError(t, err)
+
+		config := Config{}
+		config.Raft.StreamLayer = NewStreamLayer(ln, nil, nil)
+		config.Raft.LocalID = raft.ServerID(fmt.Sprintf("%d", i))
+		config.Raft.HeartbeatTimeout = 50 * time.Millisecond
+		config.Raft.ElectionTimeout = 50 * time.Millisecond
+		config.Raft.LeaderLeaseTimeout = 50 * time.Millisecond
+		config.Raft.CommitTimeout = 5 * time.Millisecond
+		config.Raft.BindAddr = ln.Addr().String()
+
+		dlog, err := NewDistributedLog(dataDir, config)
+		require.NoError(t, err)
+		t.Cleanup(func() { dlog.Close() })
+		logs = append(logs, dlog)
+		servers[fmt.Sprintf("%d", i)] = ln.Addr().String()
+	}
+
+	// act
+	for _, l := range logs {
+		require.NoError(t, l.Bootstrap(servers))
+	}
+
+	// assert
+	require.NoError(t, logs[0].WaitForLeader(3*time.Second))
+	for _, l := range logs {
+		require.Len(t, raftSuffrage(t, l), 3)
+	}
+	require.NoError(t, logs[1].Bootstrap(servers), "bootstrapping again is a no-op")
+}
+
+func BenchmarkDistributedAppend(b *testing.B) {
+	dataDir := internal.GetTempDir(b, "distributed-append-bench")
+	defer os.RemoveAll(dataDir)
+	dlog := setupSingleNode(b, dataDir)
+	defer dlog.Close()
+	record := func() *api.Record { return &api.Record{Value: []byte("hello world")} }
+
+	b.Run("serial", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := dlog.Append("", record()); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("parallel", func(b *testing.B) {
+		b.ReportAllocs()
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				if _, err := dlog.Append("", record()); err != nil {
+					b.Error(err)
+					return
+				}
+			}
+		})
+	})
+}
@@ -0,0 +1,120 @@
+package log
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// KeyProvider supplies the AES keys records are encrypted with. Each record
+// keeps the ID of its key, so keys can be rotated while old records stay readable.
+type KeyProvider interface {
+	// CurrentKey returns the key new records are encrypted with.
+	CurrentKey() (id uint32, key []byte, err error)
+	// Key returns the key of the given ID.
+	Key(id uint32) ([]byte, error)
+}
+
+// StaticKey is a KeyProvider of a single key with ID 0.
+type StaticKey []byte
+
+// NewStaticKey checks the key to be a valid AES-128, AES-192 or AES-256 key.
+func NewStaticKey(key []byte) (StaticKey, error) {
+	if _, err := aes.NewCipher(key); err != nil {
+		return nil, err
+	}
+	return StaticKey(key), nil
+}
+
+// LoadStaticKey reads a hex encoded key from the given file.
+func LoadStaticKey(path string) (StaticKey, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := hex.DecodeString(strings.TrimSpace(string(b)))
+	if err != nil {
+		return nil, fmt.Errorf("decoding key file %s: %w", path, err)
+	}
+	return NewStaticKey(key)
+}
+
+func (k StaticKey) CurrentKey() (uint32, []byte, error) {
+	return 0, k, nil
+}
+
+func (k StaticKey) Key(id uint32) ([]byte, error) {
+	if id != 0 {
+		return nil, fmt.Errorf("unknown key id %d", id)
+	}
+	return k, nil
+}
+
+// errNoKeys is returned for encrypted records read from a log without keys.
+var errNoKeys = errors.New("record is encrypted, but no keys are configured")
+
+const (
+	// encryptedFlag marks an encrypted record in its length, below the compression bits.
+	encryptedFlag = uint64(1) << 55
+	keyIDWidth    = 4
+)
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// encrypt seals p with the current key, prefixed by the key's ID and the nonce.
+func encrypt(keys KeyProvider, p []byte) ([]byte, error) {
+	id, key, err := keys.CurrentKey()
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	sealed := make([]byte, keyIDWidth+gcm.NonceSize(), keyIDWidth+gcm.NonceSize()+len(p)+gcm.Overhead())
+	enc.PutUint32(sealed, id)
+	if _, err = rand.Read(sealed[keyIDWidth:]); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(sealed, sealed[keyIDWidth:], p, nil), nil
+}
+
+// decrypt opens a record sealed by encrypt.
+func decrypt(keys KeyProvider, sealed []byte) ([]byte, error) {
+	if keys == nil {
+		return nil, errNoKeys
+	}
+	if len(sealed) < keyIDWidth {
+		return nil, errCorruptRecord
+	}
+	key, err := keys.Key(enc.Uint32(sealed))
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	sealed = sealed[keyIDWidth:]
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errCorruptRecord
+	}
+	p, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+	if err != nil {
+		return nil, errCorruptRecord
+	}
+	return p, nil
+}
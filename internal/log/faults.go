@@ -0,0 +1,65 @@
+package log
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Faults injects failures into logs, so tests of their users can reproduce
+// slow disks and failing syncs deterministically, see Config.Faults. Its
+// methods may be called while the logs are in use, the zero value injects
+// no failures.
+type Faults struct {
+	mu          sync.Mutex
+	appendDelay time.Duration
+	syncErr     error
+}
+
+// DelayAppends delays Append and AppendBatch by d before they take the log's
+// lock, zero stops delaying them.
+func (f *Faults) DelayAppends(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.appendDelay = d
+}
+
+// FailSyncs fails syncing the stores to stable storage with err, nil stops
+// failing. The records of failed syncs are synced by the next one.
+func (f *Faults) FailSyncs(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.syncErr = err
+}
+
+// delayAppend sleeps for the append delay unless ctx is done first, nil
+// faults don't delay.
+func (f *Faults) delayAppend(ctx context.Context) error {
+	if f == nil {
+		return nil
+	}
+	f.mu.Lock()
+	d := f.appendDelay
+	f.mu.Unlock()
+	if d == 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// syncError returns the error syncs fail with, nil faults don't fail them.
+func (f *Faults) syncError() error {
+	if f == nil {
+		return nil
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.syncErr
+}
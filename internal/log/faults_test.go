@@ -0,0 +1,122 @@
+package log
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	api "github.com/justagabriel/proglog/api/v1"
+	"github.com/justagabriel/proglog/internal"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFaults(t *testing.T) {
+	scenarios := map[string]func(t *testing.T, log *Log, faults *Faults){
+		"appends are delayed":                 testFaultsDelayAppends,
+		"failed syncs leave records pending":  testFaultsFailSyncs,
+		"delayed appends stop once done":      testFaultsDelayDone,
+		"failed batches keep earlier records": testFaultsPartialBatch,
+	}
+
+	for scenario, fn := range scenarios {
+		t.Run(scenario, func(t *testing.T) {
+			dir := internal.GetTempDir(t, "faults-test")
+			defer os.RemoveAll(dir)
+
+			faults := &Faults{}
+			config := Config{Faults: faults}
+			config.Segment.SyncPolicy.Interval = 10 * time.Millisecond
+			log, err := NewLog(dir, config)
+			require.NoError(t, err)
+			defer log.Close()
+
+			fn(t, log, faults)
+		})
+	}
+}
+
+func testFaultsDelayAppends(t *testing.T, log *Log, faults *Faults) {
+	// arrange
+	faults.DelayAppends(50 * time.Millisecond)
+	start := time.Now()
+
+	// act
+	_, err := log.Append(&api.Record{Value: []byte("hello world")})
+	require.NoError(t, err)
+	_, err = log.AppendBatch([]*api.Record{{Value: []byte("hello world")}})
+	require.NoError(t, err)
+
+	// assert
+	require.GreaterOrEqual(t, time.Since(start), 100*time.Millisecond)
+	faults.DelayAppends(0)
+	start = time.Now()
+	_, err = log.Append(&api.Record{Value: []byte("hello world")})
+	require.NoError(t, err)
+	require.Less(t, time.Since(start), 50*time.Millisecond)
+}
+
+func testFaultsFailSyncs(t *testing.T, log *Log, faults *Faults) {
+	// arrange
+	faults.FailSyncs(errors.New("input/output error"))
+
+	// act
+	_, err := log.Append(&api.Record{Value: []byte("hello world")})
+	require.NoError(t, err)
+	time.Sleep(30 * time.Millisecond)
+
+	// assert
+	require.Zero(t, log.DurableOffset())
+	faults.FailSyncs(nil)
+	_, err = log.Append(&api.Record{Value: []byte("hello world")})
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		return log.DurableOffset() == 2
+	}, time.Second, 5*time.Millisecond)
+}
+
+func testFaultsDelayDone(t *testing.T, log *Log, faults *Faults) {
+	// arrange
+	faults.DelayAppends(time.Hour)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	// act
+	_, err := log.AppendContext(ctx, &api.Record{Value: []byte("hello world")})
+
+	// assert
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	faults.DelayAppends(0)
+	off, err := log.Append(&api.Record{Value: []byte("hello world")})
+	require.NoError(t, err)
+	require.Zero(t, off, "the delayed record wasn't appended")
+}
+
+func testFaultsPartialBatch(t *testing.T, log *Log, faults *Faults) {
+	// arrange
+	syncErr := errors.New("input/output error")
+	faults.FailSyncs(syncErr)
+	records := []*api.Record{
+		{Value: make([]byte, 600)},
+		{Value: make([]byte, 600)},
+		{Value: []byte("third")},
+	}
+
+	// act
+	offsets, err := log.AppendBatch(records)
+
+	// assert
+	require.ErrorIs(t, err, syncErr, "rolling the filled segment fails")
+	require.Equal(t, []uint64{0, 1}, offsets)
+	for _, off := range offsets {
+		_, err := log.Read(off)
+		require.NoError(t, err)
+	}
+	_, err = log.Read(2)
+	require.Error(t, err, "records after the failure aren't appended")
+	faults.FailSyncs(nil)
+	retried, err := log.AppendBatch(records[len(offsets):])
+	require.NoError(t, err)
+	require.Equal(t, []uint64{2}, retried)
+}
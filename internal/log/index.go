@@ -1,8 +1,11 @@
 package log
 
 import (
+	"fmt"
 	"io"
 	"os"
+	"runtime"
+	"sort"
 
 	"github.com/tysonmote/gommap"
 )
@@ -11,52 +14,180 @@ var (
 	offWidth uint64 = 4
 	posWidth uint64 = 8
 	entWidth        = offWidth + posWidth
+	// indexGrowBytes is how much an index file grows at once, a multiple of
+	// entWidth so the mapping always ends after a whole entry.
+	indexGrowBytes = 1024 * entWidth
 )
 
+// IndexAccess selects how the index files of the OS' files are accessed.
+type IndexAccess uint8
+
+const (
+	// IndexAccessAuto maps the index files, except on Windows, which can't
+	// truncate mapped files.
+	IndexAccessAuto IndexAccess = iota
+	// IndexAccessMmap maps the index files into memory.
+	IndexAccessMmap
+	// IndexAccessPortable reads and writes the entries at their position
+	// with pread and pwrite, for platforms and network filesystems which
+	// don't handle mapped files well.
+	IndexAccessPortable
+)
+
+var indexAccessNames = map[IndexAccess]string{
+	IndexAccessAuto:     "auto",
+	IndexAccessMmap:     "mmap",
+	IndexAccessPortable: "portable",
+}
+
+func (a IndexAccess) String() string {
+	if name, ok := indexAccessNames[a]; ok {
+		return name
+	}
+	return fmt.Sprintf("IndexAccess(%d)", a)
+}
+
+// ParseIndexAccess returns the index access of the given name, see
+// IndexAccess.String.
+func ParseIndexAccess(name string) (IndexAccess, error) {
+	for a, n := range indexAccessNames {
+		if n == name {
+			return a, nil
+		}
+	}
+	return IndexAccessAuto, fmt.Errorf("unknown index access %q", name)
+}
+
+// mapped tells whether index files of the OS' files are mapped.
+func (a IndexAccess) mapped() bool {
+	if a == IndexAccessAuto {
+		return runtime.GOOS != "windows"
+	}
+	return a == IndexAccessMmap
+}
+
+// index maps its file, which grows in chunks up to MaxIndexBytes as entries
+// are written and is truncated to the entries on close. The entries of an
+// index which wasn't closed are followed by zeros, see segment.recover.
+// Files other than the OS' are read into memory and written through instead.
+// With IndexAccessPortable the OS' files are neither mapped nor read into
+// memory, each entry is read and written at its position in the file.
 type index struct {
-	file *os.File
-	mmap gommap.MMap
-	size uint64
+	file File
+	// mmap holds the mapped file or the copy of other files, nil for
+	// portable indexes
+	mmap     gommap.MMap
+	portable bool
+	size     uint64
+	maxBytes uint64
 }
 
-func newIndex(f *os.File, c Config) (*index, error) {
+func newIndex(f File, c Config) (*index, error) {
+	_, osFile := f.(*os.File)
 	idx := &index{
-		file: f,
+		file:     f,
+		portable: osFile && !c.Segment.IndexAccess.mapped(),
+		maxBytes: c.Segment.MaxIndexBytes,
 	}
-	fi, err := os.Stat(f.Name())
+	fi, err := f.Stat()
 	if err != nil {
 		return nil, err
 	}
 
 	idx.size = uint64(fi.Size())
-	err = os.Truncate(f.Name(), int64(c.Segment.MaxIndexBytes))
-	if err != nil {
+	if idx.portable {
+		return idx, nil
+	}
+	if err = idx.remap(idx.size); err != nil {
 		return nil, err
 	}
+	return idx, nil
+}
 
-	idx.mmap, err = gommap.Map(
-		idx.file.Fd(),
-		gommap.PROT_READ|gommap.PROT_WRITE,
-		gommap.MAP_SHARED,
-	)
+// remap grows the file to hold at least min bytes and maps it. The file grows
+// to the next chunk capped by MaxIndexBytes, it never shrinks, so entries of
+// an index whose MaxIndexBytes was lowered are kept.
+func (i *index) remap(min uint64) error {
+	capacity := (min + indexGrowBytes - 1) / indexGrowBytes * indexGrowBytes
+	if capacity == 0 {
+		capacity = indexGrowBytes
+	}
+	if capacity > i.maxBytes {
+		capacity = i.maxBytes
+	}
+	if capacity < min {
+		capacity = min
+	}
+
+	osFile, mapped := i.file.(*os.File)
+	if i.mmap != nil && mapped {
+		if err := i.mmap.UnsafeUnmap(); err != nil {
+			return err
+		}
+		i.mmap = nil
+	}
+	fi, err := i.file.Stat()
 	if err != nil {
-		return nil, err
+		return err
+	}
+	if uint64(fi.Size()) < capacity {
+		if err = i.file.Truncate(int64(capacity)); err != nil {
+			return err
+		}
+	}
+	if capacity == 0 {
+		return nil
 	}
 
-	return idx, nil
+	if !mapped {
+		buf := make(gommap.MMap, capacity)
+		if _, err = i.file.ReadAt(buf, 0); err != nil && err != io.EOF {
+			return err
+		}
+		i.mmap = buf
+		return nil
+	}
+	i.mmap, err = gommap.MapRegion(
+		osFile.Fd(),
+		0,
+		int64(capacity),
+		gommap.PROT_READ|gommap.PROT_WRITE,
+		gommap.MAP_SHARED,
+	)
+	return err
 }
 
 func (i *index) Close() error {
-	err := i.mmap.Sync(gommap.MS_SYNC)
-	if err != nil {
-		return err
+	if _, mapped := i.file.(*os.File); !mapped {
+		i.mmap = nil
+	}
+	if i.mmap != nil {
+		err := i.mmap.Sync(gommap.MS_SYNC)
+		if err != nil {
+			return err
+		}
+		err = i.mmap.UnsafeUnmap()
+		if err != nil {
+			return err
+		}
+		i.mmap = nil
 	}
 
-	err = i.file.Sync()
+	err := i.file.Sync()
 	if err != nil {
 		return err
 	}
 
+	if i.portable {
+		// only files recovered from a mapped index hold more than the entries
+		fi, err := i.file.Stat()
+		if err != nil {
+			return err
+		}
+		if uint64(fi.Size()) == i.size {
+			return i.file.Close()
+		}
+	}
 	err = i.file.Truncate(int64(i.size))
 	if err != nil {
 		return err
@@ -80,19 +211,92 @@ func (i *index) Read(in int64) (out uint32, pos uint64, err error) {
 	if i.size < pos+entWidth {
 		return 0, 0, io.EOF
 	}
+	return i.entry(pos)
+}
 
-	out = enc.Uint32(i.mmap[pos : pos+offWidth])
-	pos = enc.Uint64(i.mmap[pos+offWidth : pos+entWidth])
-	return out, pos, nil
+// entry reads the entry at the position, which has to be below i.size.
+func (i *index) entry(pos uint64) (off uint32, at uint64, err error) {
+	ent := []byte(i.mmap)
+	if i.portable {
+		ent = make([]byte, entWidth)
+		if _, err = i.file.ReadAt(ent, int64(pos)); err != nil {
+			return 0, 0, err
+		}
+		pos = 0
+	}
+	return enc.Uint32(ent[pos : pos+offWidth]), enc.Uint64(ent[pos+offWidth : pos+entWidth]), nil
+}
+
+// floor returns the entry with the greatest relative offset not above off,
+// io.EOF if there is none. Sparse and compacted indexes lack entries, so
+// they're searched if the slot doesn't match.
+func (i *index) floor(off uint32) (out uint32, pos uint64, err error) {
+	out, pos, err = i.Read(int64(off))
+	if err == nil && out == off {
+		return out, pos, nil
+	}
+
+	var searchErr error
+	slot := sort.Search(i.entries(), func(n int) bool {
+		entOff, _, err := i.entry(uint64(n) * entWidth)
+		if err != nil && searchErr == nil {
+			searchErr = err
+		}
+		return entOff > off
+	})
+	if searchErr != nil {
+		return 0, 0, searchErr
+	}
+	if slot == 0 {
+		return 0, 0, io.EOF
+	}
+	return i.Read(int64(slot - 1))
+}
+
+// entries returns the number of entries, see Config.Segment.IndexInterval.
+func (i *index) entries() int {
+	return int(i.size / entWidth)
+}
+
+// utilization returns the share of MaxIndexBytes in use, the segment is
+// full once it reaches one.
+func (i *index) utilization() float64 {
+	if i.maxBytes == 0 {
+		return 0
+	}
+	return float64(i.size) / float64(i.maxBytes)
 }
 
 func (i *index) Write(off uint32, pos uint64) error {
+	if i.portable {
+		if i.size+entWidth > i.maxBytes {
+			return io.EOF
+		}
+		ent := make([]byte, 0, entWidth)
+		ent = enc.AppendUint32(ent, off)
+		ent = enc.AppendUint64(ent, pos)
+		if _, err := i.file.WriteAt(ent, int64(i.size)); err != nil {
+			return err
+		}
+		i.size += entWidth
+		return nil
+	}
 	if uint64(len(i.mmap)) < i.size+entWidth {
-		return io.EOF
+		if i.size+entWidth > i.maxBytes {
+			return io.EOF
+		}
+		if err := i.remap(i.size + entWidth); err != nil {
+			return err
+		}
 	}
 
 	enc.PutUint32(i.mmap[i.size:i.size+offWidth], off)
 	enc.PutUint64(i.mmap[i.size+offWidth:i.size+entWidth], pos)
+	if _, mapped := i.file.(*os.File); !mapped {
+		if _, err := i.file.WriteAt(i.mmap[i.size:i.size+entWidth], int64(i.size)); err != nil {
+			return err
+		}
+	}
 	i.size += uint64(entWidth)
 	return nil
 }
@@ -3,6 +3,7 @@ package log
 import (
 	"io"
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/justagabriel/proglog/internal"
@@ -52,3 +53,139 @@ func TestIndex(t *testing.T) {
 	require.Equal(t, uint32(1), off)
 	require.Equal(t, entries[1].Pos, pos)
 }
+
+func TestIndexGrowth(t *testing.T) {
+	// arrange
+	f := internal.GetTempFile(t, "", "index_test")
+	defer os.Remove(f.Name())
+	c := Config{}
+	c.Segment.MaxIndexBytes = 2*indexGrowBytes + entWidth
+	idx, err := newIndex(f, c)
+	require.NoError(t, err)
+	fileSize := func() int64 {
+		fi, err := os.Stat(f.Name())
+		require.NoError(t, err)
+		return fi.Size()
+	}
+	require.Equal(t, int64(indexGrowBytes), fileSize(), "the file starts with a single chunk")
+
+	// act
+	entries := uint32(indexGrowBytes/entWidth) + 1
+	for off := uint32(0); off < entries; off++ {
+		require.NoError(t, idx.Write(off, uint64(off)*10))
+	}
+
+	// assert
+	require.Equal(t, int64(2*indexGrowBytes), fileSize())
+	for off := uint32(0); off < entries; off++ {
+		_, pos, err := idx.Read(int64(off))
+		require.NoError(t, err)
+		require.Equal(t, uint64(off)*10, pos)
+	}
+
+	// act
+	for off := entries; off < 2*entries-1; off++ {
+		require.NoError(t, idx.Write(off, uint64(off)*10))
+	}
+
+	// assert
+	require.Equal(t, int64(c.Segment.MaxIndexBytes), fileSize(), "growth is capped")
+	require.Equal(t, io.EOF, idx.Write(2*entries-1, 0))
+	require.NoError(t, idx.Close())
+	require.Equal(t, int64(c.Segment.MaxIndexBytes), fileSize())
+}
+
+func TestIndexPortable(t *testing.T) {
+	// arrange
+	f := internal.GetTempFile(t, "", "index_test")
+	defer os.Remove(f.Name())
+	c := Config{}
+	c.Segment.MaxIndexBytes = 4 * entWidth
+	mapped, err := newIndex(f, c)
+	require.NoError(t, err)
+	require.NoError(t, mapped.Write(0, 0))
+	// a crash leaves the chunk's zeros behind the entries
+	require.NoError(t, mapped.mmap.UnsafeUnmap())
+	require.NoError(t, f.Close())
+	fileSize := func() int64 {
+		fi, err := os.Stat(f.Name())
+		require.NoError(t, err)
+		return fi.Size()
+	}
+	c.Segment.IndexAccess = IndexAccessPortable
+	f, err = os.OpenFile(f.Name(), os.O_RDWR, 0600)
+	require.NoError(t, err)
+
+	// act
+	idx, err := newIndex(f, c)
+	require.NoError(t, err)
+	idx.size = entWidth // see segment.recover
+	require.NoError(t, idx.Write(2, 20))
+	require.NoError(t, idx.Write(4, 40))
+
+	// assert
+	require.Nil(t, idx.mmap, "the file isn't mapped")
+	out, pos, err := idx.floor(3)
+	require.NoError(t, err)
+	require.Equal(t, uint32(2), out)
+	require.Equal(t, uint64(20), pos)
+	out, pos, err = idx.Read(-1)
+	require.NoError(t, err)
+	require.Equal(t, uint32(4), out)
+	require.Equal(t, uint64(40), pos)
+	require.NoError(t, idx.Write(5, 50))
+	require.Equal(t, io.EOF, idx.Write(6, 60), "MaxIndexBytes is kept")
+	require.NoError(t, idx.Close())
+	require.Equal(t, int64(4*entWidth), fileSize(), "the zeros are truncated")
+
+	// act
+	f, err = os.OpenFile(f.Name(), os.O_RDWR, 0600)
+	require.NoError(t, err)
+	idx, err = newIndex(f, c)
+	require.NoError(t, err)
+	defer idx.Close()
+
+	// assert
+	require.Equal(t, uint64(4*entWidth), idx.size)
+	_, pos, err = idx.Read(1)
+	require.NoError(t, err)
+	require.Equal(t, uint64(20), pos)
+}
+
+func TestParseIndexAccess(t *testing.T) {
+	for _, access := range []IndexAccess{IndexAccessAuto, IndexAccessMmap, IndexAccessPortable} {
+		parsed, err := ParseIndexAccess(access.String())
+		require.NoError(t, err)
+		require.Equal(t, access, parsed)
+	}
+	_, err := ParseIndexAccess("pread")
+	require.Error(t, err)
+}
+
+func FuzzIndexRead(f *testing.F) {
+	entries := make([]byte, 0, 2*entWidth)
+	entries = enc.AppendUint32(entries, 0)
+	entries = enc.AppendUint64(entries, 0)
+	entries = enc.AppendUint32(entries, 1)
+	entries = enc.AppendUint64(entries, 10)
+	f.Add(entries, int64(1), uint32(1))
+	f.Add(entries[:entWidth+1], int64(-1), uint32(0))
+	f.Add(make([]byte, 2048), int64(-1), uint32(7))
+
+	f.Fuzz(func(t *testing.T, data []byte, in int64, off uint32) {
+		file, err := os.Create(filepath.Join(t.TempDir(), "fuzz.index"))
+		require.NoError(t, err)
+		_, err = file.Write(data)
+		require.NoError(t, err)
+		c := Config{}
+		c.Segment.MaxIndexBytes = 1024
+		idx, err := newIndex(file, c)
+		require.NoError(t, err)
+		defer idx.Close()
+
+		// entries beyond the index fail to be read, they don't panic
+		_, _, _ = idx.Read(in)
+		_, _, _ = idx.Read(-1)
+		_, _, _ = idx.floor(off)
+	})
+}
@@ -0,0 +1,473 @@
+package log
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	api "github.com/justagabriel/proglog/api/v1"
+)
+
+// Kafka record batch v2 layout, see https://kafka.apache.org/documentation/#recordbatch
+const (
+	kafkaMagic = 2
+	// batch fields up to and including the record count
+	kafkaBatchHeaderLen = 61
+	// baseOffset and batchLength precede the part counted by batchLength
+	kafkaBatchPrefixLen = 12
+	// the crc covers everything from the attributes onwards
+	kafkaCRCStart = 21
+	// kafkaMinRecordLen is the size of an empty record: its length,
+	// attributes, timestamp and offset deltas, key and value lengths and
+	// header count take a byte each
+	kafkaMinRecordLen = 7
+
+	kafkaCompressionMask = 0x07
+	kafkaCompressionGzip = 1
+	kafkaControlFlag     = 0x20
+
+	// kafkaTypeHeader carries a record's type, as Kafka records have no such field.
+	kafkaTypeHeader = "proglog.type"
+
+	maxKafkaBatchRecords = 1000
+	maxKafkaBatchBytes   = 1 << 20
+)
+
+var kafkaCRCTable = crc32.MakeTable(crc32.Castagnoli)
+
+// Appender is implemented by Log, use AppenderFunc to append to a topic.
+type Appender interface {
+	Append(record *api.Record) (uint64, error)
+}
+
+// AppenderFunc adapts a function to an Appender, e.g. to append to a topic
+// of Topics or DistributedLog.
+type AppenderFunc func(record *api.Record) (uint64, error)
+
+func (f AppenderFunc) Append(record *api.Record) (uint64, error) {
+	return f(record)
+}
+
+// ExportKafka writes the log's records into dir as Kafka log segment files,
+// one per segment including tiered ones, see KafkaExporter. Records are read
+// like Read does, so transaction markers, aborted transactions and deleted or
+// expired records are left out. The log isn't locked while exporting, records
+// appended meanwhile aren't exported.
+func (l *Log) ExportKafka(dir string) error {
+	l.mu.RLock()
+	var bases []uint64
+	for _, remote := range l.remote {
+		bases = append(bases, remote.BaseOffset)
+	}
+	for _, s := range l.segments {
+		bases = append(bases, s.baseOffset)
+	}
+	start, end := l.logStart(), l.activeSegment.nextOffset
+	l.mu.RUnlock()
+
+	e, err := NewKafkaExporter(dir)
+	if err != nil {
+		return err
+	}
+	defer e.Close()
+	for i, base := range bases {
+		next := end
+		if i+1 < len(bases) {
+			next = bases[i+1]
+		}
+		if base < start {
+			base = start
+		}
+		for off := base; off < next; off++ {
+			record, err := l.Read(off)
+			if _, ok := err.(api.ErrOffsetOutOfRange); ok {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if err = e.Write(record); err != nil {
+				return err
+			}
+		}
+		if err = e.Roll(); err != nil {
+			return err
+		}
+	}
+	return e.Close()
+}
+
+// KafkaExporter writes records into dir as Kafka log segment files, so that
+// dir can be used as a partition directory (e.g. "<topic>-0") of a broker.
+// Kafka rebuilds the missing offset and time indexes when loading the
+// segments. Records have to be written in offset order, there may be gaps.
+// Records appended before records had timestamps get the time of the export.
+type KafkaExporter struct {
+	dir       string
+	timestamp int64
+	// f is the segment file written to, nil until the next record
+	f          *os.File
+	w          *bufio.Writer
+	batch      []*api.Record
+	batchBytes int
+}
+
+func NewKafkaExporter(dir string) (*KafkaExporter, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &KafkaExporter{dir: dir, timestamp: time.Now().UnixMilli()}, nil
+}
+
+// Write adds the record to the current segment file, a new one named after
+// the record's offset is created if there's none.
+func (e *KafkaExporter) Write(record *api.Record) error {
+	if e.f == nil {
+		f, err := os.Create(filepath.Join(e.dir, fmt.Sprintf("%020d.log", record.Offset)))
+		if err != nil {
+			return err
+		}
+		e.f, e.w = f, bufio.NewWriter(f)
+	}
+	if len(e.batch) > 0 && (e.batch[0].Term != record.Term ||
+		len(e.batch) == maxKafkaBatchRecords ||
+		e.batchBytes+len(record.Value) > maxKafkaBatchBytes) {
+		if err := e.flush(); err != nil {
+			return err
+		}
+	}
+	e.batch = append(e.batch, record)
+	e.batchBytes += len(record.Value)
+	return nil
+}
+
+func (e *KafkaExporter) flush() error {
+	if len(e.batch) == 0 {
+		return nil
+	}
+	_, err := e.w.Write(encodeKafkaBatch(e.batch, e.timestamp))
+	e.batch, e.batchBytes = e.batch[:0], 0
+	return err
+}
+
+// Roll syncs and closes the current segment file, the next record starts a
+// new one.
+func (e *KafkaExporter) Roll() error {
+	if e.f == nil {
+		return nil
+	}
+	err := e.flush()
+	if err == nil {
+		err = e.w.Flush()
+	}
+	if err == nil {
+		err = e.f.Sync()
+	}
+	if cerr := e.f.Close(); err == nil {
+		err = cerr
+	}
+	e.f, e.w = nil, nil
+	return err
+}
+
+// Close finishes the current segment file like Roll.
+func (e *KafkaExporter) Close() error {
+	return e.Roll()
+}
+
+// kafkaTimestamp returns the record's timestamp in milliseconds, the fallback if it has none.
+func kafkaTimestamp(record *api.Record, fallback int64) int64 {
+	if record.Timestamp == nil {
+		return fallback
+	}
+	return record.Timestamp.AsTime().UnixMilli()
+}
+
+func encodeKafkaBatch(records []*api.Record, timestamp int64) []byte {
+	var body []byte
+	first := kafkaTimestamp(records[0], timestamp)
+	max := first
+	for _, record := range records {
+		ts := kafkaTimestamp(record, timestamp)
+		if ts > max {
+			max = ts
+		}
+		body = appendKafkaRecord(body, record, int64(record.Offset-records[0].Offset), ts-first)
+	}
+
+	b := make([]byte, kafkaBatchHeaderLen, kafkaBatchHeaderLen+len(body))
+	enc := binary.BigEndian
+	enc.PutUint64(b[0:], records[0].Offset)
+	enc.PutUint32(b[8:], uint32(kafkaBatchHeaderLen-kafkaBatchPrefixLen+len(body)))
+	// the term is the closest thing to Kafka's partition leader epoch
+	enc.PutUint32(b[12:], uint32(records[0].Term))
+	b[16] = kafkaMagic
+	enc.PutUint16(b[21:], 0) // attributes: no compression, create time
+	enc.PutUint32(b[23:], uint32(records[len(records)-1].Offset-records[0].Offset))
+	enc.PutUint64(b[27:], uint64(first))
+	enc.PutUint64(b[35:], uint64(max))
+	enc.PutUint64(b[43:], ^uint64(0)) // producer id -1: not idempotent
+	enc.PutUint16(b[51:], ^uint16(0)) // producer epoch -1
+	enc.PutUint32(b[53:], ^uint32(0)) // base sequence -1
+	enc.PutUint32(b[57:], uint32(len(records)))
+	b = append(b, body...)
+
+	enc.PutUint32(b[17:], crc32.Checksum(b[kafkaCRCStart:], kafkaCRCTable))
+	return b
+}
+
+func appendKafkaRecord(b []byte, record *api.Record, offsetDelta, timestampDelta int64) []byte {
+	r := []byte{0} // attributes
+	r = binary.AppendVarint(r, timestampDelta)
+	r = binary.AppendVarint(r, offsetDelta)
+	if len(record.Key) == 0 {
+		r = binary.AppendVarint(r, -1) // null key
+	} else {
+		r = binary.AppendVarint(r, int64(len(record.Key)))
+		r = append(r, record.Key...)
+	}
+	if record.Tombstone {
+		r = binary.AppendVarint(r, -1) // null value
+	} else {
+		r = binary.AppendVarint(r, int64(len(record.Value)))
+		r = append(r, record.Value...)
+	}
+	headers := int64(len(record.Headers))
+	if record.Type != 0 {
+		headers++
+	}
+	r = binary.AppendVarint(r, headers)
+	if record.Type != 0 {
+		r = appendKafkaHeader(r, kafkaTypeHeader, []byte(strconv.FormatUint(uint64(record.Type), 10)))
+	}
+	for _, header := range record.Headers {
+		r = appendKafkaHeader(r, header.Key, header.Value)
+	}
+
+	b = binary.AppendVarint(b, int64(len(r)))
+	return append(b, r...)
+}
+
+func appendKafkaHeader(b []byte, key string, value []byte) []byte {
+	b = binary.AppendVarint(b, int64(len(key)))
+	b = append(b, key...)
+	b = binary.AppendVarint(b, int64(len(value)))
+	return append(b, value...)
+}
+
+// ImportKafka appends the records of the Kafka log segment files in dir to the
+// log in offset order and returns how many records were imported. Records get
+// new offsets assigned by the log, timestamps are dropped.
+func ImportKafka(dir string, log Appender) (int, error) {
+	names, err := filepath.Glob(filepath.Join(dir, "*.log"))
+	if err != nil {
+		return 0, err
+	}
+	// segment names are zero padded base offsets, so they sort by offset
+	sort.Strings(names)
+
+	var n int
+	for _, name := range names {
+		imported, err := importKafkaSegment(name, log)
+		n += imported
+		if err != nil {
+			return n, fmt.Errorf("%s: %w", filepath.Base(name), err)
+		}
+	}
+	return n, nil
+}
+
+func importKafkaSegment(name string, log Appender) (int, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	var n int
+	for {
+		batch, err := readKafkaBatch(r)
+		if err == io.EOF {
+			return n, nil
+		}
+		if err != nil {
+			return n, err
+		}
+
+		records, err := decodeKafkaBatch(batch)
+		if err != nil {
+			return n, err
+		}
+		for _, record := range records {
+			if _, err = log.Append(record); err != nil {
+				return n, err
+			}
+			n++
+		}
+	}
+}
+
+func readKafkaBatch(r io.Reader) ([]byte, error) {
+	prefix := make([]byte, kafkaBatchPrefixLen)
+	if _, err := io.ReadFull(r, prefix); err != nil {
+		return nil, err
+	}
+
+	length := binary.BigEndian.Uint32(prefix[8:])
+	if length < kafkaBatchHeaderLen-kafkaBatchPrefixLen || length > maxKafkaBatchBytes*4 {
+		return nil, fmt.Errorf("invalid batch length %d", length)
+	}
+
+	b := make([]byte, kafkaBatchPrefixLen+int(length))
+	copy(b, prefix)
+	if _, err := io.ReadFull(r, b[kafkaBatchPrefixLen:]); err != nil {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return b, nil
+}
+
+func decodeKafkaBatch(b []byte) ([]*api.Record, error) {
+	enc := binary.BigEndian
+	if b[16] != kafkaMagic {
+		return nil, fmt.Errorf("unsupported record batch version %d", b[16])
+	}
+	if crc32.Checksum(b[kafkaCRCStart:], kafkaCRCTable) != enc.Uint32(b[17:]) {
+		return nil, errors.New("record batch checksum mismatch")
+	}
+
+	attributes := enc.Uint16(b[21:])
+	if attributes&kafkaControlFlag != 0 {
+		// transaction markers don't hold any data
+		return nil, nil
+	}
+
+	term := uint64(0)
+	if epoch := int32(enc.Uint32(b[12:])); epoch > 0 {
+		term = uint64(epoch)
+	}
+	count := int(int32(enc.Uint32(b[57:])))
+	if count < 0 {
+		return nil, fmt.Errorf("invalid record count %d", count)
+	}
+
+	body := b[kafkaBatchHeaderLen:]
+	switch attributes & kafkaCompressionMask {
+	case 0:
+	case kafkaCompressionGzip:
+		zr, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		if body, err = io.ReadAll(zr); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported compression codec %d", attributes&kafkaCompressionMask)
+	}
+
+	// the count comes from the file, it mustn't size the allocation unchecked
+	if count > len(body)/kafkaMinRecordLen {
+		return nil, fmt.Errorf("invalid record count %d for %d bytes of records", count, len(body))
+	}
+	records := make([]*api.Record, 0, count)
+	d := &kafkaDecoder{b: body}
+	for i := 0; i < count; i++ {
+		record, err := d.record()
+		if err != nil {
+			return nil, err
+		}
+		record.Term = term
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+type kafkaDecoder struct {
+	b   []byte
+	err error
+}
+
+var errKafkaRecordTruncated = errors.New("record truncated")
+
+func (d *kafkaDecoder) varint() int64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(d.b)
+	if n <= 0 {
+		d.err = errKafkaRecordTruncated
+		return 0
+	}
+	d.b = d.b[n:]
+	return v
+}
+
+// bytes returns a length prefixed field, nil for null.
+func (d *kafkaDecoder) bytes() []byte {
+	n := d.varint()
+	if d.err != nil || n < 0 {
+		return nil
+	}
+	if int64(len(d.b)) < n {
+		d.err = errKafkaRecordTruncated
+		return nil
+	}
+	v := d.b[:n]
+	d.b = d.b[n:]
+	return v
+}
+
+func (d *kafkaDecoder) record() (*api.Record, error) {
+	length := d.varint()
+	if d.err == nil && (length < 1 || int64(len(d.b)) < length) {
+		d.err = errKafkaRecordTruncated
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	rest := d.b[length:]
+	d.b = d.b[1:length] // attributes are unused
+
+	d.varint() // timestamp delta
+	d.varint() // offset delta
+	key, value := d.bytes(), d.bytes()
+	record := &api.Record{Value: append([]byte(nil), value...)}
+	if key != nil {
+		record.Key = append([]byte(nil), key...)
+	}
+	// null values of keyed records are Kafka's tombstones
+	record.Tombstone = value == nil && key != nil && d.err == nil
+	headers := d.varint()
+	for i := int64(0); i < headers && d.err == nil; i++ {
+		key, value := d.bytes(), d.bytes()
+		if string(key) != kafkaTypeHeader {
+			record.Headers = append(record.Headers, &api.Header{
+				Key:   string(key),
+				Value: append([]byte(nil), value...),
+			})
+			continue
+		}
+		typ, err := strconv.ParseUint(string(value), 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s header: %w", kafkaTypeHeader, err)
+		}
+		record.Type = uint32(typ)
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+
+	d.b = rest
+	return record, nil
+}
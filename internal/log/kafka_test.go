@@ -0,0 +1,284 @@
+package log
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	api "github.com/justagabriel/proglog/api/v1"
+	"github.com/justagabriel/proglog/internal"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestKafka(t *testing.T) {
+	scenarios := map[string]func(t *testing.T, log *Log, dir string){
+		"export and import round trip":     testKafkaRoundTrip,
+		"export writes kafka segments":     testKafkaExportSegments,
+		"import gzip compressed batches":   testKafkaImportGzip,
+		"import rejects corrupt batches":   testKafkaImportCorrupt,
+		"tombstones are null values":       testKafkaTombstones,
+		"import rejects forged counts":     testKafkaImportForgedCount,
+		"export leaves out hidden records": testKafkaExportHidden,
+		"export includes tiered segments":  testKafkaExportTiered,
+	}
+
+	config := Config{}
+	config.Segment.MaxStoreBytes = 64
+
+	for scenario, fn := range scenarios {
+		t.Run(scenario, func(t *testing.T) {
+			logDir := internal.GetTempDir(t, "kafka-log-test")
+			defer os.RemoveAll(logDir)
+			dir := internal.GetTempDir(t, "kafka-test")
+			defer os.RemoveAll(dir)
+
+			log, err := NewLog(logDir, config)
+			require.NoError(t, err)
+			defer log.Close()
+
+			fn(t, log, dir)
+		})
+	}
+}
+
+func appendKafkaTestRecords(t *testing.T, log *Log, n int) {
+	for i := 0; i < n; i++ {
+		record := &api.Record{
+			Value: []byte(fmt.Sprintf("hello world%d", i)),
+			Term:  uint64(1 + i/3),
+			Type:  uint32(i % 2),
+		}
+		if i%2 == 0 {
+			record.Key = []byte(fmt.Sprintf("key%d", i))
+		}
+		if i%3 == 0 {
+			record.Headers = []*api.Header{
+				{Key: "trace-id", Value: []byte(fmt.Sprintf("trace%d", i))},
+				{Key: "content-type", Value: []byte("text/plain")},
+			}
+		}
+		_, err := log.Append(record)
+		require.NoError(t, err)
+	}
+}
+
+func testKafkaRoundTrip(t *testing.T, log *Log, dir string) {
+	// arrange
+	appendKafkaTestRecords(t, log, 7)
+	imported, err := NewLog(internal.GetTempDir(t, "kafka-import-test"), log.Config)
+	require.NoError(t, err)
+	defer imported.Remove()
+
+	// act
+	require.NoError(t, log.ExportKafka(dir))
+	n, err := ImportKafka(dir, imported)
+
+	// assert
+	require.NoError(t, err)
+	require.Equal(t, 7, n)
+	for off := uint64(0); off < 7; off++ {
+		want, err := log.Read(off)
+		require.NoError(t, err)
+		got, err := imported.Read(off)
+		require.NoError(t, err)
+		require.Equal(t, want.Value, got.Value)
+		require.Equal(t, want.Term, got.Term)
+		require.Equal(t, want.Type, got.Type)
+		require.Equal(t, want.Key, got.Key)
+		require.Equal(t, len(want.Headers), len(got.Headers))
+		for i, header := range want.Headers {
+			require.Equal(t, header.Key, got.Headers[i].Key)
+			require.Equal(t, header.Value, got.Headers[i].Value)
+		}
+	}
+}
+
+func testKafkaExportSegments(t *testing.T, log *Log, dir string) {
+	// arrange
+	appendKafkaTestRecords(t, log, 3)
+
+	// act
+	err := log.ExportKafka(dir)
+
+	// assert
+	require.NoError(t, err)
+	names, err := filepath.Glob(filepath.Join(dir, "*.log"))
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(dir, "00000000000000000000.log"), names[0])
+
+	b, err := os.ReadFile(names[0])
+	require.NoError(t, err)
+	require.Equal(t, uint64(0), binary.BigEndian.Uint64(b[0:]))
+	require.Equal(t, byte(kafkaMagic), b[16])
+	require.Equal(t, uint32(1), binary.BigEndian.Uint32(b[12:]))
+	first, err := log.Read(0)
+	require.NoError(t, err)
+	require.Equal(t, uint64(first.Timestamp.AsTime().UnixMilli()), binary.BigEndian.Uint64(b[27:]))
+}
+
+func testKafkaImportGzip(t *testing.T, log *Log, dir string) {
+	// arrange
+	batch := encodeKafkaBatch([]*api.Record{
+		{Value: []byte("first"), Offset: 10},
+		{Value: []byte("second"), Offset: 11},
+	}, 0)
+	var body bytes.Buffer
+	zw := gzip.NewWriter(&body)
+	_, err := zw.Write(batch[kafkaBatchHeaderLen:])
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+
+	compressed := append(batch[:kafkaBatchHeaderLen:kafkaBatchHeaderLen], body.Bytes()...)
+	binary.BigEndian.PutUint32(compressed[8:], uint32(len(compressed)-kafkaBatchPrefixLen))
+	binary.BigEndian.PutUint16(compressed[21:], kafkaCompressionGzip)
+	binary.BigEndian.PutUint32(compressed[17:], crc32.Checksum(compressed[kafkaCRCStart:], kafkaCRCTable))
+	name := filepath.Join(dir, "00000000000000000010.log")
+	require.NoError(t, os.WriteFile(name, compressed, 0644))
+
+	// act
+	n, err := ImportKafka(dir, log)
+
+	// assert
+	require.NoError(t, err)
+	require.Equal(t, 2, n)
+	record, err := log.Read(1)
+	require.NoError(t, err)
+	require.Equal(t, []byte("second"), record.Value)
+}
+
+func testKafkaImportCorrupt(t *testing.T, log *Log, dir string) {
+	// arrange
+	batch := encodeKafkaBatch([]*api.Record{{Value: []byte("hello world")}}, 0)
+	batch[len(batch)-2] ^= 0xff
+	name := filepath.Join(dir, "00000000000000000000.log")
+	require.NoError(t, os.WriteFile(name, batch, 0644))
+
+	// act
+	n, err := ImportKafka(dir, log)
+
+	// assert
+	require.ErrorContains(t, err, "checksum mismatch")
+	require.Equal(t, 0, n)
+}
+
+func testKafkaTombstones(t *testing.T, log *Log, dir string) {
+	// arrange
+	_, err := log.Append(&api.Record{Key: []byte("a"), Tombstone: true})
+	require.NoError(t, err)
+	_, err = log.Append(&api.Record{Key: []byte("b")})
+	require.NoError(t, err)
+	imported, err := NewLog(internal.GetTempDir(t, "kafka-import-test"), log.Config)
+	require.NoError(t, err)
+	defer imported.Remove()
+
+	// act
+	require.NoError(t, log.ExportKafka(dir))
+	_, err = ImportKafka(dir, imported)
+
+	// assert
+	require.NoError(t, err)
+	tombstone, err := imported.Read(0)
+	require.NoError(t, err)
+	require.True(t, tombstone.Tombstone)
+	empty, err := imported.Read(1)
+	require.NoError(t, err)
+	require.False(t, empty.Tombstone, "empty values aren't null")
+}
+
+func testKafkaImportForgedCount(t *testing.T, log *Log, dir string) {
+	// arrange
+	batch := encodeKafkaBatch([]*api.Record{{Value: []byte("hello world")}}, 0)
+	binary.BigEndian.PutUint32(batch[57:], 1<<30)
+	binary.BigEndian.PutUint32(batch[17:], crc32.Checksum(batch[kafkaCRCStart:], kafkaCRCTable))
+	name := filepath.Join(dir, "00000000000000000000.log")
+	require.NoError(t, os.WriteFile(name, batch, 0644))
+
+	// act
+	n, err := ImportKafka(dir, log)
+
+	// assert
+	require.ErrorContains(t, err, "invalid record count")
+	require.Equal(t, 0, n)
+}
+
+// importedValues imports the Kafka segments of dir into a new log and returns
+// the records' values.
+func importedValues(t *testing.T, dir string) []string {
+	t.Helper()
+	imported, err := NewLog(internal.GetTempDir(t, "kafka-import-test"), Config{})
+	require.NoError(t, err)
+	defer imported.Remove()
+	n, err := ImportKafka(dir, imported)
+	require.NoError(t, err)
+
+	var values []string
+	for off := uint64(0); off < uint64(n); off++ {
+		record, err := imported.Read(off)
+		require.NoError(t, err)
+		values = append(values, string(record.Value))
+	}
+	return values
+}
+
+func testKafkaExportHidden(t *testing.T, log *Log, dir string) {
+	// arrange
+	log.Config.replicated = true
+	records := []*api.Record{
+		{Value: []byte("deleted"), Timestamp: timestamppb.New(time.Now().Add(-time.Hour))},
+		{Value: []byte("expired"), Timestamp: timestamppb.New(time.Now().Add(-time.Hour)), Ttl: durationpb.New(time.Minute)},
+		{Value: []byte("visible")},
+		{Value: []byte("aborted"), Transaction: 7},
+		{Transaction: 7, Marker: api.TransactionMarker_TRANSACTION_MARKER_ABORT},
+		{Value: []byte("committed"), Transaction: 8},
+		{Transaction: 8, Marker: api.TransactionMarker_TRANSACTION_MARKER_COMMIT},
+	}
+	for _, record := range records {
+		_, err := log.Append(record)
+		require.NoError(t, err)
+	}
+	_, err := log.DeleteBefore(1)
+	require.NoError(t, err)
+
+	// act
+	err = log.ExportKafka(dir)
+
+	// assert
+	require.NoError(t, err)
+	require.Equal(t, []string{"visible", "committed"}, importedValues(t, dir))
+}
+
+func testKafkaExportTiered(t *testing.T, log *Log, dir string) {
+	// arrange
+	log.Config.Tiering.Store = DirObjectStore(internal.GetTempDir(t, "kafka-bucket-test"))
+	defer os.RemoveAll(string(log.Config.Tiering.Store.(DirObjectStore)))
+	var want []string
+	for i := 0; len(log.segments) < 3; i++ {
+		value := fmt.Sprintf("hello world%d", i)
+		_, err := log.Append(&api.Record{Value: []byte(value)})
+		require.NoError(t, err)
+		want = append(want, value)
+	}
+	require.NoError(t, log.offload(nil, time.Now().Add(time.Hour)))
+	require.Len(t, log.remote, 2)
+	_, err := log.Append(&api.Record{Value: []byte("active")})
+	require.NoError(t, err)
+	want = append(want, "active")
+
+	// act
+	err = log.ExportKafka(dir)
+
+	// assert
+	require.NoError(t, err)
+	names, err := filepath.Glob(filepath.Join(dir, "*.log"))
+	require.NoError(t, err)
+	require.Len(t, names, 3, "a file per segment")
+	require.Equal(t, want, importedValues(t, dir))
+}
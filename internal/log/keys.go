@@ -0,0 +1,85 @@
+package log
+
+import (
+	"bytes"
+
+	api "github.com/justagabriel/proglog/api/v1"
+)
+
+// indexKey points the record's key at its offset if the log indexes keys,
+// l.mu has to be held for writing. Markers and records without key aren't
+// indexed.
+func (l *Log) indexKey(record *api.Record) {
+	if l.keys == nil || len(record.Key) == 0 || record.Marker != api.TransactionMarker_TRANSACTION_MARKER_NONE {
+		return
+	}
+	l.keys[string(record.Key)] = record.Offset
+}
+
+// loadKeys builds the key index from the local segments if Config.KeyIndex is
+// set, l.mu has to be held for writing or the log not shared yet.
+func (l *Log) loadKeys() error {
+	l.keys = nil
+	if !l.Config.KeyIndex {
+		return nil
+	}
+	keys := make(map[string]uint64)
+	for _, s := range l.segments {
+		err := s.scan(func(record *api.Record) error {
+			if len(record.Key) > 0 && !l.hidden(record.Transaction, record.Marker) {
+				keys[string(record.Key)] = record.Offset
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	l.keys = keys
+	return nil
+}
+
+// setKeyIndex enables or disables the key index, enabling it builds the
+// index from the local segments.
+func (l *Log) setKeyIndex(enabled bool) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if enabled == l.Config.KeyIndex {
+		return nil
+	}
+	l.Config.KeyIndex = enabled
+	return l.loadKeys()
+}
+
+// ReadByKey returns the latest record with the key. It fails with
+// api.ErrKeyIndexDisabled unless Config.KeyIndex is set, and with
+// api.ErrKeyNotFound if the key's latest record isn't readable, e.g. because
+// it expired, was deleted or belongs to an aborted transaction.
+func (l *Log) ReadByKey(key []byte) (*api.Record, error) {
+	l.mu.RLock()
+	if l.keys == nil {
+		l.mu.RUnlock()
+		return nil, api.ErrKeyIndexDisabled{}
+	}
+	off, ok := l.keys[string(key)]
+	l.mu.RUnlock()
+	if !ok {
+		return nil, api.ErrKeyNotFound{Key: key}
+	}
+
+	record, err := l.Read(off)
+	if _, ok := err.(api.ErrOffsetOutOfRange); ok {
+		return nil, api.ErrKeyNotFound{Key: key}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(record.Key, key) {
+		// the index is stale, e.g. the log was restored from a snapshot
+		return nil, api.ErrKeyNotFound{Key: key}
+	}
+	if record.Tombstone {
+		return nil, api.ErrKeyNotFound{Key: key}
+	}
+	return record, nil
+}
@@ -0,0 +1,141 @@
+package log
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	api "github.com/justagabriel/proglog/api/v1"
+	"github.com/justagabriel/proglog/internal"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyIndex(t *testing.T) {
+	scenarios := map[string]func(t *testing.T, log *Log){
+		"keys map to their latest record":     testKeyIndexLatest,
+		"index is rebuilt on open":            testKeyIndexReopen,
+		"unreadable records aren't found":     testKeyIndexUnreadable,
+		"aborted transactions aren't indexed": testKeyIndexAborted,
+		"deleted keys aren't found":           testKeyIndexDeleted,
+	}
+
+	config := Config{KeyIndex: true}
+	config.Segment.MaxStoreBytes = 96
+
+	for scenario, fn := range scenarios {
+		t.Run(scenario, func(t *testing.T) {
+			dir := internal.GetTempDir(t, "keys-test")
+			defer os.RemoveAll(dir)
+
+			log, err := NewLog(dir, config)
+			require.NoError(t, err)
+			defer log.Close()
+
+			fn(t, log)
+		})
+	}
+}
+
+func testKeyIndexLatest(t *testing.T, log *Log) {
+	// arrange
+	appendKeyed(t, log, "a", "first")
+	appendKeyed(t, log, "b", "other")
+	off := appendKeyed(t, log, "a", "second")
+	appendKeyed(t, log, "", "unkeyed")
+
+	// act
+	record, err := log.ReadByKey([]byte("a"))
+	_, missingErr := log.ReadByKey([]byte("c"))
+
+	// assert
+	require.NoError(t, err)
+	require.Equal(t, off, record.Offset)
+	require.Equal(t, "second", string(record.Value))
+	require.Equal(t, api.ErrKeyNotFound{Key: []byte("c")}, missingErr)
+}
+
+func testKeyIndexReopen(t *testing.T, log *Log) {
+	// arrange
+	for len(log.segments) < 3 {
+		appendKeyed(t, log, "a", "filler")
+	}
+	off := appendKeyed(t, log, "b", "latest")
+	require.NoError(t, log.Close())
+
+	// act
+	reopened, err := NewLog(log.Dir, log.Config)
+	require.NoError(t, err)
+	defer reopened.Close()
+	record, err := reopened.ReadByKey([]byte("b"))
+
+	// assert
+	require.NoError(t, err)
+	require.Equal(t, off, record.Offset)
+	require.Equal(t, "latest", string(record.Value))
+}
+
+func testKeyIndexUnreadable(t *testing.T, log *Log) {
+	// arrange
+	appendKeyed(t, log, "a", "alive")
+	appendTTL(t, log, "a", "expired", 0, time.Nanosecond)
+
+	// act
+	_, err := log.ReadByKey([]byte("a"))
+
+	// assert
+	require.Equal(t, api.ErrKeyNotFound{Key: []byte("a")}, err, "the latest record hides older ones")
+}
+
+func testKeyIndexAborted(t *testing.T, log *Log) {
+	// arrange
+	appendKeyed(t, log, "a", "committed")
+	log.mu.Lock()
+	_, err := log.appendTransaction([]*api.Record{{Key: []byte("a"), Value: []byte("aborted"), Transaction: 1}})
+	require.NoError(t, err)
+	require.NoError(t, log.endTransaction(1, api.TransactionMarker_TRANSACTION_MARKER_ABORT))
+	log.mu.Unlock()
+	require.NoError(t, log.Close())
+
+	// act
+	reopened, err := NewLog(log.Dir, log.Config)
+	require.NoError(t, err)
+	defer reopened.Close()
+	record, err := reopened.ReadByKey([]byte("a"))
+
+	// assert
+	require.NoError(t, err)
+	require.Equal(t, "committed", string(record.Value), "rebuilding skips the aborted record")
+}
+
+func testKeyIndexDeleted(t *testing.T, log *Log) {
+	// arrange
+	appendKeyed(t, log, "a", "alive")
+	appendTombstone(t, log, "a", 0)
+
+	// act
+	_, err := log.ReadByKey([]byte("a"))
+
+	// assert
+	require.Equal(t, api.ErrKeyNotFound{Key: []byte("a")}, err)
+}
+
+func TestKeyIndexTopics(t *testing.T) {
+	// arrange
+	dir := internal.GetTempDir(t, "keys-test")
+	defer os.RemoveAll(dir)
+	topics, err := NewTopics(dir, Config{})
+	require.NoError(t, err)
+	_, err = topics.Append("orders", &api.Record{Key: []byte("a"), Value: []byte("order")})
+	require.NoError(t, err)
+
+	// act
+	_, disabledErr := topics.ReadByKey("orders", []byte("a"))
+	_, err = topics.ConfigureTopic("orders", &api.TopicConfig{KeyIndex: true})
+	require.NoError(t, err)
+	record, err := topics.ReadByKey("orders", []byte("a"))
+
+	// assert
+	require.Equal(t, api.ErrKeyIndexDisabled{Topic: "orders"}, disabledErr)
+	require.NoError(t, err, "configuring the topic builds its index")
+	require.Equal(t, "order", string(record.Value))
+}
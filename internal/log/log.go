@@ -1,6 +1,9 @@
 package log
 
 import (
+	"bytes"
+	"context"
+	"fmt"
 	"io"
 	"os"
 	"path"
@@ -8,16 +11,62 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	api "github.com/justagabriel/proglog/api/v1"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 type Log struct {
+	// mu guards the log, except for the reads of sealed segments, see sealed
 	mu            sync.RWMutex
 	Dir           string
 	Config        Config
 	activeSegment *segment
 	segments      []*segment
+	// changed is closed and replaced whenever the log changes
+	changed    chan struct{}
+	lastAppend time.Time
+	// lastTimestamp is the timestamp of the last record, timestamps never decrease
+	lastTimestamp time.Time
+	// retentionDone stops the retention goroutine, nil if there is none
+	retentionDone chan struct{}
+	// producers holds the latest run of each idempotent producer, see dedup
+	producers map[string]producerRun
+	// aborted holds the ids of the aborted transactions, open the one whose
+	// records were appended without a marker yet and committed the one of the
+	// last commit marker, see trackTransaction
+	aborted   map[uint64]bool
+	open      uint64
+	committed uint64
+	cache     *recordCache
+	// remote are the segments in the object store, they precede segments
+	remote []remoteSegment
+	// fetchMu guards fetched while l.mu is held for reading
+	fetchMu sync.Mutex
+	fetched *segment
+	// start is the log start offset set by DeleteBefore, see logStart
+	start uint64
+	// spare tells whether the next segment's files were prepared, see
+	// Config.Segment.Preallocate. spareMu guards them and is held while
+	// they're prepared, spareWG waits for that.
+	spareMu sync.Mutex
+	spare   bool
+	spareWG sync.WaitGroup
+	// keys maps the records' keys to their latest offset, nil unless
+	// Config.KeyIndex is set
+	keys map[string]uint64
+	// sealed is read without l.mu, see sealedView
+	sealed atomic.Pointer[sealedView]
+	// maintenance holds the latest run of each task started by
+	// RunMaintenance, maintenanceMu guards it
+	maintenanceMu sync.Mutex
+	maintenance   map[api.MaintenanceTask]*maintenanceRun
+	// closed is closed once the log is, it stops maintenance runs
+	closed chan struct{}
 }
 
 func NewLog(dir string, c Config) (*Log, error) {
@@ -30,34 +79,69 @@ func NewLog(dir string, c Config) (*Log, error) {
 	}
 
 	l := &Log{
-		Dir:    dir,
-		Config: c,
+		Dir:     dir,
+		Config:  c,
+		changed: make(chan struct{}),
+		cache:   newRecordCache(c.CacheBytes),
+		closed:  make(chan struct{}),
 	}
 
-	return l, l.setup()
+	err := l.setup()
+	if err != nil {
+		return nil, err
+	}
+	l.startRetention()
+	return l, nil
 }
 
 func (l *Log) newSegment(off uint64) error {
-	s, err := newSegment(l.Dir, off, l.Config)
+	return l.openSegment(off, false)
+}
+
+// openSegment opens the segment as the active one, sealed tells whether more
+// segments are opened after it, see segment.recover.
+func (l *Log) openSegment(off uint64, sealed bool) error {
+	s, err := openSegment(l.Dir, off, l.Config, sealed)
 	if err != nil {
 		return err
 	}
 
 	l.segments = append(l.segments, s)
 	l.activeSegment = s
+	l.publish()
 	return nil
 }
 
 func (l *Log) setup() error {
-	files, err := os.ReadDir(l.Dir)
+	if err := l.setupSpare(); err != nil {
+		return err
+	}
+	if err := l.loadRemote(); err != nil {
+		return err
+	}
+	if err := l.loadStart(); err != nil {
+		return err
+	}
+	if err := l.recoverCompaction(); err != nil {
+		return err
+	}
+	storage := storageOf(l.Config)
+	files, err := storage.ReadDir(l.Dir)
 	if err != nil {
 		return err
 	}
 
 	var baseOffsets []uint64
 	for _, file := range files {
+		// only stores are considered, every store has an index of the same base offset
+		if file.IsDir() || path.Ext(file.Name()) != ".store" {
+			continue
+		}
 		offStr := strings.TrimSuffix(file.Name(), path.Ext(file.Name()))
-		off, _ := strconv.ParseUint(offStr, 10, 0)
+		off, err := strconv.ParseUint(offStr, 10, 0)
+		if err != nil {
+			continue
+		}
 		baseOffsets = append(baseOffsets, off)
 	}
 
@@ -65,44 +149,230 @@ func (l *Log) setup() error {
 		return baseOffsets[i] < baseOffsets[j]
 	})
 
-	for idx := range baseOffsets {
-		if err = l.newSegment(baseOffsets[idx]); err != nil {
+	for i, baseOffset := range baseOffsets {
+		if baseOffset < l.remoteEnd() {
+			// offloaded before a crash prevented removing it
+			for _, ext := range []string{".store", ".index"} {
+				err = storage.Remove(path.Join(l.Dir, fmt.Sprintf("%d%s", baseOffset, ext)))
+				if err != nil && !os.IsNotExist(err) {
+					return err
+				}
+			}
+			continue
+		}
+		if err = l.openSegment(baseOffset, i < len(baseOffsets)-1); err != nil {
 			return err
 		}
-		// baseOffset contains dup for index and store so we skip
-		// the dup
-		idx++
 	}
 
 	if l.segments == nil {
-		err = l.newSegment(l.Config.Segment.InitialOffset)
-		if err != nil {
+		off := l.Config.Segment.InitialOffset
+		if len(l.remote) > 0 {
+			off = l.remoteEnd()
+		}
+		if err = l.newSegment(off); err != nil {
 			return err
 		}
 	}
 
+	l.lastTimestamp = time.Time{}
+	for i := len(l.segments) - 1; i >= 0; i-- {
+		if !l.segments[i].empty() {
+			l.lastTimestamp, err = l.segments[i].lastTimestamp()
+			if err != nil {
+				return err
+			}
+			break
+		}
+	}
+	for i := len(l.remote) - 1; i >= 0 && l.lastTimestamp.IsZero(); i-- {
+		l.lastTimestamp = l.remote[i].LastTimestamp
+	}
+	if err = l.loadProducers(); err != nil {
+		return err
+	}
+	return l.loadKeys()
+}
+
+// roll starts a new active segment. The records of the previous one are
+// synced first, so the producers' checkpoint doesn't cover lost records.
+func (l *Log) roll(off uint64) error {
+	if err := l.activeSegment.store.Sync(); err != nil {
+		return err
+	}
+	if err := l.useSpare(off); err != nil {
+		return err
+	}
+	if err := l.newSegment(off); err != nil {
+		return err
+	}
+	l.prepareSpare()
+	return l.checkpointProducers()
+}
+
+// stamp gives the record the current time, replicated logs keep the
+// timestamp the leader assigned, see Config.replicated. Timestamps are kept
+// from decreasing, so they can be searched by OffsetByTime.
+func (l *Log) stamp(record *api.Record) {
+	t := time.Now()
+	if l.Config.replicated && record.Timestamp != nil {
+		t = record.Timestamp.AsTime()
+	}
+	if t.Before(l.lastTimestamp) {
+		t = l.lastTimestamp
+	}
+	record.Timestamp = timestamppb.New(t)
+	l.lastTimestamp = t
+}
+
+// checkSize rejects records exceeding Config.MaxRecordBytes.
+func checkSize(c Config, records ...*api.Record) error {
+	if c.MaxRecordBytes == 0 {
+		return nil
+	}
+	for _, record := range records {
+		if size := uint64(proto.Size(record)); size > c.MaxRecordBytes {
+			return api.ErrRecordTooLarge{Size: size, Limit: c.MaxRecordBytes}
+		}
+	}
 	return nil
 }
 
+// Append appends the record, see stamp for its timestamp.
 func (l *Log) Append(record *api.Record) (uint64, error) {
+	return l.AppendContext(context.Background(), record)
+}
+
+// AppendContext appends the record like Append, unless ctx is done before
+// it's written, e.g. while waiting for the log's lock.
+func (l *Log) AppendContext(ctx context.Context, record *api.Record) (uint64, error) {
+	if err := checkSize(l.Config, record); err != nil {
+		return 0, err
+	}
+	if err := l.Config.Faults.delayAppend(ctx); err != nil {
+		return 0, err
+	}
 	l.mu.Lock()
 	defer l.mu.Unlock()
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
 
+	offsets, dup, err := l.dedup([]*api.Record{record})
+	if err != nil {
+		return 0, err
+	}
+	if dup {
+		l.restampDuplicates([]*api.Record{record}, offsets)
+		return offsets[0], nil
+	}
+	l.stamp(record)
 	off, err := l.activeSegment.Append(record)
 	if err != nil {
 		return 0, err
 	}
+	l.track(record)
+	l.cache.add(record)
+	l.lastAppend = time.Now()
+	l.notify()
 
 	if l.activeSegment.IsMaxed() {
-		err = l.newSegment(off + 1)
+		err = l.roll(off + 1)
 	}
 
 	return off, err
 }
 
+// AppendBatch appends the records under a single lock acquisition and syncs
+// them to disk once per segment written to. It returns the records' offsets.
+// Batches aren't atomic: if a record fails to be appended or a segment to
+// roll, the records before it stay appended and readable, and their offsets
+// are returned with the error, so callers can retry the rest.
+func (l *Log) AppendBatch(records []*api.Record) ([]uint64, error) {
+	if err := checkSize(l.Config, records...); err != nil {
+		return nil, err
+	}
+	if err := l.Config.Faults.delayAppend(context.Background()); err != nil {
+		return nil, err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(records) > 0 {
+		offsets, dup, err := l.dedup(records)
+		if dup {
+			l.restampDuplicates(records, offsets)
+		}
+		if err != nil || dup {
+			return offsets, err
+		}
+	}
+
+	offsets := make([]uint64, 0, len(records))
+	defer func() {
+		// records appended before an error are readable as well
+		if len(offsets) > 0 {
+			l.lastAppend = time.Now()
+			l.notify()
+		}
+	}()
+
+	for _, record := range records {
+		l.stamp(record)
+		off, err := l.activeSegment.Append(record)
+		if err != nil {
+			return offsets, err
+		}
+		l.track(record)
+		l.cache.add(record)
+		offsets = append(offsets, off)
+
+		if l.activeSegment.IsMaxed() {
+			if err = l.roll(off + 1); err != nil {
+				return offsets, err
+			}
+		}
+	}
+	return offsets, l.activeSegment.store.Sync()
+}
+
+// Read returns the record at the offset. Out of range errors carry the log's
+// lowest and highest offset.
 func (l *Log) Read(off uint64) (*api.Record, error) {
+	return l.ReadContext(context.Background(), off)
+}
+
+// ReadContext reads the record like Read, unless ctx is done before it's
+// read, e.g. while waiting for the log's lock. Records of sealed segments are
+// read without the lock, so consumers catching up don't hold up appends.
+func (l *Log) ReadContext(ctx context.Context, off uint64) (*api.Record, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if record, ok := l.readSealed(off); ok {
+		return record, nil
+	}
 	l.mu.RLock()
 	defer l.mu.RUnlock()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	record, err := l.read(off)
+	if err == nil && (l.hidden(record.Transaction, record.Marker) || expired(record, time.Now())) {
+		record, err = nil, api.ErrOffsetOutOfRange{Offset: off}
+	}
+	if _, ok := err.(api.ErrOffsetOutOfRange); ok {
+		err = l.outOfRange(off)
+	}
+	return record, err
+}
+
+// read has to be called with l.mu held.
+func (l *Log) read(off uint64) (*api.Record, error) {
+	if off < l.start {
+		return nil, api.ErrOffsetOutOfRange{Offset: off}
+	}
 
 	var s *segment
 	for _, segment := range l.segments {
@@ -112,32 +382,146 @@ func (l *Log) Read(off uint64) (*api.Record, error) {
 		}
 	}
 
+	if s == nil && off < l.remoteEnd() {
+		return l.readRemote(off)
+	}
 	if s == nil || s.nextOffset <= off {
 		return nil, api.ErrOffsetOutOfRange{Offset: off}
 	}
-	return s.Read(off)
+	if record, ok := l.cache.get(off); ok {
+		return record, nil
+	}
+	record, err := s.Read(off)
+	if err != nil {
+		return nil, err
+	}
+	l.cache.add(record)
+	return record, nil
+}
+
+// ReadEncoded returns the record at the offset encoded like proto.Marshal
+// does, so it can be sent without decoding and encoding it again. Records of
+// sealed segments are read from the store as they are, others are read like
+// Read does and encoded.
+func (l *Log) ReadEncoded(off uint64) ([]byte, error) {
+	if b, ok := l.readSealedEncoded(off); ok {
+		return b, nil
+	}
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	if off >= l.start {
+		for _, s := range l.segments {
+			if s != l.activeSegment && s.baseOffset <= off && off < s.nextOffset {
+				b, err := s.readEncoded(off)
+				if err == nil && (l.hiddenEncoded(b) || expiredEncoded(b, time.Now())) {
+					return nil, l.outOfRange(off)
+				}
+				return b, err
+			}
+		}
+	}
+	record, err := l.read(off)
+	if err == nil && (l.hidden(record.Transaction, record.Marker) || expired(record, time.Now())) {
+		record, err = nil, api.ErrOffsetOutOfRange{Offset: off}
+	}
+	if _, ok := err.(api.ErrOffsetOutOfRange); ok {
+		err = l.outOfRange(off)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return proto.Marshal(record)
+}
+
+// OffsetByTime returns the offset of the first record with a timestamp at or
+// after t, the next offset to be written if there is none. It's never below
+// the log start offset.
+func (l *Log) OffsetByTime(t time.Time) (uint64, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	off, err := l.offsetByTime(t)
+	if start := l.logStart(); err == nil && off < start {
+		off = start
+	}
+	return off, err
+}
+
+// offsetByTime has to be called with l.mu held.
+func (l *Log) offsetByTime(t time.Time) (uint64, error) {
+	if off, ok, err := l.offsetByTimeRemote(t); err != nil || ok {
+		return off, err
+	}
+
+	// compaction may leave segments without records
+	segments := make([]*segment, 0, len(l.segments))
+	for _, s := range l.segments {
+		if !s.empty() {
+			segments = append(segments, s)
+		}
+	}
+
+	// the first segment whose last record isn't before t holds the offset
+	var err error
+	i := sort.Search(len(segments), func(i int) bool {
+		if err != nil {
+			return true
+		}
+		var last time.Time
+		last, err = segments[i].lastTimestamp()
+		return !last.Before(t)
+	})
+	if err != nil {
+		return 0, err
+	}
+	if i < len(segments) {
+		off, ok, err := segments[i].searchTime(t)
+		if err != nil || ok {
+			return off, err
+		}
+	}
+	return l.activeSegment.nextOffset, nil
 }
 
 func (l *Log) Close() error {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
+	l.stopRetention()
+	l.spareWG.Wait()
+	select {
+	case <-l.closed:
+	default:
+		close(l.closed)
+	}
+
 	for _, segment := range l.segments {
 		err := segment.Close()
 		if err != nil {
 			return err
 		}
 	}
+	if l.fetched != nil {
+		if err := l.fetched.Close(); err != nil {
+			return err
+		}
+		l.fetched = nil
+	}
 
-	return nil
+	return l.checkpointProducers()
 }
 
+// Remove deletes the log's files and objects.
 func (l *Log) Remove() error {
 	err := l.Close()
 	if err != nil {
 		return err
 	}
-	return os.RemoveAll(l.Dir)
+	if err = l.dropRemote(len(l.remote)); err != nil {
+		return err
+	}
+	return storageOf(l.Config).RemoveAll(l.Dir)
 }
 
 func (l *Log) Reset() error {
@@ -146,35 +530,64 @@ func (l *Log) Reset() error {
 		return err
 	}
 
-	return l.setup()
+	err = storageOf(l.Config).MkdirAll(l.Dir, 0755)
+	if err != nil {
+		return err
+	}
+
+	l.segments = nil
+	l.cache.reset()
+	err = l.setup()
+	if err != nil {
+		return err
+	}
+	l.startRetention()
+	return nil
 }
 
 func (l *Log) LowestOffset() (uint64, error) {
 	l.mu.RLock()
 	defer l.mu.RUnlock()
-	return l.segments[0].baseOffset, nil
+	return l.logStart(), nil
 }
 
 func (l *Log) HighestOffset() (uint64, error) {
 	l.mu.RLock()
 	defer l.mu.RUnlock()
+	return l.highest(), nil
+}
 
-	lastIdx := len(l.segments) - 1
-	off := l.segments[lastIdx].nextOffset
+// highest has to be called with l.mu held.
+func (l *Log) highest() uint64 {
+	off := l.activeSegment.nextOffset
 	if off == 0 {
-		return 0, nil
+		return 0
 	}
+	return off - 1
+}
 
-	return off - 1, nil
+// outOfRange returns the error for reading the offset, l.mu has to be held.
+func (l *Log) outOfRange(off uint64) error {
+	return api.ErrOffsetOutOfRange{Offset: off, LogStartOffset: l.logStart(), HighestOffset: l.highest()}
 }
 
+// Truncate removes the segments holding only records up to the lowest offset.
+// The active segment is kept, so the log stays writable.
 func (l *Log) Truncate(lowest uint64) error {
 	l.mu.Lock()
 	defer l.mu.Unlock()
+	n := 0
+	for n < len(l.remote) && l.remote[n].NextOffset <= lowest+1 {
+		n++
+	}
+	if err := l.dropRemote(n); err != nil {
+		return err
+	}
+
 	var segments []*segment
 	for _, s := range l.segments {
-		if s.nextOffset <= lowest+1 {
-			if err := s.Remove(); err != nil {
+		if s != l.activeSegment && s.nextOffset <= lowest+1 {
+			if err := l.removeSegment(s); err != nil {
 				return err
 			}
 			continue
@@ -182,28 +595,235 @@ func (l *Log) Truncate(lowest uint64) error {
 		segments = append(segments, s)
 	}
 	l.segments = segments
+	l.publish()
+	l.cache.reset()
+	l.notify()
 	return nil
 }
 
+// SegmentStats describes the log's segments in offset order.
+func (l *Log) SegmentStats() ([]*api.SegmentStats, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.segmentStats()
+}
+
+// Stats summarizes the log and its segments, e.g. for capacity planning.
+func (l *Log) Stats() (*api.LogStats, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	segments, err := l.segmentStats()
+	if err != nil {
+		return nil, err
+	}
+	stats := &api.LogStats{
+		LowestOffset:  l.logStart(),
+		HighestOffset: l.highest(),
+		SegmentCount:  uint64(len(segments)),
+		Segments:      segments,
+	}
+	for _, s := range segments {
+		stats.TotalBytes += s.StoreBytes + s.IndexBytes
+		if s.Remote {
+			stats.RemoteBytes += s.StoreBytes + s.IndexBytes
+		}
+	}
+	return stats, nil
+}
+
+// segmentStats has to be called with l.mu held.
+func (l *Log) segmentStats() ([]*api.SegmentStats, error) {
+	now := time.Now()
+	stats := make([]*api.SegmentStats, 0, len(l.remote)+len(l.segments))
+	for _, remote := range l.remote {
+		stats = append(stats, &api.SegmentStats{
+			BaseOffset: remote.BaseOffset,
+			NextOffset: remote.NextOffset,
+			StoreBytes: remote.StoreBytes,
+			IndexBytes: remote.IndexBytes,
+			Modified:   timestamppb.New(remote.Modified),
+			Age:        durationpb.New(now.Sub(remote.Modified)),
+			Remote:     true,
+		})
+	}
+	for _, s := range l.segments {
+		fi, err := s.store.Stat()
+		if err != nil {
+			return nil, err
+		}
+		stats = append(stats, &api.SegmentStats{
+			BaseOffset:       s.baseOffset,
+			NextOffset:       s.nextOffset,
+			StoreBytes:       s.store.size,
+			IndexBytes:       s.index.size,
+			Modified:         timestamppb.New(fi.ModTime()),
+			Age:              durationpb.New(now.Sub(fi.ModTime())),
+			Active:           s == l.activeSegment,
+			IndexUtilization: s.index.utilization(),
+		})
+	}
+	return stats, nil
+}
+
+// notify wakes up all watchers, l.mu has to be held for writing.
+func (l *Log) notify() {
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
+
+// DurableOffset returns the offset up to which the records are synced to
+// stable storage, see Config.Segment.SyncPolicy. Rolled segments are synced.
+func (l *Log) DurableOffset() uint64 {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.activeSegment.nextOffset - l.activeSegment.store.unsyncedRecords()
+}
+
+// HighWatermark returns the log's current high watermark and a channel
+// which is closed once it changes.
+func (l *Log) HighWatermark() (*api.HighWatermark, <-chan struct{}) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	hw := &api.HighWatermark{
+		Offset: l.activeSegment.nextOffset,
+	}
+	if !l.lastAppend.IsZero() {
+		hw.Time = timestamppb.New(l.lastAppend)
+	}
+	for _, remote := range l.remote {
+		hw.Size += remote.StoreBytes
+	}
+	for _, s := range l.segments {
+		hw.Size += s.store.size
+	}
+	return hw, l.changed
+}
+
+// originReader reads a store from its start. The store is deliberately not
+// embedded, io.Copy would pick up the WriteTo method of its *os.File otherwise.
 type originReader struct {
-	*store
-	off int64
+	store *store
+	off   int64
 }
 
 func (o *originReader) Read(p []byte) (int, error) {
-	n, err := o.ReadAt(p, o.off)
+	n, err := o.store.ReadAt(p, o.off)
 	o.off += int64(n)
 	return n, err
 }
 
+// Reader concatenates the log's stores, remote ones included, leaving out the
+// records deleted by DeleteBefore. The result can be restored with Restore.
+// Records appended while reading may or may not be included, see Snapshot for
+// a consistent copy.
 func (l *Log) Reader() io.Reader {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
-	readers := make([]io.Reader, len(l.segments))
+	skip, err := l.deletedBytes()
+	if err != nil {
+		return errReader{err}
+	}
+	readers, _ := l.remoteReaders(skip)
 	for i, segment := range l.segments {
-		readers[i] = &originReader{segment.store, 0}
+		var pos int64
+		if i == 0 && len(l.remote) == 0 {
+			pos = int64(skip)
+		}
+		readers = append(readers, &originReader{segment.store, pos})
 	}
 
 	return io.MultiReader(readers...)
 }
+
+// snapshot is like Reader, but limits each store to its current size, so
+// records appended while the snapshot is written don't change its size.
+func (l *Log) snapshot() (io.Reader, uint64, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	skip, err := l.deletedBytes()
+	if err != nil {
+		return nil, 0, err
+	}
+	readers, size := l.remoteReaders(skip)
+	for i, segment := range l.segments {
+		var pos uint64
+		if i == 0 && len(l.remote) == 0 {
+			pos = skip
+		}
+		readers = append(readers, io.LimitReader(&originReader{segment.store, int64(pos)}, int64(segment.store.size-pos)))
+		size += segment.store.size - pos
+	}
+
+	return io.MultiReader(readers...), size, nil
+}
+
+// Snapshot writes a copy of the log's records to w, records appended meanwhile
+// are left out. It fails if retention removes segments while it's running.
+func (l *Log) Snapshot(w io.Writer) error {
+	r, _, err := l.snapshot()
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, r)
+	return err
+}
+
+// Restore replaces the log's records by the ones written by Snapshot.
+// Their offsets are kept, including the gaps left by compaction.
+func (l *Log) Restore(r io.Reader) error {
+	if err := l.Reset(); err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	defer l.notify()
+
+	var buf bytes.Buffer
+	for first := true; ; first = false {
+		buf.Reset()
+		err := readRecord(r, &buf, l.Config.Segment.Encryption)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		record := &api.Record{}
+		if err = proto.Unmarshal(buf.Bytes(), record); err != nil {
+			return err
+		}
+
+		if first && record.Offset != l.activeSegment.baseOffset {
+			// the log starts at the snapshot's lowest offset
+			if err = l.activeSegment.Remove(); err != nil {
+				return err
+			}
+			l.segments = nil
+			if err = l.newSegment(record.Offset); err != nil {
+				return err
+			}
+		}
+		if record.Offset < l.activeSegment.nextOffset {
+			return fmt.Errorf("snapshot records out of order at offset %d", record.Offset)
+		}
+
+		if err = l.activeSegment.write(record); err != nil {
+			return err
+		}
+		l.track(record)
+		l.lastAppend = time.Now()
+		if record.Timestamp != nil {
+			l.lastTimestamp = record.Timestamp.AsTime()
+		}
+		if l.activeSegment.IsMaxed() {
+			if err = l.roll(record.Offset + 1); err != nil {
+				return err
+			}
+		}
+	}
+}
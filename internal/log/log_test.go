@@ -1,15 +1,20 @@
 package log
 
 import (
+	"bytes"
+	"context"
 	"fmt"
-	"io"
+	"math"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	api "github.com/justagabriel/proglog/api/v1"
 	"github.com/justagabriel/proglog/internal"
 	"github.com/stretchr/testify/require"
 	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 func TestLog(t *testing.T) {
@@ -19,22 +24,42 @@ func TestLog(t *testing.T) {
 		"init with existing segments":       testInitExisting,
 		"reader":                            testReader,
 		"truncate":                          testTruncate,
+		"append a batch spanning segments":  testAppendBatch,
+		"corrupt record is detected":        testCorruptRecord,
+		"snapshot restores into a new log":  testSnapshotRestore,
+		"search records by time":            testOffsetByTime,
+		"timestamps don't decrease":         testTimestampOrder,
+		"appends assign the timestamps":     testAppendTimestamp,
+		"stats summarize the segments":      testStats,
+		"encoded reads match reads":         testReadEncoded,
+		"durable offset follows the syncs":  testDurableOffset,
+		"done contexts stop appends":        testContextDone,
+		"sealed segments are read unlocked": testReadSealed,
+		"removal waits for sealed reads":    testRemoveSealed,
 	}
 
-	config := Config{}
-	config.Segment.MaxStoreBytes = 32
+	storages := map[string]func(c *Config){
+		"files":          func(c *Config) {},
+		"portable index": func(c *Config) { c.Segment.IndexAccess = IndexAccessPortable },
+		"memory":         func(c *Config) { c.Segment.Storage = NewMemStorage() },
+	}
 
-	for scenario, fn := range scenarios {
-		testFn := func(t *testing.T) {
-			dir := internal.GetTempDir(t, "store-test")
-			defer os.RemoveAll(dir)
+	for storage, configure := range storages {
+		for scenario, fn := range scenarios {
+			testFn := func(t *testing.T) {
+				dir := internal.GetTempDir(t, "store-test")
+				defer os.RemoveAll(dir)
 
-			log, err := NewLog(dir, config)
-			require.NoError(t, err)
+				config := Config{}
+				config.Segment.MaxStoreBytes = 32
+				configure(&config)
+				log, err := NewLog(dir, config)
+				require.NoError(t, err)
 
-			fn(t, log)
+				fn(t, log)
+			}
+			t.Run(storage+"/"+scenario, testFn)
 		}
-		t.Run(scenario, testFn)
 	}
 }
 
@@ -104,11 +129,12 @@ func testReader(t *testing.T, log *Log) {
 	require.Equal(t, off, uint64(0))
 
 	reader := log.Reader()
-	b, err := io.ReadAll(reader)
+	var b bytes.Buffer
+	err = readRecord(reader, &b, nil)
 	require.NoError(t, err)
 
 	read := &api.Record{}
-	err = proto.Unmarshal(b[lenWidth:], read)
+	err = proto.Unmarshal(b.Bytes(), read)
 	require.NoError(t, err)
 	require.Equal(t, append.Value, read.Value)
 }
@@ -129,3 +155,412 @@ func testTruncate(t *testing.T, log *Log) {
 	_, err = log.Read(0)
 	require.Error(t, err)
 }
+
+func testStats(t *testing.T, log *Log) {
+	// arrange
+	for i := 0; i < 3; i++ {
+		_, err := log.Append(&api.Record{Value: []byte("hello world")})
+		require.NoError(t, err)
+	}
+	require.NoError(t, log.Truncate(0))
+
+	// act
+	stats, err := log.Stats()
+
+	// assert
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), stats.LowestOffset)
+	require.Equal(t, uint64(2), stats.HighestOffset)
+	require.Equal(t, uint64(len(stats.Segments)), stats.SegmentCount)
+	var bytes uint64
+	for _, s := range stats.Segments {
+		bytes += s.StoreBytes + s.IndexBytes
+		require.True(t, s.Age.AsDuration() >= 0)
+		require.Equal(t, float64(s.IndexBytes)/float64(log.Config.Segment.MaxIndexBytes), s.IndexUtilization)
+	}
+	require.Equal(t, bytes, stats.TotalBytes)
+	require.Zero(t, stats.RemoteBytes)
+	require.True(t, stats.Segments[len(stats.Segments)-1].Active)
+}
+
+func testDurableOffset(t *testing.T, log *Log) {
+	// act
+	_, err := log.Append(&api.Record{Value: []byte("a")})
+	require.NoError(t, err)
+	appended := log.DurableOffset()
+	require.NoError(t, log.activeSegment.store.Sync())
+	synced := log.DurableOffset()
+	_, err = log.Append(&api.Record{Value: []byte("b")})
+	require.NoError(t, err)
+	rolled := log.DurableOffset()
+
+	// assert
+	require.Zero(t, appended)
+	require.Equal(t, uint64(1), synced)
+	require.Equal(t, uint64(2), rolled, "the full segment was synced when it was rolled")
+}
+
+func testContextDone(t *testing.T, log *Log) {
+	// arrange
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// act
+	_, appendErr := log.AppendContext(ctx, &api.Record{Value: []byte("hello world")})
+	_, readErr := log.ReadContext(ctx, 0)
+
+	// assert
+	require.ErrorIs(t, appendErr, context.Canceled)
+	require.ErrorIs(t, readErr, context.Canceled)
+	_, err := log.Read(0)
+	require.ErrorAs(t, err, &api.ErrOffsetOutOfRange{}, "the record wasn't appended")
+}
+
+func testReadSealed(t *testing.T, log *Log) {
+	// arrange
+	for i := 0; i < 3; i++ {
+		_, err := log.Append(&api.Record{Value: []byte(fmt.Sprintf("hello world%d", i))})
+		require.NoError(t, err)
+	}
+	require.True(t, len(log.segments) > 1)
+	// an append holds the lock
+	log.mu.Lock()
+	// offsets past the sealed segments are read holding the lock
+	active := make(chan error)
+	go func() {
+		_, err := log.Read(3)
+		active <- err
+	}()
+
+	// act
+	record, err := log.Read(0)
+	require.NoError(t, err)
+	p, encodedErr := log.ReadEncoded(0)
+
+	// assert
+	require.Equal(t, "hello world0", string(record.Value))
+	require.NoError(t, encodedErr)
+	require.NoError(t, proto.Unmarshal(p, record))
+	require.Equal(t, "hello world0", string(record.Value))
+	select {
+	case <-active:
+		t.Fatal("the offset was read without the lock")
+	case <-time.After(50 * time.Millisecond):
+	}
+	log.mu.Unlock()
+	require.ErrorAs(t, <-active, &api.ErrOffsetOutOfRange{})
+}
+
+func testRemoveSealed(t *testing.T, log *Log) {
+	// arrange
+	for i := 0; i < 3; i++ {
+		_, err := log.Append(&api.Record{Value: []byte(fmt.Sprintf("hello world%d", i))})
+		require.NoError(t, err)
+	}
+	s := log.sealedSegment(0)
+	require.NotNil(t, s)
+
+	// act
+	truncated := make(chan error)
+	go func() { truncated <- log.Truncate(0) }()
+
+	// assert
+	select {
+	case <-truncated:
+		t.Fatal("the segment was removed while it was read")
+	case <-time.After(50 * time.Millisecond):
+	}
+	record, err := s.Read(0)
+	require.NoError(t, err)
+	require.Equal(t, "hello world0", string(record.Value))
+	s.release()
+	require.NoError(t, <-truncated)
+	require.Nil(t, log.sealedSegment(0))
+	_, err = log.Read(0)
+	require.ErrorAs(t, err, &api.ErrOffsetOutOfRange{})
+}
+
+func testReadEncoded(t *testing.T, log *Log) {
+	// arrange
+	for i := 0; i < 3; i++ {
+		_, err := log.Append(&api.Record{Value: []byte(fmt.Sprintf("hello world%d", i))})
+		require.NoError(t, err)
+	}
+	require.True(t, len(log.segments) > 1)
+
+	for off := uint64(0); off < 3; off++ {
+		// act
+		p, err := log.ReadEncoded(off)
+
+		// assert
+		require.NoError(t, err)
+		record, err := log.Read(off)
+		require.NoError(t, err)
+		decoded := &api.Record{}
+		require.NoError(t, proto.Unmarshal(p, decoded))
+		require.True(t, proto.Equal(record, decoded))
+	}
+	_, err := log.ReadEncoded(3)
+	require.Equal(t, log.outOfRange(3), err)
+}
+
+func testAppendBatch(t *testing.T, log *Log) {
+	// arrange
+	records := []*api.Record{
+		{Value: []byte("first")},
+		{Value: []byte("second")},
+		{Value: []byte("third")},
+	}
+
+	// act
+	offsets, err := log.AppendBatch(records)
+
+	// assert
+	require.NoError(t, err)
+	require.Equal(t, []uint64{0, 1, 2}, offsets)
+	require.True(t, len(log.segments) > 1)
+	for i, off := range offsets {
+		read, err := log.Read(off)
+		require.NoError(t, err)
+		require.Equal(t, records[i].Value, read.Value)
+	}
+}
+
+func testCorruptRecord(t *testing.T, log *Log) {
+	// arrange
+	off, err := log.Append(&api.Record{Value: []byte("hello")})
+	require.NoError(t, err)
+	store := log.segments[0].store
+	require.NoError(t, store.Sync())
+	f, err := storageOf(log.Config).OpenFile(store.Name(), os.O_RDWR, 0644)
+	require.NoError(t, err)
+	defer f.Close()
+	_, err = f.WriteAt([]byte{0xff}, int64(store.size-1))
+	require.NoError(t, err)
+
+	// act
+	_, err = log.Read(off)
+
+	// assert
+	require.Equal(t, api.ErrCorruptRecord{Offset: off}, err)
+}
+
+func testSnapshotRestore(t *testing.T, log *Log) {
+	// arrange
+	for i := 0; i < 3; i++ {
+		_, err := log.Append(&api.Record{Value: []byte(fmt.Sprintf("hello world%d", i))})
+		require.NoError(t, err)
+	}
+	var snapshot bytes.Buffer
+	require.NoError(t, log.Snapshot(&snapshot))
+
+	dir := internal.GetTempDir(t, "restore-test")
+	defer os.RemoveAll(dir)
+	restored, err := NewLog(dir, log.Config)
+	require.NoError(t, err)
+	defer restored.Close()
+	_, err = restored.Append(&api.Record{Value: []byte("replaced")})
+	require.NoError(t, err)
+
+	// act
+	err = restored.Restore(&snapshot)
+
+	// assert
+	require.NoError(t, err)
+	for i := uint64(0); i < 3; i++ {
+		record, err := restored.Read(i)
+		require.NoError(t, err)
+		require.Equal(t, fmt.Sprintf("hello world%d", i), string(record.Value))
+	}
+	off, err := restored.Append(&api.Record{Value: []byte("next")})
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), off)
+}
+
+func testOffsetByTime(t *testing.T, log *Log) {
+	// arrange
+	log.Config.replicated = true
+	start := time.Date(2024, 1, 1, 15, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		_, err := log.Append(&api.Record{
+			Value:     []byte("hello world"),
+			Timestamp: timestamppb.New(start.Add(time.Duration(i) * time.Minute)),
+		})
+		require.NoError(t, err)
+	}
+	require.True(t, len(log.segments) > 1)
+
+	scenarios := map[string]struct {
+		time   time.Time
+		offset uint64
+	}{
+		"before the first record": {start.Add(-time.Hour), 0},
+		"at a record":             {start.Add(2 * time.Minute), 2},
+		"between records":         {start.Add(90 * time.Second), 2},
+		"after the last record":   {start.Add(time.Hour), 5},
+	}
+
+	for scenario, sc := range scenarios {
+		t.Run(scenario, func(t *testing.T) {
+			// act
+			off, err := log.OffsetByTime(sc.time)
+
+			// assert
+			require.NoError(t, err)
+			require.Equal(t, sc.offset, off)
+		})
+	}
+}
+
+func testTimestampOrder(t *testing.T, log *Log) {
+	// arrange
+	log.Config.replicated = true
+	now := time.Now()
+	_, err := log.Append(&api.Record{Value: []byte("hello world")})
+	require.NoError(t, err)
+	require.NoError(t, log.Close())
+	log, err = NewLog(log.Dir, log.Config)
+	require.NoError(t, err)
+
+	// act
+	off, err := log.Append(&api.Record{
+		Value:     []byte("hello world"),
+		Timestamp: timestamppb.New(now.Add(-time.Hour)),
+	})
+	require.NoError(t, err)
+
+	// assert
+	first, err := log.Read(0)
+	require.NoError(t, err)
+	require.False(t, first.Timestamp.AsTime().Before(now))
+	second, err := log.Read(off)
+	require.NoError(t, err)
+	require.Equal(t, first.Timestamp.AsTime(), second.Timestamp.AsTime())
+}
+
+func testAppendTimestamp(t *testing.T, log *Log) {
+	// arrange
+	before := time.Now()
+
+	// act
+	off, err := log.Append(&api.Record{
+		Value:     []byte("hello world"),
+		Timestamp: timestamppb.New(before.Add(time.Hour)),
+	})
+	require.NoError(t, err)
+	next, err := log.Append(&api.Record{Value: []byte("hello world")})
+	require.NoError(t, err)
+
+	// assert
+	for _, off := range []uint64{off, next} {
+		record, err := log.Read(off)
+		require.NoError(t, err)
+		require.False(t, record.Timestamp.AsTime().Before(before))
+		require.True(t, record.Timestamp.AsTime().Before(before.Add(time.Minute)), "future timestamps don't pin later records")
+	}
+}
+
+func TestLogMaxRecordBytes(t *testing.T) {
+	// arrange
+	dir := internal.GetTempDir(t, "store-test")
+	defer os.RemoveAll(dir)
+	config := Config{}
+	config.MaxRecordBytes = 32
+	log, err := NewLog(dir, config)
+	require.NoError(t, err)
+	defer log.Close()
+	small := &api.Record{Value: []byte("small")}
+	large := &api.Record{Value: make([]byte, 64)}
+
+	// act
+	_, err = log.Append(large)
+
+	// assert
+	var tooLarge api.ErrRecordTooLarge
+	require.ErrorAs(t, err, &tooLarge)
+	require.Equal(t, uint64(32), tooLarge.Limit)
+	require.Greater(t, tooLarge.Size, tooLarge.Limit)
+
+	// act
+	_, err = log.AppendBatch([]*api.Record{small, large})
+
+	// assert
+	require.ErrorAs(t, err, &tooLarge)
+	off, err := log.Append(small)
+	require.NoError(t, err)
+	require.Equal(t, uint64(0), off, "no record of the batch is appended")
+}
+
+// BenchmarkLogRollover appends records which fill a segment each, so every
+// append rolls the log.
+func BenchmarkLogRollover(b *testing.B) {
+	dir := internal.GetTempDir(b, "log-rollover-bench")
+	defer os.RemoveAll(dir)
+	config := Config{}
+	config.Segment.MaxStoreBytes = 32
+	log, err := NewLog(dir, config)
+	require.NoError(b, err)
+	defer log.Close()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		off, err := log.Append(&api.Record{Value: []byte("hello world")})
+		if err != nil {
+			b.Fatal(err)
+		}
+		// the segments' files are removed now and then, so they don't pile up
+		if i%1000 == 999 {
+			b.StopTimer()
+			require.NoError(b, log.Truncate(off-1))
+			b.StartTimer()
+		}
+	}
+}
+
+// FuzzNewLog opens logs whose segment files were corrupted, e.g. by a crash or
+// a failing disk. Corrupt files fail to open or lose their corrupt records,
+// they don't panic.
+func FuzzNewLog(f *testing.F) {
+	dir := f.TempDir()
+	log, err := NewLog(dir, Config{})
+	require.NoError(f, err)
+	for i := 0; i < 3; i++ {
+		_, err := log.Append(&api.Record{Value: []byte(fmt.Sprintf("hello world%d", i))})
+		require.NoError(f, err)
+	}
+	require.NoError(f, log.Close())
+	store, err := os.ReadFile(filepath.Join(dir, "0.store"))
+	require.NoError(f, err)
+	index, err := os.ReadFile(filepath.Join(dir, "0.index"))
+	require.NoError(f, err)
+	f.Add(store, index)
+	f.Add(store[:len(store)/2], index)
+	f.Add(store, index[:len(index)-1])
+	f.Add([]byte{}, make([]byte, 4096))
+	// records written before checksums were added may carry any offset
+	legacy, err := proto.Marshal(&api.Record{Value: []byte("hello world"), Offset: math.MaxUint64})
+	require.NoError(f, err)
+	f.Add(append(enc.AppendUint64(nil, uint64(len(legacy))), legacy...), make([]byte, entWidth))
+
+	f.Fuzz(func(t *testing.T, store, index []byte) {
+		dir := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "0.store"), store, 0644))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "0.index"), index, 0644))
+
+		log, err := NewLog(dir, Config{})
+		if err != nil {
+			return
+		}
+		defer log.Close()
+		lowest, err := log.LowestOffset()
+		require.NoError(t, err)
+		highest, err := log.HighestOffset()
+		require.NoError(t, err)
+		for off := lowest; off <= highest && off < lowest+16; off++ {
+			_, _ = log.Read(off)
+		}
+		_, err = log.Append(&api.Record{Value: []byte("hello world")})
+		require.NoError(t, err)
+	})
+}
@@ -0,0 +1,121 @@
+package log
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	api "github.com/justagabriel/proglog/api/v1"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// maintenanceRun tracks the progress of a task started by RunMaintenance. The
+// runs of the retention goroutine aren't tracked, their run is nil.
+type maintenanceRun struct {
+	mu       sync.Mutex
+	progress *api.MaintenanceProgress
+}
+
+func newMaintenanceRun(task api.MaintenanceTask) *maintenanceRun {
+	return &maintenanceRun{progress: &api.MaintenanceProgress{Task: task, Started: timestamppb.Now()}}
+}
+
+// start sets the number of segments the run processes.
+func (r *maintenanceRun) start(segments int) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.progress.Segments = uint64(segments)
+}
+
+// processed counts a segment processed, reclaimed are the store bytes freed.
+func (r *maintenanceRun) processed(reclaimed uint64) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.progress.SegmentsProcessed++
+	r.progress.BytesReclaimed += reclaimed
+}
+
+// finish ends the run, successful runs processed all segments.
+func (r *maintenanceRun) finish(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.progress.Finished = timestamppb.Now()
+	if err != nil {
+		r.progress.Error = err.Error()
+	} else {
+		r.progress.SegmentsProcessed = r.progress.Segments
+	}
+}
+
+func (r *maintenanceRun) finished() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.progress.Finished != nil
+}
+
+// report returns a copy of the run's progress, estimating its remaining time
+// as of now.
+func (r *maintenanceRun) report(now time.Time) *api.MaintenanceProgress {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	p := proto.Clone(r.progress).(*api.MaintenanceProgress)
+	if p.Finished == nil && p.SegmentsProcessed > 0 && p.Segments > p.SegmentsProcessed {
+		perSegment := now.Sub(p.Started.AsTime()) / time.Duration(p.SegmentsProcessed)
+		p.Eta = durationpb.New(perSegment * time.Duration(p.Segments-p.SegmentsProcessed))
+	}
+	return p
+}
+
+// RunMaintenance runs the task in the background right away and returns its
+// progress, see MaintenanceStatus. A run of the task still in progress isn't
+// started again. Compaction fails with api.ErrCompactionDisabled unless
+// RetentionPolicy.Compact is set.
+func (l *Log) RunMaintenance(task api.MaintenanceTask) (*api.MaintenanceProgress, error) {
+	l.mu.RLock()
+	compact := l.Config.Retention.Compact
+	l.mu.RUnlock()
+	if task == api.MaintenanceTask_MAINTENANCE_TASK_COMPACTION && !compact {
+		return nil, api.ErrCompactionDisabled{}
+	}
+
+	l.maintenanceMu.Lock()
+	defer l.maintenanceMu.Unlock()
+	if run, ok := l.maintenance[task]; ok && !run.finished() {
+		return run.report(time.Now()), nil
+	}
+	run := newMaintenanceRun(task)
+	if l.maintenance == nil {
+		l.maintenance = make(map[api.MaintenanceTask]*maintenanceRun)
+	}
+	l.maintenance[task] = run
+	go func() {
+		if task == api.MaintenanceTask_MAINTENANCE_TASK_COMPACTION {
+			run.finish(l.compactRun(l.closed, run))
+		} else {
+			run.finish(l.enforceRetentionRun(l.closed, time.Now(), run))
+		}
+	}()
+	return run.report(time.Now()), nil
+}
+
+// MaintenanceStatus returns the progress of the latest run of each task
+// started by RunMaintenance.
+func (l *Log) MaintenanceStatus() []*api.MaintenanceProgress {
+	l.maintenanceMu.Lock()
+	defer l.maintenanceMu.Unlock()
+	now := time.Now()
+	runs := make([]*api.MaintenanceProgress, 0, len(l.maintenance))
+	for _, run := range l.maintenance {
+		runs = append(runs, run.report(now))
+	}
+	sort.Slice(runs, func(i, j int) bool { return runs[i].Task < runs[j].Task })
+	return runs
+}
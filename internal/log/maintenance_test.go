@@ -0,0 +1,122 @@
+package log
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	api "github.com/justagabriel/proglog/api/v1"
+	"github.com/justagabriel/proglog/internal"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestMaintenance(t *testing.T) {
+	scenarios := map[string]func(t *testing.T, log *Log){
+		"compaction reports its progress": testMaintenanceCompaction,
+		"retention reports its progress":  testMaintenanceRetention,
+		"compaction has to be enabled":    testMaintenanceCompactionDisabled,
+	}
+
+	for scenario, fn := range scenarios {
+		t.Run(scenario, func(t *testing.T) {
+			dir := internal.GetTempDir(t, "maintenance-test")
+			defer os.RemoveAll(dir)
+
+			config := Config{}
+			config.Segment.MaxStoreBytes = 96
+			log, err := NewLog(dir, config)
+			require.NoError(t, err)
+			defer log.Close()
+
+			fn(t, log)
+		})
+	}
+}
+
+// awaitMaintenance waits for the task's run to finish and returns its progress.
+func awaitMaintenance(t *testing.T, log *Log, task api.MaintenanceTask) *api.MaintenanceProgress {
+	t.Helper()
+	var run *api.MaintenanceProgress
+	require.Eventually(t, func() bool {
+		for _, r := range log.MaintenanceStatus() {
+			if r.Task == task {
+				run = r
+			}
+		}
+		return run != nil && run.Finished != nil
+	}, 5*time.Second, 10*time.Millisecond)
+	return run
+}
+
+func testMaintenanceCompaction(t *testing.T, log *Log) {
+	// arrange
+	log.SetRetention(RetentionPolicy{Compact: true, CheckInterval: time.Hour})
+	for len(log.segments) < 4 {
+		appendKeyed(t, log, "a", "same key")
+	}
+	segments := uint64(len(log.segments) - 1)
+	task := api.MaintenanceTask_MAINTENANCE_TASK_COMPACTION
+
+	// act
+	started, err := log.RunMaintenance(task)
+	require.NoError(t, err)
+	run := awaitMaintenance(t, log, task)
+
+	// assert
+	require.Equal(t, task, started.Task)
+	require.Empty(t, run.Error)
+	require.Equal(t, segments, run.Segments)
+	require.Equal(t, segments, run.SegmentsProcessed)
+	require.NotZero(t, run.BytesReclaimed)
+	require.Nil(t, run.Eta)
+}
+
+func testMaintenanceRetention(t *testing.T, log *Log) {
+	// arrange
+	for len(log.segments) < 4 {
+		appendKeyed(t, log, "", "no key")
+	}
+	log.SetRetention(RetentionPolicy{MaxBytes: 1, CheckInterval: time.Hour})
+	task := api.MaintenanceTask_MAINTENANCE_TASK_RETENTION
+
+	// act
+	_, err := log.RunMaintenance(task)
+	require.NoError(t, err)
+	run := awaitMaintenance(t, log, task)
+
+	// assert
+	require.Empty(t, run.Error)
+	require.Equal(t, uint64(3), run.SegmentsProcessed)
+	require.NotZero(t, run.BytesReclaimed)
+	require.Len(t, log.segments, 1)
+}
+
+func testMaintenanceCompactionDisabled(t *testing.T, log *Log) {
+	// act
+	_, err := log.RunMaintenance(api.MaintenanceTask_MAINTENANCE_TASK_COMPACTION)
+
+	// assert
+	require.Equal(t, api.ErrCompactionDisabled{}, err)
+	require.Empty(t, log.MaintenanceStatus())
+}
+
+func TestMaintenanceETA(t *testing.T) {
+	// arrange
+	started := time.Now()
+	run := newMaintenanceRun(api.MaintenanceTask_MAINTENANCE_TASK_COMPACTION)
+	run.progress.Started = timestamppb.New(started)
+	run.start(4)
+	run.processed(10)
+
+	// act
+	progress := run.report(started.Add(time.Minute))
+	run.finish(nil)
+	finished := run.report(started.Add(2 * time.Minute))
+
+	// assert
+	require.Equal(t, 3*time.Minute, progress.Eta.AsDuration())
+	require.Equal(t, uint64(10), progress.BytesReclaimed)
+	require.Nil(t, finished.Eta)
+	require.Equal(t, uint64(4), finished.SegmentsProcessed)
+}
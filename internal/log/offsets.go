@@ -0,0 +1,101 @@
+package log
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"sync"
+
+	api "github.com/justagabriel/proglog/api/v1"
+)
+
+// ConsumerOffsets stores the committed offsets of consumer groups per topic
+// and persists them in a JSON file. The consumers of a group resume from the
+// group's offset, so they share the topic's records between them.
+type ConsumerOffsets struct {
+	mu      sync.RWMutex
+	path    string
+	offsets map[string]map[string]uint64
+}
+
+// NewConsumerOffsets loads the offsets stored at path, the file is created on the first commit.
+func NewConsumerOffsets(path string) (*ConsumerOffsets, error) {
+	o := &ConsumerOffsets{
+		path:    path,
+		offsets: make(map[string]map[string]uint64),
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return o, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(data, &o.offsets); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// CommitOffset stores the next offset the group consumes from the topic.
+func (o *ConsumerOffsets) CommitOffset(group, topic string, offset uint64) error {
+	topic, err := topicName(topic)
+	if err != nil {
+		return err
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.offsets[group] == nil {
+		o.offsets[group] = make(map[string]uint64)
+	}
+	o.offsets[group][topic] = offset
+	return o.persist()
+}
+
+func (o *ConsumerOffsets) FetchOffset(group, topic string) (uint64, error) {
+	topic, err := topicName(topic)
+	if err != nil {
+		return 0, err
+	}
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+
+	offset, ok := o.offsets[group][topic]
+	if !ok {
+		return 0, api.ErrOffsetNotCommitted{Group: group, Topic: topic}
+	}
+	return offset, nil
+}
+
+func (o *ConsumerOffsets) all() map[string]map[string]uint64 {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+
+	offsets := make(map[string]map[string]uint64, len(o.offsets))
+	for group, topics := range o.offsets {
+		offsets[group] = make(map[string]uint64, len(topics))
+		for topic, offset := range topics {
+			offsets[group][topic] = offset
+		}
+	}
+	return offsets
+}
+
+func (o *ConsumerOffsets) replace(offsets map[string]map[string]uint64) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.offsets = offsets
+	return o.persist()
+}
+
+// persist replaces the file atomically, o.mu has to be held for writing.
+func (o *ConsumerOffsets) persist() error {
+	data, err := json.Marshal(o.offsets)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(o.path, data)
+}
@@ -0,0 +1,117 @@
+package log
+
+import (
+	"io"
+	"os"
+	"path"
+	"testing"
+
+	api "github.com/justagabriel/proglog/api/v1"
+	"github.com/justagabriel/proglog/internal"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConsumerOffsets(t *testing.T) {
+	scenarios := map[string]func(t *testing.T, offsets *ConsumerOffsets, dir string){
+		"commit and fetch an offset succeeds":    testCommitFetchOffset,
+		"uncommitted offset is not found":        testOffsetNotCommitted,
+		"offsets survive a restart":              testOffsetsPersist,
+		"snapshot restores the consumer offsets": testOffsetsSnapshot,
+	}
+
+	for scenario, fn := range scenarios {
+		t.Run(scenario, func(t *testing.T) {
+			dir := internal.GetTempDir(t, "offsets-test")
+			defer os.RemoveAll(dir)
+
+			offsets, err := NewConsumerOffsets(path.Join(dir, "offsets.json"))
+			require.NoError(t, err)
+
+			fn(t, offsets, dir)
+		})
+	}
+}
+
+func testCommitFetchOffset(t *testing.T, offsets *ConsumerOffsets, dir string) {
+	// arrange
+	require.NoError(t, offsets.CommitOffset("billing", "orders", 3))
+	require.NoError(t, offsets.CommitOffset("billing", "orders", 5))
+	require.NoError(t, offsets.CommitOffset("shipping", "orders", 1))
+	require.NoError(t, offsets.CommitOffset("billing", "", 2))
+
+	// act
+	billing, err := offsets.FetchOffset("billing", "orders")
+	require.NoError(t, err)
+	shipping, err := offsets.FetchOffset("shipping", "orders")
+	require.NoError(t, err)
+	defaultTopic, err := offsets.FetchOffset("billing", api.DefaultTopic)
+	require.NoError(t, err)
+
+	// assert
+	require.Equal(t, uint64(5), billing)
+	require.Equal(t, uint64(1), shipping)
+	require.Equal(t, uint64(2), defaultTopic)
+}
+
+func testOffsetNotCommitted(t *testing.T, offsets *ConsumerOffsets, dir string) {
+	// arrange
+	require.NoError(t, offsets.CommitOffset("billing", "orders", 3))
+
+	// act
+	_, otherTopicErr := offsets.FetchOffset("billing", "payments")
+	_, otherGroupErr := offsets.FetchOffset("shipping", "orders")
+	invalidErr := offsets.CommitOffset("billing", "../orders", 3)
+
+	// assert
+	require.Equal(t, api.ErrOffsetNotCommitted{Group: "billing", Topic: "payments"}, otherTopicErr)
+	require.Equal(t, api.ErrOffsetNotCommitted{Group: "shipping", Topic: "orders"}, otherGroupErr)
+	require.Equal(t, api.ErrInvalidTopic{Topic: "../orders"}, invalidErr)
+}
+
+func testOffsetsPersist(t *testing.T, offsets *ConsumerOffsets, dir string) {
+	// arrange
+	require.NoError(t, offsets.CommitOffset("billing", "orders", 3))
+
+	// act
+	reopened, err := NewConsumerOffsets(path.Join(dir, "offsets.json"))
+
+	// assert
+	require.NoError(t, err)
+	off, err := reopened.FetchOffset("billing", "orders")
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), off)
+}
+
+func testOffsetsSnapshot(t *testing.T, offsets *ConsumerOffsets, dir string) {
+	// arrange
+	topics, err := NewTopics(internal.GetTempDir(t, "offsets-log-test"), Config{})
+	require.NoError(t, err)
+	defer topics.Remove()
+	bookmarks, err := NewBookmarks(path.Join(dir, "bookmarks.json"))
+	require.NoError(t, err)
+	require.NoError(t, offsets.CommitOffset("billing", "orders", 3))
+	require.NoError(t, offsets.CommitOffset("billing", "payments", 1))
+
+	source := &fsm{topics: topics, bookmarks: bookmarks, offsets: offsets}
+	snap, err := source.Snapshot()
+	require.NoError(t, err)
+	sink := &testSnapshotSink{}
+	require.NoError(t, snap.Persist(sink))
+
+	restoredTopics, err := NewTopics(internal.GetTempDir(t, "offsets-log-test"), Config{})
+	require.NoError(t, err)
+	defer restoredTopics.Remove()
+	restoredOffsets, err := NewConsumerOffsets(path.Join(dir, "restored.json"))
+	require.NoError(t, err)
+	require.NoError(t, restoredOffsets.CommitOffset("stale", "orders", 7))
+	target := &fsm{topics: restoredTopics, bookmarks: bookmarks, offsets: restoredOffsets}
+
+	// act
+	err = target.Restore(io.NopCloser(&sink.Buffer))
+
+	// assert
+	require.NoError(t, err)
+	require.Equal(t, map[string]map[string]uint64{
+		"billing": {"orders": 3, "payments": 1},
+	}, restoredOffsets.all())
+}
@@ -0,0 +1,182 @@
+package log
+
+import (
+	"sort"
+
+	"github.com/hashicorp/raft"
+)
+
+// JoinZone adds the server to the cluster like Join. With Raft.MaxVoters set,
+// servers beyond it join as non-voters, which replicate the log without
+// taking part in elections and commits, unless their zone has no voter yet.
+// Then a voter of the zone with the most voters is demoted, so the voters
+// spread across as many zones as possible.
+func (l *DistributedLog) JoinZone(id, addr, zone string) error {
+	return l.notLeaderErr(l.join(id, addr, zone, false))
+}
+
+// JoinNonvoter adds the server as read replica, a non-voter which is never
+// promoted, so it serves reads without slowing down commits.
+func (l *DistributedLog) JoinNonvoter(id, addr, zone string) error {
+	return l.notLeaderErr(l.join(id, addr, zone, true))
+}
+
+func (l *DistributedLog) join(id, addr, zone string, replica bool) error {
+	serverID := raft.ServerID(id)
+	l.mu.Lock()
+	if l.zones == nil {
+		l.zones = make(map[raft.ServerID]string)
+		l.replicas = make(map[raft.ServerID]bool)
+	}
+	l.zones[serverID] = zone
+	if replica {
+		l.replicas[serverID] = true
+	} else {
+		delete(l.replicas, serverID)
+	}
+	l.mu.Unlock()
+
+	configFuture := l.raft.GetConfiguration()
+	if err := configFuture.Error(); err != nil {
+		return err
+	}
+
+	serverAddr := raft.ServerAddress(addr)
+	voters := make(map[raft.ServerID]string)
+	for _, srv := range configFuture.Configuration().Servers {
+		if srv.ID == serverID || srv.Address == serverAddr {
+			if srv.ID == serverID && srv.Address == serverAddr {
+				if replica && srv.Suffrage == raft.Voter {
+					return l.raft.DemoteVoter(serverID, 0, 0).Error()
+				}
+				// server has already joined
+				return nil
+			}
+			// remove existing server
+			removeFuture := l.raft.RemoveServer(serverID, 0, 0)
+			if err := removeFuture.Error(); err != nil {
+				return err
+			}
+			continue
+		}
+		if srv.Suffrage == raft.Voter {
+			voters[srv.ID] = l.zone(srv.ID)
+		}
+	}
+	if replica {
+		return l.raft.AddNonvoter(serverID, serverAddr, 0, 0).Error()
+	}
+
+	_, leaderID := l.raft.LeaderWithID()
+	voter, demote := placeVoter(voters, leaderID, zone, l.config.Raft.MaxVoters)
+	if !voter {
+		return l.raft.AddNonvoter(serverID, serverAddr, 0, 0).Error()
+	}
+	if demote != "" {
+		if err := l.raft.DemoteVoter(demote, 0, 0).Error(); err != nil {
+			return err
+		}
+	}
+	return l.raft.AddVoter(serverID, serverAddr, 0, 0).Error()
+}
+
+// promote makes a non-voter a voter once there's room for one, preferring
+// those of zones with the fewest voters.
+func (l *DistributedLog) promote() error {
+	if l.config.Raft.MaxVoters <= 0 {
+		return nil
+	}
+	configFuture := l.raft.GetConfiguration()
+	if err := configFuture.Error(); err != nil {
+		return err
+	}
+	voters := make(map[raft.ServerID]string)
+	nonvoters := make(map[raft.ServerID]string)
+	addrs := make(map[raft.ServerID]raft.ServerAddress)
+	for _, srv := range configFuture.Configuration().Servers {
+		addrs[srv.ID] = srv.Address
+		if srv.Suffrage == raft.Voter {
+			voters[srv.ID] = l.zone(srv.ID)
+		} else if !l.replica(srv.ID) {
+			nonvoters[srv.ID] = l.zone(srv.ID)
+		}
+	}
+	if len(voters) >= l.config.Raft.MaxVoters {
+		return nil
+	}
+	id := promotion(voters, nonvoters)
+	if id == "" {
+		return nil
+	}
+	return l.raft.AddVoter(id, addrs[id], 0, 0).Error()
+}
+
+func (l *DistributedLog) zone(id raft.ServerID) string {
+	if id == l.config.Raft.LocalID {
+		return l.config.Raft.Zone
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.zones[id]
+}
+
+func (l *DistributedLog) replica(id raft.ServerID) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.replicas[id]
+}
+
+// placeVoter decides whether a server joining in the zone becomes a voter,
+// along with the voter to demote to make room for it. The leader is never demoted.
+func placeVoter(voters map[raft.ServerID]string, leader raft.ServerID, zone string, maxVoters int) (bool, raft.ServerID) {
+	if maxVoters <= 0 || len(voters) < maxVoters {
+		return true, ""
+	}
+	perZone := votersPerZone(voters)
+	if zone == "" || perZone[zone] > 0 {
+		return false, ""
+	}
+
+	var demote raft.ServerID
+	most := 1
+	for _, id := range sortedIDs(voters) {
+		if id == leader {
+			continue
+		}
+		if n := perZone[voters[id]]; n > most {
+			demote, most = id, n
+		}
+	}
+	return demote != "", demote
+}
+
+// promotion picks the non-voter of the zone with the fewest voters.
+func promotion(voters, nonvoters map[raft.ServerID]string) raft.ServerID {
+	perZone := votersPerZone(voters)
+	var promote raft.ServerID
+	fewest := -1
+	for _, id := range sortedIDs(nonvoters) {
+		if n := perZone[nonvoters[id]]; fewest < 0 || n < fewest {
+			promote, fewest = id, n
+		}
+	}
+	return promote
+}
+
+func votersPerZone(voters map[raft.ServerID]string) map[string]int {
+	perZone := make(map[string]int)
+	for _, zone := range voters {
+		perZone[zone]++
+	}
+	return perZone
+}
+
+// sortedIDs makes the placement independent of the map's order.
+func sortedIDs(servers map[raft.ServerID]string) []raft.ServerID {
+	ids := make([]raft.ServerID, 0, len(servers))
+	for id := range servers {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
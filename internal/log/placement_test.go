@@ -0,0 +1,55 @@
+package log
+
+import (
+	"testing"
+
+	"github.com/hashicorp/raft"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlaceVoter(t *testing.T) {
+	voters := map[raft.ServerID]string{"0": "a", "1": "a", "2": "b"}
+	for scenario, tc := range map[string]struct {
+		voters    map[raft.ServerID]string
+		leader    raft.ServerID
+		zone      string
+		maxVoters int
+		voter     bool
+		demote    raft.ServerID
+	}{
+		"without limit":             {voters: voters, zone: "a", maxVoters: 0, voter: true},
+		"below limit":               {voters: voters, zone: "a", maxVoters: 4, voter: true},
+		"zone with voter":           {voters: voters, zone: "b", maxVoters: 3, voter: false},
+		"without zone":              {voters: voters, zone: "", maxVoters: 3, voter: false},
+		"new zone":                  {voters: voters, zone: "c", maxVoters: 3, voter: true, demote: "0"},
+		"new zone keeps the leader": {voters: voters, leader: "0", zone: "c", maxVoters: 3, voter: true, demote: "1"},
+		"zones spread": {
+			voters:    map[raft.ServerID]string{"0": "a", "1": "b", "2": "c"},
+			zone:      "d",
+			maxVoters: 3,
+			voter:     false,
+		},
+	} {
+		t.Run(scenario, func(t *testing.T) {
+			// act
+			voter, demote := placeVoter(tc.voters, tc.leader, tc.zone, tc.maxVoters)
+
+			// assert
+			require.Equal(t, tc.voter, voter)
+			require.Equal(t, tc.demote, demote)
+		})
+	}
+}
+
+func TestPromotion(t *testing.T) {
+	// arrange
+	voters := map[raft.ServerID]string{"0": "a", "1": "b"}
+	nonvoters := map[raft.ServerID]string{"2": "a", "3": "c", "4": "b"}
+
+	// act
+	got := promotion(voters, nonvoters)
+
+	// assert
+	require.Equal(t, raft.ServerID("3"), got)
+	require.Equal(t, raft.ServerID(""), promotion(voters, nil))
+}
@@ -0,0 +1,196 @@
+package log
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	api "github.com/justagabriel/proglog/api/v1"
+)
+
+// producersFile holds the producers' state as of a segment roll, the records
+// appended since are replayed when the log is opened.
+const producersFile = "producers.json"
+
+const defaultIdempotencyKeyTTL = 24 * time.Hour
+
+// producerRun is the latest run of an idempotent producer's records, which
+// have consecutive sequence numbers and were appended at consecutive offsets.
+type producerRun struct {
+	FirstSequence uint64 `json:"first_sequence"`
+	LastSequence  uint64 `json:"last_sequence"`
+	FirstOffset   uint64 `json:"first_offset"`
+	// LastAppended is the timestamp of the run's last record in unix
+	// nanoseconds, idempotency keys expire by it.
+	LastAppended int64 `json:"last_appended,omitempty"`
+}
+
+type producersCheckpoint struct {
+	NextOffset uint64                 `json:"next_offset"`
+	Producers  map[string]producerRun `json:"producers"`
+	// the transactions' state, see Log.trackTransaction
+	Aborted   []uint64 `json:"aborted,omitempty"`
+	Open      uint64   `json:"open,omitempty"`
+	Committed uint64   `json:"committed,omitempty"`
+}
+
+// dedup checks the records of an idempotent producer against its latest run.
+// Records retried from it are duplicates, their offsets are returned.
+// l.mu has to be held.
+func (l *Log) dedup(records []*api.Record) (offsets []uint64, dup bool, err error) {
+	id, first := records[0].ProducerId, records[0].Sequence
+	for i, record := range records {
+		if record.ProducerId != id {
+			return nil, false, fmt.Errorf("records of producers %q and %q appended together", id, record.ProducerId)
+		}
+		if id != "" && record.Sequence != first+uint64(i) {
+			return nil, false, api.ErrOutOfOrderSequence{ProducerID: id, Sequence: record.Sequence, Expected: first + uint64(i)}
+		}
+	}
+	run, ok := l.producers[id]
+	if id == "" || !ok || l.expired(id, run) || first == run.LastSequence+1 {
+		return nil, false, nil
+	}
+
+	last := first + uint64(len(records)) - 1
+	switch {
+	case last <= run.LastSequence && first >= run.FirstSequence:
+		for i := range records {
+			offsets = append(offsets, run.FirstOffset+first-run.FirstSequence+uint64(i))
+		}
+		return offsets, true, nil
+	case last <= run.LastSequence:
+		return nil, false, api.ErrDuplicateSequence{ProducerID: id, Sequence: first, LastSequence: run.LastSequence}
+	}
+	return nil, false, api.ErrOutOfOrderSequence{ProducerID: id, Sequence: first, Expected: run.LastSequence + 1}
+}
+
+// restampDuplicates sets the ids and timestamps of an idempotent producer's
+// retried records to the ones of the records appended first, so the caller
+// learns them. l.mu has to be held, records which can't be read anymore are
+// left as they are.
+func (l *Log) restampDuplicates(records []*api.Record, offsets []uint64) {
+	for i, record := range records {
+		appended, err := l.read(offsets[i])
+		if err != nil {
+			continue
+		}
+		record.Id = appended.Id
+		record.Timestamp = appended.Timestamp
+	}
+}
+
+// track adds an appended record to its producer's run and the key index, l.mu
+// has to be held for writing.
+func (l *Log) track(record *api.Record) {
+	l.trackTransaction(record)
+	l.indexKey(record)
+	if record.ProducerId == "" {
+		return
+	}
+	run, ok := l.producers[record.ProducerId]
+	next := run.FirstOffset + run.LastSequence - run.FirstSequence + 1
+	if ok && record.Sequence == run.LastSequence+1 && record.Offset == next {
+		run.LastSequence = record.Sequence
+	} else {
+		run = producerRun{FirstSequence: record.Sequence, LastSequence: record.Sequence, FirstOffset: record.Offset}
+	}
+	if record.Timestamp != nil {
+		run.LastAppended = record.Timestamp.AsTime().UnixNano()
+	}
+	l.producers[record.ProducerId] = run
+}
+
+// loadProducers restores the producers' state from the checkpoint and the
+// records appended after it.
+func (l *Log) loadProducers() error {
+	checkpoint := producersCheckpoint{}
+	data, err := readFile(storageOf(l.Config), filepath.Join(l.Dir, producersFile))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err == nil {
+		if err = json.Unmarshal(data, &checkpoint); err != nil {
+			return err
+		}
+	}
+	l.producers = checkpoint.Producers
+	if l.producers == nil {
+		l.producers = make(map[string]producerRun)
+	}
+	l.aborted = make(map[uint64]bool)
+	for _, id := range checkpoint.Aborted {
+		l.aborted[id] = true
+	}
+	l.open, l.committed = checkpoint.Open, checkpoint.Committed
+
+	for _, s := range l.segments {
+		if s.nextOffset <= checkpoint.NextOffset {
+			continue
+		}
+		err = s.scan(func(record *api.Record) error {
+			if record.Offset >= checkpoint.NextOffset {
+				l.track(record)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	l.pruneProducers()
+	return nil
+}
+
+// expired reports whether the producer is made up for an idempotency key
+// which wasn't used for longer than Config.IdempotencyKeyTTL before the last
+// record. Going by the records' timestamps keeps replicas in agreement.
+func (l *Log) expired(id string, run producerRun) bool {
+	if !strings.HasPrefix(id, api.IdempotencyKeyProducer) {
+		return false
+	}
+	ttl := l.Config.IdempotencyKeyTTL
+	if ttl == 0 {
+		ttl = defaultIdempotencyKeyTTL
+	}
+	return l.lastTimestamp.Sub(time.Unix(0, run.LastAppended)) >= ttl
+}
+
+// pruneProducers forgets the expired idempotency keys and reports whether
+// there were any, l.mu has to be held for writing.
+func (l *Log) pruneProducers() (pruned bool) {
+	for id, run := range l.producers {
+		if l.expired(id, run) {
+			delete(l.producers, id)
+			pruned = true
+		}
+	}
+	return pruned
+}
+
+// checkpointProducers persists the producers' state, so opening the log only
+// replays the records appended afterwards. l.mu has to be held for writing.
+func (l *Log) checkpointProducers() error {
+	pruned := l.pruneProducers()
+	if !pruned && len(l.producers) == 0 && len(l.aborted) == 0 && l.open == 0 && l.committed == 0 {
+		return nil
+	}
+	checkpoint := producersCheckpoint{
+		NextOffset: l.activeSegment.nextOffset,
+		Producers:  l.producers,
+		Open:       l.open,
+		Committed:  l.committed,
+	}
+	for id := range l.aborted {
+		checkpoint.Aborted = append(checkpoint.Aborted, id)
+	}
+	data, err := json.Marshal(checkpoint)
+	if err != nil {
+		return err
+	}
+	return writeFile(storageOf(l.Config), filepath.Join(l.Dir, producersFile), data)
+}
@@ -0,0 +1,200 @@
+package log
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	api "github.com/justagabriel/proglog/api/v1"
+	"github.com/justagabriel/proglog/internal"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestIdempotentProducer(t *testing.T) {
+	scenarios := map[string]func(t *testing.T, log *Log){
+		"retried record returns its offset":     testRetriedRecord,
+		"retried batch returns its offsets":     testRetriedBatch,
+		"retried records get the first ids":     testRetriedIDs,
+		"records of an older run are rejected":  testOlderRunRejected,
+		"sequence gaps are rejected":            testSequenceGapRejected,
+		"producers are restored when reopening": testProducersRestored,
+		"idempotency keys expire":               testIdempotencyKeysExpire,
+	}
+
+	config := Config{}
+	config.Segment.MaxStoreBytes = 64
+
+	for scenario, fn := range scenarios {
+		t.Run(scenario, func(t *testing.T) {
+			dir := internal.GetTempDir(t, "producers-test")
+			defer os.RemoveAll(dir)
+
+			log, err := NewLog(dir, config)
+			require.NoError(t, err)
+			defer log.Close()
+
+			fn(t, log)
+		})
+	}
+}
+
+func produced(id string, sequence uint64) *api.Record {
+	return &api.Record{Value: []byte("hello world"), ProducerId: id, Sequence: sequence}
+}
+
+func testRetriedRecord(t *testing.T, log *Log) {
+	// arrange
+	_, err := log.Append(&api.Record{Value: []byte("anonymous")})
+	require.NoError(t, err)
+	off, err := log.Append(produced("p", 0))
+	require.NoError(t, err)
+
+	// act
+	retried, err := log.Append(produced("p", 0))
+
+	// assert
+	require.NoError(t, err)
+	require.Equal(t, off, retried)
+	highest, err := log.HighestOffset()
+	require.NoError(t, err)
+	require.Equal(t, off, highest, "the retry isn't appended")
+}
+
+func testRetriedBatch(t *testing.T, log *Log) {
+	// arrange
+	offsets, err := log.AppendBatch([]*api.Record{produced("p", 0), produced("p", 1), produced("p", 2)})
+	require.NoError(t, err)
+
+	// act
+	retried, err := log.AppendBatch([]*api.Record{produced("p", 1), produced("p", 2)})
+
+	// assert
+	require.NoError(t, err)
+	require.Equal(t, offsets[1:], retried)
+
+	// act
+	off, err := log.Append(produced("p", 3))
+
+	// assert
+	require.NoError(t, err)
+	require.Equal(t, offsets[2]+1, off)
+}
+
+func testRetriedIDs(t *testing.T, log *Log) {
+	// arrange
+	first := produced("p", 0)
+	first.Id = []byte("first")
+	_, err := log.Append(first)
+	require.NoError(t, err)
+	retry := produced("p", 0)
+	retry.Id = []byte("retry")
+
+	// act
+	_, err = log.Append(retry)
+
+	// assert
+	require.NoError(t, err)
+	require.Equal(t, "first", string(retry.Id))
+	require.Equal(t, first.Timestamp.AsTime(), retry.Timestamp.AsTime())
+}
+
+func testOlderRunRejected(t *testing.T, log *Log) {
+	// arrange
+	_, err := log.Append(produced("p", 0))
+	require.NoError(t, err)
+	_, err = log.Append(produced("other", 0))
+	require.NoError(t, err)
+	_, err = log.Append(produced("p", 1))
+	require.NoError(t, err)
+
+	// act
+	_, err = log.Append(produced("p", 0))
+
+	// assert
+	var dup api.ErrDuplicateSequence
+	require.ErrorAs(t, err, &dup)
+	require.Equal(t, uint64(1), dup.LastSequence)
+}
+
+func testSequenceGapRejected(t *testing.T, log *Log) {
+	// arrange
+	_, err := log.Append(produced("p", 0))
+	require.NoError(t, err)
+
+	// act
+	_, err = log.Append(produced("p", 2))
+
+	// assert
+	var outOfOrder api.ErrOutOfOrderSequence
+	require.ErrorAs(t, err, &outOfOrder)
+	require.Equal(t, uint64(1), outOfOrder.Expected)
+
+	// act
+	_, err = log.AppendBatch([]*api.Record{produced("p", 1), produced("p", 3)})
+
+	// assert
+	require.ErrorAs(t, err, &outOfOrder)
+}
+
+func testProducersRestored(t *testing.T, log *Log) {
+	// arrange
+	var offsets []uint64
+	for i := uint64(0); i < 5; i++ {
+		off, err := log.Append(produced("p", i))
+		require.NoError(t, err)
+		offsets = append(offsets, off)
+	}
+	require.Greater(t, len(log.segments), 1, "the checkpoint is written on rolls")
+	require.NoError(t, log.Close())
+
+	// act
+	reopened, err := NewLog(log.Dir, log.Config)
+	require.NoError(t, err)
+	defer reopened.Close()
+
+	// assert
+	off, err := reopened.Append(produced("p", 4))
+	require.NoError(t, err)
+	require.Equal(t, offsets[4], off)
+	_, err = reopened.Append(produced("p", 6))
+	require.ErrorAs(t, err, &api.ErrOutOfOrderSequence{})
+}
+
+func testIdempotencyKeysExpire(t *testing.T, log *Log) {
+	// arrange
+	log.Config.replicated = true
+	log.Config.IdempotencyKeyTTL = time.Hour
+	start := time.Date(2024, 1, 1, 15, 0, 0, 0, time.UTC)
+	at := func(record *api.Record, d time.Duration) *api.Record {
+		record.Timestamp = timestamppb.New(start.Add(d))
+		return record
+	}
+	key := api.IdempotencyKeyProducer + "root/key"
+	off, err := log.Append(at(produced(key, 0), 0))
+	require.NoError(t, err)
+	_, err = log.Append(at(produced("p", 0), 0))
+	require.NoError(t, err)
+	retried, err := log.Append(at(produced(key, 0), 30*time.Minute))
+	require.NoError(t, err)
+	require.Equal(t, off, retried, "the key hasn't expired yet")
+	segments := len(log.segments)
+
+	// act
+	for len(log.segments) == segments {
+		_, err = log.Append(at(&api.Record{Value: []byte("hello world")}, 2*time.Hour))
+		require.NoError(t, err)
+	}
+
+	// assert
+	require.NotContains(t, log.producers, key, "expired keys are pruned on rolls")
+	require.Contains(t, log.producers, "p", "producers of clients don't expire")
+	require.NoError(t, log.Close())
+	reopened, err := NewLog(log.Dir, log.Config)
+	require.NoError(t, err)
+	defer reopened.Close()
+	require.NotContains(t, reopened.producers, key, "expired keys aren't restored")
+	retried, err = reopened.Append(at(produced(key, 0), 2*time.Hour))
+	require.NoError(t, err)
+	require.Greater(t, retried, off, "an expired key is appended anew")
+}
@@ -0,0 +1,193 @@
+package log
+
+import (
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const defaultRetentionCheckInterval = time.Minute
+
+// startRetention enforces the retention policy in the background until the log is closed.
+// l.mu has to be held for writing.
+func (l *Log) startRetention() {
+	r := l.Config.Retention
+	tiering := l.Config.Tiering.Store != nil
+	if r.MaxAge == 0 && r.MaxBytes == 0 && !r.Compact && !tiering {
+		return
+	}
+	interval := r.CheckInterval
+	if interval == 0 {
+		interval = defaultRetentionCheckInterval
+	}
+
+	done := make(chan struct{})
+	l.retentionDone = done
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case now := <-ticker.C:
+				if err := l.rollAged(done, now); err != nil {
+					zap.L().Named("log").Error(
+						"failed to roll aged segment",
+						zap.String("dir", l.Dir),
+						zap.Error(err),
+					)
+				}
+				if err := l.enforceRetention(done, now); err != nil {
+					zap.L().Named("log").Error(
+						"failed to enforce retention",
+						zap.String("dir", l.Dir),
+						zap.Error(err),
+					)
+				}
+				if r.Compact {
+					if err := l.compact(done); err != nil {
+						zap.L().Named("log").Error(
+							"failed to compact",
+							zap.String("dir", l.Dir),
+							zap.Error(err),
+						)
+					}
+				}
+				if tiering {
+					if err := l.offload(done, now); err != nil {
+						zap.L().Named("log").Error(
+							"failed to offload segments",
+							zap.String("dir", l.Dir),
+							zap.Error(err),
+						)
+					}
+				}
+			}
+		}
+	}()
+}
+
+// SetRetention changes the retention policy while the log is open, the
+// next check enforces it.
+func (l *Log) SetRetention(r RetentionPolicy) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.stopRetention()
+	l.Config.Retention = r
+	l.startRetention()
+}
+
+// stopRetention has to be called with l.mu held for writing.
+func (l *Log) stopRetention() {
+	if l.retentionDone != nil {
+		close(l.retentionDone)
+		l.retentionDone = nil
+	}
+}
+
+// rollAged rolls the active segment once it's older than Config.Segment.MaxAge,
+// appends roll it as well, this covers logs which aren't appended to anymore.
+func (l *Log) rollAged(done <-chan struct{}, now time.Time) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	select {
+	case <-done:
+		return nil
+	default:
+	}
+	if !l.activeSegment.aged(now) {
+		return nil
+	}
+	return l.roll(l.activeSegment.nextOffset)
+}
+
+// enforceRetention removes the oldest segments until the remaining ones satisfy
+// the retention policy. done guards against running on a log closed meanwhile.
+func (l *Log) enforceRetention(done <-chan struct{}, now time.Time) error {
+	return l.enforceRetentionRun(done, now, nil)
+}
+
+// enforceRetentionRun enforces the retention policy, reporting its progress
+// to the run.
+func (l *Log) enforceRetentionRun(done <-chan struct{}, now time.Time, run *maintenanceRun) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	select {
+	case <-done:
+		return nil
+	default:
+	}
+
+	var size uint64
+	for _, remote := range l.remote {
+		size += remote.StoreBytes
+	}
+	for _, s := range l.segments {
+		size += s.store.size
+	}
+
+	r := l.Config.Retention
+	expired := func(modified time.Time) bool {
+		return r.MaxBytes != 0 && size > r.MaxBytes ||
+			r.MaxAge != 0 && now.Sub(modified) > r.MaxAge
+	}
+
+	run.start(len(l.remote) + len(l.segments) - 1)
+	// remote segments precede the local ones
+	var dropped []uint64
+	for _, remote := range l.remote {
+		if !expired(remote.Modified) {
+			break
+		}
+		size -= remote.StoreBytes
+		dropped = append(dropped, remote.StoreBytes)
+	}
+	if len(dropped) > 0 {
+		l.cache.reset()
+		l.notify()
+	}
+	if err := l.dropRemote(len(dropped)); err != nil {
+		return err
+	}
+	for _, reclaimed := range dropped {
+		run.processed(reclaimed)
+	}
+	if len(l.remote) > 0 {
+		return nil
+	}
+
+	removed := 0
+	for _, s := range l.segments {
+		if s == l.activeSegment {
+			break
+		}
+		fi, err := s.store.Stat()
+		if err != nil {
+			return err
+		}
+		if !expired(fi.ModTime()) {
+			break
+		}
+
+		size -= s.store.size
+		reclaimed := s.store.size
+		if err := l.removeSegment(s); err != nil {
+			l.segments = l.segments[removed:]
+			l.publish()
+			return err
+		}
+		run.processed(reclaimed)
+		removed++
+	}
+
+	if removed > 0 {
+		l.segments = l.segments[removed:]
+		l.publish()
+		l.cache.reset()
+		l.notify()
+	}
+	return nil
+}
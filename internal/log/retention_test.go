@@ -0,0 +1,180 @@
+package log
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	api "github.com/justagabriel/proglog/api/v1"
+	"github.com/justagabriel/proglog/internal"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetention(t *testing.T) {
+	scenarios := map[string]func(t *testing.T, config Config, dir string){
+		"segments exceeding max bytes are removed": testRetentionMaxBytes,
+		"segments older than max age are removed":  testRetentionMaxAge,
+		"active segment is never removed":          testRetentionKeepsActive,
+		"background goroutine enforces retention":  testRetentionBackground,
+		"changed policy is enforced":               testSetRetention,
+		"aged active segment is rolled":            testRollAged,
+	}
+
+	for scenario, fn := range scenarios {
+		t.Run(scenario, func(t *testing.T) {
+			dir := internal.GetTempDir(t, "retention-test")
+			defer os.RemoveAll(dir)
+
+			config := Config{}
+			config.Segment.MaxStoreBytes = 48
+			// enforced by the tests themselves, unless they configure otherwise
+			config.Retention.CheckInterval = time.Hour
+
+			fn(t, config, dir)
+		})
+	}
+}
+
+// appendRecords appends records until the log has the given amount of segments.
+func appendRecords(t *testing.T, log *Log, segments int) {
+	t.Helper()
+	for len(log.segments) < segments {
+		_, err := log.Append(&api.Record{Value: []byte("hello world")})
+		require.NoError(t, err)
+	}
+}
+
+func testRetentionMaxBytes(t *testing.T, config Config, dir string) {
+	// arrange
+	config.Retention.MaxBytes = 64
+	log, err := NewLog(dir, config)
+	require.NoError(t, err)
+	defer log.Close()
+	appendRecords(t, log, 4)
+
+	// act
+	err = log.enforceRetention(nil, time.Now())
+
+	// assert
+	require.NoError(t, err)
+	var size uint64
+	for _, s := range log.segments {
+		size += s.store.size
+	}
+	require.LessOrEqual(t, size, uint64(64))
+	lowest, err := log.LowestOffset()
+	require.NoError(t, err)
+	_, err = log.Read(lowest - 1)
+	require.Equal(t, api.ErrOffsetOutOfRange{Offset: lowest - 1, LogStartOffset: lowest, HighestOffset: lowest - 1}, err)
+}
+
+func testRetentionMaxAge(t *testing.T, config Config, dir string) {
+	// arrange
+	config.Retention.MaxAge = time.Hour
+	log, err := NewLog(dir, config)
+	require.NoError(t, err)
+	defer log.Close()
+	appendRecords(t, log, 3)
+
+	// act
+	err = log.enforceRetention(nil, time.Now())
+	require.NoError(t, err)
+	keptSegments := len(log.segments)
+	err = log.enforceRetention(nil, time.Now().Add(2*time.Hour))
+
+	// assert
+	require.NoError(t, err)
+	require.Equal(t, 3, keptSegments)
+	require.Equal(t, 1, len(log.segments))
+}
+
+func testRetentionKeepsActive(t *testing.T, config Config, dir string) {
+	// arrange
+	config.Retention.MaxBytes = 1
+	log, err := NewLog(dir, config)
+	require.NoError(t, err)
+	defer log.Close()
+	appendRecords(t, log, 2)
+	off, err := log.Append(&api.Record{Value: []byte("hello world")})
+	require.NoError(t, err)
+
+	// act
+	err = log.enforceRetention(nil, time.Now())
+	require.NoError(t, err)
+	truncateErr := log.Truncate(off)
+
+	// assert
+	require.NoError(t, truncateErr)
+	require.Equal(t, []*segment{log.activeSegment}, log.segments)
+	record, err := log.Read(off)
+	require.NoError(t, err)
+	require.Equal(t, []byte("hello world"), record.Value)
+}
+
+func testRetentionBackground(t *testing.T, config Config, dir string) {
+	// arrange
+	config.Retention.MaxBytes = 1
+	config.Retention.CheckInterval = 10 * time.Millisecond
+	log, err := NewLog(dir, config)
+	require.NoError(t, err)
+	defer log.Close()
+
+	// act
+	for i := 0; i < 5; i++ {
+		_, err = log.Append(&api.Record{Value: []byte("hello world")})
+		require.NoError(t, err)
+	}
+
+	// assert
+	require.Eventually(t, func() bool {
+		lowest, err := log.LowestOffset()
+		require.NoError(t, err)
+		return lowest > 0
+	}, time.Second, 10*time.Millisecond)
+}
+
+func testSetRetention(t *testing.T, config Config, dir string) {
+	// arrange
+	log, err := NewLog(dir, config)
+	require.NoError(t, err)
+	defer log.Close()
+	appendRecords(t, log, 4)
+
+	// act
+	log.SetRetention(RetentionPolicy{MaxBytes: 1, CheckInterval: 10 * time.Millisecond})
+
+	// assert
+	require.Eventually(t, func() bool {
+		lowest, err := log.LowestOffset()
+		require.NoError(t, err)
+		return lowest > 0
+	}, time.Second, 10*time.Millisecond)
+}
+
+func testRollAged(t *testing.T, config Config, dir string) {
+	// arrange
+	config.Segment.MaxStoreBytes = 1024
+	config.Segment.MaxAge = time.Hour
+	config.Retention.MaxAge = time.Minute
+	log, err := NewLog(dir, config)
+	require.NoError(t, err)
+	defer log.Close()
+	_, err = log.Append(&api.Record{Value: []byte("hello world")})
+	require.NoError(t, err)
+	require.Len(t, log.segments, 1)
+	later := time.Now().Add(2 * time.Hour)
+
+	// act
+	notAged := log.rollAged(nil, time.Now())
+	rolled := log.rollAged(nil, later)
+	enforced := log.enforceRetention(nil, later)
+
+	// assert
+	require.NoError(t, notAged)
+	require.NoError(t, rolled)
+	require.NoError(t, enforced)
+	require.Len(t, log.segments, 1)
+	require.Equal(t, uint64(1), log.activeSegment.baseOffset)
+	_, err = log.Read(0)
+	require.Error(t, err, "the rolled segment was removed by retention")
+}
@@ -0,0 +1,92 @@
+package log
+
+import (
+	"sort"
+	"time"
+
+	api "github.com/justagabriel/proglog/api/v1"
+)
+
+// sealedView lists the segments which aren't written to anymore along with
+// the log start offset, so reads of those segments neither take l.mu nor
+// wait for appends. It's replaced by publish whenever either changes, the
+// segments are kept open by acquire while they're read.
+type sealedView struct {
+	start    uint64
+	segments []*segment
+}
+
+// publish replaces the sealed view, l.mu has to be held for writing.
+func (l *Log) publish() {
+	v := &sealedView{start: l.start}
+	for _, s := range l.segments {
+		if s != l.activeSegment {
+			v.segments = append(v.segments, s)
+		}
+	}
+	l.sealed.Store(v)
+}
+
+// sealedSegment acquires the sealed segment holding the offset, nil if the
+// view has none, e.g. the offset is in the active segment or the segment was
+// closed meanwhile. It has to be released.
+func (l *Log) sealedSegment(off uint64) *segment {
+	v := l.sealed.Load()
+	if v == nil || off < v.start {
+		return nil
+	}
+	i := sort.Search(len(v.segments), func(i int) bool {
+		return off < v.segments[i].nextOffset
+	})
+	if i == len(v.segments) || off < v.segments[i].baseOffset {
+		return nil
+	}
+	s := v.segments[i]
+	if !s.acquire() {
+		return nil
+	}
+	return s
+}
+
+// readSealed reads the record of a sealed segment without taking l.mu. It
+// reports false for the reads it can't answer on its own, which are made
+// holding l.mu instead: those of other segments, failing ones, those of
+// transactional records, whether they're hidden depends on l.aborted, and
+// those of expired records, whose out of range error needs the offsets.
+func (l *Log) readSealed(off uint64) (*api.Record, bool) {
+	s := l.sealedSegment(off)
+	if s == nil {
+		return nil, false
+	}
+	record, ok := l.cache.get(off)
+	if !ok {
+		var err error
+		if record, err = s.Read(off); err != nil {
+			s.release()
+			return nil, false
+		}
+		l.cache.add(record)
+	}
+	s.release()
+	if record.Transaction != 0 || record.Marker != api.TransactionMarker_TRANSACTION_MARKER_NONE || expired(record, time.Now()) {
+		return nil, false
+	}
+	return record, true
+}
+
+// readSealedEncoded is readSealed for ReadEncoded.
+func (l *Log) readSealedEncoded(off uint64) ([]byte, bool) {
+	s := l.sealedSegment(off)
+	if s == nil {
+		return nil, false
+	}
+	b, err := s.readEncoded(off)
+	s.release()
+	if err != nil {
+		return nil, false
+	}
+	if transaction, _ := encodedTransaction(b); transaction != 0 || expiredEncoded(b, time.Now()) {
+		return nil, false
+	}
+	return b, true
+}
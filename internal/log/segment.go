@@ -2,8 +2,12 @@ package log
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"path"
+	"sort"
+	"sync"
+	"time"
 
 	api "github.com/justagabriel/proglog/api/v1"
 	"google.golang.org/protobuf/proto"
@@ -14,16 +18,34 @@ type segment struct {
 	index                  *index
 	baseOffset, nextOffset uint64
 	config                 Config
+	// lastPos is the position of the last record in the store
+	lastPos uint64
+	// unindexed counts the records following the last indexed one
+	unindexed uint64
+	// first is the time of the first record, see Config.Segment.MaxAge
+	first time.Time
+	// readers waits for the reads in progress which don't hold the log's
+	// lock, see acquire. readersMu guards adding to it and retired, which is
+	// set once the segment is closed.
+	readersMu sync.Mutex
+	readers   sync.WaitGroup
+	retired   bool
 }
 
+// newSegment opens the active segment of a log, see recover.
 func newSegment(dir string, baseOffset uint64, c Config) (*segment, error) {
+	return openSegment(dir, baseOffset, c, false)
+}
+
+// openSegment opens a segment, sealed tells whether it's followed by others.
+func openSegment(dir string, baseOffset uint64, c Config, sealed bool) (*segment, error) {
 	s := &segment{
 		baseOffset: baseOffset,
 		config:     c,
 	}
 
-	var err error
-	storeFile, err := os.OpenFile(
+	storage := storageOf(c)
+	storeFile, err := storage.OpenFile(
 		path.Join(dir, fmt.Sprintf("%d%s", baseOffset, ".store")),
 		os.O_RDWR|os.O_CREATE|os.O_APPEND,
 		0644,
@@ -32,12 +54,12 @@ func newSegment(dir string, baseOffset uint64, c Config) (*segment, error) {
 		return nil, err
 	}
 
-	s.store, err = newStore(storeFile)
+	s.store, err = newStore(storeFile, c)
 	if err != nil {
 		return nil, err
 	}
 
-	indexFile, err := os.OpenFile(
+	indexFile, err := storage.OpenFile(
 		path.Join(dir, fmt.Sprintf("%d%s", baseOffset, ".index")),
 		os.O_RDWR|os.O_CREATE,
 		0644,
@@ -50,63 +72,350 @@ func newSegment(dir string, baseOffset uint64, c Config) (*segment, error) {
 	if err != nil {
 		return nil, err
 	}
+	if err = s.recover(sealed); err != nil {
+		// only entries following the written ones were dropped from the
+		// index, closing keeps the files' contents
+		_ = s.store.Close()
+		_ = s.index.Close()
+		return nil, err
+	}
+	return s, nil
+}
 
-	off, _, err := s.index.Read(-1)
-	if err != nil {
-		s.nextOffset = baseOffset
-	} else {
-		s.nextOffset = baseOffset + uint64(off) + 1
+// recover drops what a crash in the middle of appending left behind. The index
+// of a segment which wasn't closed keeps the size it was grown to, its entries
+// are followed by zeros. Entries whose record is incomplete are dropped as well
+// as the store's bytes following the last intact record. The records following
+// the last indexed one are scanned to find the segment's next offset.
+// Sealed segments were synced before the next one was started, so a corrupt
+// record in one isn't a torn append and the intact records following it
+// mustn't be dropped: recover fails with api.ErrCorruptRecord instead,
+// leaving the files as they are.
+func (s *segment) recover(sealed bool) error {
+	s.nextOffset = s.baseOffset
+	var entries int64
+	var lastOff uint32
+	var lastPos uint64
+	for ; ; entries++ {
+		off, pos, err := s.index.Read(entries)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		// offsets and positions only grow, a zeroed entry ends the written ones
+		if entries > 0 && (off <= lastOff || pos <= lastPos) {
+			break
+		}
+		lastOff, lastPos = off, pos
 	}
 
-	return s, nil
+	var pos uint64
+	for ; entries > 0; entries-- {
+		off, p, err := s.index.Read(entries - 1)
+		if err != nil {
+			return err
+		}
+		pos = p
+		if _, _, err = s.decode(pos); err == nil {
+			break
+		}
+		if err != errCorruptRecord {
+			return err
+		}
+		if sealed {
+			return api.ErrCorruptRecord{Offset: s.baseOffset + uint64(off)}
+		}
+	}
+	s.index.size = uint64(entries) * entWidth
+	if entries == 0 {
+		if sealed && s.store.size > 0 {
+			return api.ErrCorruptRecord{Offset: s.baseOffset}
+		}
+		return s.store.truncate(0)
+	}
+
+	s.unindexed = 0
+	for indexed := true; pos < s.store.size; indexed = false {
+		record, end, err := s.decode(pos)
+		if err == errCorruptRecord || err == nil && record.Offset < s.nextOffset {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if !indexed {
+			s.unindexed++
+		}
+		s.lastPos, s.nextOffset = pos, record.Offset+1
+		pos = end
+	}
+	if sealed && pos < s.store.size {
+		return api.ErrCorruptRecord{Offset: s.nextOffset}
+	}
+	if err := s.store.truncate(pos); err != nil {
+		return err
+	}
+	// a corrupt first record is left to Log.Verify, the segment ages from now on
+	first, _, err := s.decode(0)
+	if err != nil && err != errCorruptRecord {
+		return err
+	}
+	if first == nil {
+		first = &api.Record{}
+	}
+	s.setFirst(first)
+	return nil
 }
 
 func (s *segment) Append(record *api.Record) (offset uint64, err error) {
-	currentOffset := s.nextOffset
-	record.Offset = currentOffset
+	record.Offset = s.nextOffset
+	if err = s.write(record); err != nil {
+		return 0, err
+	}
+	return record.Offset, nil
+}
 
+// write appends the record keeping its offset, which must not be below nextOffset.
+func (s *segment) write(record *api.Record) error {
 	p, err := proto.Marshal(record)
 	if err != nil {
-		return 0, err
+		return err
 	}
 	_, pos, err := s.store.Append(p)
 	if err != nil {
-		return 0, err
+		return err
 	}
-	if err = s.index.Write(
-		// index offsets are relative to base offset
-		uint32(s.nextOffset-uint64(s.baseOffset)),
-		pos,
-	); err != nil {
-		return 0, err
+	if pos == 0 || s.unindexed+1 >= s.config.Segment.IndexInterval {
+		if err = s.index.Write(
+			// index offsets are relative to base offset
+			uint32(record.Offset-s.baseOffset),
+			pos,
+		); err != nil {
+			// the record mustn't be found by scanning the store
+			if terr := s.store.truncate(pos); terr != nil {
+				return terr
+			}
+			return err
+		}
+		s.unindexed = 0
+	} else {
+		s.unindexed++
 	}
 
-	s.nextOffset++
-	return currentOffset, nil
+	if pos == 0 {
+		s.setFirst(record)
+	}
+	s.lastPos = pos
+	s.nextOffset = record.Offset + 1
+	return nil
 }
 
+// setFirst remembers the time of the segment's first record, records without
+// timestamp count from now.
+func (s *segment) setFirst(record *api.Record) {
+	s.first = recordTime(record)
+	if s.first.IsZero() {
+		s.first = time.Now()
+	}
+}
+
+// Read finds the closest indexed record and scans the store from there.
 func (s *segment) Read(off uint64) (*api.Record, error) {
-	_, pos, err := s.index.Read(int64(off - s.baseOffset))
-	if err != nil {
+	_, pos, err := s.index.floor(uint32(off - s.baseOffset))
+	for err == nil && pos < s.store.size {
+		var record *api.Record
+		record, pos, err = s.decode(pos)
+		switch {
+		case err == errCorruptRecord:
+			return nil, api.ErrCorruptRecord{Offset: off}
+		case err != nil:
+			return nil, err
+		case record.Offset == off:
+			return record, nil
+		case record.Offset > off:
+			err = io.EOF
+		}
+	}
+	if err != nil && err != io.EOF {
 		return nil, err
 	}
+	// the record has been compacted away
+	return nil, api.ErrOffsetOutOfRange{Offset: off}
+}
 
-	p, err := s.store.Read(pos)
+// readEncoded returns the encoded record at the offset. Indexed records are
+// read from the store without decoding them, the others are found by Read.
+func (s *segment) readEncoded(off uint64) ([]byte, error) {
+	rel, pos, err := s.index.floor(uint32(off - s.baseOffset))
+	if err == nil && s.baseOffset+uint64(rel) == off {
+		p, _, err := s.store.readAt(pos)
+		if err == errCorruptRecord {
+			return nil, api.ErrCorruptRecord{Offset: off}
+		}
+		return p, err
+	}
+	record, err := s.Read(off)
 	if err != nil {
 		return nil, err
 	}
+	return proto.Marshal(record)
+}
 
+// position returns the position of the first record at or after the offset,
+// the store's size if there is none. The offset must not be below the base offset.
+func (s *segment) position(off uint64) (uint64, error) {
+	_, pos, err := s.index.floor(uint32(off - s.baseOffset))
+	if err == io.EOF {
+		pos, err = 0, nil
+	}
+	for err == nil && pos < s.store.size {
+		var record *api.Record
+		var end uint64
+		record, end, err = s.decode(pos)
+		if err == errCorruptRecord {
+			return 0, api.ErrCorruptRecord{Offset: off}
+		}
+		if err == nil && record.Offset >= off {
+			return pos, nil
+		}
+		pos = end
+	}
+	return pos, err
+}
+
+// decode reads the record at pos from the store along with the position of
+// the next record. Records which can't be unmarshaled are corrupt.
+func (s *segment) decode(pos uint64) (*api.Record, uint64, error) {
+	p, end, err := s.store.readAt(pos)
+	if err != nil {
+		return nil, 0, err
+	}
 	record := &api.Record{}
-	err = proto.Unmarshal(p, record)
-	return record, err
+	if err = proto.Unmarshal(p, record); err != nil {
+		return nil, 0, errCorruptRecord
+	}
+	return record, end, nil
+}
+
+// scan calls fn with each record of the segment in offset order.
+func (s *segment) scan(fn func(record *api.Record) error) error {
+	next := s.baseOffset
+	for pos := uint64(0); pos < s.store.size; {
+		record, end, err := s.decode(pos)
+		if err == errCorruptRecord {
+			return api.ErrCorruptRecord{Offset: next}
+		}
+		if err != nil {
+			return err
+		}
+		if err = fn(record); err != nil {
+			return err
+		}
+		next, pos = record.Offset+1, end
+	}
+	return nil
+}
+
+// empty reports whether the segment holds no records.
+func (s *segment) empty() bool {
+	return s.store.size == 0
+}
+
+// lastTimestamp returns the timestamp of the segment's last record, which
+// must not be empty.
+func (s *segment) lastTimestamp() (time.Time, error) {
+	record, _, err := s.decode(s.lastPos)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return recordTime(record), nil
+}
+
+// recordTime returns the record's timestamp, the zero time for records
+// appended before records had timestamps.
+func recordTime(record *api.Record) time.Time {
+	if record.Timestamp == nil {
+		return time.Time{}
+	}
+	return record.Timestamp.AsTime()
+}
+
+// searchTime returns the offset of the first record with a timestamp at or
+// after t, ok is false if there is none. The indexed records are searched
+// first, the record is one of those following the last one before t.
+func (s *segment) searchTime(t time.Time) (off uint64, ok bool, err error) {
+	if s.empty() {
+		return 0, false, nil
+	}
+	entry := sort.Search(s.index.entries(), func(n int) bool {
+		var pos uint64
+		var record *api.Record
+		if err == nil {
+			_, pos, err = s.index.Read(int64(n))
+		}
+		if err == nil {
+			record, _, err = s.decode(pos)
+		}
+		return err != nil || !recordTime(record).Before(t)
+	})
+	if err != nil {
+		return 0, false, err
+	}
+	if entry > 0 {
+		entry--
+	}
+
+	_, pos, err := s.index.Read(int64(entry))
+	for err == nil && pos < s.store.size {
+		var record *api.Record
+		record, pos, err = s.decode(pos)
+		if err == nil && !recordTime(record).Before(t) {
+			return record.Offset, true, nil
+		}
+	}
+	return 0, false, err
 }
 
 func (s *segment) IsMaxed() bool {
 	return s.store.size >= s.config.Segment.MaxStoreBytes ||
-		s.index.size >= s.config.Segment.MaxIndexBytes
+		s.index.size >= s.config.Segment.MaxIndexBytes ||
+		s.aged(time.Now())
+}
+
+// aged reports whether the segment's first record is older than Config.Segment.MaxAge.
+func (s *segment) aged(now time.Time) bool {
+	maxAge := s.config.Segment.MaxAge
+	return maxAge != 0 && !s.empty() && now.Sub(s.first) >= maxAge
+}
+
+// acquire keeps the segment from being closed until release is called, it
+// reports false if it's closed already.
+func (s *segment) acquire() bool {
+	s.readersMu.Lock()
+	defer s.readersMu.Unlock()
+	if s.retired {
+		return false
+	}
+	s.readers.Add(1)
+	return true
+}
+
+func (s *segment) release() {
+	s.readers.Done()
+}
+
+// retire waits for the reads in progress and fails those to come.
+func (s *segment) retire() {
+	s.readersMu.Lock()
+	s.retired = true
+	s.readersMu.Unlock()
+	s.readers.Wait()
 }
 
 func (s *segment) Close() error {
+	s.retire()
 	err := s.index.Close()
 	if err != nil {
 		return err
@@ -126,11 +435,12 @@ func (s *segment) Remove() error {
 		return err
 	}
 
-	err = os.Remove(s.index.Name())
+	storage := storageOf(s.config)
+	err = storage.Remove(s.index.Name())
 	if err != nil {
 		return err
 	}
 
-	err = os.Remove(s.store.Name())
+	err = storage.Remove(s.store.Name())
 	return err
 }
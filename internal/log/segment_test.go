@@ -3,11 +3,14 @@ package log
 import (
 	"io"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	api "github.com/justagabriel/proglog/api/v1"
 	"github.com/justagabriel/proglog/internal"
 	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 func TestSegment(t *testing.T) {
@@ -59,3 +62,209 @@ func TestSegment(t *testing.T) {
 	require.NoError(t, err)
 	require.False(t, s.IsMaxed())
 }
+
+func TestSegmentMaxAge(t *testing.T) {
+	// arrange
+	dir := internal.GetTempDir(t, "segment-test")
+	defer os.RemoveAll(dir)
+	c := Config{}
+	c.Segment.MaxStoreBytes = 1024
+	c.Segment.MaxIndexBytes = 1024
+	c.Segment.MaxAge = time.Hour
+	s, err := newSegment(dir, 0, c)
+	require.NoError(t, err)
+	require.False(t, s.IsMaxed(), "empty segments don't age")
+
+	// act
+	_, err = s.Append(&api.Record{
+		Value:     []byte("hello world"),
+		Timestamp: timestamppb.New(time.Now().Add(-2 * time.Hour)),
+	})
+	require.NoError(t, err)
+	require.NoError(t, s.Close())
+	reopened, err := newSegment(dir, 0, c)
+	require.NoError(t, err)
+	defer reopened.Remove()
+
+	// assert
+	require.True(t, s.IsMaxed())
+	require.True(t, reopened.IsMaxed(), "the first record's time is read on recovery")
+	require.False(t, reopened.aged(time.Now().Add(-90*time.Minute)))
+}
+
+func TestSegmentRecover(t *testing.T) {
+	scenarios := map[string]struct {
+		// tear returns how many bytes the crashed segment's store loses
+		tear    func(recordWidth int64) int64
+		records uint64
+	}{
+		"unclosed index is trimmed to its entries": {
+			tear:    func(int64) int64 { return 0 },
+			records: 3,
+		},
+		"torn record at the tail is dropped": {
+			tear:    func(int64) int64 { return 1 },
+			records: 2,
+		},
+		"record missing from the store is dropped": {
+			tear:    func(recordWidth int64) int64 { return recordWidth },
+			records: 2,
+		},
+	}
+
+	for scenario, sc := range scenarios {
+		t.Run(scenario, func(t *testing.T) {
+			// arrange
+			dir := internal.GetTempDir(t, "segment-recover-test")
+			defer os.RemoveAll(dir)
+			c := Config{}
+			c.Segment.MaxStoreBytes = 1024
+			c.Segment.MaxIndexBytes = 1024
+
+			s, err := newSegment(dir, 16, c)
+			require.NoError(t, err)
+			for i := 0; i < 3; i++ {
+				_, err = s.Append(&api.Record{Value: write})
+				require.NoError(t, err)
+			}
+			crash(t, s)
+			size := int64(s.store.size)
+			require.NoError(t, os.Truncate(s.store.Name(), size-sc.tear(size/3)))
+
+			// act
+			s, err = newSegment(dir, 16, c)
+			require.NoError(t, err)
+			defer s.Close()
+
+			// assert
+			require.Equal(t, 16+sc.records, s.nextOffset)
+			for off := uint64(16); off < s.nextOffset; off++ {
+				got, err := s.Read(off)
+				require.NoError(t, err)
+				require.Equal(t, write, got.Value)
+			}
+			off, err := s.Append(&api.Record{Value: []byte("after crash")})
+			require.NoError(t, err)
+			require.Equal(t, 16+sc.records, off)
+			got, err := s.Read(off)
+			require.NoError(t, err)
+			require.Equal(t, []byte("after crash"), got.Value)
+		})
+	}
+}
+
+// crash releases the segment's files the way a crashing process does,
+// buffered store writes are kept so the test controls what got lost.
+func crash(t *testing.T, s *segment) {
+	t.Helper()
+	require.NoError(t, s.store.Sync())
+	require.NoError(t, s.store.File.Close())
+	require.NoError(t, s.index.mmap.UnsafeUnmap())
+	require.NoError(t, s.index.file.Close())
+}
+
+func TestSegmentRecoverCorruptMiddle(t *testing.T) {
+	scenarios := map[string]struct {
+		sealed bool
+		// records is the number of records left, zero if opening fails
+		records uint64
+	}{
+		"active segment drops the records from the corrupt one on": {sealed: false, records: 1},
+		"sealed segment fails to open and is kept":                 {sealed: true},
+	}
+
+	for scenario, sc := range scenarios {
+		t.Run(scenario, func(t *testing.T) {
+			// arrange
+			dir := internal.GetTempDir(t, "segment-corrupt-test")
+			defer os.RemoveAll(dir)
+			c := Config{}
+			c.Segment.MaxStoreBytes = 1024
+			c.Segment.MaxIndexBytes = 1024
+			s, err := newSegment(dir, 16, c)
+			require.NoError(t, err)
+			for i := 0; i < 3; i++ {
+				_, err = s.Append(&api.Record{Value: write})
+				require.NoError(t, err)
+			}
+			pos, err := s.position(17)
+			require.NoError(t, err)
+			require.NoError(t, s.Close())
+			f, err := os.OpenFile(s.store.Name(), os.O_RDWR, 0644)
+			require.NoError(t, err)
+			_, err = f.WriteAt([]byte{0xff}, int64(pos)+lenWidth+1)
+			require.NoError(t, err)
+			require.NoError(t, f.Close())
+			// the index lost the entries after the first, so recovery scans
+			// the store through the corrupt record
+			idx, err := os.OpenFile(s.index.Name(), os.O_RDWR, 0644)
+			require.NoError(t, err)
+			_, err = idx.WriteAt(make([]byte, 2*entWidth), int64(entWidth))
+			require.NoError(t, err)
+			require.NoError(t, idx.Close())
+			before, err := os.Stat(s.store.Name())
+			require.NoError(t, err)
+
+			// act
+			s, err = openSegment(dir, 16, c, sc.sealed)
+
+			// assert
+			if sc.sealed {
+				require.Equal(t, api.ErrCorruptRecord{Offset: 17}, err)
+				after, err := os.Stat(filepath.Join(dir, "16.store"))
+				require.NoError(t, err)
+				require.Equal(t, before.Size(), after.Size(), "the intact record after the corrupt one is kept")
+				return
+			}
+			require.NoError(t, err)
+			defer s.Close()
+			require.Equal(t, 16+sc.records, s.nextOffset)
+		})
+	}
+}
+
+func TestSegmentSparseIndex(t *testing.T) {
+	// arrange
+	dir := internal.GetTempDir(t, "segment-sparse-test")
+	defer os.RemoveAll(dir)
+	c := Config{}
+	c.Segment.MaxStoreBytes = 1024
+	c.Segment.MaxIndexBytes = 1024
+	c.Segment.IndexInterval = 3
+	start := time.Now()
+
+	s, err := newSegment(dir, 16, c)
+	require.NoError(t, err)
+	for i := 0; i < 7; i++ {
+		ts := timestamppb.New(start.Add(time.Duration(i) * time.Second))
+		_, err = s.Append(&api.Record{Value: write, Timestamp: ts})
+		require.NoError(t, err)
+	}
+	require.NoError(t, s.Close())
+
+	// act
+	s, err = newSegment(dir, 16, c)
+	require.NoError(t, err)
+	defer s.Close()
+	off, err := s.Append(&api.Record{Value: write, Timestamp: timestamppb.New(start.Add(7 * time.Second))})
+	require.NoError(t, err)
+
+	// assert
+	require.Equal(t, uint64(23), off)
+	require.Equal(t, 3, s.index.entries(), "records 16, 19 and 22 are indexed")
+	for off := uint64(16); off < s.nextOffset; off++ {
+		got, err := s.Read(off)
+		require.NoError(t, err)
+		require.Equal(t, off, got.Offset)
+	}
+	_, err = s.Read(s.nextOffset)
+	require.Equal(t, api.ErrOffsetOutOfRange{Offset: s.nextOffset}, err)
+
+	found, ok, err := s.searchTime(start.Add(4500 * time.Millisecond))
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, uint64(21), found)
+	_, ok, err = s.searchTime(start.Add(time.Minute))
+	require.NoError(t, err)
+	require.False(t, ok)
+}
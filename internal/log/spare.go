@@ -0,0 +1,136 @@
+package log
+
+import (
+	"fmt"
+	"os"
+	"path"
+
+	"go.uber.org/zap"
+)
+
+// spareName names the files prepared for the next segment, they're renamed
+// after its base offset once the log rolls. Being no offset, they're skipped
+// when the segments are loaded.
+const spareName = "spare"
+
+func (l *Log) spareFile(ext string) string {
+	return path.Join(l.Dir, spareName+ext)
+}
+
+// setupSpare removes the spare files of the last run, which may be half
+// prepared, and prepares new ones. l.mu has to be held for writing.
+func (l *Log) setupSpare() error {
+	l.spareMu.Lock()
+	l.spare = false
+	for _, ext := range []string{".store", ".index"} {
+		if err := storageOf(l.Config).Remove(l.spareFile(ext)); err != nil && !os.IsNotExist(err) {
+			l.spareMu.Unlock()
+			return err
+		}
+	}
+	l.spareMu.Unlock()
+	l.prepareSpare()
+	return nil
+}
+
+// prepareSpare creates the next segment's files in the background, see
+// Config.Segment.Preallocate.
+func (l *Log) prepareSpare() {
+	if !l.Config.Segment.Preallocate {
+		return
+	}
+	l.spareWG.Add(1)
+	go func() {
+		defer l.spareWG.Done()
+		l.spareMu.Lock()
+		defer l.spareMu.Unlock()
+		if l.spare {
+			return
+		}
+		if err := l.resetSpare(); err != nil {
+			zap.L().Named("log").Error(
+				"failed to preallocate segment",
+				zap.String("dir", l.Dir),
+				zap.Error(err),
+			)
+		}
+	}()
+}
+
+// resetSpare empties the spare files, creating them if needed, and grows the
+// index like a new segment's. l.spareMu has to be held.
+func (l *Log) resetSpare() error {
+	storage := storageOf(l.Config)
+	store, err := storage.OpenFile(l.spareFile(".store"), os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if err = store.Close(); err != nil {
+		return err
+	}
+
+	index, err := storage.OpenFile(l.spareFile(".index"), os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	capacity := uint64(indexGrowBytes)
+	if capacity > l.Config.Segment.MaxIndexBytes {
+		capacity = l.Config.Segment.MaxIndexBytes
+	}
+	if err = index.Truncate(int64(capacity)); err != nil {
+		index.Close()
+		return err
+	}
+	if err = index.Close(); err != nil {
+		return err
+	}
+	l.spare = true
+	return nil
+}
+
+// useSpare renames the spare files after the new segment's base offset. If
+// they're still being prepared the segment's files are created as usual, so
+// appends never wait for them. l.mu has to be held for writing.
+func (l *Log) useSpare(off uint64) error {
+	if !l.spareMu.TryLock() {
+		return nil
+	}
+	defer l.spareMu.Unlock()
+	if !l.spare {
+		return nil
+	}
+	l.spare = false
+	for _, ext := range []string{".store", ".index"} {
+		err := storageOf(l.Config).Rename(l.spareFile(ext), path.Join(l.Dir, fmt.Sprintf("%d%s", off, ext)))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeSegment removes the segment's files, or keeps them as spare files if
+// Config.Segment.Recycle is set and there are none yet. l.mu has to be held
+// for writing.
+func (l *Log) removeSegment(s *segment) error {
+	if !l.Config.Segment.Recycle {
+		return s.Remove()
+	}
+	l.spareMu.Lock()
+	defer l.spareMu.Unlock()
+	if l.spare {
+		return s.Remove()
+	}
+
+	if err := s.Close(); err != nil {
+		return err
+	}
+	storage := storageOf(l.Config)
+	if err := storage.Rename(s.store.Name(), l.spareFile(".store")); err != nil {
+		return err
+	}
+	if err := storage.Rename(s.index.Name(), l.spareFile(".index")); err != nil {
+		return err
+	}
+	return l.resetSpare()
+}
@@ -0,0 +1,121 @@
+package log
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	api "github.com/justagabriel/proglog/api/v1"
+	"github.com/justagabriel/proglog/internal"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSpareSegment(t *testing.T) {
+	scenarios := map[string]func(t *testing.T, config Config, dir string){
+		"rolling uses the preallocated files":  testPreallocate,
+		"removed segment's files are recycled": testRecycle,
+		"leftover spare files are replaced":    testSpareReopen,
+	}
+
+	for scenario, fn := range scenarios {
+		t.Run(scenario, func(t *testing.T) {
+			dir := internal.GetTempDir(t, "spare-test")
+			defer os.RemoveAll(dir)
+
+			config := Config{}
+			config.Segment.MaxStoreBytes = 32
+
+			fn(t, config, dir)
+		})
+	}
+}
+
+// spareExists tells whether the spare files exist, waiting for their preparation.
+func spareExists(t *testing.T, log *Log) bool {
+	t.Helper()
+	log.spareWG.Wait()
+	log.spareMu.Lock()
+	defer log.spareMu.Unlock()
+	_, storeErr := os.Stat(log.spareFile(".store"))
+	_, indexErr := os.Stat(log.spareFile(".index"))
+	require.Equal(t, log.spare, storeErr == nil)
+	require.Equal(t, log.spare, indexErr == nil)
+	return log.spare
+}
+
+func testPreallocate(t *testing.T, config Config, dir string) {
+	// arrange
+	config.Segment.Preallocate = true
+	log, err := NewLog(dir, config)
+	require.NoError(t, err)
+	defer log.Close()
+	require.True(t, spareExists(t, log))
+	fi, err := os.Stat(log.spareFile(".index"))
+	require.NoError(t, err)
+	require.Equal(t, int64(log.Config.Segment.MaxIndexBytes), fi.Size())
+
+	// act
+	appendRecords(t, log, 2)
+
+	// assert
+	require.True(t, spareExists(t, log), "the next segment's files are prepared again")
+	_, err = os.Stat(path.Join(dir, "1.store"))
+	require.NoError(t, err)
+	off, err := log.Append(&api.Record{Value: []byte("hello world")})
+	require.NoError(t, err)
+	read, err := log.Read(off)
+	require.NoError(t, err)
+	require.Equal(t, []byte("hello world"), read.Value)
+}
+
+func testRecycle(t *testing.T, config Config, dir string) {
+	// arrange
+	config.Segment.Recycle = true
+	log, err := NewLog(dir, config)
+	require.NoError(t, err)
+	defer log.Close()
+	appendRecords(t, log, 3)
+	require.False(t, spareExists(t, log))
+
+	// act
+	err = log.Truncate(0)
+
+	// assert
+	require.NoError(t, err)
+	require.True(t, spareExists(t, log))
+	_, err = os.Stat(path.Join(dir, "0.store"))
+	require.True(t, os.IsNotExist(err))
+	fi, err := os.Stat(log.spareFile(".store"))
+	require.NoError(t, err)
+	require.Zero(t, fi.Size())
+
+	base := log.activeSegment.nextOffset
+	appendRecords(t, log, len(log.segments)+1)
+	require.False(t, spareExists(t, log), "the next roll used the recycled files")
+	read, err := log.Read(base)
+	require.NoError(t, err)
+	require.Equal(t, []byte("hello world"), read.Value)
+}
+
+func testSpareReopen(t *testing.T, config Config, dir string) {
+	// arrange
+	config.Segment.Preallocate = true
+	log, err := NewLog(dir, config)
+	require.NoError(t, err)
+	appendRecords(t, log, 2)
+	require.NoError(t, log.Close())
+	// a spare store torn by a crash
+	require.NoError(t, os.WriteFile(log.spareFile(".store"), []byte("torn"), 0644))
+
+	// act
+	log, err = NewLog(dir, config)
+	require.NoError(t, err)
+	defer log.Close()
+
+	// assert
+	require.Len(t, log.segments, 2)
+	require.True(t, spareExists(t, log))
+	fi, err := os.Stat(log.spareFile(".store"))
+	require.NoError(t, err)
+	require.Zero(t, fi.Size())
+}
@@ -0,0 +1,355 @@
+package log
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Storage holds the files of logs and topics, see Config.Segment.Storage.
+// Its methods behave like their counterparts of package os.
+type Storage interface {
+	OpenFile(name string, flag int, perm os.FileMode) (File, error)
+	Remove(name string) error
+	RemoveAll(path string) error
+	Rename(oldpath, newpath string) error
+	MkdirAll(path string, perm os.FileMode) error
+	ReadDir(dir string) ([]os.DirEntry, error)
+}
+
+// File is opened by Storage. Indexes of an *os.File are
+// mapped into memory, other indexes are read once and written through.
+type File interface {
+	io.Reader
+	io.ReaderAt
+	io.Writer
+	io.WriterAt
+	Name() string
+	Stat() (os.FileInfo, error)
+	Sync() error
+	Truncate(size int64) error
+	Close() error
+}
+
+// storageOf returns the configured storage, the OS' files by default.
+func storageOf(c Config) Storage {
+	if c.Segment.Storage == nil {
+		return osStorage{}
+	}
+	return c.Segment.Storage
+}
+
+type osStorage struct{}
+
+func (osStorage) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	return os.OpenFile(name, flag, perm)
+}
+
+func (osStorage) Remove(name string) error {
+	return os.Remove(name)
+}
+
+func (osStorage) RemoveAll(path string) error {
+	return os.RemoveAll(path)
+}
+
+func (osStorage) Rename(oldpath, newpath string) error {
+	return os.Rename(oldpath, newpath)
+}
+
+func (osStorage) MkdirAll(path string, perm os.FileMode) error {
+	return os.MkdirAll(path, perm)
+}
+
+func (osStorage) ReadDir(dir string) ([]os.DirEntry, error) {
+	return os.ReadDir(dir)
+}
+
+// readFile is os.ReadFile for the storage.
+func readFile(s Storage, name string) ([]byte, error) {
+	f, err := s.OpenFile(name, os.O_RDONLY, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
+
+// writeFile is writeFileAtomic for the storage, the temporary file is
+// overwritten by the next write if a crash leaves it behind.
+func writeFile(s Storage, name string, data []byte) error {
+	tmp := name + ".tmp"
+	f, err := s.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	return s.Rename(tmp, name)
+}
+
+// MemStorage keeps files in memory, e.g. for tests. The directories of files
+// exist implicitly.
+type MemStorage struct {
+	mu    sync.Mutex
+	files map[string]*memData
+	dirs  map[string]bool
+}
+
+func NewMemStorage() *MemStorage {
+	return &MemStorage{
+		files: make(map[string]*memData),
+		dirs:  make(map[string]bool),
+	}
+}
+
+type memData struct {
+	mu       sync.Mutex
+	data     []byte
+	modified time.Time
+}
+
+func (m *MemStorage) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name = filepath.Clean(name)
+	d, ok := m.files[name]
+	if !ok {
+		if flag&os.O_CREATE == 0 {
+			return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+		}
+		d = &memData{modified: time.Now()}
+		m.files[name] = d
+	}
+	if flag&os.O_TRUNC != 0 {
+		d.mu.Lock()
+		d.data, d.modified = nil, time.Now()
+		d.mu.Unlock()
+	}
+	return &memFile{memData: d, name: name, append: flag&os.O_APPEND != 0}, nil
+}
+
+func (m *MemStorage) Remove(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name = filepath.Clean(name)
+	if _, ok := m.files[name]; ok {
+		delete(m.files, name)
+		return nil
+	}
+	for file := range m.files {
+		if isBelow(file, name) {
+			return &os.PathError{Op: "remove", Path: name, Err: syscall.ENOTEMPTY}
+		}
+	}
+	if !m.dirs[name] {
+		return &os.PathError{Op: "remove", Path: name, Err: os.ErrNotExist}
+	}
+	delete(m.dirs, name)
+	return nil
+}
+
+func (m *MemStorage) RemoveAll(path string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	path = filepath.Clean(path)
+	for name := range m.files {
+		if isBelow(name, path) {
+			delete(m.files, name)
+		}
+	}
+	for dir := range m.dirs {
+		if isBelow(dir, path) {
+			delete(m.dirs, dir)
+		}
+	}
+	return nil
+}
+
+func (m *MemStorage) Rename(oldpath, newpath string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	oldpath, newpath = filepath.Clean(oldpath), filepath.Clean(newpath)
+	d, ok := m.files[oldpath]
+	if !ok {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: os.ErrNotExist}
+	}
+	delete(m.files, oldpath)
+	m.files[newpath] = d
+	return nil
+}
+
+func (m *MemStorage) MkdirAll(path string, perm os.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for path = filepath.Clean(path); !m.dirs[path]; path = filepath.Dir(path) {
+		m.dirs[path] = true
+	}
+	return nil
+}
+
+// ReadDir lists the files and directories directly within the directory,
+// including the implicit directories of files.
+func (m *MemStorage) ReadDir(dir string) ([]os.DirEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	dir = filepath.Clean(dir)
+	infos := make(map[string]os.FileInfo)
+	child := func(name string) (string, bool) {
+		rel, err := filepath.Rel(dir, name)
+		if err != nil || rel == "." || !isBelow(name, dir) {
+			return "", false
+		}
+		return strings.Split(rel, string(filepath.Separator))[0], !strings.ContainsRune(rel, filepath.Separator)
+	}
+	for name, d := range m.files {
+		if base, isFile := child(name); base != "" {
+			if isFile {
+				d.mu.Lock()
+				infos[base] = memFileInfo{name: base, size: int64(len(d.data)), modified: d.modified}
+				d.mu.Unlock()
+			} else {
+				infos[base] = memFileInfo{name: base, dir: true}
+			}
+		}
+	}
+	for name := range m.dirs {
+		if base, _ := child(name); base != "" {
+			infos[base] = memFileInfo{name: base, dir: true}
+		}
+	}
+
+	entries := make([]os.DirEntry, 0, len(infos))
+	for _, info := range infos {
+		entries = append(entries, fs.FileInfoToDirEntry(info))
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+	return entries, nil
+}
+
+// isBelow reports whether the name is the directory or within it.
+func isBelow(name, dir string) bool {
+	rel, err := filepath.Rel(dir, name)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// memFile is an open file of MemStorage, its name is kept when renaming it.
+type memFile struct {
+	*memData
+	name   string
+	off    int64
+	append bool
+}
+
+func (f *memFile) Read(p []byte) (int, error) {
+	n, err := f.ReadAt(p, f.off)
+	f.off += int64(n)
+	return n, err
+}
+
+func (f *memFile) ReadAt(p []byte, off int64) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if off >= int64(len(f.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, f.data[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (f *memFile) Write(p []byte) (int, error) {
+	if f.append {
+		f.mu.Lock()
+		f.off = int64(len(f.data))
+		f.mu.Unlock()
+	}
+	n, err := f.WriteAt(p, f.off)
+	f.off += int64(n)
+	return n, err
+}
+
+func (f *memFile) WriteAt(p []byte, off int64) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if end := off + int64(len(p)); end > int64(len(f.data)) {
+		f.data = append(f.data, make([]byte, end-int64(len(f.data)))...)
+	}
+	f.modified = time.Now()
+	return copy(f.data[off:], p), nil
+}
+
+func (f *memFile) Name() string {
+	return f.name
+}
+
+func (f *memFile) Stat() (os.FileInfo, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return memFileInfo{name: filepath.Base(f.name), size: int64(len(f.data)), modified: f.modified}, nil
+}
+
+func (f *memFile) Sync() error {
+	return nil
+}
+
+func (f *memFile) Truncate(size int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if size < int64(len(f.data)) {
+		f.data = f.data[:size]
+	} else {
+		f.data = append(f.data, make([]byte, size-int64(len(f.data)))...)
+	}
+	f.modified = time.Now()
+	return nil
+}
+
+func (f *memFile) Close() error {
+	return nil
+}
+
+type memFileInfo struct {
+	name     string
+	size     int64
+	modified time.Time
+	dir      bool
+}
+
+func (i memFileInfo) Name() string       { return i.name }
+func (i memFileInfo) Size() int64        { return i.size }
+func (i memFileInfo) ModTime() time.Time { return i.modified }
+func (i memFileInfo) IsDir() bool        { return i.dir }
+func (i memFileInfo) Sys() any           { return nil }
+
+func (i memFileInfo) Mode() os.FileMode {
+	if i.dir {
+		return fs.ModeDir | 0755
+	}
+	return 0644
+}
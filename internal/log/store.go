@@ -2,9 +2,15 @@ package log
 
 import (
 	"bufio"
+	"bytes"
 	"encoding/binary"
-	"os"
+	"errors"
+	"hash/crc32"
+	"io"
 	"sync"
+	"time"
+
+	"go.uber.org/zap"
 )
 
 var (
@@ -13,26 +19,59 @@ var (
 
 const (
 	lenWidth = 8
+	crcWidth = 4
+	// crcFlag marks a length followed by the CRC32 checksum of the record,
+	// records written before checksums were introduced lack both.
+	crcFlag = uint64(1) << 63
 )
 
+// flagsMask covers the bits of a record's length describing the record.
+const flagsMask = crcFlag | codecMask | encryptedFlag
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// errCorruptRecord is returned for records which fail their checksum or end prematurely.
+var errCorruptRecord = errors.New("corrupt record")
+
 type store struct {
-	*os.File
+	File
 	mu   sync.Mutex
 	buf  *bufio.Writer
 	size uint64
+
+	compression Compression
+	compressor  compressor
+	keys        KeyProvider
+	faults      *Faults
+
+	policy   SyncPolicy
+	unsynced uint64
+	// timer syncs the appends made since it was started, see SyncPolicy.Interval
+	timer *time.Timer
+
+	// ahead holds the store's bytes starting at aheadPos, see Config.Segment.ReadAheadBytes
+	readAheadBytes uint64
+	ahead          []byte
+	aheadPos       uint64
 }
 
-func newStore(f *os.File) (*store, error) {
-	fi, err := os.Stat(f.Name())
+func newStore(f File, c Config) (*store, error) {
+	fi, err := f.Stat()
 	if err != nil {
 		return nil, err
 	}
 
 	size := uint64(fi.Size())
 	return &store{
-		File: f,
-		size: size,
-		buf:  bufio.NewWriter(f),
+		File:        f,
+		size:        size,
+		buf:         bufio.NewWriter(f),
+		compression: c.Segment.Compression,
+		keys:        c.Segment.Encryption,
+		faults:      c.Faults,
+		policy:      c.Segment.SyncPolicy,
+
+		readAheadBytes: c.Segment.ReadAheadBytes,
 	}, nil
 }
 
@@ -41,8 +80,30 @@ func (s *store) Append(p []byte) (u uint64, pos uint64, err error) {
 	defer s.mu.Unlock()
 
 	pos = s.size
-	err = binary.Write(s.buf, enc, uint64(len(p)))
-	if err != nil {
+	codec := CompressionNone
+	if s.compression != CompressionNone {
+		compressed, ok, err := s.compressor.compress(p)
+		if err != nil {
+			return 0, 0, err
+		}
+		if ok {
+			p, codec = compressed, s.compression
+		}
+	}
+	flags := crcFlag | uint64(codec)<<codecShift
+	if s.keys != nil {
+		if p, err = encrypt(s.keys, p); err != nil {
+			return 0, 0, err
+		}
+		flags |= encryptedFlag
+	}
+
+	// the length's top bit flags the checksum, the following ones hold the compression
+	// and whether the record is encrypted
+	var header [lenWidth + crcWidth]byte
+	enc.PutUint64(header[:lenWidth], uint64(len(p))|flags)
+	enc.PutUint32(header[lenWidth:], crc32.Checksum(p, crcTable))
+	if _, err = s.buf.Write(header[:]); err != nil {
 		return 0, 0, err
 	}
 
@@ -51,26 +112,188 @@ func (s *store) Append(p []byte) (u uint64, pos uint64, err error) {
 		return 0, 0, err
 	}
 
-	w += lenWidth
+	w += len(header)
 	s.size += uint64(w)
-	return uint64(w), pos, nil
+	return uint64(w), pos, s.appended()
+}
+
+// unsyncedRecords returns the number of records appended since the last sync.
+func (s *store) unsyncedRecords() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.unsynced
+}
+
+// appended syncs according to the store's policy.
+func (s *store) appended() error {
+	s.unsynced++
+	if s.policy.EveryWrites > 0 && s.unsynced >= s.policy.EveryWrites {
+		return s.sync()
+	}
+	if s.policy.Interval > 0 && s.timer == nil {
+		var timer *time.Timer
+		timer = time.AfterFunc(s.policy.Interval, func() {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			if s.timer != timer {
+				// stopped by Close
+				return
+			}
+			s.timer = nil
+			if err := s.sync(); err != nil {
+				zap.L().Named("log").Error(
+					"failed to sync store",
+					zap.String("file", s.Name()),
+					zap.Error(err),
+				)
+			}
+		})
+		s.timer = timer
+	}
+	return nil
 }
 
 func (s *store) Read(pos uint64) ([]byte, error) {
+	p, _, err := s.readAt(pos)
+	return p, err
+}
+
+// recordEnd returns the position following the intact record at pos.
+func (s *store) recordEnd(pos uint64) (uint64, error) {
+	_, end, err := s.readAt(pos)
+	return end, err
+}
+
+// readAt reads the record at pos along with the position following it, where
+// the next record starts.
+func (s *store) readAt(pos uint64) (p []byte, end uint64, err error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	if err := s.buf.Flush(); err != nil {
-		return nil, err
+		return nil, 0, err
 	}
-	size := make([]byte, lenWidth)
-	if _, err := s.File.ReadAt(size, int64(pos)); err != nil {
-		return nil, err
+	if pos >= s.size {
+		return nil, 0, errCorruptRecord
 	}
-	b := make([]byte, enc.Uint64(size))
-	if _, err := s.File.ReadAt(b, int64(pos+lenWidth)); err != nil {
-		return nil, err
+	if s.readAheadBytes > 0 {
+		// records the buffer fails on are read on their own, e.g. larger ones
+		if p, end, err := s.readBuffered(pos); err == nil {
+			return p, end, nil
+		}
+	}
+
+	var b bytes.Buffer
+	r := io.NewSectionReader(s.File, int64(pos), int64(s.size-pos))
+	err = readRecord(r, &b, s.keys)
+	if err == io.EOF {
+		return nil, 0, errCorruptRecord
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	read, err := r.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, 0, err
+	}
+	return b.Bytes(), pos + uint64(read), nil
+}
+
+// readBuffered reads the record at pos from the read-ahead buffer, which is
+// refilled starting at pos unless it holds the whole record. s.mu has to be
+// held and the buffered writes flushed.
+func (s *store) readBuffered(pos uint64) ([]byte, uint64, error) {
+	for refilled := false; ; refilled = true {
+		if pos >= s.aheadPos && pos < s.aheadPos+uint64(len(s.ahead)) {
+			r := bytes.NewReader(s.ahead[pos-s.aheadPos:])
+			var b bytes.Buffer
+			err := readRecord(r, &b, s.keys)
+			if err == nil {
+				return b.Bytes(), pos + uint64(r.Size()) - uint64(r.Len()), nil
+			}
+			if refilled {
+				return nil, 0, err
+			}
+		}
+
+		n := s.readAheadBytes
+		if n > s.size-pos {
+			n = s.size - pos
+		}
+		if uint64(cap(s.ahead)) < n {
+			s.ahead = make([]byte, n)
+		}
+		s.ahead = s.ahead[:n]
+		s.aheadPos = pos
+		if _, err := s.File.ReadAt(s.ahead, int64(pos)); err != nil {
+			s.ahead = s.ahead[:0]
+			return nil, 0, err
+		}
 	}
-	return b, nil
+}
+
+// truncate drops everything following pos.
+func (s *store) truncate(pos uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if pos >= s.size {
+		return nil
+	}
+	if err := s.buf.Flush(); err != nil {
+		return err
+	}
+	if err := s.File.Truncate(int64(pos)); err != nil {
+		return err
+	}
+	s.size = pos
+	s.ahead = s.ahead[:0]
+	return nil
+}
+
+// readRecord reads the next record written by store.Append into b, verifying
+// its checksum if it has one, decrypting and decompressing it. It returns
+// io.EOF if r ends before the record.
+func readRecord(r io.Reader, b *bytes.Buffer, keys KeyProvider) error {
+	var header [lenWidth + crcWidth]byte
+	if _, err := io.ReadFull(r, header[:lenWidth]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return errCorruptRecord
+		}
+		return err
+	}
+	size := enc.Uint64(header[:lenWidth])
+	checksummed := size&crcFlag != 0
+	codec := Compression((size & codecMask) >> codecShift)
+	encrypted := size&encryptedFlag != 0
+	size &^= flagsMask
+	if checksummed {
+		if _, err := io.ReadFull(r, header[lenWidth:]); err != nil {
+			return errCorruptRecord
+		}
+	}
+
+	// copying instead of allocating size bytes up front keeps a corrupt size from exhausting memory
+	start := b.Len()
+	if _, err := io.CopyN(b, r, int64(size)); err != nil {
+		if err == io.EOF {
+			return errCorruptRecord
+		}
+		return err
+	}
+	if checksummed && crc32.Checksum(b.Bytes()[start:], crcTable) != enc.Uint32(header[lenWidth:]) {
+		return errCorruptRecord
+	}
+	if encrypted {
+		p, err := decrypt(keys, b.Bytes()[start:])
+		if err != nil {
+			return err
+		}
+		b.Truncate(start)
+		b.Write(p)
+	}
+	if codec != CompressionNone {
+		return decompress(codec, b, start)
+	}
+	return nil
 }
 
 func (s *store) ReadAt(p []byte, off int64) (int, error) {
@@ -83,12 +306,42 @@ func (s *store) ReadAt(p []byte, off int64) (int, error) {
 	return s.File.ReadAt(p, off)
 }
 
+// Sync flushes the buffered records and commits them to stable storage.
+func (s *store) Sync() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sync()
+}
+
+func (s *store) sync() error {
+	if err := s.buf.Flush(); err != nil {
+		return err
+	}
+	if s.unsynced == 0 {
+		return nil
+	}
+	if err := s.faults.syncError(); err != nil {
+		return err
+	}
+	if err := s.File.Sync(); err != nil {
+		return err
+	}
+	s.unsynced = 0
+	return nil
+}
+
 func (s *store) Close() error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	err := s.buf.Flush()
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+	// records must not get lost when the process exits right after closing
+	err := s.sync()
 	if err != nil {
 		return err
 	}
+	s.ahead = nil
 	return s.File.Close()
 }
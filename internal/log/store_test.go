@@ -1,8 +1,12 @@
 package log
 
 import (
+	"bytes"
+	"fmt"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/justagabriel/proglog/internal"
 	"github.com/stretchr/testify/require"
@@ -10,7 +14,7 @@ import (
 
 var (
 	write = []byte("hello world!!! you are awesome!!!")
-	width = uint64(len(write) + lenWidth)
+	width = uint64(len(write) + lenWidth + crcWidth)
 )
 
 func TestStoreAppendRead(t *testing.T) {
@@ -18,14 +22,14 @@ func TestStoreAppendRead(t *testing.T) {
 	require.NoError(t, err)
 	defer os.Remove(f.Name())
 
-	s, err := newStore(f)
+	s, err := newStore(f, Config{})
 	require.NoError(t, err)
 
 	testAppend(t, s)
 	testRead(t, s)
 	testReadAt(t, s)
 
-	s, err = newStore(f)
+	s, err = newStore(f, Config{})
 	require.NoError(t, err)
 	testRead(t, s)
 }
@@ -53,13 +57,13 @@ func testRead(t *testing.T, s *store) {
 func testReadAt(t *testing.T, s *store) {
 	t.Helper()
 	for i, off := uint64(1), int64(0); i < 4; i++ {
-		b := make([]byte, lenWidth)
+		b := make([]byte, lenWidth+crcWidth)
 		n, err := s.ReadAt(b, off)
 		require.NoError(t, err)
-		require.Equal(t, lenWidth, n)
+		require.Equal(t, lenWidth+crcWidth, n)
 		off += int64(n)
 
-		size := enc.Uint64(b)
+		size := enc.Uint64(b) &^ crcFlag
 		b = make([]byte, size)
 		n, err = s.ReadAt(b, off)
 		require.NoError(t, err)
@@ -73,7 +77,7 @@ func TestStoreClose(t *testing.T) {
 	f := internal.GetTempFile(t, "", "store_close_test")
 	defer os.Remove(f.Name())
 
-	s, err := newStore(f)
+	s, err := newStore(f, Config{})
 	require.NoError(t, err)
 
 	_, _, err = s.Append(write)
@@ -90,6 +94,268 @@ func TestStoreClose(t *testing.T) {
 	require.True(t, afterSize > beforeSize)
 }
 
+func TestStoreSyncPolicy(t *testing.T) {
+	scenarios := map[string]struct {
+		policy SyncPolicy
+		writes int
+		synced bool
+	}{
+		"never syncs by default":         {SyncPolicy{}, 2, false},
+		"syncs every write":              {SyncPolicy{EveryWrites: 1}, 1, true},
+		"waits for the given writes":     {SyncPolicy{EveryWrites: 3}, 2, false},
+		"syncs after the given writes":   {SyncPolicy{EveryWrites: 3}, 3, true},
+		"syncs after the given interval": {SyncPolicy{Interval: 10 * time.Millisecond}, 1, true},
+	}
+
+	for scenario, sc := range scenarios {
+		t.Run(scenario, func(t *testing.T) {
+			// arrange
+			f := internal.GetTempFile(t, "", "store_sync_test")
+			defer os.Remove(f.Name())
+			c := Config{}
+			c.Segment.SyncPolicy = sc.policy
+			s, err := newStore(f, c)
+			require.NoError(t, err)
+			defer s.Close()
+
+			// act
+			for i := 0; i < sc.writes; i++ {
+				_, _, err = s.Append(write)
+				require.NoError(t, err)
+			}
+
+			// assert
+			synced := func() bool {
+				_, size, err := openFile(f.Name())
+				require.NoError(t, err)
+				return uint64(size) == width*uint64(sc.writes)
+			}
+			if sc.synced {
+				require.Eventually(t, synced, time.Second, 5*time.Millisecond)
+			} else {
+				time.Sleep(20 * time.Millisecond)
+				require.False(t, synced())
+			}
+		})
+	}
+}
+
+func TestStoreCorruptRecord(t *testing.T) {
+	scenarios := map[string]struct {
+		corrupt func(t *testing.T, f *os.File)
+		err     error
+	}{
+		"flipped bit fails the checksum": {
+			corrupt: func(t *testing.T, f *os.File) {
+				_, err := f.WriteAt([]byte{write[0] ^ 1}, lenWidth+crcWidth)
+				require.NoError(t, err)
+			},
+			err: errCorruptRecord,
+		},
+		"torn record ends prematurely": {
+			corrupt: func(t *testing.T, f *os.File) {
+				require.NoError(t, f.Truncate(int64(width-1)))
+			},
+			err: errCorruptRecord,
+		},
+		"record without checksum is read": {
+			corrupt: func(t *testing.T, f *os.File) {
+				// the format used before checksums were introduced
+				b := make([]byte, lenWidth)
+				enc.PutUint64(b, uint64(len(write)))
+				_, err := f.WriteAt(append(b, write...), 0)
+				require.NoError(t, err)
+				require.NoError(t, f.Truncate(int64(lenWidth+len(write))))
+			},
+		},
+	}
+
+	for scenario, sc := range scenarios {
+		t.Run(scenario, func(t *testing.T) {
+			// arrange
+			f := internal.GetTempFile(t, "", "store_corrupt_test")
+			defer os.Remove(f.Name())
+			s, err := newStore(f, Config{})
+			require.NoError(t, err)
+			_, _, err = s.Append(write)
+			require.NoError(t, err)
+			require.NoError(t, s.Close())
+
+			raw, err := os.OpenFile(f.Name(), os.O_RDWR, 0644)
+			require.NoError(t, err)
+			sc.corrupt(t, raw)
+			require.NoError(t, raw.Close())
+
+			f, err = os.OpenFile(f.Name(), os.O_RDWR|os.O_APPEND, 0644)
+			require.NoError(t, err)
+			s, err = newStore(f, Config{})
+			require.NoError(t, err)
+			defer s.Close()
+
+			// act
+			read, err := s.Read(0)
+
+			// assert
+			require.Equal(t, sc.err, err)
+			if sc.err == nil {
+				require.Equal(t, write, read)
+			}
+		})
+	}
+}
+
+func TestStoreCompression(t *testing.T) {
+	scenarios := map[string]struct {
+		compression Compression
+		record      []byte
+		compressed  bool
+	}{
+		"compressible record is compressed": {
+			compression: CompressionFlate,
+			record:      bytes.Repeat([]byte(`{"hello":"world"}`), 16),
+			compressed:  true,
+		},
+		"incompressible record is kept": {
+			compression: CompressionFlate,
+			record:      []byte("hi"),
+		},
+		"records aren't compressed by default": {
+			record: bytes.Repeat([]byte(`{"hello":"world"}`), 16),
+		},
+	}
+
+	for scenario, sc := range scenarios {
+		t.Run(scenario, func(t *testing.T) {
+			// arrange
+			f := internal.GetTempFile(t, "", "store_compression_test")
+			defer os.Remove(f.Name())
+			c := Config{}
+			c.Segment.Compression = sc.compression
+			s, err := newStore(f, c)
+			require.NoError(t, err)
+
+			// act
+			n, _, err := s.Append(sc.record)
+			require.NoError(t, err)
+			require.NoError(t, s.Close())
+
+			// assert
+			raw := uint64(lenWidth + crcWidth + len(sc.record))
+			require.Equal(t, sc.compressed, n < raw)
+
+			// stores read what others wrote regardless of their own compression
+			f, err = os.OpenFile(f.Name(), os.O_RDWR|os.O_APPEND, 0644)
+			require.NoError(t, err)
+			s, err = newStore(f, Config{})
+			require.NoError(t, err)
+			defer s.Close()
+			read, err := s.Read(0)
+			require.NoError(t, err)
+			require.Equal(t, sc.record, read)
+			end, err := s.recordEnd(0)
+			require.NoError(t, err)
+			require.Equal(t, n, end)
+		})
+	}
+}
+
+func TestParseCompression(t *testing.T) {
+	for _, c := range []Compression{CompressionNone, CompressionFlate} {
+		parsed, err := ParseCompression(c.String())
+		require.NoError(t, err)
+		require.Equal(t, c, parsed)
+	}
+	_, err := ParseCompression("zstd")
+	require.Error(t, err)
+}
+
+// rotatingKeys is a KeyProvider encrypting with the last of its keys.
+type rotatingKeys [][]byte
+
+func (k rotatingKeys) CurrentKey() (uint32, []byte, error) {
+	return uint32(len(k) - 1), k[len(k)-1], nil
+}
+
+func (k rotatingKeys) Key(id uint32) ([]byte, error) {
+	if int(id) >= len(k) {
+		return nil, fmt.Errorf("unknown key id %d", id)
+	}
+	return k[id], nil
+}
+
+func TestStoreEncryption(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, 32)
+	otherKey := bytes.Repeat([]byte{2}, 32)
+
+	scenarios := map[string]struct {
+		write, read KeyProvider
+		err         error
+	}{
+		"record is read with the key": {
+			write: StaticKey(key),
+			read:  StaticKey(key),
+		},
+		"record is read after the key has been rotated": {
+			write: rotatingKeys{key},
+			read:  rotatingKeys{key, otherKey},
+		},
+		"record isn't read without keys": {
+			write: StaticKey(key),
+			err:   errNoKeys,
+		},
+		"record isn't read with the wrong key": {
+			write: StaticKey(key),
+			read:  StaticKey(otherKey),
+			err:   errCorruptRecord,
+		},
+		"plain record is read with keys": {
+			read: StaticKey(key),
+		},
+	}
+
+	for scenario, sc := range scenarios {
+		t.Run(scenario, func(t *testing.T) {
+			// arrange
+			f := internal.GetTempFile(t, "", "store_encryption_test")
+			defer os.Remove(f.Name())
+			c := Config{}
+			c.Segment.Encryption = sc.write
+			s, err := newStore(f, c)
+			require.NoError(t, err)
+			_, _, err = s.Append(write)
+			require.NoError(t, err)
+			require.NoError(t, s.Close())
+
+			raw, err := os.ReadFile(f.Name())
+			require.NoError(t, err)
+			require.Equal(t, sc.write == nil, bytes.Contains(raw, write))
+
+			f, err = os.OpenFile(f.Name(), os.O_RDWR|os.O_APPEND, 0644)
+			require.NoError(t, err)
+			c.Segment.Encryption = sc.read
+			s, err = newStore(f, c)
+			require.NoError(t, err)
+			defer s.Close()
+
+			// act
+			read, err := s.Read(0)
+
+			// assert
+			require.Equal(t, sc.err, err)
+			if sc.err == nil {
+				require.Equal(t, write, read)
+			}
+		})
+	}
+}
+
+func TestNewStaticKey(t *testing.T) {
+	_, err := NewStaticKey(make([]byte, 32))
+	require.NoError(t, err)
+	_, err = NewStaticKey(make([]byte, 7))
+	require.Error(t, err)
+}
+
 func openFile(name string) (f *os.File, size int64, err error) {
 	f, err = os.OpenFile(
 		name,
@@ -105,3 +371,101 @@ func openFile(name string) (f *os.File, size int64, err error) {
 	}
 	return f, fi.Size(), nil
 }
+
+func TestStoreReadAhead(t *testing.T) {
+	// arrange
+	f := internal.GetTempFile(t, "", "store_read_ahead_test")
+	defer os.Remove(f.Name())
+	// segments append to their stores, so truncated stores are appended to at their end
+	require.NoError(t, f.Close())
+	f, err := os.OpenFile(f.Name(), os.O_RDWR|os.O_APPEND, 0644)
+	require.NoError(t, err)
+	c := Config{}
+	c.Segment.ReadAheadBytes = 2 * width
+	s, err := newStore(f, c)
+	require.NoError(t, err)
+	defer s.Close()
+	testAppend(t, s)
+	large := bytes.Repeat(write, 3)
+	_, largePos, err := s.Append(large)
+	require.NoError(t, err)
+
+	// act & assert
+	var pos uint64
+	for i := 0; i < 3; i++ {
+		read, end, err := s.readAt(pos)
+		require.NoError(t, err)
+		require.Equal(t, write, read)
+		require.Equal(t, pos+width, end)
+		pos = end
+	}
+	read, err := s.Read(largePos)
+	require.NoError(t, err)
+	require.Equal(t, large, read, "records larger than the buffer are read on their own")
+
+	require.NoError(t, s.truncate(width))
+	_, _, err = s.Append([]byte("replaced"))
+	require.NoError(t, err)
+	read, err = s.Read(width)
+	require.NoError(t, err)
+	require.Equal(t, []byte("replaced"), read, "truncating drops the buffer")
+}
+
+func BenchmarkStoreAppend(b *testing.B) {
+	f := internal.GetTempFile(b, "", "store_append_bench")
+	defer os.Remove(f.Name())
+	s, err := newStore(f, Config{})
+	require.NoError(b, err)
+	defer s.Close()
+
+	b.SetBytes(int64(len(write)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, _, err := s.Append(write); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkStoreRead(b *testing.B) {
+	const records = 1024
+	f := internal.GetTempFile(b, "", "store_read_bench")
+	defer os.Remove(f.Name())
+	s, err := newStore(f, Config{})
+	require.NoError(b, err)
+	defer s.Close()
+	for i := 0; i < records; i++ {
+		_, _, err := s.Append(write)
+		require.NoError(b, err)
+	}
+
+	b.SetBytes(int64(len(write)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := s.Read(uint64(i%records) * width); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func FuzzStoreRead(f *testing.F) {
+	f.Add(write, uint64(0))
+	f.Add(append(enc.AppendUint64(nil, crcFlag|uint64(len(write))), write...), uint64(0))
+	f.Add(enc.AppendUint64(nil, 1<<40), uint64(0))
+
+	f.Fuzz(func(t *testing.T, data []byte, pos uint64) {
+		file, err := os.Create(filepath.Join(t.TempDir(), "fuzz.store"))
+		require.NoError(t, err)
+		_, err = file.Write(data)
+		require.NoError(t, err)
+		s, err := newStore(file, Config{})
+		require.NoError(t, err)
+		defer s.Close()
+
+		// corrupt records fail to be read, they don't panic
+		_, _ = s.Read(pos)
+		_, _ = s.Read(0)
+	})
+}
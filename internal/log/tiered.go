@@ -0,0 +1,385 @@
+package log
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"time"
+
+	api "github.com/justagabriel/proglog/api/v1"
+)
+
+const (
+	// tieredFile lists the log's segments which were moved to the object store.
+	tieredFile = "tiered.json"
+	// fetchDir holds the remote segment read last.
+	fetchDir = ".tiered"
+)
+
+// ObjectStore keeps the segments offloaded by Config.Tiering, e.g. a bucket
+// of S3 or GCS. Names are slash separated.
+type ObjectStore interface {
+	Put(name string, r io.Reader) error
+	Get(name string) (io.ReadCloser, error)
+	Delete(name string) error
+}
+
+// DirObjectStore keeps objects as files below the directory, e.g. a mounted bucket.
+type DirObjectStore string
+
+func (d DirObjectStore) path(name string) string {
+	return filepath.Join(string(d), filepath.FromSlash(name))
+}
+
+// Put writes the object to a temporary file first, so it's either complete or missing.
+func (d DirObjectStore) Put(name string, r io.Reader) error {
+	p := d.path(name)
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(p), filepath.Base(p)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), p)
+}
+
+func (d DirObjectStore) Get(name string) (io.ReadCloser, error) {
+	return os.Open(d.path(name))
+}
+
+// Delete succeeds for missing objects.
+func (d DirObjectStore) Delete(name string) error {
+	err := os.Remove(d.path(name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// remoteSegment describes a segment in the object store.
+type remoteSegment struct {
+	BaseOffset    uint64    `json:"base_offset"`
+	NextOffset    uint64    `json:"next_offset"`
+	StoreBytes    uint64    `json:"store_bytes"`
+	IndexBytes    uint64    `json:"index_bytes"`
+	LastTimestamp time.Time `json:"last_timestamp"`
+	// Modified is the last modification of the store before it was offloaded
+	Modified time.Time `json:"modified"`
+}
+
+func (l *Log) objectName(baseOffset uint64, ext string) string {
+	return path.Join(l.Config.Tiering.Prefix, fmt.Sprintf("%d%s", baseOffset, ext))
+}
+
+// loadRemote reads the list of remote segments and drops the copy of the
+// segment fetched last.
+func (l *Log) loadRemote() error {
+	l.remote = nil
+	if err := storageOf(l.Config).RemoveAll(filepath.Join(l.Dir, fetchDir)); err != nil {
+		return err
+	}
+	data, err := readFile(storageOf(l.Config), filepath.Join(l.Dir, tieredFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, &l.remote)
+}
+
+func (l *Log) persistRemote() error {
+	data, err := json.Marshal(l.remote)
+	if err != nil {
+		return err
+	}
+	return writeFile(storageOf(l.Config), filepath.Join(l.Dir, tieredFile), data)
+}
+
+// remoteEnd returns the offset following the remote segments, zero if there are none.
+func (l *Log) remoteEnd() uint64 {
+	if len(l.remote) == 0 {
+		return 0
+	}
+	return l.remote[len(l.remote)-1].NextOffset
+}
+
+// offload moves the oldest inactive segments which weren't written to for
+// Config.Tiering.OffloadAfter to the object store. A segment is listed as
+// remote before its local files are removed, leftovers of a crash in between
+// are removed by setup. done guards against running on a log closed meanwhile.
+func (l *Log) offload(done <-chan struct{}, now time.Time) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	defer l.publish()
+
+	select {
+	case <-done:
+		return nil
+	default:
+	}
+
+	for l.segments[0] != l.activeSegment {
+		s := l.segments[0]
+		fi, err := s.store.Stat()
+		if err != nil {
+			return err
+		}
+		if now.Sub(fi.ModTime()) <= l.Config.Tiering.OffloadAfter {
+			return nil
+		}
+		remote := remoteSegment{
+			BaseOffset: s.baseOffset,
+			NextOffset: s.nextOffset,
+			StoreBytes: s.store.size,
+			IndexBytes: s.index.size,
+			Modified:   fi.ModTime(),
+		}
+		if !s.empty() {
+			if remote.LastTimestamp, err = s.lastTimestamp(); err != nil {
+				return err
+			}
+		}
+
+		if err = s.Close(); err != nil {
+			return err
+		}
+		err = l.upload(s)
+		if err == nil {
+			l.remote = append(l.remote, remote)
+			if err = l.persistRemote(); err != nil {
+				l.remote = l.remote[:len(l.remote)-1]
+			}
+		}
+		if err != nil {
+			// the segment stays local
+			reopened, rerr := openSegment(l.Dir, s.baseOffset, s.config, true)
+			if rerr != nil {
+				return rerr
+			}
+			l.segments[0] = reopened
+			return err
+		}
+
+		l.segments = l.segments[1:]
+		if err = storageOf(l.Config).Remove(s.index.Name()); err != nil {
+			return err
+		}
+		if err = storageOf(l.Config).Remove(s.store.Name()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// upload puts the files of the closed segment into the object store.
+func (l *Log) upload(s *segment) error {
+	for _, name := range []string{s.store.Name(), s.index.Name()} {
+		f, err := storageOf(l.Config).OpenFile(name, os.O_RDONLY, 0)
+		if err != nil {
+			return err
+		}
+		err = l.Config.Tiering.Store.Put(l.objectName(s.baseOffset, filepath.Ext(name)), f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dropRemote removes the first n remote segments, they're delisted before
+// their objects are deleted. l.mu has to be held for writing.
+func (l *Log) dropRemote(n int) error {
+	if n == 0 {
+		return nil
+	}
+	dropped := l.remote[:n:n]
+	l.remote = l.remote[n:]
+	if err := l.persistRemote(); err != nil {
+		return err
+	}
+
+	for _, remote := range dropped {
+		if l.fetched != nil && l.fetched.baseOffset == remote.BaseOffset {
+			if err := l.fetched.Remove(); err != nil {
+				return err
+			}
+			l.fetched = nil
+		}
+		for _, ext := range []string{".store", ".index"} {
+			if err := l.Config.Tiering.Store.Delete(l.objectName(remote.BaseOffset, ext)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// fetch returns the remote segment holding the offset, nil if there is none.
+// Only the segment fetched last is kept on disk. l.mu has to be held and
+// l.fetchMu for fetched.
+func (l *Log) fetch(off uint64) (*segment, error) {
+	i := sort.Search(len(l.remote), func(i int) bool {
+		return l.remote[i].NextOffset > off
+	})
+	if i == len(l.remote) || off < l.remote[i].BaseOffset {
+		return nil, nil
+	}
+	remote := l.remote[i]
+	if l.fetched != nil && l.fetched.baseOffset == remote.BaseOffset {
+		return l.fetched, nil
+	}
+
+	if l.fetched != nil {
+		if err := l.fetched.Remove(); err != nil {
+			return nil, err
+		}
+		l.fetched = nil
+	}
+	dir := filepath.Join(l.Dir, fetchDir)
+	if err := storageOf(l.Config).MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	for _, ext := range []string{".store", ".index"} {
+		err := l.download(
+			l.objectName(remote.BaseOffset, ext),
+			filepath.Join(dir, fmt.Sprintf("%d%s", remote.BaseOffset, ext)),
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	s, err := openSegment(dir, remote.BaseOffset, l.Config, true)
+	if err != nil {
+		return nil, err
+	}
+	l.fetched = s
+	return s, nil
+}
+
+func (l *Log) download(name, dst string) error {
+	r, err := l.Config.Tiering.Store.Get(name)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	f, err := storageOf(l.Config).OpenFile(dst, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// readRemote reads the record from the object store, l.mu has to be held.
+func (l *Log) readRemote(off uint64) (*api.Record, error) {
+	if record, ok := l.cache.get(off); ok {
+		return record, nil
+	}
+
+	l.fetchMu.Lock()
+	defer l.fetchMu.Unlock()
+	s, err := l.fetch(off)
+	if err != nil {
+		return nil, err
+	}
+	if s == nil {
+		return nil, api.ErrOffsetOutOfRange{Offset: off}
+	}
+	record, err := s.Read(off)
+	if err != nil {
+		return nil, err
+	}
+	l.cache.add(record)
+	return record, nil
+}
+
+// offsetByTimeRemote is OffsetByTime for the remote segments, l.mu has to be held.
+func (l *Log) offsetByTimeRemote(t time.Time) (uint64, bool, error) {
+	for _, remote := range l.remote {
+		// segments without records have no last timestamp
+		if remote.StoreBytes == 0 || remote.LastTimestamp.Before(t) {
+			continue
+		}
+
+		l.fetchMu.Lock()
+		defer l.fetchMu.Unlock()
+		s, err := l.fetch(remote.BaseOffset)
+		if err != nil {
+			return 0, false, err
+		}
+		return s.searchTime(t)
+	}
+	return 0, false, nil
+}
+
+// objectReader reads an object following its first skip bytes, it's fetched
+// on the first read.
+type objectReader struct {
+	store ObjectStore
+	name  string
+	skip  uint64
+	r     io.ReadCloser
+}
+
+func (o *objectReader) Read(p []byte) (int, error) {
+	if o.r == nil {
+		r, err := o.store.Get(o.name)
+		if err != nil {
+			return 0, err
+		}
+		o.r = r
+		if _, err = io.CopyN(io.Discard, r, int64(o.skip)); err != nil {
+			return 0, err
+		}
+	}
+	n, err := o.r.Read(p)
+	if err == io.EOF {
+		o.r.Close()
+	}
+	return n, err
+}
+
+// remoteReaders returns readers of the remote stores and their size, the
+// first skip bytes are left out. l.mu has to be held.
+func (l *Log) remoteReaders(skip uint64) ([]io.Reader, uint64) {
+	var size uint64
+	readers := make([]io.Reader, 0, len(l.remote))
+	for i, remote := range l.remote {
+		r := &objectReader{
+			store: l.Config.Tiering.Store,
+			name:  l.objectName(remote.BaseOffset, ".store"),
+		}
+		if i == 0 {
+			r.skip = skip
+		}
+		readers = append(readers, r)
+		size += remote.StoreBytes - r.skip
+	}
+	return readers, size
+}
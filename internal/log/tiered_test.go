@@ -0,0 +1,154 @@
+package log
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	api "github.com/justagabriel/proglog/api/v1"
+	"github.com/justagabriel/proglog/internal"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTiering(t *testing.T) {
+	scenarios := map[string]func(t *testing.T, log *Log, store DirObjectStore){
+		"offloaded records are read transparently": testTieringRead,
+		"remote segments are kept when reopening":  testTieringReopen,
+		"truncate deletes objects":                 testTieringTruncate,
+		"retention removes remote segments":        testTieringRetention,
+		"snapshot includes remote segments":        testTieringSnapshot,
+	}
+
+	for scenario, fn := range scenarios {
+		t.Run(scenario, func(t *testing.T) {
+			dir := internal.GetTempDir(t, "tiering-test")
+			defer os.RemoveAll(dir)
+			store := DirObjectStore(filepath.Join(dir, "bucket"))
+
+			config := Config{}
+			config.Segment.MaxStoreBytes = 48
+			config.Retention.CheckInterval = time.Hour
+			config.Tiering.Store = store
+			config.Tiering.Prefix = "node/topic"
+
+			logDir := filepath.Join(dir, "log")
+			require.NoError(t, os.MkdirAll(logDir, 0755))
+			log, err := NewLog(logDir, config)
+			require.NoError(t, err)
+			defer log.Close()
+			appendRecords(t, log, 4)
+
+			fn(t, log, store)
+		})
+	}
+}
+
+func testTieringRead(t *testing.T, log *Log, store DirObjectStore) {
+	// act
+	err := log.offload(nil, time.Now())
+
+	// assert
+	require.NoError(t, err)
+	require.Len(t, log.segments, 1)
+	require.Len(t, log.remote, 3)
+	_, err = os.Stat(filepath.Join(string(store), "node", "topic", "0.store"))
+	require.NoError(t, err)
+	_, err = os.Stat(filepath.Join(log.Dir, "0.store"))
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	lowest, err := log.LowestOffset()
+	require.NoError(t, err)
+	require.Equal(t, uint64(0), lowest)
+	highest, err := log.HighestOffset()
+	require.NoError(t, err)
+	for off := lowest; off <= highest; off++ {
+		record, err := log.Read(off)
+		require.NoError(t, err)
+		require.Equal(t, off, record.Offset)
+	}
+
+	off, err := log.OffsetByTime(time.Time{})
+	require.NoError(t, err)
+	require.Equal(t, uint64(0), off)
+}
+
+func testTieringReopen(t *testing.T, log *Log, _ DirObjectStore) {
+	// arrange
+	require.NoError(t, log.offload(nil, time.Now()))
+	highest, err := log.HighestOffset()
+	require.NoError(t, err)
+	require.NoError(t, log.Close())
+
+	// act
+	reopened, err := NewLog(log.Dir, log.Config)
+	require.NoError(t, err)
+	defer reopened.Close()
+
+	// assert
+	require.Len(t, reopened.remote, len(log.remote))
+	for i, remote := range reopened.remote {
+		require.Equal(t, log.remote[i].BaseOffset, remote.BaseOffset)
+		require.Equal(t, log.remote[i].NextOffset, remote.NextOffset)
+	}
+	record, err := reopened.Read(0)
+	require.NoError(t, err)
+	require.Equal(t, uint64(0), record.Offset)
+	off, err := reopened.Append(&api.Record{Value: []byte("hello world")})
+	require.NoError(t, err)
+	require.Equal(t, highest+1, off)
+}
+
+func testTieringTruncate(t *testing.T, log *Log, store DirObjectStore) {
+	// arrange
+	require.NoError(t, log.offload(nil, time.Now()))
+	first := log.remote[0]
+
+	// act
+	err := log.Truncate(first.NextOffset - 1)
+
+	// assert
+	require.NoError(t, err)
+	require.Len(t, log.remote, 2)
+	_, err = os.Stat(filepath.Join(string(store), "node", "topic", "0.store"))
+	require.ErrorIs(t, err, os.ErrNotExist)
+	_, err = log.Read(0)
+	require.ErrorAs(t, err, &api.ErrOffsetOutOfRange{})
+	lowest, err := log.LowestOffset()
+	require.NoError(t, err)
+	require.Equal(t, first.NextOffset, lowest)
+}
+
+func testTieringRetention(t *testing.T, log *Log, _ DirObjectStore) {
+	// arrange
+	require.NoError(t, log.offload(nil, time.Now()))
+	log.Config.Retention.MaxAge = time.Minute
+
+	// act
+	err := log.enforceRetention(nil, time.Now().Add(time.Hour))
+
+	// assert
+	require.NoError(t, err)
+	require.Empty(t, log.remote)
+	require.Len(t, log.segments, 1, "the active segment is kept")
+}
+
+func testTieringSnapshot(t *testing.T, log *Log, _ DirObjectStore) {
+	// arrange
+	var want bytes.Buffer
+	require.NoError(t, log.Snapshot(&want))
+	require.NoError(t, log.offload(nil, time.Now()))
+
+	// act
+	var got bytes.Buffer
+	err := log.Snapshot(&got)
+
+	// assert
+	require.NoError(t, err)
+	require.Equal(t, want.Bytes(), got.Bytes())
+	read, err := io.ReadAll(log.Reader())
+	require.NoError(t, err)
+	require.Equal(t, want.Bytes(), read)
+}
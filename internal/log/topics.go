@@ -0,0 +1,591 @@
+package log
+
+import (
+	"context"
+	"io"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	api "github.com/justagabriel/proglog/api/v1"
+)
+
+var topicNamePattern = regexp.MustCompile(`^[a-zA-Z0-9._-]{1,249}$`)
+
+// Topics manages a Log per topic, each one in a directory named after its topic.
+// Topics are created by their first append.
+type Topics struct {
+	mu     sync.RWMutex
+	Dir    string
+	Config Config
+	logs   map[string]*Log
+	// configs holds the config overrides of topics, see CreateTopic
+	configs map[string]*api.TopicConfig
+	// deleted holds the deleted topics until they're purged, see DeleteTopic
+	deleted map[string]*deletedTopic
+	// purgeDone stops purging deleted topics, see startPurge
+	purgeDone chan struct{}
+	// created is closed and replaced whenever a topic gets created
+	created chan struct{}
+	// transactionMu lets one transaction append at a time, see AppendTransaction
+	transactionMu sync.Mutex
+}
+
+func NewTopics(dir string, c Config) (*Topics, error) {
+	t := &Topics{
+		Dir:     dir,
+		Config:  c,
+		logs:    make(map[string]*Log),
+		configs: make(map[string]*api.TopicConfig),
+		deleted: make(map[string]*deletedTopic),
+		created: make(chan struct{}),
+	}
+	return t, t.setup()
+}
+
+// NewInMemory returns topics whose files are kept in memory, e.g. for tests
+// of services embedding the log. It replaces the config's storage and
+// satisfies the same interfaces of package server as NewTopics.
+func NewInMemory(c Config) (*Topics, error) {
+	c.Segment.Storage = NewMemStorage()
+	return NewTopics(string(filepath.Separator), c)
+}
+
+func (t *Topics) setup() error {
+	err := storageOf(t.Config).MkdirAll(t.Dir, 0755)
+	if err != nil {
+		return err
+	}
+
+	err = t.migrate()
+	if err != nil {
+		return err
+	}
+
+	entries, err := storageOf(t.Config).ReadDir(t.Dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() || !topicNamePattern.MatchString(entry.Name()) {
+			continue
+		}
+		dir := filepath.Join(t.Dir, entry.Name())
+		tc, err := loadTopicConfig(t.Config, dir)
+		if err != nil {
+			return err
+		}
+		if tc != nil {
+			t.configs[entry.Name()] = tc
+		}
+		l, err := NewLog(dir, t.logConfig(t.Config, entry.Name()))
+		if err != nil {
+			return err
+		}
+		at, deleted, err := loadDeleted(t.Config, dir)
+		if err != nil {
+			return err
+		}
+		if deleted {
+			t.deleted[entry.Name()] = &deletedTopic{log: l, at: at}
+			continue
+		}
+		t.logs[entry.Name()] = l
+	}
+	t.startPurge()
+	return t.recoverTransaction()
+}
+
+// migrate moves the segments of a log from before topics existed into the default topic.
+func (t *Topics) migrate() error {
+	storage := storageOf(t.Config)
+	entries, err := storage.ReadDir(t.Dir)
+	if err != nil {
+		return err
+	}
+
+	defaultDir := filepath.Join(t.Dir, api.DefaultTopic)
+	for _, entry := range entries {
+		ext := filepath.Ext(entry.Name())
+		if entry.IsDir() || (ext != ".store" && ext != ".index") {
+			continue
+		}
+		if err = storage.MkdirAll(defaultDir, 0755); err != nil {
+			return err
+		}
+		err = storage.Rename(filepath.Join(t.Dir, entry.Name()), filepath.Join(defaultDir, entry.Name()))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// topicName validates the topic and maps the empty topic to the default topic.
+func topicName(topic string) (string, error) {
+	if topic == "" {
+		return api.DefaultTopic, nil
+	}
+	if topic == "." || topic == ".." || !topicNamePattern.MatchString(topic) {
+		return "", api.ErrInvalidTopic{Topic: topic}
+	}
+	return topic, nil
+}
+
+// topicConfig keeps the objects of the topic's log apart from other topics'.
+func topicConfig(c Config, name string) Config {
+	c.Tiering.Prefix = path.Join(c.Tiering.Prefix, name)
+	return c
+}
+
+// log returns the topic's log, nil if it doesn't exist and create isn't set.
+// Deleted topics don't exist, they can't be created until they're purged.
+func (t *Topics) log(topic string, create bool) (*Log, error) {
+	name, err := topicName(topic)
+	if err != nil {
+		return nil, err
+	}
+
+	t.mu.RLock()
+	l, ok := t.logs[name]
+	t.mu.RUnlock()
+	if ok || !create {
+		return l, nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if l, ok = t.logs[name]; ok {
+		return l, nil
+	}
+	if _, ok = t.deleted[name]; ok {
+		return nil, api.ErrTopicDeleted{Topic: name}
+	}
+	return t.createLog(name, t.Config)
+}
+
+// createLog has to be called with t.mu held for writing.
+func (t *Topics) createLog(name string, c Config) (*Log, error) {
+	dir := filepath.Join(t.Dir, name)
+	if err := storageOf(c).MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	if tc := t.configs[name]; tc != nil {
+		if err := saveTopicConfig(c, dir, tc); err != nil {
+			return nil, err
+		}
+	}
+	l, err := NewLog(dir, t.logConfig(c, name))
+	if err != nil {
+		return nil, err
+	}
+
+	t.logs[name] = l
+	close(t.created)
+	t.created = make(chan struct{})
+	return l, nil
+}
+
+func (t *Topics) Append(topic string, record *api.Record) (uint64, error) {
+	return t.AppendContext(context.Background(), topic, record)
+}
+
+// AppendContext appends the record to the topic, see Log.AppendContext.
+func (t *Topics) AppendContext(ctx context.Context, topic string, record *api.Record) (uint64, error) {
+	if err := t.checkQuota(topic); err != nil {
+		return 0, err
+	}
+	l, err := t.log(topic, true)
+	if err != nil {
+		return 0, err
+	}
+	return l.AppendContext(ctx, record)
+}
+
+// AppendBatch appends the records to the topic, see Log.AppendBatch.
+func (t *Topics) AppendBatch(topic string, records []*api.Record) ([]uint64, error) {
+	if err := t.checkQuota(topic); err != nil {
+		return nil, err
+	}
+	l, err := t.log(topic, true)
+	if err != nil {
+		return nil, err
+	}
+	return l.AppendBatch(records)
+}
+
+// Read reads from the topic, topics which don't exist yet are treated as empty.
+func (t *Topics) Read(topic string, off uint64) (*api.Record, error) {
+	return t.ReadContext(context.Background(), topic, off)
+}
+
+// ReadContext reads from the topic, see Log.ReadContext.
+func (t *Topics) ReadContext(ctx context.Context, topic string, off uint64) (*api.Record, error) {
+	l, err := t.log(topic, false)
+	if err != nil {
+		return nil, err
+	}
+	if l == nil {
+		return nil, api.ErrOffsetOutOfRange{Offset: off}
+	}
+	return l.ReadContext(ctx, off)
+}
+
+// ReadEncoded returns the encoded record, see Log.ReadEncoded.
+func (t *Topics) ReadEncoded(topic string, off uint64) ([]byte, error) {
+	l, err := t.log(topic, false)
+	if err != nil {
+		return nil, err
+	}
+	if l == nil {
+		return nil, api.ErrOffsetOutOfRange{Offset: off}
+	}
+	return l.ReadEncoded(off)
+}
+
+// OffsetByTime searches the topic by time, see Log.OffsetByTime.
+func (t *Topics) OffsetByTime(topic string, ts time.Time) (uint64, error) {
+	l, err := t.log(topic, false)
+	if err != nil || l == nil {
+		return 0, err
+	}
+	return l.OffsetByTime(ts)
+}
+
+// ReadByKey returns the latest record with the key, see Log.ReadByKey.
+func (t *Topics) ReadByKey(topic string, key []byte) (*api.Record, error) {
+	name, err := topicName(topic)
+	if err != nil {
+		return nil, err
+	}
+	l, err := t.log(name, false)
+	if err != nil {
+		return nil, err
+	}
+	if l == nil {
+		return nil, api.ErrKeyNotFound{Key: key}
+	}
+	record, err := l.ReadByKey(key)
+	if _, ok := err.(api.ErrKeyIndexDisabled); ok {
+		err = api.ErrKeyIndexDisabled{Topic: name}
+	}
+	return record, err
+}
+
+// LowestOffset returns the lowest offset of the topic, see Log.LowestOffset.
+func (t *Topics) LowestOffset(topic string) (uint64, error) {
+	l, err := t.log(topic, false)
+	if err != nil || l == nil {
+		return 0, err
+	}
+	return l.LowestOffset()
+}
+
+// HighestOffset returns the offset of the topic's last record, see Log.HighestOffset.
+func (t *Topics) HighestOffset(topic string) (uint64, error) {
+	l, err := t.log(topic, false)
+	if err != nil || l == nil {
+		return 0, err
+	}
+	return l.HighestOffset()
+}
+
+// TenantBytes returns the bytes the records of the tenant's topics take up.
+func (t *Topics) TenantBytes(tenant string) uint64 {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	var size uint64
+	for name, l := range t.logs {
+		if owner, ok := api.TopicTenant(name); ok && owner == tenant {
+			hw, _ := l.HighWatermark()
+			size += hw.Size
+		}
+	}
+	return size
+}
+
+// checkQuota rejects appends to the topic once its tenant reached its quota.
+func (t *Topics) checkQuota(topic string) error {
+	tenant, ok := api.TopicTenant(topic)
+	if !ok {
+		return nil
+	}
+	quota, ok := t.Config.TenantQuotas[tenant]
+	if !ok {
+		return nil
+	}
+	if t.TenantBytes(tenant) >= quota {
+		return api.ErrQuotaExceeded{Tenant: tenant, Quota: quota}
+	}
+	return nil
+}
+
+// Names returns the names of all topics in alphabetical order.
+func (t *Topics) Names() []string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	names := make([]string, 0, len(t.logs))
+	for name := range t.logs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// HighWatermark returns the topic's high watermark, see Log.HighWatermark.
+// For topics which don't exist yet the channel is closed once any topic gets created.
+func (t *Topics) HighWatermark(topic string) (*api.HighWatermark, <-chan struct{}, error) {
+	name, err := topicName(topic)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	t.mu.RLock()
+	l, ok := t.logs[name]
+	created := t.created
+	t.mu.RUnlock()
+	if !ok {
+		return &api.HighWatermark{}, created, nil
+	}
+
+	hw, changed := l.HighWatermark()
+	return hw, changed, nil
+}
+
+// DurableOffset returns the offset up to which the topic's records are
+// synced, see Log.DurableOffset.
+func (t *Topics) DurableOffset(topic string) (uint64, error) {
+	name, err := topicName(topic)
+	if err != nil {
+		return 0, err
+	}
+
+	t.mu.RLock()
+	l, ok := t.logs[name]
+	t.mu.RUnlock()
+	if !ok {
+		return 0, nil
+	}
+	return l.DurableOffset(), nil
+}
+
+// Truncate truncates the topic's log, see Log.Truncate.
+func (t *Topics) Truncate(topic string, lowest uint64) error {
+	l, err := t.log(topic, false)
+	if err != nil || l == nil {
+		return err
+	}
+	return l.Truncate(lowest)
+}
+
+// DeleteBefore deletes the topic's records below the offset, see Log.DeleteBefore.
+func (t *Topics) DeleteBefore(topic string, off uint64) (uint64, error) {
+	l, err := t.log(topic, false)
+	if err != nil || l == nil {
+		return 0, err
+	}
+	return l.DeleteBefore(off)
+}
+
+// Backup writes a copy of the topic's records to w, see Log.Snapshot.
+func (t *Topics) Backup(topic string, w io.Writer) error {
+	l, err := t.log(topic, false)
+	if err != nil || l == nil {
+		return err
+	}
+	return l.Snapshot(w)
+}
+
+// SegmentStats describes the topic's segments, see Log.SegmentStats.
+func (t *Topics) SegmentStats(topic string) ([]*api.SegmentStats, error) {
+	l, err := t.log(topic, false)
+	if err != nil || l == nil {
+		return nil, err
+	}
+	return l.SegmentStats()
+}
+
+// Stats summarizes the topic's log, see Log.Stats. Unknown topics are empty.
+func (t *Topics) Stats(topic string) (*api.LogStats, error) {
+	l, err := t.log(topic, false)
+	if err != nil {
+		return nil, err
+	}
+	if l == nil {
+		return &api.LogStats{}, nil
+	}
+	return l.Stats()
+}
+
+// Verify checks and optionally repairs the topic's log, see Log.Verify.
+func (t *Topics) Verify(topic string, repair bool) (*api.VerifyReport, error) {
+	l, err := t.log(topic, false)
+	if err != nil {
+		return nil, err
+	}
+	if l == nil {
+		return &api.VerifyReport{}, nil
+	}
+	return l.Verify(repair)
+}
+
+// RunMaintenance runs the task on the topic's log right away, see
+// Log.RunMaintenance. Unknown topics fail with api.ErrTopicNotFound.
+func (t *Topics) RunMaintenance(topic string, task api.MaintenanceTask) (*api.MaintenanceProgress, error) {
+	name, err := topicName(topic)
+	if err != nil {
+		return nil, err
+	}
+	l, err := t.log(name, false)
+	if err != nil {
+		return nil, err
+	}
+	if l == nil {
+		return nil, api.ErrTopicNotFound{Topic: name}
+	}
+	progress, err := l.RunMaintenance(task)
+	if _, ok := err.(api.ErrCompactionDisabled); ok {
+		err = api.ErrCompactionDisabled{Topic: name}
+	}
+	return progress, err
+}
+
+// MaintenanceStatus reports the maintenance runs of the topic's log, see
+// Log.MaintenanceStatus. Unknown topics fail with api.ErrTopicNotFound.
+func (t *Topics) MaintenanceStatus(topic string) ([]*api.MaintenanceProgress, error) {
+	name, err := topicName(topic)
+	if err != nil {
+		return nil, err
+	}
+	l, err := t.log(name, false)
+	if err != nil {
+		return nil, err
+	}
+	if l == nil {
+		return nil, api.ErrTopicNotFound{Topic: name}
+	}
+	return l.MaintenanceStatus(), nil
+}
+
+// SetRetention changes the retention policy of all topics, including those
+// created later on.
+func (t *Topics) SetRetention(r RetentionPolicy) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.Config.Retention = r
+	for name, l := range t.logs {
+		l.SetRetention(withTopicConfig(t.Config, t.configs[name]).Retention)
+	}
+}
+
+func (t *Topics) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.purgeDone != nil {
+		close(t.purgeDone)
+		t.purgeDone = nil
+	}
+	for _, l := range t.logs {
+		if err := l.Close(); err != nil {
+			return err
+		}
+	}
+	for _, d := range t.deleted {
+		if err := d.log.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *Topics) Remove() error {
+	err := t.Close()
+	if err != nil {
+		return err
+	}
+	return storageOf(t.Config).RemoveAll(t.Dir)
+}
+
+// reset removes all topics.
+func (t *Topics) reset() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for name, l := range t.logs {
+		if err := l.Remove(); err != nil {
+			return err
+		}
+		delete(t.logs, name)
+	}
+	for name, d := range t.deleted {
+		if err := d.log.Remove(); err != nil {
+			return err
+		}
+		delete(t.deleted, name)
+	}
+	t.configs = make(map[string]*api.TopicConfig)
+	return nil
+}
+
+// restoreLog replaces the topic's log by an empty one starting at the given offset.
+func (t *Topics) restoreLog(topic string, initialOffset uint64) (*Log, error) {
+	name, err := topicName(topic)
+	if err != nil {
+		return nil, err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if l, ok := t.logs[name]; ok {
+		if err = l.Remove(); err != nil {
+			return nil, err
+		}
+		delete(t.logs, name)
+	}
+	if d, ok := t.deleted[name]; ok {
+		if err = d.log.Remove(); err != nil {
+			return nil, err
+		}
+		delete(t.deleted, name)
+	}
+
+	c := t.Config
+	c.Segment.InitialOffset = initialOffset
+	return t.createLog(name, c)
+}
+
+type topicSnapshot struct {
+	name   string
+	size   uint64
+	reader io.Reader
+}
+
+func (t *Topics) snapshot() ([]topicSnapshot, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	snapshots := make([]topicSnapshot, 0, len(t.logs)+len(t.deleted))
+	for name, l := range t.logs {
+		reader, size, err := l.snapshot()
+		if err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, topicSnapshot{name: name, size: size, reader: reader})
+	}
+	for name, d := range t.deleted {
+		reader, size, err := d.log.snapshot()
+		if err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, topicSnapshot{name: name, size: size, reader: reader})
+	}
+	return snapshots, nil
+}
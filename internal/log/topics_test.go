@@ -0,0 +1,230 @@
+package log
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	api "github.com/justagabriel/proglog/api/v1"
+	"github.com/justagabriel/proglog/internal"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTopics(t *testing.T) {
+	scenarios := map[string]func(t *testing.T, topics *Topics){
+		"topics have their own offsets":           testTopicsIsolated,
+		"empty topic is the default topic":        testTopicsDefault,
+		"invalid topic names are rejected":        testTopicsInvalidName,
+		"unknown topic reads out of range":        testTopicsUnknown,
+		"topics survive a restart":                testTopicsReopen,
+		"snapshot restores all topics":            testTopicsSnapshot,
+		"watermark of a new topic gets notified":  testTopicsHighWatermark,
+		"log without topics moves to the default": testTopicsMigrate,
+		"tenants are limited to their quota":      testTopicsTenantQuota,
+	}
+
+	for scenario, fn := range scenarios {
+		t.Run(scenario, func(t *testing.T) {
+			dir := internal.GetTempDir(t, "topics-test")
+			defer os.RemoveAll(dir)
+
+			topics, err := NewTopics(dir, Config{})
+			require.NoError(t, err)
+
+			fn(t, topics)
+		})
+	}
+}
+
+func testTopicsIsolated(t *testing.T, topics *Topics) {
+	// act
+	ordersOff, err := topics.Append("orders", &api.Record{Value: []byte("order")})
+	require.NoError(t, err)
+	paymentsOff, err := topics.Append("payments", &api.Record{Value: []byte("payment")})
+	require.NoError(t, err)
+
+	// assert
+	require.Equal(t, uint64(0), ordersOff)
+	require.Equal(t, uint64(0), paymentsOff)
+	record, err := topics.Read("orders", 0)
+	require.NoError(t, err)
+	require.Equal(t, []byte("order"), record.Value)
+	record, err = topics.Read("payments", 0)
+	require.NoError(t, err)
+	require.Equal(t, []byte("payment"), record.Value)
+	require.Equal(t, []string{"orders", "payments"}, topics.Names())
+}
+
+func testTopicsTenantQuota(t *testing.T, topics *Topics) {
+	// arrange
+	topics.Config.TenantQuotas = map[string]uint64{"team-a": 1}
+	record := func() *api.Record { return &api.Record{Value: []byte("hello world")} }
+
+	// act
+	_, err := topics.Append("team-a.orders", record())
+	require.NoError(t, err)
+	_, ordersErr := topics.Append("team-a.orders", record())
+	_, paymentsErr := topics.AppendBatch("team-a.payments", []*api.Record{record()})
+	_, otherErr := topics.Append("team-b.orders", record())
+
+	// assert
+	require.Equal(t, api.ErrQuotaExceeded{Tenant: "team-a", Quota: 1}, ordersErr)
+	require.Equal(t, api.ErrQuotaExceeded{Tenant: "team-a", Quota: 1}, paymentsErr, "the quota covers all topics of the tenant")
+	require.NoError(t, otherErr)
+	require.NotZero(t, topics.TenantBytes("team-a"))
+}
+
+func testTopicsDefault(t *testing.T, topics *Topics) {
+	// act
+	_, err := topics.Append("", &api.Record{Value: []byte("hello world")})
+	require.NoError(t, err)
+
+	// assert
+	record, err := topics.Read(api.DefaultTopic, 0)
+	require.NoError(t, err)
+	require.Equal(t, []byte("hello world"), record.Value)
+}
+
+func testTopicsInvalidName(t *testing.T, topics *Topics) {
+	for _, topic := range []string{".", "..", "../escape", "with space", "a/b"} {
+		// act
+		_, err := topics.Append(topic, &api.Record{Value: []byte("hello world")})
+
+		// assert
+		require.Equal(t, api.ErrInvalidTopic{Topic: topic}, err)
+	}
+	require.Empty(t, topics.Names())
+}
+
+func testTopicsUnknown(t *testing.T, topics *Topics) {
+	// act
+	record, err := topics.Read("orders", 0)
+
+	// assert
+	require.Nil(t, record)
+	require.Equal(t, api.ErrOffsetOutOfRange{Offset: 0}, err)
+	require.Empty(t, topics.Names())
+}
+
+func testTopicsReopen(t *testing.T, topics *Topics) {
+	// arrange
+	_, err := topics.Append("orders", &api.Record{Value: []byte("order")})
+	require.NoError(t, err)
+	require.NoError(t, topics.Close())
+
+	// act
+	reopened, err := NewTopics(topics.Dir, topics.Config)
+	require.NoError(t, err)
+
+	// assert
+	record, err := reopened.Read("orders", 0)
+	require.NoError(t, err)
+	require.Equal(t, []byte("order"), record.Value)
+}
+
+func testTopicsSnapshot(t *testing.T, topics *Topics) {
+	// arrange
+	_, err := topics.Append("orders", &api.Record{Value: []byte("order")})
+	require.NoError(t, err)
+	_, err = topics.Append("payments", &api.Record{Value: []byte("payment")})
+	require.NoError(t, err)
+	bookmarks, err := NewBookmarks(filepath.Join(topics.Dir, "bookmarks.json"))
+	require.NoError(t, err)
+	offsets, err := NewConsumerOffsets(filepath.Join(topics.Dir, "offsets.json"))
+	require.NoError(t, err)
+
+	source := &fsm{topics: topics, bookmarks: bookmarks, offsets: offsets}
+	snap, err := source.Snapshot()
+	require.NoError(t, err)
+	sink := &testSnapshotSink{}
+	require.NoError(t, snap.Persist(sink))
+
+	restored, err := NewTopics(internal.GetTempDir(t, "topics-test"), Config{})
+	require.NoError(t, err)
+	defer restored.Remove()
+	_, err = restored.Append("stale", &api.Record{Value: []byte("stale")})
+	require.NoError(t, err)
+	target := &fsm{topics: restored, bookmarks: bookmarks, offsets: offsets}
+
+	// act
+	err = target.Restore(io.NopCloser(&sink.Buffer))
+
+	// assert
+	require.NoError(t, err)
+	require.Equal(t, []string{"orders", "payments"}, restored.Names())
+	record, err := restored.Read("payments", 0)
+	require.NoError(t, err)
+	require.Equal(t, []byte("payment"), record.Value)
+}
+
+func testTopicsHighWatermark(t *testing.T, topics *Topics) {
+	// arrange
+	hw, changed, err := topics.HighWatermark("orders")
+	require.NoError(t, err)
+	require.Equal(t, uint64(0), hw.Size)
+
+	// act
+	_, err = topics.Append("orders", &api.Record{Value: []byte("order")})
+	require.NoError(t, err)
+
+	// assert
+	<-changed
+	hw, _, err = topics.HighWatermark("orders")
+	require.NoError(t, err)
+	require.NotZero(t, hw.Size)
+}
+
+func testTopicsMigrate(t *testing.T, topics *Topics) {
+	// arrange
+	dir := internal.GetTempDir(t, "topics-test")
+	defer os.RemoveAll(dir)
+	log, err := NewLog(dir, Config{})
+	require.NoError(t, err)
+	_, err = log.Append(&api.Record{Value: []byte("hello world")})
+	require.NoError(t, err)
+	require.NoError(t, log.Close())
+
+	// act
+	migrated, err := NewTopics(dir, Config{})
+
+	// assert
+	require.NoError(t, err)
+	require.Equal(t, []string{api.DefaultTopic}, migrated.Names())
+	record, err := migrated.Read("", 0)
+	require.NoError(t, err)
+	require.Equal(t, []byte("hello world"), record.Value)
+}
+
+func TestInMemoryTopics(t *testing.T) {
+	// arrange
+	config := Config{}
+	config.Segment.MaxStoreBytes = 32
+	topics, err := NewInMemory(config)
+	require.NoError(t, err)
+
+	// act
+	for i := 0; i < 3; i++ {
+		_, err = topics.Append("orders", &api.Record{Value: []byte("order")})
+		require.NoError(t, err)
+	}
+
+	// assert
+	record, err := topics.Read("orders", 2)
+	require.NoError(t, err)
+	require.Equal(t, []byte("order"), record.Value)
+	_, err = os.Stat(filepath.Join(topics.Dir, "orders"))
+	require.ErrorIs(t, err, os.ErrNotExist, "nothing is written to disk")
+
+	// act
+	require.NoError(t, topics.Close())
+	reopened, err := NewTopics(topics.Dir, topics.Config)
+
+	// assert
+	require.NoError(t, err)
+	defer reopened.Remove()
+	require.Equal(t, []string{"orders"}, reopened.Names())
+	record, err = reopened.Read("orders", 0)
+	require.NoError(t, err)
+	require.Equal(t, []byte("order"), record.Value)
+}
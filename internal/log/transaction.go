@@ -0,0 +1,275 @@
+package log
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"time"
+
+	api "github.com/justagabriel/proglog/api/v1"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+var (
+	transactionField = (&api.Record{}).ProtoReflect().Descriptor().Fields().ByName("transaction").Number()
+	markerField      = (&api.Record{}).ProtoReflect().Descriptor().Fields().ByName("marker").Number()
+)
+
+// trackTransaction keeps the state of the record's transaction, l.mu has to
+// be held for writing. Transactions are appended one at a time, so at most
+// one of them is open.
+func (l *Log) trackTransaction(record *api.Record) {
+	if record.Transaction == 0 {
+		return
+	}
+	switch record.Marker {
+	case api.TransactionMarker_TRANSACTION_MARKER_NONE:
+		l.open = record.Transaction
+	case api.TransactionMarker_TRANSACTION_MARKER_COMMIT:
+		l.open = 0
+		l.committed = record.Transaction
+	case api.TransactionMarker_TRANSACTION_MARKER_ABORT:
+		l.open = 0
+		l.aborted[record.Transaction] = true
+	}
+}
+
+// hidden tells whether reads skip the record: markers and the records of
+// aborted transactions. l.mu has to be held.
+func (l *Log) hidden(transaction uint64, marker api.TransactionMarker) bool {
+	return marker != api.TransactionMarker_TRANSACTION_MARKER_NONE || l.aborted[transaction]
+}
+
+// hiddenEncoded is hidden for an encoded record, it only decodes the
+// record's transaction fields.
+func (l *Log) hiddenEncoded(b []byte) bool {
+	transaction, marker := encodedTransaction(b)
+	return transaction != 0 && l.hidden(transaction, api.TransactionMarker(marker))
+}
+
+// encodedTransaction decodes the transaction fields of an encoded record,
+// they're zero if the record is malformed.
+func encodedTransaction(b []byte) (transaction, marker uint64) {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return 0, 0
+		}
+		b = b[n:]
+		if (num == transactionField || num == markerField) && typ == protowire.VarintType {
+			v, n := protowire.ConsumeVarint(b)
+			if n < 0 {
+				return 0, 0
+			}
+			if num == transactionField {
+				transaction = v
+			} else {
+				marker = v
+			}
+			b = b[n:]
+			continue
+		}
+		n = protowire.ConsumeFieldValue(num, typ, b)
+		if n < 0 {
+			return 0, 0
+		}
+		b = b[n:]
+	}
+	return transaction, marker
+}
+
+// appendTransaction appends the records of a transaction without syncing
+// them, l.mu has to be held for writing.
+func (l *Log) appendTransaction(records []*api.Record) ([]uint64, error) {
+	offsets := make([]uint64, 0, len(records))
+	for _, record := range records {
+		l.stamp(record)
+		off, err := l.activeSegment.Append(record)
+		if err != nil {
+			return offsets, err
+		}
+		l.track(record)
+		l.cache.add(record)
+		offsets = append(offsets, off)
+
+		if l.activeSegment.IsMaxed() {
+			if err = l.roll(off + 1); err != nil {
+				return offsets, err
+			}
+		}
+	}
+	return offsets, nil
+}
+
+// endTransaction appends the transaction's marker and syncs the log, l.mu
+// has to be held for writing.
+func (l *Log) endTransaction(transaction uint64, marker api.TransactionMarker) error {
+	_, err := l.appendTransaction([]*api.Record{{Transaction: transaction, Marker: marker}})
+	if err != nil {
+		return err
+	}
+	return l.activeSegment.store.Sync()
+}
+
+// AppendTransaction appends the records to their topics atomically: readers
+// see all of them once the transaction is committed, or none if it's
+// aborted. Each topic's records are followed by a commit marker once all
+// of them were appended, an error appends abort markers instead. Records
+// carrying a transaction id keep it, e.g. the one assigned by the leader of
+// a DistributedLog, others are assigned a new one.
+func (t *Topics) AppendTransaction(appends []*api.TopicRecords) ([]*api.TopicOffsets, error) {
+	if err := checkTransaction(appends); err != nil {
+		return nil, err
+	}
+	transaction := appends[0].Records[0].Transaction
+	if transaction == 0 {
+		transaction = newTransactionID()
+	}
+	for _, a := range appends {
+		for _, record := range a.Records {
+			record.Transaction = transaction
+		}
+		if err := checkSize(t.Config, a.Records...); err != nil {
+			return nil, err
+		}
+		if err := t.checkQuota(a.Topic); err != nil {
+			return nil, err
+		}
+	}
+
+	t.transactionMu.Lock()
+	defer t.transactionMu.Unlock()
+
+	logs := make([]*Log, len(appends))
+	for i, a := range appends {
+		l, err := t.log(a.Topic, true)
+		if err != nil {
+			return nil, err
+		}
+		logs[i] = l
+	}
+	// locked in a fixed order, readers of the topics wait for the transaction
+	locked := append([]*Log(nil), logs...)
+	sort.Slice(locked, func(i, j int) bool { return locked[i].Dir < locked[j].Dir })
+	for _, l := range locked {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+	}
+
+	res := make([]*api.TopicOffsets, len(appends))
+	var err error
+	for i, a := range appends {
+		var offsets []uint64
+		offsets, err = logs[i].appendTransaction(a.Records)
+		res[i] = &api.TopicOffsets{Topic: a.Topic, Offsets: offsets}
+		if err != nil {
+			break
+		}
+	}
+
+	marker := api.TransactionMarker_TRANSACTION_MARKER_COMMIT
+	if err != nil {
+		marker = api.TransactionMarker_TRANSACTION_MARKER_ABORT
+	}
+	for _, l := range logs {
+		if l.open != transaction {
+			continue
+		}
+		if merr := l.endTransaction(transaction, marker); merr != nil && err == nil {
+			err = merr
+		}
+		l.lastAppend = time.Now()
+		l.notify()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// checkTransaction validates the appends of a transaction.
+func checkTransaction(appends []*api.TopicRecords) error {
+	if len(appends) == 0 {
+		return fmt.Errorf("transaction appends no records")
+	}
+	topics := make(map[string]bool)
+	for _, a := range appends {
+		name, err := topicName(a.Topic)
+		if err != nil {
+			return err
+		}
+		if topics[name] {
+			return fmt.Errorf("transaction appends to topic %q twice", name)
+		}
+		topics[name] = true
+		if len(a.Records) == 0 {
+			return fmt.Errorf("transaction appends no records to topic %q", name)
+		}
+		for _, record := range a.Records {
+			if record.ProducerId != "" {
+				return fmt.Errorf("transactions can't append records of idempotent producers")
+			}
+			if record.Transaction != appends[0].Records[0].Transaction {
+				return fmt.Errorf("transaction appends records of several transactions")
+			}
+		}
+	}
+	return nil
+}
+
+// newTransactionID returns a random transaction id, never zero.
+func newTransactionID() uint64 {
+	var b [8]byte
+	for {
+		if _, err := rand.Read(b[:]); err != nil {
+			panic(err)
+		}
+		if id := binary.BigEndian.Uint64(b[:]); id != 0 {
+			return id
+		}
+	}
+}
+
+// recoverTransaction ends the transaction left open by a crash: it's
+// committed if any topic holds its commit marker, all of its records were
+// appended then, and aborted otherwise.
+func (t *Topics) recoverTransaction() error {
+	var open []*Log
+	var committed bool
+	var transaction uint64
+	for _, l := range t.logs {
+		if l.open != 0 {
+			open = append(open, l)
+			transaction = l.open
+		}
+	}
+	if len(open) == 0 {
+		return nil
+	}
+	for _, l := range t.logs {
+		if l.committed == transaction {
+			committed = true
+		}
+	}
+
+	marker := api.TransactionMarker_TRANSACTION_MARKER_ABORT
+	if committed {
+		marker = api.TransactionMarker_TRANSACTION_MARKER_COMMIT
+	}
+	for _, l := range open {
+		l.mu.Lock()
+		err := l.endTransaction(transaction, marker)
+		l.mu.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+	zap.L().Named("log").Info(
+		"recovered open transaction",
+		zap.Uint64("transaction", transaction),
+		zap.Stringer("marker", marker),
+	)
+	return nil
+}
@@ -0,0 +1,150 @@
+package log
+
+import (
+	"os"
+	"testing"
+
+	api "github.com/justagabriel/proglog/api/v1"
+	"github.com/justagabriel/proglog/internal"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransaction(t *testing.T) {
+	scenarios := map[string]func(t *testing.T, topics *Topics){
+		"committed records are visible in all topics": testTransactionCommit,
+		"invalid transactions append nothing":         testTransactionInvalid,
+		"crash after a commit marker commits":         testTransactionRecoverCommit,
+		"crash before any commit marker aborts":       testTransactionRecoverAbort,
+	}
+
+	for scenario, fn := range scenarios {
+		t.Run(scenario, func(t *testing.T) {
+			dir := internal.GetTempDir(t, "transaction-test")
+			defer os.RemoveAll(dir)
+
+			topics, err := NewTopics(dir, Config{})
+			require.NoError(t, err)
+
+			fn(t, topics)
+		})
+	}
+}
+
+func testTransactionCommit(t *testing.T, topics *Topics) {
+	// act
+	res, err := topics.AppendTransaction([]*api.TopicRecords{
+		{Topic: "orders", Records: []*api.Record{{Value: []byte("order 1")}, {Value: []byte("order 2")}}},
+		{Topic: "payments", Records: []*api.Record{{Value: []byte("payment")}}},
+	})
+	require.NoError(t, err)
+	next, err := topics.Append("orders", &api.Record{Value: []byte("order 3")})
+	require.NoError(t, err)
+
+	// assert
+	require.Equal(t, []*api.TopicOffsets{
+		{Topic: "orders", Offsets: []uint64{0, 1}},
+		{Topic: "payments", Offsets: []uint64{0}},
+	}, res)
+	require.Equal(t, uint64(3), next, "the commit marker takes an offset")
+	requireValues(t, topics, "orders", "order 1", "order 2", "order 3")
+	requireValues(t, topics, "payments", "payment")
+}
+
+func testTransactionInvalid(t *testing.T, topics *Topics) {
+	// arrange
+	record := func() *api.Record { return &api.Record{Value: []byte("order")} }
+
+	// act
+	_, emptyErr := topics.AppendTransaction(nil)
+	_, twiceErr := topics.AppendTransaction([]*api.TopicRecords{
+		{Topic: "orders", Records: []*api.Record{record()}},
+		{Topic: "orders", Records: []*api.Record{record()}},
+	})
+	_, producerErr := topics.AppendTransaction([]*api.TopicRecords{
+		{Topic: "orders", Records: []*api.Record{{Value: []byte("order"), ProducerId: "p"}}},
+	})
+	_, nameErr := topics.AppendTransaction([]*api.TopicRecords{
+		{Topic: "orders", Records: []*api.Record{record()}},
+		{Topic: "../payments", Records: []*api.Record{record()}},
+	})
+
+	// assert
+	require.Error(t, emptyErr)
+	require.Error(t, twiceErr)
+	require.Error(t, producerErr)
+	require.Error(t, nameErr)
+	require.Empty(t, topics.Names())
+}
+
+func testTransactionRecoverCommit(t *testing.T, topics *Topics) {
+	// arrange
+	crashTransaction(t, topics, 7, "orders")
+
+	// act
+	require.NoError(t, topics.Close())
+	reopened, err := NewTopics(topics.Dir, topics.Config)
+	require.NoError(t, err)
+
+	// assert
+	requireValues(t, reopened, "orders", "orders 7")
+	requireValues(t, reopened, "payments", "payments 7")
+}
+
+func testTransactionRecoverAbort(t *testing.T, topics *Topics) {
+	// arrange
+	crashTransaction(t, topics, 7)
+
+	// act
+	require.NoError(t, topics.Close())
+	reopened, err := NewTopics(topics.Dir, topics.Config)
+	require.NoError(t, err)
+	_, err = reopened.Append("orders", &api.Record{Value: []byte("order")})
+	require.NoError(t, err)
+
+	// assert
+	requireValues(t, reopened, "orders", "order")
+	requireValues(t, reopened, "payments")
+}
+
+// crashTransaction appends the records of a transaction to orders and
+// payments, like a crash would leave them, with commit markers in the
+// committed topics only.
+func crashTransaction(t *testing.T, topics *Topics, transaction uint64, committed ...string) {
+	t.Helper()
+	for _, topic := range []string{"orders", "payments"} {
+		l, err := topics.log(topic, true)
+		require.NoError(t, err)
+		l.mu.Lock()
+		_, err = l.appendTransaction([]*api.Record{{Value: []byte(topic + " 7"), Transaction: transaction}})
+		l.mu.Unlock()
+		require.NoError(t, err)
+	}
+	for _, topic := range committed {
+		l, err := topics.log(topic, false)
+		require.NoError(t, err)
+		l.mu.Lock()
+		err = l.endTransaction(transaction, api.TransactionMarker_TRANSACTION_MARKER_COMMIT)
+		l.mu.Unlock()
+		require.NoError(t, err)
+	}
+}
+
+// requireValues requires the topic's visible records to hold the values.
+func requireValues(t *testing.T, topics *Topics, topic string, values ...string) {
+	t.Helper()
+	highest, err := topics.HighestOffset(topic)
+	require.NoError(t, err)
+	var got []string
+	for off := uint64(0); off <= highest; off++ {
+		record, err := topics.Read(topic, off)
+		_, encodedErr := topics.ReadEncoded(topic, off)
+		if _, ok := err.(api.ErrOffsetOutOfRange); ok {
+			require.IsType(t, api.ErrOffsetOutOfRange{}, encodedErr)
+			continue
+		}
+		require.NoError(t, err)
+		require.NoError(t, encodedErr)
+		got = append(got, string(record.Value))
+	}
+	require.Equal(t, values, got)
+}
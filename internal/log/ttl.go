@@ -0,0 +1,53 @@
+package log
+
+import (
+	"time"
+
+	api "github.com/justagabriel/proglog/api/v1"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+)
+
+var ttlField = (&api.Record{}).ProtoReflect().Descriptor().Fields().ByName("ttl").Number()
+
+// expired tells whether the record outlived its TTL, records without one
+// never expire. Expired records are kept until compaction removes them.
+func expired(record *api.Record, now time.Time) bool {
+	if record.Ttl == nil || record.Timestamp == nil {
+		return false
+	}
+	return !now.Before(record.Timestamp.AsTime().Add(record.Ttl.AsDuration()))
+}
+
+// expiredEncoded is expired for an encoded record, it's only decoded if it
+// has a TTL.
+func expiredEncoded(b []byte, now time.Time) bool {
+	if !hasField(b, ttlField) {
+		return false
+	}
+	record := &api.Record{}
+	if err := proto.Unmarshal(b, record); err != nil {
+		return false
+	}
+	return expired(record, now)
+}
+
+// hasField tells whether the encoded message has the field.
+func hasField(b []byte, field protowire.Number) bool {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return false
+		}
+		if num == field {
+			return true
+		}
+		b = b[n:]
+		n = protowire.ConsumeFieldValue(num, typ, b)
+		if n < 0 {
+			return false
+		}
+		b = b[n:]
+	}
+	return false
+}
@@ -0,0 +1,108 @@
+package log
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	api "github.com/justagabriel/proglog/api/v1"
+	"github.com/justagabriel/proglog/internal"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestTTL(t *testing.T) {
+	scenarios := map[string]func(t *testing.T, log *Log){
+		"reads skip expired records":         testTTLReads,
+		"compaction removes expired records": testTTLCompact,
+	}
+
+	config := Config{}
+	config.Segment.MaxStoreBytes = 96
+	// the records keep their timestamps, see appendTTL
+	config.replicated = true
+
+	for scenario, fn := range scenarios {
+		t.Run(scenario, func(t *testing.T) {
+			dir := internal.GetTempDir(t, "ttl-test")
+			defer os.RemoveAll(dir)
+
+			log, err := NewLog(dir, config)
+			require.NoError(t, err)
+			defer log.Close()
+
+			fn(t, log)
+		})
+	}
+}
+
+// appendTTL appends a record appended age ago which lives for ttl.
+func appendTTL(t *testing.T, log *Log, key, value string, age, ttl time.Duration) uint64 {
+	t.Helper()
+	off, err := log.Append(&api.Record{
+		Key:       []byte(key),
+		Value:     []byte(value),
+		Timestamp: timestamppb.New(time.Now().Add(-age)),
+		Ttl:       durationpb.New(ttl),
+	})
+	require.NoError(t, err)
+	return off
+}
+
+func testTTLReads(t *testing.T, log *Log) {
+	// arrange
+	appendTTL(t, log, "a", "expired", time.Hour, time.Minute)
+	appendTTL(t, log, "b", "alive", time.Hour, 2*time.Hour)
+	for len(log.segments) < 3 {
+		appendKeyed(t, log, "c", "filler")
+	}
+	// the active segment's records are read holding the lock, its record
+	// can't be older than the fillers
+	active := appendTTL(t, log, "d", "expired", 0, time.Nanosecond)
+	highest, err := log.HighestOffset()
+	require.NoError(t, err)
+
+	// act
+	_, sealedErr := log.Read(0)
+	_, encodedErr := log.ReadEncoded(0)
+	_, activeErr := log.Read(active)
+	_, activeEncodedErr := log.ReadEncoded(active)
+	alive, err := log.Read(1)
+
+	// assert
+	want := api.ErrOffsetOutOfRange{Offset: 0, HighestOffset: highest}
+	require.Equal(t, want, sealedErr)
+	require.Equal(t, want, encodedErr)
+	want.Offset = active
+	require.Equal(t, want, activeErr)
+	require.Equal(t, want, activeEncodedErr)
+	require.NoError(t, err)
+	require.Equal(t, "alive", string(alive.Value))
+}
+
+func testTTLCompact(t *testing.T, log *Log) {
+	// arrange
+	appendTTL(t, log, "", "expired", time.Hour, time.Minute)
+	appendTTL(t, log, "a", "a1", 0, time.Hour)
+	appendTTL(t, log, "a", "a2", 0, time.Hour)
+	for len(log.segments) < 3 {
+		appendKeyed(t, log, "c", "filler")
+	}
+
+	// act
+	err := log.compact(nil)
+
+	// assert
+	require.NoError(t, err)
+	var stored []string
+	for _, s := range log.segments {
+		require.NoError(t, s.scan(func(record *api.Record) error {
+			stored = append(stored, string(record.Value))
+			return nil
+		}))
+	}
+	require.NotContains(t, stored, "expired", "expired records are removed")
+	require.NotContains(t, stored, "a1")
+	require.Contains(t, stored, "a2")
+}
@@ -0,0 +1,124 @@
+package log
+
+import (
+	"fmt"
+
+	api "github.com/justagabriel/proglog/api/v1"
+)
+
+// Verify checks the local segments: every record has to pass its checksum
+// and follow the previous one's offset, every index entry has to point to
+// the record with its offset. Segments moved to the object store aren't
+// checked.
+//
+// With repair each inconsistent segment is rewritten with its records up to
+// the first corrupt one and a rebuilt index, the records following it are
+// lost. Recovering on startup only drops what an interrupted append left
+// behind, this repairs corruption in the middle of a segment as well.
+func (l *Log) Verify(repair bool) (*api.VerifyReport, error) {
+	if repair {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+	} else {
+		l.mu.RLock()
+		defer l.mu.RUnlock()
+	}
+
+	report := &api.VerifyReport{Segments: uint64(len(l.segments))}
+	for i, s := range l.segments {
+		records, intact, issues, err := s.verify()
+		if err != nil {
+			return nil, err
+		}
+		report.Records += records
+		report.Inconsistencies = append(report.Inconsistencies, issues...)
+		if !repair || len(issues) == 0 {
+			continue
+		}
+
+		report.Repaired = true
+		report.DroppedBytes += s.store.size - intact
+		repaired, err := l.repairSegment(s, intact)
+		if err != nil {
+			return nil, err
+		}
+		if s == l.activeSegment {
+			l.activeSegment = repaired
+		}
+		l.segments[i] = repaired
+	}
+	if report.Repaired {
+		l.publish()
+		l.cache.reset()
+		l.notify()
+	}
+	return report, nil
+}
+
+// repairSegment rewrites the segment with the records preceding intact.
+func (l *Log) repairSegment(s *segment, intact uint64) (*segment, error) {
+	var records []*api.Record
+	for pos := uint64(0); pos < intact; {
+		record, end, err := s.decode(pos)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+		pos = end
+	}
+	return l.rewriteSegment(s, records)
+}
+
+// verify scans the store and checks the index entries against its records.
+// It returns the number of intact records and the position following the
+// last of them.
+func (s *segment) verify() (records, intact uint64, issues []*api.Inconsistency, err error) {
+	issue := func(index bool, pos uint64, format string, args ...interface{}) {
+		issues = append(issues, &api.Inconsistency{
+			Segment:  s.baseOffset,
+			Index:    index,
+			Position: pos,
+			Problem:  fmt.Sprintf(format, args...),
+		})
+	}
+
+	// offsets of the intact records by their position
+	offsets := make(map[uint64]uint64)
+	next := s.baseOffset
+	for intact < s.store.size {
+		record, end, err := s.decode(intact)
+		if err == errCorruptRecord {
+			issue(false, intact, "corrupt record, %d bytes following it are unreadable", s.store.size-intact)
+			break
+		}
+		if err != nil {
+			return 0, 0, nil, err
+		}
+		if record.Offset < next {
+			issue(false, intact, "record has offset %d, want %d or above", record.Offset, next)
+			break
+		}
+		offsets[intact] = record.Offset
+		records++
+		next = record.Offset + 1
+		intact = end
+	}
+
+	if records > 0 && s.index.entries() == 0 {
+		issue(true, 0, "the segment's records aren't indexed")
+	}
+	for n := 0; n < s.index.entries(); n++ {
+		rel, pos, err := s.index.Read(int64(n))
+		if err != nil {
+			return 0, 0, nil, err
+		}
+		off, ok := offsets[pos]
+		switch {
+		case !ok:
+			issue(true, uint64(n)*entWidth, "entry points to position %d, which doesn't hold an intact record", pos)
+		case off != s.baseOffset+uint64(rel):
+			issue(true, uint64(n)*entWidth, "entry names offset %d, the record at position %d has offset %d", s.baseOffset+uint64(rel), pos, off)
+		}
+	}
+	return records, intact, issues, nil
+}
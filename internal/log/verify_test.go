@@ -0,0 +1,114 @@
+package log
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	api "github.com/justagabriel/proglog/api/v1"
+	"github.com/justagabriel/proglog/internal"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerify(t *testing.T) {
+	scenarios := map[string]func(t *testing.T, log *Log){
+		"intact log has no inconsistencies":      testVerifyIntact,
+		"corrupt record is found and repaired":   testVerifyCorruptRecord,
+		"wrong index entry is found and rebuilt": testVerifyIndex,
+	}
+
+	for scenario, fn := range scenarios {
+		t.Run(scenario, func(t *testing.T) {
+			dir := internal.GetTempDir(t, "verify-test")
+			defer os.RemoveAll(dir)
+
+			log, err := NewLog(dir, Config{})
+			require.NoError(t, err)
+			defer log.Close()
+			for i := 0; i < 5; i++ {
+				_, err := log.Append(&api.Record{Value: []byte(fmt.Sprintf("record %d", i))})
+				require.NoError(t, err)
+			}
+
+			fn(t, log)
+		})
+	}
+}
+
+func testVerifyIntact(t *testing.T, log *Log) {
+	// act
+	report, err := log.Verify(true)
+
+	// assert
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), report.Segments)
+	require.Equal(t, uint64(5), report.Records)
+	require.Empty(t, report.Inconsistencies)
+	require.False(t, report.Repaired)
+}
+
+func testVerifyCorruptRecord(t *testing.T, log *Log) {
+	// arrange
+	s := log.activeSegment
+	require.NoError(t, s.store.Sync())
+	pos, err := s.position(3)
+	require.NoError(t, err)
+	f, err := storageOf(log.Config).OpenFile(s.store.Name(), os.O_RDWR, 0644)
+	require.NoError(t, err)
+	defer f.Close()
+	_, err = f.WriteAt([]byte{0xff}, int64(pos-1))
+	require.NoError(t, err)
+
+	// act
+	checked, err := log.Verify(false)
+	require.NoError(t, err)
+	repaired, err := log.Verify(true)
+	require.NoError(t, err)
+	verified, err := log.Verify(false)
+	require.NoError(t, err)
+
+	// assert
+	require.Equal(t, uint64(2), checked.Records)
+	require.Len(t, checked.Inconsistencies, 4, "the record and the entries from it on")
+	require.False(t, checked.Inconsistencies[0].Index)
+	require.Equal(t, checked.Inconsistencies, repaired.Inconsistencies)
+	require.True(t, repaired.Repaired)
+	require.True(t, repaired.DroppedBytes > 0)
+	require.Empty(t, verified.Inconsistencies)
+	read, err := log.Read(1)
+	require.NoError(t, err)
+	require.Equal(t, []byte("record 1"), read.Value)
+	_, err = log.Read(2)
+	require.Error(t, err)
+	off, err := log.Append(&api.Record{Value: []byte("appended")})
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), off)
+}
+
+func testVerifyIndex(t *testing.T, log *Log) {
+	// arrange
+	idx := log.activeSegment.index
+	enc.PutUint32(idx.mmap[entWidth:], 3)
+
+	// act
+	checked, err := log.Verify(false)
+	require.NoError(t, err)
+	repaired, err := log.Verify(true)
+	require.NoError(t, err)
+
+	// assert
+	require.Equal(t, uint64(5), checked.Records)
+	require.Len(t, checked.Inconsistencies, 1)
+	require.True(t, checked.Inconsistencies[0].Index)
+	require.Equal(t, uint64(entWidth), checked.Inconsistencies[0].Position)
+	require.True(t, repaired.Repaired)
+	require.Zero(t, repaired.DroppedBytes)
+	verified, err := log.Verify(false)
+	require.NoError(t, err)
+	require.Empty(t, verified.Inconsistencies)
+	for i := uint64(0); i < 5; i++ {
+		read, err := log.Read(i)
+		require.NoError(t, err)
+		require.Equal(t, []byte(fmt.Sprintf("record %d", i)), read.Value)
+	}
+}
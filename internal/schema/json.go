@@ -0,0 +1,130 @@
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// JSON requires values to be JSON documents matching a JSON schema. Only
+// the keywords type, properties, required, additionalProperties, items and
+// enum are supported, others are ignored.
+type JSON struct {
+	name   string
+	schema *jsonSchema
+}
+
+type jsonSchema struct {
+	Type                 string                 `json:"type"`
+	Properties           map[string]*jsonSchema `json:"properties"`
+	Required             []string               `json:"required"`
+	AdditionalProperties *bool                  `json:"additionalProperties"`
+	Items                *jsonSchema            `json:"items"`
+	Enum                 []interface{}          `json:"enum"`
+}
+
+// ParseJSON parses the JSON schema, the name identifies it in violations.
+func ParseJSON(name string, schema []byte) (JSON, error) {
+	s := &jsonSchema{}
+	if err := decodeJSON(schema, s); err != nil {
+		return JSON{}, fmt.Errorf("invalid JSON schema: %w", err)
+	}
+	return JSON{name: name, schema: s}, nil
+}
+
+func (j JSON) Name() string {
+	return j.name
+}
+
+func (j JSON) Validate(value []byte) error {
+	var v interface{}
+	if err := decodeJSON(value, &v); err != nil {
+		return err
+	}
+	return j.schema.validate(v, "$")
+}
+
+// decodeJSON keeps numbers as json.Number, so integers can be told apart.
+func decodeJSON(b []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+	if dec.More() {
+		return errors.New("trailing data after the document")
+	}
+	return nil
+}
+
+func (s *jsonSchema) validate(v interface{}, path string) error {
+	if s.Type != "" && jsonType(v) != s.Type && !(s.Type == "number" && jsonType(v) == "integer") {
+		return fmt.Errorf("%s: want %s, got %s", path, s.Type, jsonType(v))
+	}
+	if len(s.Enum) > 0 && !s.inEnum(v) {
+		return fmt.Errorf("%s: not one of the enum's values", path)
+	}
+
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for _, name := range s.Required {
+			if _, ok := v[name]; !ok {
+				return fmt.Errorf("%s: missing property %q", path, name)
+			}
+		}
+		for name, value := range v {
+			prop, ok := s.Properties[name]
+			if !ok {
+				if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+					return fmt.Errorf("%s: unexpected property %q", path, name)
+				}
+				continue
+			}
+			if err := prop.validate(value, path+"."+name); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		if s.Items == nil {
+			return nil
+		}
+		for i, item := range v {
+			if err := s.Items.validate(item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *jsonSchema) inEnum(v interface{}) bool {
+	for _, e := range s.Enum {
+		if reflect.DeepEqual(e, v) {
+			return true
+		}
+	}
+	return false
+}
+
+func jsonType(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case json.Number:
+		if strings.ContainsAny(v.String(), ".eE") {
+			return "number"
+		}
+		return "integer"
+	case []interface{}:
+		return "array"
+	default:
+		return "object"
+	}
+}
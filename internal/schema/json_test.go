@@ -0,0 +1,54 @@
+package schema
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestJSON(t *testing.T) {
+	schema, err := ParseJSON("order.json", []byte(`{
+		"type": "object",
+		"required": ["id", "items"],
+		"additionalProperties": false,
+		"properties": {
+			"id": {"type": "integer"},
+			"status": {"enum": ["open", "paid"]},
+			"total": {"type": "number"},
+			"items": {"type": "array", "items": {"type": "string"}}
+		}
+	}`))
+	require.NoError(t, err)
+
+	for value, want := range map[string]string{
+		`{"id": 1, "items": ["book"], "status": "paid", "total": 9.5}`: "",
+		`{"id": 1, "items": [], "total": 10}`:                          "",
+		`[]`:                                                           "$: want object, got array",
+		`{"items": []}`:                                                `$: missing property "id"`,
+		`{"id": 1.5, "items": []}`:                                     "$.id: want integer, got number",
+		`{"id": 1, "items": [1]}`:                                      "$.items[0]: want string, got integer",
+		`{"id": 1, "items": [], "status": "lost"}`:                     "$.status: not one of the enum's values",
+		`{"id": 1, "items": [], "note": "fragile"}`:                    `$: unexpected property "note"`,
+		`{"id": 1, "items": []} {}`:                                    "trailing data after the document",
+	} {
+		t.Run(value, func(t *testing.T) {
+			// act
+			err := schema.Validate([]byte(value))
+
+			// assert
+			if want == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.EqualError(t, err, want)
+		})
+	}
+}
+
+func TestParseJSONInvalid(t *testing.T) {
+	// act
+	_, err := ParseJSON("broken.json", []byte(`{"type": `))
+
+	// assert
+	require.Error(t, err)
+}
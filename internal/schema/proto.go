@@ -0,0 +1,58 @@
+package schema
+
+import (
+	"errors"
+	"fmt"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// Proto requires values to be encoded protobuf messages of a type. Fields
+// unknown to the type are rejected, e.g. those of a newer version of it.
+type Proto struct {
+	desc protoreflect.MessageDescriptor
+}
+
+func NewProto(desc protoreflect.MessageDescriptor) Proto {
+	return Proto{desc: desc}
+}
+
+// ParseProto returns the schema of the message of the encoded FileDescriptorSet.
+func ParseProto(descriptorSet []byte, message string) (Proto, error) {
+	set := &descriptorpb.FileDescriptorSet{}
+	if err := proto.Unmarshal(descriptorSet, set); err != nil {
+		return Proto{}, fmt.Errorf("invalid descriptor set: %w", err)
+	}
+	files, err := protodesc.NewFiles(set)
+	if err != nil {
+		return Proto{}, err
+	}
+	desc, err := files.FindDescriptorByName(protoreflect.FullName(message))
+	if err != nil {
+		return Proto{}, fmt.Errorf("message %q: %w", message, err)
+	}
+	msg, ok := desc.(protoreflect.MessageDescriptor)
+	if !ok {
+		return Proto{}, fmt.Errorf("%q isn't a message", message)
+	}
+	return NewProto(msg), nil
+}
+
+func (p Proto) Name() string {
+	return string(p.desc.FullName())
+}
+
+func (p Proto) Validate(value []byte) error {
+	msg := dynamicpb.NewMessage(p.desc)
+	if err := proto.Unmarshal(value, msg); err != nil {
+		return err
+	}
+	if len(msg.GetUnknown()) > 0 {
+		return errors.New("unknown fields")
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+// Package schema validates record values against schemas registered per topic.
+package schema
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	api "github.com/justagabriel/proglog/api/v1"
+)
+
+// Schema validates record values.
+type Schema interface {
+	// Name identifies the schema in violations.
+	Name() string
+	// Validate tells what's wrong with the value, nil if it matches.
+	Validate(value []byte) error
+}
+
+// Registry holds the schemas of topics, values of topics without one aren't validated.
+type Registry struct {
+	mu      sync.RWMutex
+	schemas map[string]Schema
+}
+
+func NewRegistry() *Registry {
+	return &Registry{schemas: make(map[string]Schema)}
+}
+
+// Register sets the topic's schema, replacing the one it had.
+func (r *Registry) Register(topic string, schema Schema) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.schemas[topicKey(topic)] = schema
+}
+
+// Validate returns an api.ErrSchemaViolation if the record's value doesn't
+// match the topic's schema.
+func (r *Registry) Validate(topic string, record *api.Record) error {
+	r.mu.RLock()
+	schema, ok := r.schemas[topicKey(topic)]
+	r.mu.RUnlock()
+	if !ok {
+		return nil
+	}
+	if err := schema.Validate(record.Value); err != nil {
+		return api.ErrSchemaViolation{Topic: topicKey(topic), Schema: schema.Name(), Violation: err.Error()}
+	}
+	return nil
+}
+
+// Load registers the schema of a spec like "orders=order.json" for a JSON
+// schema or "orders=shop.binpb#shop.v1.Order" for a protobuf message of a
+// descriptor set, as written by protoc --descriptor_set_out --include_imports.
+func (r *Registry) Load(spec string) error {
+	topic, file, ok := strings.Cut(spec, "=")
+	if !ok || topic == "" || file == "" {
+		return fmt.Errorf("invalid schema %q, want topic=file", spec)
+	}
+
+	var schema Schema
+	if path, message, ok := strings.Cut(file, "#"); ok {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		schema, err = ParseProto(b, message)
+		if err != nil {
+			return fmt.Errorf("schema of topic %q: %w", topic, err)
+		}
+	} else {
+		b, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		schema, err = ParseJSON(filepath.Base(file), b)
+		if err != nil {
+			return fmt.Errorf("schema of topic %q: %w", topic, err)
+		}
+	}
+	r.Register(topic, schema)
+	return nil
+}
+
+func topicKey(topic string) string {
+	if topic == "" {
+		return api.DefaultTopic
+	}
+	return topic
+}
@@ -0,0 +1,94 @@
+package schema
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	api "github.com/justagabriel/proglog/api/v1"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+func TestRegistry(t *testing.T) {
+	// arrange
+	registry := NewRegistry()
+	registry.Register("servers", NewProto((&api.Server{}).ProtoReflect().Descriptor()))
+	server, err := proto.Marshal(&api.Server{Id: "0", RpcAddr: "localhost:8400"})
+	require.NoError(t, err)
+	record, err := proto.Marshal(&api.Record{Value: []byte("hello world"), Offset: 3})
+	require.NoError(t, err)
+
+	for scenario, tc := range map[string]struct {
+		topic     string
+		value     []byte
+		violation bool
+	}{
+		"matching value":          {topic: "servers", value: server},
+		"message of another type": {topic: "servers", value: record, violation: true},
+		"invalid encoding":        {topic: "servers", value: []byte("hello world"), violation: true},
+		"topic without schema":    {topic: "", value: []byte("hello world")},
+	} {
+		t.Run(scenario, func(t *testing.T) {
+			// act
+			err := registry.Validate(tc.topic, &api.Record{Value: tc.value})
+
+			// assert
+			if !tc.violation {
+				require.NoError(t, err)
+				return
+			}
+			violation, ok := err.(api.ErrSchemaViolation)
+			require.True(t, ok)
+			require.Equal(t, "servers", violation.Topic)
+			require.Equal(t, "log.v1.Server", violation.Schema)
+			require.NotEmpty(t, violation.Violation)
+		})
+	}
+}
+
+func TestRegistryLoad(t *testing.T) {
+	// arrange
+	dir := t.TempDir()
+	jsonFile := filepath.Join(dir, "order.json")
+	require.NoError(t, os.WriteFile(jsonFile, []byte(`{"type": "object", "required": ["id"]}`), 0600))
+	set, err := proto.Marshal(descriptorSet(api.File_api_v1_log_proto))
+	require.NoError(t, err)
+	protoFile := filepath.Join(dir, "log.binpb")
+	require.NoError(t, os.WriteFile(protoFile, set, 0600))
+	registry := NewRegistry()
+
+	// act
+	require.NoError(t, registry.Load("orders="+jsonFile))
+	require.NoError(t, registry.Load("servers="+protoFile+"#log.v1.Server"))
+
+	// assert
+	require.NoError(t, registry.Validate("orders", &api.Record{Value: []byte(`{"id": 1}`)}))
+	require.Error(t, registry.Validate("orders", &api.Record{Value: []byte(`{}`)}))
+	require.Error(t, registry.Validate("servers", &api.Record{Value: []byte("hello world")}))
+	require.Error(t, registry.Load("orders"), "the topic is missing")
+	require.Error(t, registry.Load("servers="+protoFile+"#log.v1.Missing"))
+}
+
+// descriptorSet holds the file along with its imports, like protoc --include_imports.
+func descriptorSet(file protoreflect.FileDescriptor) *descriptorpb.FileDescriptorSet {
+	set := &descriptorpb.FileDescriptorSet{}
+	seen := make(map[string]bool)
+	var add func(protoreflect.FileDescriptor)
+	add = func(file protoreflect.FileDescriptor) {
+		if seen[file.Path()] {
+			return
+		}
+		seen[file.Path()] = true
+		imports := file.Imports()
+		for i := 0; i < imports.Len(); i++ {
+			add(imports.Get(i).FileDescriptor)
+		}
+		set.File = append(set.File, protodesc.ToFileDescriptorProto(file))
+	}
+	add(file)
+	return set
+}
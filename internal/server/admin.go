@@ -0,0 +1,212 @@
+package server
+
+import (
+	"context"
+	"errors"
+
+	api "github.com/justagabriel/proglog/api/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// TopicAdmin manages the lifecycle of topics for the Admin service, see
+// log.Topics.CreateTopic.
+type TopicAdmin interface {
+	CreateTopic(topic string, config *api.TopicConfig) (*api.TopicDescription, error)
+	DeleteTopic(topic string) error
+	UndeleteTopic(topic string) (*api.TopicDescription, error)
+	DescribeTopic(topic string) (*api.TopicDescription, error)
+	ConfigureTopic(topic string, config *api.TopicConfig) (*api.TopicDescription, error)
+}
+
+// Maintainer runs retention and compaction on demand, see
+// log.Log.RunMaintenance.
+type Maintainer interface {
+	RunMaintenance(topic string, task api.MaintenanceTask) (*api.MaintenanceProgress, error)
+	MaintenanceStatus(topic string) ([]*api.MaintenanceProgress, error)
+}
+
+// authorizeAdmin checks whether the subject may administer the topic.
+func (s *grpcServer) authorizeAdmin(ctx context.Context, topic string) error {
+	if s.TopicAdmin == nil {
+		return status.Error(codes.Unimplemented, "topic administration is not supported")
+	}
+	return s.Authorizer.Authorize(subject(ctx), topicObject(topic), adminAction)
+}
+
+func (s *grpcServer) CreateTopic(ctx context.Context, req *api.CreateTopicRequest) (*api.CreateTopicResponse, error) {
+	if err := s.authorizeAdmin(ctx, req.Topic); err != nil {
+		return nil, err
+	}
+	topic, err := s.TopicAdmin.CreateTopic(req.Topic, req.Config)
+	if leader, fctx, ok := s.forwardAdmin(ctx, err); ok {
+		return leader.CreateTopic(fctx, req)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &api.CreateTopicResponse{Topic: topic}, nil
+}
+
+func (s *grpcServer) DeleteTopic(ctx context.Context, req *api.DeleteTopicRequest) (*api.DeleteTopicResponse, error) {
+	if err := s.authorizeAdmin(ctx, req.Topic); err != nil {
+		return nil, err
+	}
+	err := s.TopicAdmin.DeleteTopic(req.Topic)
+	if leader, fctx, ok := s.forwardAdmin(ctx, err); ok {
+		return leader.DeleteTopic(fctx, req)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &api.DeleteTopicResponse{}, nil
+}
+
+func (s *grpcServer) UndeleteTopic(ctx context.Context, req *api.UndeleteTopicRequest) (*api.UndeleteTopicResponse, error) {
+	if err := s.authorizeAdmin(ctx, req.Topic); err != nil {
+		return nil, err
+	}
+	topic, err := s.TopicAdmin.UndeleteTopic(req.Topic)
+	if leader, fctx, ok := s.forwardAdmin(ctx, err); ok {
+		return leader.UndeleteTopic(fctx, req)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &api.UndeleteTopicResponse{Topic: topic}, nil
+}
+
+// DescribeTopic describes the topic as this server's replica has it.
+func (s *grpcServer) DescribeTopic(ctx context.Context, req *api.DescribeTopicRequest) (*api.DescribeTopicResponse, error) {
+	if err := s.authorizeAdmin(ctx, req.Topic); err != nil {
+		return nil, err
+	}
+	topic, err := s.TopicAdmin.DescribeTopic(req.Topic)
+	if err != nil {
+		return nil, err
+	}
+	return &api.DescribeTopicResponse{Topic: topic}, nil
+}
+
+func (s *grpcServer) ConfigureTopic(ctx context.Context, req *api.ConfigureTopicRequest) (*api.ConfigureTopicResponse, error) {
+	if err := s.authorizeAdmin(ctx, req.Topic); err != nil {
+		return nil, err
+	}
+	topic, err := s.TopicAdmin.ConfigureTopic(req.Topic, req.Config)
+	if leader, fctx, ok := s.forwardAdmin(ctx, err); ok {
+		return leader.ConfigureTopic(fctx, req)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &api.ConfigureTopicResponse{Topic: topic}, nil
+}
+
+// ResetOffsets commits the offset resolved on this server's replica, a
+// follower forwards the request to the leader resolving it anew.
+func (s *grpcServer) ResetOffsets(ctx context.Context, req *api.ResetOffsetsRequest) (*api.ResetOffsetsResponse, error) {
+	err := s.authorizeGroup(ctx, req.Group, req.Topic, adminAction)
+	if err != nil {
+		return nil, err
+	}
+	offset, err := s.resetOffset(req)
+	if err != nil {
+		return nil, err
+	}
+	res := &api.ResetOffsetsResponse{Offset: offset}
+	if s.Watcher != nil {
+		hw, _, err := s.Watcher.HighWatermark(req.Topic)
+		if err != nil {
+			return nil, err
+		}
+		if hw.Offset > offset {
+			res.Lag = hw.Offset - offset
+		}
+	}
+	previous, err := s.OffsetCommitter.FetchOffset(req.Group, topicKey(req.Topic))
+	if err == nil {
+		res.PreviousOffset = &previous
+	} else if !errors.As(err, &api.ErrOffsetNotCommitted{}) {
+		return nil, err
+	}
+	if req.DryRun {
+		return res, nil
+	}
+
+	err = s.OffsetCommitter.CommitOffset(req.Group, topicKey(req.Topic), offset)
+	if leader, fctx, ok := s.forwardAdmin(ctx, err); ok {
+		return leader.ResetOffsets(fctx, req)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// resetOffset resolves the offset the request resets the group to.
+func (s *grpcServer) resetOffset(req *api.ResetOffsetsRequest) (uint64, error) {
+	switch to := req.To.(type) {
+	case *api.ResetOffsetsRequest_Earliest:
+		if s.OffsetRanger == nil {
+			return 0, status.Error(codes.Unimplemented, "offset ranges are not supported")
+		}
+		return s.OffsetRanger.LowestOffset(req.Topic)
+	case *api.ResetOffsetsRequest_Latest:
+		if s.Watcher == nil {
+			return 0, status.Error(codes.Unimplemented, "high watermarks are not supported")
+		}
+		hw, _, err := s.Watcher.HighWatermark(req.Topic)
+		if err != nil {
+			return 0, err
+		}
+		return hw.Offset, nil
+	case *api.ResetOffsetsRequest_Time:
+		if s.TimeSearcher == nil {
+			return 0, status.Error(codes.Unimplemented, "searching by time is not supported")
+		}
+		if err := to.Time.CheckValid(); err != nil {
+			return 0, status.Error(codes.InvalidArgument, err.Error())
+		}
+		return s.TimeSearcher.OffsetByTime(req.Topic, to.Time.AsTime())
+	case *api.ResetOffsetsRequest_Offset:
+		return to.Offset, nil
+	default:
+		return 0, status.Error(codes.InvalidArgument, "earliest, latest, time or offset is required")
+	}
+}
+
+// authorizeMaintenance checks whether the subject may maintain the topic.
+func (s *grpcServer) authorizeMaintenance(ctx context.Context, topic string) error {
+	if s.Maintainer == nil {
+		return status.Error(codes.Unimplemented, "maintenance is not supported")
+	}
+	return s.Authorizer.Authorize(subject(ctx), topicObject(topic), adminAction)
+}
+
+// RunMaintenance runs the task on the topic's log of this server.
+func (s *grpcServer) RunMaintenance(ctx context.Context, req *api.RunMaintenanceRequest) (*api.RunMaintenanceResponse, error) {
+	if err := s.authorizeMaintenance(ctx, req.Topic); err != nil {
+		return nil, err
+	}
+	if _, ok := api.MaintenanceTask_name[int32(req.Task)]; !ok {
+		return nil, status.Errorf(codes.InvalidArgument, "unknown maintenance task %d", req.Task)
+	}
+	progress, err := s.Maintainer.RunMaintenance(req.Topic, req.Task)
+	if err != nil {
+		return nil, err
+	}
+	return &api.RunMaintenanceResponse{Progress: progress}, nil
+}
+
+// GetMaintenanceStatus reports the maintenance runs of the topic's log of
+// this server.
+func (s *grpcServer) GetMaintenanceStatus(ctx context.Context, req *api.GetMaintenanceStatusRequest) (*api.GetMaintenanceStatusResponse, error) {
+	if err := s.authorizeMaintenance(ctx, req.Topic); err != nil {
+		return nil, err
+	}
+	runs, err := s.Maintainer.MaintenanceStatus(req.Topic)
+	if err != nil {
+		return nil, err
+	}
+	return &api.GetMaintenanceStatusResponse{Runs: runs}, nil
+}
@@ -0,0 +1,219 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	api "github.com/justagabriel/proglog/api/v1"
+	"github.com/justagabriel/proglog/internal/log"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestServerTopicLifecycle(t *testing.T) {
+	// arrange
+	testSetup := SetupTest(t, nil, debug)
+	defer testSetup.Teardown()
+	admin := testSetup.AuthorizedAdminClient
+	ctx := context.Background()
+	config := &api.TopicConfig{MaxStoreBytes: 4096, Compact: true}
+
+	// act
+	created, err := admin.CreateTopic(ctx, &api.CreateTopicRequest{Topic: "orders", Config: config})
+	require.NoError(t, err)
+	_, existsErr := admin.CreateTopic(ctx, &api.CreateTopicRequest{Topic: "orders"})
+	_, err = testSetup.AuthorizedClient.Create(ctx, &api.CreateRecordRequest{Topic: "orders", Record: &api.Record{Value: []byte("order")}})
+	require.NoError(t, err)
+	configured, err := admin.ConfigureTopic(ctx, &api.ConfigureTopicRequest{Topic: "orders", Config: &api.TopicConfig{RetentionMaxBytes: 1 << 20}})
+	require.NoError(t, err)
+	described, err := admin.DescribeTopic(ctx, &api.DescribeTopicRequest{Topic: "orders"})
+	require.NoError(t, err)
+	_, err = admin.DeleteTopic(ctx, &api.DeleteTopicRequest{Topic: "orders"})
+	require.NoError(t, err)
+	_, deletedErr := admin.DescribeTopic(ctx, &api.DescribeTopicRequest{Topic: "orders"})
+
+	// assert
+	require.Equal(t, "orders", created.Topic.Topic)
+	require.Equal(t, config.MaxStoreBytes, created.Topic.Config.MaxStoreBytes)
+	require.True(t, created.Topic.Config.Compact)
+	require.Equal(t, codes.AlreadyExists, status.Code(existsErr))
+	require.Equal(t, uint64(1<<20), configured.Topic.Config.RetentionMaxBytes)
+	require.False(t, configured.Topic.Config.Compact, "configuring replaces the overrides")
+	require.NotZero(t, described.Topic.Stats.TotalBytes)
+	require.Equal(t, codes.NotFound, status.Code(deletedErr))
+	_, err = testSetup.AuthorizedClient.Get(ctx, &api.GetRecordRequest{Topic: "orders"})
+	require.Error(t, err, "the records are deleted along with the topic")
+}
+
+func TestServerUndeleteTopic(t *testing.T) {
+	// arrange
+	testSetup := SetupTest(t, func(c *Config) {
+		c.TopicAdmin.(*log.Topics).Config.TopicDeleteGracePeriod = time.Hour
+	}, debug)
+	defer testSetup.Teardown()
+	admin := testSetup.AuthorizedAdminClient
+	client := testSetup.AuthorizedClient
+	ctx := context.Background()
+	_, err := admin.CreateTopic(ctx, &api.CreateTopicRequest{Topic: "orders", Config: &api.TopicConfig{Compact: true}})
+	require.NoError(t, err)
+	_, err = client.Create(ctx, &api.CreateRecordRequest{Topic: "orders", Record: &api.Record{Value: []byte("order")}})
+	require.NoError(t, err)
+
+	// act
+	_, err = admin.DeleteTopic(ctx, &api.DeleteTopicRequest{Topic: "orders"})
+	require.NoError(t, err)
+	_, produceErr := client.Create(ctx, &api.CreateRecordRequest{Topic: "orders", Record: &api.Record{Value: []byte("order")}})
+	_, deniedErr := testSetup.UnauthorizedAdminClient.UndeleteTopic(ctx, &api.UndeleteTopicRequest{Topic: "orders"})
+	undeleted, err := admin.UndeleteTopic(ctx, &api.UndeleteTopicRequest{Topic: "orders"})
+	require.NoError(t, err)
+	_, notDeletedErr := admin.UndeleteTopic(ctx, &api.UndeleteTopicRequest{Topic: "orders"})
+
+	// assert
+	require.Equal(t, api.ErrTopicDeleted{Topic: "orders"}, api.FromError(produceErr))
+	require.Equal(t, codes.PermissionDenied, status.Code(deniedErr))
+	require.True(t, undeleted.Topic.Config.Compact)
+	require.Equal(t, codes.NotFound, status.Code(notDeletedErr))
+	res, err := client.Get(ctx, &api.GetRecordRequest{Topic: "orders"})
+	require.NoError(t, err)
+	require.Equal(t, []byte("order"), res.Record.Value)
+}
+
+func TestServerTopicAdminAuthorization(t *testing.T) {
+	scenarios := map[string]struct {
+		fn   func(*Config)
+		code codes.Code
+	}{
+		"admin action is required":    {code: codes.PermissionDenied},
+		"unimplemented without admin": {fn: func(c *Config) { c.TopicAdmin = nil }, code: codes.Unimplemented},
+	}
+
+	for scenario, s := range scenarios {
+		t.Run(scenario, func(t *testing.T) {
+			// arrange
+			testSetup := SetupTest(t, s.fn, debug)
+			defer testSetup.Teardown()
+
+			// act
+			_, err := testSetup.UnauthorizedAdminClient.CreateTopic(context.Background(), &api.CreateTopicRequest{Topic: "orders"})
+
+			// assert
+			require.Equal(t, s.code, status.Code(err))
+		})
+	}
+}
+
+func TestServerMaintenance(t *testing.T) {
+	// arrange
+	testSetup := SetupTest(t, nil, debug)
+	defer testSetup.Teardown()
+	admin := testSetup.AuthorizedAdminClient
+	ctx := context.Background()
+	for topic, compact := range map[string]bool{"orders": true, "events": false} {
+		_, err := admin.CreateTopic(ctx, &api.CreateTopicRequest{Topic: topic, Config: &api.TopicConfig{MaxStoreBytes: 96, Compact: compact}})
+		require.NoError(t, err)
+	}
+	for i := 0; i < 10; i++ {
+		_, err := testSetup.AuthorizedClient.Create(ctx, &api.CreateRecordRequest{
+			Topic:  "orders",
+			Record: &api.Record{Key: []byte("order"), Value: []byte("state")},
+		})
+		require.NoError(t, err)
+	}
+	compaction := api.MaintenanceTask_MAINTENANCE_TASK_COMPACTION
+
+	// act
+	started, err := admin.RunMaintenance(ctx, &api.RunMaintenanceRequest{Topic: "orders", Task: compaction})
+	require.NoError(t, err)
+	var runs []*api.MaintenanceProgress
+	require.Eventually(t, func() bool {
+		res, err := admin.GetMaintenanceStatus(ctx, &api.GetMaintenanceStatusRequest{Topic: "orders"})
+		require.NoError(t, err)
+		runs = res.Runs
+		return len(runs) == 1 && runs[0].Finished != nil
+	}, 5*time.Second, 10*time.Millisecond)
+	_, disabledErr := admin.RunMaintenance(ctx, &api.RunMaintenanceRequest{Topic: "events", Task: compaction})
+	_, unknownErr := admin.RunMaintenance(ctx, &api.RunMaintenanceRequest{Topic: "unknown"})
+	_, deniedErr := testSetup.UnauthorizedAdminClient.RunMaintenance(ctx, &api.RunMaintenanceRequest{Topic: "orders"})
+
+	// assert
+	require.Equal(t, compaction, started.Progress.Task)
+	run := runs[0]
+	require.Empty(t, run.Error)
+	require.NotZero(t, run.Segments)
+	require.Equal(t, run.Segments, run.SegmentsProcessed)
+	require.NotZero(t, run.BytesReclaimed)
+	require.Equal(t, api.ErrCompactionDisabled{Topic: "events"}, api.FromError(disabledErr))
+	require.Equal(t, codes.NotFound, status.Code(unknownErr))
+	require.Equal(t, codes.PermissionDenied, status.Code(deniedErr))
+}
+
+func TestServerResetOffsets(t *testing.T) {
+	scenarios := map[string]struct {
+		req       *api.ResetOffsetsRequest
+		offset    uint64
+		committed uint64
+		lag       uint64
+		code      codes.Code
+	}{
+		"earliest":           {req: &api.ResetOffsetsRequest{To: &api.ResetOffsetsRequest_Earliest{Earliest: true}}, offset: 0, committed: 0, lag: 3},
+		"latest":             {req: &api.ResetOffsetsRequest{To: &api.ResetOffsetsRequest_Latest{Latest: true}}, offset: 3, committed: 3},
+		"time":               {req: &api.ResetOffsetsRequest{To: &api.ResetOffsetsRequest_Time{Time: timestamppb.New(time.Now().Add(time.Hour))}}, offset: 3, committed: 3},
+		"offset":             {req: &api.ResetOffsetsRequest{To: &api.ResetOffsetsRequest_Offset{Offset: 2}}, offset: 2, committed: 2, lag: 1},
+		"past the end":       {req: &api.ResetOffsetsRequest{To: &api.ResetOffsetsRequest_Offset{Offset: 5}, DryRun: true}, offset: 5, committed: 1},
+		"dry run":            {req: &api.ResetOffsetsRequest{To: &api.ResetOffsetsRequest_Earliest{Earliest: true}, DryRun: true}, offset: 0, committed: 1, lag: 3},
+		"target is required": {req: &api.ResetOffsetsRequest{}, code: codes.InvalidArgument},
+	}
+
+	for scenario, s := range scenarios {
+		t.Run(scenario, func(t *testing.T) {
+			// arrange
+			testSetup := SetupTest(t, nil, debug)
+			defer testSetup.Teardown()
+			client := testSetup.AuthorizedClient
+			ctx := context.Background()
+			for _, value := range []string{"order 0", "order 1", "order 2"} {
+				_, err := client.Create(ctx, &api.CreateRecordRequest{Topic: "orders", Record: &api.Record{Value: []byte(value)}})
+				require.NoError(t, err)
+			}
+			_, err := client.CommitOffset(ctx, &api.CommitOffsetRequest{Group: "billing", Topic: "orders", Offset: 1})
+			require.NoError(t, err)
+			s.req.Group, s.req.Topic = "billing", "orders"
+
+			// act
+			res, err := testSetup.AuthorizedAdminClient.ResetOffsets(ctx, s.req)
+
+			// assert
+			require.Equal(t, s.code, status.Code(err))
+			if err != nil {
+				return
+			}
+			require.Equal(t, s.offset, res.Offset)
+			require.Equal(t, s.lag, res.Lag)
+			require.Equal(t, uint64(1), res.GetPreviousOffset())
+			committed, err := client.FetchOffset(ctx, &api.FetchOffsetRequest{Group: "billing", Topic: "orders"})
+			require.NoError(t, err)
+			require.Equal(t, s.committed, committed.Offset)
+		})
+	}
+}
+
+func TestServerResetOffsetsUncommitted(t *testing.T) {
+	// arrange
+	testSetup := SetupTest(t, nil, debug)
+	defer testSetup.Teardown()
+	ctx := context.Background()
+	req := &api.ResetOffsetsRequest{Group: "billing", Topic: "orders", To: &api.ResetOffsetsRequest_Offset{Offset: 5}}
+
+	// act
+	res, err := testSetup.AuthorizedAdminClient.ResetOffsets(ctx, req)
+	require.NoError(t, err)
+	_, unauthorizedErr := testSetup.UnauthorizedAdminClient.ResetOffsets(ctx, req)
+
+	// assert
+	require.Equal(t, uint64(5), res.Offset)
+	require.Nil(t, res.PreviousOffset, "the group had no offset committed")
+	require.Equal(t, codes.PermissionDenied, status.Code(unauthorizedErr))
+}
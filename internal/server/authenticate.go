@@ -0,0 +1,155 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+
+	grpc_auth "github.com/grpc-ecosystem/go-grpc-middleware/auth"
+	grpc_ctxtags "github.com/grpc-ecosystem/go-grpc-middleware/tags"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// Authenticator resolves the subject of a request. ok is false if the request
+// carries no credentials the authenticator understands, an error is returned
+// for credentials which are present but invalid.
+type Authenticator interface {
+	Authenticate(ctx context.Context) (subject string, ok bool, err error)
+}
+
+// TLSAuthenticator uses a verified client certificate's subject, by default its common name.
+type TLSAuthenticator struct {
+	// Subject extracts the subject from the certificate, e.g. SPIFFESubject,
+	// defaults to CommonNameSubject.
+	Subject CertSubject
+}
+
+// CertSubject extracts the subject from a client certificate, ok is false if it has none.
+type CertSubject func(cert *x509.Certificate) (subject string, ok bool)
+
+// CommonNameSubject uses the certificate's common name as subject.
+func CommonNameSubject(cert *x509.Certificate) (string, bool) {
+	return cert.Subject.CommonName, true
+}
+
+// SPIFFESubject uses the certificate's SPIFFE ID as subject, e.g.
+// "spiffe://example.org/ns/prod/sa/billing" issued by SPIRE.
+func SPIFFESubject(cert *x509.Certificate) (string, bool) {
+	for _, uri := range cert.URIs {
+		if uri.Scheme == "spiffe" && uri.Host != "" {
+			return uri.String(), true
+		}
+	}
+	return "", false
+}
+
+// DNSSubject uses the certificate's first DNS SAN as subject.
+func DNSSubject(cert *x509.Certificate) (string, bool) {
+	if len(cert.DNSNames) == 0 {
+		return "", false
+	}
+	return cert.DNSNames[0], true
+}
+
+func (a TLSAuthenticator) Authenticate(ctx context.Context) (string, bool, error) {
+	peer, ok := peer.FromContext(ctx)
+	if !ok || peer.AuthInfo == nil {
+		return "", false, nil
+	}
+
+	tlsInfo, ok := peer.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(tlsInfo.State.VerifiedChains) == 0 {
+		return "", false, nil
+	}
+	subject := a.Subject
+	if subject == nil {
+		subject = CommonNameSubject
+	}
+	name, ok := subject(tlsInfo.State.VerifiedChains[0][0])
+	return name, ok, nil
+}
+
+// TokenAuthenticator maps static bearer tokens from the "authorization" metadata to subjects.
+type TokenAuthenticator struct {
+	// subjects is keyed by the tokens' hashes, so lookups don't leak token prefixes through timing
+	subjects map[[sha256.Size]byte]string
+}
+
+// NewTokenAuthenticator creates a TokenAuthenticator from a token to subject mapping.
+func NewTokenAuthenticator(tokens map[string]string) *TokenAuthenticator {
+	a := &TokenAuthenticator{subjects: make(map[[sha256.Size]byte]string, len(tokens))}
+	for token, subject := range tokens {
+		a.subjects[sha256.Sum256([]byte(token))] = subject
+	}
+	return a
+}
+
+// LoadTokenAuthenticator reads a file with one "<subject> <token>" pair per line.
+// Empty lines and lines starting with '#' are ignored.
+func LoadTokenAuthenticator(path string) (*TokenAuthenticator, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	tokens := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: expected \"<subject> <token>\"", path, line)
+		}
+		tokens[fields[1]] = fields[0]
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+	return NewTokenAuthenticator(tokens), nil
+}
+
+func (a *TokenAuthenticator) Authenticate(ctx context.Context) (string, bool, error) {
+	token, err := grpc_auth.AuthFromMD(ctx, "bearer")
+	if err != nil {
+		return "", false, nil
+	}
+
+	subject, ok := a.subjects[sha256.Sum256([]byte(token))]
+	if !ok {
+		return "", false, status.Error(codes.Unauthenticated, "invalid bearer token")
+	}
+	return subject, true, nil
+}
+
+// authenticator runs the authenticators in order, the first one which applies
+// determines the subject. Requests no authenticator applies to get the empty subject.
+func authenticator(authenticators []Authenticator) grpc_auth.AuthFunc {
+	return func(ctx context.Context) (context.Context, error) {
+		if _, ok := peer.FromContext(ctx); !ok {
+			return ctx, status.New(codes.Unknown, "couldn't find peer info").Err()
+		}
+
+		for _, a := range authenticators {
+			subject, ok, err := a.Authenticate(ctx)
+			if err != nil {
+				return ctx, err
+			}
+			if ok {
+				grpc_ctxtags.Extract(ctx).Set("peer.subject", subject)
+				return context.WithValue(ctx, subjectContextKey{}, subject), nil
+			}
+		}
+		return context.WithValue(ctx, subjectContextKey{}, ""), nil
+	}
+}
@@ -0,0 +1,141 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+func TestAuthenticatorChain(t *testing.T) {
+	scenarios := map[string]func(t *testing.T, authenticate func(context.Context) (context.Context, error)){
+		"client certificate wins over token":     testAuthenticateCertFirst,
+		"token authenticates without cert":       testAuthenticateToken,
+		"invalid token is rejected":              testAuthenticateInvalidToken,
+		"no credentials yield the empty subject": testAuthenticateAnonymous,
+	}
+
+	authenticate := authenticator([]Authenticator{
+		TLSAuthenticator{},
+		NewTokenAuthenticator(map[string]string{"secret-token": "root"}),
+	})
+	for title, scenario := range scenarios {
+		t.Run(title, func(t *testing.T) {
+			scenario(t, authenticate)
+		})
+	}
+}
+
+func testPeerContext(commonName string) context.Context {
+	p := &peer.Peer{Addr: &net.TCPAddr{}}
+	if commonName != "" {
+		cert := &x509.Certificate{Subject: pkix.Name{CommonName: commonName}}
+		p.AuthInfo = credentials.TLSInfo{
+			State: tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}},
+		}
+	}
+	return peer.NewContext(context.Background(), p)
+}
+
+func withBearer(ctx context.Context, token string) context.Context {
+	return metadata.NewIncomingContext(ctx, metadata.Pairs("authorization", "Bearer "+token))
+}
+
+func testAuthenticateCertFirst(t *testing.T, authenticate func(context.Context) (context.Context, error)) {
+	// arrange
+	ctx := withBearer(testPeerContext("nobody"), "secret-token")
+
+	// act
+	ctx, err := authenticate(ctx)
+
+	// assert
+	require.NoError(t, err)
+	require.Equal(t, "nobody", subject(ctx))
+}
+
+func testAuthenticateToken(t *testing.T, authenticate func(context.Context) (context.Context, error)) {
+	// arrange
+	ctx := withBearer(testPeerContext(""), "secret-token")
+
+	// act
+	ctx, err := authenticate(ctx)
+
+	// assert
+	require.NoError(t, err)
+	require.Equal(t, "root", subject(ctx))
+}
+
+func testAuthenticateInvalidToken(t *testing.T, authenticate func(context.Context) (context.Context, error)) {
+	// arrange
+	ctx := withBearer(testPeerContext(""), "guessed-token")
+
+	// act
+	_, err := authenticate(ctx)
+
+	// assert
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+func testAuthenticateAnonymous(t *testing.T, authenticate func(context.Context) (context.Context, error)) {
+	// act
+	ctx, err := authenticate(testPeerContext(""))
+
+	// assert
+	require.NoError(t, err)
+	require.Equal(t, "", subject(ctx))
+}
+
+func TestCertSubject(t *testing.T) {
+	spiffeID, err := url.Parse("spiffe://example.org/ns/prod/sa/billing")
+	require.NoError(t, err)
+	website, err := url.Parse("https://example.org")
+	require.NoError(t, err)
+	cert := &x509.Certificate{
+		Subject:  pkix.Name{CommonName: "billing"},
+		DNSNames: []string{"billing.example.org", "billing"},
+		URIs:     []*url.URL{website, spiffeID},
+	}
+
+	for scenario, tc := range map[string]struct {
+		subject CertSubject
+		cert    *x509.Certificate
+		want    string
+		wantOK  bool
+	}{
+		"common name":                {subject: CommonNameSubject, cert: cert, want: "billing", wantOK: true},
+		"SPIFFE ID":                  {subject: SPIFFESubject, cert: cert, want: spiffeID.String(), wantOK: true},
+		"first DNS SAN":              {subject: DNSSubject, cert: cert, want: "billing.example.org", wantOK: true},
+		"no SPIFFE ID":               {subject: SPIFFESubject, cert: &x509.Certificate{URIs: []*url.URL{website}}},
+		"no DNS SAN":                 {subject: DNSSubject, cert: &x509.Certificate{}},
+		"authenticator uses subject": {cert: cert, want: spiffeID.String(), wantOK: true},
+	} {
+		t.Run(scenario, func(t *testing.T) {
+			// act
+			var got string
+			var ok bool
+			if tc.subject != nil {
+				got, ok = tc.subject(tc.cert)
+			} else {
+				p := &peer.Peer{Addr: &net.TCPAddr{}, AuthInfo: credentials.TLSInfo{
+					State: tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{tc.cert}}},
+				}}
+				got, ok, err = TLSAuthenticator{Subject: SPIFFESubject}.Authenticate(peer.NewContext(context.Background(), p))
+				require.NoError(t, err)
+			}
+
+			// assert
+			require.Equal(t, tc.wantOK, ok)
+			require.Equal(t, tc.want, got)
+		})
+	}
+}
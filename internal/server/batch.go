@@ -0,0 +1,101 @@
+package server
+
+import (
+	"context"
+
+	api "github.com/justagabriel/proglog/api/v1"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+)
+
+// maxStreamBatchBytes caps the bytes of a batch sent by GetStream and
+// ConsumeStream, well below gRPC's default message size limit of 4MiB.
+const maxStreamBatchBytes = 1 << 20
+
+// recordsField is the field number of GetRecordResponse.records.
+var recordsField = (&api.GetRecordResponse{}).ProtoReflect().Descriptor().Fields().ByName("records").Number()
+
+// batch collects the encoded records GetStream and ConsumeStream send in a
+// single response, see GetRecordRequest.max_records and max_bytes.
+type batch struct {
+	maxRecords int
+	maxBytes   int
+	records    int
+	b          []byte
+}
+
+func newBatch(req *api.GetRecordRequest) *batch {
+	if req.MaxRecords == 0 && req.MaxBytes == 0 {
+		return &batch{}
+	}
+	maxBytes := int(req.MaxBytes)
+	if maxBytes == 0 || maxBytes > maxStreamBatchBytes {
+		maxBytes = maxStreamBatchBytes
+	}
+	return &batch{maxRecords: int(req.MaxRecords), maxBytes: maxBytes}
+}
+
+// enabled tells whether the request asked for batches.
+func (b *batch) enabled() bool {
+	return b.maxBytes > 0
+}
+
+// fits tells whether the record can be added without exceeding max_bytes,
+// an empty batch takes any record.
+func (b *batch) fits(record []byte) bool {
+	size := protowire.SizeTag(recordsField) + protowire.SizeBytes(len(record))
+	return b.records == 0 || len(b.b)+size <= b.maxBytes
+}
+
+func (b *batch) add(record []byte) {
+	b.b = protowire.AppendTag(b.b, recordsField, protowire.BytesType)
+	b.b = protowire.AppendBytes(b.b, record)
+	b.records++
+}
+
+// full tells whether the batch has to be sent before adding more records.
+func (b *batch) full() bool {
+	return b.maxRecords > 0 && b.records >= b.maxRecords || len(b.b) >= b.maxBytes
+}
+
+// take returns the batch's response and empties it, nil if it's empty.
+func (b *batch) take() *encodedResponse {
+	if b.records == 0 {
+		return nil
+	}
+	res := &encodedResponse{b: b.b}
+	b.b = nil
+	b.records = 0
+	return res
+}
+
+// getBatch is Get for GetStream requests asking for batches: it reads the
+// records from the requested offset on until the batch is full or the end
+// of the topic is reached, skipping those not matching the filter. Only the
+// first read waits like Get. The response is nil if no record matched.
+func (s *grpcServer) getBatch(ctx context.Context, req *api.GetRecordRequest) (*encodedResponse, error) {
+	b := newBatch(req)
+	getReq := req
+	for offset := req.Offset; !b.full(); offset++ {
+		res, err := s.Get(ctx, getReq)
+		if _, ok := err.(api.ErrOffsetOutOfRange); ok && offset > req.Offset {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		getReq = &api.GetRecordRequest{Topic: req.Topic, Offset: offset + 1, Consistency: req.Consistency}
+		if !matches(req.Filter, res.Record) {
+			continue
+		}
+		record, err := proto.Marshal(res.Record)
+		if err != nil {
+			return nil, err
+		}
+		if !b.fits(record) {
+			break
+		}
+		b.add(record)
+	}
+	return b.take(), nil
+}
@@ -0,0 +1,125 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	api "github.com/justagabriel/proglog/api/v1"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestServerConsumeStreamBatches(t *testing.T) {
+	scenarios := map[string]func(*Config){
+		"waits for the high watermark":   nil,
+		"polls without watcher":          func(c *Config) { c.Watcher = nil },
+		"decodes without encoded reader": func(c *Config) { c.EncodedReader = nil },
+	}
+
+	for scenario, fn := range scenarios {
+		t.Run(scenario, func(t *testing.T) {
+			// arrange
+			testSetup := SetupTest(t, fn, debug)
+			defer testSetup.Teardown()
+			client := testSetup.AuthorizedClient
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			createRecords(t, client, 0, 5)
+
+			// act
+			stream, err := client.ConsumeStream(ctx, &api.GetRecordRequest{MaxRecords: 2})
+			require.NoError(t, err)
+			var batches [][]uint64
+			for i := 0; i < 3; i++ {
+				res, err := stream.Recv()
+				require.NoError(t, err)
+				batches = append(batches, recordOffsets(t, res))
+			}
+			createRecords(t, client, 5, 1)
+			res, err := stream.Recv()
+
+			// assert
+			require.NoError(t, err)
+			require.Equal(t, [][]uint64{{0, 1}, {2, 3}, {4}}, batches, "the last batch is sent at the end of the log")
+			require.Equal(t, []uint64{5}, recordOffsets(t, res))
+			require.Equal(t, "record 5", string(res.Records[0].Value))
+		})
+	}
+}
+
+func TestServerConsumeStreamBatchBytes(t *testing.T) {
+	// arrange
+	testSetup := SetupTest(t, nil, debug)
+	defer testSetup.Teardown()
+	client := testSetup.AuthorizedClient
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	createRecords(t, client, 0, 5)
+	stored, err := client.Get(ctx, &api.GetRecordRequest{Offset: 1})
+	require.NoError(t, err)
+	size := proto.Size(&api.GetRecordResponse{Records: []*api.Record{stored.Record}})
+
+	// act
+	stream, err := client.ConsumeStream(ctx, &api.GetRecordRequest{MaxBytes: uint32(2*size + 1)})
+	require.NoError(t, err)
+	var batches [][]uint64
+	for i := 0; i < 3; i++ {
+		res, err := stream.Recv()
+		require.NoError(t, err)
+		batches = append(batches, recordOffsets(t, res))
+	}
+	tiny, err := client.ConsumeStream(ctx, &api.GetRecordRequest{Offset: 3, MaxBytes: 1})
+	require.NoError(t, err)
+	res, err := tiny.Recv()
+
+	// assert
+	require.Equal(t, [][]uint64{{0, 1}, {2, 3}, {4}}, batches)
+	require.NoError(t, err)
+	require.Equal(t, []uint64{3}, recordOffsets(t, res), "a batch holds at least one record")
+}
+
+func TestServerGetStreamBatches(t *testing.T) {
+	// arrange
+	testSetup := SetupTest(t, nil, debug)
+	defer testSetup.Teardown()
+	client := testSetup.AuthorizedClient
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	createRecords(t, client, 0, 5)
+	stream, err := client.GetStream(ctx)
+	require.NoError(t, err)
+
+	// act
+	require.NoError(t, stream.Send(&api.GetRecordRequest{Offset: 1, MaxRecords: 10}))
+	all, allErr := stream.Recv()
+	require.NoError(t, stream.Send(&api.GetRecordRequest{Offset: 0, MaxRecords: 2}))
+	two, twoErr := stream.Recv()
+
+	// assert
+	require.NoError(t, allErr)
+	require.Equal(t, []uint64{1, 2, 3, 4}, recordOffsets(t, all), "the batch ends at the end of the log")
+	require.NoError(t, twoErr)
+	require.Equal(t, []uint64{0, 1}, recordOffsets(t, two))
+}
+
+func createRecords(t *testing.T, client api.LogClient, from, n int) {
+	t.Helper()
+	for i := from; i < from+n; i++ {
+		_, err := client.Create(context.Background(), &api.CreateRecordRequest{
+			Record: &api.Record{Value: []byte(fmt.Sprintf("record %d", i))},
+		})
+		require.NoError(t, err)
+	}
+}
+
+func recordOffsets(t *testing.T, res *api.GetRecordResponse) []uint64 {
+	t.Helper()
+	require.Nil(t, res.Record, "batches are sent in records")
+	var offsets []uint64
+	for _, record := range res.Records {
+		require.Equal(t, fmt.Sprintf("record %d", record.Offset), string(record.Value))
+		offsets = append(offsets, record.Offset)
+	}
+	return offsets
+}
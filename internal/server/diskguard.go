@@ -0,0 +1,68 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	api "github.com/justagabriel/proglog/api/v1"
+)
+
+// DiskUsager reports the bytes the server's data takes up on disk. It's
+// asked for every append, so it should be cheap, e.g. measured periodically.
+type DiskUsager interface {
+	DiskUsage() uint64
+}
+
+// DiskWatermarks keep producers from filling up the disk, which would leave
+// segments partially written. A zero value for a watermark disables it.
+type DiskWatermarks struct {
+	// Low throttles the appends once the data takes up more bytes, each is
+	// delayed the longer the closer the usage gets to High.
+	Low uint64
+	// High rejects the appends with api.ErrDiskFull once the data takes up
+	// that many bytes, until retention or deletions freed up space.
+	High uint64
+	// MaxThrottle is the delay of appends at the high watermark, defaults
+	// to a second.
+	MaxThrottle time.Duration
+}
+
+// throttle returns how long appends are delayed at the usage.
+func (w DiskWatermarks) throttle(usage uint64) time.Duration {
+	if w.Low == 0 || usage <= w.Low {
+		return 0
+	}
+	max := w.MaxThrottle
+	if max == 0 {
+		max = time.Second
+	}
+	if w.High <= w.Low || usage >= w.High {
+		return max
+	}
+	return time.Duration(float64(max) * float64(usage-w.Low) / float64(w.High-w.Low))
+}
+
+// guardDisk delays or rejects an append according to the DiskWatermarks.
+func (s *grpcServer) guardDisk(ctx context.Context) error {
+	if s.DiskUsager == nil {
+		return nil
+	}
+	usage := s.DiskUsager.DiskUsage()
+	if s.DiskWatermarks.High > 0 && usage >= s.DiskWatermarks.High {
+		recordDiskGuard(ctx, "rejected")
+		return api.ErrDiskFull{Usage: usage, HighWatermark: s.DiskWatermarks.High}
+	}
+	delay := s.DiskWatermarks.throttle(usage)
+	if delay == 0 {
+		return nil
+	}
+	recordDiskGuard(ctx, "throttled")
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return contextError(ctx.Err())
+	}
+}
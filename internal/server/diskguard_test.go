@@ -0,0 +1,164 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	api "github.com/justagabriel/proglog/api/v1"
+	"github.com/stretchr/testify/require"
+	"go.opencensus.io/stats/view"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestDiskWatermarksThrottle(t *testing.T) {
+	w := DiskWatermarks{Low: 100, High: 200, MaxThrottle: time.Second}
+	cases := map[string]struct {
+		w     DiskWatermarks
+		usage uint64
+		want  time.Duration
+	}{
+		"below low":        {w: w, usage: 100, want: 0},
+		"between":          {w: w, usage: 150, want: 500 * time.Millisecond},
+		"at high":          {w: w, usage: 200, want: time.Second},
+		"disabled":         {usage: 1 << 40, want: 0},
+		"low only":         {w: DiskWatermarks{Low: 100}, usage: 101, want: time.Second},
+		"default throttle": {w: DiskWatermarks{Low: 100, High: 200}, usage: 200, want: time.Second},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			require.Equal(t, c.want, c.w.throttle(c.usage))
+		})
+	}
+}
+
+// diskUsage reports a fixed disk usage.
+type diskUsage struct {
+	atomic.Uint64
+}
+
+func (d *diskUsage) DiskUsage() uint64 {
+	return d.Load()
+}
+
+func TestServerDiskWatermarks(t *testing.T) {
+	scenarios := map[string]func(t *testing.T, client api.LogClient, usage *diskUsage){
+		"appends below the low watermark pass": testDiskBelowLow,
+		"appends above the low one are slowed": testDiskThrottled,
+		"appends above the high one fail":      testDiskFull,
+	}
+
+	for scenario, fn := range scenarios {
+		t.Run(scenario, func(t *testing.T) {
+			usage := &diskUsage{}
+			testSetup := SetupTest(t, func(c *Config) {
+				c.DiskUsager = usage
+				c.DiskWatermarks = DiskWatermarks{Low: 100, High: 200, MaxThrottle: 200 * time.Millisecond}
+			}, debug)
+			defer testSetup.Teardown()
+			fn(t, testSetup.AuthorizedClient, usage)
+		})
+	}
+}
+
+func testDiskBelowLow(t *testing.T, client api.LogClient, usage *diskUsage) {
+	// arrange
+	usage.Store(100)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	// act
+	_, err := client.Create(ctx, &api.CreateRecordRequest{Record: &api.Record{Value: []byte("hello world")}})
+
+	// assert
+	require.NoError(t, err)
+}
+
+func testDiskThrottled(t *testing.T, client api.LogClient, usage *diskUsage) {
+	// arrange
+	usage.Store(150)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	// act
+	_, deadlineErr := client.Create(ctx, &api.CreateRecordRequest{Record: &api.Record{Value: []byte("hasty")}})
+	start := time.Now()
+	_, err := client.Create(context.Background(), &api.CreateRecordRequest{Record: &api.Record{Value: []byte("patient")}})
+
+	// assert
+	require.Equal(t, codes.DeadlineExceeded, status.Code(deadlineErr))
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, time.Since(start), 100*time.Millisecond)
+	_, err = client.Get(context.Background(), &api.GetRecordRequest{Offset: 1})
+	require.Error(t, err, "the hasty append was dropped")
+}
+
+func testDiskFull(t *testing.T, client api.LogClient, usage *diskUsage) {
+	// arrange
+	usage.Store(200)
+	record := &api.Record{Value: []byte("hello world")}
+
+	// act
+	_, createErr := client.Create(context.Background(), &api.CreateRecordRequest{Record: record})
+	_, batchErr := client.CreateBatch(context.Background(), &api.CreateRecordBatchRequest{Records: []*api.Record{record}})
+	usage.Store(0)
+	_, err := client.Create(context.Background(), &api.CreateRecordRequest{Record: record})
+
+	// assert
+	for _, err := range []error{createErr, batchErr} {
+		require.Equal(t, codes.ResourceExhausted, status.Code(err))
+		require.Equal(t, api.ErrDiskFull{Usage: 200, HighWatermark: 200}, api.FromError(err))
+	}
+	require.NoError(t, err, "appends pass again once space was freed up")
+}
+
+func TestMetricsExporterDisk(t *testing.T) {
+	// arrange
+	usage := &diskUsage{}
+	usage.Store(300)
+	testSetup := SetupTest(t, func(c *Config) {
+		c.DiskUsager = usage
+		c.DiskWatermarks = DiskWatermarks{Low: 100, High: 200}
+	}, debug)
+	defer testSetup.Teardown()
+	exporter, err := NewMetricsExporter(testSetup.Config)
+	require.NoError(t, err)
+	view.RegisterExporter(exporter)
+	defer view.UnregisterExporter(exporter)
+	view.SetReportingPeriod(10 * time.Millisecond)
+	defer view.SetReportingPeriod(10 * time.Second)
+	_, err = testSetup.AuthorizedClient.Create(context.Background(), &api.CreateRecordRequest{Record: &api.Record{Value: []byte("hello world")}})
+	require.Error(t, err)
+
+	want := []string{
+		"proglog_disk_bytes 300",
+		"proglog_disk_low_watermark_bytes 100",
+		"proglog_disk_high_watermark_bytes 200",
+		"# TYPE proglog_server_disk_guarded_appends counter",
+		`proglog_server_disk_guarded_appends{action="rejected"}`,
+	}
+
+	// act
+	scrape := func() bool {
+		res := httptest.NewRecorder()
+		exporter.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		b, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		for _, line := range want {
+			if !strings.Contains(string(b), line) {
+				return false
+			}
+		}
+		return true
+	}
+
+	// assert
+	require.Eventually(t, scrape, time.Second, 10*time.Millisecond)
+}
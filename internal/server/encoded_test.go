@@ -0,0 +1,70 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	api "github.com/justagabriel/proglog/api/v1"
+	"github.com/justagabriel/proglog/internal/log"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestCodec(t *testing.T) {
+	// arrange
+	record := &api.Record{Value: []byte("hello world"), Offset: 42}
+	p, err := proto.Marshal(record)
+	require.NoError(t, err)
+	want, err := proto.Marshal(&api.GetRecordResponse{Record: record})
+	require.NoError(t, err)
+
+	// act
+	encoded, encodedErr := codec{}.Marshal(newEncodedResponse(p))
+	marshaled, marshalErr := codec{}.Marshal(&api.GetRecordResponse{Record: record})
+	_, invalidErr := codec{}.Marshal("hello world")
+
+	// assert
+	require.NoError(t, encodedErr)
+	require.NoError(t, marshalErr)
+	require.Equal(t, want, encoded)
+	require.Equal(t, want, marshaled)
+	require.Error(t, invalidErr)
+	res := &api.GetRecordResponse{}
+	require.NoError(t, codec{}.Unmarshal(encoded, res))
+	require.True(t, proto.Equal(record, res.Record))
+}
+
+func TestServerConsumeStreamSealedSegments(t *testing.T) {
+	// arrange
+	logConfig := log.Config{}
+	logConfig.Segment.MaxStoreBytes = 32
+	clog, err := log.NewInMemory(logConfig)
+	require.NoError(t, err)
+	defer clog.Remove()
+	testSetup := SetupTest(t, func(c *Config) {
+		c.CommitLog = clog
+		c.Watcher = clog
+		c.EncodedReader = clog
+	}, debug)
+	defer testSetup.Teardown()
+	client := testSetup.AuthorizedClient
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	for i := 0; i < 3; i++ {
+		_, err := client.Create(ctx, &api.CreateRecordRequest{Record: &api.Record{Value: []byte(fmt.Sprintf("record %d", i))}})
+		require.NoError(t, err)
+	}
+
+	// act
+	stream, err := client.ConsumeStream(ctx, &api.GetRecordRequest{})
+	require.NoError(t, err)
+
+	// assert
+	for i := uint64(0); i < 3; i++ {
+		res, err := stream.Recv()
+		require.NoError(t, err)
+		require.Equal(t, i, res.Record.Offset)
+		require.Equal(t, fmt.Sprintf("record %d", i), string(res.Record.Value))
+	}
+}
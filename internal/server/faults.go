@@ -0,0 +1,57 @@
+package server
+
+import (
+	"sync"
+
+	"google.golang.org/grpc"
+)
+
+// Faults injects failures into the server's streams, so tests of clients can
+// reproduce lost messages deterministically, see Config.Faults. Its methods
+// may be called while the server runs, the zero value injects no failures.
+type Faults struct {
+	mu   sync.Mutex
+	drop int
+}
+
+// DropStreamMessages silently drops the next n messages the server sends on
+// any stream, as if the connection lost them.
+func (f *Faults) DropStreamMessages(n int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.drop = n
+}
+
+// dropMessage tells whether the next message is dropped.
+func (f *Faults) dropMessage() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.drop == 0 {
+		return false
+	}
+	f.drop--
+	return true
+}
+
+// injectStreamFaults drops the messages sent on streams according to the
+// faults, nil faults inject none.
+func injectStreamFaults(faults *Faults) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if faults == nil {
+			return handler(srv, ss)
+		}
+		return handler(srv, &faultyStream{ServerStream: ss, faults: faults})
+	}
+}
+
+type faultyStream struct {
+	grpc.ServerStream
+	faults *Faults
+}
+
+func (s *faultyStream) SendMsg(m interface{}) error {
+	if s.faults.dropMessage() {
+		return nil
+	}
+	return s.ServerStream.SendMsg(m)
+}
@@ -0,0 +1,44 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	api "github.com/justagabriel/proglog/api/v1"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFaultsDropStreamMessages(t *testing.T) {
+	// arrange
+	faults := &Faults{}
+	testSetup := SetupTest(t, func(c *Config) {
+		c.Faults = faults
+	}, debug)
+	defer testSetup.Teardown()
+	client := testSetup.AuthorizedClient
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for i := 0; i < 3; i++ {
+		_, err := client.Create(ctx, &api.CreateRecordRequest{Record: &api.Record{Value: []byte(fmt.Sprintf("record %d", i))}})
+		require.NoError(t, err)
+	}
+	faults.DropStreamMessages(1)
+
+	// act
+	stream, err := client.ConsumeStream(ctx, &api.GetRecordRequest{})
+	require.NoError(t, err)
+
+	// assert
+	for i := uint64(1); i < 3; i++ {
+		res, err := stream.Recv()
+		require.NoError(t, err)
+		require.Equal(t, i, res.Record.Offset, "the first record was dropped")
+	}
+	_, err = client.Create(ctx, &api.CreateRecordRequest{Record: &api.Record{Value: []byte("record 3")}})
+	require.NoError(t, err)
+	res, err := stream.Recv()
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), res.Record.Offset, "later messages are sent")
+}
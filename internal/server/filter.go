@@ -0,0 +1,33 @@
+package server
+
+import (
+	"bytes"
+
+	api "github.com/justagabriel/proglog/api/v1"
+)
+
+// matches tells whether the record meets the filter's conditions, a nil
+// filter matches every record.
+func matches(filter *api.RecordFilter, record *api.Record) bool {
+	if filter == nil {
+		return true
+	}
+	if !bytes.HasPrefix(record.Key, filter.KeyPrefix) {
+		return false
+	}
+	for _, want := range filter.Headers {
+		if !hasHeader(record, want) {
+			return false
+		}
+	}
+	return true
+}
+
+func hasHeader(record *api.Record, want *api.Header) bool {
+	for _, h := range record.Headers {
+		if h.Key == want.Key && bytes.Equal(h.Value, want.Value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,48 @@
+package server
+
+import (
+	"testing"
+
+	api "github.com/justagabriel/proglog/api/v1"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatches(t *testing.T) {
+	record := &api.Record{
+		Key:     []byte("order-42"),
+		Headers: []*api.Header{{Key: "type", Value: []byte("created")}, {Key: "region", Value: []byte("eu")}},
+	}
+	for scenario, tc := range map[string]struct {
+		filter *api.RecordFilter
+		want   bool
+	}{
+		"without filter":   {filter: nil, want: true},
+		"empty filter":     {filter: &api.RecordFilter{}, want: true},
+		"key prefix":       {filter: &api.RecordFilter{KeyPrefix: []byte("order-")}, want: true},
+		"other key prefix": {filter: &api.RecordFilter{KeyPrefix: []byte("payment-")}, want: false},
+		"headers": {
+			filter: &api.RecordFilter{Headers: []*api.Header{{Key: "region", Value: []byte("eu")}, {Key: "type", Value: []byte("created")}}},
+			want:   true,
+		},
+		"header of other value": {
+			filter: &api.RecordFilter{Headers: []*api.Header{{Key: "type", Value: []byte("deleted")}}},
+			want:   false,
+		},
+		"missing header": {
+			filter: &api.RecordFilter{Headers: []*api.Header{{Key: "tenant", Value: []byte("acme")}}},
+			want:   false,
+		},
+		"all conditions": {
+			filter: &api.RecordFilter{KeyPrefix: []byte("payment-"), Headers: []*api.Header{{Key: "type", Value: []byte("created")}}},
+			want:   false,
+		},
+	} {
+		t.Run(scenario, func(t *testing.T) {
+			// act
+			got := matches(tc.filter, record)
+
+			// assert
+			require.Equal(t, tc.want, got)
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package server
+
+import (
+	"context"
+	"sync"
+
+	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware"
+	api "github.com/justagabriel/proglog/api/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// forwardedKey marks requests forwarded by a follower, which aren't forwarded again.
+const forwardedKey = "proglog-forwarded"
+
+// Forwarder forwards writes which a follower received to the leader, so
+// clients without the proglog load balancer can send them to any server.
+// The leader authorizes the forwarding server's subject, the follower the
+// client's.
+type Forwarder struct {
+	opts  []grpc.DialOption
+	mu    sync.Mutex
+	conns map[string]*grpc.ClientConn
+}
+
+// NewForwarder returns a forwarder dialing leaders with the options, e.g.
+// the credentials of the peer certificate.
+func NewForwarder(opts ...grpc.DialOption) *Forwarder {
+	return &Forwarder{opts: opts, conns: make(map[string]*grpc.ClientConn)}
+}
+
+// conn returns a connection to the leader, connections are kept for reuse.
+func (f *Forwarder) conn(addr string) (*grpc.ClientConn, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	conn, ok := f.conns[addr]
+	if !ok {
+		var err error
+		conn, err = grpc.Dial(addr, f.opts...)
+		if err != nil {
+			return nil, err
+		}
+		f.conns[addr] = conn
+	}
+	return conn, nil
+}
+
+func (f *Forwarder) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var err error
+	for addr, conn := range f.conns {
+		if cerr := conn.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+		delete(f.conns, addr)
+	}
+	return err
+}
+
+// forward returns a client of the leader if the error tells this server isn't
+// the leader and the request may be forwarded, along with the context to call it with.
+func (s *grpcServer) forward(ctx context.Context, err error) (api.LogClient, context.Context, bool) {
+	conn, fctx, ok := s.forwardConn(ctx, err)
+	if !ok {
+		return nil, nil, false
+	}
+	return api.NewLogClient(conn), fctx, true
+}
+
+// forwardAdmin is forward for the Admin service.
+func (s *grpcServer) forwardAdmin(ctx context.Context, err error) (api.AdminClient, context.Context, bool) {
+	conn, fctx, ok := s.forwardConn(ctx, err)
+	if !ok {
+		return nil, nil, false
+	}
+	return api.NewAdminClient(conn), fctx, true
+}
+
+func (s *grpcServer) forwardConn(ctx context.Context, err error) (*grpc.ClientConn, context.Context, bool) {
+	notLeader, ok := err.(api.ErrNotLeader)
+	if !ok || s.Forwarder == nil || notLeader.LeaderAddr == "" {
+		return nil, nil, false
+	}
+	if forwarded(ctx) {
+		return nil, nil, false
+	}
+	conn, cerr := s.Forwarder.conn(notLeader.LeaderAddr)
+	if cerr != nil {
+		return nil, nil, false
+	}
+	return conn, metadata.AppendToOutgoingContext(ctx, forwardedKey, "true"), true
+}
+
+// forwarded tells whether a follower forwarded the request, see trustForwarded.
+func forwarded(ctx context.Context) bool {
+	md, _ := metadata.FromIncomingContext(ctx)
+	return len(md.Get(forwardedKey)) > 0
+}
+
+// trustForwarded removes the forwarded marker from the requests of clients
+// whose certificate isn't one of the peers', see Config.PeerSubjects. Clients
+// setting it themselves would skip the tenant scoping otherwise.
+func trustForwarded(ctx context.Context, authenticator TLSAuthenticator, peers []string) context.Context {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok || len(md.Get(forwardedKey)) == 0 {
+		return ctx
+	}
+	if subject, ok, _ := authenticator.Authenticate(ctx); ok {
+		for _, peer := range peers {
+			if subject == peer {
+				return ctx
+			}
+		}
+	}
+	md = md.Copy()
+	md.Delete(forwardedKey)
+	return metadata.NewIncomingContext(ctx, md)
+}
+
+func trustForwardedUnary(authenticator TLSAuthenticator, peers []string) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		return handler(trustForwarded(ctx, authenticator, peers), req)
+	}
+}
+
+func trustForwardedStream(authenticator TLSAuthenticator, peers []string) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		wrapped := grpc_middleware.WrapServerStream(ss)
+		wrapped.WrappedContext = trustForwarded(ss.Context(), authenticator, peers)
+		return handler(srv, wrapped)
+	}
+}
+
+// peerAuthenticator returns the configured TLSAuthenticator, so peers'
+// subjects are extracted from their certificates like clients' are.
+func peerAuthenticator(authenticators []Authenticator) TLSAuthenticator {
+	for _, a := range authenticators {
+		if tlsAuthenticator, ok := a.(TLSAuthenticator); ok {
+			return tlsAuthenticator
+		}
+	}
+	return TLSAuthenticator{}
+}
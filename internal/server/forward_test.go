@@ -0,0 +1,106 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	api "github.com/justagabriel/proglog/api/v1"
+	"github.com/justagabriel/proglog/internal/config"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+)
+
+// follower fails appends like a follower of the leader at the address.
+type follower struct {
+	CommitLog
+	leaderAddr string
+}
+
+func (f follower) Append(string, *api.Record) (uint64, error) {
+	return 0, api.ErrNotLeader{LeaderAddr: f.leaderAddr, Term: 1}
+}
+
+func (f follower) ReadLeader(string, uint64) (*api.Record, error) {
+	return nil, api.ErrNotLeader{LeaderAddr: f.leaderAddr, Term: 1}
+}
+
+func (f follower) AppendBatch(string, []*api.Record) ([]uint64, error) {
+	return nil, api.ErrNotLeader{LeaderAddr: f.leaderAddr, Term: 1}
+}
+
+func TestServerForward(t *testing.T) {
+	// arrange
+	leader := SetupTest(t, nil, debug)
+	defer leader.Teardown()
+
+	tlsConfig, err := config.SetupTLSConfig(config.TLSConfig{
+		CertFile: config.RootClientCertFile,
+		KeyFile:  config.RootClientKeyFile,
+		CAFile:   config.CAFile,
+	})
+	require.NoError(t, err)
+	forwarder := NewForwarder(grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)))
+	defer forwarder.Close()
+	setup := SetupTest(t, func(c *Config) {
+		c.CommitLog = follower{CommitLog: c.CommitLog, leaderAddr: leader.LogServerAddr}
+		c.BatchAppender = follower{leaderAddr: leader.LogServerAddr}
+		c.LeaderReader = follower{leaderAddr: leader.LogServerAddr}
+		c.Forwarder = forwarder
+	}, debug)
+	defer setup.Teardown()
+	ctx := context.Background()
+
+	// act
+	res, err := setup.AuthorizedClient.Create(ctx, &api.CreateRecordRequest{
+		Record: &api.Record{Value: []byte("hello world")},
+	})
+	require.NoError(t, err)
+	batch, err := setup.AuthorizedClient.CreateBatch(ctx, &api.CreateRecordBatchRequest{
+		Records: []*api.Record{{Value: []byte("first")}, {Value: []byte("second")}},
+	})
+	require.NoError(t, err)
+
+	// assert
+	require.Equal(t, uint64(0), res.Offset)
+	require.Equal(t, []uint64{1, 2}, batch.Offsets)
+	got, err := leader.AuthorizedClient.Get(ctx, &api.GetRecordRequest{Offset: res.Offset})
+	require.NoError(t, err)
+	require.Equal(t, "hello world", string(got.Record.Value))
+
+	// act
+	got, err = setup.AuthorizedClient.Get(ctx, &api.GetRecordRequest{
+		Offset:      res.Offset,
+		Consistency: api.ReadConsistency_READ_CONSISTENCY_LEADER,
+	})
+
+	// assert
+	require.NoError(t, err, "reads of the leader are forwarded as well")
+	require.Equal(t, "hello world", string(got.Record.Value))
+}
+
+func TestServerForwardOnce(t *testing.T) {
+	// arrange
+	forwarder := NewForwarder(grpc.WithTransportCredentials(insecure.NewCredentials()))
+	defer forwarder.Close()
+	setup := SetupTest(t, func(c *Config) {
+		c.CommitLog = follower{CommitLog: c.CommitLog, leaderAddr: "localhost:1"}
+		c.Forwarder = forwarder
+		// the client's certificate is a peer's
+		c.PeerSubjects = []string{"root"}
+	}, debug)
+	defer setup.Teardown()
+	ctx := metadata.AppendToOutgoingContext(context.Background(), forwardedKey, "true")
+
+	// act
+	_, err := setup.AuthorizedClient.Create(ctx, &api.CreateRecordRequest{
+		Record: &api.Record{Value: []byte("hello world")},
+	})
+
+	// assert
+	notLeader, ok := api.NotLeaderFromError(err)
+	require.True(t, ok, "forwarded requests aren't forwarded again")
+	require.Equal(t, "localhost:1", notLeader.LeaderAddr)
+}
@@ -0,0 +1,193 @@
+package server
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"google.golang.org/grpc"
+)
+
+const (
+	grpcWebContentType     = "application/grpc-web"
+	grpcWebTextContentType = "application/grpc-web-text"
+	// grpcWebTrailerFlag marks the frame holding the trailers, see
+	// https://github.com/grpc/grpc/blob/master/doc/PROTOCOL-WEB.md
+	grpcWebTrailerFlag = 0x80
+)
+
+// NewGRPCWebHandler serves the unary and server streaming RPCs of gsrv to
+// gRPC-web clients, e.g. browsers, and passes the other requests to next.
+// Requests are authenticated, authorized and rate limited by gsrv like the
+// ones of gRPC clients.
+//
+// Browsers may call from the origins allowed, "*" allows all of them. Without
+// any only the pages served by the handler's own host may.
+func NewGRPCWebHandler(gsrv *grpc.Server, origins []string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case isGRPCWebPreflight(r):
+			if !setCORSHeaders(w, r, origins) {
+				http.Error(w, "origin not allowed", http.StatusForbidden)
+				return
+			}
+			w.Header().Set("Access-Control-Allow-Methods", http.MethodPost)
+			w.Header().Set("Access-Control-Allow-Headers", r.Header.Get("Access-Control-Request-Headers"))
+			w.Header().Set("Access-Control-Max-Age", "600")
+			w.WriteHeader(http.StatusNoContent)
+		case isGRPCWeb(r):
+			if !setCORSHeaders(w, r, origins) {
+				http.Error(w, "origin not allowed", http.StatusForbidden)
+				return
+			}
+			serveGRPCWeb(gsrv, w, r)
+		default:
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+func isGRPCWeb(r *http.Request) bool {
+	return r.Method == http.MethodPost && strings.HasPrefix(r.Header.Get("Content-Type"), grpcWebContentType)
+}
+
+// isGRPCWebPreflight tells CORS preflights of gRPC-web calls, gRPC-web
+// clients always send the x-grpc-web header.
+func isGRPCWebPreflight(r *http.Request) bool {
+	if r.Method != http.MethodOptions || r.Header.Get("Origin") == "" {
+		return false
+	}
+	for _, h := range strings.Split(r.Header.Get("Access-Control-Request-Headers"), ",") {
+		if strings.EqualFold(strings.TrimSpace(h), "x-grpc-web") {
+			return true
+		}
+	}
+	return false
+}
+
+// setCORSHeaders allows the request's origin to read the response, it
+// returns false if the origin isn't allowed. Requests without an origin
+// don't come from browsers and are always allowed.
+func setCORSHeaders(w http.ResponseWriter, r *http.Request, origins []string) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if !originAllowed(origins, origin, r.Host) {
+		return false
+	}
+	h := w.Header()
+	h.Set("Access-Control-Allow-Origin", origin)
+	h.Add("Vary", "Origin")
+	h.Set("Access-Control-Expose-Headers", "grpc-status, grpc-message, grpc-status-details-bin")
+	return true
+}
+
+// originAllowed tells whether the origin is one of the allowed, or the
+// host's own origin if none are.
+func originAllowed(allowed []string, origin, host string) bool {
+	if len(allowed) == 0 {
+		allowed = []string{(&url.URL{Scheme: "http", Host: host}).String(), (&url.URL{Scheme: "https", Host: host}).String()}
+	}
+	for _, a := range allowed {
+		if a == "*" || a == origin {
+			return true
+		}
+	}
+	return false
+}
+
+// serveGRPCWeb passes the request to gsrv as gRPC request and translates the
+// response, whose trailers are sent as last frame of the body.
+func serveGRPCWeb(gsrv *grpc.Server, w http.ResponseWriter, r *http.Request) {
+	contentType := r.Header.Get("Content-Type")
+	text := strings.HasPrefix(contentType, grpcWebTextContentType)
+
+	req := r.Clone(r.Context())
+	req.ProtoMajor, req.ProtoMinor, req.Proto = 2, 0, "HTTP/2.0"
+	req.Header.Set("Content-Type", "application/grpc"+strings.TrimPrefix(strings.TrimPrefix(contentType, grpcWebTextContentType), grpcWebContentType))
+	req.Header.Del("Content-Length")
+	req.ContentLength = -1
+	if text {
+		req.Body = io.NopCloser(base64.NewDecoder(base64.StdEncoding, r.Body))
+	}
+
+	gw := &grpcWebResponseWriter{w: w, header: make(http.Header), contentType: contentType, text: text}
+	gsrv.ServeHTTP(gw, req)
+	gw.writeTrailers()
+}
+
+// grpcWebResponseWriter lets gsrv write a gRPC-web response, the headers set
+// after the first write are the trailers.
+type grpcWebResponseWriter struct {
+	w           http.ResponseWriter
+	header      http.Header
+	contentType string
+	text        bool
+	code        int
+}
+
+func (gw *grpcWebResponseWriter) Header() http.Header {
+	return gw.header
+}
+
+func (gw *grpcWebResponseWriter) WriteHeader(code int) {
+	if gw.code != 0 {
+		return
+	}
+	gw.code = code
+	h := gw.w.Header()
+	for k, vv := range gw.header {
+		if k == "Trailer" || k == "Content-Type" {
+			continue
+		}
+		h[k] = vv
+	}
+	h.Set("Content-Type", gw.contentType)
+	gw.header = make(http.Header)
+	gw.w.WriteHeader(code)
+}
+
+func (gw *grpcWebResponseWriter) Write(p []byte) (int, error) {
+	gw.WriteHeader(http.StatusOK)
+	if gw.text {
+		if _, err := io.WriteString(gw.w, base64.StdEncoding.EncodeToString(p)); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+	return gw.w.Write(p)
+}
+
+func (gw *grpcWebResponseWriter) Flush() {
+	gw.WriteHeader(http.StatusOK)
+	if f, ok := gw.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// writeTrailers sends the trailers set by gsrv as trailer frame, unless gsrv
+// rejected the request with an HTTP error.
+func (gw *grpcWebResponseWriter) writeTrailers() {
+	if gw.code != http.StatusOK {
+		return
+	}
+	var buf bytes.Buffer
+	for k, vv := range gw.header {
+		k = strings.ToLower(strings.TrimPrefix(k, http.TrailerPrefix))
+		for _, v := range vv {
+			fmt.Fprintf(&buf, "%s: %s\r\n", k, v)
+		}
+	}
+	frame := make([]byte, 5, 5+buf.Len())
+	frame[0] = grpcWebTrailerFlag
+	binary.BigEndian.PutUint32(frame[1:], uint32(buf.Len()))
+	frame = append(frame, buf.Bytes()...)
+	_, _ = gw.Write(frame)
+	gw.Flush()
+}
@@ -0,0 +1,213 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	api "github.com/justagabriel/proglog/api/v1"
+	"github.com/justagabriel/proglog/internal/auth"
+	"github.com/justagabriel/proglog/internal/config"
+	"github.com/justagabriel/proglog/internal/log"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestGRPCWeb(t *testing.T) {
+	scenarios := map[string]func(t *testing.T, srv *httptest.Server, root, nobody *http.Client){
+		"unary calls succeed":               testGRPCWebUnary,
+		"text encoded calls succeed":        testGRPCWebText,
+		"server streams are consumed":       testGRPCWebStream,
+		"unauthorized client is not served": testGRPCWebUnauthorized,
+		"preflights check the origin":       testGRPCWebPreflight,
+	}
+
+	for scenario, fn := range scenarios {
+		t.Run(scenario, func(t *testing.T) {
+			clog, err := log.NewInMemory(log.Config{})
+			require.NoError(t, err)
+			defer clog.Close()
+			authorizer, err := auth.New(config.ACLModelFile, config.ACLPolicyFile)
+			require.NoError(t, err)
+			gsrv, err := NewGRPCServer(&Config{CommitLog: clog, Authorizer: authorizer})
+			require.NoError(t, err)
+
+			srv, root, nobody := startHTTPTest(t, NewGRPCWebHandler(gsrv, nil, http.NotFoundHandler()))
+			defer srv.Close()
+			fn(t, srv, root, nobody)
+		})
+	}
+}
+
+func testGRPCWebUnary(t *testing.T, srv *httptest.Server, root, nobody *http.Client) {
+	// act
+	created := &api.CreateRecordResponse{}
+	createStatus := callGRPCWeb(t, srv, root, "Create", &api.CreateRecordRequest{Record: &api.Record{Value: []byte("hello world")}}, created)
+	got := &api.GetRecordResponse{}
+	getStatus := callGRPCWeb(t, srv, root, "Get", &api.GetRecordRequest{Offset: created.Offset}, got)
+	res, err := root.Get(srv.URL + "/records/0")
+	require.NoError(t, err)
+	res.Body.Close()
+
+	// assert
+	require.Equal(t, "0", createStatus)
+	require.Equal(t, "0", getStatus)
+	require.Equal(t, "hello world", string(got.Record.Value))
+	require.Equal(t, http.StatusNotFound, res.StatusCode, "other requests are passed on")
+}
+
+func testGRPCWebText(t *testing.T, srv *httptest.Server, root, nobody *http.Client) {
+	// arrange
+	req, err := proto.Marshal(&api.CreateRecordRequest{Record: &api.Record{Value: []byte("hello world")}})
+	require.NoError(t, err)
+	body := base64.StdEncoding.EncodeToString(grpcWebFrame(0, req))
+
+	// act
+	res, err := root.Post(srv.URL+"/log.v1.Log/Create", "application/grpc-web-text+proto", strings.NewReader(body))
+	require.NoError(t, err)
+	defer res.Body.Close()
+	encoded, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	// the response may hold several padded base64 strings, 4 characters
+	// always decode on their own
+	var decoded []byte
+	for i := 0; i+4 <= len(encoded); i += 4 {
+		b, err := base64.StdEncoding.DecodeString(string(encoded[i : i+4]))
+		require.NoError(t, err)
+		decoded = append(decoded, b...)
+	}
+	frames := readGRPCWebFrames(t, bytes.NewReader(decoded))
+
+	// assert
+	require.Equal(t, "application/grpc-web-text+proto", res.Header.Get("Content-Type"))
+	require.Len(t, frames, 2)
+	created := &api.CreateRecordResponse{}
+	require.NoError(t, proto.Unmarshal(frames[0], created))
+	require.Equal(t, uint64(0), created.Offset)
+	require.Equal(t, "0", grpcWebStatus(frames[1]))
+}
+
+func testGRPCWebStream(t *testing.T, srv *httptest.Server, root, nobody *http.Client) {
+	// arrange
+	callGRPCWeb(t, srv, root, "Create", &api.CreateRecordRequest{Record: &api.Record{Value: []byte("order 0")}}, &api.CreateRecordResponse{})
+	b, err := proto.Marshal(&api.GetRecordRequest{Offset: 0})
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, srv.URL+"/log.v1.Log/ConsumeStream", bytes.NewReader(grpcWebFrame(0, b)))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/grpc-web+proto")
+
+	// act
+	res, err := root.Do(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	first := &api.GetRecordResponse{}
+	require.NoError(t, proto.Unmarshal(readGRPCWebFrame(t, res.Body), first))
+	callGRPCWeb(t, srv, root, "Create", &api.CreateRecordRequest{Record: &api.Record{Value: []byte("order 1")}}, &api.CreateRecordResponse{})
+	second := &api.GetRecordResponse{}
+	require.NoError(t, proto.Unmarshal(readGRPCWebFrame(t, res.Body), second))
+
+	// assert
+	require.Equal(t, "order 0", string(first.Record.Value))
+	require.Equal(t, "order 1", string(second.Record.Value), "streams tail the topic")
+}
+
+func testGRPCWebUnauthorized(t *testing.T, srv *httptest.Server, root, nobody *http.Client) {
+	// act
+	st := callGRPCWeb(t, srv, nobody, "Create", &api.CreateRecordRequest{Record: &api.Record{Value: []byte("hello world")}}, nil)
+
+	// assert
+	require.Equal(t, strconv.Itoa(int(codes.PermissionDenied)), st)
+}
+
+func testGRPCWebPreflight(t *testing.T, srv *httptest.Server, root, nobody *http.Client) {
+	// arrange
+	preflight := func(origin string) *http.Response {
+		req, err := http.NewRequest(http.MethodOptions, srv.URL+"/log.v1.Log/Create", nil)
+		require.NoError(t, err)
+		req.Header.Set("Origin", origin)
+		req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+		req.Header.Set("Access-Control-Request-Headers", "content-type,x-grpc-web,x-user-agent")
+		res, err := root.Do(req)
+		require.NoError(t, err)
+		res.Body.Close()
+		return res
+	}
+
+	// act
+	own := preflight(srv.URL)
+	foreign := preflight("https://example.com")
+
+	// assert
+	require.Equal(t, http.StatusNoContent, own.StatusCode)
+	require.Equal(t, srv.URL, own.Header.Get("Access-Control-Allow-Origin"))
+	require.Equal(t, "content-type,x-grpc-web,x-user-agent", own.Header.Get("Access-Control-Allow-Headers"))
+	require.Equal(t, http.StatusForbidden, foreign.StatusCode)
+}
+
+// callGRPCWeb calls the Log's method with the request and decodes the
+// response into res, it returns the grpc-status trailer.
+func callGRPCWeb(t *testing.T, srv *httptest.Server, client *http.Client, method string, req, res proto.Message) string {
+	t.Helper()
+	b, err := proto.Marshal(req)
+	require.NoError(t, err)
+	httpRes, err := client.Post(srv.URL+"/log.v1.Log/"+method, "application/grpc-web+proto", bytes.NewReader(grpcWebFrame(0, b)))
+	require.NoError(t, err)
+	defer httpRes.Body.Close()
+	require.Equal(t, http.StatusOK, httpRes.StatusCode)
+
+	frames := readGRPCWebFrames(t, httpRes.Body)
+	require.NotEmpty(t, frames)
+	if len(frames) == 2 {
+		require.NoError(t, proto.Unmarshal(frames[0], res))
+	}
+	return grpcWebStatus(frames[len(frames)-1])
+}
+
+func grpcWebFrame(flag byte, b []byte) []byte {
+	frame := make([]byte, 5, 5+len(b))
+	frame[0] = flag
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(b)))
+	return append(frame, b...)
+}
+
+func readGRPCWebFrame(t *testing.T, r io.Reader) []byte {
+	t.Helper()
+	header := make([]byte, 5)
+	_, err := io.ReadFull(r, header)
+	require.NoError(t, err)
+	b := make([]byte, binary.BigEndian.Uint32(header[1:]))
+	_, err = io.ReadFull(r, b)
+	require.NoError(t, err)
+	return b
+}
+
+func readGRPCWebFrames(t *testing.T, r io.Reader) [][]byte {
+	t.Helper()
+	b, err := io.ReadAll(r)
+	require.NoError(t, err)
+	var frames [][]byte
+	for br := bytes.NewReader(b); br.Len() > 0; {
+		frames = append(frames, readGRPCWebFrame(t, br))
+	}
+	return frames
+}
+
+// grpcWebStatus returns the grpc-status of the trailer frame.
+func grpcWebStatus(trailers []byte) string {
+	for _, line := range strings.Split(string(trailers), "\r\n") {
+		if v, ok := strings.CutPrefix(line, "grpc-status: "); ok {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,353 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	api "github.com/justagabriel/proglog/api/v1"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// maxHTTPBodyBytes caps the size of a JSON request body.
+const maxHTTPBodyBytes = 4 << 20
+
+// idempotencyKeyHeader makes a produce safe to retry, see applyIdempotencyKey.
+const idempotencyKeyHeader = "Idempotency-Key"
+
+// maxIdempotencyKeyBytes caps the length of an Idempotency-Key header.
+const maxIdempotencyKeyBytes = 255
+
+type httpServer struct {
+	srv          *grpcServer
+	authenticate func(ctx context.Context) (context.Context, error)
+	tenants      []TenantResolver
+}
+
+// NewHTTPHandler exposes the log as JSON over HTTP:
+//
+//	POST /records            body: CreateRecordRequest, returns CreateRecordResponse
+//	GET  /records            returns GetRangeResponse, see handleRange
+//	GET  /records/{offset}   returns GetRecordResponse
+//	GET  /ws/...             the WebSocket bridge, see handleWebSocket
+//
+// Both accept a "topic" query parameter. Requests are authenticated, authorized
+// and rate limited like their gRPC counterparts, though rate limits are tracked
+// apart from the ones of the gRPC server. Produces with an Idempotency-Key
+// header return the offset of the record appended first when retried.
+func NewHTTPHandler(config *Config) (http.Handler, error) {
+	srv, err := newGRPCServer(config)
+	if err != nil {
+		return nil, err
+	}
+	authenticators := config.Authenticators
+	if authenticators == nil {
+		authenticators = []Authenticator{TLSAuthenticator{}}
+	}
+	s := &httpServer{
+		srv:          srv,
+		authenticate: authenticator(authenticators),
+		tenants:      config.TenantResolvers,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/records", s.handleRecords)
+	mux.HandleFunc("/records/", s.handleConsume)
+	mux.HandleFunc("/ws/", s.handleWebSocket)
+	return mux, nil
+}
+
+func (s *httpServer) handleRecords(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		s.handleProduce(w, r)
+	case http.MethodGet:
+		s.handleRange(w, r)
+	default:
+		w.Header().Set("Allow", http.MethodGet+", "+http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *httpServer) handleProduce(w http.ResponseWriter, r *http.Request) {
+	ctx, err := s.context(r)
+	if err != nil {
+		writeHTTPError(w, err)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxHTTPBodyBytes))
+	if err != nil {
+		writeHTTPError(w, status.Error(codes.InvalidArgument, err.Error()))
+		return
+	}
+	req := &api.CreateRecordRequest{}
+	if err = protojson.Unmarshal(body, req); err != nil {
+		writeHTTPError(w, status.Error(codes.InvalidArgument, err.Error()))
+		return
+	}
+	if req.Record == nil {
+		writeHTTPError(w, status.Error(codes.InvalidArgument, "record is required"))
+		return
+	}
+	if topic := r.URL.Query().Get("topic"); topic != "" {
+		req.Topic = topic
+	}
+	s.scope(ctx, req)
+	if key := r.Header.Get(idempotencyKeyHeader); key != "" {
+		if err = applyIdempotencyKey(ctx, req.Record, key); err != nil {
+			writeHTTPError(w, err)
+			return
+		}
+	}
+	if s.srv.SchemaValidator != nil {
+		if err = validateRequest(s.srv.SchemaValidator, req); err != nil {
+			writeHTTPError(w, err)
+			return
+		}
+	}
+
+	res, err := s.srv.Create(ctx, req)
+	if err != nil {
+		writeHTTPError(w, err)
+		return
+	}
+	writeHTTPResponse(w, res)
+}
+
+// applyIdempotencyKey maps the key onto the dedupe of idempotent producers:
+// the record becomes the only one of a producer named after the subject and
+// the key, so a retried produce is a duplicate of the record appended first.
+// Keys are remembered per topic like the producers, until they expire.
+func applyIdempotencyKey(ctx context.Context, record *api.Record, key string) error {
+	if len(key) > maxIdempotencyKeyBytes {
+		msg := fmt.Sprintf("%s can't be longer than %d bytes", idempotencyKeyHeader, maxIdempotencyKeyBytes)
+		return status.Error(codes.InvalidArgument, msg)
+	}
+	if record.ProducerId != "" {
+		msg := fmt.Sprintf("%s can't be combined with a producer id", idempotencyKeyHeader)
+		return status.Error(codes.InvalidArgument, msg)
+	}
+	record.ProducerId = api.IdempotencyKeyProducer + Subject(ctx) + "/" + key
+	record.Sequence = 0
+	return nil
+}
+
+func (s *httpServer) handleConsume(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	offset, err := strconv.ParseUint(strings.TrimPrefix(r.URL.Path, "/records/"), 10, 64)
+	if err != nil {
+		writeHTTPError(w, status.Error(codes.InvalidArgument, "offset has to be an unsigned integer"))
+		return
+	}
+	var maxWait uint64
+	if v := r.URL.Query().Get("max_wait_ms"); v != "" {
+		maxWait, err = strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			writeHTTPError(w, status.Error(codes.InvalidArgument, "max_wait_ms has to be an unsigned integer"))
+			return
+		}
+	}
+	req := &api.GetRecordRequest{
+		Topic:     r.URL.Query().Get("topic"),
+		Offset:    offset,
+		MaxWaitMs: uint32(maxWait),
+	}
+	if v := r.URL.Query().Get("required_offset"); v != "" {
+		required, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			writeHTTPError(w, status.Error(codes.InvalidArgument, "required_offset has to be an unsigned integer"))
+			return
+		}
+		req.RequiredOffset = &required
+	}
+	if req.Consistency, err = parseConsistency(r.URL.Query().Get("consistency")); err != nil {
+		writeHTTPError(w, err)
+		return
+	}
+	ctx, err := s.context(r)
+	if err != nil {
+		writeHTTPError(w, err)
+		return
+	}
+
+	s.scope(ctx, req)
+	res, err := s.srv.Get(ctx, req)
+	if err != nil {
+		writeHTTPError(w, err)
+		return
+	}
+	writeHTTPResponse(w, res)
+}
+
+// handleRange reads a range of records, the query parameters are the ones
+// of GetRangeRequest: from_offset, max_records, max_bytes and consistency.
+func (s *httpServer) handleRange(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	req := &api.GetRangeRequest{Topic: query.Get("topic")}
+	var err error
+	if v := query.Get("from_offset"); v != "" {
+		if req.FromOffset, err = strconv.ParseUint(v, 10, 64); err != nil {
+			writeHTTPError(w, status.Error(codes.InvalidArgument, "from_offset has to be an unsigned integer"))
+			return
+		}
+	}
+	for name, field := range map[string]*uint32{"max_records": &req.MaxRecords, "max_bytes": &req.MaxBytes} {
+		v := query.Get(name)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			writeHTTPError(w, status.Errorf(codes.InvalidArgument, "%s has to be an unsigned integer", name))
+			return
+		}
+		*field = uint32(n)
+	}
+	if req.Consistency, err = parseConsistency(query.Get("consistency")); err != nil {
+		writeHTTPError(w, err)
+		return
+	}
+	ctx, err := s.context(r)
+	if err != nil {
+		writeHTTPError(w, err)
+		return
+	}
+
+	s.scope(ctx, req)
+	res, err := s.srv.GetRange(ctx, req)
+	if err != nil {
+		writeHTTPError(w, err)
+		return
+	}
+	writeHTTPResponse(w, res)
+}
+
+func parseConsistency(v string) (api.ReadConsistency, error) {
+	switch v {
+	case "", "replica":
+		return api.ReadConsistency_READ_CONSISTENCY_REPLICA, nil
+	case "leader":
+		return api.ReadConsistency_READ_CONSISTENCY_LEADER, nil
+	}
+	return 0, status.Error(codes.InvalidArgument, `consistency has to be "replica" or "leader"`)
+}
+
+// context carries the request's client certificate, authorization and tenant
+// headers the way gRPC does, so the authenticators and tenant resolvers don't
+// need to know about HTTP.
+func (s *httpServer) context(r *http.Request) (context.Context, error) {
+	p := &peer.Peer{Addr: httpAddr(r.RemoteAddr)}
+	if r.TLS != nil {
+		p.AuthInfo = credentials.TLSInfo{State: *r.TLS}
+	}
+	ctx := peer.NewContext(r.Context(), p)
+	md := metadata.MD{}
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		md.Set("authorization", auth)
+	}
+	if tenant := r.Header.Get(TenantHeader); tenant != "" {
+		md.Set(TenantHeader, tenant)
+	}
+	ctx = metadata.NewIncomingContext(ctx, md)
+	ctx, err := s.authenticate(ctx)
+	if err != nil || len(s.tenants) == 0 {
+		return ctx, err
+	}
+	return resolveTenant(ctx, s.tenants)
+}
+
+// scope prefixes the request's topic with the tenant, like scopeTenants.
+func (s *httpServer) scope(ctx context.Context, req interface{}) {
+	if len(s.tenants) > 0 {
+		scope(Tenant(ctx), req)
+	}
+}
+
+type httpAddr string
+
+func (a httpAddr) Network() string { return "tcp" }
+func (a httpAddr) String() string  { return string(a) }
+
+var _ net.Addr = httpAddr("")
+
+func writeHTTPResponse(w http.ResponseWriter, res proto.Message) {
+	b, err := protojson.Marshal(res)
+	if err != nil {
+		writeHTTPError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(b)
+}
+
+// writeHTTPError writes the status of err as JSON, using the HTTP status code
+// closest to its gRPC code.
+func writeHTTPError(w http.ResponseWriter, err error) {
+	st := status.Convert(err)
+	for _, detail := range st.Details() {
+		if info, ok := detail.(*errdetails.RetryInfo); ok {
+			retryAfter := int(math.Ceil(info.RetryDelay.AsDuration().Seconds()))
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+		}
+	}
+
+	b, err := protojson.Marshal(st.Proto())
+	if err != nil {
+		b = []byte(`{"message":"failed to marshal error"}`)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(httpStatus(st.Code()))
+	_, _ = w.Write(b)
+}
+
+func httpStatus(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return http.StatusOK
+	case codes.Canceled:
+		return 499
+	case codes.InvalidArgument, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.FailedPrecondition:
+		return http.StatusPreconditionFailed
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	default:
+		// ErrOffsetOutOfRange uses the non-standard code 404
+		if int(code) == http.StatusNotFound {
+			return http.StatusNotFound
+		}
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,279 @@
+package server
+
+import (
+	"crypto/tls"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	api "github.com/justagabriel/proglog/api/v1"
+	"github.com/justagabriel/proglog/internal/auth"
+	"github.com/justagabriel/proglog/internal/config"
+	"github.com/justagabriel/proglog/internal/log"
+	"github.com/justagabriel/proglog/internal/schema"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestHTTPServer(t *testing.T) {
+	scenarios := map[string]func(t *testing.T, srv *httptest.Server, root, nobody *http.Client){
+		"produce/consume a record succeeds": testHTTPProduceConsume,
+		"consume past log boundary fails":   testHTTPConsumePastBoundary,
+		"malformed requests are rejected":   testHTTPMalformed,
+		"unauthorized client is not served": testHTTPUnauthorized,
+		"records are produced to the topic": testHTTPTopics,
+		"ranges of records are read":        testHTTPRange,
+		"idempotency keys dedupe produces":  testHTTPIdempotencyKey,
+	}
+
+	for scenario, fn := range scenarios {
+		t.Run(scenario, func(t *testing.T) {
+			srv, root, nobody := setupHTTPTest(t, nil)
+			defer srv.Close()
+			fn(t, srv, root, nobody)
+		})
+	}
+}
+
+func setupHTTPTest(t *testing.T, fn func(*Config)) (*httptest.Server, *http.Client, *http.Client) {
+	t.Helper()
+
+	clog, err := log.NewInMemory(log.Config{})
+	require.NoError(t, err)
+	t.Cleanup(func() { clog.Close() })
+
+	authorizer, err := auth.New(config.ACLModelFile, config.ACLPolicyFile)
+	require.NoError(t, err)
+
+	cfg := &Config{
+		CommitLog:  clog,
+		Authorizer: authorizer,
+	}
+	if fn != nil {
+		fn(cfg)
+	}
+	handler, err := NewHTTPHandler(cfg)
+	require.NoError(t, err)
+	return startHTTPTest(t, handler)
+}
+
+// startHTTPTest serves the handler over TLS and returns clients with the root
+// and nobody certificates.
+func startHTTPTest(t *testing.T, handler http.Handler) (*httptest.Server, *http.Client, *http.Client) {
+	t.Helper()
+
+	serverTLSConfig, err := config.SetupTLSConfig(config.TLSConfig{
+		CertFile: config.ServerCertFile,
+		KeyFile:  config.ServerKeyFile,
+		CAFile:   config.CAFile,
+		Server:   true,
+	})
+	require.NoError(t, err)
+	// StartTLS would add its own certificate, which takes precedence over
+	// GetCertificate for clients connecting by IP address
+	srv := httptest.NewUnstartedServer(handler)
+	srv.Listener = tls.NewListener(srv.Listener, serverTLSConfig)
+	srv.Start()
+	srv.URL = "https://" + srv.Listener.Addr().String()
+
+	newClient := func(crtPath, keyPath string) *http.Client {
+		tlsConfig, err := config.SetupTLSConfig(config.TLSConfig{
+			CertFile: crtPath,
+			KeyFile:  keyPath,
+			CAFile:   config.CAFile,
+		})
+		require.NoError(t, err)
+		return &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+	}
+	return srv,
+		newClient(config.RootClientCertFile, config.RootClientKeyFile),
+		newClient(config.NobodyClientCertFile, config.NobodyClientKeyFile)
+}
+
+func testHTTPProduceConsume(t *testing.T, srv *httptest.Server, root, nobody *http.Client) {
+	// arrange
+	body := `{"record": {"value": "aGVsbG8gd29ybGQ="}}`
+
+	// act
+	res, err := root.Post(srv.URL+"/records", "application/json", strings.NewReader(body))
+	require.NoError(t, err)
+	defer res.Body.Close()
+	created := &api.CreateRecordResponse{}
+	decodeHTTPResponse(t, res, created)
+
+	res, err = root.Get(srv.URL + "/records/0")
+	require.NoError(t, err)
+	defer res.Body.Close()
+	got := &api.GetRecordResponse{}
+	decodeHTTPResponse(t, res, got)
+
+	// assert
+	require.Equal(t, uint64(0), created.Offset)
+	require.Equal(t, "hello world", string(got.Record.Value))
+	require.Equal(t, "application/json", res.Header.Get("Content-Type"))
+}
+
+func testHTTPConsumePastBoundary(t *testing.T, srv *httptest.Server, root, nobody *http.Client) {
+	// act
+	res, err := root.Get(srv.URL + "/records/1")
+	require.NoError(t, err)
+	defer res.Body.Close()
+
+	// assert
+	require.Equal(t, http.StatusNotFound, res.StatusCode)
+}
+
+func testHTTPRange(t *testing.T, srv *httptest.Server, root, nobody *http.Client) {
+	// arrange
+	for _, value := range []string{"first", "second", "third"} {
+		body := `{"record":{"value":"` + base64.StdEncoding.EncodeToString([]byte(value)) + `"}}`
+		res, err := root.Post(srv.URL+"/records", "application/json", strings.NewReader(body))
+		require.NoError(t, err)
+		res.Body.Close()
+		require.Equal(t, http.StatusOK, res.StatusCode)
+	}
+
+	// act
+	res, err := root.Get(srv.URL + "/records?from_offset=1&max_records=5")
+	require.NoError(t, err)
+	defer res.Body.Close()
+
+	// assert
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	b, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	got := &api.GetRangeResponse{}
+	require.NoError(t, protojson.Unmarshal(b, got))
+	require.Len(t, got.Records, 2)
+	require.Equal(t, "second", string(got.Records[0].Value))
+	require.Equal(t, "third", string(got.Records[1].Value))
+	require.Equal(t, uint64(3), got.NextOffset)
+}
+
+func testHTTPIdempotencyKey(t *testing.T, srv *httptest.Server, root, nobody *http.Client) {
+	produce := func(key, body string) *http.Response {
+		req, err := http.NewRequest(http.MethodPost, srv.URL+"/records", strings.NewReader(body))
+		require.NoError(t, err)
+		req.Header.Set("Idempotency-Key", key)
+		res, err := root.Do(req)
+		require.NoError(t, err)
+		return res
+	}
+	offsets := func(keys ...string) []uint64 {
+		var offsets []uint64
+		for _, key := range keys {
+			res := produce(key, `{"record": {"value": "aGVsbG8gd29ybGQ="}}`)
+			created := &api.CreateRecordResponse{}
+			decodeHTTPResponse(t, res, created)
+			res.Body.Close()
+			offsets = append(offsets, created.Offset)
+		}
+		return offsets
+	}
+
+	// act
+	got := offsets("first", "second", "first", "third")
+	long := produce(strings.Repeat("k", 256), `{"record": {}}`)
+	long.Body.Close()
+	withProducer := produce("fourth", `{"record": {"producerId": "producer"}}`)
+	withProducer.Body.Close()
+
+	// assert
+	require.Equal(t, []uint64{0, 1, 0, 2}, got)
+	require.Equal(t, http.StatusBadRequest, long.StatusCode)
+	require.Equal(t, http.StatusBadRequest, withProducer.StatusCode)
+}
+
+func testHTTPMalformed(t *testing.T, srv *httptest.Server, root, nobody *http.Client) {
+	requests := map[string]struct {
+		method, path, body string
+		want               int
+	}{
+		"offset is no number":          {http.MethodGet, "/records/abc", "", http.StatusBadRequest},
+		"body is no json":              {http.MethodPost, "/records", "{", http.StatusBadRequest},
+		"record is missing":            {http.MethodPost, "/records", "{}", http.StatusBadRequest},
+		"method is wrong":              {http.MethodDelete, "/records/0", "", http.StatusMethodNotAllowed},
+		"consistency is unknown":       {http.MethodGet, "/records/0?consistency=strong", "", http.StatusBadRequest},
+		"required offset is no number": {http.MethodGet, "/records/0?required_offset=abc", "", http.StatusBadRequest},
+		"range offset is no number":    {http.MethodGet, "/records?from_offset=abc", "", http.StatusBadRequest},
+		"range limit is no number":     {http.MethodGet, "/records?max_records=-1", "", http.StatusBadRequest},
+		"range method is wrong":        {http.MethodDelete, "/records", "", http.StatusMethodNotAllowed},
+	}
+
+	for name, r := range requests {
+		// arrange
+		req, err := http.NewRequest(r.method, srv.URL+r.path, strings.NewReader(r.body))
+		require.NoError(t, err)
+
+		// act
+		res, err := root.Do(req)
+		require.NoError(t, err)
+		res.Body.Close()
+
+		// assert
+		require.Equal(t, r.want, res.StatusCode, name)
+	}
+}
+
+func testHTTPUnauthorized(t *testing.T, srv *httptest.Server, root, nobody *http.Client) {
+	// act
+	res, err := nobody.Post(srv.URL+"/records", "application/json", strings.NewReader(`{"record": {}}`))
+	require.NoError(t, err)
+	defer res.Body.Close()
+
+	// assert
+	require.Equal(t, http.StatusForbidden, res.StatusCode)
+}
+
+func testHTTPTopics(t *testing.T, srv *httptest.Server, root, nobody *http.Client) {
+	// arrange
+	res, err := root.Post(srv.URL+"/records?topic=orders", "application/json", strings.NewReader(`{"record": {}}`))
+	require.NoError(t, err)
+	res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	// act
+	inDefault, err := root.Get(srv.URL + "/records/0")
+	require.NoError(t, err)
+	inDefault.Body.Close()
+	inTopic, err := root.Get(srv.URL + "/records/0?topic=orders")
+	require.NoError(t, err)
+	inTopic.Body.Close()
+
+	// assert
+	require.Equal(t, http.StatusNotFound, inDefault.StatusCode)
+	require.Equal(t, http.StatusOK, inTopic.StatusCode)
+}
+
+func TestHTTPServerSchemaValidation(t *testing.T) {
+	// arrange
+	orders, err := schema.ParseJSON("order.json", []byte(`{"type": "object", "required": ["id"]}`))
+	require.NoError(t, err)
+	registry := schema.NewRegistry()
+	registry.Register("orders", orders)
+	srv, root, _ := setupHTTPTest(t, func(c *Config) {
+		c.SchemaValidator = registry
+	})
+	defer srv.Close()
+	body := `{"record": {"value": "` + base64.StdEncoding.EncodeToString([]byte(`{"name": "book"}`)) + `"}}`
+
+	// act
+	res, err := root.Post(srv.URL+"/records?topic=orders", "application/json", strings.NewReader(body))
+	require.NoError(t, err)
+	defer res.Body.Close()
+
+	// assert
+	require.Equal(t, http.StatusBadRequest, res.StatusCode)
+}
+
+func decodeHTTPResponse(t *testing.T, res *http.Response, m proto.Message) {
+	t.Helper()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	b, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	require.NoError(t, protojson.Unmarshal(b, m))
+}
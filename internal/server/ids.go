@@ -0,0 +1,23 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"time"
+)
+
+// newRecordID returns a UUIDv7 of the time: 48 bits of its unix milliseconds
+// followed by the version, 74 random bits and the variant, so ids sort by
+// the time they were assigned at, apart from ids of the same millisecond.
+func newRecordID(t time.Time) []byte {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id[6:]); err != nil {
+		panic(err)
+	}
+	var ms [8]byte
+	binary.BigEndian.PutUint64(ms[:], uint64(t.UnixMilli()))
+	copy(id, ms[2:])
+	id[6] = 0x70 | id[6]&0x0f
+	id[8] = 0x80 | id[8]&0x3f
+	return id
+}
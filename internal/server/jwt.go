@@ -0,0 +1,386 @@
+package server
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	grpc_auth "github.com/grpc-ecosystem/go-grpc-middleware/auth"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// minKeyRefetchInterval limits how often tokens signed with unknown keys make
+// the authenticator refetch the keys.
+const minKeyRefetchInterval = time.Minute
+
+// JWTConfig configures a JWTAuthenticator.
+type JWTConfig struct {
+	// JWKSURL serves the keys tokens are signed with. If empty it's discovered
+	// through the issuer's OpenID configuration.
+	JWKSURL string
+	// Issuer has to match the tokens' "iss" claim if set.
+	Issuer string
+	// Audience has to be in the tokens' "aud" claim if set.
+	Audience string
+	// SubjectClaim is the claim used as subject, defaults to "sub".
+	SubjectClaim string
+	// RefreshInterval is how often the keys are refetched, defaults to an hour.
+	RefreshInterval time.Duration
+	// Leeway tolerates clock skew when checking "exp" and "nbf", defaults to a minute.
+	Leeway time.Duration
+}
+
+// JWTAuthenticator uses a claim of bearer tokens signed by an OpenID Connect
+// provider, or anything else publishing its keys as JWKS, as subject.
+// Bearer tokens which aren't JWTs don't apply, so static tokens can be
+// accepted by a TokenAuthenticator after it.
+type JWTAuthenticator struct {
+	config JWTConfig
+	client *http.Client
+	now    func() time.Time
+
+	// fetchMu serializes fetching the keys and guards jwksURL
+	fetchMu sync.Mutex
+	jwksURL string
+
+	mu      sync.RWMutex
+	keys    map[string]crypto.PublicKey
+	fetched time.Time
+}
+
+func NewJWTAuthenticator(config JWTConfig) (*JWTAuthenticator, error) {
+	if config.JWKSURL == "" && config.Issuer == "" {
+		return nil, errors.New("either JWKS URL or issuer required")
+	}
+	if config.SubjectClaim == "" {
+		config.SubjectClaim = "sub"
+	}
+	if config.RefreshInterval == 0 {
+		config.RefreshInterval = time.Hour
+	}
+	if config.Leeway == 0 {
+		config.Leeway = time.Minute
+	}
+	return &JWTAuthenticator{
+		config:  config,
+		client:  &http.Client{Timeout: 10 * time.Second},
+		now:     time.Now,
+		jwksURL: config.JWKSURL,
+	}, nil
+}
+
+func (a *JWTAuthenticator) Authenticate(ctx context.Context) (string, bool, error) {
+	token, err := grpc_auth.AuthFromMD(ctx, "bearer")
+	if err != nil {
+		return "", false, nil
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", false, nil
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err = decodeSegment(parts[0], &header); err != nil || header.Alg == "" {
+		return "", false, nil
+	}
+
+	alg, ok := jwtAlgorithms[header.Alg]
+	if !ok {
+		return "", false, invalidToken("unsupported algorithm %q", header.Alg)
+	}
+	key, err := a.key(ctx, header.Kid)
+	if err != nil {
+		return "", false, err
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", false, invalidToken("malformed signature")
+	}
+	if !alg.verify(key, parts[0]+"."+parts[1], sig) {
+		return "", false, invalidToken("invalid signature")
+	}
+
+	var claims map[string]interface{}
+	if err = decodeSegment(parts[1], &claims); err != nil {
+		return "", false, invalidToken("malformed claims")
+	}
+	if err = a.validate(claims); err != nil {
+		return "", false, err
+	}
+	subject, _ := claims[a.config.SubjectClaim].(string)
+	if subject == "" {
+		return "", false, invalidToken("missing %q claim", a.config.SubjectClaim)
+	}
+	return subject, true, nil
+}
+
+func (a *JWTAuthenticator) validate(claims map[string]interface{}) error {
+	now := a.now()
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return invalidToken("missing \"exp\" claim")
+	}
+	if now.Add(-a.config.Leeway).After(time.Unix(int64(exp), 0)) {
+		return invalidToken("token expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(a.config.Leeway).Before(time.Unix(int64(nbf), 0)) {
+		return invalidToken("token not valid yet")
+	}
+	if a.config.Issuer != "" && claims["iss"] != a.config.Issuer {
+		return invalidToken("unexpected issuer")
+	}
+	if a.config.Audience != "" && !hasAudience(claims["aud"], a.config.Audience) {
+		return invalidToken("unexpected audience")
+	}
+	return nil
+}
+
+// hasAudience checks the "aud" claim, which is either a string or a list of them.
+func hasAudience(aud interface{}, audience string) bool {
+	switch aud := aud.(type) {
+	case string:
+		return aud == audience
+	case []interface{}:
+		for _, a := range aud {
+			if a == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// key returns the key with the given ID, refetching the keys if they're stale
+// or don't contain it.
+func (a *JWTAuthenticator) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	a.mu.RLock()
+	key, ok := a.keys[kid]
+	fetched := a.fetched
+	a.mu.RUnlock()
+	if ok && a.now().Sub(fetched) < a.config.RefreshInterval {
+		return key, nil
+	}
+
+	a.fetchMu.Lock()
+	defer a.fetchMu.Unlock()
+	// the keys may have been refetched while waiting for the lock
+	a.mu.RLock()
+	key, ok = a.keys[kid]
+	fetched = a.fetched
+	a.mu.RUnlock()
+	age := a.now().Sub(fetched)
+	if ok && age < a.config.RefreshInterval {
+		return key, nil
+	}
+	if !ok && age < minKeyRefetchInterval {
+		return nil, invalidToken("unknown key %q", kid)
+	}
+
+	keys, err := a.fetchKeys(ctx)
+	if err != nil {
+		if ok {
+			// keep using the stale keys while the provider is unavailable
+			return key, nil
+		}
+		return nil, status.Errorf(codes.Unavailable, "couldn't fetch token keys: %v", err)
+	}
+	a.mu.Lock()
+	a.keys = keys
+	a.fetched = a.now()
+	a.mu.Unlock()
+
+	if key, ok = keys[kid]; !ok {
+		return nil, invalidToken("unknown key %q", kid)
+	}
+	return key, nil
+}
+
+func (a *JWTAuthenticator) fetchKeys(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	if a.jwksURL == "" {
+		var discovery struct {
+			JWKSURI string `json:"jwks_uri"`
+		}
+		url := strings.TrimSuffix(a.config.Issuer, "/") + "/.well-known/openid-configuration"
+		if err := a.getJSON(ctx, url, &discovery); err != nil {
+			return nil, err
+		}
+		if discovery.JWKSURI == "" {
+			return nil, fmt.Errorf("%s: missing jwks_uri", url)
+		}
+		a.jwksURL = discovery.JWKSURI
+	}
+
+	var jwks struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := a.getJSON(ctx, a.jwksURL, &jwks); err != nil {
+		return nil, err
+	}
+	keys := make(map[string]crypto.PublicKey, len(jwks.Keys))
+	for _, k := range jwks.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		// keys of unknown types are skipped, the provider may publish ones we don't need
+		if key, err := k.publicKey(); err == nil {
+			keys[k.Kid] = key
+		}
+	}
+	return keys, nil
+}
+
+func (a *JWTAuthenticator) getJSON(ctx context.Context, url string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	res, err := a.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: unexpected status %s", url, res.Status)
+	}
+	return json.NewDecoder(res.Body).Decode(v)
+}
+
+// jwk is a JSON Web Key, only the members of RSA and EC public keys are read.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+var jwkCurves = map[string]elliptic.Curve{
+	"P-256": elliptic.P256(),
+	"P-384": elliptic.P384(),
+	"P-521": elliptic.P521(),
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() {
+			return nil, errors.New("RSA exponent too large")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		curve, ok := jwkCurves[k.Crv]
+		if !ok {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("point not on curve")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+type jwtAlgorithm struct {
+	hash  crypto.Hash
+	check func(key crypto.PublicKey, hash crypto.Hash, digest, sig []byte) bool
+}
+
+func (alg jwtAlgorithm) verify(key crypto.PublicKey, signed string, sig []byte) bool {
+	h := alg.hash.New()
+	h.Write([]byte(signed))
+	return alg.check(key, alg.hash, h.Sum(nil), sig)
+}
+
+// jwtAlgorithms are the supported signature algorithms, "none" and the HMAC
+// ones don't make sense with published keys.
+var jwtAlgorithms = map[string]jwtAlgorithm{
+	"RS256": {crypto.SHA256, verifyPKCS1v15},
+	"RS384": {crypto.SHA384, verifyPKCS1v15},
+	"RS512": {crypto.SHA512, verifyPKCS1v15},
+	"PS256": {crypto.SHA256, verifyPSS},
+	"PS384": {crypto.SHA384, verifyPSS},
+	"PS512": {crypto.SHA512, verifyPSS},
+	"ES256": {crypto.SHA256, verifyECDSA(elliptic.P256())},
+	"ES384": {crypto.SHA384, verifyECDSA(elliptic.P384())},
+	"ES512": {crypto.SHA512, verifyECDSA(elliptic.P521())},
+}
+
+func verifyPKCS1v15(key crypto.PublicKey, hash crypto.Hash, digest, sig []byte) bool {
+	pub, ok := key.(*rsa.PublicKey)
+	return ok && rsa.VerifyPKCS1v15(pub, hash, digest, sig) == nil
+}
+
+func verifyPSS(key crypto.PublicKey, hash crypto.Hash, digest, sig []byte) bool {
+	pub, ok := key.(*rsa.PublicKey)
+	opts := &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash}
+	return ok && rsa.VerifyPSS(pub, hash, digest, sig, opts) == nil
+}
+
+// verifyECDSA verifies signatures made of the fixed size r and s values.
+func verifyECDSA(curve elliptic.Curve) func(crypto.PublicKey, crypto.Hash, []byte, []byte) bool {
+	size := (curve.Params().BitSize + 7) / 8
+	return func(key crypto.PublicKey, _ crypto.Hash, digest, sig []byte) bool {
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok || pub.Curve != curve || len(sig) != 2*size {
+			return false
+		}
+		r := new(big.Int).SetBytes(sig[:size])
+		s := new(big.Int).SetBytes(sig[size:])
+		return ecdsa.Verify(pub, digest, r, s)
+	}
+}
+
+func decodeSegment(seg string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+func decodeInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+func invalidToken(format string, args ...interface{}) error {
+	return status.Errorf(codes.Unauthenticated, "invalid bearer token: "+format, args...)
+}
@@ -0,0 +1,263 @@
+package server
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	testIssuer   = "https://idp.example.com"
+	testAudience = "proglog"
+)
+
+// testIdP serves the JWKS of an RSA and an EC key and signs tokens with them.
+type testIdP struct {
+	*httptest.Server
+	rsaKey  *rsa.PrivateKey
+	ecKey   *ecdsa.PrivateKey
+	fetches atomic.Int32
+}
+
+func newTestIdP(t *testing.T) *testIdP {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	idp := &testIdP{rsaKey: rsaKey, ecKey: ecKey}
+
+	b64 := func(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{"jwks_uri": idp.URL + "/keys"})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		idp.fetches.Add(1)
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{
+			{"kty": "RSA", "kid": "rsa", "use": "sig", "n": b64(rsaKey.N.Bytes()), "e": b64(big.NewInt(int64(rsaKey.E)).Bytes())},
+			{"kty": "EC", "kid": "ec", "crv": "P-256", "x": b64(ecKey.X.FillBytes(make([]byte, 32))), "y": b64(ecKey.Y.FillBytes(make([]byte, 32)))},
+			{"kty": "oct", "kid": "secret", "k": "c2VjcmV0"},
+		}})
+	})
+	idp.Server = httptest.NewServer(mux)
+	t.Cleanup(idp.Close)
+	return idp
+}
+
+func (idp *testIdP) sign(t *testing.T, alg, kid string, claims map[string]interface{}) string {
+	header, err := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	require.NoError(t, err)
+	payload, err := json.Marshal(claims)
+	require.NoError(t, err)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := crypto.SHA256.New()
+	digest.Write([]byte(signed))
+
+	var sig []byte
+	switch alg {
+	case "RS256":
+		sig, err = rsa.SignPKCS1v15(rand.Reader, idp.rsaKey, crypto.SHA256, digest.Sum(nil))
+		require.NoError(t, err)
+	case "ES256":
+		r, s, err := ecdsa.Sign(rand.Reader, idp.ecKey, digest.Sum(nil))
+		require.NoError(t, err)
+		sig = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func testClaims(overrides map[string]interface{}) map[string]interface{} {
+	claims := map[string]interface{}{
+		"iss":   testIssuer,
+		"aud":   []string{"other", testAudience},
+		"sub":   "root",
+		"email": "root@example.com",
+		"exp":   time.Now().Add(time.Hour).Unix(),
+	}
+	for k, v := range overrides {
+		if v == nil {
+			delete(claims, k)
+			continue
+		}
+		claims[k] = v
+	}
+	return claims
+}
+
+func TestJWTAuthenticator(t *testing.T) {
+	idp := newTestIdP(t)
+
+	scenarios := map[string]struct {
+		token   func(t *testing.T) string
+		config  func(c *JWTConfig)
+		subject string
+		ok      bool
+		code    codes.Code
+	}{
+		"RS256 token": {
+			token:   func(t *testing.T) string { return idp.sign(t, "RS256", "rsa", testClaims(nil)) },
+			subject: "root",
+			ok:      true,
+		},
+		"ES256 token": {
+			token:   func(t *testing.T) string { return idp.sign(t, "ES256", "ec", testClaims(nil)) },
+			subject: "root",
+			ok:      true,
+		},
+		"custom subject claim": {
+			token:   func(t *testing.T) string { return idp.sign(t, "RS256", "rsa", testClaims(nil)) },
+			config:  func(c *JWTConfig) { c.SubjectClaim = "email" },
+			subject: "root@example.com",
+			ok:      true,
+		},
+		"expired within leeway": {
+			token: func(t *testing.T) string {
+				return idp.sign(t, "RS256", "rsa", testClaims(map[string]interface{}{"exp": time.Now().Add(-time.Second).Unix()}))
+			},
+			subject: "root",
+			ok:      true,
+		},
+		"static token doesn't apply": {
+			token: func(t *testing.T) string { return "secret-token" },
+		},
+		"expired": {
+			token: func(t *testing.T) string {
+				return idp.sign(t, "RS256", "rsa", testClaims(map[string]interface{}{"exp": time.Now().Add(-time.Hour).Unix()}))
+			},
+			code: codes.Unauthenticated,
+		},
+		"missing expiry": {
+			token: func(t *testing.T) string {
+				return idp.sign(t, "RS256", "rsa", testClaims(map[string]interface{}{"exp": nil}))
+			},
+			code: codes.Unauthenticated,
+		},
+		"not valid yet": {
+			token: func(t *testing.T) string {
+				return idp.sign(t, "RS256", "rsa", testClaims(map[string]interface{}{"nbf": time.Now().Add(time.Hour).Unix()}))
+			},
+			code: codes.Unauthenticated,
+		},
+		"other issuer": {
+			token: func(t *testing.T) string {
+				return idp.sign(t, "RS256", "rsa", testClaims(map[string]interface{}{"iss": "https://evil.example.com"}))
+			},
+			code: codes.Unauthenticated,
+		},
+		"other audience": {
+			token: func(t *testing.T) string {
+				return idp.sign(t, "RS256", "rsa", testClaims(map[string]interface{}{"aud": "other"}))
+			},
+			code: codes.Unauthenticated,
+		},
+		"missing subject": {
+			token: func(t *testing.T) string {
+				return idp.sign(t, "RS256", "rsa", testClaims(map[string]interface{}{"sub": nil}))
+			},
+			code: codes.Unauthenticated,
+		},
+		"key of other algorithm": {
+			token: func(t *testing.T) string { return idp.sign(t, "RS256", "ec", testClaims(nil)) },
+			code:  codes.Unauthenticated,
+		},
+		"unknown key": {
+			token: func(t *testing.T) string { return idp.sign(t, "RS256", "rotated", testClaims(nil)) },
+			code:  codes.Unauthenticated,
+		},
+		"unsigned": {
+			token: func(t *testing.T) string { return idp.sign(t, "none", "rsa", testClaims(nil)) },
+			code:  codes.Unauthenticated,
+		},
+		"tampered claims": {
+			token: func(t *testing.T) string {
+				token := strings.Split(idp.sign(t, "RS256", "rsa", testClaims(nil)), ".")
+				admin := strings.Split(idp.sign(t, "RS256", "rsa", testClaims(map[string]interface{}{"sub": "admin"})), ".")
+				return strings.Join([]string{token[0], admin[1], token[2]}, ".")
+			},
+			code: codes.Unauthenticated,
+		},
+	}
+
+	for scenario, sc := range scenarios {
+		t.Run(scenario, func(t *testing.T) {
+			// arrange
+			config := JWTConfig{Issuer: testIssuer, JWKSURL: idp.URL + "/keys", Audience: testAudience}
+			if sc.config != nil {
+				sc.config(&config)
+			}
+			authenticator, err := NewJWTAuthenticator(config)
+			require.NoError(t, err)
+
+			// act
+			subject, ok, err := authenticator.Authenticate(withBearer(context.Background(), sc.token(t)))
+
+			// assert
+			require.Equal(t, sc.code, status.Code(err))
+			require.Equal(t, sc.ok, ok)
+			require.Equal(t, sc.subject, subject)
+		})
+	}
+}
+
+func TestJWTAuthenticatorDiscovery(t *testing.T) {
+	// arrange
+	idp := newTestIdP(t)
+	authenticator, err := NewJWTAuthenticator(JWTConfig{Issuer: idp.URL})
+	require.NoError(t, err)
+	token := idp.sign(t, "ES256", "ec", testClaims(map[string]interface{}{"iss": idp.URL}))
+
+	// act
+	subject, ok, err := authenticator.Authenticate(withBearer(context.Background(), token))
+
+	// assert
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, "root", subject)
+}
+
+func TestJWTAuthenticatorKeyRefresh(t *testing.T) {
+	// arrange
+	idp := newTestIdP(t)
+	authenticator, err := NewJWTAuthenticator(JWTConfig{JWKSURL: idp.URL + "/keys"})
+	require.NoError(t, err)
+	now := time.Now()
+	authenticator.now = func() time.Time { return now }
+	authenticate := func(kid string) error {
+		token := idp.sign(t, "RS256", kid, testClaims(map[string]interface{}{"exp": now.Add(2 * time.Hour).Unix()}))
+		_, _, err := authenticator.Authenticate(withBearer(context.Background(), token))
+		return err
+	}
+
+	// act & assert
+	require.NoError(t, authenticate("rsa"))
+	require.NoError(t, authenticate("rsa"))
+	require.Equal(t, int32(1), idp.fetches.Load(), "keys are cached")
+
+	require.Error(t, authenticate("rotated"))
+	require.Error(t, authenticate("rotated"))
+	require.Equal(t, int32(1), idp.fetches.Load(), "unknown keys don't refetch right away")
+
+	now = now.Add(minKeyRefetchInterval)
+	require.Error(t, authenticate("rotated"))
+	require.Equal(t, int32(2), idp.fetches.Load(), "unknown keys refetch after a while")
+
+	now = now.Add(time.Hour)
+	idp.Close()
+	require.NoError(t, authenticate("rsa"), "stale keys are used while the provider is unavailable")
+}
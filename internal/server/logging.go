@@ -0,0 +1,266 @@
+package server
+
+import (
+	"context"
+	"path"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	grpc_zap "github.com/grpc-ecosystem/go-grpc-middleware/logging/zap"
+	grpc_ctxtags "github.com/grpc-ecosystem/go-grpc-middleware/tags"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// RequestLogConfig controls the request logs, the zero value logs each RPC once it finished.
+type RequestLogConfig struct {
+	// SampleEvery logs every Nth successful unary RPC per method, failed ones
+	// are always logged. Zero and one log all of them.
+	SampleEvery uint64
+	// StreamMessagesEvery logs every Nth message a stream sends besides the
+	// stream's end, e.g. to follow high-volume ConsumeStreams. Zero logs the
+	// streams' ends only.
+	StreamMessagesEvery uint64
+}
+
+// RequestLogger logs RPCs with the peer's identity, the topic and offsets
+// they touched, their payload sizes and latency. Its config can be changed
+// while the server runs, see Config.RequestLogger.
+type RequestLogger struct {
+	mu     sync.Mutex
+	config RequestLogConfig
+	// calls counts the successful unary RPCs per method for sampling
+	calls map[string]uint64
+}
+
+func NewRequestLogger(config RequestLogConfig) *RequestLogger {
+	return &RequestLogger{config: config, calls: make(map[string]uint64)}
+}
+
+// SetConfig replaces the config, it applies to running streams from their next message on.
+func (l *RequestLogger) SetConfig(config RequestLogConfig) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.config = config
+}
+
+func (l *RequestLogger) getConfig() RequestLogConfig {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.config
+}
+
+// sample tells whether the successful unary RPC of the method is logged.
+func (l *RequestLogger) sample(method string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.config.SampleEvery <= 1 {
+		return true
+	}
+	n := l.calls[method]
+	l.calls[method]++
+	return n%l.config.SampleEvery == 0
+}
+
+func (l *RequestLogger) unary() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		code := status.Code(err)
+		if code == codes.OK && !l.sample(info.FullMethod) {
+			return resp, err
+		}
+
+		fields := callFields(ctx, info.FullMethod, start, err)
+		fields = append(fields, zap.Int("grpc.request.bytes", messageSize(req)))
+		fields = append(fields, messageFields("grpc.request", req)...)
+		if err == nil {
+			fields = append(fields, zap.Int("grpc.response.bytes", messageSize(resp)))
+			fields = append(fields, messageFields("grpc.response", resp)...)
+		}
+		logCall(code, "finished unary call with code "+code.String(), fields)
+		return resp, err
+	}
+}
+
+func (l *RequestLogger) stream() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		stream := &loggedStream{ServerStream: ss, logger: l, method: info.FullMethod}
+		err := handler(srv, stream)
+		code := status.Code(err)
+
+		fields := callFields(ss.Context(), info.FullMethod, start, err)
+		fields = append(fields,
+			zap.Int64("grpc.request.messages", stream.received.Load()),
+			zap.Int64("grpc.request.bytes", stream.receivedBytes.Load()),
+			zap.Int64("grpc.response.messages", stream.sent.Load()),
+			zap.Int64("grpc.response.bytes", stream.sentBytes.Load()),
+		)
+		if first, ok := stream.first.Load().(proto.Message); ok {
+			fields = append(fields, messageFields("grpc.request", first)...)
+		}
+		logCall(code, "finished streaming call with code "+code.String(), fields)
+		return err
+	}
+}
+
+// loggedStream counts the messages of a stream and logs the sampled ones it sends.
+type loggedStream struct {
+	grpc.ServerStream
+	logger *RequestLogger
+	method string
+	// first is the first request, e.g. naming the consumed topic
+	first                   atomic.Value
+	received, receivedBytes atomic.Int64
+	sent, sentBytes         atomic.Int64
+}
+
+func (s *loggedStream) RecvMsg(m interface{}) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	if s.received.Add(1) == 1 {
+		if msg, ok := m.(proto.Message); ok {
+			s.first.Store(msg)
+		}
+	}
+	s.receivedBytes.Add(int64(messageSize(m)))
+	return nil
+}
+
+func (s *loggedStream) SendMsg(m interface{}) error {
+	if err := s.ServerStream.SendMsg(m); err != nil {
+		return err
+	}
+	n := s.sent.Add(1)
+	size := messageSize(m)
+	s.sentBytes.Add(int64(size))
+
+	every := s.logger.getConfig().StreamMessagesEvery
+	if every == 0 || uint64(n-1)%every != 0 {
+		return nil
+	}
+	fields := callFields(s.Context(), s.method, time.Time{}, nil)
+	fields = append(fields, zap.Int64("grpc.response.message", n), zap.Int("grpc.response.bytes", size))
+	fields = append(fields, messageFields("grpc.response", m)...)
+	zap.L().Named("server").Info("streamed message", fields...)
+	return nil
+}
+
+// callFields describes the RPC and its peer, a zero start omits the latency.
+// The peer's subject and tenant are tagged by the authentication and
+// tenancy interceptors.
+func callFields(ctx context.Context, fullMethod string, start time.Time, err error) []zap.Field {
+	fields := []zap.Field{
+		zap.String("grpc.service", path.Dir(fullMethod)[1:]),
+		zap.String("grpc.method", path.Base(fullMethod)),
+	}
+	if !start.IsZero() {
+		fields = append(fields,
+			zap.String("grpc.code", status.Code(err).String()),
+			zap.Int64("grpc.time_ns", time.Since(start).Nanoseconds()),
+		)
+	}
+	if err != nil {
+		fields = append(fields, zap.Error(err))
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		fields = append(fields, zap.String("peer.address", p.Addr.String()))
+	}
+	tags := grpc_ctxtags.Extract(ctx).Values()
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fields = append(fields, zap.Any(key, tags[key]))
+	}
+	return fields
+}
+
+func logCall(code codes.Code, msg string, fields []zap.Field) {
+	logger := zap.L().Named("server")
+	switch grpc_zap.DefaultCodeToLevel(code) {
+	case zap.DebugLevel:
+		logger.Debug(msg, fields...)
+	case zap.InfoLevel:
+		logger.Info(msg, fields...)
+	case zap.WarnLevel:
+		logger.Warn(msg, fields...)
+	default:
+		logger.Error(msg, fields...)
+	}
+}
+
+func messageSize(m interface{}) int {
+	if r, ok := m.(*encodedResponse); ok {
+		return len(r.b)
+	}
+	msg, ok := m.(proto.Message)
+	if !ok {
+		return 0
+	}
+	return proto.Size(msg)
+}
+
+// messageFields logs the topic and offsets a request or response names:
+// the offset, the offset of its record or the offsets of a batch.
+func messageFields(prefix string, m interface{}) []zap.Field {
+	if r, ok := m.(*encodedResponse); ok {
+		res, err := r.decode()
+		if err != nil {
+			return nil
+		}
+		m = res
+	}
+	msg, ok := m.(proto.Message)
+	if !ok {
+		return nil
+	}
+	r := msg.ProtoReflect()
+	fields := r.Descriptor().Fields()
+	var zapFields []zap.Field
+	if fd := fields.ByName("topic"); isString(fd) {
+		zapFields = append(zapFields, zap.String(prefix+".topic", topicKey(r.Get(fd).String())))
+	}
+	if fd := fields.ByName("offset"); isUint64(fd) {
+		zapFields = append(zapFields, zap.Uint64(prefix+".offset", r.Get(fd).Uint()))
+	}
+	if fd := fields.ByName("record"); fd != nil && fd.Message() != nil && !fd.IsList() && r.Has(fd) {
+		record := r.Get(fd).Message()
+		if offset := record.Descriptor().Fields().ByName("offset"); isUint64(offset) {
+			zapFields = append(zapFields, zap.Uint64(prefix+".offset", record.Get(offset).Uint()))
+		}
+	}
+	if fd := fields.ByName("records"); fd != nil && fd.IsList() && fd.Message() != nil {
+		if records := r.Get(fd).List(); records.Len() > 0 {
+			record := records.Get(0).Message()
+			if offset := record.Descriptor().Fields().ByName("offset"); isUint64(offset) {
+				zapFields = append(zapFields, zap.Uint64(prefix+".offset", record.Get(offset).Uint()))
+			}
+			zapFields = append(zapFields, zap.Int(prefix+".records", records.Len()))
+		}
+	}
+	if fd := fields.ByName("offsets"); fd != nil && fd.IsList() && fd.Kind() == protoreflect.Uint64Kind {
+		if offsets := r.Get(fd).List(); offsets.Len() > 0 {
+			zapFields = append(zapFields,
+				zap.Uint64(prefix+".offset", offsets.Get(0).Uint()),
+				zap.Int(prefix+".records", offsets.Len()),
+			)
+		}
+	}
+	return zapFields
+}
+
+func isUint64(fd protoreflect.FieldDescriptor) bool {
+	return fd != nil && fd.Kind() == protoreflect.Uint64Kind && !fd.IsList()
+}
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	api "github.com/justagabriel/proglog/api/v1"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestRequestLogger(t *testing.T) {
+	// arrange
+	core, logs := observer.New(zapcore.DebugLevel)
+	defer zap.ReplaceGlobals(zap.New(core))()
+	requestLogger := NewRequestLogger(RequestLogConfig{SampleEvery: 2})
+	testSetup := SetupTest(t, func(c *Config) {
+		c.RequestLogger = requestLogger
+	}, debug)
+	defer testSetup.Teardown()
+	client := testSetup.AuthorizedClient
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// act
+	for _, value := range []string{"first", "second", "third"} {
+		_, err := client.Create(ctx, &api.CreateRecordRequest{Topic: "orders", Record: &api.Record{Value: []byte(value)}})
+		require.NoError(t, err)
+	}
+	_, err := client.Get(ctx, &api.GetRecordRequest{Topic: "orders", Offset: 42})
+	require.Error(t, err)
+	requestLogger.SetConfig(RequestLogConfig{StreamMessagesEvery: 2})
+	stream, err := client.ConsumeStream(ctx, &api.GetRecordRequest{Topic: "orders"})
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		_, err = stream.Recv()
+		require.NoError(t, err)
+	}
+	cancel()
+
+	// assert
+	creates := logs.FilterMessage("finished unary call with code OK").FilterField(zap.String("grpc.method", "Create")).All()
+	require.Len(t, creates, 2, "every second call is logged")
+	fields := creates[1].ContextMap()
+	require.Equal(t, "log.v1.Log", fields["grpc.service"])
+	require.Equal(t, "root", fields["peer.subject"])
+	require.Equal(t, "orders", fields["grpc.request.topic"])
+	require.Equal(t, uint64(2), fields["grpc.response.offset"])
+	require.NotZero(t, fields["grpc.request.bytes"])
+	require.Contains(t, fields, "grpc.time_ns")
+	require.Equal(t, 1, logs.FilterField(zap.String("grpc.method", "Get")).Len(), "failed calls are always logged")
+
+	messages := logs.FilterMessage("streamed message").All()
+	require.Len(t, messages, 2)
+	require.Equal(t, uint64(0), messages[0].ContextMap()["grpc.response.offset"])
+	require.Equal(t, uint64(2), messages[1].ContextMap()["grpc.response.offset"])
+	require.Eventually(t, func() bool {
+		// streams of other tests may end meanwhile
+		ends := logs.FilterMessageSnippet("finished streaming call").FilterField(zap.String("grpc.request.topic", "orders"))
+		return ends.Len() == 1 && ends.All()[0].ContextMap()["grpc.response.messages"] == int64(3)
+	}, time.Second, 10*time.Millisecond)
+}
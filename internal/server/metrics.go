@@ -0,0 +1,236 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"go.opencensus.io/plugin/ocgrpc"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+	"google.golang.org/grpc"
+)
+
+var (
+	topicTag = tag.MustNewKey("topic")
+	// actionTag tells whether the DiskWatermarks throttled or rejected appends
+	actionTag = tag.MustNewKey("action")
+
+	appendedRecords = stats.Int64("proglog/server/appended_records", "Records appended", stats.UnitDimensionless)
+	appendedBytes   = stats.Int64("proglog/server/appended_bytes", "Bytes of the records appended", stats.UnitBytes)
+	readRecords     = stats.Int64("proglog/server/read_records", "Records read", stats.UnitDimensionless)
+	readBytes       = stats.Int64("proglog/server/read_bytes", "Bytes of the records read", stats.UnitBytes)
+	activeStreams   = stats.Int64("proglog/server/active_streams", "Streaming RPCs in progress", stats.UnitDimensionless)
+	diskGuarded     = stats.Int64("proglog/server/disk_guarded_appends", "Appends throttled or rejected by the disk watermarks", stats.UnitDimensionless)
+	slowConsumers   = stats.Int64("proglog/server/slow_consumers", "ConsumeStreams ended for not keeping up", stats.UnitDimensionless)
+)
+
+// Views are the server's views, registered by NewGRPCServer along with
+// ocgrpc.DefaultServerViews, which hold the per RPC latencies.
+var Views = []*view.View{
+	{Measure: appendedRecords, TagKeys: []tag.Key{topicTag}, Aggregation: view.Sum()},
+	{Measure: appendedBytes, TagKeys: []tag.Key{topicTag}, Aggregation: view.Sum()},
+	{Measure: readRecords, TagKeys: []tag.Key{topicTag}, Aggregation: view.Sum()},
+	{Measure: readBytes, TagKeys: []tag.Key{topicTag}, Aggregation: view.Sum()},
+	{Measure: activeStreams, Aggregation: view.LastValue()},
+	{Measure: diskGuarded, TagKeys: []tag.Key{actionTag}, Aggregation: view.Count()},
+	{Measure: slowConsumers, TagKeys: []tag.Key{topicTag}, Aggregation: view.Count()},
+}
+
+func registerViews() error {
+	if err := view.Register(ocgrpc.DefaultServerViews...); err != nil {
+		return err
+	}
+	return view.Register(Views...)
+}
+
+func recordAppend(ctx context.Context, topic string, records, size int) {
+	_ = stats.RecordWithTags(ctx, []tag.Mutator{tag.Upsert(topicTag, topicKey(topic))},
+		appendedRecords.M(int64(records)), appendedBytes.M(int64(size)))
+}
+
+func recordRead(ctx context.Context, topic string, size int) {
+	_ = stats.RecordWithTags(ctx, []tag.Mutator{tag.Upsert(topicTag, topicKey(topic))},
+		readRecords.M(1), readBytes.M(int64(size)))
+}
+
+func recordDiskGuard(ctx context.Context, action string) {
+	_ = stats.RecordWithTags(ctx, []tag.Mutator{tag.Upsert(actionTag, action)}, diskGuarded.M(1))
+}
+
+func recordSlowConsumer(ctx context.Context, topic string) {
+	_ = stats.RecordWithTags(ctx, []tag.Mutator{tag.Upsert(topicTag, topicKey(topic))}, slowConsumers.M(1))
+}
+
+var streams int64
+
+// countStreams records the number of streaming RPCs in progress.
+func countStreams(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	stats.Record(ss.Context(), activeStreams.M(atomic.AddInt64(&streams, 1)))
+	defer func() {
+		stats.Record(ss.Context(), activeStreams.M(atomic.AddInt64(&streams, -1)))
+	}()
+	return handler(srv, ss)
+}
+
+// TopicLister lists the topics whose segments are reported by the MetricsExporter.
+type TopicLister interface {
+	Topics() []string
+}
+
+// MetricsExporter is an OpenCensus exporter serving the latest data of all
+// registered views in the Prometheus text format. If the config has a
+// TopicLister and SegmentStatser it reports the segment count and size of
+// every topic as well, with a DiskUsager the disk usage and its watermarks.
+type MetricsExporter struct {
+	config *Config
+	mu     sync.Mutex
+	data   map[string]*view.Data
+}
+
+func NewMetricsExporter(config *Config) (*MetricsExporter, error) {
+	if err := registerViews(); err != nil {
+		return nil, err
+	}
+	return &MetricsExporter{
+		config: config,
+		data:   make(map[string]*view.Data),
+	}, nil
+}
+
+var _ view.Exporter = (*MetricsExporter)(nil)
+
+func (e *MetricsExporter) ExportView(data *view.Data) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.data[data.View.Name] = data
+}
+
+func (e *MetricsExporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+	e.mu.Lock()
+	names := make([]string, 0, len(e.data))
+	for name := range e.data {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		writeView(w, e.data[name])
+	}
+	e.mu.Unlock()
+
+	if err := e.writeSegments(w); err != nil {
+		fmt.Fprintf(w, "# segments unavailable: %s\n", strings.ReplaceAll(err.Error(), "\n", " "))
+	}
+	e.writeDisk(w)
+}
+
+// writeDisk writes the disk usage along with the watermarks, so alerts can
+// fire before appends get rejected.
+func (e *MetricsExporter) writeDisk(w io.Writer) {
+	if e.config.DiskUsager == nil {
+		return
+	}
+	wm := e.config.DiskWatermarks
+	fmt.Fprintf(w, "# HELP proglog_disk_bytes Bytes the server's data takes up on disk\n# TYPE proglog_disk_bytes gauge\nproglog_disk_bytes %d\n", e.config.DiskUsager.DiskUsage())
+	fmt.Fprintf(w, "# HELP proglog_disk_low_watermark_bytes Disk usage above which appends are throttled, 0 if disabled\n# TYPE proglog_disk_low_watermark_bytes gauge\nproglog_disk_low_watermark_bytes %d\n", wm.Low)
+	fmt.Fprintf(w, "# HELP proglog_disk_high_watermark_bytes Disk usage at which appends are rejected, 0 if disabled\n# TYPE proglog_disk_high_watermark_bytes gauge\nproglog_disk_high_watermark_bytes %d\n", wm.High)
+}
+
+func (e *MetricsExporter) writeSegments(w io.Writer) error {
+	if e.config.TopicLister == nil || e.config.SegmentStatser == nil {
+		return nil
+	}
+	var segments, size strings.Builder
+	for _, topic := range e.config.TopicLister.Topics() {
+		segs, err := e.config.SegmentStatser.SegmentStats(topic)
+		if err != nil {
+			return err
+		}
+		var bytes uint64
+		for _, s := range segs {
+			bytes += s.StoreBytes + s.IndexBytes
+		}
+		labels := fmt.Sprintf(`{topic="%s"}`, labelEscaper.Replace(topic))
+		fmt.Fprintf(&segments, "proglog_log_segments%s %d\n", labels, len(segs))
+		fmt.Fprintf(&size, "proglog_log_bytes%s %d\n", labels, bytes)
+	}
+	fmt.Fprintf(w, "# HELP proglog_log_segments Segments of the topic\n# TYPE proglog_log_segments gauge\n%s", segments.String())
+	fmt.Fprintf(w, "# HELP proglog_log_bytes Bytes of the topic's stores and indexes\n# TYPE proglog_log_bytes gauge\n%s", size.String())
+	return nil
+}
+
+var (
+	invalidMetricChars = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+	labelEscaper       = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+)
+
+// writeView writes the view's rows as one metric, cumulative counts and sums
+// are counters, last values are gauges.
+func writeView(w io.Writer, data *view.Data) {
+	v := data.View
+	name := invalidMetricChars.ReplaceAllString(v.Name, "_")
+	typ := "counter"
+	switch v.Aggregation.Type {
+	case view.AggTypeLastValue:
+		typ = "gauge"
+	case view.AggTypeDistribution:
+		typ = "histogram"
+	}
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, strings.ReplaceAll(v.Description, "\n", " "), name, typ)
+
+	rows := make([]string, 0, len(data.Rows))
+	for _, row := range data.Rows {
+		var labels []string
+		for _, t := range row.Tags {
+			key := invalidMetricChars.ReplaceAllString(t.Key.Name(), "_")
+			labels = append(labels, fmt.Sprintf(`%s="%s"`, key, labelEscaper.Replace(t.Value)))
+		}
+
+		var b strings.Builder
+		switch d := row.Data.(type) {
+		case *view.CountData:
+			fmt.Fprintf(&b, "%s%s %d\n", name, formatLabels(labels), d.Value)
+		case *view.SumData:
+			fmt.Fprintf(&b, "%s%s %g\n", name, formatLabels(labels), d.Value)
+		case *view.LastValueData:
+			fmt.Fprintf(&b, "%s%s %g\n", name, formatLabels(labels), d.Value)
+		case *view.DistributionData:
+			var count int64
+			for i, bound := range v.Aggregation.Buckets {
+				count += d.CountPerBucket[i]
+				le := append(labels[:len(labels):len(labels)], fmt.Sprintf(`le="%g"`, bound))
+				fmt.Fprintf(&b, "%s_bucket%s %d\n", name, formatLabels(le), count)
+			}
+			le := append(labels[:len(labels):len(labels)], `le="+Inf"`)
+			fmt.Fprintf(&b, "%s_bucket%s %d\n", name, formatLabels(le), d.Count)
+			fmt.Fprintf(&b, "%s_sum%s %g\n", name, formatLabels(labels), d.Sum())
+			fmt.Fprintf(&b, "%s_count%s %d\n", name, formatLabels(labels), d.Count)
+		}
+		rows = append(rows, b.String())
+	}
+	sort.Strings(rows)
+	for _, row := range rows {
+		io.WriteString(w, row)
+	}
+}
+
+func formatLabels(labels []string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(labels, ",") + "}"
+}
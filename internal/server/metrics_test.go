@@ -0,0 +1,73 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	api "github.com/justagabriel/proglog/api/v1"
+	"github.com/justagabriel/proglog/internal/log"
+	"github.com/stretchr/testify/require"
+	"go.opencensus.io/stats/view"
+)
+
+type topicNames func() []string
+
+func (f topicNames) Topics() []string {
+	return f()
+}
+
+func TestMetricsExporter(t *testing.T) {
+	// arrange
+	testSetup := SetupTest(t, func(c *Config) {
+		c.TopicLister = topicNames(c.SegmentStatser.(*log.Topics).Names)
+	}, debug)
+	defer testSetup.Teardown()
+	exporter, err := NewMetricsExporter(testSetup.Config)
+	require.NoError(t, err)
+	view.RegisterExporter(exporter)
+	defer view.UnregisterExporter(exporter)
+	view.SetReportingPeriod(10 * time.Millisecond)
+	defer view.SetReportingPeriod(10 * time.Second)
+
+	ctx := context.Background()
+	client := testSetup.AuthorizedClient
+	_, err = client.Create(ctx, &api.CreateRecordRequest{Topic: "metrics", Record: &api.Record{Value: []byte("hello")}})
+	require.NoError(t, err)
+	_, err = client.Get(ctx, &api.GetRecordRequest{Topic: "metrics"})
+	require.NoError(t, err)
+
+	want := []string{
+		"# TYPE proglog_server_appended_records counter",
+		`proglog_server_appended_records{topic="metrics"} 1`,
+		`proglog_server_read_records{topic="metrics"} 1`,
+		"# TYPE grpc_io_server_server_latency histogram",
+		`grpc_io_server_server_latency_count{grpc_server_method="log.v1.Log/Create"}`,
+		"# TYPE proglog_log_segments gauge",
+		`proglog_log_segments{topic="metrics"} 1`,
+	}
+
+	// act
+	var body string
+	scrape := func() bool {
+		res := httptest.NewRecorder()
+		exporter.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		require.Equal(t, http.StatusOK, res.Code)
+		b, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		body = string(b)
+		for _, line := range want {
+			if !strings.Contains(body, line) {
+				return false
+			}
+		}
+		return true
+	}
+
+	// assert
+	require.Eventually(t, scrape, time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,271 @@
+package server
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.opencensus.io/trace"
+	"go.uber.org/zap"
+)
+
+// OTLPConfig configures an OTLPExporter.
+type OTLPConfig struct {
+	// Endpoint receives the spans, e.g. http://localhost:4318/v1/traces.
+	Endpoint string
+	// Resource describes the process, e.g. its "service.name".
+	Resource map[string]string
+	// FlushInterval is how long spans are batched, defaults to 5 seconds.
+	FlushInterval time.Duration
+	// MaxBatchSpans flushes a batch early once it has this many spans, defaults to 512.
+	MaxBatchSpans int
+}
+
+// OTLPExporter is an OpenCensus trace exporter sending spans to an OTLP/HTTP
+// endpoint in the JSON encoding, which OpenTelemetry collectors and Jaeger accept.
+type OTLPExporter struct {
+	config OTLPConfig
+	client *http.Client
+	logger *zap.Logger
+
+	mu    sync.Mutex
+	spans []*trace.SpanData
+	// flushes is signaled if a batch is full
+	flushes chan struct{}
+	done    chan struct{}
+	closed  sync.WaitGroup
+}
+
+func NewOTLPExporter(config OTLPConfig) *OTLPExporter {
+	if config.FlushInterval == 0 {
+		config.FlushInterval = 5 * time.Second
+	}
+	if config.MaxBatchSpans == 0 {
+		config.MaxBatchSpans = 512
+	}
+	e := &OTLPExporter{
+		config:  config,
+		client:  &http.Client{Timeout: 10 * time.Second},
+		logger:  zap.L().Named("otlp"),
+		flushes: make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+	e.closed.Add(1)
+	go e.run()
+	return e
+}
+
+var _ trace.Exporter = (*OTLPExporter)(nil)
+
+func (e *OTLPExporter) ExportSpan(span *trace.SpanData) {
+	e.mu.Lock()
+	e.spans = append(e.spans, span)
+	full := len(e.spans) >= e.config.MaxBatchSpans
+	e.mu.Unlock()
+	if full {
+		select {
+		case e.flushes <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Close sends the spans batched so far and stops the exporter.
+func (e *OTLPExporter) Close() error {
+	close(e.done)
+	e.closed.Wait()
+	return nil
+}
+
+func (e *OTLPExporter) run() {
+	defer e.closed.Done()
+	ticker := time.NewTicker(e.config.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-e.done:
+			e.flush()
+			return
+		case <-ticker.C:
+		case <-e.flushes:
+		}
+		e.flush()
+	}
+}
+
+func (e *OTLPExporter) flush() {
+	e.mu.Lock()
+	spans := e.spans
+	e.spans = nil
+	e.mu.Unlock()
+	if len(spans) == 0 {
+		return
+	}
+	if err := e.send(spans); err != nil {
+		e.logger.Error("failed to export spans", zap.Int("spans", len(spans)), zap.Error(err))
+	}
+}
+
+func (e *OTLPExporter) send(spans []*trace.SpanData) error {
+	body, err := json.Marshal(otlpRequest(e.config.Resource, spans))
+	if err != nil {
+		return err
+	}
+	res, err := e.client.Post(e.config.Endpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode/100 != 2 {
+		return fmt.Errorf("unexpected status %s", res.Status)
+	}
+	return nil
+}
+
+// The types below are the JSON encoding of OTLP's ExportTraceServiceRequest.
+
+type otlpTraces struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Events            []otlpEvent     `json:"events,omitempty"`
+	Status            otlpStatus      `json:"status"`
+}
+
+type otlpEvent struct {
+	TimeUnixNano string          `json:"timeUnixNano"`
+	Name         string          `json:"name"`
+	Attributes   []otlpAttribute `json:"attributes,omitempty"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+const (
+	otlpStatusUnset = 0
+	otlpStatusError = 2
+)
+
+// otlpSpanKinds maps OpenCensus span kinds to OTLP ones.
+var otlpSpanKinds = map[int]int{
+	trace.SpanKindUnspecified: 1, // internal
+	trace.SpanKindServer:      2,
+	trace.SpanKindClient:      3,
+}
+
+func otlpRequest(resource map[string]string, spans []*trace.SpanData) otlpTraces {
+	res := otlpResource{}
+	for k, v := range resource {
+		v := v
+		res.Attributes = append(res.Attributes, otlpAttribute{Key: k, Value: otlpValue{StringValue: &v}})
+	}
+	sort.Slice(res.Attributes, func(i, j int) bool { return res.Attributes[i].Key < res.Attributes[j].Key })
+
+	scope := otlpScopeSpans{Scope: otlpScope{Name: "proglog"}}
+	for _, s := range spans {
+		span := otlpSpan{
+			TraceID:           hex.EncodeToString(s.TraceID[:]),
+			SpanID:            hex.EncodeToString(s.SpanID[:]),
+			Name:              s.Name,
+			Kind:              otlpSpanKinds[s.SpanKind],
+			StartTimeUnixNano: unixNano(s.StartTime),
+			EndTimeUnixNano:   unixNano(s.EndTime),
+			Attributes:        otlpAttributes(s.Attributes),
+			Status:            otlpStatus{Code: otlpStatusUnset},
+		}
+		if s.ParentSpanID != (trace.SpanID{}) {
+			span.ParentSpanID = hex.EncodeToString(s.ParentSpanID[:])
+		}
+		if s.Code != 0 {
+			span.Status = otlpStatus{Code: otlpStatusError, Message: s.Message}
+		}
+		for _, a := range s.Annotations {
+			span.Events = append(span.Events, otlpEvent{
+				TimeUnixNano: unixNano(a.Time),
+				Name:         a.Message,
+				Attributes:   otlpAttributes(a.Attributes),
+			})
+		}
+		scope.Spans = append(scope.Spans, span)
+	}
+
+	return otlpTraces{ResourceSpans: []otlpResourceSpans{{
+		Resource:   res,
+		ScopeSpans: []otlpScopeSpans{scope},
+	}}}
+}
+
+func otlpAttributes(attrs map[string]interface{}) []otlpAttribute {
+	res := make([]otlpAttribute, 0, len(attrs))
+	for k, v := range attrs {
+		var value otlpValue
+		switch v := v.(type) {
+		case string:
+			value.StringValue = &v
+		case bool:
+			value.BoolValue = &v
+		case int64:
+			i := strconv.FormatInt(v, 10)
+			value.IntValue = &i
+		case float64:
+			value.DoubleValue = &v
+		default:
+			s := fmt.Sprint(v)
+			value.StringValue = &s
+		}
+		res = append(res, otlpAttribute{Key: k, Value: value})
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Key < res[j].Key })
+	return res
+}
+
+func unixNano(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
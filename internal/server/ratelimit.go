@@ -0,0 +1,250 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	api "github.com/justagabriel/proglog/api/v1"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// RateLimit caps the throughput of a request class.
+// A zero value for a field disables that particular limit.
+type RateLimit struct {
+	RecordsPerSecond float64
+	BytesPerSecond   float64
+}
+
+// RateLimits holds the limits applied to produce and consume requests of a
+// topic, or of a client in case of Config.ClientRateLimits.
+type RateLimits struct {
+	Produce RateLimit
+	Consume RateLimit
+}
+
+// retryAfterKey is the metadata key carrying the suggested back off in seconds.
+const retryAfterKey = "retry-after"
+
+// bucket is a token bucket which is allowed to go into debt, so that a single
+// request larger than the configured rate is still served once the bucket is full.
+type bucket struct {
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+func newBucket(rate float64) *bucket {
+	return &bucket{rate: rate, tokens: rate, last: time.Now()}
+}
+
+func (b *bucket) refill(now time.Time) {
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	b.tokens = math.Min(b.tokens, b.rate)
+	b.last = now
+}
+
+// wait returns how long it takes until n tokens can be taken from the bucket.
+func (b *bucket) wait(n float64) time.Duration {
+	n = math.Min(n, b.rate)
+	if b.tokens >= n {
+		return 0
+	}
+	return time.Duration((n - b.tokens) / b.rate * float64(time.Second))
+}
+
+type limiter struct {
+	mu      sync.Mutex
+	records *bucket
+	bytes   *bucket
+}
+
+func newLimiter(l RateLimit) *limiter {
+	lim := &limiter{}
+	if l.RecordsPerSecond > 0 {
+		lim.records = newBucket(l.RecordsPerSecond)
+	}
+	if l.BytesPerSecond > 0 {
+		lim.bytes = newBucket(l.BytesPerSecond)
+	}
+	return lim
+}
+
+// take consumes the given amount of records and bytes. If the limiter is in
+// debt nothing is consumed and the time to wait before retrying is returned.
+func (l *limiter) take(records, bytes int) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	var wait time.Duration
+	buckets := []struct {
+		*bucket
+		n int
+	}{{l.records, records}, {l.bytes, bytes}}
+	for _, b := range buckets {
+		if b.bucket == nil {
+			continue
+		}
+		b.refill(now)
+		if w := b.wait(float64(b.n)); w > wait {
+			wait = w
+		}
+	}
+	if wait > 0 {
+		return wait
+	}
+
+	l.charge(records, bytes)
+	return 0
+}
+
+// charge consumes the given amount of records and bytes unconditionally.
+func (l *limiter) charge(records, bytes int) {
+	if l.records != nil {
+		l.records.tokens -= float64(records)
+	}
+	if l.bytes != nil {
+		l.bytes.tokens -= float64(bytes)
+	}
+}
+
+// RateLimiter tracks the produce and consume limiters of each topic or
+// client. Its limits can be changed while the server runs, see Config.RateLimiter.
+type RateLimiter struct {
+	mu       sync.Mutex
+	limits   RateLimits
+	produces map[string]*limiter
+	consumes map[string]*limiter
+}
+
+func NewRateLimiter(limits RateLimits) *RateLimiter {
+	return &RateLimiter{
+		limits:   limits,
+		produces: make(map[string]*limiter),
+		consumes: make(map[string]*limiter),
+	}
+}
+
+// SetLimits replaces the limits, the buckets of all topics or clients start over full.
+func (r *RateLimiter) SetLimits(limits RateLimits) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.limits = limits
+	r.produces = make(map[string]*limiter)
+	r.consumes = make(map[string]*limiter)
+}
+
+func (r *RateLimiter) limiter(key string, produce bool) *limiter {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	limiters, limit := r.consumes, r.limits.Consume
+	if produce {
+		limiters, limit = r.produces, r.limits.Produce
+	}
+	if limit == (RateLimit{}) {
+		return nil
+	}
+
+	l, ok := limiters[key]
+	if !ok {
+		l = newLimiter(limit)
+		limiters[key] = l
+	}
+	return l
+}
+
+// allowProduce checks whether the given amount of records of the given total size may be appended to the topic.
+func (r *RateLimiter) allowProduce(ctx context.Context, topic string, records, size int) error {
+	l := r.limiter(topic, true)
+	if l == nil {
+		return nil
+	}
+	return rateLimited(ctx, "produce", l.take(records, size))
+}
+
+// allowConsume checks whether the given amount of records may be read from the topic.
+func (r *RateLimiter) allowConsume(ctx context.Context, topic string, records int) error {
+	l := r.limiter(topic, false)
+	if l == nil {
+		return nil
+	}
+	return rateLimited(ctx, "consume", l.take(records, 0))
+}
+
+// consumed charges the bytes of a record which has been read from the topic.
+func (r *RateLimiter) consumed(topic string, size int) {
+	l := r.limiter(topic, false)
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.charge(0, size)
+}
+
+// consumedRecords charges the records and their bytes read from the topic by
+// requests which checked allowConsume before knowing their count.
+func (r *RateLimiter) consumedRecords(topic string, records, size int) {
+	l := r.limiter(topic, false)
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.charge(records, size)
+}
+
+// limitClients applies the client rate limits to Create and Get requests,
+// keyed by the authenticated subject.
+func limitClients(r *RateLimiter) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		var err error
+		switch req := req.(type) {
+		case *api.CreateRecordRequest:
+			err = r.allowProduce(ctx, subject(ctx), 1, proto.Size(req.Record))
+		case *api.GetRecordRequest:
+			err = r.allowConsume(ctx, subject(ctx), 1)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		res, err := handler(ctx, req)
+		if res, ok := res.(*api.GetRecordResponse); ok && err == nil {
+			r.consumed(subject(ctx), proto.Size(res.Record))
+		}
+		return res, err
+	}
+}
+
+func rateLimited(ctx context.Context, action string, wait time.Duration) error {
+	if wait == 0 {
+		return nil
+	}
+
+	retryAfter := int(math.Ceil(wait.Seconds()))
+	// the header can't be set anymore once a stream sent its first message,
+	// the retry info detail carries the same information in that case
+	_ = grpc.SetHeader(ctx, metadata.Pairs(retryAfterKey, strconv.Itoa(retryAfter)))
+
+	msg := fmt.Sprintf("%s rate limit exceeded, retry in %s", action, wait)
+	st := status.New(codes.ResourceExhausted, msg)
+	std, err := st.WithDetails(&errdetails.RetryInfo{
+		RetryDelay: durationpb.New(wait),
+	})
+	if err != nil {
+		return st.Err()
+	}
+	return std.Err()
+}
@@ -0,0 +1,80 @@
+package server
+
+import (
+	"context"
+
+	api "github.com/justagabriel/proglog/api/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// ReadOnlier keeps the read-only mode of the cluster, see
+// log.DistributedLog.SetReadOnly.
+type ReadOnlier interface {
+	SetReadOnly(mode *api.ReadOnlyMode) error
+	ReadOnly() *api.ReadOnlyMode
+}
+
+// checkWritable rejects appends while the server or its cluster is read-only.
+func (s *grpcServer) checkWritable() error {
+	if mode := s.readOnly.Load(); mode != nil && mode.Enabled {
+		return api.ErrReadOnly{Reason: mode.Reason}
+	}
+	if s.ReadOnlier != nil {
+		if mode := s.ReadOnlier.ReadOnly(); mode.GetEnabled() {
+			return api.ErrReadOnly{Cluster: true, Reason: mode.Reason}
+		}
+	}
+	return nil
+}
+
+// SetReadOnly sets the read-only mode of this server, or with cluster that of
+// all servers, followers forward the latter to the leader.
+func (s *grpcServer) SetReadOnly(ctx context.Context, req *api.SetReadOnlyRequest) (*api.SetReadOnlyResponse, error) {
+	if !req.Cluster {
+		err := s.Authorizer.Authorize(subject(ctx), configObject, adminAction)
+		if err != nil {
+			return nil, err
+		}
+		mode := &api.ReadOnlyMode{}
+		if req.Mode != nil {
+			mode = proto.Clone(req.Mode).(*api.ReadOnlyMode)
+		}
+		s.readOnly.Store(mode)
+		return &api.SetReadOnlyResponse{}, nil
+	}
+
+	if s.ReadOnlier == nil {
+		return nil, status.Error(codes.Unimplemented, "cluster-wide read-only mode is not supported")
+	}
+	err := s.Authorizer.Authorize(subject(ctx), clusterObject, adminAction)
+	if err != nil {
+		return nil, err
+	}
+	err = s.ReadOnlier.SetReadOnly(req.Mode)
+	if leader, fctx, ok := s.forwardAdmin(ctx, err); ok {
+		return leader.SetReadOnly(fctx, req)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &api.SetReadOnlyResponse{}, nil
+}
+
+// GetReadOnly reports the read-only mode of this server and of its cluster,
+// the latter is left nil without a ReadOnlier.
+func (s *grpcServer) GetReadOnly(ctx context.Context, req *api.GetReadOnlyRequest) (*api.GetReadOnlyResponse, error) {
+	err := s.Authorizer.Authorize(subject(ctx), configObject, adminAction)
+	if err != nil {
+		return nil, err
+	}
+	res := &api.GetReadOnlyResponse{Node: s.readOnly.Load()}
+	if res.Node == nil {
+		res.Node = &api.ReadOnlyMode{}
+	}
+	if s.ReadOnlier != nil {
+		res.Cluster = s.ReadOnlier.ReadOnly()
+	}
+	return res, nil
+}
@@ -0,0 +1,109 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	api "github.com/justagabriel/proglog/api/v1"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// clusterMode keeps the cluster's read-only mode in memory.
+type clusterMode struct {
+	mode *api.ReadOnlyMode
+}
+
+func (c *clusterMode) SetReadOnly(mode *api.ReadOnlyMode) error {
+	c.mode = mode
+	return nil
+}
+
+func (c *clusterMode) ReadOnly() *api.ReadOnlyMode {
+	return c.mode
+}
+
+func TestServerReadOnly(t *testing.T) {
+	scenarios := map[string]struct {
+		cluster bool
+		want    api.ErrReadOnly
+	}{
+		"server":  {want: api.ErrReadOnly{Reason: "maintenance"}},
+		"cluster": {cluster: true, want: api.ErrReadOnly{Cluster: true, Reason: "maintenance"}},
+	}
+
+	for scenario, s := range scenarios {
+		t.Run(scenario, func(t *testing.T) {
+			// arrange
+			testSetup := SetupTest(t, func(c *Config) {
+				c.ReadOnlier = &clusterMode{}
+			}, debug)
+			defer testSetup.Teardown()
+			client := testSetup.AuthorizedClient
+			admin := testSetup.AuthorizedAdminClient
+			ctx := context.Background()
+			record := &api.Record{Value: []byte("hello world")}
+			_, err := client.Create(ctx, &api.CreateRecordRequest{Record: record})
+			require.NoError(t, err)
+
+			// act
+			_, err = admin.SetReadOnly(ctx, &api.SetReadOnlyRequest{
+				Mode:    &api.ReadOnlyMode{Enabled: true, Reason: "maintenance"},
+				Cluster: s.cluster,
+			})
+			require.NoError(t, err)
+			_, createErr := client.Create(ctx, &api.CreateRecordRequest{Record: record})
+			_, batchErr := client.CreateBatch(ctx, &api.CreateRecordBatchRequest{Records: []*api.Record{record}})
+			_, transactionErr := client.CreateTransaction(ctx, &api.CreateTransactionRequest{
+				Appends: []*api.TopicRecords{{Topic: "orders", Records: []*api.Record{record}}},
+			})
+			res, getErr := client.Get(ctx, &api.GetRecordRequest{Offset: 0})
+			mode, err := admin.GetReadOnly(ctx, &api.GetReadOnlyRequest{})
+			require.NoError(t, err)
+
+			// assert
+			for _, err := range []error{createErr, batchErr, transactionErr} {
+				require.Equal(t, codes.FailedPrecondition, status.Code(err))
+				require.Equal(t, s.want, api.FromError(err))
+			}
+			require.NoError(t, getErr, "reads are still served")
+			require.Equal(t, record.Value, res.Record.Value)
+			require.Equal(t, !s.cluster, mode.Node.Enabled)
+			require.Equal(t, s.cluster, mode.Cluster.GetEnabled())
+			_, err = admin.SetReadOnly(ctx, &api.SetReadOnlyRequest{Cluster: s.cluster})
+			require.NoError(t, err)
+			_, err = client.Create(ctx, &api.CreateRecordRequest{Record: record})
+			require.NoError(t, err, "disabling the mode accepts appends again")
+		})
+	}
+}
+
+func TestServerReadOnlyAuthorization(t *testing.T) {
+	scenarios := map[string]struct {
+		fn      func(*Config)
+		cluster bool
+		code    codes.Code
+	}{
+		"admin action is required":       {code: codes.PermissionDenied},
+		"admin action on the cluster":    {fn: func(c *Config) { c.ReadOnlier = &clusterMode{} }, cluster: true, code: codes.PermissionDenied},
+		"unimplemented without readonly": {cluster: true, code: codes.Unimplemented},
+	}
+
+	for scenario, s := range scenarios {
+		t.Run(scenario, func(t *testing.T) {
+			// arrange
+			testSetup := SetupTest(t, s.fn, debug)
+			defer testSetup.Teardown()
+
+			// act
+			_, err := testSetup.UnauthorizedAdminClient.SetReadOnly(context.Background(), &api.SetReadOnlyRequest{
+				Mode:    &api.ReadOnlyMode{Enabled: true},
+				Cluster: s.cluster,
+			})
+
+			// assert
+			require.Equal(t, s.code, status.Code(err))
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	api "github.com/justagabriel/proglog/api/v1"
+	"github.com/justagabriel/proglog/internal/config"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/grpc/status"
+)
+
+func TestServerReflection(t *testing.T) {
+	scenarios := map[string]struct {
+		enabled bool
+		code    codes.Code
+	}{
+		"services are listed once enabled":  {enabled: true, code: codes.OK},
+		"reflection is disabled by default": {enabled: false, code: codes.Unimplemented},
+	}
+
+	for scenario, s := range scenarios {
+		t.Run(scenario, func(t *testing.T) {
+			// arrange
+			setup := SetupTest(t, func(c *Config) {
+				c.Reflection = s.enabled
+			}, debug)
+			defer setup.Teardown()
+			tlsConfig, err := config.SetupTLSConfig(config.TLSConfig{
+				CertFile: config.RootClientCertFile,
+				KeyFile:  config.RootClientKeyFile,
+				CAFile:   config.CAFile,
+			})
+			require.NoError(t, err)
+			cc, err := grpc.Dial(setup.LogServerAddr, grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)))
+			require.NoError(t, err)
+			defer cc.Close()
+
+			// act
+			stream, err := reflectionpb.NewServerReflectionClient(cc).ServerReflectionInfo(context.Background())
+			require.NoError(t, err)
+			err = stream.Send(&reflectionpb.ServerReflectionRequest{
+				MessageRequest: &reflectionpb.ServerReflectionRequest_ListServices{},
+			})
+			require.NoError(t, err)
+			res, err := stream.Recv()
+
+			// assert
+			require.Equal(t, s.code, status.Code(err))
+			if !s.enabled {
+				return
+			}
+			var services []string
+			for _, service := range res.GetListServicesResponse().Service {
+				services = append(services, service.Name)
+			}
+			require.Contains(t, services, api.Log_ServiceDesc.ServiceName)
+			require.Contains(t, services, api.Admin_ServiceDesc.ServiceName)
+
+			// act
+			err = stream.Send(&reflectionpb.ServerReflectionRequest{
+				MessageRequest: &reflectionpb.ServerReflectionRequest_FileContainingSymbol{
+					FileContainingSymbol: api.Log_ServiceDesc.ServiceName,
+				},
+			})
+			require.NoError(t, err)
+			res, err = stream.Recv()
+
+			// assert
+			require.NoError(t, err)
+			require.NotEmpty(t, res.GetFileDescriptorResponse().GetFileDescriptorProto(), "the descriptors of the services' messages are served")
+		})
+	}
+}
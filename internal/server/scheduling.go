@@ -0,0 +1,180 @@
+package server
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"sync"
+)
+
+// Scheduling bounds the appends and reads in progress, so under load
+// producers and consumers wait in line instead of piling up goroutines
+// competing for the log. A zero value for a field disables that particular
+// limit, the zero value schedules nothing.
+type Scheduling struct {
+	// MaxProduce caps the appends in progress: those of Create, CreateBatch,
+	// CreateTransaction and each record of CreateStream.
+	MaxProduce int
+	// MaxConsume caps the reads in progress: those of Get, GetMany and each
+	// record of ConsumeStream.
+	MaxConsume int
+	// MaxInFlight caps the appends and reads in progress together.
+	MaxInFlight int
+	// Priority decides which waiting operation is admitted next. Capping the
+	// prioritized class below MaxInFlight keeps the other from starving.
+	Priority Priority
+}
+
+// Priority tells which operations Scheduling admits first.
+type Priority int
+
+const (
+	// NoPriority admits operations in the order they arrived.
+	NoPriority Priority = iota
+	// ProducePriority admits waiting appends before waiting reads.
+	ProducePriority
+	// ConsumePriority admits waiting reads before waiting appends.
+	ConsumePriority
+)
+
+// ParsePriority parses "none", "produce" or "consume", empty means none.
+func ParsePriority(s string) (Priority, error) {
+	switch s {
+	case "", "none":
+		return NoPriority, nil
+	case "produce":
+		return ProducePriority, nil
+	case "consume":
+		return ConsumePriority, nil
+	}
+	return 0, fmt.Errorf("unknown priority %q", s)
+}
+
+// class is the kind of an operation scheduled.
+type class int
+
+const (
+	produceClass class = iota
+	consumeClass
+)
+
+// waiter is an operation waiting to be admitted, ready is closed once it is.
+type waiter struct {
+	seq      uint64
+	ready    chan struct{}
+	admitted bool
+}
+
+// scheduler admits operations according to Scheduling, a nil scheduler
+// admits all of them right away.
+type scheduler struct {
+	mu      sync.Mutex
+	config  Scheduling
+	running [2]int
+	total   int
+	waiting [2]*list.List
+	seq     uint64
+}
+
+func newScheduler(config Scheduling) *scheduler {
+	if config.MaxProduce == 0 && config.MaxConsume == 0 && config.MaxInFlight == 0 {
+		return nil
+	}
+	return &scheduler{
+		config:  config,
+		waiting: [2]*list.List{list.New(), list.New()},
+	}
+}
+
+// acquire waits until the operation is admitted or ctx is done, release has
+// to be called once an admitted operation finished.
+func (s *scheduler) acquire(ctx context.Context, c class) error {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	s.seq++
+	w := &waiter{seq: s.seq, ready: make(chan struct{})}
+	e := s.waiting[c].PushBack(w)
+	s.dispatch()
+	s.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		return nil
+	case <-ctx.Done():
+	}
+	s.mu.Lock()
+	if w.admitted {
+		s.mu.Unlock()
+		s.release(c)
+	} else {
+		s.waiting[c].Remove(e)
+		s.mu.Unlock()
+	}
+	return contextError(ctx.Err())
+}
+
+func (s *scheduler) release(c class) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.running[c]--
+	s.total--
+	s.dispatch()
+}
+
+// dispatch admits the waiting operations the limits allow, s.mu has to be held.
+func (s *scheduler) dispatch() {
+	for {
+		c, ok := s.next()
+		if !ok {
+			return
+		}
+		w := s.waiting[c].Remove(s.waiting[c].Front()).(*waiter)
+		w.admitted = true
+		close(w.ready)
+		s.running[c]++
+		s.total++
+	}
+}
+
+// next returns the class of the operation to admit next, false if there is
+// none or the limits don't allow it.
+func (s *scheduler) next() (class, bool) {
+	if s.config.MaxInFlight > 0 && s.total >= s.config.MaxInFlight {
+		return 0, false
+	}
+	produce, consume := s.admissible(produceClass), s.admissible(consumeClass)
+	switch {
+	case produce && consume:
+	case produce:
+		return produceClass, true
+	case consume:
+		return consumeClass, true
+	default:
+		return 0, false
+	}
+	switch s.config.Priority {
+	case ProducePriority:
+		return produceClass, true
+	case ConsumePriority:
+		return consumeClass, true
+	}
+	if s.waiting[produceClass].Front().Value.(*waiter).seq < s.waiting[consumeClass].Front().Value.(*waiter).seq {
+		return produceClass, true
+	}
+	return consumeClass, true
+}
+
+// admissible tells whether an operation of the class waits and its class's
+// limit allows admitting it.
+func (s *scheduler) admissible(c class) bool {
+	max := s.config.MaxProduce
+	if c == consumeClass {
+		max = s.config.MaxConsume
+	}
+	return s.waiting[c].Len() > 0 && (max == 0 || s.running[c] < max)
+}
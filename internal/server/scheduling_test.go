@@ -0,0 +1,150 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	api "github.com/justagabriel/proglog/api/v1"
+	"github.com/justagabriel/proglog/internal/log"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestScheduler(t *testing.T) {
+	scenarios := map[string]func(t *testing.T){
+		"class limits hold up their class only": testSchedulerClassLimits,
+		"priority admits its class first":       testSchedulerPriority,
+		"without priority arrival order counts": testSchedulerArrivalOrder,
+		"cancelled operations leave the line":   testSchedulerCancel,
+	}
+
+	for scenario, fn := range scenarios {
+		t.Run(scenario, fn)
+	}
+}
+
+func testSchedulerClassLimits(t *testing.T) {
+	// arrange
+	s := newScheduler(Scheduling{MaxProduce: 1})
+	require.NoError(t, s.acquire(context.Background(), produceClass))
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	// act
+	produceErr := s.acquire(ctx, produceClass)
+	consumeErr := s.acquire(context.Background(), consumeClass)
+
+	// assert
+	require.Equal(t, codes.DeadlineExceeded, status.Code(produceErr))
+	require.NoError(t, consumeErr)
+}
+
+func testSchedulerPriority(t *testing.T) {
+	// arrange
+	s := newScheduler(Scheduling{MaxInFlight: 1, Priority: ConsumePriority})
+	require.NoError(t, s.acquire(context.Background(), produceClass))
+	admitted := queue(t, s, produceClass, consumeClass)
+
+	// act
+	s.release(produceClass)
+
+	// assert
+	require.Equal(t, consumeClass, <-admitted)
+	s.release(consumeClass)
+	require.Equal(t, produceClass, <-admitted)
+}
+
+func testSchedulerArrivalOrder(t *testing.T) {
+	// arrange
+	s := newScheduler(Scheduling{MaxInFlight: 1})
+	require.NoError(t, s.acquire(context.Background(), produceClass))
+	admitted := queue(t, s, produceClass, consumeClass)
+
+	// act
+	s.release(produceClass)
+
+	// assert
+	require.Equal(t, produceClass, <-admitted)
+	s.release(produceClass)
+	require.Equal(t, consumeClass, <-admitted)
+}
+
+func testSchedulerCancel(t *testing.T) {
+	// arrange
+	s := newScheduler(Scheduling{MaxInFlight: 1})
+	require.NoError(t, s.acquire(context.Background(), produceClass))
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error)
+	go func() { errc <- s.acquire(ctx, consumeClass) }()
+	waitQueued(t, s, 1)
+
+	// act
+	cancel()
+
+	// assert
+	require.Equal(t, codes.Canceled, status.Code(<-errc))
+	waitQueued(t, s, 0)
+	s.release(produceClass)
+	require.NoError(t, s.acquire(context.Background(), produceClass))
+}
+
+// queue lets operations of the classes wait in line in order, their classes
+// are sent once they're admitted.
+func queue(t *testing.T, s *scheduler, classes ...class) <-chan class {
+	admitted := make(chan class, len(classes))
+	for i, c := range classes {
+		go func(c class) {
+			require.NoError(t, s.acquire(context.Background(), c))
+			admitted <- c
+		}(c)
+		waitQueued(t, s, i+1)
+	}
+	return admitted
+}
+
+func waitQueued(t *testing.T, s *scheduler, n int) {
+	require.Eventually(t, func() bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return s.waiting[produceClass].Len()+s.waiting[consumeClass].Len() == n
+	}, time.Second, time.Millisecond)
+}
+
+func TestServerScheduling(t *testing.T) {
+	// arrange
+	faults := &log.Faults{}
+	clog, err := log.NewInMemory(log.Config{Faults: faults})
+	require.NoError(t, err)
+	defer clog.Remove()
+	testSetup := SetupTest(t, func(c *Config) {
+		c.CommitLog = clog
+		c.Scheduling.MaxProduce = 1
+	}, debug)
+	defer testSetup.Teardown()
+	client := testSetup.AuthorizedClient
+	_, err = client.Create(context.Background(), &api.CreateRecordRequest{Record: &api.Record{Value: []byte("hello world")}})
+	require.NoError(t, err)
+	faults.DelayAppends(200 * time.Millisecond)
+	slow := make(chan error)
+	go func() {
+		_, err := client.Create(context.Background(), &api.CreateRecordRequest{Record: &api.Record{Value: []byte("slow")}})
+		slow <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	// only the append in progress is slow
+	faults.DelayAppends(0)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	// act
+	_, createErr := client.Create(ctx, &api.CreateRecordRequest{Record: &api.Record{Value: []byte("waiting")}})
+	res, getErr := client.Get(context.Background(), &api.GetRecordRequest{Offset: 0})
+
+	// assert
+	require.Equal(t, codes.DeadlineExceeded, status.Code(createErr), "the append waited for the slow one")
+	require.NoError(t, getErr, "reads don't wait for appends")
+	require.Equal(t, "hello world", string(res.Record.Value))
+	require.NoError(t, <-slow)
+}
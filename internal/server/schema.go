@@ -0,0 +1,72 @@
+package server
+
+import (
+	"context"
+
+	api "github.com/justagabriel/proglog/api/v1"
+	"google.golang.org/grpc"
+)
+
+// SchemaValidator rejects records not matching their topic's schema, see
+// the schema package for one.
+type SchemaValidator interface {
+	Validate(topic string, record *api.Record) error
+}
+
+// validateRecords rejects Create, CreateBatch and CreateTransaction requests holding a record
+// the validator rejects, before they reach the log.
+func validateRecords(v SchemaValidator) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if v != nil {
+			if err := validateRequest(v, req); err != nil {
+				return nil, err
+			}
+		}
+		return handler(ctx, req)
+	}
+}
+
+// validateStreams does the same as validateRecords for the requests of
+// CreateStream.
+func validateStreams(v SchemaValidator) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if v == nil || !info.IsClientStream {
+			return handler(srv, ss)
+		}
+		return handler(srv, &validatedStream{ServerStream: ss, validator: v})
+	}
+}
+
+type validatedStream struct {
+	grpc.ServerStream
+	validator SchemaValidator
+}
+
+func (s *validatedStream) RecvMsg(m interface{}) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	return validateRequest(s.validator, m)
+}
+
+func validateRequest(v SchemaValidator, req interface{}) error {
+	switch req := req.(type) {
+	case *api.CreateRecordRequest:
+		return v.Validate(req.Topic, req.Record)
+	case *api.CreateRecordBatchRequest:
+		for _, record := range req.Records {
+			if err := v.Validate(req.Topic, record); err != nil {
+				return err
+			}
+		}
+	case *api.CreateTransactionRequest:
+		for _, a := range req.Appends {
+			for _, record := range a.Records {
+				if err := v.Validate(a.Topic, record); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
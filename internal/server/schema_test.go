@@ -0,0 +1,62 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	api "github.com/justagabriel/proglog/api/v1"
+	"github.com/justagabriel/proglog/internal/schema"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestServerSchemaValidation(t *testing.T) {
+	// arrange
+	orders, err := schema.ParseJSON("order.json", []byte(`{"type": "object", "required": ["id"]}`))
+	require.NoError(t, err)
+	registry := schema.NewRegistry()
+	registry.Register("orders", orders)
+	testSetup := SetupTest(t, func(c *Config) {
+		c.SchemaValidator = registry
+	}, debug)
+	defer testSetup.Teardown()
+	client := testSetup.AuthorizedClient
+	ctx := context.Background()
+	valid := &api.Record{Value: []byte(`{"id": 1}`)}
+	invalid := &api.Record{Value: []byte(`{"name": "book"}`)}
+
+	// act
+	_, err = client.Create(ctx, &api.CreateRecordRequest{Topic: "orders", Record: valid})
+	require.NoError(t, err)
+	_, err = client.Create(ctx, &api.CreateRecordRequest{Topic: "orders", Record: invalid})
+
+	// assert
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+	violation, ok := api.SchemaViolationFromError(err)
+	require.True(t, ok)
+	require.Equal(t, api.ErrSchemaViolation{
+		Topic:     "orders",
+		Schema:    "order.json",
+		Violation: `$: missing property "id"`,
+	}, violation)
+
+	// act
+	_, err = client.CreateBatch(ctx, &api.CreateRecordBatchRequest{Topic: "orders", Records: []*api.Record{valid, invalid}})
+
+	// assert
+	_, ok = api.SchemaViolationFromError(err)
+	require.True(t, ok, "batches are rejected as a whole")
+
+	// act
+	stream, err := client.CreateStream(ctx)
+	require.NoError(t, err)
+	require.NoError(t, stream.Send(&api.CreateRecordRequest{Topic: "orders", Record: invalid}))
+	_, err = stream.Recv()
+
+	// assert
+	_, ok = api.SchemaViolationFromError(err)
+	require.True(t, ok, "streamed records are validated as well")
+	_, err = client.Create(ctx, &api.CreateRecordRequest{Record: invalid})
+	require.NoError(t, err, "topics without a schema accept all records")
+}
@@ -2,59 +2,325 @@ package server
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync/atomic"
 	"time"
 
 	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware"
 	grpc_auth "github.com/grpc-ecosystem/go-grpc-middleware/auth"
-	grpc_zap "github.com/grpc-ecosystem/go-grpc-middleware/logging/zap"
 	grpc_ctxtags "github.com/grpc-ecosystem/go-grpc-middleware/tags"
 	api "github.com/justagabriel/proglog/api/v1"
 	"go.opencensus.io/plugin/ocgrpc"
-	"go.opencensus.io/stats/view"
 	"go.opencensus.io/trace"
-	"go.uber.org/zap"
-	"go.uber.org/zap/zapcore"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/credentials"
+	// clients may compress their requests and responses with gzip
+	_ "google.golang.org/grpc/encoding/gzip"
 	"google.golang.org/grpc/health"
 	healthpb "google.golang.org/grpc/health/grpc_health_v1"
-	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/reflection"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
 )
 
 const (
 	createAction string = "create"
 	getAction    string = "get"
+	adminAction  string = "admin"
 )
 
+// consumePollInterval is how often ConsumeStream checks for new records if no Watcher is configured.
+const consumePollInterval = 100 * time.Millisecond
+
+// maxGetWait caps how long Get waits for a record to be appended.
+const maxGetWait = 30 * time.Second
+
+// maxGetManyOffsets caps the amount of records fetched by a single GetMany call.
+const maxGetManyOffsets = 1000
+
+// defaultRangeRecords is the default of GetRangeRequest.max_records,
+// maxGetManyOffsets caps it.
+const defaultRangeRecords = 100
+
+// maxBatchRecords caps the amount of records appended by a single CreateBatch call.
+const maxBatchRecords = 1000
+
+// CommitLog appends to and reads from topics, the empty topic is the default topic.
+// It's the only dependency the server requires, the other interfaces of Config
+// are optional. log.DistributedLog implements it as well as log.Topics, which
+// log.NewInMemory returns for tests of services embedding the server.
 type CommitLog interface {
-	Append(*api.Record) (uint64, error)
-	Read(uint64) (*api.Record, error)
+	Append(topic string, record *api.Record) (uint64, error)
+	Read(topic string, offset uint64) (*api.Record, error)
+}
+
+// ContextCommitLog is a CommitLog which stops appending and reading once the
+// request's context is done, so the work of clients gone away is dropped.
+type ContextCommitLog interface {
+	AppendContext(ctx context.Context, topic string, record *api.Record) (uint64, error)
+	ReadContext(ctx context.Context, topic string, offset uint64) (*api.Record, error)
+}
+
+// AcksAppender appends records acknowledged before they're committed, see
+// api.Acks. Without one all records are acknowledged once appended.
+type AcksAppender interface {
+	AppendAcks(topic string, record *api.Record, acks api.Acks) (uint64, error)
+}
+
+// BatchAppender appends several records to a topic at once.
+type BatchAppender interface {
+	AppendBatch(topic string, records []*api.Record) ([]uint64, error)
+}
+
+// Transactor appends records to several topics atomically.
+type Transactor interface {
+	AppendTransaction(appends []*api.TopicRecords) ([]*api.TopicOffsets, error)
 }
 
+// Authorizer decides whether the subject may perform the action on the object,
+// see topicObject, bookmarkObject and groupObject.
 type Authorizer interface {
-	Authorize(subject, action string) error
+	Authorize(subject, object, action string) error
 }
 
 type GetServerer interface {
 	GetServers() ([]*api.Server, error)
 }
 
+// Watcher reports the high watermark of a topic, the returned channel is closed once it changes.
+type Watcher interface {
+	HighWatermark(topic string) (*api.HighWatermark, <-chan struct{}, error)
+}
+
+type Bookmarker interface {
+	SetBookmark(name string, offset uint64) error
+	GetBookmark(name string) (uint64, error)
+	DeleteBookmark(name string) error
+}
+
+// OffsetCommitter stores the offsets consumer groups committed per topic.
+type OffsetCommitter interface {
+	CommitOffset(group, topic string, offset uint64) error
+	FetchOffset(group, topic string) (uint64, error)
+}
+
+type SegmentStatser interface {
+	SegmentStats(topic string) ([]*api.SegmentStats, error)
+}
+
+// LogStatser summarizes a topic's log, see log.Log.Stats.
+type LogStatser interface {
+	Stats(topic string) (*api.LogStats, error)
+}
+
+// Verifier checks and repairs a topic's log, see log.Log.Verify.
+type Verifier interface {
+	Verify(topic string, repair bool) (*api.VerifyReport, error)
+}
+
+// DurabilityReporter reports the offset up to which a topic's records are
+// durable, see log.Log.DurableOffset.
+type DurabilityReporter interface {
+	DurableOffset(topic string) (uint64, error)
+}
+
+// Backuper writes a copy of a topic's records, restorable with log.Log.Restore.
+type Backuper interface {
+	Backup(topic string, w io.Writer) error
+}
+
+// TimeSearcher finds the first offset of a topic appended at or after a time.
+type TimeSearcher interface {
+	OffsetByTime(topic string, t time.Time) (uint64, error)
+}
+
+// KeyReader reads the latest record of a topic per key, see log.Log.ReadByKey.
+type KeyReader interface {
+	ReadByKey(topic string, key []byte) (*api.Record, error)
+}
+
+// LeaderReader reads records as the leader, for reads with the leader
+// consistency. Followers fail with ErrNotLeader.
+type LeaderReader interface {
+	ReadLeader(topic string, offset uint64) (*api.Record, error)
+}
+
+// Readier reports whether the node is ready to serve, e.g. whether its cluster
+// has a leader. The returned channel is closed once that may have changed, it's
+// nil once the node stopped for good.
+type Readier interface {
+	Ready() (bool, <-chan struct{})
+}
+
+// Truncater removes old segments of a topic to reclaim disk space.
+type Truncater interface {
+	Truncate(topic string, lowest uint64) error
+}
+
+// OffsetRanger reports the range of a topic's offsets.
+type OffsetRanger interface {
+	LowestOffset(topic string) (uint64, error)
+	HighestOffset(topic string) (uint64, error)
+}
+
+// RecordDeleter deletes the records of a topic below an offset, which becomes
+// the topic's log start offset. It returns the log start offset.
+type RecordDeleter interface {
+	DeleteBefore(topic string, offset uint64) (uint64, error)
+}
+
+// MembershipChanger adds servers to and removes them from the raft cluster,
+// servers added as non-voters are read replicas.
+type MembershipChanger interface {
+	JoinZone(id, addr, zone string) error
+	JoinNonvoter(id, addr, zone string) error
+	Leave(id string) error
+}
+
+// ConfigReloader re-reads the server's config and applies the settings
+// which don't require a restart.
+type ConfigReloader interface {
+	ReloadConfig(dryRun bool) (changes []string, err error)
+}
+
 type Config struct {
-	CommitLog   CommitLog
-	Authorizer  Authorizer
-	GetServerer GetServerer
+	CommitLog     CommitLog
+	BatchAppender BatchAppender
+	Authorizer    Authorizer
+	// AcksAppender serves the appends not waiting for the quorum.
+	AcksAppender AcksAppender
+	// ContextCommitLog serves the appends and reads instead of CommitLog,
+	// they stop once the RPC is cancelled or its deadline passed.
+	ContextCommitLog ContextCommitLog
+	// Transactor enables CreateTransaction.
+	Transactor Transactor
+	// TopicAdmin enables the Admin service.
+	TopicAdmin TopicAdmin
+	// Maintainer enables RunMaintenance and GetMaintenanceStatus.
+	Maintainer Maintainer
+	// ReadOnlier enables the cluster-wide read-only mode, followers forward
+	// SetReadOnly to the leader with the Forwarder. The read-only mode of
+	// the server itself is supported regardless.
+	ReadOnlier ReadOnlier
+	// Authenticators are tried in order, defaults to authenticating by client certificate.
+	Authenticators []Authenticator
+	GetServerer    GetServerer
+	// MembershipChanger enables Join and Leave, followers forward them to
+	// the leader with the Forwarder.
+	MembershipChanger MembershipChanger
+	// ConfigReloader enables ReloadConfig.
+	ConfigReloader ConfigReloader
+	Watcher        Watcher
+	Bookmarker     Bookmarker
+	// OffsetCommitter enables CommitOffset and FetchOffset.
+	OffsetCommitter OffsetCommitter
+	SegmentStatser  SegmentStatser
+	// EncodedReader lets ConsumeStream send records without decoding them.
+	EncodedReader EncodedReader
+	// LogStatser enables GetLogStats.
+	LogStatser LogStatser
+	// Verifier enables Verify.
+	Verifier      Verifier
+	Truncater     Truncater
+	RecordDeleter RecordDeleter
+	Backuper      Backuper
+	TimeSearcher  TimeSearcher
+	OffsetRanger  OffsetRanger
+	// KeyReader enables GetByKey.
+	KeyReader KeyReader
+	// DurabilityReporter sets the durable offset of CreateStream's responses,
+	// it's left zero without.
+	DurabilityReporter DurabilityReporter
+	// LeaderReader serves reads with the leader consistency, without one
+	// they're served by the CommitLog like all others.
+	LeaderReader LeaderReader
+	// Readier lets the health service report the log service as NOT_SERVING
+	// while the node isn't ready, it's always SERVING without.
+	Readier Readier
+	// TraceSampler decides which RPCs are traced, defaults to all of them.
+	// Spans of RPCs whose client sent a sampled trace context are traced as well
+	// by samplers like trace.ProbabilitySampler.
+	TraceSampler trace.Sampler
+	// TopicLister enables the segment metrics of the MetricsExporter.
+	TopicLister TopicLister
+	RateLimits  RateLimits
+	// ClientRateLimits apply to each client's Create and Get requests across
+	// all topics, clients are told apart by their authenticated subject.
+	ClientRateLimits RateLimits
+	// RateLimiter and ClientRateLimiter are used instead of RateLimits and
+	// ClientRateLimits if set, so the limits can be changed while serving.
+	RateLimiter       *RateLimiter
+	ClientRateLimiter *RateLimiter
+	// RequestLogger logs the RPCs, nil logs each of them, see RequestLogConfig.
+	RequestLogger *RequestLogger
+	StreamLimits  StreamLimits
+	// Scheduling bounds the appends and reads in progress, the zero value
+	// leaves them unbounded.
+	Scheduling Scheduling
+	// Transport sets the message size limits and keepalives of the
+	// connections, the zero value keeps gRPC's defaults.
+	Transport Transport
+	// Reflection registers the gRPC reflection service, so tools like
+	// grpcurl discover the services. Its RPCs are authenticated like all
+	// others.
+	Reflection bool
+	// DiskUsager enables the DiskWatermarks, which throttle and reject
+	// appends once the server's data takes up too much disk space.
+	DiskUsager     DiskUsager
+	DiskWatermarks DiskWatermarks
+	// Forwarder forwards Create, CreateBatch, Join and Leave requests failing
+	// with ErrNotLeader to the leader, without one followers return the error.
+	Forwarder *Forwarder
+	// PeerSubjects are the certificate subjects of the cluster's servers, see
+	// TLSAuthenticator. Only their requests are taken as forwarded by a
+	// follower, which scoped them to their tenant already.
+	PeerSubjects []string
+	// MaxRecordBytes rejects records whose encoded size exceeds it before
+	// they reach the log, zero disables the limit.
+	MaxRecordBytes uint64
+	// SchemaValidator rejects records not matching their topic's schema with
+	// api.ErrSchemaViolation, nil accepts all records.
+	SchemaValidator SchemaValidator
+	// TenantResolvers enable multi-tenancy, they're tried in order to find the
+	// tenant of a request. The topics and consumer groups of requests are
+	// prefixed with their tenant's name, see api.TenantTopic, requests
+	// without tenant are rejected. Nil serves all clients alike.
+	TenantResolvers []TenantResolver
+	// WebSocketOrigins are the origins of the web pages allowed to open
+	// WebSockets of the HTTP gateway, "*" allows all. Defaults to the
+	// gateway's own origin.
+	WebSocketOrigins []string
+	// Faults injects failures into the streams for tests, nil injects none.
+	Faults *Faults
+	// UnaryInterceptors and StreamInterceptors run after the client was
+	// authenticated, so subject-based middleware like tenant extraction can be
+	// added without forking the server. They run in order, before the rate
+	// limits and the schema validation.
+	UnaryInterceptors  []grpc.UnaryServerInterceptor
+	StreamInterceptors []grpc.StreamServerInterceptor
 }
 
 type grpcServer struct {
 	api.UnimplementedLogServer
+	api.UnimplementedAdminServer
 	*Config
+	limiter   *RateLimiter
+	scheduler *scheduler
+	// readOnly is the server's read-only mode, nil until it's set
+	readOnly atomic.Pointer[api.ReadOnlyMode]
 }
 
 func newGRPCServer(config *Config) (*grpcServer, error) {
+	limiter := config.RateLimiter
+	if limiter == nil {
+		limiter = NewRateLimiter(config.RateLimits)
+	}
 	srv := &grpcServer{
-		Config: config,
+		Config:    config,
+		limiter:   limiter,
+		scheduler: newScheduler(config.Scheduling),
 	}
 	return srv, nil
 }
@@ -63,70 +329,637 @@ var _ api.LogServer = (*grpcServer)(nil)
 
 type subjectContextKey struct{}
 
-func authenticate(ctx context.Context) (context.Context, error) {
-	peer, ok := peer.FromContext(ctx)
-	if !ok {
-		return ctx, status.New(codes.Unknown, "couldn't find peer info").Err()
-	}
+func subject(ctx context.Context) string {
+	return ctx.Value(subjectContextKey{}).(string)
+}
 
-	if peer.AuthInfo == nil {
-		return context.WithValue(ctx, subjectContextKey{}, ""), nil
+// Subject returns the authenticated subject of a request, for use in
+// Config.UnaryInterceptors and Config.StreamInterceptors.
+func Subject(ctx context.Context) string {
+	subject, _ := ctx.Value(subjectContextKey{}).(string)
+	return subject
+}
+
+// topicKey maps the empty topic to the default topic, so both share their rate limits.
+func topicKey(topic string) string {
+	if topic == "" {
+		return api.DefaultTopic
 	}
+	return topic
+}
 
-	tlsInfo := peer.AuthInfo.(credentials.TLSInfo)
-	subject := tlsInfo.State.VerifiedChains[0][0].Subject.CommonName
-	ctx = context.WithValue(ctx, subjectContextKey{}, subject)
-	return ctx, nil
+// topicObject names a topic in ACL policies, "topic/*" matches all topics.
+func topicObject(topic string) string {
+	return "topic/" + topicKey(topic)
 }
 
-func subject(ctx context.Context) string {
-	return ctx.Value(subjectContextKey{}).(string)
+// bookmarkObject names a bookmark in ACL policies, "bookmark/*" matches all bookmarks.
+func bookmarkObject(name string) string {
+	return "bookmark/" + name
+}
+
+// clusterObject names the cluster's membership in ACL policies.
+const clusterObject = "cluster"
+
+// configObject names the server's config in ACL policies.
+const configObject = "config"
+
+// groupObject names a consumer group in ACL policies, "group/*" matches all groups.
+func groupObject(group string) string {
+	return "group/" + group
+}
+
+// checkRecords rejects records exceeding MaxRecordBytes, records setting
+// the transaction fields, which are the log's to set, and invalid TTLs. It
+// assigns the ids of accepted records, replacing the ones sent by clients,
+// which don't count towards MaxRecordBytes. Timestamps sent by clients are
+// dropped, the log assigns them.
+func (s *grpcServer) checkRecords(records ...*api.Record) error {
+	for _, record := range records {
+		record.Id = nil
+		record.Timestamp = nil
+		if record.Transaction != 0 || record.Marker != api.TransactionMarker_TRANSACTION_MARKER_NONE {
+			return status.Error(codes.InvalidArgument, "records can't set their transaction or marker")
+		}
+		if record.Ttl != nil && (record.Ttl.CheckValid() != nil || record.Ttl.AsDuration() <= 0) {
+			return status.Error(codes.InvalidArgument, "a record's ttl has to be positive")
+		}
+		if record.Tombstone && (len(record.Key) == 0 || len(record.Value) != 0) {
+			return status.Error(codes.InvalidArgument, "tombstones need a key and can't have a value")
+		}
+		if s.MaxRecordBytes == 0 {
+			continue
+		}
+		if size := uint64(proto.Size(record)); size > s.MaxRecordBytes {
+			return api.ErrRecordTooLarge{Size: size, Limit: s.MaxRecordBytes}
+		}
+	}
+	now := time.Now()
+	for _, record := range records {
+		record.Id = newRecordID(now)
+	}
+	return nil
 }
 
 func (s *grpcServer) Create(ctx context.Context, req *api.CreateRecordRequest) (*api.CreateRecordResponse, error) {
 	subject := subject(ctx)
-	err := s.Authorizer.Authorize(subject, getAction)
+	err := s.Authorizer.Authorize(subject, topicObject(req.Topic), createAction)
+	if err != nil {
+		return nil, err
+	}
+	if err = s.checkWritable(); err != nil {
+		return nil, err
+	}
+	if err = s.guardDisk(ctx); err != nil {
+		return nil, err
+	}
+	err = s.checkRecords(req.Record)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := api.Acks_name[int32(req.Acks)]; !ok {
+		return nil, status.Errorf(codes.InvalidArgument, "unknown acks %d", req.Acks)
+	}
+	err = s.limiter.allowProduce(ctx, topicKey(req.Topic), 1, proto.Size(req.Record))
+	if err != nil {
+		return nil, err
+	}
+	offset, err := s.append(ctx, req)
+	if leader, fctx, ok := s.forward(ctx, err); ok {
+		return leader.Create(fctx, req)
+	}
 	if err != nil {
 		return nil, err
 	}
-	offset, err := s.CommitLog.Append(req.Record)
+	recordAppend(ctx, req.Topic, 1, proto.Size(req.Record))
+	return &api.CreateRecordResponse{Offset: offset, Id: req.Record.Id}, nil
+}
+
+// Delete appends a tombstone for the key, it's created like any other record.
+func (s *grpcServer) Delete(ctx context.Context, req *api.DeleteRecordRequest) (*api.DeleteRecordResponse, error) {
+	res, err := s.Create(ctx, &api.CreateRecordRequest{
+		Record: &api.Record{Key: req.Key, Tombstone: true},
+		Topic:  req.Topic,
+		Acks:   req.Acks,
+	})
 	if err != nil {
 		return nil, err
 	}
-	return &api.CreateRecordResponse{Offset: offset}, nil
+	return &api.DeleteRecordResponse{Offset: res.Offset, Id: res.Id}, nil
+}
+
+// append appends the record, acknowledging it as requested if possible.
+func (s *grpcServer) append(ctx context.Context, req *api.CreateRecordRequest) (uint64, error) {
+	if err := s.scheduler.acquire(ctx, produceClass); err != nil {
+		return 0, err
+	}
+	defer s.scheduler.release(produceClass)
+	if req.Acks != api.Acks_ACKS_QUORUM && s.AcksAppender != nil {
+		return s.AcksAppender.AppendAcks(req.Topic, req.Record, req.Acks)
+	}
+	if s.ContextCommitLog != nil {
+		offset, err := s.ContextCommitLog.AppendContext(ctx, req.Topic, req.Record)
+		return offset, contextError(err)
+	}
+	return s.CommitLog.Append(req.Topic, req.Record)
+}
+
+// read reads the record, until ctx is done if possible.
+func (s *grpcServer) read(ctx context.Context, topic string, offset uint64) (*api.Record, error) {
+	if err := s.scheduler.acquire(ctx, consumeClass); err != nil {
+		return nil, err
+	}
+	defer s.scheduler.release(consumeClass)
+	if s.ContextCommitLog != nil {
+		record, err := s.ContextCommitLog.ReadContext(ctx, topic, offset)
+		return record, contextError(err)
+	}
+	return s.CommitLog.Read(topic, offset)
+}
+
+// contextError turns the errors of done contexts into their status.
+func contextError(err error) error {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return status.FromContextError(err).Err()
+	}
+	return err
+}
+
+// CreateBatch appends the records to the topic in one go, either all of them
+// are accepted by the rate limits or none.
+func (s *grpcServer) CreateBatch(ctx context.Context, req *api.CreateRecordBatchRequest) (*api.CreateRecordBatchResponse, error) {
+	if s.BatchAppender == nil {
+		return nil, status.Error(codes.Unimplemented, "batch appends are not supported")
+	}
+	err := s.Authorizer.Authorize(subject(ctx), topicObject(req.Topic), createAction)
+	if err != nil {
+		return nil, err
+	}
+	if err = s.checkWritable(); err != nil {
+		return nil, err
+	}
+	if err = s.guardDisk(ctx); err != nil {
+		return nil, err
+	}
+	if len(req.Records) > maxBatchRecords {
+		msg := fmt.Sprintf("at most %d records can be appended at once", maxBatchRecords)
+		return nil, status.Error(codes.InvalidArgument, msg)
+	}
+	for _, record := range req.Records {
+		if record.ProducerId != req.Records[0].ProducerId {
+			return nil, status.Error(codes.InvalidArgument, "a batch holds the records of a single producer")
+		}
+	}
+	err = s.checkRecords(req.Records...)
+	if err != nil {
+		return nil, err
+	}
+	size := 0
+	for _, record := range req.Records {
+		size += proto.Size(record)
+	}
+	err = s.limiter.allowProduce(ctx, topicKey(req.Topic), len(req.Records), size)
+	if err != nil {
+		return nil, err
+	}
+	if err = s.scheduler.acquire(ctx, produceClass); err != nil {
+		return nil, err
+	}
+	offsets, err := s.BatchAppender.AppendBatch(req.Topic, req.Records)
+	s.scheduler.release(produceClass)
+	if leader, fctx, ok := s.forward(ctx, err); ok {
+		return leader.CreateBatch(fctx, req)
+	}
+	if err != nil {
+		return nil, err
+	}
+	recordAppend(ctx, req.Topic, len(offsets), size)
+	ids := make([][]byte, len(req.Records))
+	for i, record := range req.Records {
+		ids[i] = record.Id
+	}
+	return &api.CreateRecordBatchResponse{Offsets: offsets, Ids: ids}, nil
+}
+
+// CreateTransaction appends the records to their topics atomically, the
+// rate limits have to accept the records of all topics.
+func (s *grpcServer) CreateTransaction(ctx context.Context, req *api.CreateTransactionRequest) (*api.CreateTransactionResponse, error) {
+	if s.Transactor == nil {
+		return nil, status.Error(codes.Unimplemented, "transactions are not supported")
+	}
+	if len(req.Appends) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "a transaction appends records to at least one topic")
+	}
+	records := 0
+	topics := make(map[string]bool, len(req.Appends))
+	for _, a := range req.Appends {
+		if topics[a.Topic] {
+			return nil, status.Errorf(codes.InvalidArgument, "a transaction appends to topic %q once", a.Topic)
+		}
+		topics[a.Topic] = true
+		if len(a.Records) == 0 {
+			return nil, status.Errorf(codes.InvalidArgument, "a transaction appends no records to topic %q", a.Topic)
+		}
+		records += len(a.Records)
+	}
+	if records > maxBatchRecords {
+		msg := fmt.Sprintf("at most %d records can be appended at once", maxBatchRecords)
+		return nil, status.Error(codes.InvalidArgument, msg)
+	}
+	sizes := make([]int, len(req.Appends))
+	for i, a := range req.Appends {
+		err := s.Authorizer.Authorize(subject(ctx), topicObject(a.Topic), createAction)
+		if err != nil {
+			return nil, err
+		}
+		if err = s.checkRecords(a.Records...); err != nil {
+			return nil, err
+		}
+		for _, record := range a.Records {
+			sizes[i] += proto.Size(record)
+		}
+	}
+	if err := s.checkWritable(); err != nil {
+		return nil, err
+	}
+	if err := s.guardDisk(ctx); err != nil {
+		return nil, err
+	}
+	for i, a := range req.Appends {
+		err := s.limiter.allowProduce(ctx, topicKey(a.Topic), len(a.Records), sizes[i])
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := s.scheduler.acquire(ctx, produceClass); err != nil {
+		return nil, err
+	}
+	offsets, err := s.Transactor.AppendTransaction(req.Appends)
+	s.scheduler.release(produceClass)
+	if leader, fctx, ok := s.forward(ctx, err); ok {
+		return leader.CreateTransaction(fctx, req)
+	}
+	if err != nil {
+		return nil, err
+	}
+	for i, a := range req.Appends {
+		recordAppend(ctx, a.Topic, len(a.Records), sizes[i])
+	}
+	return &api.CreateTransactionResponse{Offsets: offsets}, nil
 }
 
 func (s *grpcServer) Get(ctx context.Context, req *api.GetRecordRequest) (*api.GetRecordResponse, error) {
 	subject := subject(ctx)
-	err := s.Authorizer.Authorize(subject, getAction)
+	err := s.Authorizer.Authorize(subject, topicObject(req.Topic), getAction)
 	if err != nil {
 		return nil, err
 	}
-	rec, err := s.CommitLog.Read(req.GetOffset())
+	err = s.limiter.allowConsume(ctx, topicKey(req.Topic), 1)
 	if err != nil {
 		return nil, err
 	}
+	if req.RequiredOffset != nil {
+		if err = s.awaitReplica(ctx, req); err != nil {
+			return nil, err
+		}
+	}
+	var rec *api.Record
+	if req.Consistency == api.ReadConsistency_READ_CONSISTENCY_LEADER && s.LeaderReader != nil {
+		rec, err = s.LeaderReader.ReadLeader(req.Topic, req.GetOffset())
+		if leader, fctx, ok := s.forward(ctx, err); ok {
+			return leader.Get(fctx, req)
+		}
+	} else {
+		rec, err = s.read(ctx, req.Topic, req.GetOffset())
+	}
+	if _, ok := err.(api.ErrOffsetOutOfRange); ok && req.MaxWaitMs > 0 {
+		rec, err = s.awaitRecord(ctx, req)
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.limiter.consumed(topicKey(req.Topic), proto.Size(rec))
+	recordRead(ctx, req.Topic, proto.Size(rec))
 
 	return &api.GetRecordResponse{Record: rec}, nil
 }
 
-func (s *grpcServer) CreateStream(stream api.Log_CreateStreamServer) error {
+// awaitRecord reads the record once it's appended, it fails with
+// ErrOffsetOutOfRange if that doesn't happen within the request's max wait.
+func (s *grpcServer) awaitRecord(ctx context.Context, req *api.GetRecordRequest) (*api.Record, error) {
+	wait := time.Duration(req.MaxWaitMs) * time.Millisecond
+	if wait > maxGetWait {
+		wait = maxGetWait
+	}
+	timeout := time.NewTimer(wait)
+	defer timeout.Stop()
+
 	for {
-		req, err := stream.Recv()
+		var changed <-chan struct{}
+		if s.Watcher != nil {
+			hw, c, err := s.Watcher.HighWatermark(req.Topic)
+			if err != nil {
+				return nil, err
+			}
+			if req.Offset < hw.Offset {
+				// the record was appended or is gone for good
+				return s.read(ctx, req.Topic, req.Offset)
+			}
+			changed = c
+		}
+
+		var poll <-chan time.Time
+		if changed == nil {
+			poll = time.After(consumePollInterval)
+		}
+		select {
+		case <-ctx.Done():
+			return nil, status.FromContextError(ctx.Err()).Err()
+		case <-timeout.C:
+			return s.read(ctx, req.Topic, req.Offset)
+		case <-changed:
+		case <-poll:
+			rec, err := s.read(ctx, req.Topic, req.Offset)
+			if _, ok := err.(api.ErrOffsetOutOfRange); !ok {
+				return rec, err
+			}
+		}
+	}
+}
+
+// awaitReplica waits until the replica holds the record at the request's
+// required offset. It fails with Unavailable if that doesn't happen within the
+// request's max wait, or the server's cap without one.
+func (s *grpcServer) awaitReplica(ctx context.Context, req *api.GetRecordRequest) error {
+	required := req.GetRequiredOffset()
+	wait := maxGetWait
+	if max := time.Duration(req.MaxWaitMs) * time.Millisecond; max > 0 && max < wait {
+		wait = max
+	}
+	timeout := time.NewTimer(wait)
+	defer timeout.Stop()
+
+	for {
+		var changed <-chan struct{}
+		if s.Watcher != nil {
+			hw, c, err := s.Watcher.HighWatermark(req.Topic)
+			if err != nil {
+				return err
+			}
+			if required < hw.Offset {
+				return nil
+			}
+			changed = c
+		} else {
+			_, err := s.read(ctx, req.Topic, required)
+			outOfRange, ok := err.(api.ErrOffsetOutOfRange)
+			if !ok || required < outOfRange.LogStartOffset {
+				// the record is there, gone for good or the read fails anyway
+				return nil
+			}
+		}
+
+		var poll <-chan time.Time
+		if changed == nil {
+			poll = time.After(consumePollInterval)
+		}
+		select {
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		case <-timeout.C:
+			return status.Errorf(codes.Unavailable, "replica didn't catch up with offset %d", required)
+		case <-changed:
+		case <-poll:
+		}
+	}
+}
+
+// GetMany reads the records at the given offsets. Offsets which can't be read
+// yield an error result instead of failing the whole call.
+func (s *grpcServer) GetMany(ctx context.Context, req *api.GetManyRequest) (*api.GetManyResponse, error) {
+	err := s.Authorizer.Authorize(subject(ctx), topicObject(req.Topic), getAction)
+	if err != nil {
+		return nil, err
+	}
+	if len(req.Offsets) > maxGetManyOffsets {
+		msg := fmt.Sprintf("at most %d offsets can be requested at once", maxGetManyOffsets)
+		return nil, status.Error(codes.InvalidArgument, msg)
+	}
+	err = s.limiter.allowConsume(ctx, topicKey(req.Topic), len(req.Offsets))
+	if err != nil {
+		return nil, err
+	}
+
+	res := &api.GetManyResponse{Results: make([]*api.GetManyResult, 0, len(req.Offsets))}
+	for _, off := range req.Offsets {
+		if err := ctx.Err(); err != nil {
+			return nil, status.FromContextError(err).Err()
+		}
+		result := &api.GetManyResult{Offset: off}
+		rec, err := s.read(ctx, req.Topic, off)
 		if err != nil {
-			return err
+			result.Result = &api.GetManyResult_Error{Error: status.Convert(err).Proto()}
+		} else {
+			s.limiter.consumed(topicKey(req.Topic), proto.Size(rec))
+			recordRead(ctx, req.Topic, proto.Size(rec))
+			result.Result = &api.GetManyResult_Record{Record: rec}
 		}
+		res.Results = append(res.Results, result)
+	}
+	return res, nil
+}
+
+// GetRange pages through the topic: it reads the records from the requested
+// offset on until max_records or max_bytes is reached or the end of the
+// topic, so request/response clients read ranges without holding a stream
+// open. Offsets without readable record, e.g. compacted ones, are skipped.
+func (s *grpcServer) GetRange(ctx context.Context, req *api.GetRangeRequest) (*api.GetRangeResponse, error) {
+	err := s.Authorizer.Authorize(subject(ctx), topicObject(req.Topic), getAction)
+	if err != nil {
+		return nil, err
+	}
+	// the range's records are charged once read, as their count isn't known
+	// upfront, so only a limiter in debt rejects the request
+	err = s.limiter.allowConsume(ctx, topicKey(req.Topic), 0)
+	if err != nil {
+		return nil, err
+	}
+	maxRecords := int(req.MaxRecords)
+	if maxRecords == 0 {
+		maxRecords = defaultRangeRecords
+	}
+	if maxRecords > maxGetManyOffsets {
+		maxRecords = maxGetManyOffsets
+	}
+	maxBytes := int(req.MaxBytes)
+	if maxBytes == 0 || maxBytes > maxStreamBatchBytes {
+		maxBytes = maxStreamBatchBytes
+	}
 
-		res, err := s.Create(stream.Context(), req)
+	res := &api.GetRangeResponse{NextOffset: req.FromOffset}
+	size := 0
+	for len(res.Records) < maxRecords {
+		if err := ctx.Err(); err != nil {
+			return nil, status.FromContextError(err).Err()
+		}
+		var rec *api.Record
+		var err error
+		if req.Consistency == api.ReadConsistency_READ_CONSISTENCY_LEADER && s.LeaderReader != nil {
+			rec, err = s.LeaderReader.ReadLeader(req.Topic, res.NextOffset)
+			if leader, fctx, ok := s.forward(ctx, err); ok {
+				return leader.GetRange(fctx, req)
+			}
+		} else {
+			rec, err = s.read(ctx, req.Topic, res.NextOffset)
+		}
+		if e, ok := api.OffsetOutOfRangeFromError(err); ok && res.NextOffset >= e.LogStartOffset {
+			// the highest offset is ambiguous for empty topics, so the
+			// range ends before it if its record isn't readable
+			if res.NextOffset >= e.HighestOffset {
+				break
+			}
+			res.NextOffset++
+			continue
+		}
 		if err != nil {
-			return err
+			return nil, err
+		}
+		n := proto.Size(rec)
+		if len(res.Records) > 0 && size+n > maxBytes {
+			break
+		}
+		size += n
+		res.Records = append(res.Records, rec)
+		res.NextOffset++
+		recordRead(ctx, req.Topic, n)
+	}
+	s.limiter.consumedRecords(topicKey(req.Topic), len(res.Records), size)
+	return res, nil
+}
+
+// GetByTime returns the offset consumers start from to replay the records
+// appended since the requested time.
+func (s *grpcServer) GetByTime(ctx context.Context, req *api.GetByTimeRequest) (*api.GetByTimeResponse, error) {
+	if s.TimeSearcher == nil {
+		return nil, status.Error(codes.Unimplemented, "searching by time is not supported")
+	}
+	err := s.Authorizer.Authorize(subject(ctx), topicObject(req.Topic), getAction)
+	if err != nil {
+		return nil, err
+	}
+	if err = req.Time.CheckValid(); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	offset, err := s.TimeSearcher.OffsetByTime(req.Topic, req.Time.AsTime())
+	if err != nil {
+		return nil, err
+	}
+	return &api.GetByTimeResponse{Offset: offset}, nil
+}
+
+// GetByKey returns the latest record with the requested key of a topic
+// indexing its keys.
+func (s *grpcServer) GetByKey(ctx context.Context, req *api.GetByKeyRequest) (*api.GetByKeyResponse, error) {
+	if s.KeyReader == nil {
+		return nil, status.Error(codes.Unimplemented, "reading by key is not supported")
+	}
+	err := s.Authorizer.Authorize(subject(ctx), topicObject(req.Topic), getAction)
+	if err != nil {
+		return nil, err
+	}
+	if len(req.Key) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "key is required")
+	}
+	if err = s.limiter.allowConsume(ctx, topicKey(req.Topic), 1); err != nil {
+		return nil, err
+	}
+	rec, err := s.KeyReader.ReadByKey(req.Topic, req.Key)
+	if err != nil {
+		return nil, err
+	}
+	s.limiter.consumed(topicKey(req.Topic), proto.Size(rec))
+	recordRead(ctx, req.Topic, proto.Size(rec))
+	return &api.GetByKeyResponse{Record: rec}, nil
+}
+
+func (s *grpcServer) LowestOffset(ctx context.Context, req *api.LowestOffsetRequest) (*api.LowestOffsetResponse, error) {
+	if s.OffsetRanger == nil {
+		return nil, status.Error(codes.Unimplemented, "offset ranges are not supported")
+	}
+	err := s.Authorizer.Authorize(subject(ctx), topicObject(req.Topic), getAction)
+	if err != nil {
+		return nil, err
+	}
+	offset, err := s.OffsetRanger.LowestOffset(req.Topic)
+	if err != nil {
+		return nil, err
+	}
+	return &api.LowestOffsetResponse{Offset: offset}, nil
+}
+
+func (s *grpcServer) HighestOffset(ctx context.Context, req *api.HighestOffsetRequest) (*api.HighestOffsetResponse, error) {
+	if s.OffsetRanger == nil {
+		return nil, status.Error(codes.Unimplemented, "offset ranges are not supported")
+	}
+	err := s.Authorizer.Authorize(subject(ctx), topicObject(req.Topic), getAction)
+	if err != nil {
+		return nil, err
+	}
+	offset, err := s.OffsetRanger.HighestOffset(req.Topic)
+	if err != nil {
+		return nil, err
+	}
+	return &api.HighestOffsetResponse{Offset: offset}, nil
+}
+
+// CreateStream appends the records in the order they're received and acks
+// each with its offset and the topic's durable offset. It receives at most
+// StreamLimits.CreateWindow records ahead of appending them, further ones are
+// held back by gRPC's flow control, so a fast producer waits for a slow disk
+// instead of filling up the server's memory.
+func (s *grpcServer) CreateStream(stream api.Log_CreateStreamServer) error {
+	ctx, cancel := context.WithCancel(stream.Context())
+	defer cancel()
+
+	reqs := make(chan *api.CreateRecordRequest, s.StreamLimits.createWindow()-1)
+	recvErr := make(chan error, 1)
+	go func() {
+		defer close(reqs)
+		for {
+			req, err := stream.Recv()
+			if err != nil {
+				recvErr <- err
+				return
+			}
+			select {
+			case reqs <- req:
+			case <-ctx.Done():
+				return
+			}
 		}
+	}()
 
-		err = stream.Send(res)
+	for req := range reqs {
+		res, err := s.Create(ctx, req)
+		if err != nil {
+			return err
+		}
+		res.DurableOffset, err = s.durableOffset(req.Topic)
 		if err != nil {
 			return err
 		}
+		if err = stream.Send(res); err != nil {
+			return err
+		}
 	}
+	return <-recvErr
+}
+
+func (s *grpcServer) durableOffset(topic string) (uint64, error) {
+	if s.DurabilityReporter == nil {
+		return 0, nil
+	}
+	return s.DurabilityReporter.DurableOffset(topic)
 }
 
 func (s *grpcServer) GetStream(stream api.Log_GetStreamServer) error {
@@ -140,6 +973,24 @@ func (s *grpcServer) GetStream(stream api.Log_GetStreamServer) error {
 				return err
 			}
 
+			if newBatch(req).enabled() {
+				res, err := s.getBatch(stream.Context(), req)
+				switch err.(type) {
+				case nil:
+				case api.ErrOffsetOutOfRange:
+					continue
+				default:
+					return err
+				}
+				if res == nil {
+					continue
+				}
+				if err = stream.SendMsg(res); err != nil {
+					return err
+				}
+				continue
+			}
+
 			res, err := s.Get(stream.Context(), req)
 			switch err.(type) {
 			case nil:
@@ -148,6 +999,9 @@ func (s *grpcServer) GetStream(stream api.Log_GetStreamServer) error {
 			default:
 				return err
 			}
+			if !matches(req.Filter, res.Record) {
+				continue
+			}
 
 			err = stream.Send(res)
 			if err != nil {
@@ -158,7 +1012,353 @@ func (s *grpcServer) GetStream(stream api.Log_GetStreamServer) error {
 	}
 }
 
+// ConsumeStream sends the records of the topic starting at the requested offset.
+// Once it reached the end of the log it waits for new records to be appended.
+// Offsets which were compacted or truncated away are skipped, as are
+// transaction markers, records of aborted transactions and records not
+// matching the request's filter. Batches collect the records available
+// already, they're sent once full or at the end of the log.
+func (s *grpcServer) ConsumeStream(req *api.GetRecordRequest, stream api.Log_ConsumeStreamServer) error {
+	ctx := stream.Context()
+	err := s.Authorizer.Authorize(subject(ctx), topicObject(req.Topic), getAction)
+	if err != nil {
+		return err
+	}
+
+	b := newBatch(req)
+	slow := &slowConsumer{limits: s.StreamLimits, topic: req.Topic}
+	offset := req.Offset
+	var end uint64
+	sendMsg := func(m interface{}) error {
+		var lag uint64
+		if end > offset {
+			lag = end - offset
+		}
+		err := slow.send(stream, m, lag)
+		if _, ok := err.(api.ErrSlowConsumer); ok {
+			recordSlowConsumer(ctx, req.Topic)
+		}
+		return err
+	}
+	send := func(record []byte) error {
+		if !b.enabled() {
+			return sendMsg(newEncodedResponse(record))
+		}
+		if !b.fits(record) {
+			if err := sendMsg(b.take()); err != nil {
+				return err
+			}
+		}
+		b.add(record)
+		if b.full() {
+			return sendMsg(b.take())
+		}
+		return nil
+	}
+
+	for {
+		// catching up doesn't wait, so the client may be gone meanwhile
+		if ctx.Err() != nil {
+			return nil
+		}
+		var changed <-chan struct{}
+		if s.Watcher != nil {
+			var hw *api.HighWatermark
+			hw, changed, err = s.Watcher.HighWatermark(req.Topic)
+			if err != nil {
+				return err
+			}
+			end = hw.Offset
+			if err = slow.check(offset, end); err != nil {
+				recordSlowConsumer(ctx, req.Topic)
+				return err
+			}
+		}
+
+		if s.Watcher == nil || offset < end {
+			record, ok, err := s.consume(ctx, req, offset)
+			switch err.(type) {
+			case nil:
+				if !ok {
+					offset++
+					continue
+				}
+				if err = send(record); err != nil {
+					return err
+				}
+				offset++
+				continue
+			case api.ErrOffsetOutOfRange:
+				if offset < end {
+					offset++
+					continue
+				}
+			default:
+				return err
+			}
+		}
+
+		if res := b.take(); res != nil {
+			if err = sendMsg(res); err != nil {
+				return err
+			}
+		}
+		var poll <-chan time.Time
+		if changed == nil {
+			poll = time.After(consumePollInterval)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-changed:
+		case <-poll:
+		}
+	}
+}
+
+// consume reads the encoded record at the offset for ConsumeStream, it
+// reports false if the record doesn't match the request's filter. Without a
+// filter it's read encoded, if possible, otherwise it's encoded once read.
+func (s *grpcServer) consume(ctx context.Context, req *api.GetRecordRequest, offset uint64) ([]byte, bool, error) {
+	if s.EncodedReader != nil && req.Filter == nil {
+		record, err := s.getEncoded(ctx, req.Topic, offset)
+		return record, err == nil, err
+	}
+	res, err := s.Get(ctx, &api.GetRecordRequest{Topic: req.Topic, Offset: offset})
+	if err != nil || !matches(req.Filter, res.Record) {
+		return nil, false, err
+	}
+	record, err := proto.Marshal(res.Record)
+	return record, err == nil, err
+}
+
+// Watch streams the topic's high watermark whenever it changes. Changes happening
+// while a watermark is being sent are coalesced into the next one.
+func (s *grpcServer) Watch(req *api.WatchRequest, stream api.Log_WatchServer) error {
+	if s.Watcher == nil {
+		return status.Error(codes.Unimplemented, "watching is not supported")
+	}
+	ctx := stream.Context()
+	err := s.Authorizer.Authorize(subject(ctx), topicObject(req.Topic), getAction)
+	if err != nil {
+		return err
+	}
+
+	for {
+		hw, changed, err := s.Watcher.HighWatermark(req.Topic)
+		if err != nil {
+			return err
+		}
+		if err = stream.Send(hw); err != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-changed:
+		}
+	}
+}
+
+func (s *grpcServer) SetBookmark(ctx context.Context, req *api.SetBookmarkRequest) (*api.SetBookmarkResponse, error) {
+	if s.Bookmarker == nil {
+		return nil, status.Error(codes.Unimplemented, "bookmarks are not supported")
+	}
+	err := s.Authorizer.Authorize(subject(ctx), bookmarkObject(req.Bookmark.GetName()), createAction)
+	if err != nil {
+		return nil, err
+	}
+	if req.GetBookmark().GetName() == "" {
+		return nil, status.Error(codes.InvalidArgument, "bookmark name is required")
+	}
+	err = s.Bookmarker.SetBookmark(req.Bookmark.Name, req.Bookmark.Offset)
+	if err != nil {
+		return nil, err
+	}
+	return &api.SetBookmarkResponse{}, nil
+}
+
+func (s *grpcServer) GetBookmark(ctx context.Context, req *api.GetBookmarkRequest) (*api.GetBookmarkResponse, error) {
+	if s.Bookmarker == nil {
+		return nil, status.Error(codes.Unimplemented, "bookmarks are not supported")
+	}
+	err := s.Authorizer.Authorize(subject(ctx), bookmarkObject(req.Name), getAction)
+	if err != nil {
+		return nil, err
+	}
+	offset, err := s.Bookmarker.GetBookmark(req.Name)
+	if err != nil {
+		return nil, err
+	}
+	return &api.GetBookmarkResponse{
+		Bookmark: &api.Bookmark{Name: req.Name, Offset: offset},
+	}, nil
+}
+
+func (s *grpcServer) DeleteBookmark(ctx context.Context, req *api.DeleteBookmarkRequest) (*api.DeleteBookmarkResponse, error) {
+	if s.Bookmarker == nil {
+		return nil, status.Error(codes.Unimplemented, "bookmarks are not supported")
+	}
+	err := s.Authorizer.Authorize(subject(ctx), bookmarkObject(req.Name), createAction)
+	if err != nil {
+		return nil, err
+	}
+	err = s.Bookmarker.DeleteBookmark(req.Name)
+	if err != nil {
+		return nil, err
+	}
+	return &api.DeleteBookmarkResponse{}, nil
+}
+
+// authorizeGroup checks that the subject may perform the action on the group
+// and read the topic whose offset it commits or fetches.
+func (s *grpcServer) authorizeGroup(ctx context.Context, group, topic, action string) error {
+	if s.OffsetCommitter == nil {
+		return status.Error(codes.Unimplemented, "consumer groups are not supported")
+	}
+	err := s.Authorizer.Authorize(subject(ctx), groupObject(group), action)
+	if err != nil {
+		return err
+	}
+	err = s.Authorizer.Authorize(subject(ctx), topicObject(topic), getAction)
+	if err != nil {
+		return err
+	}
+	if group == "" {
+		return status.Error(codes.InvalidArgument, "group is required")
+	}
+	return nil
+}
+
+func (s *grpcServer) CommitOffset(ctx context.Context, req *api.CommitOffsetRequest) (*api.CommitOffsetResponse, error) {
+	err := s.authorizeGroup(ctx, req.Group, req.Topic, createAction)
+	if err != nil {
+		return nil, err
+	}
+	err = s.OffsetCommitter.CommitOffset(req.Group, topicKey(req.Topic), req.Offset)
+	if err != nil {
+		return nil, err
+	}
+	return &api.CommitOffsetResponse{}, nil
+}
+
+func (s *grpcServer) FetchOffset(ctx context.Context, req *api.FetchOffsetRequest) (*api.FetchOffsetResponse, error) {
+	err := s.authorizeGroup(ctx, req.Group, req.Topic, getAction)
+	if err != nil {
+		return nil, err
+	}
+	offset, err := s.OffsetCommitter.FetchOffset(req.Group, topicKey(req.Topic))
+	if err != nil {
+		return nil, err
+	}
+	return &api.FetchOffsetResponse{Offset: offset}, nil
+}
+
+func (s *grpcServer) GetSegmentStats(ctx context.Context, req *api.GetSegmentStatsRequest) (*api.GetSegmentStatsResponse, error) {
+	if s.SegmentStatser == nil {
+		return nil, status.Error(codes.Unimplemented, "segment stats are not supported")
+	}
+	err := s.Authorizer.Authorize(subject(ctx), topicObject(req.Topic), adminAction)
+	if err != nil {
+		return nil, err
+	}
+	segments, err := s.SegmentStatser.SegmentStats(req.Topic)
+	if err != nil {
+		return nil, err
+	}
+	return &api.GetSegmentStatsResponse{Segments: segments}, nil
+}
+
+func (s *grpcServer) GetLogStats(ctx context.Context, req *api.GetLogStatsRequest) (*api.GetLogStatsResponse, error) {
+	if s.LogStatser == nil {
+		return nil, status.Error(codes.Unimplemented, "log stats are not supported")
+	}
+	err := s.Authorizer.Authorize(subject(ctx), topicObject(req.Topic), adminAction)
+	if err != nil {
+		return nil, err
+	}
+	stats, err := s.LogStatser.Stats(req.Topic)
+	if err != nil {
+		return nil, err
+	}
+	return &api.GetLogStatsResponse{Stats: stats}, nil
+}
+
+func (s *grpcServer) Verify(ctx context.Context, req *api.VerifyRequest) (*api.VerifyResponse, error) {
+	if s.Verifier == nil {
+		return nil, status.Error(codes.Unimplemented, "verifying is not supported")
+	}
+	err := s.Authorizer.Authorize(subject(ctx), topicObject(req.Topic), adminAction)
+	if err != nil {
+		return nil, err
+	}
+	report, err := s.Verifier.Verify(req.Topic, req.Repair)
+	if err != nil {
+		return nil, err
+	}
+	return &api.VerifyResponse{Report: report}, nil
+}
+
+func (s *grpcServer) Truncate(ctx context.Context, req *api.TruncateRequest) (*api.TruncateResponse, error) {
+	if s.Truncater == nil {
+		return nil, status.Error(codes.Unimplemented, "truncating is not supported")
+	}
+	err := s.Authorizer.Authorize(subject(ctx), topicObject(req.Topic), adminAction)
+	if err != nil {
+		return nil, err
+	}
+	err = s.Truncater.Truncate(req.Topic, req.Lowest)
+	if err != nil {
+		return nil, err
+	}
+	return &api.TruncateResponse{}, nil
+}
+
+// DeleteBefore deletes the topic's records below the offset.
+func (s *grpcServer) DeleteBefore(ctx context.Context, req *api.DeleteBeforeRequest) (*api.DeleteBeforeResponse, error) {
+	if s.RecordDeleter == nil {
+		return nil, status.Error(codes.Unimplemented, "deleting records is not supported")
+	}
+	err := s.Authorizer.Authorize(subject(ctx), topicObject(req.Topic), adminAction)
+	if err != nil {
+		return nil, err
+	}
+	start, err := s.RecordDeleter.DeleteBefore(req.Topic, req.Offset)
+	if err != nil {
+		return nil, err
+	}
+	return &api.DeleteBeforeResponse{LogStartOffset: start}, nil
+}
+
+// Backup streams a copy of the topic's records in chunks.
+func (s *grpcServer) Backup(req *api.BackupRequest, stream api.Log_BackupServer) error {
+	if s.Backuper == nil {
+		return status.Error(codes.Unimplemented, "backups are not supported")
+	}
+	err := s.Authorizer.Authorize(subject(stream.Context()), topicObject(req.Topic), adminAction)
+	if err != nil {
+		return err
+	}
+	return s.Backuper.Backup(req.Topic, chunkWriter{stream})
+}
+
+// chunkWriter sends each write as a backup chunk.
+type chunkWriter struct {
+	stream api.Log_BackupServer
+}
+
+func (w chunkWriter) Write(p []byte) (int, error) {
+	if err := w.stream.Send(&api.BackupChunk{Data: p}); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
 func (s *grpcServer) GetServers(ctx context.Context, req *api.GetServersRequest) (*api.GetServersResponse, error) {
+	if s.GetServerer == nil {
+		return nil, status.Error(codes.Unimplemented, "cluster topology is not supported")
+	}
 	servers, err := s.GetServerer.GetServers()
 	if err != nil {
 		return nil, err
@@ -166,48 +1366,148 @@ func (s *grpcServer) GetServers(ctx context.Context, req *api.GetServersRequest)
 	return &api.GetServersResponse{Servers: servers}, nil
 }
 
+// Join adds the server to the raft cluster, as read replica with nonvoter.
+func (s *grpcServer) Join(ctx context.Context, req *api.JoinRequest) (*api.JoinResponse, error) {
+	if s.MembershipChanger == nil {
+		return nil, status.Error(codes.Unimplemented, "membership changes are not supported")
+	}
+	err := s.Authorizer.Authorize(subject(ctx), clusterObject, adminAction)
+	if err != nil {
+		return nil, err
+	}
+	if req.Id == "" || req.Addr == "" {
+		return nil, status.Error(codes.InvalidArgument, "id and addr are required")
+	}
+	if req.Nonvoter {
+		err = s.MembershipChanger.JoinNonvoter(req.Id, req.Addr, req.Zone)
+	} else {
+		err = s.MembershipChanger.JoinZone(req.Id, req.Addr, req.Zone)
+	}
+	if leader, fctx, ok := s.forward(ctx, err); ok {
+		return leader.Join(fctx, req)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &api.JoinResponse{}, nil
+}
+
+// Leave removes the server from the raft cluster.
+func (s *grpcServer) Leave(ctx context.Context, req *api.LeaveRequest) (*api.LeaveResponse, error) {
+	if s.MembershipChanger == nil {
+		return nil, status.Error(codes.Unimplemented, "membership changes are not supported")
+	}
+	err := s.Authorizer.Authorize(subject(ctx), clusterObject, adminAction)
+	if err != nil {
+		return nil, err
+	}
+	if req.Id == "" {
+		return nil, status.Error(codes.InvalidArgument, "id is required")
+	}
+	err = s.MembershipChanger.Leave(req.Id)
+	if leader, fctx, ok := s.forward(ctx, err); ok {
+		return leader.Leave(fctx, req)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &api.LeaveResponse{}, nil
+}
+
+// ReloadConfig re-reads the config of the server it's sent to.
+func (s *grpcServer) ReloadConfig(ctx context.Context, req *api.ReloadConfigRequest) (*api.ReloadConfigResponse, error) {
+	if s.ConfigReloader == nil {
+		return nil, status.Error(codes.Unimplemented, "reloading the config is not supported")
+	}
+	err := s.Authorizer.Authorize(subject(ctx), configObject, adminAction)
+	if err != nil {
+		return nil, err
+	}
+	changes, err := s.ConfigReloader.ReloadConfig(req.DryRun)
+	if err != nil {
+		return nil, err
+	}
+	return &api.ReloadConfigResponse{Changes: changes}, nil
+}
+
 func NewGRPCServer(config *Config, opts ...grpc.ServerOption) (*grpc.Server, error) {
 
-	logger := zap.L().Named("server")
-	zapOpts := []grpc_zap.Option{
-		grpc_zap.WithDurationField(
-			func(duration time.Duration) zapcore.Field {
-				return zap.Int64(
-					"grpc.time_ns",
-					duration.Nanoseconds(),
-				)
-			},
-		),
+	requestLogger := config.RequestLogger
+	if requestLogger == nil {
+		requestLogger = NewRequestLogger(RequestLogConfig{})
+	}
+
+	authenticators := config.Authenticators
+	if authenticators == nil {
+		authenticators = []Authenticator{TLSAuthenticator{}}
 	}
+	authenticate := authenticator(authenticators)
+	peerAuth := peerAuthenticator(authenticators)
 
-	trace.ApplyConfig(trace.Config{DefaultSampler: trace.AlwaysSample()})
-	err := view.Register(ocgrpc.DefaultServerViews...)
+	sampler := config.TraceSampler
+	if sampler == nil {
+		sampler = trace.AlwaysSample()
+	}
+	err := registerViews()
 	if err != nil {
 		return nil, err
 	}
 
+	streamInterceptors := []grpc.StreamServerInterceptor{
+		traceStream(sampler),
+		grpc_ctxtags.StreamServerInterceptor(),
+		requestLogger.stream(),
+		grpc_auth.StreamServerInterceptor(authenticate),
+		trustForwardedStream(peerAuth, config.PeerSubjects),
+		scopeTenantStreams(config.TenantResolvers),
+	}
+	streamInterceptors = append(streamInterceptors, config.StreamInterceptors...)
+	streamInterceptors = append(streamInterceptors,
+		countStreams,
+		limitStreams(config.StreamLimits),
+		validateStreams(config.SchemaValidator),
+		injectStreamFaults(config.Faults),
+	)
+	clientLimiter := config.ClientRateLimiter
+	if clientLimiter == nil {
+		clientLimiter = NewRateLimiter(config.ClientRateLimits)
+	}
+	unaryInterceptors := []grpc.UnaryServerInterceptor{
+		traceUnary(sampler),
+		grpc_ctxtags.UnaryServerInterceptor(),
+		requestLogger.unary(),
+		grpc_auth.UnaryServerInterceptor(authenticate),
+		trustForwardedUnary(peerAuth, config.PeerSubjects),
+		scopeTenants(config.TenantResolvers),
+	}
+	unaryInterceptors = append(unaryInterceptors, config.UnaryInterceptors...)
+	unaryInterceptors = append(unaryInterceptors,
+		limitClients(clientLimiter),
+		validateRecords(config.SchemaValidator),
+	)
+
 	grpcOpts := []grpc.ServerOption{
-		grpc.StreamInterceptor(
-			grpc_middleware.ChainStreamServer(
-				grpc_ctxtags.StreamServerInterceptor(),
-				grpc_zap.StreamServerInterceptor(logger, zapOpts...),
-				grpc_auth.StreamServerInterceptor(authenticate),
-			),
-		),
-		grpc.UnaryInterceptor(grpc_middleware.ChainUnaryServer(
-			grpc_ctxtags.UnaryServerInterceptor(),
-			grpc_zap.UnaryServerInterceptor(logger, zapOpts...),
-			grpc_auth.UnaryServerInterceptor(authenticate),
-		)),
-		grpc.StatsHandler(&ocgrpc.ServerHandler{}),
+		grpc.ForceServerCodec(codec{}),
+		grpc.StreamInterceptor(grpc_middleware.ChainStreamServer(streamInterceptors...)),
+		grpc.UnaryInterceptor(grpc_middleware.ChainUnaryServer(unaryInterceptors...)),
+		// ocgrpc records the RPC stats, the spans are left to traceUnary and traceStream
+		grpc.StatsHandler(&ocgrpc.ServerHandler{StartOptions: trace.StartOptions{Sampler: trace.NeverSample()}}),
 	}
+	grpcOpts = append(grpcOpts, config.Transport.serverOptions()...)
 
 	opts = append(opts, grpcOpts...)
 	gsrv := grpc.NewServer(opts...)
 
+	// the server as a whole is serving while the process is up, the log
+	// service only once the node is ready
 	hsrv := health.NewServer()
 	hsrv.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+	hsrv.SetServingStatus(api.Log_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_SERVING)
 	healthpb.RegisterHealthServer(gsrv, hsrv)
+	if config.Readier != nil {
+		hsrv.SetServingStatus(api.Log_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_NOT_SERVING)
+		go reportReadiness(hsrv, config.Readier)
+	}
 
 	srv, err := newGRPCServer(config)
 	if err != nil {
@@ -215,5 +1515,42 @@ func NewGRPCServer(config *Config, opts ...grpc.ServerOption) (*grpc.Server, err
 	}
 
 	api.RegisterLogServer(gsrv, srv)
+	api.RegisterAdminServer(gsrv, srv)
+	if config.Reflection {
+		reflection.Register(gsrv)
+	}
 	return gsrv, nil
 }
+
+// reportReadiness updates the log service's health until the node stopped.
+func reportReadiness(hsrv *health.Server, readier Readier) {
+	for {
+		ready, changed := readier.Ready()
+		status := healthpb.HealthCheckResponse_NOT_SERVING
+		if ready {
+			status = healthpb.HealthCheckResponse_SERVING
+		}
+		hsrv.SetServingStatus(api.Log_ServiceDesc.ServiceName, status)
+		if changed == nil {
+			return
+		}
+		<-changed
+	}
+}
+
+// GracefulStop stops the server from accepting new RPCs and waits for the
+// running ones to finish. RPCs still running after the grace period, like
+// streams tailing a topic, are cancelled.
+func GracefulStop(gsrv *grpc.Server, grace time.Duration) {
+	stopped := make(chan struct{})
+	go func() {
+		gsrv.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(grace):
+		gsrv.Stop()
+		<-stopped
+	}
+}
@@ -1,11 +1,15 @@
 package server
 
 import (
+	"bytes"
 	"context"
 	"flag"
+	"io"
 	"net"
 	"os"
+	"sync"
 	"testing"
+	"time"
 
 	api "github.com/justagabriel/proglog/api/v1"
 	"github.com/justagabriel/proglog/internal"
@@ -13,12 +17,20 @@ import (
 	"github.com/justagabriel/proglog/internal/log"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/zap"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/connectivity"
 	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 var debug = flag.Bool("debug", false, "Enable observability for debugging.")
@@ -42,6 +54,7 @@ func TestServer(t *testing.T) {
 		"consume past log boundary fails":               testGetPastBoundary,
 		"create/get a stream succeeds":                  testCreateGetStream,
 		"unauthorized client is not served":             testUnauthorized,
+		"topics are read separately":                    testTopics,
 	}
 
 	for title, scenario := range scenarios {
@@ -57,7 +70,8 @@ func testCreateGet(t *testing.T, authorizedClient api.LogClient, unauthorizedCli
 	// arrange
 	ctx := context.Background()
 	want := &api.Record{
-		Value: []byte("hello world"),
+		Value:   []byte("hello world"),
+		Headers: []*api.Header{{Key: "content-type", Value: []byte("text/plain")}},
 	}
 
 	createResp, err := authorizedClient.Create(
@@ -79,6 +93,35 @@ func testCreateGet(t *testing.T, authorizedClient api.LogClient, unauthorizedCli
 	require.NoError(t, err)
 	require.Equal(t, want.Value, getResp.Record.Value)
 	require.Equal(t, want.Offset, getResp.Record.Offset)
+	require.Len(t, getResp.Record.Headers, 1)
+	require.Equal(t, "content-type", getResp.Record.Headers[0].Key)
+	require.Equal(t, []byte("text/plain"), getResp.Record.Headers[0].Value)
+}
+
+func testTopics(t *testing.T, authorizedClient api.LogClient, unauthorizedClient api.LogClient, config *Config) {
+	// arrange
+	ctx := context.Background()
+	for _, topic := range []string{"orders", "payments"} {
+		_, err := authorizedClient.Create(ctx, &api.CreateRecordRequest{
+			Topic:  topic,
+			Record: &api.Record{Value: []byte(topic)},
+		})
+		require.NoError(t, err)
+	}
+
+	// act
+	getResp, err := authorizedClient.Get(ctx, &api.GetRecordRequest{Topic: "payments", Offset: 0})
+	_, defaultErr := authorizedClient.Get(ctx, &api.GetRecordRequest{Offset: 0})
+	_, invalidErr := authorizedClient.Create(ctx, &api.CreateRecordRequest{
+		Topic:  "../orders",
+		Record: &api.Record{Value: []byte("escape")},
+	})
+
+	// assert
+	require.NoError(t, err)
+	require.Equal(t, []byte("payments"), getResp.Record.Value)
+	require.Equal(t, status.Code(api.ErrOffsetOutOfRange{}.GRPCStatus().Err()), status.Code(defaultErr))
+	require.Equal(t, codes.InvalidArgument, status.Code(invalidErr))
 }
 
 func testGetPastBoundary(t *testing.T, authorizedClient api.LogClient, authorizedclient api.LogClient, config *Config) {
@@ -116,7 +159,7 @@ func testCreateGetStream(t *testing.T, authorizedClient api.LogClient, unauthori
 	// arrange
 	ctx := context.Background()
 
-	records := []api.Record{
+	records := []*api.Record{
 		{
 			Value:  []byte("hello world 1!"),
 			Offset: 0,
@@ -135,7 +178,7 @@ func testCreateGetStream(t *testing.T, authorizedClient api.LogClient, unauthori
 
 	for offset, record := range records {
 		createReq := &api.CreateRecordRequest{
-			Record: &record,
+			Record: record,
 		}
 		err = stream.Send(createReq)
 		require.NoError(t, err)
@@ -158,10 +201,9 @@ func testCreateGetStream(t *testing.T, authorizedClient api.LogClient, unauthori
 		require.NoError(t, err)
 		res, err := getStream.Recv()
 		require.NoError(t, err)
-		require.Equal(t, res.Record, &api.Record{
-			Value:  record.Value,
-			Offset: uint64(i),
-		})
+		require.Equal(t, record.Value, res.Record.Value)
+		require.Equal(t, uint64(i), res.Record.Offset)
+		require.NotNil(t, res.Record.Timestamp)
 	}
 }
 
@@ -198,43 +240,1360 @@ func testUnauthorized(t *testing.T, authorizedClient api.LogClient, unauthorized
 	}
 }
 
-func TestServerRequiresClientTLSCert(t *testing.T) {
+func TestServerRateLimits(t *testing.T) {
 	// arrange
-	l, err := net.Listen("tcp", "localhost:0")
+	testSetup := SetupTest(t, func(c *Config) {
+		c.RateLimits.Produce.RecordsPerSecond = 1
+		c.RateLimits.Consume.RecordsPerSecond = 1
+	}, debug)
+	defer testSetup.Teardown()
+
+	ctx := context.Background()
+	createReq := &api.CreateRecordRequest{
+		Record: &api.Record{Value: []byte("hello world")},
+	}
+
+	// act
+	_, err := testSetup.AuthorizedClient.Create(ctx, createReq)
 	require.NoError(t, err)
+	_, err = testSetup.AuthorizedClient.Create(ctx, createReq)
 
-	serverTLSConfig, err := config.SetupTLSConfig(config.TLSConfig{
-		CertFile:      config.ServerCertFile,
-		KeyFile:       config.ServerKeyFile,
-		CAFile:        config.CAFile,
-		ServerAddress: l.Addr().String(),
-		Server:        true,
+	// assert
+	st := status.Convert(err)
+	require.Equal(t, codes.ResourceExhausted, st.Code())
+	require.Len(t, st.Details(), 1)
+	retryInfo, ok := st.Details()[0].(*errdetails.RetryInfo)
+	require.True(t, ok)
+	require.True(t, retryInfo.RetryDelay.AsDuration() > 0)
+
+	// act
+	_, err = testSetup.AuthorizedClient.Get(ctx, &api.GetRecordRequest{Offset: 0})
+	require.NoError(t, err)
+	var header metadata.MD
+	_, err = testSetup.AuthorizedClient.Get(ctx, &api.GetRecordRequest{Offset: 0}, grpc.Header(&header))
+
+	// assert
+	require.Equal(t, codes.ResourceExhausted, status.Code(err))
+	require.Equal(t, []string{"1"}, header.Get(retryAfterKey))
+}
+
+func TestServerGetRangeRateLimits(t *testing.T) {
+	// arrange
+	testSetup := SetupTest(t, func(c *Config) {
+		c.RateLimits.Consume.RecordsPerSecond = 1
+	}, debug)
+	defer testSetup.Teardown()
+	ctx := context.Background()
+	for _, value := range []string{"first", "second", "third"} {
+		_, err := testSetup.AuthorizedClient.Create(ctx, &api.CreateRecordRequest{
+			Record: &api.Record{Value: []byte(value)},
+		})
+		require.NoError(t, err)
+	}
+
+	// act
+	res, err := testSetup.AuthorizedClient.GetRange(ctx, &api.GetRangeRequest{})
+	require.NoError(t, err)
+	_, err = testSetup.AuthorizedClient.GetRange(ctx, &api.GetRangeRequest{FromOffset: res.NextOffset})
+
+	// assert
+	require.Len(t, res.Records, 3, "the limit is checked once per range")
+	require.Equal(t, codes.ResourceExhausted, status.Code(err), "the range's records are charged")
+}
+
+func TestServerClientRateLimits(t *testing.T) {
+	// arrange
+	testSetup := SetupTest(t, func(c *Config) {
+		c.ClientRateLimits.Produce.RecordsPerSecond = 1
+	}, debug)
+	defer testSetup.Teardown()
+	ctx := context.Background()
+	_, err := testSetup.AuthorizedClient.Create(ctx, &api.CreateRecordRequest{
+		Topic:  "first",
+		Record: &api.Record{Value: []byte("hello world")},
 	})
 	require.NoError(t, err)
-	serverCreds := credentials.NewTLS(serverTLSConfig)
 
-	dir := internal.GetTempDir(t, "server-test")
-	clog, err := log.NewLog(dir, log.Config{})
+	// act
+	var header metadata.MD
+	_, err = testSetup.AuthorizedClient.Create(ctx, &api.CreateRecordRequest{
+		Topic:  "second",
+		Record: &api.Record{Value: []byte("hello world")},
+	}, grpc.Header(&header))
+	_, otherErr := testSetup.UnauthorizedClient.Create(ctx, &api.CreateRecordRequest{
+		Record: &api.Record{Value: []byte("hello world")},
+	})
+
+	// assert
+	st := status.Convert(err)
+	require.Equal(t, codes.ResourceExhausted, st.Code(), "the limit spans topics")
+	require.Len(t, st.Details(), 1)
+	_, ok := st.Details()[0].(*errdetails.RetryInfo)
+	require.True(t, ok)
+	require.Equal(t, []string{"1"}, header.Get(retryAfterKey))
+	require.Equal(t, codes.PermissionDenied, status.Code(otherErr), "other clients have their own limit")
+}
+
+func TestServerTimestamps(t *testing.T) {
+	// arrange
+	testSetup := SetupTest(t, nil, debug)
+	defer testSetup.Teardown()
+	ctx := context.Background()
+	before := time.Now()
+
+	// act
+	res, err := testSetup.AuthorizedClient.Create(ctx, &api.CreateRecordRequest{
+		Record: &api.Record{Value: []byte("hello world"), Timestamp: timestamppb.New(before.Add(time.Hour))},
+	})
 	require.NoError(t, err)
 
-	cfg := &Config{
-		CommitLog: clog,
+	// assert
+	got, err := testSetup.AuthorizedClient.Get(ctx, &api.GetRecordRequest{Offset: res.Offset})
+	require.NoError(t, err)
+	require.False(t, got.Record.Timestamp.AsTime().Before(before))
+	require.True(t, got.Record.Timestamp.AsTime().Before(before.Add(time.Minute)), "client timestamps are dropped")
+}
+
+func TestServerGetMany(t *testing.T) {
+	// arrange
+	testSetup := SetupTest(t, nil, debug)
+	defer testSetup.Teardown()
+	ctx := context.Background()
+	for _, value := range []string{"first", "second", "third"} {
+		_, err := testSetup.AuthorizedClient.Create(ctx, &api.CreateRecordRequest{
+			Record: &api.Record{Value: []byte(value)},
+		})
+		require.NoError(t, err)
 	}
-	server, err := NewGRPCServer(cfg, grpc.Creds(serverCreds))
+
+	// act
+	res, err := testSetup.AuthorizedClient.GetMany(ctx, &api.GetManyRequest{
+		Offsets: []uint64{2, 7, 0},
+	})
+
+	// assert
 	require.NoError(t, err)
+	require.Len(t, res.Results, 3)
+	require.Equal(t, []byte("third"), res.Results[0].GetRecord().Value)
+	require.Equal(t, uint64(7), res.Results[1].Offset)
+	require.Nil(t, res.Results[1].GetRecord())
+	require.NotNil(t, res.Results[1].GetError())
+	require.Equal(t, []byte("first"), res.Results[2].GetRecord().Value)
+}
 
-	go func() {
-		server.Serve(l)
-	}()
+func TestServerGetRange(t *testing.T) {
+	scenarios := map[string]func(t *testing.T, client api.LogClient){
+		"ranges page through the topic":     testGetRangePages,
+		"max bytes leave at least a record": testGetRangeMaxBytes,
+		"unreadable offsets are skipped":    testGetRangeGaps,
+		"empty topics have empty ranges":    testGetRangeEmpty,
+	}
 
-	credsWithoutTLSCert := grpc.WithTransportCredentials(insecure.NewCredentials())
+	for scenario, fn := range scenarios {
+		t.Run(scenario, func(t *testing.T) {
+			testSetup := SetupTest(t, nil, debug)
+			defer testSetup.Teardown()
+			fn(t, testSetup.AuthorizedClient)
+		})
+	}
+}
+
+func testGetRangePages(t *testing.T, client api.LogClient) {
+	// arrange
+	ctx := context.Background()
+	for _, value := range []string{"first", "second", "third"} {
+		_, err := client.Create(ctx, &api.CreateRecordRequest{Record: &api.Record{Value: []byte(value)}})
+		require.NoError(t, err)
+	}
 
 	// act
-	clientConnection, err := grpc.Dial(l.Addr().String(), credsWithoutTLSCert)
+	var values []string
+	var pages int
+	req := &api.GetRangeRequest{MaxRecords: 2}
+	for {
+		res, err := client.GetRange(ctx, req)
+		require.NoError(t, err)
+		if len(res.Records) == 0 {
+			require.Equal(t, uint64(3), res.NextOffset)
+			break
+		}
+		pages++
+		for _, record := range res.Records {
+			values = append(values, string(record.Value))
+		}
+		req.FromOffset = res.NextOffset
+	}
 
 	// assert
-	state := clientConnection.GetState().String()
-	println(state)
-	require.NoError(t, err, "the connection it self should work, only the auth should fail.")
-	require.NotEqual(t, clientConnection.GetState(), connectivity.Ready, "should be unable to connect due to missing TLS cert")
+	require.Equal(t, []string{"first", "second", "third"}, values)
+	require.Equal(t, 2, pages)
+}
+
+func testGetRangeMaxBytes(t *testing.T, client api.LogClient) {
+	// arrange
+	ctx := context.Background()
+	for _, value := range []string{"first", "second"} {
+		_, err := client.Create(ctx, &api.CreateRecordRequest{Record: &api.Record{Value: []byte(value)}})
+		require.NoError(t, err)
+	}
+
+	// act
+	res, err := client.GetRange(ctx, &api.GetRangeRequest{MaxBytes: 1})
+
+	// assert
+	require.NoError(t, err)
+	require.Len(t, res.Records, 1)
+	require.Equal(t, "first", string(res.Records[0].Value))
+	require.Equal(t, uint64(1), res.NextOffset)
+}
+
+func testGetRangeGaps(t *testing.T, client api.LogClient) {
+	// arrange
+	ctx := context.Background()
+	_, err := client.Create(ctx, &api.CreateRecordRequest{Record: &api.Record{Value: []byte("first")}})
+	require.NoError(t, err)
+	// the transaction's commit marker follows its record
+	_, err = client.CreateTransaction(ctx, &api.CreateTransactionRequest{Appends: []*api.TopicRecords{
+		{Records: []*api.Record{{Value: []byte("second")}}},
+	}})
+	require.NoError(t, err)
+	_, err = client.Create(ctx, &api.CreateRecordRequest{Record: &api.Record{Value: []byte("third")}})
+	require.NoError(t, err)
+
+	// act
+	res, err := client.GetRange(ctx, &api.GetRangeRequest{})
+
+	// assert
+	require.NoError(t, err)
+	require.Len(t, res.Records, 3)
+	require.Equal(t, []uint64{0, 1, 3}, []uint64{res.Records[0].Offset, res.Records[1].Offset, res.Records[2].Offset})
+	require.Equal(t, uint64(4), res.NextOffset)
+}
+
+func testGetRangeEmpty(t *testing.T, client api.LogClient) {
+	// act
+	res, err := client.GetRange(context.Background(), &api.GetRangeRequest{})
+
+	// assert
+	require.NoError(t, err)
+	require.Empty(t, res.Records)
+	require.Zero(t, res.NextOffset)
+}
+
+func TestServerSegmentStats(t *testing.T) {
+	// arrange
+	testSetup := SetupTest(t, nil, debug)
+	defer testSetup.Teardown()
+	ctx := context.Background()
+	_, err := testSetup.AuthorizedClient.Create(ctx, &api.CreateRecordRequest{
+		Record: &api.Record{Value: []byte("hello world")},
+	})
+	require.NoError(t, err)
+
+	// act
+	res, err := testSetup.AuthorizedClient.GetSegmentStats(ctx, &api.GetSegmentStatsRequest{})
+	_, unauthorizedErr := testSetup.UnauthorizedClient.GetSegmentStats(ctx, &api.GetSegmentStatsRequest{})
+
+	// assert
+	require.NoError(t, err)
+	require.Len(t, res.Segments, 1)
+	segment := res.Segments[0]
+	require.Equal(t, uint64(0), segment.BaseOffset)
+	require.Equal(t, uint64(1), segment.NextOffset)
+	require.True(t, segment.StoreBytes > 0)
+	require.True(t, segment.Active)
+	require.Equal(t, codes.PermissionDenied, status.Code(unauthorizedErr))
+}
+
+func TestServerLogStats(t *testing.T) {
+	// arrange
+	testSetup := SetupTest(t, nil, debug)
+	defer testSetup.Teardown()
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		_, err := testSetup.AuthorizedClient.Create(ctx, &api.CreateRecordRequest{
+			Record: &api.Record{Value: []byte("hello world")},
+		})
+		require.NoError(t, err)
+	}
+
+	// act
+	res, err := testSetup.AuthorizedClient.GetLogStats(ctx, &api.GetLogStatsRequest{})
+	unknown, unknownErr := testSetup.AuthorizedClient.GetLogStats(ctx, &api.GetLogStatsRequest{Topic: "unknown"})
+	_, unauthorizedErr := testSetup.UnauthorizedClient.GetLogStats(ctx, &api.GetLogStatsRequest{})
+
+	// assert
+	require.NoError(t, err)
+	stats := res.Stats
+	require.Equal(t, uint64(0), stats.LowestOffset)
+	require.Equal(t, uint64(1), stats.HighestOffset)
+	require.Equal(t, uint64(1), stats.SegmentCount)
+	require.Equal(t, stats.Segments[0].StoreBytes+stats.Segments[0].IndexBytes, stats.TotalBytes)
+	require.True(t, stats.Segments[0].IndexUtilization > 0)
+	require.NoError(t, unknownErr)
+	require.Zero(t, unknown.Stats.SegmentCount)
+	require.Equal(t, codes.PermissionDenied, status.Code(unauthorizedErr))
+}
+
+func TestServerVerify(t *testing.T) {
+	// arrange
+	testSetup := SetupTest(t, nil, debug)
+	defer testSetup.Teardown()
+	ctx := context.Background()
+	_, err := testSetup.AuthorizedClient.Create(ctx, &api.CreateRecordRequest{
+		Record: &api.Record{Value: []byte("hello world")},
+	})
+	require.NoError(t, err)
+
+	// act
+	res, err := testSetup.AuthorizedClient.Verify(ctx, &api.VerifyRequest{Repair: true})
+	_, unauthorizedErr := testSetup.UnauthorizedClient.Verify(ctx, &api.VerifyRequest{})
+
+	// assert
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), res.Report.Records)
+	require.Empty(t, res.Report.Inconsistencies)
+	require.False(t, res.Report.Repaired)
+	require.Equal(t, codes.PermissionDenied, status.Code(unauthorizedErr))
+}
+
+func TestServerTruncate(t *testing.T) {
+	// arrange
+	logConfig := log.Config{}
+	logConfig.Segment.MaxStoreBytes = 32
+	clog, err := log.NewInMemory(logConfig)
+	require.NoError(t, err)
+	defer clog.Remove()
+	testSetup := SetupTest(t, func(c *Config) {
+		c.CommitLog = clog
+		c.Truncater = clog
+	}, debug)
+	defer testSetup.Teardown()
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		_, err = testSetup.AuthorizedClient.Create(ctx, &api.CreateRecordRequest{
+			Record: &api.Record{Value: []byte("hello world")},
+		})
+		require.NoError(t, err)
+	}
+
+	// act
+	_, err = testSetup.AuthorizedClient.Truncate(ctx, &api.TruncateRequest{Lowest: 1})
+	_, unauthorizedErr := testSetup.UnauthorizedClient.Truncate(ctx, &api.TruncateRequest{Lowest: 1})
+
+	// assert
+	require.NoError(t, err)
+	_, err = testSetup.AuthorizedClient.Get(ctx, &api.GetRecordRequest{Offset: 0})
+	require.Equal(t, status.Code(api.ErrOffsetOutOfRange{}.GRPCStatus().Err()), status.Code(err))
+	_, err = testSetup.AuthorizedClient.Get(ctx, &api.GetRecordRequest{Offset: 2})
+	require.NoError(t, err)
+	require.Equal(t, codes.PermissionDenied, status.Code(unauthorizedErr))
+}
+
+func TestServerDeleteBefore(t *testing.T) {
+	// arrange
+	logConfig := log.Config{}
+	logConfig.Segment.MaxStoreBytes = 32
+	clog, err := log.NewInMemory(logConfig)
+	require.NoError(t, err)
+	defer clog.Remove()
+	testSetup := SetupTest(t, func(c *Config) {
+		c.CommitLog = clog
+		c.RecordDeleter = clog
+	}, debug)
+	defer testSetup.Teardown()
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		_, err = testSetup.AuthorizedClient.Create(ctx, &api.CreateRecordRequest{
+			Record: &api.Record{Value: []byte("hello world")},
+		})
+		require.NoError(t, err)
+	}
+
+	// act
+	res, err := testSetup.AuthorizedClient.DeleteBefore(ctx, &api.DeleteBeforeRequest{Offset: 2})
+	_, unauthorizedErr := testSetup.UnauthorizedClient.DeleteBefore(ctx, &api.DeleteBeforeRequest{Offset: 2})
+
+	// assert
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), res.LogStartOffset)
+	_, err = testSetup.AuthorizedClient.Get(ctx, &api.GetRecordRequest{Offset: 1})
+	outOfRange, ok := api.OffsetOutOfRangeFromError(err)
+	require.True(t, ok)
+	require.Equal(t, api.ErrOffsetOutOfRange{Offset: 1, LogStartOffset: 2, HighestOffset: 2}, outOfRange)
+	_, err = testSetup.AuthorizedClient.Get(ctx, &api.GetRecordRequest{Offset: 2})
+	require.NoError(t, err)
+	require.Equal(t, codes.PermissionDenied, status.Code(unauthorizedErr))
+}
+
+func TestServerOffsetRange(t *testing.T) {
+	// arrange
+	logConfig := log.Config{}
+	logConfig.Segment.MaxStoreBytes = 32
+	clog, err := log.NewInMemory(logConfig)
+	require.NoError(t, err)
+	defer clog.Remove()
+	testSetup := SetupTest(t, func(c *Config) {
+		c.CommitLog = clog
+		c.RecordDeleter = clog
+		c.OffsetRanger = clog
+	}, debug)
+	defer testSetup.Teardown()
+	ctx := context.Background()
+	for i := 0; i < 4; i++ {
+		_, err = testSetup.AuthorizedClient.Create(ctx, &api.CreateRecordRequest{
+			Record: &api.Record{Value: []byte("hello world")},
+		})
+		require.NoError(t, err)
+	}
+	_, err = testSetup.AuthorizedClient.DeleteBefore(ctx, &api.DeleteBeforeRequest{Offset: 1})
+	require.NoError(t, err)
+
+	// act
+	lowest, err := testSetup.AuthorizedClient.LowestOffset(ctx, &api.LowestOffsetRequest{})
+	require.NoError(t, err)
+	highest, err := testSetup.AuthorizedClient.HighestOffset(ctx, &api.HighestOffsetRequest{})
+	require.NoError(t, err)
+	_, unauthorizedErr := testSetup.UnauthorizedClient.HighestOffset(ctx, &api.HighestOffsetRequest{})
+
+	// assert
+	require.Equal(t, uint64(1), lowest.Offset)
+	require.Equal(t, uint64(3), highest.Offset)
+	_, err = testSetup.AuthorizedClient.Get(ctx, &api.GetRecordRequest{Offset: 4})
+	outOfRange, ok := api.OffsetOutOfRangeFromError(err)
+	require.True(t, ok)
+	require.Equal(t, api.ErrOffsetOutOfRange{Offset: 4, LogStartOffset: 1, HighestOffset: 3}, outOfRange)
+	require.Equal(t, codes.PermissionDenied, status.Code(unauthorizedErr))
+}
+
+func TestServerGetServersUnimplemented(t *testing.T) {
+	// arrange
+	testSetup := SetupTest(t, nil, debug)
+	defer testSetup.Teardown()
+
+	// act
+	_, err := testSetup.AuthorizedClient.GetServers(context.Background(), &api.GetServersRequest{})
+
+	// assert
+	require.Equal(t, codes.Unimplemented, status.Code(err))
+}
+
+// members records the membership changes, true for voters.
+type members map[string]bool
+
+func (m members) JoinZone(id, addr, zone string) error {
+	m[id] = true
+	return nil
+}
+
+func (m members) JoinNonvoter(id, addr, zone string) error {
+	m[id] = false
+	return nil
+}
+
+func (m members) Leave(id string) error {
+	delete(m, id)
+	return nil
+}
+
+func TestServerMembership(t *testing.T) {
+	// arrange
+	m := members{}
+	testSetup := SetupTest(t, func(c *Config) {
+		c.MembershipChanger = m
+	}, debug)
+	defer testSetup.Teardown()
+	ctx := context.Background()
+
+	// act
+	_, err := testSetup.AuthorizedClient.Join(ctx, &api.JoinRequest{Id: "1", Addr: "127.0.0.1:8401"})
+	require.NoError(t, err)
+	_, err = testSetup.AuthorizedClient.Join(ctx, &api.JoinRequest{Id: "2", Addr: "127.0.0.1:8402", Nonvoter: true})
+	require.NoError(t, err)
+	_, err = testSetup.AuthorizedClient.Join(ctx, &api.JoinRequest{Id: "3", Addr: "127.0.0.1:8403"})
+	require.NoError(t, err)
+	_, err = testSetup.AuthorizedClient.Leave(ctx, &api.LeaveRequest{Id: "3"})
+	require.NoError(t, err)
+	_, invalidErr := testSetup.AuthorizedClient.Join(ctx, &api.JoinRequest{Id: "4"})
+	_, unauthorizedErr := testSetup.UnauthorizedClient.Leave(ctx, &api.LeaveRequest{Id: "1"})
+
+	// assert
+	require.Equal(t, members{"1": true, "2": false}, m)
+	require.Equal(t, codes.InvalidArgument, status.Code(invalidErr))
+	require.Equal(t, codes.PermissionDenied, status.Code(unauthorizedErr))
+}
+
+func TestServerWatch(t *testing.T) {
+	// arrange
+	testSetup := SetupTest(t, nil, debug)
+	defer testSetup.Teardown()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream, err := testSetup.AuthorizedClient.Watch(ctx, &api.WatchRequest{})
+	require.NoError(t, err)
+	initial, err := stream.Recv()
+	require.NoError(t, err)
+
+	// act
+	_, err = testSetup.AuthorizedClient.Create(ctx, &api.CreateRecordRequest{
+		Record: &api.Record{Value: []byte("hello world")},
+	})
+	require.NoError(t, err)
+	hw, err := stream.Recv()
+
+	// assert
+	require.NoError(t, err)
+	require.Equal(t, uint64(0), initial.Offset)
+	require.Nil(t, initial.Time)
+	require.Equal(t, uint64(1), hw.Offset)
+	require.NotNil(t, hw.Time)
+	require.True(t, hw.Size > initial.Size)
+}
+
+func TestServerGetByTime(t *testing.T) {
+	// arrange
+	testSetup := SetupTest(t, nil, debug)
+	defer testSetup.Teardown()
+	client := testSetup.AuthorizedClient
+	ctx := context.Background()
+	_, err := client.Create(ctx, &api.CreateRecordRequest{Record: &api.Record{Value: []byte("before")}})
+	require.NoError(t, err)
+	res, err := client.Get(ctx, &api.GetRecordRequest{Offset: 0})
+	require.NoError(t, err)
+	since := res.Record.Timestamp.AsTime().Add(time.Nanosecond)
+	time.Sleep(time.Millisecond)
+	_, err = client.Create(ctx, &api.CreateRecordRequest{Record: &api.Record{Value: []byte("since")}})
+	require.NoError(t, err)
+
+	// act
+	byTime, err := client.GetByTime(ctx, &api.GetByTimeRequest{Time: timestamppb.New(since)})
+	_, unauthorizedErr := testSetup.UnauthorizedClient.GetByTime(ctx, &api.GetByTimeRequest{Time: timestamppb.Now()})
+	_, invalidErr := client.GetByTime(ctx, &api.GetByTimeRequest{})
+
+	// assert
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), byTime.Offset)
+	require.Equal(t, codes.PermissionDenied, status.Code(unauthorizedErr))
+	require.Equal(t, codes.InvalidArgument, status.Code(invalidErr))
+}
+
+func TestServerRecordIDs(t *testing.T) {
+	// arrange
+	testSetup := SetupTest(t, nil, debug)
+	defer testSetup.Teardown()
+	client := testSetup.AuthorizedClient
+	ctx := context.Background()
+
+	// act
+	created, err := client.Create(ctx, &api.CreateRecordRequest{Record: &api.Record{Value: []byte("first"), Id: []byte("chosen")}})
+	require.NoError(t, err)
+	batch, err := client.CreateBatch(ctx, &api.CreateRecordBatchRequest{Records: []*api.Record{{Value: []byte("second")}, {Value: []byte("third")}}})
+	require.NoError(t, err)
+
+	// assert
+	ids := append([][]byte{created.Id}, batch.Ids...)
+	seen := make(map[string]bool)
+	for off, id := range ids {
+		require.Len(t, id, 16)
+		require.Equal(t, byte(0x70), id[6]&0xf0, "ids are UUIDv7s")
+		require.False(t, seen[string(id)], "ids are unique")
+		seen[string(id)] = true
+		res, err := client.Get(ctx, &api.GetRecordRequest{Offset: uint64(off)})
+		require.NoError(t, err)
+		require.Equal(t, id, res.Record.Id)
+	}
+}
+
+func TestServerGetByKey(t *testing.T) {
+	// arrange
+	testSetup := SetupTest(t, nil, debug)
+	defer testSetup.Teardown()
+	client := testSetup.AuthorizedClient
+	ctx := context.Background()
+	_, err := testSetup.AuthorizedAdminClient.CreateTopic(ctx, &api.CreateTopicRequest{Topic: "users", Config: &api.TopicConfig{KeyIndex: true}})
+	require.NoError(t, err)
+	for _, value := range []string{"alice", "alice smith"} {
+		_, err = client.Create(ctx, &api.CreateRecordRequest{Topic: "users", Record: &api.Record{Key: []byte("1"), Value: []byte(value)}})
+		require.NoError(t, err)
+	}
+	_, err = client.Create(ctx, &api.CreateRecordRequest{Record: &api.Record{Key: []byte("1"), Value: []byte("unindexed")}})
+	require.NoError(t, err)
+
+	// act
+	res, err := client.GetByKey(ctx, &api.GetByKeyRequest{Topic: "users", Key: []byte("1")})
+	_, missingErr := client.GetByKey(ctx, &api.GetByKeyRequest{Topic: "users", Key: []byte("2")})
+	_, disabledErr := client.GetByKey(ctx, &api.GetByKeyRequest{Key: []byte("1")})
+	_, invalidErr := client.GetByKey(ctx, &api.GetByKeyRequest{Topic: "users"})
+	_, unauthorizedErr := testSetup.UnauthorizedClient.GetByKey(ctx, &api.GetByKeyRequest{Topic: "users", Key: []byte("1")})
+
+	// assert
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), res.Record.Offset)
+	require.Equal(t, "alice smith", string(res.Record.Value))
+	require.Equal(t, api.ErrKeyNotFound{Key: []byte("2")}, api.FromError(missingErr))
+	require.Equal(t, codes.FailedPrecondition, status.Code(disabledErr))
+	require.Equal(t, codes.InvalidArgument, status.Code(invalidErr))
+	require.Equal(t, codes.PermissionDenied, status.Code(unauthorizedErr))
+}
+
+func TestServerDelete(t *testing.T) {
+	// arrange
+	testSetup := SetupTest(t, nil, debug)
+	defer testSetup.Teardown()
+	client := testSetup.AuthorizedClient
+	ctx := context.Background()
+	_, err := testSetup.AuthorizedAdminClient.CreateTopic(ctx, &api.CreateTopicRequest{Topic: "users", Config: &api.TopicConfig{KeyIndex: true}})
+	require.NoError(t, err)
+	_, err = client.Create(ctx, &api.CreateRecordRequest{Topic: "users", Record: &api.Record{Key: []byte("1"), Value: []byte("alice")}})
+	require.NoError(t, err)
+
+	// act
+	res, err := client.Delete(ctx, &api.DeleteRecordRequest{Topic: "users", Key: []byte("1")})
+	_, invalidErr := client.Delete(ctx, &api.DeleteRecordRequest{Topic: "users"})
+	_, valueErr := client.Create(ctx, &api.CreateRecordRequest{Topic: "users", Record: &api.Record{Key: []byte("1"), Value: []byte("bob"), Tombstone: true}})
+	_, unauthorizedErr := testSetup.UnauthorizedClient.Delete(ctx, &api.DeleteRecordRequest{Topic: "users", Key: []byte("1")})
+
+	// assert
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), res.Offset)
+	require.Len(t, res.Id, 16)
+	got, err := client.Get(ctx, &api.GetRecordRequest{Topic: "users", Offset: res.Offset})
+	require.NoError(t, err)
+	require.True(t, got.Record.Tombstone)
+	require.Equal(t, []byte("1"), got.Record.Key)
+	_, err = client.GetByKey(ctx, &api.GetByKeyRequest{Topic: "users", Key: []byte("1")})
+	require.Equal(t, api.ErrKeyNotFound{Key: []byte("1")}, api.FromError(err))
+	require.Equal(t, codes.InvalidArgument, status.Code(invalidErr))
+	require.Equal(t, codes.InvalidArgument, status.Code(valueErr))
+	require.Equal(t, codes.PermissionDenied, status.Code(unauthorizedErr))
+}
+
+func TestServerBackup(t *testing.T) {
+	// arrange
+	testSetup := SetupTest(t, nil, debug)
+	defer testSetup.Teardown()
+	client := testSetup.AuthorizedClient
+	ctx := context.Background()
+	for _, value := range []string{"first", "second"} {
+		_, err := client.Create(ctx, &api.CreateRecordRequest{Record: &api.Record{Value: []byte(value)}})
+		require.NoError(t, err)
+	}
+
+	// act
+	stream, err := client.Backup(ctx, &api.BackupRequest{})
+	require.NoError(t, err)
+	var backup bytes.Buffer
+	for {
+		chunk, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		backup.Write(chunk.Data)
+	}
+
+	// assert
+	dir := internal.GetTempDir(t, "backup-test")
+	defer os.RemoveAll(dir)
+	restored, err := log.NewLog(dir, log.Config{})
+	require.NoError(t, err)
+	defer restored.Close()
+	require.NoError(t, restored.Restore(&backup))
+	record, err := restored.Read(1)
+	require.NoError(t, err)
+	require.Equal(t, "second", string(record.Value))
+
+	// act
+	stream, err = testSetup.UnauthorizedClient.Backup(ctx, &api.BackupRequest{})
+	require.NoError(t, err)
+	_, err = stream.Recv()
+
+	// assert
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+}
+
+func TestServerGzip(t *testing.T) {
+	// arrange
+	testSetup := SetupTest(t, nil, debug)
+	defer testSetup.Teardown()
+	ctx := context.Background()
+
+	// act
+	res, err := testSetup.AuthorizedClient.Create(ctx,
+		&api.CreateRecordRequest{Record: &api.Record{Value: []byte("hello world")}},
+		grpc.UseCompressor(gzip.Name),
+	)
+
+	// assert
+	require.NoError(t, err)
+	got, err := testSetup.AuthorizedClient.Get(ctx, &api.GetRecordRequest{Offset: res.Offset}, grpc.UseCompressor(gzip.Name))
+	require.NoError(t, err)
+	require.Equal(t, "hello world", string(got.Record.Value))
+}
+
+func TestServerCreateBatch(t *testing.T) {
+	// arrange
+	testSetup := SetupTest(t, nil, debug)
+	defer testSetup.Teardown()
+	client := testSetup.AuthorizedClient
+	ctx := context.Background()
+
+	// act
+	res, err := client.CreateBatch(ctx, &api.CreateRecordBatchRequest{
+		Records: []*api.Record{{Value: []byte("first")}, {Value: []byte("second")}},
+	})
+
+	// assert
+	require.NoError(t, err)
+	require.Equal(t, []uint64{0, 1}, res.Offsets)
+	got, err := client.Get(ctx, &api.GetRecordRequest{Offset: 1})
+	require.NoError(t, err)
+	require.Equal(t, "second", string(got.Record.Value))
+
+	// act
+	_, err = client.CreateBatch(ctx, &api.CreateRecordBatchRequest{
+		Records: make([]*api.Record, maxBatchRecords+1),
+	})
+
+	// assert
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+// acksLog records the acks of the appends it serves, acknowledging them
+// without an offset.
+type acksLog struct {
+	acks []api.Acks
+}
+
+func (l *acksLog) AppendAcks(topic string, record *api.Record, acks api.Acks) (uint64, error) {
+	l.acks = append(l.acks, acks)
+	return 0, nil
+}
+
+func TestServerCreateAcks(t *testing.T) {
+	// arrange
+	appender := &acksLog{}
+	testSetup := SetupTest(t, func(c *Config) {
+		c.AcksAppender = appender
+	}, debug)
+	defer testSetup.Teardown()
+	client := testSetup.AuthorizedClient
+	ctx := context.Background()
+	_, err := client.Create(ctx, &api.CreateRecordRequest{Record: &api.Record{Value: []byte("first")}})
+	require.NoError(t, err)
+
+	// act
+	quorum, quorumErr := client.Create(ctx, &api.CreateRecordRequest{Record: &api.Record{Value: []byte("second")}, Acks: api.Acks_ACKS_QUORUM})
+	_, leaderErr := client.Create(ctx, &api.CreateRecordRequest{Record: &api.Record{}, Acks: api.Acks_ACKS_LEADER})
+	_, noneErr := client.Create(ctx, &api.CreateRecordRequest{Record: &api.Record{}, Acks: api.Acks_ACKS_NONE})
+	_, unknownErr := client.Create(ctx, &api.CreateRecordRequest{Record: &api.Record{}, Acks: api.Acks(42)})
+
+	// assert
+	require.NoError(t, quorumErr)
+	require.Equal(t, uint64(1), quorum.Offset, "quorum acks are served by the commit log")
+	require.NoError(t, leaderErr)
+	require.NoError(t, noneErr)
+	require.Equal(t, []api.Acks{api.Acks_ACKS_LEADER, api.Acks_ACKS_NONE}, appender.acks)
+	require.Equal(t, codes.InvalidArgument, status.Code(unknownErr))
+}
+
+func TestServerCreateTransaction(t *testing.T) {
+	// arrange
+	testSetup := SetupTest(t, nil, debug)
+	defer testSetup.Teardown()
+	client := testSetup.AuthorizedClient
+	ctx := context.Background()
+
+	// act
+	res, err := client.CreateTransaction(ctx, &api.CreateTransactionRequest{Appends: []*api.TopicRecords{
+		{Topic: "orders", Records: []*api.Record{{Value: []byte("order")}}},
+		{Topic: "payments", Records: []*api.Record{{Value: []byte("payment")}}},
+	}})
+	_, emptyErr := client.CreateTransaction(ctx, &api.CreateTransactionRequest{})
+	_, twiceErr := client.CreateTransaction(ctx, &api.CreateTransactionRequest{Appends: []*api.TopicRecords{
+		{Topic: "orders", Records: []*api.Record{{Value: []byte("order")}}},
+		{Topic: "orders", Records: []*api.Record{{Value: []byte("order")}}},
+	}})
+	_, markerErr := client.CreateTransaction(ctx, &api.CreateTransactionRequest{Appends: []*api.TopicRecords{
+		{Topic: "orders", Records: []*api.Record{{Marker: api.TransactionMarker_TRANSACTION_MARKER_COMMIT}}},
+	}})
+	_, createErr := client.Create(ctx, &api.CreateRecordRequest{Topic: "orders", Record: &api.Record{Transaction: 42}})
+
+	// assert
+	require.NoError(t, err)
+	require.Equal(t, "orders", res.Offsets[0].Topic)
+	require.Equal(t, []uint64{0}, res.Offsets[0].Offsets)
+	require.Equal(t, "payments", res.Offsets[1].Topic)
+	require.Equal(t, []uint64{0}, res.Offsets[1].Offsets)
+	got, err := client.Get(ctx, &api.GetRecordRequest{Topic: "payments", Offset: 0})
+	require.NoError(t, err)
+	require.Equal(t, "payment", string(got.Record.Value))
+	require.Equal(t, codes.InvalidArgument, status.Code(emptyErr))
+	require.Equal(t, codes.InvalidArgument, status.Code(twiceErr))
+	require.Equal(t, codes.InvalidArgument, status.Code(markerErr), "markers are the log's to append")
+	require.Equal(t, codes.InvalidArgument, status.Code(createErr))
+}
+
+func TestServerCreateTransactionUnimplemented(t *testing.T) {
+	// arrange
+	testSetup := SetupTest(t, func(c *Config) {
+		c.Transactor = nil
+	}, debug)
+	defer testSetup.Teardown()
+
+	// act
+	_, err := testSetup.AuthorizedClient.CreateTransaction(context.Background(), &api.CreateTransactionRequest{})
+
+	// assert
+	require.Equal(t, codes.Unimplemented, status.Code(err))
+}
+
+func TestServerMaxRecordBytes(t *testing.T) {
+	// arrange
+	testSetup := SetupTest(t, func(c *Config) {
+		c.MaxRecordBytes = 16
+	}, debug)
+	defer testSetup.Teardown()
+	client := testSetup.AuthorizedClient
+	ctx := context.Background()
+	large := &api.Record{Value: make([]byte, 32)}
+
+	// act
+	_, err := client.Create(ctx, &api.CreateRecordRequest{Record: large})
+
+	// assert
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+	tooLarge, ok := api.RecordTooLargeFromError(err)
+	require.True(t, ok)
+	require.Equal(t, api.ErrRecordTooLarge{Size: uint64(proto.Size(large)), Limit: 16}, tooLarge)
+
+	// act
+	_, err = client.CreateBatch(ctx, &api.CreateRecordBatchRequest{
+		Records: []*api.Record{{Value: []byte("small")}, large},
+	})
+
+	// assert
+	_, ok = api.RecordTooLargeFromError(err)
+	require.True(t, ok)
+	_, err = client.Get(ctx, &api.GetRecordRequest{Offset: 0})
+	require.Error(t, err, "no record of the batch is appended")
+}
+
+func TestServerRecordTTL(t *testing.T) {
+	// arrange
+	testSetup := SetupTest(t, nil, debug)
+	defer testSetup.Teardown()
+	client := testSetup.AuthorizedClient
+	ctx := context.Background()
+	record := func(ttl time.Duration) *api.CreateRecordRequest {
+		return &api.CreateRecordRequest{Record: &api.Record{Value: []byte("hello world"), Ttl: durationpb.New(ttl)}}
+	}
+
+	// act
+	_, err := client.Create(ctx, record(time.Nanosecond))
+	require.NoError(t, err)
+	_, err = client.Create(ctx, record(time.Hour))
+	require.NoError(t, err)
+	_, invalidErr := client.Create(ctx, record(-time.Second))
+	_, expiredErr := client.Get(ctx, &api.GetRecordRequest{Offset: 0})
+	alive, err := client.Get(ctx, &api.GetRecordRequest{Offset: 1})
+
+	// assert
+	require.Equal(t, codes.InvalidArgument, status.Code(invalidErr))
+	_, ok := api.OffsetOutOfRangeFromError(expiredErr)
+	require.True(t, ok, "expired records aren't read")
+	require.NoError(t, err)
+	require.Equal(t, time.Hour, alive.Record.Ttl.AsDuration())
+}
+
+func TestServerIdempotentProducer(t *testing.T) {
+	// arrange
+	testSetup := SetupTest(t, nil, debug)
+	defer testSetup.Teardown()
+	client := testSetup.AuthorizedClient
+	ctx := context.Background()
+	record := &api.Record{Value: []byte("hello world"), ProducerId: "producer", Sequence: 0}
+	first, err := client.Create(ctx, &api.CreateRecordRequest{Record: record})
+	require.NoError(t, err)
+
+	// act
+	retried, err := client.Create(ctx, &api.CreateRecordRequest{Record: record})
+
+	// assert
+	require.NoError(t, err)
+	require.Equal(t, first.Offset, retried.Offset)
+	_, err = client.Get(ctx, &api.GetRecordRequest{Offset: first.Offset + 1})
+	require.Error(t, err, "the retry isn't appended")
+
+	// act
+	_, err = client.Create(ctx, &api.CreateRecordRequest{
+		Record: &api.Record{Value: []byte("gap"), ProducerId: "producer", Sequence: 2},
+	})
+
+	// assert
+	require.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	// act
+	_, err = client.CreateBatch(ctx, &api.CreateRecordBatchRequest{
+		Records: []*api.Record{{ProducerId: "producer", Sequence: 1}, {ProducerId: "other"}},
+	})
+
+	// assert
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestServerConsumerOffsets(t *testing.T) {
+	// arrange
+	testSetup := SetupTest(t, nil, debug)
+	defer testSetup.Teardown()
+	client := testSetup.AuthorizedClient
+	ctx := context.Background()
+
+	// act
+	_, err := client.CommitOffset(ctx, &api.CommitOffsetRequest{Group: "billing", Topic: "orders", Offset: 3})
+	require.NoError(t, err)
+	res, err := client.FetchOffset(ctx, &api.FetchOffsetRequest{Group: "billing", Topic: "orders"})
+
+	// assert
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), res.Offset)
+
+	// act
+	_, notCommittedErr := client.FetchOffset(ctx, &api.FetchOffsetRequest{Group: "shipping", Topic: "orders"})
+	_, missingGroupErr := client.CommitOffset(ctx, &api.CommitOffsetRequest{Topic: "orders", Offset: 3})
+	_, unauthorizedErr := testSetup.UnauthorizedClient.FetchOffset(ctx, &api.FetchOffsetRequest{Group: "billing", Topic: "orders"})
+
+	// assert
+	require.Equal(t, codes.NotFound, status.Code(notCommittedErr))
+	require.Equal(t, codes.InvalidArgument, status.Code(missingGroupErr))
+	require.Equal(t, codes.PermissionDenied, status.Code(unauthorizedErr))
+}
+
+func TestServerConsumeStream(t *testing.T) {
+	scenarios := map[string]func(*Config){
+		"waits for the high watermark":   nil,
+		"polls without watcher":          func(c *Config) { c.Watcher = nil },
+		"decodes without encoded reader": func(c *Config) { c.EncodedReader = nil },
+	}
+
+	for scenario, fn := range scenarios {
+		t.Run(scenario, func(t *testing.T) {
+			// arrange
+			testSetup := SetupTest(t, fn, debug)
+			defer testSetup.Teardown()
+			client := testSetup.AuthorizedClient
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			for _, value := range []string{"first", "second"} {
+				_, err := client.Create(ctx, &api.CreateRecordRequest{Record: &api.Record{Value: []byte(value)}})
+				require.NoError(t, err)
+			}
+
+			// act
+			stream, err := client.ConsumeStream(ctx, &api.GetRecordRequest{Offset: 1})
+			require.NoError(t, err)
+			second, err := stream.Recv()
+			require.NoError(t, err)
+			_, err = client.Create(ctx, &api.CreateRecordRequest{Record: &api.Record{Value: []byte("third")}})
+			require.NoError(t, err)
+			third, err := stream.Recv()
+
+			// assert
+			require.NoError(t, err)
+			require.Equal(t, "second", string(second.Record.Value))
+			require.Equal(t, uint64(2), third.Record.Offset)
+			require.Equal(t, "third", string(third.Record.Value))
+		})
+	}
+}
+
+func TestServerConsumeStreamFilter(t *testing.T) {
+	// arrange
+	testSetup := SetupTest(t, nil, debug)
+	defer testSetup.Teardown()
+	client := testSetup.AuthorizedClient
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	for _, record := range []*api.Record{
+		{Key: []byte("order-1"), Value: []byte("first")},
+		{Key: []byte("payment-1"), Value: []byte("second")},
+		{Key: []byte("order-2"), Value: []byte("third"), Headers: []*api.Header{{Key: "type", Value: []byte("cancelled")}}},
+		{Key: []byte("order-3"), Value: []byte("fourth")},
+	} {
+		_, err := client.Create(ctx, &api.CreateRecordRequest{Record: record})
+		require.NoError(t, err)
+	}
+	filter := &api.RecordFilter{KeyPrefix: []byte("order-")}
+
+	// act
+	stream, err := client.ConsumeStream(ctx, &api.GetRecordRequest{Filter: filter})
+	require.NoError(t, err)
+	var got []string
+	for i := 0; i < 3; i++ {
+		res, err := stream.Recv()
+		require.NoError(t, err)
+		got = append(got, string(res.Record.Value))
+	}
+
+	// assert
+	require.Equal(t, []string{"first", "third", "fourth"}, got)
+
+	// act
+	getStream, err := client.GetStream(ctx)
+	require.NoError(t, err)
+	filter.Headers = []*api.Header{{Key: "type", Value: []byte("cancelled")}}
+	for offset := uint64(0); offset < 4; offset++ {
+		require.NoError(t, getStream.Send(&api.GetRecordRequest{Offset: offset, Filter: filter}))
+	}
+	res, err := getStream.Recv()
+
+	// assert
+	require.NoError(t, err)
+	require.Equal(t, "third", string(res.Record.Value), "records not matching the filter aren't sent")
+}
+
+func TestServerGetMaxWait(t *testing.T) {
+	scenarios := map[string]func(*Config){
+		"waits for the high watermark": nil,
+		"polls without watcher":        func(c *Config) { c.Watcher = nil },
+	}
+
+	for scenario, fn := range scenarios {
+		t.Run(scenario, func(t *testing.T) {
+			// arrange
+			testSetup := SetupTest(t, fn, debug)
+			defer testSetup.Teardown()
+			client := testSetup.AuthorizedClient
+			ctx := context.Background()
+			go func() {
+				time.Sleep(50 * time.Millisecond)
+				_, _ = client.Create(ctx, &api.CreateRecordRequest{Record: &api.Record{Value: []byte("first")}})
+			}()
+
+			// act
+			res, err := client.Get(ctx, &api.GetRecordRequest{Offset: 0, MaxWaitMs: 5000})
+
+			// assert
+			require.NoError(t, err)
+			require.Equal(t, "first", string(res.Record.Value))
+
+			// act
+			start := time.Now()
+			_, err = client.Get(ctx, &api.GetRecordRequest{Offset: 1, MaxWaitMs: 50})
+
+			// assert
+			require.Equal(t, status.Code(api.ErrOffsetOutOfRange{}.GRPCStatus().Err()), status.Code(err))
+			require.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+		})
+	}
+}
+
+func TestServerGetRequiredOffset(t *testing.T) {
+	scenarios := map[string]func(*Config){
+		"waits for the high watermark": nil,
+		"polls without watcher":        func(c *Config) { c.Watcher = nil },
+	}
+
+	for scenario, fn := range scenarios {
+		t.Run(scenario, func(t *testing.T) {
+			// arrange
+			testSetup := SetupTest(t, fn, debug)
+			defer testSetup.Teardown()
+			client := testSetup.AuthorizedClient
+			ctx := context.Background()
+			_, err := client.Create(ctx, &api.CreateRecordRequest{Record: &api.Record{Value: []byte("first")}})
+			require.NoError(t, err)
+			time.AfterFunc(50*time.Millisecond, func() {
+				_, _ = client.Create(ctx, &api.CreateRecordRequest{Record: &api.Record{Value: []byte("second")}})
+			})
+
+			// act
+			res, err := client.Get(ctx, &api.GetRecordRequest{Offset: 0, RequiredOffset: proto.Uint64(1)})
+
+			// assert
+			require.NoError(t, err)
+			require.Equal(t, "first", string(res.Record.Value))
+
+			// act
+			_, err = client.Get(ctx, &api.GetRecordRequest{Offset: 0, RequiredOffset: proto.Uint64(5), MaxWaitMs: 50})
+
+			// assert
+			require.Equal(t, codes.Unavailable, status.Code(err))
+		})
+	}
+}
+
+func TestServerBookmarks(t *testing.T) {
+	// arrange
+	testSetup := SetupTest(t, nil, debug)
+	defer testSetup.Teardown()
+	client := testSetup.AuthorizedClient
+	ctx := context.Background()
+
+	// act
+	_, err := client.SetBookmark(ctx, &api.SetBookmarkRequest{
+		Bookmark: &api.Bookmark{Name: "replay", Offset: 42},
+	})
+	require.NoError(t, err)
+	res, err := client.GetBookmark(ctx, &api.GetBookmarkRequest{Name: "replay"})
+
+	// assert
+	require.NoError(t, err)
+	require.Equal(t, uint64(42), res.Bookmark.Offset)
+
+	// act
+	_, err = client.DeleteBookmark(ctx, &api.DeleteBookmarkRequest{Name: "replay"})
+	require.NoError(t, err)
+	_, err = client.GetBookmark(ctx, &api.GetBookmarkRequest{Name: "replay"})
+
+	// assert
+	require.Equal(t, codes.NotFound, status.Code(err))
+
+	// act
+	_, err = client.SetBookmark(ctx, &api.SetBookmarkRequest{Bookmark: &api.Bookmark{}})
+
+	// assert
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestServerInterceptors(t *testing.T) {
+	// arrange
+	var mu sync.Mutex
+	var subjects []string
+	testSetup := SetupTest(t, func(c *Config) {
+		c.UnaryInterceptors = []grpc.UnaryServerInterceptor{
+			func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+				mu.Lock()
+				subjects = append(subjects, Subject(ctx))
+				mu.Unlock()
+				if Subject(ctx) == "nobody" {
+					return nil, status.Error(codes.Unauthenticated, "unknown tenant")
+				}
+				return handler(ctx, req)
+			},
+		}
+		c.StreamInterceptors = []grpc.StreamServerInterceptor{
+			func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+				return status.Error(codes.Unimplemented, "streams are disabled")
+			},
+		}
+	}, debug)
+	defer testSetup.Teardown()
+	ctx := context.Background()
+
+	// act
+	_, err := testSetup.AuthorizedClient.Create(ctx, &api.CreateRecordRequest{Record: &api.Record{Value: []byte("hello world")}})
+	require.NoError(t, err)
+	_, err = testSetup.UnauthorizedClient.Create(ctx, &api.CreateRecordRequest{Record: &api.Record{Value: []byte("hello world")}})
+
+	// assert
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+	require.Equal(t, []string{"root", "nobody"}, subjects)
+
+	// act
+	stream, err := testSetup.AuthorizedClient.ConsumeStream(ctx, &api.GetRecordRequest{})
+	require.NoError(t, err)
+	_, err = stream.Recv()
+
+	// assert
+	require.Equal(t, codes.Unimplemented, status.Code(err))
+}
+
+func TestServerRequiresClientTLSCert(t *testing.T) {
+	// arrange
+	l, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+
+	serverTLSConfig, err := config.SetupTLSConfig(config.TLSConfig{
+		CertFile:      config.ServerCertFile,
+		KeyFile:       config.ServerKeyFile,
+		CAFile:        config.CAFile,
+		ServerAddress: l.Addr().String(),
+		Server:        true,
+	})
+	require.NoError(t, err)
+	serverCreds := credentials.NewTLS(serverTLSConfig)
+
+	clog, err := log.NewInMemory(log.Config{})
+	require.NoError(t, err)
+
+	cfg := &Config{
+		CommitLog: clog,
+	}
+	server, err := NewGRPCServer(cfg, grpc.Creds(serverCreds))
+	require.NoError(t, err)
+
+	go func() {
+		server.Serve(l)
+	}()
+
+	credsWithoutTLSCert := grpc.WithTransportCredentials(insecure.NewCredentials())
+
+	// act
+	clientConnection, err := grpc.Dial(l.Addr().String(), credsWithoutTLSCert)
+
+	// assert
+	state := clientConnection.GetState().String()
+	println(state)
+	require.NoError(t, err, "the connection it self should work, only the auth should fail.")
+	require.NotEqual(t, clientConnection.GetState(), connectivity.Ready, "should be unable to connect due to missing TLS cert")
+}
+
+// readiness is a Readier toggled by the test.
+type readiness struct {
+	mu      sync.Mutex
+	ready   bool
+	changed chan struct{}
+}
+
+func (r *readiness) Ready() (bool, <-chan struct{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.ready, r.changed
+}
+
+func (r *readiness) set(ready bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ready = ready
+	close(r.changed)
+	r.changed = make(chan struct{})
+}
+
+func TestReportReadiness(t *testing.T) {
+	// arrange
+	hsrv := health.NewServer()
+	readier := &readiness{changed: make(chan struct{})}
+	go reportReadiness(hsrv, readier)
+	serving := func() healthpb.HealthCheckResponse_ServingStatus {
+		res, err := hsrv.Check(context.Background(), &healthpb.HealthCheckRequest{Service: api.Log_ServiceDesc.ServiceName})
+		require.NoError(t, err)
+		return res.Status
+	}
+	eventually := func(want healthpb.HealthCheckResponse_ServingStatus) {
+		require.Eventually(t, func() bool { return serving() == want }, time.Second, 10*time.Millisecond)
+	}
+
+	// act & assert
+	eventually(healthpb.HealthCheckResponse_NOT_SERVING)
+	readier.set(true)
+	eventually(healthpb.HealthCheckResponse_SERVING)
+	readier.set(false)
+	eventually(healthpb.HealthCheckResponse_NOT_SERVING)
+}
+
+func TestGracefulStop(t *testing.T) {
+	// arrange
+	ln, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+	gsrv := grpc.NewServer()
+	healthpb.RegisterHealthServer(gsrv, health.NewServer())
+	go gsrv.Serve(ln)
+	cc, err := grpc.Dial(ln.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer cc.Close()
+	// watching never finishes on its own, like tailing a topic
+	stream, err := healthpb.NewHealthClient(cc).Watch(context.Background(), &healthpb.HealthCheckRequest{})
+	require.NoError(t, err)
+	_, err = stream.Recv()
+	require.NoError(t, err)
+
+	// act
+	start := time.Now()
+	GracefulStop(gsrv, 100*time.Millisecond)
+
+	// assert
+	require.Less(t, time.Since(start), time.Second)
+	require.GreaterOrEqual(t, time.Since(start), 100*time.Millisecond)
+	_, err = stream.Recv()
+	require.Error(t, err)
+}
+
+func TestServerContextDeadline(t *testing.T) {
+	// arrange
+	faults := &log.Faults{}
+	clog, err := log.NewInMemory(log.Config{Faults: faults})
+	require.NoError(t, err)
+	defer clog.Remove()
+	testSetup := SetupTest(t, func(c *Config) {
+		c.CommitLog = clog
+		c.ContextCommitLog = clog
+	}, debug)
+	defer testSetup.Teardown()
+	client := testSetup.AuthorizedClient
+	faults.DelayAppends(100 * time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	// act
+	_, err = client.Create(ctx, &api.CreateRecordRequest{Record: &api.Record{Value: []byte("hello world")}})
+
+	// assert
+	require.Equal(t, codes.DeadlineExceeded, status.Code(err))
+	faults.DelayAppends(0)
+	// an append outliving its RPC would have finished meanwhile
+	time.Sleep(150 * time.Millisecond)
+	res, err := client.Create(context.Background(), &api.CreateRecordRequest{Record: &api.Record{Value: []byte("hello world")}})
+	require.NoError(t, err)
+	require.Zero(t, res.Offset, "the expired record wasn't appended")
+}
+
+// BenchmarkProduceConsume produces and consumes records over localhost gRPC.
+func BenchmarkProduceConsume(b *testing.B) {
+	value := bytes.Repeat([]byte("a"), 128)
+	setup := func(b *testing.B) (api.LogClient, context.Context) {
+		testSetup := SetupTest(b, nil, debug)
+		b.Cleanup(testSetup.Teardown)
+		ctx, cancel := context.WithCancel(context.Background())
+		b.Cleanup(cancel)
+		return testSetup.AuthorizedClient, ctx
+	}
+
+	b.Run("produce", func(b *testing.B) {
+		client, ctx := setup(b)
+		b.SetBytes(int64(len(value)))
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if _, err := client.Create(ctx, &api.CreateRecordRequest{Record: &api.Record{Value: value}}); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("produce stream", func(b *testing.B) {
+		client, ctx := setup(b)
+		stream, err := client.CreateStream(ctx)
+		require.NoError(b, err)
+		b.SetBytes(int64(len(value)))
+		b.ResetTimer()
+		go func() {
+			for i := 0; i < b.N; i++ {
+				if err := stream.Send(&api.CreateRecordRequest{Record: &api.Record{Value: value}}); err != nil {
+					return
+				}
+			}
+		}()
+		for i := 0; i < b.N; i++ {
+			if _, err := stream.Recv(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("consume stream", func(b *testing.B) {
+		client, ctx := setup(b)
+		for i := 0; i < b.N; i++ {
+			_, err := client.Create(ctx, &api.CreateRecordRequest{Record: &api.Record{Value: value}})
+			require.NoError(b, err)
+		}
+		b.SetBytes(int64(len(value)))
+		b.ResetTimer()
+		stream, err := client.ConsumeStream(ctx, &api.GetRecordRequest{})
+		require.NoError(b, err)
+		for i := 0; i < b.N; i++ {
+			if _, err := stream.Recv(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
 }
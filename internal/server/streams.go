@@ -0,0 +1,291 @@
+package server
+
+import (
+	"context"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware"
+	api "github.com/justagabriel/proglog/api/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// defaultCreateWindow is the default of StreamLimits.CreateWindow.
+const defaultCreateWindow = 64
+
+// StreamLimits protect the server from clients holding many streams open or
+// not keeping up with them.
+// A zero value for a field disables that particular limit, unless noted.
+type StreamLimits struct {
+	// MaxStreams caps the streaming RPCs in progress, further ones fail with
+	// ResourceExhausted.
+	MaxStreams int
+	// MaxStreamsPerClient caps the streaming RPCs in progress of each
+	// authenticated subject.
+	MaxStreamsPerClient int
+	// IdleTimeout ends streams which neither sent nor received a message for
+	// that long with Unavailable, so clients know to reopen them.
+	IdleTimeout time.Duration
+	// CreateWindow caps the records each CreateStream receives ahead of
+	// appending them, defaults to 64.
+	CreateWindow int
+	// MaxConsumerLag ends ConsumeStreams which stay more than this many
+	// records behind their topic's end for SlowConsumerTimeout with
+	// api.ErrSlowConsumer, zero disables it.
+	MaxConsumerLag uint64
+	// SlowConsumerTimeout ends ConsumeStreams whose sends block for that
+	// long, i.e. the consumer stopped receiving and the stream's flow control
+	// window is full, with api.ErrSlowConsumer. Zero disables it.
+	SlowConsumerTimeout time.Duration
+}
+
+func (l StreamLimits) createWindow() int {
+	if l.CreateWindow <= 0 {
+		return defaultCreateWindow
+	}
+	return l.CreateWindow
+}
+
+// streamCounter tracks the streams in progress, in total and per subject.
+type streamCounter struct {
+	mu        sync.Mutex
+	limits    StreamLimits
+	total     int
+	perClient map[string]int
+}
+
+// acquire reserves a stream for the subject, release has to be called once it ended.
+func (c *streamCounter) acquire(subject string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.limits.MaxStreams > 0 && c.total >= c.limits.MaxStreams {
+		return status.Errorf(codes.ResourceExhausted, "too many streams, the limit is %d", c.limits.MaxStreams)
+	}
+	if c.limits.MaxStreamsPerClient > 0 && c.perClient[subject] >= c.limits.MaxStreamsPerClient {
+		return status.Errorf(codes.ResourceExhausted, "too many streams of the client, the limit is %d", c.limits.MaxStreamsPerClient)
+	}
+	c.total++
+	c.perClient[subject]++
+	return nil
+}
+
+func (c *streamCounter) release(subject string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.total--
+	if c.perClient[subject]--; c.perClient[subject] == 0 {
+		delete(c.perClient, subject)
+	}
+}
+
+// limitStreams enforces the stream limits, it has to run after authentication.
+func limitStreams(limits StreamLimits) grpc.StreamServerInterceptor {
+	counter := &streamCounter{limits: limits, perClient: make(map[string]int)}
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		subject := subject(ss.Context())
+		if err := counter.acquire(subject); err != nil {
+			return err
+		}
+		defer counter.release(subject)
+
+		if limits.IdleTimeout == 0 {
+			return handler(srv, ss)
+		}
+		ctx, cancel := context.WithCancel(ss.Context())
+		defer cancel()
+		stream := &idleStream{
+			WrappedServerStream: &grpc_middleware.WrappedServerStream{ServerStream: ss, WrappedContext: ctx},
+		}
+		stream.touch()
+		idle := make(chan struct{})
+		go stream.watch(limits.IdleTimeout, cancel, idle)
+
+		err := handler(srv, stream)
+		select {
+		case <-idle:
+			return status.Errorf(codes.Unavailable, "stream was idle for %s", limits.IdleTimeout)
+		default:
+			return err
+		}
+	}
+}
+
+// idleStream cancels its context once it neither sent nor received a message
+// for a while. Receiving observes the cancellation as well.
+type idleStream struct {
+	*grpc_middleware.WrappedServerStream
+	// last is the time of the last message in nanoseconds since the epoch
+	last int64
+}
+
+func (s *idleStream) touch() {
+	atomic.StoreInt64(&s.last, time.Now().UnixNano())
+}
+
+// watch cancels the stream and closes idle once it's idle for the timeout.
+func (s *idleStream) watch(timeout time.Duration, cancel context.CancelFunc, idle chan<- struct{}) {
+	ctx := s.Context()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-timer.C:
+			elapsed := now.Sub(time.Unix(0, atomic.LoadInt64(&s.last)))
+			if elapsed >= timeout {
+				close(idle)
+				cancel()
+				return
+			}
+			timer.Reset(timeout - elapsed)
+		}
+	}
+}
+
+func (s *idleStream) SendMsg(m interface{}) error {
+	err := s.WrappedServerStream.SendMsg(m)
+	if err == nil {
+		s.touch()
+	}
+	return err
+}
+
+// RecvMsg receives in the background, so it returns once the stream is
+// cancelled for being idle. The stream ends right after, which stops the
+// background receive too.
+func (s *idleStream) RecvMsg(m interface{}) error {
+	errc := make(chan error, 1)
+	go func() {
+		errc <- s.WrappedServerStream.RecvMsg(m)
+	}()
+	select {
+	case err := <-errc:
+		if err == nil {
+			s.touch()
+		}
+		return err
+	case <-s.Context().Done():
+		return s.Context().Err()
+	}
+}
+
+// slowConsumer ends a ConsumeStream whose consumer can't keep up, so it
+// doesn't pin the server's memory and the topic's segments, see
+// StreamLimits.MaxConsumerLag.
+type slowConsumer struct {
+	limits StreamLimits
+	topic  string
+	// behind is since when the lag exceeds MaxConsumerLag, zero while it doesn't
+	behind time.Time
+}
+
+// check fails once the consumer at the offset was behind the topic's end for
+// too long.
+func (c *slowConsumer) check(offset, end uint64) error {
+	if c.limits.MaxConsumerLag == 0 || end <= offset || end-offset <= c.limits.MaxConsumerLag {
+		c.behind = time.Time{}
+		return nil
+	}
+	now := time.Now()
+	if c.behind.IsZero() {
+		c.behind = now
+	}
+	if now.Sub(c.behind) < c.limits.SlowConsumerTimeout {
+		return nil
+	}
+	return api.ErrSlowConsumer{Topic: topicKey(c.topic), Lag: end - offset}
+}
+
+// send sends the message, it fails if that blocks for SlowConsumerTimeout.
+// The blocked send goes on in the background until the stream ends, which it
+// does right after.
+func (c *slowConsumer) send(stream grpc.ServerStream, m interface{}, lag uint64) error {
+	if c.limits.SlowConsumerTimeout == 0 {
+		return stream.SendMsg(m)
+	}
+	errc := make(chan error, 1)
+	go func() {
+		errc <- stream.SendMsg(m)
+	}()
+	timer := time.NewTimer(c.limits.SlowConsumerTimeout)
+	defer timer.Stop()
+	select {
+	case err := <-errc:
+		return err
+	case <-timer.C:
+		return api.ErrSlowConsumer{Topic: topicKey(c.topic), Lag: lag}
+	}
+}
+
+// LimitConnections limits the connections accepted from each client host,
+// further ones are closed right away. Zero disables the limit.
+func LimitConnections(ln net.Listener, max int) net.Listener {
+	if max == 0 {
+		return ln
+	}
+	return &limitListener{Listener: ln, max: max, conns: make(map[string]int)}
+}
+
+type limitListener struct {
+	net.Listener
+	max   int
+	mu    sync.Mutex
+	conns map[string]int
+}
+
+func (l *limitListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		host := remoteHost(conn)
+
+		l.mu.Lock()
+		if l.conns[host] >= l.max {
+			l.mu.Unlock()
+			conn.Close()
+			continue
+		}
+		l.conns[host]++
+		l.mu.Unlock()
+		return &limitConn{Conn: conn, release: func() { l.release(host) }}, nil
+	}
+}
+
+func (l *limitListener) release(host string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.conns[host]--; l.conns[host] == 0 {
+		delete(l.conns, host)
+	}
+}
+
+func remoteHost(conn net.Conn) string {
+	addr := conn.RemoteAddr().String()
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
+
+// limitConn gives its slot back once closed.
+type limitConn struct {
+	net.Conn
+	once    sync.Once
+	release func()
+}
+
+func (c *limitConn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(c.release)
+	return err
+}
@@ -0,0 +1,283 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	api "github.com/justagabriel/proglog/api/v1"
+	"github.com/justagabriel/proglog/internal/log"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestStreamLimits(t *testing.T) {
+	// arrange
+	testSetup := SetupTest(t, func(c *Config) {
+		c.StreamLimits.MaxStreamsPerClient = 1
+	}, debug)
+	defer testSetup.Teardown()
+	client := testSetup.AuthorizedClient
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	_, err := client.Create(ctx, &api.CreateRecordRequest{Record: &api.Record{Value: []byte("hello world")}})
+	require.NoError(t, err)
+	first, err := client.ConsumeStream(ctx, &api.GetRecordRequest{})
+	require.NoError(t, err)
+	_, err = first.Recv()
+	require.NoError(t, err)
+
+	// act
+	second, err := client.ConsumeStream(ctx, &api.GetRecordRequest{})
+	require.NoError(t, err)
+	_, err = second.Recv()
+	other, otherErr := testSetup.UnauthorizedClient.ConsumeStream(ctx, &api.GetRecordRequest{})
+	require.NoError(t, otherErr)
+	_, otherErr = other.Recv()
+
+	// assert
+	require.Equal(t, codes.ResourceExhausted, status.Code(err))
+	require.Equal(t, codes.PermissionDenied, status.Code(otherErr), "other clients have their own limit")
+}
+
+func TestStreamIdleTimeout(t *testing.T) {
+	// arrange
+	testSetup := SetupTest(t, func(c *Config) {
+		c.StreamLimits.IdleTimeout = 50 * time.Millisecond
+	}, debug)
+	defer testSetup.Teardown()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// act
+	stream, err := testSetup.AuthorizedClient.GetStream(ctx)
+	require.NoError(t, err)
+	_, err = stream.Recv()
+
+	// assert
+	require.Equal(t, codes.Unavailable, status.Code(err))
+}
+
+func TestSlowConsumerLag(t *testing.T) {
+	scenarios := map[string]struct {
+		from uint64
+		err  error
+	}{
+		"consumers too far behind are ended": {from: 0, err: api.ErrSlowConsumer{Topic: api.DefaultTopic, Lag: 5}},
+		"consumers within the lag are kept":  {from: 4, err: nil},
+	}
+
+	for scenario, s := range scenarios {
+		t.Run(scenario, func(t *testing.T) {
+			// arrange
+			testSetup := SetupTest(t, func(c *Config) {
+				c.StreamLimits.MaxConsumerLag = 2
+			}, debug)
+			defer testSetup.Teardown()
+			client := testSetup.AuthorizedClient
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			for i := 0; i < 5; i++ {
+				_, err := client.Create(ctx, &api.CreateRecordRequest{Record: &api.Record{Value: []byte("hello world")}})
+				require.NoError(t, err)
+			}
+
+			// act
+			stream, err := client.ConsumeStream(ctx, &api.GetRecordRequest{Offset: s.from})
+			require.NoError(t, err)
+			res, err := stream.Recv()
+
+			// assert
+			if s.err != nil {
+				require.Equal(t, s.err, api.FromError(err))
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, s.from, res.Record.Offset)
+		})
+	}
+}
+
+func TestSlowConsumerBlockedSend(t *testing.T) {
+	// arrange
+	testSetup := SetupTest(t, func(c *Config) {
+		c.StreamLimits.SlowConsumerTimeout = 50 * time.Millisecond
+	}, debug)
+	defer testSetup.Teardown()
+	client := testSetup.AuthorizedClient
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	value := make([]byte, 32<<10)
+	for i := 0; i < 16; i++ {
+		_, err := client.Create(ctx, &api.CreateRecordRequest{Record: &api.Record{Value: value}})
+		require.NoError(t, err)
+	}
+
+	// act
+	stream, err := client.ConsumeStream(ctx, &api.GetRecordRequest{})
+	require.NoError(t, err)
+	time.Sleep(300 * time.Millisecond) // the stream's window fills up
+	received := 0
+	for err == nil {
+		_, err = stream.Recv()
+		received++
+	}
+
+	// assert
+	_, ok := api.FromError(err).(api.ErrSlowConsumer)
+	require.True(t, ok, err)
+	require.Less(t, received, 16, "the stream ended before all records were sent")
+}
+
+// gatedLog blocks appends until the gate is closed.
+type gatedLog struct {
+	CommitLog
+	gate chan struct{}
+}
+
+func (l *gatedLog) Append(topic string, record *api.Record) (uint64, error) {
+	<-l.gate
+	return l.CommitLog.Append(topic, record)
+}
+
+// countingStream counts the messages received by the handler.
+type countingStream struct {
+	grpc.ServerStream
+	received *atomic.Int64
+}
+
+func (s *countingStream) RecvMsg(m interface{}) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	s.received.Add(1)
+	return nil
+}
+
+func TestCreateStreamWindow(t *testing.T) {
+	// arrange
+	gate := make(chan struct{})
+	var received atomic.Int64
+	testSetup := SetupTest(t, func(c *Config) {
+		c.CommitLog = &gatedLog{CommitLog: c.CommitLog, gate: gate}
+		c.StreamLimits.CreateWindow = 2
+		c.StreamInterceptors = append(c.StreamInterceptors, func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			return handler(srv, &countingStream{ServerStream: ss, received: &received})
+		})
+	}, debug)
+	defer testSetup.Teardown()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	stream, err := testSetup.AuthorizedClient.CreateStream(ctx)
+	require.NoError(t, err)
+
+	// act
+	for i := 0; i < 10; i++ {
+		record := &api.Record{Value: []byte(fmt.Sprintf("record %d", i))}
+		require.NoError(t, stream.Send(&api.CreateRecordRequest{Record: record}))
+	}
+
+	// assert
+	require.Eventually(t, func() bool { return received.Load() == 3 }, time.Second, 10*time.Millisecond,
+		"the record being appended and the window")
+	require.Never(t, func() bool { return received.Load() > 3 }, 100*time.Millisecond, 10*time.Millisecond)
+	close(gate)
+	for i := uint64(0); i < 10; i++ {
+		res, err := stream.Recv()
+		require.NoError(t, err)
+		require.Equal(t, i, res.Offset, "records are appended in order")
+	}
+}
+
+func TestCreateStreamDurableOffset(t *testing.T) {
+	// arrange
+	logConfig := log.Config{}
+	logConfig.Segment.SyncPolicy.Interval = time.Hour
+	clog, err := log.NewInMemory(logConfig)
+	require.NoError(t, err)
+	defer clog.Remove()
+	testSetup := SetupTest(t, func(c *Config) {
+		c.CommitLog = clog
+		c.BatchAppender = clog
+		c.DurabilityReporter = clog
+	}, debug)
+	defer testSetup.Teardown()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream, err := testSetup.AuthorizedClient.CreateStream(ctx)
+	require.NoError(t, err)
+
+	// act
+	var acks []*api.CreateRecordResponse
+	for i := 0; i < 2; i++ {
+		err := stream.Send(&api.CreateRecordRequest{Record: &api.Record{Value: []byte("hello world")}})
+		require.NoError(t, err)
+		res, err := stream.Recv()
+		require.NoError(t, err)
+		acks = append(acks, res)
+	}
+	_, err = testSetup.AuthorizedClient.CreateBatch(ctx, &api.CreateRecordBatchRequest{
+		Records: []*api.Record{{Value: []byte("hello world")}},
+	})
+	require.NoError(t, err)
+	require.NoError(t, stream.Send(&api.CreateRecordRequest{Record: &api.Record{Value: []byte("hello world")}}))
+	res, err := stream.Recv()
+	require.NoError(t, err)
+
+	// assert
+	require.Zero(t, acks[0].DurableOffset, "appends aren't synced before the interval passed")
+	require.Zero(t, acks[1].DurableOffset)
+	require.Equal(t, uint64(3), res.Offset)
+	require.Equal(t, uint64(3), res.DurableOffset, "batches are synced")
+}
+
+func TestLimitConnections(t *testing.T) {
+	// arrange
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	ln := LimitConnections(l, 1)
+	defer ln.Close()
+
+	accepted := make(chan net.Conn, 2)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			accepted <- conn
+		}
+	}()
+	first, err := net.Dial("tcp", ln.Addr().String())
+	require.NoError(t, err)
+	defer first.Close()
+	conn := <-accepted
+
+	// act
+	second, err := net.Dial("tcp", ln.Addr().String())
+	require.NoError(t, err)
+	defer second.Close()
+	_, err = second.Read(make([]byte, 1))
+
+	// assert
+	require.Error(t, err, "the second connection is closed")
+
+	// act
+	require.NoError(t, conn.Close())
+	third, err := net.Dial("tcp", ln.Addr().String())
+	require.NoError(t, err)
+	defer third.Close()
+
+	// assert
+	select {
+	case conn = <-accepted:
+		conn.Close()
+	case <-time.After(5 * time.Second):
+		t.Fatal("the connection wasn't accepted after the first one was closed")
+	}
+}
@@ -0,0 +1,166 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+
+	grpc_ctxtags "github.com/grpc-ecosystem/go-grpc-middleware/tags"
+	api "github.com/justagabriel/proglog/api/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// TenantHeader is the metadata key HeaderTenant reads the tenant from.
+const TenantHeader = "proglog-tenant"
+
+var tenantPattern = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+
+// TenantResolver resolves the tenant of a request. ok is false if the request
+// doesn't name a tenant the way the resolver understands.
+type TenantResolver interface {
+	Tenant(ctx context.Context) (tenant string, ok bool, err error)
+}
+
+// CertOUTenant uses the organizational unit of a verified client certificate as tenant.
+type CertOUTenant struct{}
+
+func (CertOUTenant) Tenant(ctx context.Context) (string, bool, error) {
+	peer, ok := peer.FromContext(ctx)
+	if !ok || peer.AuthInfo == nil {
+		return "", false, nil
+	}
+	tlsInfo, ok := peer.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(tlsInfo.State.VerifiedChains) == 0 {
+		return "", false, nil
+	}
+	ou := tlsInfo.State.VerifiedChains[0][0].Subject.OrganizationalUnit
+	if len(ou) == 0 {
+		return "", false, nil
+	}
+	return ou[0], true, nil
+}
+
+// HeaderTenant uses the proglog-tenant metadata as tenant. Clients choose it
+// freely, so the ACL policy has to bind subjects to their tenant's topics,
+// e.g. "alice, topic/team-a.*, create".
+type HeaderTenant struct{}
+
+func (HeaderTenant) Tenant(ctx context.Context) (string, bool, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get(TenantHeader)
+	if len(values) == 0 {
+		return "", false, nil
+	}
+	return values[0], true, nil
+}
+
+type tenantContextKey struct{}
+
+// Tenant returns the tenant of a request, empty without multi-tenancy.
+func Tenant(ctx context.Context) string {
+	tenant, _ := ctx.Value(tenantContextKey{}).(string)
+	return tenant
+}
+
+// resolveTenant runs the resolvers in order, the first one which applies
+// determines the tenant. Requests no resolver applies to are rejected.
+func resolveTenant(ctx context.Context, resolvers []TenantResolver) (context.Context, error) {
+	for _, r := range resolvers {
+		tenant, ok, err := r.Tenant(ctx)
+		if err != nil {
+			return ctx, err
+		}
+		if !ok {
+			continue
+		}
+		if !tenantPattern.MatchString(tenant) {
+			return ctx, status.Error(codes.PermissionDenied, fmt.Sprintf("invalid tenant %q", tenant))
+		}
+		grpc_ctxtags.Extract(ctx).Set("tenant", tenant)
+		return context.WithValue(ctx, tenantContextKey{}, tenant), nil
+	}
+	return ctx, status.Error(codes.PermissionDenied, "the request names no tenant")
+}
+
+// scopeTenants prefixes the topics and consumer groups of requests with the
+// tenant's name, see api.TenantTopic, so tenants can't see each other's.
+// Requests forwarded by a follower were scoped by it already.
+func scopeTenants(resolvers []TenantResolver) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if len(resolvers) == 0 || forwarded(ctx) {
+			return handler(ctx, req)
+		}
+		ctx, err := resolveTenant(ctx, resolvers)
+		if err != nil {
+			return nil, err
+		}
+		scope(Tenant(ctx), req)
+		return handler(ctx, req)
+	}
+}
+
+// scopeTenantStreams does the same as scopeTenants for each message of a stream.
+func scopeTenantStreams(resolvers []TenantResolver) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if len(resolvers) == 0 || forwarded(ss.Context()) {
+			return handler(srv, ss)
+		}
+		ctx, err := resolveTenant(ss.Context(), resolvers)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &scopedStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+type scopedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *scopedStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *scopedStream) RecvMsg(m interface{}) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	scope(Tenant(s.ctx), m)
+	return nil
+}
+
+// scope prefixes the topic and group fields of the request, those of its
+// appends as well.
+func scope(tenant string, req interface{}) {
+	msg, ok := req.(proto.Message)
+	if !ok {
+		return
+	}
+	m := msg.ProtoReflect()
+	fields := m.Descriptor().Fields()
+	if fd := fields.ByName("topic"); isString(fd) {
+		m.Set(fd, protoreflect.ValueOfString(api.TenantTopic(tenant, m.Get(fd).String())))
+	}
+	if fd := fields.ByName("group"); isString(fd) && m.Get(fd).String() != "" {
+		m.Set(fd, protoreflect.ValueOfString(tenant+api.TenantSeparator+m.Get(fd).String()))
+	}
+	// the topics of a transaction's appends
+	if fd := fields.ByName("appends"); fd != nil && fd.IsList() && fd.Message() != nil {
+		appends := m.Get(fd).List()
+		for i := 0; i < appends.Len(); i++ {
+			scope(tenant, appends.Get(i).Message().Interface())
+		}
+	}
+}
+
+func isString(fd protoreflect.FieldDescriptor) bool {
+	return fd != nil && fd.Kind() == protoreflect.StringKind && !fd.IsList()
+}
@@ -0,0 +1,132 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"testing"
+
+	api "github.com/justagabriel/proglog/api/v1"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+func TestServerTenants(t *testing.T) {
+	// arrange
+	testSetup := SetupTest(t, func(c *Config) {
+		c.TenantResolvers = []TenantResolver{HeaderTenant{}}
+	}, debug)
+	defer testSetup.Teardown()
+	client := testSetup.AuthorizedClient
+	teamA := metadata.AppendToOutgoingContext(context.Background(), TenantHeader, "team-a")
+	teamB := metadata.AppendToOutgoingContext(context.Background(), TenantHeader, "team-b")
+
+	// act
+	_, err := client.Create(teamA, &api.CreateRecordRequest{Topic: "orders", Record: &api.Record{Value: []byte("of team a")}})
+	require.NoError(t, err)
+	_, err = client.CommitOffset(teamA, &api.CommitOffsetRequest{Group: "billing", Topic: "orders", Offset: 1})
+	require.NoError(t, err)
+
+	// assert
+	got, err := client.Get(teamA, &api.GetRecordRequest{Topic: "orders"})
+	require.NoError(t, err)
+	require.Equal(t, "of team a", string(got.Record.Value))
+	_, err = client.Get(teamB, &api.GetRecordRequest{Topic: "orders"})
+	require.Equal(t, api.ErrOffsetOutOfRange{}.GRPCStatus().Code(), status.Code(err), "tenants don't see each other's topics")
+	_, err = client.FetchOffset(teamB, &api.FetchOffsetRequest{Group: "billing", Topic: "orders"})
+	require.Error(t, err, "tenants don't see each other's consumer groups")
+	_, err = client.Get(context.Background(), &api.GetRecordRequest{Topic: "orders"})
+	require.Equal(t, codes.PermissionDenied, status.Code(err), "requests without tenant are rejected")
+	stream, err := client.ConsumeStream(teamA, &api.GetRecordRequest{Topic: "orders"})
+	require.NoError(t, err)
+	res, err := stream.Recv()
+	require.NoError(t, err)
+	require.Equal(t, "of team a", string(res.Record.Value), "streams are scoped as well")
+	_, err = testSetup.Config.CommitLog.Read("team-a.orders", 0)
+	require.NoError(t, err, "topics are prefixed with their tenant")
+}
+
+func TestServerTenantsForwardedByClient(t *testing.T) {
+	scenarios := map[string]struct {
+		peers    []string
+		tenant   string
+		code     codes.Code
+		topic    string
+		describe string
+	}{
+		"clients are rejected without tenant": {
+			code:     codes.PermissionDenied,
+			describe: "the marker doesn't skip resolving the tenant",
+		},
+		"clients are scoped": {
+			tenant:   "team-a",
+			topic:    "team-a.orders",
+			describe: "the marker doesn't skip scoping",
+		},
+		"peers are trusted": {
+			peers:    []string{"root"},
+			topic:    "orders",
+			describe: "peers forward requests they scoped already",
+		},
+	}
+
+	for scenario, s := range scenarios {
+		t.Run(scenario, func(t *testing.T) {
+			// arrange
+			testSetup := SetupTest(t, func(c *Config) {
+				c.TenantResolvers = []TenantResolver{HeaderTenant{}}
+				c.PeerSubjects = s.peers
+			}, debug)
+			defer testSetup.Teardown()
+			ctx := metadata.AppendToOutgoingContext(context.Background(), forwardedKey, "true")
+			if s.tenant != "" {
+				ctx = metadata.AppendToOutgoingContext(ctx, TenantHeader, s.tenant)
+			}
+
+			// act
+			_, err := testSetup.AuthorizedClient.Create(ctx, &api.CreateRecordRequest{Topic: "orders", Record: &api.Record{Value: []byte("order")}})
+
+			// assert
+			require.Equal(t, s.code, status.Code(err), s.describe)
+			if s.topic != "" {
+				_, err = testSetup.Config.CommitLog.Read(s.topic, 0)
+				require.NoError(t, err, s.describe)
+			}
+		})
+	}
+}
+
+func TestCertOUTenant(t *testing.T) {
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "alice", OrganizationalUnit: []string{"team-a"}}}
+	for scenario, tc := range map[string]struct {
+		ctx    context.Context
+		tenant string
+		ok     bool
+	}{
+		"verified certificate": {
+			ctx: peer.NewContext(context.Background(), &peer.Peer{AuthInfo: credentials.TLSInfo{
+				State: tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}},
+			}}),
+			tenant: "team-a",
+			ok:     true,
+		},
+		"without certificate": {
+			ctx: peer.NewContext(context.Background(), &peer.Peer{}),
+		},
+	} {
+		t.Run(scenario, func(t *testing.T) {
+			// act
+			tenant, ok, err := CertOUTenant{}.Tenant(tc.ctx)
+
+			// assert
+			require.NoError(t, err)
+			require.Equal(t, tc.ok, ok)
+			require.Equal(t, tc.tenant, tenant)
+		})
+	}
+}
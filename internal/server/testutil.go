@@ -2,6 +2,7 @@ package server
 
 import (
 	"net"
+	"path"
 	"testing"
 	"time"
 
@@ -24,6 +25,10 @@ type LogServerTestSetup struct {
 	// UnauthorizedClient is an authenicated grpc client, unable to communicate with the created server.
 	UnauthorizedClient api.LogClient
 
+	// AuthorizedAdminClient and UnauthorizedAdminClient are the Admin service's clients of the same subjects.
+	AuthorizedAdminClient   api.AdminClient
+	UnauthorizedAdminClient api.AdminClient
+
 	// Config represents internal LogServer entities.
 	Config *Config
 
@@ -36,7 +41,7 @@ type LogServerTestSetup struct {
 
 // SetupTest creates a new 'Log' server and returns an authorized and an unauthorized client of it
 // additionally the config of the server itself, and a teardown function is returned.
-func SetupTest(t *testing.T, fn func(*Config), isDebugMode *bool) LogServerTestSetup {
+func SetupTest(t testing.TB, fn func(*Config), isDebugMode *bool) LogServerTestSetup {
 	t.Helper()
 
 	setup := LogServerTestSetup{}
@@ -57,8 +62,13 @@ func SetupTest(t *testing.T, fn func(*Config), isDebugMode *bool) LogServerTestS
 	require.NoError(t, err)
 	serverCreds := credentials.NewTLS(serverTLSConfig)
 
-	dir := internal.GetTempDir(t, "server-test")
-	clog, err := log.NewLog(dir, log.Config{})
+	clog, err := log.NewInMemory(log.Config{})
+	require.NoError(t, err)
+
+	bookmarks, err := log.NewBookmarks(path.Join(internal.GetTempDir(t, "bookmarks-test"), "bookmarks.json"))
+	require.NoError(t, err)
+
+	offsets, err := log.NewConsumerOffsets(path.Join(internal.GetTempDir(t, "offsets-test"), "offsets.json"))
 	require.NoError(t, err)
 
 	authorizer, err := auth.New(config.ACLModelFile, config.ACLPolicyFile)
@@ -83,8 +93,26 @@ func SetupTest(t *testing.T, fn func(*Config), isDebugMode *bool) LogServerTestS
 	}
 
 	setup.Config = &Config{
-		CommitLog:  clog,
-		Authorizer: authorizer,
+		CommitLog:          clog,
+		BatchAppender:      clog,
+		Transactor:         clog,
+		TopicAdmin:         clog,
+		Maintainer:         clog,
+		Authorizer:         authorizer,
+		Watcher:            clog,
+		Bookmarker:         bookmarks,
+		OffsetCommitter:    offsets,
+		SegmentStatser:     clog,
+		LogStatser:         clog,
+		Verifier:           clog,
+		DurabilityReporter: clog,
+		EncodedReader:      clog,
+		Truncater:          clog,
+		RecordDeleter:      clog,
+		Backuper:           clog,
+		TimeSearcher:       clog,
+		KeyReader:          clog,
+		OffsetRanger:       clog,
 	}
 	if fn != nil {
 		fn(setup.Config)
@@ -118,6 +146,8 @@ func SetupTest(t *testing.T, fn func(*Config), isDebugMode *bool) LogServerTestS
 
 	setup.AuthorizedClient = rootClient
 	setup.UnauthorizedClient = nobodyClient
+	setup.AuthorizedAdminClient = api.NewAdminClient(rootConn)
+	setup.UnauthorizedAdminClient = api.NewAdminClient(nobodyConn)
 	setup.Teardown = func() {
 		server.Stop()
 		rootConn.Close()
@@ -0,0 +1,105 @@
+package server
+
+import (
+	"context"
+	"encoding/hex"
+	"strings"
+
+	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware"
+	"go.opencensus.io/trace"
+	"go.opencensus.io/trace/propagation"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// traceparentKey carries the W3C trace context sent by OpenTelemetry clients.
+	traceparentKey = "traceparent"
+	// traceBinKey carries the trace context sent by OpenCensus clients.
+	traceBinKey = "grpc-trace-bin"
+)
+
+// remoteParent returns the trace context the client sent along with the RPC.
+func remoteParent(ctx context.Context) (trace.SpanContext, bool) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if v := md.Get(traceparentKey); len(v) > 0 {
+		if sc, ok := parseTraceparent(v[0]); ok {
+			return sc, true
+		}
+	}
+	if v := md.Get(traceBinKey); len(v) > 0 {
+		return propagation.FromBinary([]byte(v[0]))
+	}
+	return trace.SpanContext{}, false
+}
+
+// parseTraceparent parses a W3C traceparent header: version-traceid-parentid-flags.
+func parseTraceparent(h string) (sc trace.SpanContext, ok bool) {
+	parts := strings.Split(strings.TrimSpace(h), "-")
+	if len(parts) < 4 || parts[0] == "ff" || len(parts[0]) != 2 {
+		return sc, false
+	}
+	traceID, err := hex.DecodeString(parts[1])
+	if err != nil || len(traceID) != len(sc.TraceID) {
+		return sc, false
+	}
+	spanID, err := hex.DecodeString(parts[2])
+	if err != nil || len(spanID) != len(sc.SpanID) {
+		return sc, false
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil || len(flags) != 1 {
+		return sc, false
+	}
+	copy(sc.TraceID[:], traceID)
+	copy(sc.SpanID[:], spanID)
+	if sc.TraceID == (trace.TraceID{}) || sc.SpanID == (trace.SpanID{}) {
+		return sc, false
+	}
+	sc.TraceOptions = trace.TraceOptions(flags[0] & 1)
+	return sc, true
+}
+
+// startSpan starts the server span of the RPC as child of the client's span.
+func startSpan(ctx context.Context, fullMethod string, sampler trace.Sampler) (context.Context, *trace.Span) {
+	name := strings.ReplaceAll(strings.TrimPrefix(fullMethod, "/"), "/", ".")
+	opts := []trace.StartOption{
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithSampler(sampler),
+	}
+	if parent, ok := remoteParent(ctx); ok {
+		return trace.StartSpanWithRemoteParent(ctx, name, parent, opts...)
+	}
+	// the span ocgrpc put into the context isn't sampled, so it mustn't become the parent
+	return trace.StartSpan(trace.NewContext(ctx, nil), name, opts...)
+}
+
+func endSpan(span *trace.Span, err error) {
+	if err != nil {
+		s := status.Convert(err)
+		span.SetStatus(trace.Status{Code: int32(s.Code()), Message: s.Message()})
+	}
+	span.End()
+}
+
+func traceUnary(sampler trace.Sampler) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, span := startSpan(ctx, info.FullMethod, sampler)
+		res, err := handler(ctx, req)
+		endSpan(span, err)
+		return res, err
+	}
+}
+
+// traceStream hands the span to the stream handler through the stream's context.
+func traceStream(sampler trace.Sampler) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, span := startSpan(ss.Context(), info.FullMethod, sampler)
+		stream := grpc_middleware.WrapServerStream(ss)
+		stream.WrappedContext = ctx
+		err := handler(srv, stream)
+		endSpan(span, err)
+		return err
+	}
+}
@@ -0,0 +1,177 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	api "github.com/justagabriel/proglog/api/v1"
+	"github.com/stretchr/testify/require"
+	"go.opencensus.io/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	testTraceID     = "4bf92f3577b34da6a3ce929d0e0e4736"
+	testParentID    = "00f067aa0ba902b7"
+	testTraceparent = "00-" + testTraceID + "-" + testParentID + "-01"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	scenarios := map[string]struct {
+		header  string
+		ok      bool
+		sampled bool
+	}{
+		"sampled":             {header: testTraceparent, ok: true, sampled: true},
+		"not sampled":         {header: "00-" + testTraceID + "-" + testParentID + "-00", ok: true},
+		"future version":      {header: "01-" + testTraceID + "-" + testParentID + "-01-extra", ok: true, sampled: true},
+		"invalid version":     {header: "ff-" + testTraceID + "-" + testParentID + "-01"},
+		"zero trace id":       {header: "00-00000000000000000000000000000000-" + testParentID + "-01"},
+		"short span id":       {header: "00-" + testTraceID + "-00f067aa-01"},
+		"missing flags":       {header: "00-" + testTraceID + "-" + testParentID},
+		"not hex encoded ids": {header: "00-" + testTraceID + "-00f067aa0ba902bz-01"},
+	}
+
+	for scenario, sc := range scenarios {
+		t.Run(scenario, func(t *testing.T) {
+			// act
+			parent, ok := parseTraceparent(sc.header)
+
+			// assert
+			require.Equal(t, sc.ok, ok)
+			if sc.ok {
+				require.Equal(t, testTraceID, parent.TraceID.String())
+				require.Equal(t, testParentID, parent.SpanID.String())
+				require.Equal(t, sc.sampled, parent.IsSampled())
+			}
+		})
+	}
+}
+
+type spanRecorder struct {
+	mu    sync.Mutex
+	spans []*trace.SpanData
+}
+
+func (r *spanRecorder) ExportSpan(s *trace.SpanData) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.spans = append(r.spans, s)
+}
+
+func (r *spanRecorder) span(name string) *trace.SpanData {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, s := range r.spans {
+		if s.Name == name && s.TraceID.String() == testTraceID {
+			return s
+		}
+	}
+	return nil
+}
+
+func TestServerTracing(t *testing.T) {
+	// arrange
+	recorder := &spanRecorder{}
+	trace.RegisterExporter(recorder)
+	defer trace.UnregisterExporter(recorder)
+	testSetup := SetupTest(t, nil, debug)
+	defer testSetup.Teardown()
+	ctx := metadata.AppendToOutgoingContext(context.Background(), traceparentKey, testTraceparent)
+
+	// act
+	_, err := testSetup.AuthorizedClient.Create(ctx, &api.CreateRecordRequest{
+		Record: &api.Record{Value: []byte("hello")},
+	})
+
+	// assert
+	require.NoError(t, err)
+	var span *trace.SpanData
+	require.Eventually(t, func() bool {
+		span = recorder.span("log.v1.Log.Create")
+		return span != nil
+	}, time.Second, 10*time.Millisecond)
+	require.Equal(t, testParentID, span.ParentSpanID.String())
+	require.Equal(t, trace.SpanKindServer, span.SpanKind)
+	require.True(t, span.HasRemoteParent)
+}
+
+func TestTraceStream(t *testing.T) {
+	// arrange
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(traceparentKey, testTraceparent))
+	var handled trace.SpanContext
+	handler := func(srv interface{}, stream grpc.ServerStream) error {
+		handled = trace.FromContext(stream.Context()).SpanContext()
+		return nil
+	}
+
+	// act
+	err := traceStream(trace.NeverSample())(nil, &contextStream{ctx: ctx}, &grpc.StreamServerInfo{FullMethod: "/log.v1.Log/ConsumeStream"}, handler)
+
+	// assert
+	require.NoError(t, err)
+	require.Equal(t, testTraceID, handled.TraceID.String())
+	require.NotEqual(t, testParentID, handled.SpanID.String())
+}
+
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *contextStream) Context() context.Context {
+	return s.ctx
+}
+
+func TestOTLPExporter(t *testing.T) {
+	// arrange
+	bodies := make(chan []byte, 1)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		bodies <- b
+	}))
+	defer collector.Close()
+	exporter := NewOTLPExporter(OTLPConfig{
+		Endpoint: collector.URL,
+		Resource: map[string]string{"service.name": "proglog"},
+	})
+	parent, ok := parseTraceparent(testTraceparent)
+	require.True(t, ok)
+	start := time.Unix(1700000000, 0)
+
+	// act
+	exporter.ExportSpan(&trace.SpanData{
+		SpanContext:  trace.SpanContext{TraceID: parent.TraceID, SpanID: trace.SpanID{1}},
+		ParentSpanID: parent.SpanID,
+		SpanKind:     trace.SpanKindServer,
+		Name:         "log.v1.Log.Create",
+		StartTime:    start,
+		EndTime:      start.Add(time.Millisecond),
+		Attributes:   map[string]interface{}{"topic": "default", "records": int64(1)},
+		Status:       trace.Status{Code: 7, Message: "denied"},
+	})
+	require.NoError(t, exporter.Close())
+
+	// assert
+	var req otlpTraces
+	require.NoError(t, json.Unmarshal(<-bodies, &req))
+	require.Equal(t, "service.name", req.ResourceSpans[0].Resource.Attributes[0].Key)
+	span := req.ResourceSpans[0].ScopeSpans[0].Spans[0]
+	require.Equal(t, testTraceID, span.TraceID)
+	require.Equal(t, "0100000000000000", span.SpanID)
+	require.Equal(t, testParentID, span.ParentSpanID)
+	require.Equal(t, 2, span.Kind)
+	require.Equal(t, "1700000000000000000", span.StartTimeUnixNano)
+	require.Equal(t, "1700000000001000000", span.EndTimeUnixNano)
+	require.Equal(t, otlpStatus{Code: otlpStatusError, Message: "denied"}, span.Status)
+	require.Equal(t, "records", span.Attributes[0].Key)
+	require.Equal(t, "1", *span.Attributes[0].Value.IntValue)
+}
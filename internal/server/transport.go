@@ -0,0 +1,65 @@
+package server
+
+import (
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/keepalive"
+)
+
+// Transport configures the server's gRPC connections, so large records and
+// long-lived idle streams can be allowed deliberately. A zero value for a
+// field keeps gRPC's default.
+type Transport struct {
+	// MaxRecvMsgBytes caps the requests received, gRPC defaults to 4 MiB,
+	// which caps records short of MaxRecordBytes.
+	MaxRecvMsgBytes int
+	// MaxSendMsgBytes caps the responses sent, e.g. ConsumeStream's batches.
+	MaxSendMsgBytes int
+	// KeepaliveMinTime is how often clients may ping at most, those pinging
+	// more often are disconnected. gRPC defaults to 5 minutes.
+	KeepaliveMinTime time.Duration
+	// KeepalivePermitWithoutStream lets clients ping without streams or RPCs
+	// in progress, e.g. to keep idle connections of consumers open.
+	KeepalivePermitWithoutStream bool
+	// KeepaliveTime is how long a connection is idle before the server pings
+	// the client, KeepaliveTimeout how long it waits for the ping's ack
+	// before closing the connection.
+	KeepaliveTime    time.Duration
+	KeepaliveTimeout time.Duration
+	// MaxConnectionIdle closes connections without RPCs in progress for that long.
+	MaxConnectionIdle time.Duration
+	// MaxConnectionAge closes connections once they're that old, after a
+	// grace period of MaxConnectionAgeGrace for the RPCs in progress, so
+	// clients spread over the nodes again.
+	MaxConnectionAge      time.Duration
+	MaxConnectionAgeGrace time.Duration
+}
+
+func (t Transport) serverOptions() []grpc.ServerOption {
+	var opts []grpc.ServerOption
+	if t.MaxRecvMsgBytes > 0 {
+		opts = append(opts, grpc.MaxRecvMsgSize(t.MaxRecvMsgBytes))
+	}
+	if t.MaxSendMsgBytes > 0 {
+		opts = append(opts, grpc.MaxSendMsgSize(t.MaxSendMsgBytes))
+	}
+	if t.KeepaliveMinTime > 0 || t.KeepalivePermitWithoutStream {
+		opts = append(opts, grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{
+			MinTime:             t.KeepaliveMinTime,
+			PermitWithoutStream: t.KeepalivePermitWithoutStream,
+		}))
+	}
+	// gRPC keeps its defaults for the zero durations
+	params := keepalive.ServerParameters{
+		Time:                  t.KeepaliveTime,
+		Timeout:               t.KeepaliveTimeout,
+		MaxConnectionIdle:     t.MaxConnectionIdle,
+		MaxConnectionAge:      t.MaxConnectionAge,
+		MaxConnectionAgeGrace: t.MaxConnectionAgeGrace,
+	}
+	if params != (keepalive.ServerParameters{}) {
+		opts = append(opts, grpc.KeepaliveParams(params))
+	}
+	return opts
+}
@@ -0,0 +1,52 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	api "github.com/justagabriel/proglog/api/v1"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestServerTransport(t *testing.T) {
+	scenarios := map[string]struct {
+		transport Transport
+		size      int
+		code      codes.Code
+	}{
+		"smaller limits reject records": {
+			transport: Transport{MaxRecvMsgBytes: 1024},
+			size:      2048,
+			code:      codes.ResourceExhausted,
+		},
+		"larger limits accept records": {
+			transport: Transport{MaxRecvMsgBytes: 8 << 20},
+			size:      5 << 20,
+			code:      codes.OK,
+		},
+		"defaults reject records above 4 MiB": {
+			size: 5 << 20,
+			code: codes.ResourceExhausted,
+		},
+	}
+
+	for scenario, tc := range scenarios {
+		t.Run(scenario, func(t *testing.T) {
+			// arrange
+			testSetup := SetupTest(t, func(c *Config) {
+				c.Transport = tc.transport
+			}, debug)
+			defer testSetup.Teardown()
+			record := &api.Record{Value: bytes.Repeat([]byte("a"), tc.size)}
+
+			// act
+			_, err := testSetup.AuthorizedClient.Create(context.Background(), &api.CreateRecordRequest{Record: record})
+
+			// assert
+			require.Equal(t, tc.code, status.Code(err))
+		})
+	}
+}
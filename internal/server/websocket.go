@@ -0,0 +1,174 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	api "github.com/justagabriel/proglog/api/v1"
+	"golang.org/x/net/websocket"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// handleWebSocket serves the WebSocket bridge of the HTTP gateway, for
+// browsers and devices which can't speak gRPC:
+//
+//	/ws/subscribe?offset={offset}   sends the records from the offset on as GetRecordResponse, like ConsumeStream
+//	/ws/publish                     appends each CreateRecordRequest received, answering with its CreateRecordResponse
+//
+// Both accept a "topic" query parameter, subscribe a "max_records" one for
+// batches. Messages are JSON text frames, errors are sent as google.rpc.Status
+// and end subscriptions. Browsers can't set headers on WebSockets, so a bearer
+// token may be passed as "access_token" query parameter instead.
+func (s *httpServer) handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	if token := r.URL.Query().Get("access_token"); token != "" && r.Header.Get("Authorization") == "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	ctx, err := s.context(r)
+	if err != nil {
+		writeHTTPError(w, err)
+		return
+	}
+
+	var handler func(ctx context.Context, conn *websocket.Conn) error
+	switch r.URL.Path {
+	case "/ws/subscribe":
+		handler = s.subscribe
+	case "/ws/publish":
+		handler = s.publish
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	ws := websocket.Server{
+		Handshake: s.checkOrigin,
+		Handler: func(conn *websocket.Conn) {
+			conn.MaxPayloadBytes = maxHTTPBodyBytes
+			if err := handler(ctx, conn); err != nil {
+				_ = sendWebSocket(conn, status.Convert(err).Proto())
+			}
+		},
+	}
+	ws.ServeHTTP(w, r)
+}
+
+// checkOrigin accepts the origins of Config.WebSocketOrigins, or the gateway's
+// own origin if there are none. Clients which aren't browsers send no origin.
+func (s *httpServer) checkOrigin(config *websocket.Config, r *http.Request) error {
+	origin, err := websocket.Origin(config, r)
+	if err != nil || origin == nil {
+		return err
+	}
+	if originAllowed(s.srv.WebSocketOrigins, origin.String(), r.Host) {
+		return nil
+	}
+	return status.Errorf(codes.PermissionDenied, "origin %q is not allowed", origin)
+}
+
+func (s *httpServer) subscribe(ctx context.Context, conn *websocket.Conn) error {
+	query := conn.Request().URL.Query()
+	req := &api.GetRecordRequest{Topic: query.Get("topic")}
+	var err error
+	if v := query.Get("offset"); v != "" {
+		if req.Offset, err = strconv.ParseUint(v, 10, 64); err != nil {
+			return status.Error(codes.InvalidArgument, "offset has to be an unsigned integer")
+		}
+	}
+	if v := query.Get("max_records"); v != "" {
+		maxRecords, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			return status.Error(codes.InvalidArgument, "max_records has to be an unsigned integer")
+		}
+		req.MaxRecords = uint32(maxRecords)
+	}
+	s.scope(ctx, req)
+
+	// the subscription ends once the client closes the connection
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		var discard []byte
+		for websocket.Message.Receive(conn, &discard) == nil {
+		}
+		cancel()
+	}()
+	return s.srv.ConsumeStream(req, &webSocketStream{ctx: ctx, conn: conn})
+}
+
+func (s *httpServer) publish(ctx context.Context, conn *websocket.Conn) error {
+	topic := conn.Request().URL.Query().Get("topic")
+	for {
+		var msg []byte
+		if err := websocket.Message.Receive(conn, &msg); err != nil {
+			return nil
+		}
+		res, err := s.publishOne(ctx, topic, msg)
+		if err != nil {
+			err = sendWebSocket(conn, status.Convert(err).Proto())
+		} else {
+			err = sendWebSocket(conn, res)
+		}
+		if err != nil {
+			return nil
+		}
+	}
+}
+
+func (s *httpServer) publishOne(ctx context.Context, topic string, msg []byte) (*api.CreateRecordResponse, error) {
+	req := &api.CreateRecordRequest{}
+	if err := protojson.Unmarshal(msg, req); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if req.Record == nil {
+		return nil, status.Error(codes.InvalidArgument, "record is required")
+	}
+	if topic != "" {
+		req.Topic = topic
+	}
+	s.scope(ctx, req)
+	if s.srv.SchemaValidator != nil {
+		if err := validateRequest(s.srv.SchemaValidator, req); err != nil {
+			return nil, err
+		}
+	}
+	return s.srv.Create(ctx, req)
+}
+
+func sendWebSocket(conn *websocket.Conn, msg proto.Message) error {
+	b, err := protojson.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return websocket.Message.Send(conn, string(b))
+}
+
+// webSocketStream lets ConsumeStream send to a WebSocket, it only implements
+// the methods ConsumeStream calls.
+type webSocketStream struct {
+	grpc.ServerStream
+	ctx  context.Context
+	conn *websocket.Conn
+}
+
+func (s *webSocketStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *webSocketStream) Send(res *api.GetRecordResponse) error {
+	return sendWebSocket(s.conn, res)
+}
+
+func (s *webSocketStream) SendMsg(m interface{}) error {
+	if r, ok := m.(*encodedResponse); ok {
+		res, err := r.decode()
+		if err != nil {
+			return err
+		}
+		return s.Send(res)
+	}
+	return s.Send(m.(*api.GetRecordResponse))
+}
@@ -0,0 +1,109 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	api "github.com/justagabriel/proglog/api/v1"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/websocket"
+	"google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestWebSocketBridge(t *testing.T) {
+	scenarios := map[string]func(t *testing.T, srv *httptest.Server, root, nobody *http.Client){
+		"subscribers get published records": testWebSocketPublishSubscribe,
+		"unauthorized client is not served": testWebSocketUnauthorized,
+		"foreign origins are rejected":      testWebSocketOrigin,
+	}
+
+	for scenario, fn := range scenarios {
+		t.Run(scenario, func(t *testing.T) {
+			srv, root, nobody := setupHTTPTest(t, nil)
+			defer srv.Close()
+			fn(t, srv, root, nobody)
+		})
+	}
+}
+
+func testWebSocketPublishSubscribe(t *testing.T, srv *httptest.Server, root, nobody *http.Client) {
+	// arrange
+	publisher := dialWebSocket(t, srv, root, "/ws/publish?topic=orders", srv.URL)
+	defer publisher.Close()
+	publish := func(value string) *api.CreateRecordResponse {
+		require.NoError(t, websocket.Message.Send(publisher, `{"record": {"value": "`+value+`"}}`))
+		res := &api.CreateRecordResponse{}
+		receiveWebSocket(t, publisher, res)
+		return res
+	}
+	publish("b3JkZXIgMA==")
+
+	// act
+	subscriber := dialWebSocket(t, srv, root, "/ws/subscribe?topic=orders&offset=0", srv.URL)
+	defer subscriber.Close()
+	first := &api.GetRecordResponse{}
+	receiveWebSocket(t, subscriber, first)
+	created := publish("b3JkZXIgMQ==")
+	second := &api.GetRecordResponse{}
+	receiveWebSocket(t, subscriber, second)
+
+	// assert
+	require.Equal(t, uint64(1), created.Offset)
+	require.Equal(t, "order 0", string(first.Record.Value))
+	require.Equal(t, "order 1", string(second.Record.Value), "subscribers tail the topic")
+	require.Equal(t, uint64(1), second.Record.Offset)
+}
+
+func testWebSocketUnauthorized(t *testing.T, srv *httptest.Server, root, nobody *http.Client) {
+	// arrange
+	publisher := dialWebSocket(t, srv, nobody, "/ws/publish", srv.URL)
+	defer publisher.Close()
+
+	// act
+	require.NoError(t, websocket.Message.Send(publisher, `{"record": {"value": "aGVsbG8="}}`))
+	st := &status.Status{}
+	receiveWebSocket(t, publisher, st)
+
+	// assert
+	require.Equal(t, int32(codes.PermissionDenied), st.Code)
+}
+
+func testWebSocketOrigin(t *testing.T, srv *httptest.Server, root, nobody *http.Client) {
+	// act
+	_, foreignErr := newWebSocket(srv, root, "/ws/subscribe", "https://example.com")
+	own, ownErr := newWebSocket(srv, root, "/ws/subscribe", srv.URL)
+
+	// assert
+	require.Error(t, foreignErr)
+	require.NoError(t, ownErr)
+	own.Close()
+}
+
+func dialWebSocket(t *testing.T, srv *httptest.Server, client *http.Client, path, origin string) *websocket.Conn {
+	t.Helper()
+	conn, err := newWebSocket(srv, client, path, origin)
+	require.NoError(t, err)
+	return conn
+}
+
+// newWebSocket dials the path with the client's certificate from the origin.
+func newWebSocket(srv *httptest.Server, client *http.Client, path, origin string) (*websocket.Conn, error) {
+	config, err := websocket.NewConfig("wss://"+strings.TrimPrefix(srv.URL, "https://")+path, origin)
+	if err != nil {
+		return nil, err
+	}
+	config.TlsConfig = client.Transport.(*http.Transport).TLSClientConfig.Clone()
+	return websocket.DialConfig(config)
+}
+
+func receiveWebSocket(t *testing.T, conn *websocket.Conn, m proto.Message) {
+	t.Helper()
+	var msg string
+	require.NoError(t, websocket.Message.Receive(conn, &msg))
+	require.NoError(t, protojson.Unmarshal([]byte(msg), m))
+}
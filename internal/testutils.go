@@ -21,7 +21,7 @@ func testRootDir() string {
 
 // GetTempFile creates a file in the temporary 'dir'.
 // If 'dir' is "", a random dir name will be assigned.
-func GetTempFile(t *testing.T, dir, filename string) *os.File {
+func GetTempFile(t testing.TB, dir, filename string) *os.File {
 	// make sure that a random dir is generated if none specified
 	if dir == "" {
 		dirName := randDirName()
@@ -41,7 +41,7 @@ func GetTempFile(t *testing.T, dir, filename string) *os.File {
 
 // GetTempDir creates a temporary directory 'dir'.
 // if the 'dir' string includes '*', those will be replaced with a random string.
-func GetTempDir(t *testing.T, dir string) string {
+func GetTempDir(t testing.TB, dir string) string {
 	dirPath, err := os.MkdirTemp(testRootDir(), dir)
 	if err != nil {
 		panic(err)
@@ -52,7 +52,7 @@ func GetTempDir(t *testing.T, dir string) string {
 }
 
 // FreePort returns an available port.
-func FreePort(t *testing.T) int {
+func FreePort(t testing.TB) int {
 	for i := 0; i < 10; i++ {
 		l, err := net.Listen("tcp", "localhost:0")
 		if err != nil {
@@ -0,0 +1,191 @@
+// Package log embeds proglog's commit log in applications, e.g. as a local
+// write-ahead log, without running a server or cluster:
+//
+//	wal, err := log.Open(dir, log.Config{Sync: log.SyncPolicy{EveryWrites: 1}})
+//	if err != nil {
+//		...
+//	}
+//	defer wal.Close()
+//	off, err := wal.Append(&api.Record{Value: []byte("hello world")})
+//
+// Records are the api.Record messages the servers store, the logs' files
+// can be served by a proglog server later on. Reads of offsets outside the
+// log fail with api.ErrOffsetOutOfRange.
+//
+// The package's exported API follows the module's semantic version, it
+// only changes incompatibly with a new major version. The log's file format
+// is kept readable by later versions. Settings of the servers' logs which
+// aren't exposed here may be added to Config.
+package log
+
+import (
+	"context"
+	"time"
+
+	api "github.com/justagabriel/proglog/api/v1"
+	ilog "github.com/justagabriel/proglog/internal/log"
+)
+
+type Config struct {
+	// MaxStoreBytes and MaxIndexBytes roll the active segment once its store
+	// or index reaches them, they default to 1 KiB each. An index entry
+	// takes 12 bytes.
+	MaxStoreBytes uint64
+	MaxIndexBytes uint64
+	// InitialOffset is the offset of the first record of a new log.
+	InitialOffset uint64
+	// MaxRecordBytes rejects records whose encoded size exceeds it with
+	// api.ErrRecordTooLarge, zero disables the limit.
+	MaxRecordBytes uint64
+	// CacheBytes keeps recently appended and read records in memory up to
+	// this encoded size, zero disables the cache.
+	CacheBytes uint64
+	// KeyIndex keeps the offset of the latest record per key in memory, see
+	// Log.ReadByKey.
+	KeyIndex bool
+	Sync     SyncPolicy
+	// Retention removes old segments, the zero value keeps all records.
+	Retention RetentionPolicy
+}
+
+// SyncPolicy controls when appends are synced to stable storage, the zero
+// value leaves syncing to Close and the OS.
+type SyncPolicy struct {
+	// EveryWrites syncs after this many appends, 1 syncs on each append.
+	EveryWrites uint64
+	// Interval syncs at most this long after an append.
+	Interval time.Duration
+}
+
+// RetentionPolicy removes old segments in the background, zero fields
+// disable their limit. The active segment is never removed.
+type RetentionPolicy struct {
+	// MaxAge removes segments which weren't written to for longer.
+	MaxAge time.Duration
+	// MaxBytes caps the size of the log's stores.
+	MaxBytes uint64
+	// Compact rewrites inactive segments keeping only the latest record per
+	// key, offsets don't change.
+	Compact bool
+	// TombstoneRetention is how long compaction keeps tombstones, zero keeps
+	// them.
+	TombstoneRetention time.Duration
+	// CheckInterval defaults to a minute.
+	CheckInterval time.Duration
+}
+
+func (c Config) internal() ilog.Config {
+	var ic ilog.Config
+	ic.Segment.MaxStoreBytes = c.MaxStoreBytes
+	ic.Segment.MaxIndexBytes = c.MaxIndexBytes
+	ic.Segment.InitialOffset = c.InitialOffset
+	ic.Segment.SyncPolicy = ilog.SyncPolicy{EveryWrites: c.Sync.EveryWrites, Interval: c.Sync.Interval}
+	ic.MaxRecordBytes = c.MaxRecordBytes
+	ic.CacheBytes = c.CacheBytes
+	ic.KeyIndex = c.KeyIndex
+	ic.Retention = ilog.RetentionPolicy{
+		MaxAge:             c.Retention.MaxAge,
+		MaxBytes:           c.Retention.MaxBytes,
+		Compact:            c.Retention.Compact,
+		TombstoneRetention: c.Retention.TombstoneRetention,
+		CheckInterval:      c.Retention.CheckInterval,
+	}
+	return ic
+}
+
+// Log is a commit log in a directory, it's safe for concurrent use.
+type Log struct {
+	log *ilog.Log
+}
+
+// Open opens the log in the directory, creating it if it's empty.
+func Open(dir string, config Config) (*Log, error) {
+	l, err := ilog.NewLog(dir, config.internal())
+	if err != nil {
+		return nil, err
+	}
+	return &Log{log: l}, nil
+}
+
+// Append appends the record and returns its offset, which is set on the
+// record as well as its timestamp, the time it's appended.
+func (l *Log) Append(record *api.Record) (uint64, error) {
+	return l.log.Append(record)
+}
+
+// AppendBatch appends the records under a single lock and syncs them once
+// per segment written to. It returns the records' offsets. On error the
+// records appended before the failure are kept, and their offsets are
+// returned with the error.
+func (l *Log) AppendBatch(records []*api.Record) ([]uint64, error) {
+	return l.log.AppendBatch(records)
+}
+
+// Read returns the record at the offset. Compacted and expired records
+// aren't returned, their offsets fail with api.ErrOffsetOutOfRange.
+func (l *Log) Read(off uint64) (*api.Record, error) {
+	return l.log.Read(off)
+}
+
+// ReadByKey returns the latest record with the key. It fails with
+// api.ErrKeyIndexDisabled unless Config.KeyIndex is set and with
+// api.ErrKeyNotFound if there's no such record or it was deleted.
+func (l *Log) ReadByKey(key []byte) (*api.Record, error) {
+	return l.log.ReadByKey(key)
+}
+
+// OffsetByTime returns the offset of the first record with a timestamp at
+// or after t, the next offset to be written if there is none.
+func (l *Log) OffsetByTime(t time.Time) (uint64, error) {
+	return l.log.OffsetByTime(t)
+}
+
+// LowestOffset returns the offset of the log's first record.
+func (l *Log) LowestOffset() (uint64, error) {
+	return l.log.LowestOffset()
+}
+
+// HighestOffset returns the offset of the log's last record, zero if it's
+// empty.
+func (l *Log) HighestOffset() (uint64, error) {
+	return l.log.HighestOffset()
+}
+
+// DurableOffset returns the offset up to which records are synced to stable
+// storage, see Config.Sync.
+func (l *Log) DurableOffset() uint64 {
+	return l.log.DurableOffset()
+}
+
+// Wait waits until the record at the offset was appended, it fails once ctx
+// is done. Tailing readers call it before reading the next offset.
+func (l *Log) Wait(ctx context.Context, off uint64) error {
+	for {
+		hw, changed := l.log.HighWatermark()
+		if hw.Offset > off {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+// Truncate removes the segments holding only records up to the lowest
+// offset, e.g. once a write-ahead log's records were checkpointed. The
+// active segment is kept.
+func (l *Log) Truncate(lowest uint64) error {
+	return l.log.Truncate(lowest)
+}
+
+// Close syncs and closes the log's files.
+func (l *Log) Close() error {
+	return l.log.Close()
+}
+
+// Remove closes the log and removes its directory.
+func (l *Log) Remove() error {
+	return l.log.Remove()
+}
@@ -0,0 +1,116 @@
+package log
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	api "github.com/justagabriel/proglog/api/v1"
+	"github.com/justagabriel/proglog/internal"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLog(t *testing.T) {
+	scenarios := map[string]func(t *testing.T, log *Log){
+		"records survive a restart":    testReopen,
+		"records are looked up by key": testReadByKey,
+		"wait returns once appended":   testWait,
+		"truncated records are gone":   testTruncate,
+	}
+
+	config := Config{MaxStoreBytes: 64, KeyIndex: true, Sync: SyncPolicy{EveryWrites: 1}}
+
+	for scenario, fn := range scenarios {
+		t.Run(scenario, func(t *testing.T) {
+			dir := internal.GetTempDir(t, "embedded-log-test")
+			defer os.RemoveAll(dir)
+
+			log, err := Open(dir, config)
+			require.NoError(t, err)
+			defer log.Close()
+
+			fn(t, log)
+		})
+	}
+}
+
+func testReopen(t *testing.T, log *Log) {
+	// arrange
+	offsets, err := log.AppendBatch([]*api.Record{{Value: []byte("first")}, {Value: []byte("second")}})
+	require.NoError(t, err)
+	dir := log.log.Dir
+	require.Equal(t, offsets[1], log.DurableOffset()-1, "every append is synced")
+	require.NoError(t, log.Close())
+
+	// act
+	reopened, err := Open(dir, Config{})
+	require.NoError(t, err)
+	defer reopened.Close()
+	record, err := reopened.Read(offsets[1])
+
+	// assert
+	require.NoError(t, err)
+	require.Equal(t, "second", string(record.Value))
+	_, err = reopened.Read(offsets[1] + 1)
+	require.IsType(t, api.ErrOffsetOutOfRange{}, err)
+}
+
+func testReadByKey(t *testing.T, log *Log) {
+	// arrange
+	for _, value := range []string{"alice", "alice smith"} {
+		_, err := log.Append(&api.Record{Key: []byte("1"), Value: []byte(value)})
+		require.NoError(t, err)
+	}
+
+	// act
+	record, err := log.ReadByKey([]byte("1"))
+
+	// assert
+	require.NoError(t, err)
+	require.Equal(t, "alice smith", string(record.Value))
+}
+
+func testWait(t *testing.T, log *Log) {
+	// arrange
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	time.AfterFunc(10*time.Millisecond, func() {
+		_, _ = log.Append(&api.Record{Value: []byte("hello world")})
+	})
+
+	// act
+	err := log.Wait(ctx, 0)
+
+	// assert
+	require.NoError(t, err)
+	_, err = log.Read(0)
+	require.NoError(t, err)
+	expired, cancelExpired := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancelExpired()
+	require.ErrorIs(t, log.Wait(expired, 1), context.DeadlineExceeded)
+}
+
+func testTruncate(t *testing.T, log *Log) {
+	// arrange
+	var last uint64
+	for i := 0; i < 5; i++ {
+		off, err := log.Append(&api.Record{Value: []byte("hello world")})
+		require.NoError(t, err)
+		last = off
+	}
+
+	// act
+	err := log.Truncate(last - 1)
+
+	// assert
+	require.NoError(t, err)
+	lowest, err := log.LowestOffset()
+	require.NoError(t, err)
+	require.NotZero(t, lowest)
+	_, err = log.Read(0)
+	require.IsType(t, api.ErrOffsetOutOfRange{}, err)
+	highest, err := log.HighestOffset()
+	require.NoError(t, err)
+	require.Equal(t, last, highest)
+}
@@ -0,0 +1,195 @@
+// Package proglogtest runs proglog clusters in-process, so applications using
+// proglog can integration-test against it. The clusters' certificates and ACL
+// are generated for each test, nothing beyond the test's temporary directory
+// is needed.
+package proglogtest
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	api "github.com/justagabriel/proglog/api/v1"
+	"github.com/justagabriel/proglog/client"
+	"github.com/justagabriel/proglog/internal"
+	"github.com/justagabriel/proglog/internal/agent"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// host is the address the nodes bind to and clients reach them at.
+const host = "localhost"
+
+// The subjects of the clients, the ACL allows Root all actions and Nobody
+// none.
+const (
+	Root   = "root"
+	Nobody = "nobody"
+)
+
+// aclModel matches the subjects' actions on objects like "topic/orders",
+// policy objects may end in a wildcard like "topic/*".
+const aclModel = `[request_definition]
+r = sub, obj, act
+
+[policy_definition]
+p = sub, obj, act
+
+[policy_effect]
+e = some(where (p.eft == allow))
+
+[matchers]
+m = r.sub == p.sub && keyMatch(r.obj, p.obj) && r.act == p.act
+`
+
+type Config struct {
+	// Nodes is the size of the cluster, defaults to a single node.
+	Nodes int
+	// Policies are added to the ACL, e.g. "p, billing, topic/orders, get",
+	// whose subjects' clients are returned by Cluster.Client.
+	Policies []string
+	// ReadyTimeout bounds waiting for the nodes to join the cluster and elect
+	// the leader, defaults to 10 seconds.
+	ReadyTimeout time.Duration
+}
+
+// Cluster is a proglog cluster running in-process, it's shut down once the
+// test finished.
+type Cluster struct {
+	// Addrs are the nodes' RPC addresses, the first node is the leader.
+	Addrs []string
+
+	t      testing.TB
+	ca     *authority
+	agents []*agent.Agent
+}
+
+// New starts a cluster and waits until its nodes joined and elected the
+// first node leader.
+func New(t testing.TB, config Config) *Cluster {
+	t.Helper()
+	if config.Nodes == 0 {
+		config.Nodes = 1
+	}
+	if config.ReadyTimeout == 0 {
+		config.ReadyTimeout = 10 * time.Second
+	}
+
+	ca, err := newAuthority()
+	require.NoError(t, err)
+	serverTLSConfig, err := ca.serverTLSConfig()
+	require.NoError(t, err)
+	peerTLSConfig, err := ca.clientTLSConfig(Root)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	modelFile := filepath.Join(dir, "model.conf")
+	policyFile := filepath.Join(dir, "policy.csv")
+	require.NoError(t, os.WriteFile(modelFile, []byte(aclModel), 0o600))
+	policies := append([]string{
+		fmt.Sprintf("p, %s, *, create", Root),
+		fmt.Sprintf("p, %s, *, get", Root),
+		fmt.Sprintf("p, %s, *, admin", Root),
+	}, config.Policies...)
+	require.NoError(t, os.WriteFile(policyFile, []byte(strings.Join(policies, "\n")+"\n"), 0o600))
+
+	c := &Cluster{t: t, ca: ca}
+	t.Cleanup(c.shutdown)
+	for i := 0; i < config.Nodes; i++ {
+		// the nodes gossip on their RPC ports, which they join the first one at
+		var startJoinAddrs []string
+		if i > 0 {
+			startJoinAddrs = []string{c.Addrs[0]}
+		}
+		a, err := agent.New(agent.Config{
+			ServerTLSConfig: serverTLSConfig,
+			PeerTLSConfig:   peerTLSConfig,
+			SerfOnRPCPort:   true,
+			DataDir:         filepath.Join(dir, fmt.Sprintf("node-%d", i)),
+			BindAddr:        fmt.Sprintf("%s:%d", host, internal.FreePort(t)),
+			RPCPort:         internal.FreePort(t),
+			NodeName:        fmt.Sprintf("%d", i),
+			StartJoinAddr:   startJoinAddrs,
+			ACLModelFile:    modelFile,
+			ACLPolicyFile:   policyFile,
+			Bootstrap:       i == 0,
+			LogLevel:        "warn",
+		})
+		require.NoError(t, err)
+		c.agents = append(c.agents, a)
+		addr, err := a.Config.RPCAddr()
+		require.NoError(t, err)
+		c.Addrs = append(c.Addrs, addr)
+	}
+
+	c.waitReady(config.ReadyTimeout)
+	return c
+}
+
+// waitReady waits until every node knows all nodes and the leader.
+func (c *Cluster) waitReady(timeout time.Duration) {
+	c.t.Helper()
+	for _, addr := range c.Addrs {
+		conn, err := grpc.Dial(addr, c.DialOptions(Root)...)
+		require.NoError(c.t, err)
+		ready := func() bool {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			res, err := api.NewLogClient(conn).GetServers(ctx, &api.GetServersRequest{})
+			if err != nil || len(res.Servers) != len(c.Addrs) {
+				return false
+			}
+			for _, server := range res.Servers {
+				if server.IsLeader {
+					return true
+				}
+			}
+			return false
+		}
+		require.Eventually(c.t, ready, timeout, 50*time.Millisecond, "node %s isn't ready", addr)
+		conn.Close()
+	}
+}
+
+// TLSConfig returns the client TLS config authenticating as the subject.
+func (c *Cluster) TLSConfig(subject string) *tls.Config {
+	c.t.Helper()
+	tlsConfig, err := c.ca.clientTLSConfig(subject)
+	require.NoError(c.t, err)
+	return tlsConfig
+}
+
+// DialOptions authenticate as the subject, for clients dialing the nodes
+// themselves.
+func (c *Cluster) DialOptions(subject string) []grpc.DialOption {
+	c.t.Helper()
+	return []grpc.DialOption{grpc.WithTransportCredentials(credentials.NewTLS(c.TLSConfig(subject)))}
+}
+
+// Client returns a client of the leader authenticated as the subject, it's
+// closed once the test finished. Followers forward writes to the leader, so
+// reads of the leader observe the client's writes.
+func (c *Cluster) Client(subject string) *client.Client {
+	c.t.Helper()
+	cl, err := client.New(client.Config{
+		Addr:        c.Addrs[0],
+		DialOptions: c.DialOptions(subject),
+	})
+	require.NoError(c.t, err)
+	c.t.Cleanup(func() { cl.Close() })
+	return cl
+}
+
+func (c *Cluster) shutdown() {
+	for _, a := range c.agents {
+		if err := a.Shutdown(); err != nil {
+			c.t.Errorf("failed to shut down node %s: %v", a.Config.NodeName, err)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package proglogtest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	api "github.com/justagabriel/proglog/api/v1"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestCluster(t *testing.T) {
+	scenarios := map[string]func(t *testing.T){
+		"single node serves clients":          testClusterSingleNode,
+		"followers replicate the records":     testClusterReplicates,
+		"policies authorize further subjects": testClusterPolicies,
+	}
+
+	for scenario, fn := range scenarios {
+		t.Run(scenario, fn)
+	}
+}
+
+func testClusterSingleNode(t *testing.T) {
+	// arrange
+	cluster := New(t, Config{})
+	ctx := context.Background()
+
+	// act
+	res, err := cluster.Client(Root).Create(ctx, &api.CreateRecordRequest{Record: &api.Record{Value: []byte("hello world")}})
+
+	// assert
+	require.NoError(t, err)
+	read, err := cluster.Client(Root).Get(ctx, &api.GetRecordRequest{Offset: res.Offset})
+	require.NoError(t, err)
+	require.Equal(t, []byte("hello world"), read.Record.Value)
+	_, err = cluster.Client(Nobody).Get(ctx, &api.GetRecordRequest{Offset: res.Offset})
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+}
+
+func testClusterReplicates(t *testing.T) {
+	// arrange
+	cluster := New(t, Config{Nodes: 3})
+	ctx := context.Background()
+
+	// act
+	res, err := cluster.Client(Root).Create(ctx, &api.CreateRecordRequest{Record: &api.Record{Value: []byte("hello world")}})
+	require.NoError(t, err)
+
+	// assert
+	require.Len(t, cluster.Addrs, 3)
+	for _, addr := range cluster.Addrs[1:] {
+		conn, err := grpc.Dial(addr, cluster.DialOptions(Root)...)
+		require.NoError(t, err)
+		defer conn.Close()
+		follower := api.NewLogClient(conn)
+		require.Eventually(t, func() bool {
+			read, err := follower.Get(ctx, &api.GetRecordRequest{Offset: res.Offset})
+			return err == nil && string(read.Record.Value) == "hello world"
+		}, 5*time.Second, 50*time.Millisecond)
+	}
+}
+
+func testClusterPolicies(t *testing.T) {
+	// arrange
+	cluster := New(t, Config{Policies: []string{"p, billing, topic/orders, create"}})
+	client := cluster.Client("billing")
+	ctx := context.Background()
+
+	// act
+	_, allowedErr := client.Create(ctx, &api.CreateRecordRequest{Topic: "orders", Record: &api.Record{Value: []byte("order 0")}})
+	_, deniedErr := client.Create(ctx, &api.CreateRecordRequest{Topic: "payments", Record: &api.Record{Value: []byte("payment 0")}})
+
+	// assert
+	require.NoError(t, allowedErr)
+	require.Equal(t, codes.PermissionDenied, status.Code(deniedErr))
+}